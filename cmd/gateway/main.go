@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
+	"fmt"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
@@ -16,9 +19,22 @@ import (
 
 func main() {
 	configPath := flag.String("config", "config.yaml", "path to configuration file")
+	selfTest := flag.Bool("selftest", false, "send a minimal completion to every configured provider/model pair and exit")
+	checkOnly := flag.Bool("check-config", false, "validate the configuration, rule expressions and secrets, then exit 0 if valid or 1 otherwise")
 	flag.Parse()
 
 	cfg, err := config.Load(*configPath)
+	if *checkOnly {
+		if err == nil {
+			err = checkConfig(cfg)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "config %s is invalid: %v\n", *configPath, err)
+			os.Exit(1)
+		}
+		fmt.Printf("config %s is valid\n", *configPath)
+		return
+	}
 	if err != nil {
 		log.Errorf("load config: %v", err)
 		return
@@ -30,11 +46,28 @@ func main() {
 		log.Debug("Debug logging enabled")
 	}
 
+	if *selfTest {
+		gw, err := gateway.New(cfg, nil)
+		if err != nil {
+			log.Errorf("init gateway: %v", err)
+			os.Exit(1)
+		}
+		if !runSelfTest(gw) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	log.Infof("Starting OpenAI Cost Optimal Gateway on %s", cfg.Listen)
 
 	var usageStore storage.Store
 	if cfg.SaveUsage {
-		usageStore, err = storage.New(context.Background(), cfg.StorageType, cfg.StorageURI)
+		opts := storageOptions(cfg)
+		if cfg.StoragePartitionByTenant {
+			usageStore, err = storage.NewPartitioned(context.Background(), cfg.StorageType, cfg.StorageURI, opts...)
+		} else {
+			usageStore, err = storage.New(context.Background(), cfg.StorageType, cfg.StorageURI, opts...)
+		}
 		if err != nil {
 			log.Errorf("init usage storage: %v", err)
 			return
@@ -46,6 +79,16 @@ func main() {
 				log.Warningf("close usage storage: %v", cerr)
 			}
 		}()
+		if cfg.RequestLogEncryption != nil {
+			if err := enableRequestLogEncryption(cfg.RequestLogEncryption, usageStore); err != nil {
+				log.Errorf("request log encryption: %v", err)
+				return
+			}
+		}
+		if err := server.LoadStoredTenants(context.Background(), cfg, usageStore); err != nil {
+			log.Errorf("load tenants: %v", err)
+			return
+		}
 	}
 
 	gw, err := gateway.New(cfg, usageStore)
@@ -55,6 +98,7 @@ func main() {
 	}
 
 	srv := server.New(cfg, gw, usageStore)
+	srv.SetConfigPath(*configPath)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -64,3 +108,77 @@ func main() {
 		return
 	}
 }
+
+// enableRequestLogEncryption resolves the request log key and hands it to the store.
+// storageOptions converts the sqlite settings of cfg to storage options.
+func storageOptions(cfg *config.Config) []storage.Option {
+	if cfg.SQLite == nil {
+		return nil
+	}
+	return []storage.Option{storage.WithSQLite(storage.SQLiteOptions{
+		JournalMode:        cfg.SQLite.JournalMode,
+		Synchronous:        cfg.SQLite.Synchronous,
+		BusyTimeout:        time.Duration(cfg.SQLite.BusyTimeoutMs) * time.Millisecond,
+		WriteBatchSize:     cfg.SQLite.WriteBatchSize,
+		WriteFlushInterval: time.Duration(cfg.SQLite.WriteFlushMs) * time.Millisecond,
+		CheckpointInterval: time.Duration(cfg.SQLite.CheckpointIntervalSeconds) * time.Second,
+	})}
+}
+
+func enableRequestLogEncryption(cfg *config.RequestLogEncryptionConfig, store storage.Store) error {
+	encrypter, ok := store.(storage.RequestLogEncrypter)
+	if !ok {
+		return fmt.Errorf("storage does not support request log encryption")
+	}
+	key, err := cfg.ResolveKey()
+	if err != nil {
+		return err
+	}
+	return encrypter.SetRequestLogKey(key)
+}
+
+// checkConfig performs the startup steps that can fail on a loaded
+// configuration without opening storage or listening: compiling the routing
+// rules and alert expressions and resolving the configured secrets.
+func checkConfig(cfg *config.Config) error {
+	if _, err := gateway.New(cfg, nil); err != nil {
+		return fmt.Errorf("init gateway: %w", err)
+	}
+	if cfg.RequestLogEncryption != nil {
+		if _, err := cfg.RequestLogEncryption.ResolveKey(); err != nil {
+			return fmt.Errorf("request log encryption: %w", err)
+		}
+	}
+	if cfg.TLS != nil && cfg.TLS.CertFile != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile); err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+	}
+	return nil
+}
+
+func runSelfTest(gw *gateway.Gateway) bool {
+	results := gw.SelfTest(context.Background())
+	if len(results) == 0 {
+		fmt.Println("No provider/model pairs configured.")
+		return true
+	}
+
+	ok := true
+	for _, res := range results {
+		status := "OK  "
+		if !res.Success {
+			status = "FAIL"
+			ok = false
+		}
+		fmt.Printf("[%s] %s -> %s (%s) latency=%s", status, res.Model, res.Provider, res.UpstreamModel, res.Latency.Round(time.Millisecond))
+		if res.ReturnedModel != "" {
+			fmt.Printf(" returned_model=%s", res.ReturnedModel)
+		}
+		if res.Error != "" {
+			fmt.Printf(" error=%s", res.Error)
+		}
+		fmt.Println()
+	}
+	return ok
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+const liteLLMConfigDescription = "# Generated by gatewayctl import-litellm from %s\n# Review the providers, access tokens and API keys before using in production.\n"
+
+func runImportLiteLLM(args []string) error {
+	fs := flag.NewFlagSet("import-litellm", flag.ContinueOnError)
+	input := fs.String("input", "", "LiteLLM proxy config.yaml to convert")
+	output := fs.String("output", "", "write configuration to the given file instead of stdout")
+	force := fs.Bool("force", false, "overwrite the output file if it already exists")
+	noEnv := fs.Bool("no-env", false, "do not resolve API keys from the environment")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return errors.New("--input is required")
+	}
+
+	data, err := os.ReadFile(*input)
+	if err != nil {
+		return fmt.Errorf("read litellm config: %w", err)
+	}
+	getenv := os.Getenv
+	if *noEnv {
+		getenv = func(string) string { return "" }
+	}
+	cfg, warnings, err := config.ConvertLiteLLM(data, getenv)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("converted configuration is invalid: %w", err)
+	}
+
+	rendered, err := marshalConfig(cfg)
+	if err != nil {
+		return err
+	}
+	rendered = fmt.Sprintf(liteLLMConfigDescription, *input) + rendered
+
+	if *output == "" {
+		fmt.Print(rendered)
+		return nil
+	}
+	if !*force {
+		if _, err := os.Stat(*output); err == nil {
+			return fmt.Errorf("file %s already exists (use --force to overwrite)", *output)
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("check output path: %w", err)
+		}
+	}
+	if err := os.WriteFile(*output, []byte(rendered), 0o600); err != nil {
+		return fmt.Errorf("write configuration: %w", err)
+	}
+	fmt.Printf("Configuration written to %s\n", *output)
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"math"
 	"os"
 	"sort"
 	"strconv"
@@ -38,6 +39,20 @@ func run(args []string) error {
 		return runAddProvider(args[1:])
 	case "add-model":
 		return runAddModel(args[1:])
+	case "import-litellm":
+		return runImportLiteLLM(args[1:])
+	case "export-state":
+		return runExportState(args[1:])
+	case "import-state":
+		return runImportState(args[1:])
+	case "migrate-storage":
+		return runMigrateStorage(args[1:])
+	case "route-test":
+		return runRouteTest(args[1:])
+	case "tail":
+		return runTail(args[1:])
+	case "usage":
+		return runUsage(args[1:])
 	case "help", "-h", "--help":
 		printUsage()
 		return nil
@@ -51,10 +66,17 @@ func printUsage() {
 	fmt.Println(`Usage: gatewayctl <command> [options]
 
 Commands:
-  init           Generate a starter configuration file
-  preview        Validate and preview routing behavior from a configuration
-  add-provider   Append a provider definition to an existing configuration
-  add-model      Append a logical model to an existing configuration
+  init             Generate a starter configuration file
+  preview          Validate and preview routing behavior from a configuration
+  add-provider     Append a provider definition to an existing configuration
+  add-model        Append a logical model to an existing configuration
+  import-litellm   Convert a LiteLLM proxy config.yaml into a gateway configuration
+  export-state     Save a running gateway's effective configuration and onboarded tenants to a file
+  import-state     Import the tenants of an exported state file into a running gateway
+  migrate-storage  Copy usage records and request logs to another storage backend
+  route-test       Show which rule and provider order a request would be routed with
+  tail             Stream requests from a running gateway as they complete
+  usage            Summarize a running gateway's usage by model, provider or day
 
 Use "gatewayctl <command> --help" to see command-specific options.`)
 }
@@ -71,7 +93,7 @@ func runInit(args []string) error {
 		Listen:  "0.0.0.0:8000",
 		Debug:   false,
 		Default: "openai-official",
-		APIKeys: []string{"sk-your-gateway-key"},
+		APIKeys: config.APIKeys{{Key: "sk-your-gateway-key"}},
 		Providers: []config.ProviderConfig{{
 			ID:          "openai-official",
 			Type:        config.ProviderTypeOpenAI,
@@ -206,7 +228,7 @@ func runAddProvider(args []string) error {
 	confPath := fs.String("conf", "config.yaml", "path to the configuration file")
 	apply := fs.Bool("apply", false, "write the updated configuration back to the file")
 	id := fs.String("id", "", "unique provider identifier")
-	providerType := fs.String("type", string(config.ProviderTypeOpenAI), "provider type (openai, anthropic, ...)")
+	providerType := fs.String("type", string(config.ProviderTypeOpenAI), "provider type (openai, anthropic, openrouter)")
 	baseURL := fs.String("base_url", "", "provider base URL")
 	accessToken := fs.String("access_token", "", "provider access token")
 	timeoutStr := fs.String("timeout", "", "optional request timeout, e.g. 30s")
@@ -219,6 +241,9 @@ func runAddProvider(args []string) error {
 	if *id == "" {
 		return errors.New("--id is required")
 	}
+	if *baseURL == "" && config.ProviderType(*providerType) == config.ProviderTypeOpenRouter {
+		*baseURL = config.OpenRouterBaseURL
+	}
 	if *baseURL == "" {
 		return errors.New("--base_url is required")
 	}
@@ -352,7 +377,29 @@ func marshalConfig(cfg *config.Config) (string, error) {
 	} else {
 		writeLine(&b, "api_keys:")
 		for _, key := range cfg.APIKeys {
-			writeLine(&b, "  - %s", quoteString(key))
+			if key.Name == "" && key.Owner == "" && len(key.Tags) == 0 && key.ExpiresAt == "" && key.Enabled == nil {
+				writeLine(&b, "  - %s", quoteString(key.Key))
+				continue
+			}
+			writeLine(&b, "  - key: %s", quoteString(key.Key))
+			if key.Name != "" {
+				writeLine(&b, "    name: %s", quoteString(key.Name))
+			}
+			if key.Owner != "" {
+				writeLine(&b, "    owner: %s", quoteString(key.Owner))
+			}
+			if len(key.Tags) > 0 {
+				writeLine(&b, "    tags:")
+				for _, tag := range key.Tags {
+					writeLine(&b, "      - %s", quoteString(tag))
+				}
+			}
+			if key.ExpiresAt != "" {
+				writeLine(&b, "    expires_at: %s", quoteString(key.ExpiresAt))
+			}
+			if key.Enabled != nil {
+				writeLine(&b, "    enabled: %t", *key.Enabled)
+			}
 		}
 	}
 
@@ -369,18 +416,20 @@ func marshalConfig(cfg *config.Config) (string, error) {
 			writeLine(&b, "    base_url: %s", quoteString(provider.BaseURL))
 			writeLine(&b, "    access_token: %s", quoteString(provider.AccessToken))
 			if provider.Timeout > 0 {
-				writeLine(&b, "    timeout: %s", quoteString(provider.Timeout.String()))
+				// timeouts are read as seconds
+				writeLine(&b, "    timeout: %d", int64(math.Ceil(provider.Timeout.Seconds())))
 			}
-			if len(provider.Headers) > 0 {
-				keys := make([]string, 0, len(provider.Headers))
-				for k := range provider.Headers {
-					keys = append(keys, k)
+			writeStringMap(&b, "    ", "headers", provider.Headers)
+			writeStringMap(&b, "    ", "paths", provider.Paths)
+			if openRouter := provider.OpenRouter; openRouter != nil {
+				writeLine(&b, "    openrouter:")
+				if openRouter.Referer != "" {
+					writeLine(&b, "      referer: %s", quoteString(openRouter.Referer))
 				}
-				sort.Strings(keys)
-				writeLine(&b, "    headers:")
-				for _, key := range keys {
-					writeLine(&b, "      %s: %s", quoteString(key), quoteString(provider.Headers[key]))
+				if openRouter.Title != "" {
+					writeLine(&b, "      title: %s", quoteString(openRouter.Title))
 				}
+				writeLine(&b, "      fallback: %t", openRouter.Fallback)
 			}
 		}
 	}
@@ -423,9 +472,35 @@ func marshalConfig(cfg *config.Config) (string, error) {
 		}
 	}
 
+	if len(cfg.Alias) > 0 {
+		b.WriteString("\n")
+		writeLine(&b, "alias:")
+		for _, alias := range cfg.Alias {
+			writeLine(&b, "  - model: %s", quoteString(alias.Model))
+			writeLine(&b, "    target: %s", quoteString(alias.Target))
+		}
+	}
+
 	return b.String(), nil
 }
 
+// writeStringMap writes a mapping of strings sorted by key; empty mappings are omitted.
+func writeStringMap(b *strings.Builder, indent, key string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	writeLine(b, "%s%s:", indent, key)
+	for _, k := range keys {
+		// keys stay unquoted, the configuration loader keeps quotes of keys
+		writeLine(b, "%s  %s: %s", indent, k, quoteString(values[k]))
+	}
+}
+
 func providerTypeLabel(t config.ProviderType) string {
 	if t == "" {
 		return "openai"
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func runMigrateStorage(args []string) error {
+	fs := flag.NewFlagSet("migrate-storage", flag.ContinueOnError)
+	confPath := fs.String("conf", "", "configuration file providing the source storage and the request log encryption key")
+	fromType := fs.String("from-type", "", "source storage type (defaults to storage_type of --conf)")
+	fromURI := fs.String("from-uri", "", "source storage URI (defaults to storage_uri of --conf)")
+	toType := fs.String("to-type", "", "destination storage type, e.g. sqlite")
+	toURI := fs.String("to-uri", "", "destination storage URI")
+	toPartitioned := fs.Bool("to-partition-by-tenant", false, "write each tenant's records to its own partition, like storage_partition_by_tenant")
+	batch := fs.Int("batch", 500, "number of records copied per batch")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *toType == "" || *toURI == "" {
+		return errors.New("--to-type and --to-uri are required")
+	}
+	if *batch <= 0 {
+		return errors.New("--batch must be positive")
+	}
+
+	var encryption *config.RequestLogEncryptionConfig
+	fromPartitioned := false
+	if *confPath != "" {
+		cfg, err := config.Load(*confPath)
+		if err != nil {
+			return err
+		}
+		if *fromType == "" {
+			*fromType = cfg.StorageType
+		}
+		if *fromURI == "" {
+			*fromURI = cfg.StorageURI
+		}
+		encryption = cfg.RequestLogEncryption
+		fromPartitioned = cfg.StoragePartitionByTenant
+	}
+	if *fromType == "" || *fromURI == "" {
+		return errors.New("--conf or --from-type and --from-uri are required")
+	}
+	if *fromType == *toType && *fromURI == *toURI {
+		return errors.New("source and destination are the same storage")
+	}
+
+	ctx := context.Background()
+	source, err := openMigrationStore(ctx, *fromType, *fromURI, fromPartitioned, encryption)
+	if err != nil {
+		return fmt.Errorf("open source storage: %w", err)
+	}
+	defer source.Close(ctx)
+	dest, err := openMigrationStore(ctx, *toType, *toURI, *toPartitioned, encryption)
+	if err != nil {
+		return fmt.Errorf("open destination storage: %w", err)
+	}
+	defer dest.Close(ctx)
+
+	exporter, ok := source.(storage.Exporter)
+	if !ok {
+		return fmt.Errorf("storage %s does not support export", *fromType)
+	}
+	importer, _ := dest.(storage.Importer)
+
+	usage, err := copyBatches(ctx, "usage records",
+		func(afterID int64) ([]storage.UsageRecord, int64, error) {
+			records, err := exporter.ExportUsage(ctx, afterID, *batch)
+			if err != nil || len(records) == 0 {
+				return nil, 0, err
+			}
+			lastID := records[len(records)-1].ID
+			for i := range records {
+				records[i].ID = 0
+			}
+			return records, lastID, nil
+		},
+		func(records []storage.UsageRecord) error {
+			if importer != nil {
+				return importer.ImportUsage(ctx, records)
+			}
+			for _, record := range records {
+				if err := dest.RecordUsage(ctx, record); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	logs, err := copyBatches(ctx, "request logs",
+		func(afterID int64) ([]storage.RequestLog, int64, error) {
+			logs, err := exporter.ExportRequestLogs(ctx, afterID, *batch)
+			if err != nil || len(logs) == 0 {
+				return nil, 0, err
+			}
+			lastID := logs[len(logs)-1].ID
+			for i := range logs {
+				logs[i].ID = 0
+			}
+			return logs, lastID, nil
+		},
+		func(logs []storage.RequestLog) error {
+			if importer != nil {
+				return importer.ImportRequestLogs(ctx, logs)
+			}
+			for _, log := range logs {
+				if err := dest.RecordRequestLog(ctx, log); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Migrated %d usage records and %d request logs from %s to %s.\n", usage, logs, *fromType, *toType)
+	return nil
+}
+
+// openMigrationStore opens a storage, with its tenant partitions when
+// partitioned, so migrations read and write the records of every tenant.
+func openMigrationStore(ctx context.Context, driver, uri string, partitioned bool, encryption *config.RequestLogEncryptionConfig) (storage.Store, error) {
+	open := storage.New
+	if partitioned {
+		open = storage.NewPartitioned
+	}
+	store, err := open(ctx, driver, uri)
+	if err != nil {
+		return nil, err
+	}
+	if encryption == nil {
+		return store, nil
+	}
+	encrypter, ok := store.(storage.RequestLogEncrypter)
+	if !ok {
+		store.Close(ctx)
+		return nil, fmt.Errorf("storage %s does not support request log encryption", driver)
+	}
+	key, err := encryption.ResolveKey()
+	if err == nil {
+		err = encrypter.SetRequestLogKey(key)
+	}
+	if err != nil {
+		store.Close(ctx)
+		return nil, err
+	}
+	return store, nil
+}
+
+// copyBatches reads batches after the last id seen until read returns none,
+// writes each one and prints the progress.
+func copyBatches[T any](ctx context.Context, name string, read func(afterID int64) ([]T, int64, error), write func([]T) error) (int, error) {
+	var afterID int64
+	copied := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return copied, err
+		}
+		items, lastID, err := read(afterID)
+		if err != nil {
+			return copied, fmt.Errorf("read %s: %w", name, err)
+		}
+		if len(items) == 0 {
+			return copied, nil
+		}
+		if err := write(items); err != nil {
+			return copied, fmt.Errorf("write %s after id %d: %w", name, afterID, err)
+		}
+		copied += len(items)
+		afterID = lastID
+		fmt.Printf("  %s: %d copied\n", name, copied)
+	}
+}
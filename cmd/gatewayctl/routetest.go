@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tidwall/sjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/gateway"
+)
+
+func runRouteTest(args []string) error {
+	fs := flag.NewFlagSet("route-test", flag.ContinueOnError)
+	confPath := fs.String("conf", "config.yaml", "path to the configuration file")
+	model := fs.String("model", "", "model to route; overrides the model of the request body")
+	bodyPath := fs.String("body", "", "JSON request body to route (defaults to an empty chat request)")
+	path := fs.String("path", "/v1/chat/completions", "request path: /v1/chat/completions, /v1/responses or /v1/messages")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	reqType, err := requestTypeOf(*path)
+	if err != nil {
+		return err
+	}
+	body := []byte(`{"messages":[]}`)
+	if *bodyPath != "" {
+		if body, err = os.ReadFile(*bodyPath); err != nil {
+			return fmt.Errorf("read request body: %w", err)
+		}
+	}
+	if *model != "" {
+		if body, err = sjson.SetBytes(body, "model", *model); err != nil {
+			return fmt.Errorf("set model: %w", err)
+		}
+	}
+
+	cfg, err := config.Load(*confPath)
+	if err != nil {
+		return err
+	}
+	gw, err := gateway.New(cfg, nil)
+	if err != nil {
+		return err
+	}
+	plan, err := gw.DryRun(body, reqType, *path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Model      : %s", plan.Model)
+	if plan.ResolvedModel != plan.Model {
+		fmt.Printf(" -> %s", plan.ResolvedModel)
+	}
+	fmt.Println()
+	fmt.Printf("Route      : %s\n", plan.Route)
+	fmt.Printf("Tokens     : %d\n", plan.TokenCount)
+	if plan.Route == gateway.RouteModel {
+		if plan.Rule != "" {
+			fmt.Printf("Rule       : %s\n", plan.Rule)
+		} else {
+			fmt.Println("Rule       : <none, default order>")
+		}
+	}
+	if len(plan.Unsupported) > 0 {
+		fmt.Printf("Skipped    : candidates without %s\n", strings.Join(plan.Unsupported, ", "))
+	}
+	if len(plan.Providers) == 0 {
+		return errors.New("no provider can serve this request")
+	}
+	fmt.Println("Providers  :")
+	for idx, p := range plan.Providers {
+		fmt.Printf("  %d. %s (as %s)\n", idx+1, p.Provider, p.Model)
+	}
+	return nil
+}
+
+func requestTypeOf(path string) (gateway.RequestType, error) {
+	switch path {
+	case "/v1/chat/completions":
+		return gateway.RequestTypeChatCompletions, nil
+	case "/v1/responses":
+		return gateway.RequestTypeResponses, nil
+	case "/v1/messages":
+		return gateway.RequestTypeAnthropicMessages, nil
+	default:
+		return 0, fmt.Errorf("unsupported path %q", path)
+	}
+}
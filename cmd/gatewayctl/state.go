@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+func runExportState(args []string) error {
+	fs := flag.NewFlagSet("export-state", flag.ContinueOnError)
+	gatewayURL := fs.String("url", envOr("GATEWAY_URL", "http://127.0.0.1:8000"), "gateway base URL (env GATEWAY_URL)")
+	apiKey := fs.String("key", os.Getenv("GATEWAY_API_KEY"), "admin API key (env GATEWAY_API_KEY)")
+	output := fs.String("output", "", "file to write the state to (required)")
+	timeout := fs.Duration("timeout", 30*time.Second, "request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		return errors.New("--output is required")
+	}
+
+	data, err := callState(&http.Client{Timeout: *timeout}, http.MethodGet, *gatewayURL, *apiKey, "", nil)
+	if err != nil {
+		return fmt.Errorf("export state: %w", err)
+	}
+	var snapshot struct {
+		Tenants []json.RawMessage `json:"tenants"`
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("decode state: %w", err)
+	}
+	// The state holds provider tokens and API keys.
+	if err := os.WriteFile(*output, data, 0o600); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	fmt.Printf("Exported the effective configuration and %d onboarded tenants to %s.\n", len(snapshot.Tenants), *output)
+	return nil
+}
+
+func runImportState(args []string) error {
+	fs := flag.NewFlagSet("import-state", flag.ContinueOnError)
+	gatewayURL := fs.String("url", envOr("GATEWAY_URL", "http://127.0.0.1:8000"), "gateway base URL (env GATEWAY_URL)")
+	apiKey := fs.String("key", os.Getenv("GATEWAY_API_KEY"), "admin API key (env GATEWAY_API_KEY)")
+	input := fs.String("file", "", "state file written by export-state (required)")
+	dryRun := fs.Bool("dry-run", false, "report what would be imported without changing the gateway")
+	timeout := fs.Duration("timeout", 30*time.Second, "request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return errors.New("--file is required")
+	}
+	state, err := os.ReadFile(*input)
+	if err != nil {
+		return fmt.Errorf("read state: %w", err)
+	}
+
+	query := ""
+	if *dryRun {
+		query = "dry_run=true"
+	}
+	data, err := callState(&http.Client{Timeout: *timeout}, http.MethodPost, *gatewayURL, *apiKey, query, state)
+	if err != nil {
+		return fmt.Errorf("import state: %w", err)
+	}
+	var result struct {
+		Imported      []string `json:"imported"`
+		Skipped       []string `json:"skipped"`
+		ConfigSummary []string `json:"config_summary"`
+		ConfigApplied bool     `json:"config_applied"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("decode import result: %w", err)
+	}
+
+	verb := "Imported"
+	if *dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d tenants: %s\n", verb, len(result.Imported), joinOrNone(result.Imported))
+	fmt.Printf("Skipped %d existing tenants: %s\n", len(result.Skipped), joinOrNone(result.Skipped))
+	if len(result.ConfigSummary) == 0 {
+		fmt.Println("The configuration routes like the target gateway.")
+		return nil
+	}
+	if result.ConfigApplied {
+		fmt.Println("Applied configuration changes, add them to the target's config file to keep them after a reload:")
+	} else {
+		fmt.Println("Configuration changes the import would apply:")
+	}
+	for _, line := range result.ConfigSummary {
+		fmt.Println("  " + line)
+	}
+	return nil
+}
+
+func callState(client *http.Client, method, baseURL, apiKey, query string, body []byte) ([]byte, error) {
+	if apiKey == "" {
+		return nil, errors.New("--key or GATEWAY_API_KEY is required")
+	}
+	endpoint := strings.TrimRight(baseURL, "/") + "/admin/state"
+	if query != "" {
+		endpoint += "?" + query
+	}
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gateway returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+func joinOrNone(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
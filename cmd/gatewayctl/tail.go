@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func runTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	gatewayURL := fs.String("url", envOr("GATEWAY_URL", "http://127.0.0.1:8000"), "gateway base URL (env GATEWAY_URL)")
+	apiKey := fs.String("key", os.Getenv("GATEWAY_API_KEY"), "API key with the read-usage or admin role (env GATEWAY_API_KEY)")
+	model := fs.String("model", "", "only show requests for this model")
+	provider := fs.String("provider", "", "only show requests served by this provider")
+	tenant := fs.String("tenant", "", "only show requests of this tenant")
+	raw := fs.Bool("json", false, "print each usage record as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *apiKey == "" {
+		return errors.New("--key or GATEWAY_API_KEY is required")
+	}
+
+	query := url.Values{}
+	for name, value := range map[string]string{"model": *model, "provider": *provider, "tenant": *tenant} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	endpoint := strings.TrimRight(*gatewayURL, "/") + "/usage/events"
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+*apiKey)
+	req.Header.Set("Accept", "text/event-stream")
+
+	// No client timeout: the stream stays open until interrupted.
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("connect to gateway: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("connect to gateway: gateway returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return readUsageEvents(resp.Body, func(data string) error {
+		if *raw {
+			fmt.Println(data)
+			return nil
+		}
+		var record storage.UsageRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			return fmt.Errorf("decode usage event: %w", err)
+		}
+		fmt.Println(formatUsageEvent(record))
+		return nil
+	})
+}
+
+// readUsageEvents calls handle with the data of each "usage" server-sent
+// event until the stream ends.
+func readUsageEvents(r io.Reader, handle func(data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	event, data := "", ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event == "usage" && data != "" {
+				if err := handle(data); err != nil {
+					return err
+				}
+			}
+			event, data = "", ""
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read events: %w", err)
+	}
+	return errors.New("event stream closed by the gateway")
+}
+
+func formatUsageEvent(rec storage.UsageRecord) string {
+	target := rec.Provider
+	if target == "" {
+		target = "-"
+	}
+	if rec.Model != "" && rec.Model != rec.OriginalModel {
+		target += " (" + rec.Model + ")"
+	}
+	latency := rec.Duration.Round(time.Millisecond).String()
+	if rec.FirstTokenLatency > 0 {
+		latency += " ttft " + rec.FirstTokenLatency.Round(time.Millisecond).String()
+	}
+	line := fmt.Sprintf("%s  %-8s %-20s -> %-32s %6d in %6d out  %-20s %s",
+		rec.CreatedAt.Local().Format("15:04:05"),
+		rec.Outcome,
+		rec.OriginalModel,
+		target,
+		rec.RequestTokens,
+		rec.ResponseTokens,
+		latency,
+		rec.RequestID,
+	)
+	if rec.Tenant != "" {
+		line += "  tenant=" + rec.Tenant
+	}
+	if rec.Error != "" {
+		line += "  error=" + truncate(rec.Error, 120)
+	}
+	return strings.TrimRight(line, " ")
+}
+
+func truncate(value string, max int) string {
+	value = strings.ReplaceAll(value, "\n", " ")
+	if len(value) <= max {
+		return value
+	}
+	return value[:max] + "..."
+}
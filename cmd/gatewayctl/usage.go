@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// usageRow aggregates the usage records sharing a model, provider, day or key.
+type usageRow struct {
+	Key            string
+	Requests       int
+	Failures       int
+	RequestTokens  int
+	ResponseTokens int
+	Duration       time.Duration
+}
+
+func runUsage(args []string) error {
+	fs := flag.NewFlagSet("usage", flag.ContinueOnError)
+	gatewayURL := fs.String("url", envOr("GATEWAY_URL", "http://127.0.0.1:8000"), "gateway base URL (env GATEWAY_URL)")
+	apiKey := fs.String("key", os.Getenv("GATEWAY_API_KEY"), "API key with the read-usage or admin role (env GATEWAY_API_KEY)")
+	by := fs.String("by", "model", "group records by model, provider, day or key")
+	format := fs.String("format", "table", "output format: table or csv")
+	limit := fs.Int("limit", 1000, "number of most recent records to fetch")
+	tenant := fs.String("tenant", "", "only include records of this tenant")
+	keyName := fs.String("key-name", "", "only include records of the API key with this name")
+	sinceStr := fs.String("since", "", "only include records created after this date (YYYY-MM-DD) or duration ago (e.g. 24h)")
+	timeout := fs.Duration("timeout", 30*time.Second, "request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keyOf, err := usageGrouping(*by)
+	if err != nil {
+		return err
+	}
+	if *format != "table" && *format != "csv" {
+		return fmt.Errorf("unsupported format %q, expected table or csv", *format)
+	}
+	var since time.Time
+	if *sinceStr != "" {
+		if since, err = parseSince(*sinceStr, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	records, err := fetchUsage(&http.Client{Timeout: *timeout}, *gatewayURL, *apiKey, *limit, *tenant, *keyName, since)
+	if err != nil {
+		return err
+	}
+	if len(records) >= *limit {
+		return fmt.Errorf("fetched the limit of %d records, the totals may be incomplete: raise --limit or narrow --since", *limit)
+	}
+	rows := aggregateUsage(records, since, keyOf)
+
+	if *format == "csv" {
+		return writeUsageCSV(os.Stdout, *by, rows)
+	}
+	return writeUsageTable(os.Stdout, *by, rows)
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func usageGrouping(by string) (func(storage.UsageRecord) string, error) {
+	switch by {
+	case "model":
+		return func(rec storage.UsageRecord) string { return rec.Model }, nil
+	case "provider":
+		return func(rec storage.UsageRecord) string { return rec.Provider }, nil
+	case "day":
+		return func(rec storage.UsageRecord) string { return rec.CreatedAt.Local().Format("2006-01-02") }, nil
+	case "key":
+		// Unnamed keys are told apart by their digest.
+		return func(rec storage.UsageRecord) string {
+			if rec.KeyName != "" {
+				return rec.KeyName
+			}
+			return rec.KeyID
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported grouping %q, expected model, provider, day or key", by)
+	}
+}
+
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q, expected YYYY-MM-DD or a duration", value)
+	}
+	return t, nil
+}
+
+func fetchUsage(client *http.Client, baseURL, apiKey string, limit int, tenant, keyName string, since time.Time) ([]storage.UsageRecord, error) {
+	if apiKey == "" {
+		return nil, errors.New("--key or GATEWAY_API_KEY is required")
+	}
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339))
+	}
+	if tenant != "" {
+		query.Set("tenant", tenant)
+	}
+	if keyName != "" {
+		query.Set("key_name", keyName)
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(baseURL, "/")+"/usage?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("query usage: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read usage response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("query usage: gateway returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var usage struct {
+		Data []storage.UsageRecord `json:"data"`
+	}
+	if err := json.Unmarshal(body, &usage); err != nil {
+		return nil, fmt.Errorf("decode usage response: %w", err)
+	}
+	return usage.Data, nil
+}
+
+// aggregateUsage groups the records created at or after since, sorted by key
+// (days ascending, models and providers by name).
+func aggregateUsage(records []storage.UsageRecord, since time.Time, keyOf func(storage.UsageRecord) string) []*usageRow {
+	byKey := make(map[string]*usageRow)
+	for _, rec := range records {
+		if !since.IsZero() && rec.CreatedAt.Before(since) {
+			continue
+		}
+		key := keyOf(rec)
+		if key == "" {
+			key = "<none>"
+		}
+		row, ok := byKey[key]
+		if !ok {
+			row = &usageRow{Key: key}
+			byKey[key] = row
+		}
+		row.Requests++
+		if !rec.Billable() {
+			row.Failures++
+		}
+		row.RequestTokens += rec.RequestTokens
+		row.ResponseTokens += rec.ResponseTokens
+		row.Duration += rec.Duration
+	}
+
+	rows := make([]*usageRow, 0, len(byKey))
+	for _, row := range byKey {
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Key < rows[j].Key })
+	return rows
+}
+
+func (r *usageRow) avgDurationMs() int64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return (r.Duration / time.Duration(r.Requests)).Milliseconds()
+}
+
+func usageColumns(by string) []string {
+	return []string{by, "requests", "failures", "request_tokens", "response_tokens", "total_tokens", "avg_duration_ms"}
+}
+
+func (r *usageRow) fields() []string {
+	return []string{
+		r.Key,
+		strconv.Itoa(r.Requests),
+		strconv.Itoa(r.Failures),
+		strconv.Itoa(r.RequestTokens),
+		strconv.Itoa(r.ResponseTokens),
+		strconv.Itoa(r.RequestTokens + r.ResponseTokens),
+		strconv.FormatInt(r.avgDurationMs(), 10),
+	}
+}
+
+func writeUsageCSV(w io.Writer, by string, rows []*usageRow) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(usageColumns(by)); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := out.Write(row.fields()); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func writeUsageTable(w io.Writer, by string, rows []*usageRow) error {
+	if len(rows) == 0 {
+		_, err := fmt.Fprintln(w, "No usage records found.")
+		return err
+	}
+	total := &usageRow{Key: "TOTAL"}
+	for _, row := range rows {
+		total.Requests += row.Requests
+		total.Failures += row.Failures
+		total.RequestTokens += row.RequestTokens
+		total.ResponseTokens += row.ResponseTokens
+		total.Duration += row.Duration
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	header := usageColumns(by)
+	for i := range header {
+		header[i] = strings.ToUpper(header[i])
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+	for _, row := range append(rows, total) {
+		fmt.Fprintln(tw, strings.Join(row.fields(), "\t")+"\t")
+	}
+	return tw.Flush()
+}
@@ -3,6 +3,7 @@ module github.com/mylxsw/openai-cost-optimal-gateway
 go 1.24.3
 
 require (
+	github.com/andybalholm/brotli v1.2.0
 	github.com/expr-lang/expr v1.17.6
 	github.com/google/uuid v1.3.0
 	github.com/mattn/go-sqlite3 v1.14.32
@@ -0,0 +1,115 @@
+// Package apierror writes the errors the gateway itself answers with in the
+// JSON format of the OpenAI API, or of the Anthropic API on /v1/messages, so
+// client SDKs can parse them like provider errors.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Codes of the errors the gateway answers with. The status determines the
+// error type; the code tells errors of the same type apart.
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeInvalidAPIKey      = "invalid_api_key"
+	CodeMissingAPIKey      = "missing_api_key"
+	CodeExpiredAPIKey      = "expired_api_key"
+	CodeDisabledAPIKey     = "disabled_api_key"
+	CodePermissionDenied   = "permission_denied"
+	CodeModelNotFound      = "model_not_found"
+	CodeModelNotAllowed    = "model_not_allowed"
+	CodeRateLimitExceeded  = "rate_limit_exceeded"
+	CodeBudgetExceeded     = "budget_exceeded"
+	CodeContentBlocked     = "content_blocked"
+	CodeNoProvider         = "no_provider_available"
+	CodeNotFound           = "not_found"
+	CodeNotSupported       = "not_supported"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeConflict           = "conflict"
+	CodeServiceUnavailable = "service_unavailable"
+	CodeInternal           = "internal_error"
+)
+
+type openAIError struct {
+	Error openAIErrorBody `json:"error"`
+}
+
+type openAIErrorBody struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+type anthropicError struct {
+	Type  string             `json:"type"`
+	Error anthropicErrorBody `json:"error"`
+}
+
+type anthropicErrorBody struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// Write answers r with an error of the given status. An empty code is sent as
+// null; Anthropic errors have no code.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	var body any
+	if r != nil && IsAnthropicPath(r.URL.Path) {
+		body = anthropicError{Type: "error", Error: anthropicErrorBody{Type: anthropicType(status), Message: message}}
+	} else {
+		e := openAIErrorBody{Message: message, Type: openAIType(status)}
+		if code != "" {
+			e.Code = &code
+		}
+		body = openAIError{Error: e}
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// IsAnthropicPath reports whether path is served in the Anthropic API format.
+func IsAnthropicPath(path string) bool {
+	return path == "/v1/messages" || strings.HasPrefix(path, "/v1/messages/")
+}
+
+func openAIType(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "authentication_error"
+	case status == http.StatusForbidden:
+		return "permission_error"
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case status >= http.StatusInternalServerError:
+		return "server_error"
+	default:
+		return "invalid_request_error"
+	}
+}
+
+func anthropicType(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "authentication_error"
+	case status == http.StatusForbidden:
+		return "permission_error"
+	case status == http.StatusNotFound:
+		return "not_found_error"
+	case status == http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case status == http.StatusServiceUnavailable:
+		return "overloaded_error"
+	case status >= http.StatusInternalServerError:
+		return "api_error"
+	default:
+		return "invalid_request_error"
+	}
+}
@@ -0,0 +1,33 @@
+package apierror
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	cases := []struct {
+		path   string
+		status int
+		code   string
+		want   string
+	}{
+		{"/v1/chat/completions", http.StatusNotFound, CodeModelNotFound, `{"error":{"message":"boom","type":"invalid_request_error","param":null,"code":"model_not_found"}}`},
+		{"/v1/responses", http.StatusTooManyRequests, CodeRateLimitExceeded, `{"error":{"message":"boom","type":"rate_limit_error","param":null,"code":"rate_limit_exceeded"}}`},
+		{"/admin/state", http.StatusInternalServerError, "", `{"error":{"message":"boom","type":"server_error","param":null,"code":null}}`},
+		{"/v1/messages", http.StatusNotFound, CodeModelNotFound, `{"type":"error","error":{"type":"not_found_error","message":"boom"}}`},
+		{"/v1/messages", http.StatusServiceUnavailable, CodeServiceUnavailable, `{"type":"error","error":{"type":"overloaded_error","message":"boom"}}`},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		Write(rec, httptest.NewRequest(http.MethodPost, tc.path, nil), tc.status, tc.code, "boom")
+		if rec.Code != tc.status || rec.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("%s: unexpected response %d %s", tc.path, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if got := strings.TrimSpace(rec.Body.String()); got != tc.want {
+			t.Fatalf("%s: unexpected body %s, want %s", tc.path, got, tc.want)
+		}
+	}
+}
@@ -1,25 +1,47 @@
 package config
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"os/exec"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/cron"
 )
 
 type ProviderType string
 
 const (
-	ProviderTypeOpenAI    ProviderType = "openai"
-	ProviderTypeAnthropic ProviderType = "anthropic"
+	ProviderTypeOpenAI     ProviderType = "openai"
+	ProviderTypeAnthropic  ProviderType = "anthropic"
+	ProviderTypeOpenRouter ProviderType = "openrouter"
 )
 
+// OpenRouterBaseURL is the base_url of openrouter providers without one.
+const OpenRouterBaseURL = "https://openrouter.ai/api/v1"
+
 type Config struct {
-	Listen         string           `json:"listen" yaml:"listen"`
-	APIKeys        []string         `json:"api_keys" yaml:"api_keys"`
+	Listen string `json:"listen" yaml:"listen"`
+	// TLS serves the listener over HTTPS and sets the TLS and HSTS policy
+	TLS *TLSConfig `json:"tls" yaml:"tls"`
+	// CORS lets browser clients call the gateway from the allowed origins
+	CORS *CORSConfig `json:"cors" yaml:"cors"`
+	// APIKeys may call the proxy routes; each entry is a key or a key object with a name, owner, tags and expiry
+	APIKeys   APIKeys  `json:"api_keys" yaml:"api_keys"`
+	AdminKeys []string `json:"admin_keys" yaml:"admin_keys"`
+	// Keys are API keys with explicit roles: proxy, read-usage and admin
+	Keys           []KeyConfig      `json:"keys" yaml:"keys"`
 	Providers      []ProviderConfig `json:"providers" yaml:"providers"`
 	Models         []ModelConfig    `json:"models" yaml:"models"`
 	Default        string           `json:"default_provider" yaml:"default_provider"`
@@ -30,13 +52,935 @@ type Config struct {
 	RetentionDays  int              `json:"retention_days" yaml:"retention_days"`
 	CleanupEnabled bool             `json:"cleanup_enabled" yaml:"cleanup_enabled"`
 	// CleanupIntervalHours controls how often the background cleanup runs; defaults to 6 if not set or <= 0
-	CleanupIntervalHours int           `json:"cleanup_interval_hours" yaml:"cleanup_interval_hours"`
-	Alias                []AliasConfig `json:"alias" yaml:"alias"`
+	CleanupIntervalHours int `json:"cleanup_interval_hours" yaml:"cleanup_interval_hours"`
+	// Retention sets how long each kind of stored data is kept by the cleanup task
+	Retention *RetentionConfig `json:"retention" yaml:"retention"`
+	Alias     []AliasConfig    `json:"alias" yaml:"alias"`
+	// Deprecations replace retired models before routing, e.g. gpt-4-32k: gpt-4o
+	Deprecations map[string]string `json:"deprecations" yaml:"deprecations"`
+	// Groups are virtual models that fail over across an ordered list of concrete models
+	Groups []GroupConfig `json:"groups" yaml:"groups"`
+	// DefaultLimits are the parameter limits of models without their own, such as discovered
+	// models and models sent to the default provider
+	DefaultLimits *ParamLimits `json:"default_limits" yaml:"default_limits"`
+	// ModelUnavailableTTLSeconds is how long a provider model that answered "model not found" is skipped; defaults to 600
+	ModelUnavailableTTLSeconds int `json:"model_unavailable_ttl_seconds" yaml:"model_unavailable_ttl_seconds"`
+	// StreamKeepaliveSeconds sends ": ping" comments to streaming clients while the provider is silent for that long; 0 disables it
+	StreamKeepaliveSeconds int `json:"stream_keepalive_seconds" yaml:"stream_keepalive_seconds"`
+	// StreamWriteTimeoutSeconds ends a stream when a write to its client takes longer; 0 disables it
+	StreamWriteTimeoutSeconds int `json:"stream_write_timeout_seconds" yaml:"stream_write_timeout_seconds"`
+	// StreamBufferBytes is how much provider data may wait for a streaming client before the stream
+	// is ended; 0 reads the provider only as fast as the client takes the data
+	StreamBufferBytes int `json:"stream_buffer_bytes" yaml:"stream_buffer_bytes"`
+	// MaxRequestTimeoutSeconds lets clients override the provider timeout of a request with the
+	// x-gateway-timeout header, capped at this value; 0 rejects the header
+	MaxRequestTimeoutSeconds int `json:"max_request_timeout_seconds" yaml:"max_request_timeout_seconds"`
+	// Compression is how compressed provider responses are handled: "passthrough" (default) forwards the
+	// client's Accept-Encoding and relays compressed bodies as is, "identity" drops Accept-Encoding so
+	// responses reach the gateway uncompressed, and "decode" decompresses gzip and br responses and
+	// compresses them again in an encoding the client accepts
+	Compression string `json:"compression" yaml:"compression"`
+	// SynthesizeStreamUsage appends a usage chunk to chat completion streams whose client set
+	// stream_options.include_usage when the provider does not send one
+	SynthesizeStreamUsage bool `json:"synthesize_stream_usage" yaml:"synthesize_stream_usage"`
+	// SynthesizeUsage adds a usage object counted by the gateway to non-stream responses whose
+	// provider does not send one
+	SynthesizeUsage bool `json:"synthesize_usage" yaml:"synthesize_usage"`
+	// RewriteResponseModel replaces the provider's model name in responses with the requested one and
+	// gives chat completion chunks a stable id derived from the request id
+	RewriteResponseModel bool `json:"rewrite_response_model" yaml:"rewrite_response_model"`
+	// AnonymizeProviders strips provider identifying response headers and vendor specific chat completion
+	// fields, and rewrites response model names and chat completion ids like RewriteResponseModel
+	AnonymizeProviders bool `json:"anonymize_providers" yaml:"anonymize_providers"`
+	// RateLimitHeaders adjusts how provider rate limit headers are relayed to clients
+	RateLimitHeaders *RateLimitHeadersConfig `json:"rate_limit_headers" yaml:"rate_limit_headers"`
+	// ModelDiscovery periodically registers pass-through routes for models listed by the providers
+	ModelDiscovery *ModelDiscoveryConfig `json:"model_discovery" yaml:"model_discovery"`
+	// Pricing is the price table of models, used for costs, budgets and cost based routing
+	Pricing *PricingConfig `json:"pricing" yaml:"pricing"`
+	// Warmup opens connections to every provider at startup so the first requests do not pay for them
+	Warmup *WarmupConfig `json:"warmup" yaml:"warmup"`
+	// ReadinessCheckProviders makes /readyz also require at least one reachable provider
+	ReadinessCheckProviders bool `json:"readiness_check_providers" yaml:"readiness_check_providers"`
+	// HeartbeatURL is pinged on startup, periodically while the gateway is ready, and on shutdown,
+	// for dead man's switch monitors such as healthchecks.io
+	HeartbeatURL string `json:"heartbeat_url" yaml:"heartbeat_url"`
+	// HeartbeatIntervalSeconds is the time between heartbeats; defaults to 60
+	HeartbeatIntervalSeconds int `json:"heartbeat_interval_seconds" yaml:"heartbeat_interval_seconds"`
+	// ConfigWatchIntervalSeconds checks the configuration file for changes that often and reloads it; 0 disables watching
+	ConfigWatchIntervalSeconds int `json:"config_watch_interval_seconds" yaml:"config_watch_interval_seconds"`
+	// BackupDir is the directory where POST /admin/backup writes named snapshots; defaults to "backups"
+	BackupDir string         `json:"backup_dir" yaml:"backup_dir"`
+	Tenants   []TenantConfig `json:"tenants" yaml:"tenants"`
+	// RateLimit applies to every API key on its own
+	RateLimit *RateLimitConfig `json:"rate_limit" yaml:"rate_limit"`
+	// TenantTemplates are the presets POST /admin/tenants applies to new tenants
+	TenantTemplates []TenantTemplate `json:"tenant_templates" yaml:"tenant_templates"`
+	// StoragePartitionByTenant keeps the usage data of each tenant in its own storage file
+	StoragePartitionByTenant bool `json:"storage_partition_by_tenant" yaml:"storage_partition_by_tenant"`
+	// SQLite tunes the sqlite storage for heavy write traffic
+	SQLite *SQLiteConfig `json:"sqlite" yaml:"sqlite"`
+	// RequestLogEncryption encrypts the headers and body of stored request logs with AES-256-GCM
+	RequestLogEncryption *RequestLogEncryptionConfig `json:"request_log_encryption" yaml:"request_log_encryption"`
+	// ResponseLogs stores the final response body of sampled requests next to their request log
+	ResponseLogs *ResponseLogConfig `json:"response_logs" yaml:"response_logs"`
+	// PIIScrubbing redacts personal data from request bodies before they are stored in the request logs
+	PIIScrubbing *PIIScrubbingConfig `json:"pii_scrubbing" yaml:"pii_scrubbing"`
+	// LogRedactPaths are JSON paths of request body fields replaced by "[REDACTED]" in debug logs and stored
+	// request logs; "#" matches every array element, e.g. messages.#.content
+	LogRedactPaths []string `json:"log_redact_paths" yaml:"log_redact_paths"`
+	// Moderation sends prompts to a moderation endpoint before they are routed
+	Moderation *ModerationConfig `json:"moderation" yaml:"moderation"`
+	// PromptInspection flags or blocks prompts and tool outputs that look like prompt injection or jailbreak attempts
+	PromptInspection *PromptInspectionConfig `json:"prompt_inspection" yaml:"prompt_inspection"`
+	// SecretDetection stops credentials pasted into prompts from leaving the gateway
+	SecretDetection *SecretDetectionConfig `json:"secret_detection" yaml:"secret_detection"`
+	// ExternalProcessor sends requests, and optionally responses, to a gRPC service that may mutate or reject them
+	ExternalProcessor *ExternalProcessorConfig `json:"external_processor" yaml:"external_processor"`
+	// UpstreamUserID sets the OpenAI "user" / Anthropic "metadata.user_id" field of forwarded
+	// requests to the caller's tenant ("tenant") or a per-key digest ("key"); empty disables it
+	UpstreamUserID string           `json:"upstream_user_id" yaml:"upstream_user_id"`
+	Notifiers      []NotifierConfig `json:"notifiers" yaml:"notifiers"`
+	// NotifyCooldownSeconds suppresses repeats of the same alert within the window; defaults to 300
+	NotifyCooldownSeconds int `json:"notify_cooldown_seconds" yaml:"notify_cooldown_seconds"`
+	// ProviderUnhealthyThreshold is the number of consecutive failures after which a provider is reported unhealthy; defaults to 3
+	ProviderUnhealthyThreshold int `json:"provider_unhealthy_threshold" yaml:"provider_unhealthy_threshold"`
+	// ProviderEviction takes providers unhealthy for long out of rotation and re-probes them in the background
+	ProviderEviction *ProviderEvictionConfig `json:"provider_eviction" yaml:"provider_eviction"`
+	// HealthCheck periodically checks every provider and skips those failing the checks when routing
+	HealthCheck *HealthCheckConfig `json:"health_check" yaml:"health_check"`
+	// Retry decides which provider errors are retried and failed over, and how long to wait in between;
+	// every error status fails over to the next provider without waiting when unset
+	Retry *RetryConfig `json:"retry" yaml:"retry"`
+	// ErrorRateAlert raises an error_rate_spike alert when a provider fails too many requests
+	ErrorRateAlert *ErrorRateAlertConfig `json:"error_rate_alert" yaml:"error_rate_alert"`
+	// AnomalyDetection raises a spend_anomaly alert when a key's hourly token usage of a model jumps above its baseline
+	AnomalyDetection *AnomalyDetectionConfig `json:"anomaly_detection" yaml:"anomaly_detection"`
+	// Reports are usage summaries delivered through the notifiers on a cron schedule
+	Reports []ReportConfig `json:"reports" yaml:"reports"`
+	// Alerts are user defined rules over runtime metrics
+	Alerts []AlertRule `json:"alerts" yaml:"alerts"`
+	// Exporters send every request to tracing backends such as Langfuse and LangSmith
+	Exporters *ExportersConfig `json:"exporters" yaml:"exporters"`
+	// MetricsPush pushes aggregated usage metrics to Prometheus on an interval, for deployments that cannot scrape the gateway
+	MetricsPush *MetricsPushConfig `json:"metrics_push" yaml:"metrics_push"`
+	// StatsD sends request, token, latency and retry metrics to a statsd or DogStatsD agent
+	StatsD *StatsDConfig `json:"statsd" yaml:"statsd"`
+	// Callbacks POST a signed summary of each finished request to the callback_url of its key or the
+	// URL of its x-callback-url header
+	Callbacks *CallbacksConfig `json:"callbacks" yaml:"callbacks"`
+}
+
+// CallbacksConfig configures the completion callbacks.
+type CallbacksConfig struct {
+	// Secret signs the callbacks like the webhook notifier: X-Gateway-Signature holds
+	// "sha256=" + HMAC-SHA256(secret, X-Gateway-Timestamp + "." + body)
+	Secret string `json:"secret" yaml:"secret"`
+	// AllowHeader lets clients name the callback URL of a request in the x-callback-url header
+	AllowHeader bool `json:"allow_header" yaml:"allow_header"`
+	// AllowedHosts are the hosts x-callback-url may point to; required with allow_header
+	AllowedHosts []string `json:"allowed_hosts" yaml:"allowed_hosts"`
+	// TimeoutSeconds bounds each delivery attempt; defaults to 10
+	TimeoutSeconds int `json:"timeout_seconds" yaml:"timeout_seconds"`
+	// MaxAttempts is the number of deliveries tried before a callback is dropped; defaults to 3
+	MaxAttempts int `json:"max_attempts" yaml:"max_attempts"`
+}
+
+// StatsD formats.
+const (
+	StatsDFormatDogStatsD = "dogstatsd"
+	StatsDFormatStatsD    = "statsd"
+)
+
+// StatsDConfig is the statsd agent metrics are sent to.
+type StatsDConfig struct {
+	// Address is the agent's host:port over UDP, or unix:///path for a DogStatsD unix socket
+	Address string `json:"address" yaml:"address"`
+	// Format is dogstatsd, with provider/model/outcome tags, or statsd, with them in the metric names; defaults to dogstatsd
+	Format string `json:"format" yaml:"format"`
+	// Prefix starts every metric name; defaults to "gateway."
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// Tags are added to every metric in the dogstatsd format, e.g. env:prod
+	Tags []string `json:"tags" yaml:"tags"`
+}
+
+// Metrics push formats.
+const (
+	MetricsPushRemoteWrite = "remote_write"
+	MetricsPushPushgateway = "pushgateway"
+)
+
+// MetricsPushConfig is the Prometheus endpoint usage metrics are pushed to.
+type MetricsPushConfig struct {
+	// URL is the remote-write endpoint, e.g. http://prometheus:9090/api/v1/write, or the Pushgateway base URL
+	URL string `json:"url" yaml:"url"`
+	// Format is remote_write or pushgateway; defaults to remote_write
+	Format string `json:"format" yaml:"format"`
+	// IntervalSeconds is the time between pushes; defaults to 30
+	IntervalSeconds int `json:"interval_seconds" yaml:"interval_seconds"`
+	// Job is the job label of the metrics; defaults to openai-cost-optimal-gateway
+	Job string `json:"job" yaml:"job"`
+	// Labels are added to every series, e.g. instance; with pushgateway they form the grouping key
+	Labels map[string]string `json:"labels" yaml:"labels"`
+	// Headers are sent with every push, e.g. Authorization
+	Headers map[string]string `json:"headers" yaml:"headers"`
+}
+
+// ExportersConfig sends each request to the configured tracing backends. Every
+// backend has its own queue, sent in batches in the background.
+type ExportersConfig struct {
+	// BatchSize is the number of requests sent per call to a backend; defaults to 50
+	BatchSize int `json:"batch_size" yaml:"batch_size"`
+	// FlushIntervalSeconds is the longest a request waits before it is sent; defaults to 5
+	FlushIntervalSeconds int `json:"flush_interval_seconds" yaml:"flush_interval_seconds"`
+	// QueueSize is the number of requests waiting per backend; requests beyond it are dropped; defaults to 10000
+	QueueSize int `json:"queue_size" yaml:"queue_size"`
+	// OmitContent leaves prompts and completions out of the exported traces
+	OmitContent bool `json:"omit_content" yaml:"omit_content"`
+	// Langfuse exports each request as a trace with one generation per provider attempt
+	Langfuse *LangfuseConfig `json:"langfuse" yaml:"langfuse"`
+	// LangSmith exports each provider attempt as a run
+	LangSmith *LangSmithConfig `json:"langsmith" yaml:"langsmith"`
+}
+
+// LangfuseConfig is the Langfuse project requests are exported to through its ingestion API.
+type LangfuseConfig struct {
+	// Host is the Langfuse base URL; defaults to https://cloud.langfuse.com
+	Host      string `json:"host" yaml:"host"`
+	PublicKey string `json:"public_key" yaml:"public_key"`
+	SecretKey string `json:"secret_key" yaml:"secret_key"`
+}
+
+// LangSmithConfig is the LangSmith project requests are exported to through its run API.
+type LangSmithConfig struct {
+	// Endpoint is the LangSmith API URL; defaults to https://api.smith.langchain.com
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	APIKey   string `json:"api_key" yaml:"api_key"`
+	// Project receives the runs; defaults to "default"
+	Project string `json:"project" yaml:"project"`
+}
+
+// PricingSyncConfig names a model pricing feed: a JSON object keyed by model
+// name, either in the LiteLLM price map format (input_cost_per_token and
+// output_cost_per_token in USD) or as ModelPrice entries.
+type PricingSyncConfig struct {
+	URL string `json:"url" yaml:"url"`
+	// Headers are sent with every fetch, e.g. an Authorization header
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	// IntervalSeconds is the time between fetches; defaults to 86400
+	IntervalSeconds int `json:"interval_seconds" yaml:"interval_seconds"`
+	// TimeoutSeconds bounds each fetch; defaults to 30
+	TimeoutSeconds int `json:"timeout_seconds" yaml:"timeout_seconds"`
+}
+
+// PricingConfig is the price table of models. A model is priced by its entry
+// for the provider, else its entry without a provider, else the synced feed.
+type PricingConfig struct {
+	// EstimatedOutputTokens is the completion size assumed when estimating the cost of a request; defaults to 512
+	EstimatedOutputTokens int             `json:"estimated_output_tokens" yaml:"estimated_output_tokens"`
+	Prices                []ProviderPrice `json:"prices" yaml:"prices"`
+	// Sync periodically fetches the prices of the models without an entry from a pricing feed
+	Sync *PricingSyncConfig `json:"sync" yaml:"sync"`
+}
+
+// ProviderPrice is the cost of a provider model in USD per million tokens.
+type ProviderPrice struct {
+	// Provider restricts the price to one provider; empty prices the model on every provider
+	Provider string `json:"provider" yaml:"provider"`
+	// Model is the model name sent to the provider
+	Model  string  `json:"model" yaml:"model"`
+	Input  float64 `json:"input" yaml:"input"`
+	Output float64 `json:"output" yaml:"output"`
+}
+
+// ModelPrice is the cost of a model in USD per million tokens.
+type ModelPrice struct {
+	Input  float64 `json:"input" yaml:"input"`
+	Output float64 `json:"output" yaml:"output"`
+}
+
+// AlertRule raises an alert while its condition holds.
+type AlertRule struct {
+	Name string `json:"name" yaml:"name"`
+	// Condition is an expression over runtime metrics, optionally followed by
+	// "for <duration>" to require it to hold that long, e.g. "provider_error_rate > 0.2 for 5m"
+	Condition string `json:"condition" yaml:"condition"`
+	// WindowSeconds is the sliding window metrics are computed over; defaults to 300
+	WindowSeconds int `json:"window_seconds" yaml:"window_seconds"`
+	// Severity is info, warning or critical; defaults to warning
+	Severity string `json:"severity" yaml:"severity"`
+	// Notifiers restricts delivery to the named notifiers; empty means all notifiers
+	Notifiers []string `json:"notifiers" yaml:"notifiers"`
+}
+
+var alertHoldPattern = regexp.MustCompile(`^(.*\S)\s+for\s+(\S+)$`)
+
+// ParseCondition splits the condition into the expression and the duration it must hold for.
+func (r AlertRule) ParseCondition() (string, time.Duration, error) {
+	condition := strings.TrimSpace(r.Condition)
+	m := alertHoldPattern.FindStringSubmatch(condition)
+	if m == nil {
+		return condition, 0, nil
+	}
+	hold, err := time.ParseDuration(m[2])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid duration %q in condition: %w", m[2], err)
+	}
+	if hold < 0 {
+		return "", 0, fmt.Errorf("duration %q in condition must not be negative", m[2])
+	}
+	return m[1], hold, nil
+}
+
+// ReportConfig schedules a usage summary report.
+type ReportConfig struct {
+	Name string `json:"name" yaml:"name"`
+	// Schedule is a five-field cron expression evaluated in local time, e.g. "0 9 * * 1"
+	Schedule string `json:"schedule" yaml:"schedule"`
+	// Period is the window the report covers: daily (last 24 hours) or weekly (last 7 days); defaults to daily
+	Period string `json:"period" yaml:"period"`
+	// Tenant restricts the report to one tenant; empty covers all traffic
+	Tenant string `json:"tenant" yaml:"tenant"`
+	// TopModels is the number of models listed by usage; defaults to 5
+	TopModels int `json:"top_models" yaml:"top_models"`
+}
+
+// AnomalyDetectionConfig defines when token usage of a key and model counts as anomalous.
+type AnomalyDetectionConfig struct {
+	// Factor is how many times the baseline hourly spend, or tokens for unpriced models, the last hour must exceed
+	Factor float64 `json:"factor" yaml:"factor"`
+	// BaselineHours is the history the average hourly usage is computed over; defaults to 24
+	BaselineHours int `json:"baseline_hours" yaml:"baseline_hours"`
+	// MinTokens ignores keys that used fewer tokens than this in the last hour
+	MinTokens int `json:"min_tokens" yaml:"min_tokens"`
+	// CheckIntervalSeconds is how often usage is compared with the baseline; defaults to 300
+	CheckIntervalSeconds int `json:"check_interval_seconds" yaml:"check_interval_seconds"`
+}
+
+// ErrorRateAlertConfig defines when a provider's error rate counts as a spike.
+type ErrorRateAlertConfig struct {
+	// Threshold is the failure ratio, between 0 and 1, that triggers the alert
+	Threshold float64 `json:"threshold" yaml:"threshold"`
+	// WindowSeconds is the sliding window the ratio is computed over; defaults to 300
+	WindowSeconds int `json:"window_seconds" yaml:"window_seconds"`
+	// MinRequests avoids alerting on a handful of requests; defaults to 20
+	MinRequests int `json:"min_requests" yaml:"min_requests"`
+}
+
+// NotifierConfig configures a destination for alert events.
+type NotifierConfig struct {
+	Name    string            `json:"name" yaml:"name"`
+	Type    string            `json:"type" yaml:"type"`
+	URL     string            `json:"url" yaml:"url"`
+	Secret  string            `json:"secret" yaml:"secret"`
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	// Events restricts the notifier to the listed event types; empty means all events
+	Events []string `json:"events" yaml:"events"`
+	// Retries is the number of extra delivery attempts after a failure
+	Retries int `json:"retries" yaml:"retries"`
+	// Host, Port, Username, Password, From and To configure the email notifier
+	Host     string   `json:"host" yaml:"host"`
+	Port     int      `json:"port" yaml:"port"`
+	Username string   `json:"username" yaml:"username"`
+	Password string   `json:"password" yaml:"password"`
+	From     string   `json:"from" yaml:"from"`
+	To       []string `json:"to" yaml:"to"`
+	// APIKey is the PagerDuty routing key or the Opsgenie API key
+	APIKey string `json:"api_key" yaml:"api_key"`
+}
+
+// TenantConfig groups API keys that share model visibility and routing overrides.
+type TenantConfig struct {
+	ID      string   `json:"id" yaml:"id"`
+	Name    string   `json:"name" yaml:"name"`
+	APIKeys []string `json:"api_keys" yaml:"api_keys"`
+	// APIKeyDigests are SHA-256 hex digests of further keys; tenants created through the
+	// onboarding API are stored with digests only, so their keys never reach disk
+	APIKeyDigests []string `json:"api_key_digests,omitempty" yaml:"api_key_digests"`
+	// Models lists the model names the tenant may request; empty means all models
+	Models    []string              `json:"models" yaml:"models"`
+	Overrides []TenantModelOverride `json:"overrides" yaml:"overrides"`
+	// Budget caps the tokens and cost consumed by all keys of the tenant combined
+	Budget *BudgetConfig `json:"budget" yaml:"budget"`
+	// RateLimit caps the request rate of all keys of the tenant combined
+	RateLimit *RateLimitConfig `json:"rate_limit" yaml:"rate_limit"`
+}
+
+// APIKeyDigest returns the digest a key is matched by in api_key_digests.
+func APIKeyDigest(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// WithKeyDigests returns a copy of the tenant whose api_keys are replaced by
+// their digests.
+func (t TenantConfig) WithKeyDigests() TenantConfig {
+	digests := append([]string(nil), t.APIKeyDigests...)
+	for _, key := range t.APIKeys {
+		digests = append(digests, APIKeyDigest(key))
+	}
+	t.APIKeys = nil
+	t.APIKeyDigests = digests
+	return t
+}
+
+// TenantTemplate holds the model visibility and limits handed to tenants created
+// through the onboarding API.
+type TenantTemplate struct {
+	Name      string                `json:"name" yaml:"name"`
+	Models    []string              `json:"models" yaml:"models"`
+	Overrides []TenantModelOverride `json:"overrides" yaml:"overrides"`
+	Budget    *BudgetConfig         `json:"budget" yaml:"budget"`
+	RateLimit *RateLimitConfig      `json:"rate_limit" yaml:"rate_limit"`
+}
+
+// Apply copies the template settings onto the tenant.
+func (t TenantTemplate) Apply(tenant *TenantConfig) {
+	tenant.Models = append([]string(nil), t.Models...)
+	tenant.Overrides = append([]TenantModelOverride(nil), t.Overrides...)
+	if t.Budget != nil {
+		budget := *t.Budget
+		tenant.Budget = &budget
+	}
+	if t.RateLimit != nil {
+		limit := *t.RateLimit
+		tenant.RateLimit = &limit
+	}
+}
+
+// RateLimitConfig allows RequestsPerMinute requests on average with bursts of up to Burst
+// requests; Burst defaults to RequestsPerMinute.
+type RateLimitConfig struct {
+	RequestsPerMinute int `json:"requests_per_minute" yaml:"requests_per_minute"`
+	Burst             int `json:"burst" yaml:"burst"`
+}
+
+// BudgetConfig limits token consumption and cost per calendar day and month; zero means unlimited.
+type BudgetConfig struct {
+	DailyTokens   int64 `json:"daily_tokens" yaml:"daily_tokens"`
+	MonthlyTokens int64 `json:"monthly_tokens" yaml:"monthly_tokens"`
+	// DailyCost and MonthlyCost are in USD, priced like exported costs; usage of unpriced models costs nothing
+	DailyCost   float64 `json:"daily_cost" yaml:"daily_cost"`
+	MonthlyCost float64 `json:"monthly_cost" yaml:"monthly_cost"`
+}
+
+func (b *BudgetConfig) validate() error {
+	if b.DailyTokens < 0 || b.MonthlyTokens < 0 || b.DailyCost < 0 || b.MonthlyCost < 0 {
+		return fmt.Errorf("budget limits must not be negative")
+	}
+	return nil
+}
+
+// TenantModelOverride replaces the provider order of a model for a single tenant.
+type TenantModelOverride struct {
+	Model     string         `json:"model" yaml:"model"`
+	Providers ModelProviders `json:"providers" yaml:"providers"`
 }
 
 type AliasConfig struct {
 	Model  string `json:"model" yaml:"model"`
 	Target string `json:"target" yaml:"target"`
+	// Params are request body fields pinned by the alias, e.g. temperature or max_tokens.
+	// They replace the values sent by the client.
+	Params map[string]any `json:"params" yaml:"params"`
+}
+
+// Roles of API keys, each granting access to one route group.
+const (
+	// RoleProxy may call the /v1 proxy routes
+	RoleProxy = "proxy"
+	// RoleReadUsage may read the usage records and request logs of every tenant
+	RoleReadUsage = "read-usage"
+	// RoleAdmin may call every endpoint
+	RoleAdmin = "admin"
+)
+
+// APIKeyConfig is a gateway API key with its metadata.
+type APIKeyConfig struct {
+	Key string `json:"key" yaml:"key"`
+	KeyMetadata
+}
+
+// KeyMetadata describes an API key; usage is attributed by its name.
+type KeyMetadata struct {
+	// Name is recorded with the usage of the key
+	Name  string   `json:"name" yaml:"name"`
+	Owner string   `json:"owner" yaml:"owner"`
+	Tags  []string `json:"tags" yaml:"tags"`
+	// ExpiresAt is a date (2006-01-02), valid through that day, or an RFC 3339 time after which the key is rejected
+	ExpiresAt string `json:"expires_at" yaml:"expires_at"`
+	// Enabled set to false rejects the key; defaults to true
+	Enabled *bool `json:"enabled" yaml:"enabled"`
+}
+
+// Disabled reports whether the key was switched off with enabled: false.
+func (k KeyMetadata) Disabled() bool {
+	return k.Enabled != nil && !*k.Enabled
+}
+
+// Expiry returns the time from which the key is rejected, or the zero time
+// for keys that do not expire. A date expires at the end of that day in local
+// time.
+func (k KeyMetadata) Expiry() (time.Time, error) {
+	if k.ExpiresAt == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", k.ExpiresAt, time.Local); err == nil {
+		return t.AddDate(0, 0, 1), nil
+	}
+	t, err := time.Parse(time.RFC3339, k.ExpiresAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expires_at %q must be a date (2006-01-02) or an RFC 3339 time", k.ExpiresAt)
+	}
+	return t, nil
+}
+
+func validateKey(key string, meta KeyMetadata) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if _, err := meta.Expiry(); err != nil {
+		return fmt.Errorf("key %s...: %w", key[:min(4, len(key))], err)
+	}
+	return nil
+}
+
+// APIKeys lists the api_keys, written either as plain keys or as key objects.
+type APIKeys []APIKeyConfig
+
+// KeyConfig is an API key with the roles it is granted.
+type KeyConfig struct {
+	Key string `json:"key" yaml:"key"`
+	KeyMetadata
+	Roles []string `json:"roles" yaml:"roles"`
+	// CallbackURL receives the completion callback of every request made with the key
+	CallbackURL string `json:"callback_url" yaml:"callback_url"`
+	// Budget caps the tokens and cost consumed by the key
+	Budget *BudgetConfig `json:"budget" yaml:"budget"`
+}
+
+// RetentionConfig keeps each kind of stored data for its own number of days, so
+// billing data can outlive raw prompt logs.
+type RetentionConfig struct {
+	// UsageDays applies to usage records; defaults to retention_days, or 3
+	UsageDays int `json:"usage_days" yaml:"usage_days"`
+	// RequestLogDays applies to request logs; defaults to 3
+	RequestLogDays int `json:"request_log_days" yaml:"request_log_days"`
+	// ResponseLogDays applies to stored response bodies; defaults to request_log_days
+	ResponseLogDays int `json:"response_log_days" yaml:"response_log_days"`
+	// AlertDays applies to the alert history; 0 keeps alerts forever
+	AlertDays int `json:"alert_days" yaml:"alert_days"`
+	// AuditDays applies to the audit log; 0 keeps it forever
+	AuditDays int `json:"audit_days" yaml:"audit_days"`
+}
+
+// RetentionPolicy returns the retention windows with the defaults applied.
+func (c *Config) RetentionPolicy() RetentionConfig {
+	var policy RetentionConfig
+	if c.Retention != nil {
+		policy = *c.Retention
+	}
+	if policy.UsageDays <= 0 {
+		policy.UsageDays = c.RetentionDays
+	}
+	if policy.UsageDays <= 0 {
+		policy.UsageDays = 3
+	}
+	if policy.RequestLogDays <= 0 {
+		policy.RequestLogDays = 3
+	}
+	if policy.ResponseLogDays <= 0 {
+		policy.ResponseLogDays = policy.RequestLogDays
+	}
+	return policy
+}
+
+// ResponseLogConfig controls which response bodies are stored.
+type ResponseLogConfig struct {
+	// SampleRate is the fraction of requests whose response is stored, between 0 and 1; defaults to 1
+	SampleRate float64 `json:"sample_rate" yaml:"sample_rate"`
+	// MaxBytes caps the stored body, longer bodies are truncated; defaults to 65536
+	MaxBytes int `json:"max_bytes" yaml:"max_bytes"`
+}
+
+// RequestLogEncryptionConfig names where the base64 encoded 32 byte request log
+// key comes from. Exactly one source must be set.
+type RequestLogEncryptionConfig struct {
+	// Key is the key itself
+	Key string `json:"key" yaml:"key"`
+	// KeyEnv is the environment variable holding the key
+	KeyEnv string `json:"key_env" yaml:"key_env"`
+	// KeyFile is a file holding the key
+	KeyFile string `json:"key_file" yaml:"key_file"`
+	// KeyCommand is a shell command printing the key, e.g. a KMS decrypt call
+	KeyCommand string `json:"key_command" yaml:"key_command"`
+}
+
+// Actions taken on flagged requests.
+const (
+	ModerationBlock = "block"
+	ModerationTag   = "tag"
+)
+
+// ModerationConfig configures the pre-flight moderation check. The endpoint must
+// accept and answer the OpenAI moderations format.
+type ModerationConfig struct {
+	// URL of the moderation endpoint; defaults to the OpenAI moderations API, or to
+	// "<base_url>/moderations" of Provider when that is set
+	URL string `json:"url" yaml:"url"`
+	// Provider sends moderation calls through a configured provider and its access token
+	Provider string `json:"provider" yaml:"provider"`
+	// AccessToken authenticates calls to URL
+	AccessToken string `json:"access_token" yaml:"access_token"`
+	// Model is the moderation model; defaults to omni-moderation-latest
+	Model string `json:"model" yaml:"model"`
+	// Action is block (default), answering flagged requests with 400, or tag, only recording the verdict
+	Action string `json:"action" yaml:"action"`
+	// TimeoutSeconds bounds each moderation call; defaults to 10
+	TimeoutSeconds int `json:"timeout_seconds" yaml:"timeout_seconds"`
+	// FailClosed rejects requests when the moderation endpoint cannot be reached
+	FailClosed bool `json:"fail_closed" yaml:"fail_closed"`
+}
+
+// ExternalProcessorConfig is the gRPC service implementing api/extproc/v1/extproc.proto.
+type ExternalProcessorConfig struct {
+	// Address is the service's base URL: http:// for cleartext HTTP/2, https:// for TLS
+	Address string `json:"address" yaml:"address"`
+	// ProcessResponse also sends non-streaming responses to the processor before they reach the client
+	ProcessResponse bool `json:"process_response" yaml:"process_response"`
+	// TimeoutMs bounds each call; defaults to 1000
+	TimeoutMs int `json:"timeout_ms" yaml:"timeout_ms"`
+	// FailOpen lets requests and responses through unchanged when the processor fails; by default
+	// they are answered with 503
+	FailOpen bool `json:"fail_open" yaml:"fail_open"`
+	// Headers are sent as gRPC metadata with every call, e.g. authorization
+	Headers map[string]string `json:"headers" yaml:"headers"`
+}
+
+// Compression modes.
+const (
+	CompressionPassthrough = "passthrough"
+	CompressionIdentity    = "identity"
+	CompressionDecode      = "decode"
+)
+
+// Secret detection modes.
+const (
+	SecretBlock = "block"
+	SecretMask  = "mask"
+	SecretLog   = "log"
+)
+
+// Secret detectors built into the gateway.
+const (
+	SecretAWSAccessKey = "aws_access_key"
+	SecretAWSSecretKey = "aws_secret_key"
+	SecretPrivateKey   = "private_key"
+	SecretBearerToken  = "bearer_token"
+	SecretGitHubToken  = "github_token"
+	SecretSlackToken   = "slack_token"
+)
+
+// SecretDetectionConfig configures the data loss prevention check of outgoing prompts.
+type SecretDetectionConfig struct {
+	// Mode is block (default), rejecting the request with 400, mask, replacing the secrets
+	// before forwarding, or log, only logging the detection
+	Mode string `json:"mode" yaml:"mode"`
+	// Detectors selects the built-in detectors; all when empty
+	Detectors []string `json:"detectors" yaml:"detectors"`
+	// Patterns are additional secret formats
+	Patterns []PIIPattern `json:"patterns" yaml:"patterns"`
+}
+
+// TLSConfig is the TLS policy of the listener.
+type TLSConfig struct {
+	// CertFile and KeyFile are the PEM certificate chain and private key; without them the
+	// listener stays plain HTTP, e.g. behind a TLS terminating proxy, and only HSTS applies
+	CertFile string `json:"cert_file" yaml:"cert_file"`
+	KeyFile  string `json:"key_file" yaml:"key_file"`
+	// MinVersion is the lowest accepted TLS version, 1.2 or 1.3; defaults to 1.2
+	MinVersion string `json:"min_version" yaml:"min_version"`
+	// CipherSuites restricts the TLS 1.2 cipher suites by their standard names, e.g.
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256; Go's secure defaults when empty. TLS 1.3 suites are not configurable
+	CipherSuites []string `json:"cipher_suites" yaml:"cipher_suites"`
+	// HSTS adds a Strict-Transport-Security header to every response
+	HSTS *HSTSConfig `json:"hsts" yaml:"hsts"`
+}
+
+// HSTSConfig configures the Strict-Transport-Security response header.
+type HSTSConfig struct {
+	// MaxAgeSeconds is how long browsers remember to use HTTPS only; defaults to 31536000 (one year)
+	MaxAgeSeconds     int  `json:"max_age_seconds" yaml:"max_age_seconds"`
+	IncludeSubdomains bool `json:"include_subdomains" yaml:"include_subdomains"`
+	Preload           bool `json:"preload" yaml:"preload"`
+}
+
+// CORSConfig is the cross-origin policy for browser clients.
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed to call the gateway, e.g. https://app.example.com; "*" allows any origin
+	AllowedOrigins []string `json:"allowed_origins" yaml:"allowed_origins"`
+	// AllowedHeaders are the request headers browsers may send; the headers a preflight asks for when empty
+	AllowedHeaders []string `json:"allowed_headers" yaml:"allowed_headers"`
+	// AllowedMethods are the methods browsers may use; defaults to GET, POST, HEAD and OPTIONS
+	AllowedMethods []string `json:"allowed_methods" yaml:"allowed_methods"`
+	// MaxAgeSeconds is how long browsers cache a preflight answer; defaults to 600
+	MaxAgeSeconds int `json:"max_age_seconds" yaml:"max_age_seconds"`
+}
+
+// AllowsOrigin reports whether requests from origin may read the responses.
+func (c *CORSConfig) AllowsOrigin(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Header returns the Strict-Transport-Security header value.
+func (h *HSTSConfig) Header() string {
+	value := "max-age=" + strconv.Itoa(h.MaxAgeSeconds)
+	if h.IncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if h.Preload {
+		value += "; preload"
+	}
+	return value
+}
+
+// ParseTLSVersion converts "1.2" or "1.3" to its crypto/tls constant; empty
+// returns 0, leaving the choice to crypto/tls.
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "":
+		return 0, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported tls version %s, expected 1.2 or 1.3", version)
+	}
+}
+
+// CipherSuiteIDs converts cipher suite names to their IDs. Only suites
+// crypto/tls considers secure are accepted.
+func CipherSuiteIDs(names []string) ([]uint16, error) {
+	var ids []uint16
+	for _, name := range names {
+		id, ok := uint16(0), false
+		for _, suite := range tls.CipherSuites() {
+			if suite.Name == name {
+				id, ok = suite.ID, true
+				break
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Actions taken on suspicious prompts.
+const (
+	InspectionFlag  = "flag"
+	InspectionBlock = "block"
+)
+
+// PromptInspectionConfig configures the prompt injection and jailbreak detection stage.
+type PromptInspectionConfig struct {
+	// Action is flag (default), logging and counting detections, or block, answering them with 400
+	Action string `json:"action" yaml:"action"`
+	// Models limits inspection to these models; all models when empty
+	Models []string `json:"models" yaml:"models"`
+	// DisableBuiltin turns off the built-in rules so only Rules apply
+	DisableBuiltin bool `json:"disable_builtin" yaml:"disable_builtin"`
+	// Rules are additional regular expressions, matched case insensitively
+	Rules []InspectionRule `json:"rules" yaml:"rules"`
+	// Classifier is an optional external service scoring the text
+	Classifier *InspectionClassifier `json:"classifier" yaml:"classifier"`
+}
+
+// InspectionRule is a named regular expression marking suspicious text.
+type InspectionRule struct {
+	Name  string `json:"name" yaml:"name"`
+	Regex string `json:"regex" yaml:"regex"`
+}
+
+// InspectionClassifier is called with {"input": text} and answers with a
+// "score" between 0 and 1 or a boolean "flagged".
+type InspectionClassifier struct {
+	URL         string `json:"url" yaml:"url"`
+	AccessToken string `json:"access_token" yaml:"access_token"`
+	// Threshold is the score from which text is suspicious; defaults to 0.5
+	Threshold float64 `json:"threshold" yaml:"threshold"`
+	// TimeoutSeconds bounds each classifier call; defaults to 5. Failed calls do not flag the request
+	TimeoutSeconds int `json:"timeout_seconds" yaml:"timeout_seconds"`
+}
+
+// PII types recognised by the built-in scrubber.
+const (
+	PIIEmail      = "email"
+	PIIPhone      = "phone"
+	PIICreditCard = "credit_card"
+	PIIAPIKey     = "api_key"
+)
+
+// PIIScrubbingConfig selects what is redacted from stored request bodies.
+type PIIScrubbingConfig struct {
+	// Builtin lists the built-in patterns to apply: email, phone, credit_card, api_key; all when empty
+	Builtin []string `json:"builtin" yaml:"builtin"`
+	// Patterns are additional regular expressions to redact
+	Patterns []PIIPattern `json:"patterns" yaml:"patterns"`
+	// Paths override the settings for requests whose path starts with the given prefix; the longest prefix wins
+	Paths []PIIPathConfig `json:"paths" yaml:"paths"`
+}
+
+// PIIPattern is a custom regular expression whose matches are redacted.
+type PIIPattern struct {
+	Name  string `json:"name" yaml:"name"`
+	Regex string `json:"regex" yaml:"regex"`
+}
+
+// PIIPathConfig adjusts scrubbing for one path prefix.
+type PIIPathConfig struct {
+	Path string `json:"path" yaml:"path"`
+	// Disabled stores bodies of these requests unchanged
+	Disabled bool `json:"disabled" yaml:"disabled"`
+	// Builtin replaces the global built-in list when set
+	Builtin []string `json:"builtin" yaml:"builtin"`
+	// Patterns are applied in addition to the global ones
+	Patterns []PIIPattern `json:"patterns" yaml:"patterns"`
+}
+
+// ModelDiscoveryConfig controls automatic registration of provider models.
+type ModelDiscoveryConfig struct {
+	// IntervalSeconds is the time between refreshes of the providers' model lists; defaults to 3600
+	IntervalSeconds int `json:"interval_seconds" yaml:"interval_seconds"`
+	// Providers limits discovery to these providers; all providers when empty
+	Providers []string `json:"providers" yaml:"providers"`
+}
+
+// ProviderEvictionConfig controls how long unhealthy providers stay in
+// rotation and how they are probed while out of it.
+type ProviderEvictionConfig struct {
+	// AfterSeconds is how long a provider stays unhealthy before it is evicted; defaults to 300
+	AfterSeconds int `json:"after_seconds" yaml:"after_seconds"`
+	// ProbeIntervalSeconds is the time between probes of an evicted provider; defaults to 60
+	ProbeIntervalSeconds int `json:"probe_interval_seconds" yaml:"probe_interval_seconds"`
+	// TimeoutSeconds bounds each probe; defaults to 10
+	TimeoutSeconds int `json:"timeout_seconds" yaml:"timeout_seconds"`
+}
+
+// HealthCheckConfig controls the active health checks of the providers.
+type HealthCheckConfig struct {
+	// Mode is "connect" (default), which requests the models endpoint, or "request", which sends a one token completion
+	Mode string `json:"mode" yaml:"mode"`
+	// IntervalSeconds is the time between checks of each provider; defaults to 30
+	IntervalSeconds int `json:"interval_seconds" yaml:"interval_seconds"`
+	// TimeoutSeconds bounds each check; defaults to 5
+	TimeoutSeconds int `json:"timeout_seconds" yaml:"timeout_seconds"`
+	// FailureThreshold is the number of consecutive failed checks after which a provider is skipped; defaults to 3
+	FailureThreshold int `json:"failure_threshold" yaml:"failure_threshold"`
+}
+
+// RetryConfig is a retry policy. A provider answering a retryable status is
+// tried again after an exponential backoff until max_attempts, then the next
+// provider is tried; other statuses are relayed to the client.
+type RetryConfig struct {
+	// MaxAttempts is the number of times each provider is tried; defaults to 2
+	MaxAttempts int `json:"max_attempts" yaml:"max_attempts"`
+	// RetryableStatuses are the provider statuses that are retried; defaults to 408, 429, 500, 502, 503 and 504
+	RetryableStatuses []int `json:"retryable_statuses" yaml:"retryable_statuses"`
+	// BackoffBaseMs is the wait before the second attempt, doubled for each further one; defaults to 200
+	BackoffBaseMs int `json:"backoff_base_ms" yaml:"backoff_base_ms"`
+	// BackoffMaxMs caps the wait, including the retry-after the provider asks for; defaults to 5000
+	BackoffMaxMs int `json:"backoff_max_ms" yaml:"backoff_max_ms"`
+	// Jitter waits a random duration up to the backoff instead of the full backoff
+	Jitter bool `json:"jitter" yaml:"jitter"`
+}
+
+// Retryable reports whether a provider status is retried under the policy.
+func (r *RetryConfig) Retryable(status int) bool {
+	for _, s := range r.RetryableStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RetryConfig) setDefaults() {
+	if r.MaxAttempts <= 0 {
+		r.MaxAttempts = 2
+	}
+	if len(r.RetryableStatuses) == 0 {
+		r.RetryableStatuses = []int{408, 429, 500, 502, 503, 504}
+	}
+	if r.BackoffBaseMs <= 0 {
+		r.BackoffBaseMs = 200
+	}
+	if r.BackoffMaxMs <= 0 {
+		r.BackoffMaxMs = 5000
+	}
+}
+
+func (r *RetryConfig) validate() error {
+	for _, status := range r.RetryableStatuses {
+		if status < 400 || status > 599 {
+			return fmt.Errorf("retryable status %d is not an error status", status)
+		}
+	}
+	if r.BackoffMaxMs < r.BackoffBaseMs {
+		return fmt.Errorf("backoff_max_ms must not be less than backoff_base_ms")
+	}
+	return nil
+}
+
+// Warm-up modes.
+const (
+	// WarmupConnect requests the provider's models endpoint, establishing the
+	// connection without spending tokens
+	WarmupConnect = "connect"
+	// WarmupRequest sends a one token completion to the provider
+	WarmupRequest = "request"
+)
+
+// WarmupConfig controls the requests sent to each provider at startup.
+type WarmupConfig struct {
+	// Mode is "connect" (default) or "request"
+	Mode string `json:"mode" yaml:"mode"`
+	// TimeoutSeconds bounds the warm-up of each provider; defaults to 10
+	TimeoutSeconds int `json:"timeout_seconds" yaml:"timeout_seconds"`
+}
+
+// RateLimitHeadersConfig controls the provider rate limit headers
+// (x-ratelimit-*, anthropic-ratelimit-*, retry-after) sent to clients. They are
+// relayed unchanged by default.
+type RateLimitHeadersConfig struct {
+	// RenamePrefix relays x-ratelimit-* and anthropic-ratelimit-* headers under this prefix, so
+	// clients do not take one provider's limits for the gateway's; retry-after keeps its name
+	RenamePrefix string `json:"rename_prefix" yaml:"rename_prefix"`
+	// AggregateRetryAfter sets retry-after on failed requests to the shortest wait any of the
+	// attempted providers asked for
+	AggregateRetryAfter bool `json:"aggregate_retry_after" yaml:"aggregate_retry_after"`
+}
+
+// GroupConfig is a virtual model such as "smart" or "cheap". Requests for the
+// group try its models in order, each routed through its own providers and rules.
+type GroupConfig struct {
+	Name   string        `json:"name" yaml:"name"`
+	Models []GroupMember `json:"models" yaml:"models"`
+}
+
+// GroupMember is a concrete model of a group. Provider optionally restricts the
+// model to one provider; models not configured in models require it.
+type GroupMember struct {
+	Model    string `json:"model" yaml:"model"`
+	Provider string `json:"provider" yaml:"provider"`
 }
 
 type ProviderConfig struct {
@@ -45,161 +989,1527 @@ type ProviderConfig struct {
 	AccessToken string            `json:"access_token" yaml:"access_token"`
 	Type        ProviderType      `json:"type" yaml:"type"`
 	Headers     map[string]string `json:"headers" yaml:"headers"`
-	Timeout     time.Duration     `json:"timeout" yaml:"timeout"`
+	// Timeout is written in seconds for providers of every type; defaults to 10 minutes
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// Paths override the endpoint paths joined to base_url, keyed by chat_completions, responses,
+	// messages or models. "{model}" is replaced by the provider model, e.g. /openai/deployments/{model}/chat/completions
+	Paths map[string]string `json:"paths" yaml:"paths"`
+	// UnsupportedParams are request fields the provider rejects; they are removed before forwarding
+	UnsupportedParams []string `json:"unsupported_params" yaml:"unsupported_params"`
+	// SLO is an optional latency objective tracked from the provider's usage records
+	SLO *SLOConfig `json:"slo" yaml:"slo"`
+	// MinTLSVersion is the lowest TLS version accepted from the provider, 1.2 or 1.3; Go's default (1.2) when empty
+	MinTLSVersion string `json:"min_tls_version" yaml:"min_tls_version"`
+	// OpenRouter holds the settings of openrouter providers
+	OpenRouter *OpenRouterConfig `json:"openrouter" yaml:"openrouter"`
+	// Query controls the query parameters sent to the provider; client parameters are forwarded as is when empty
+	Query *QueryConfig `json:"query" yaml:"query"`
+	// HealthCheck enables the active health checks of the provider when health_check is configured; defaults to true
+	HealthCheck *bool `json:"health_check" yaml:"health_check"`
+	// Retry replaces the retry policy of the models and the global one for requests to the provider
+	Retry *RetryConfig `json:"retry" yaml:"retry"`
+}
+
+// HealthChecked reports whether the provider takes part in active health checks.
+func (p ProviderConfig) HealthChecked() bool {
+	return p.HealthCheck == nil || *p.HealthCheck
+}
+
+// QueryConfig sets the query parameters of requests to a provider, e.g. the
+// api-version required by Azure OpenAI.
+type QueryConfig struct {
+	// Forward lists the client query parameters sent to the provider; the others are dropped.
+	// Empty forwards all of them
+	Forward []string `json:"forward" yaml:"forward"`
+	// Set are parameters added to every request, replacing client values of the same name
+	Set map[string]string `json:"set" yaml:"set"`
+}
+
+// SQLiteConfig sets the sqlite pragmas and how usage records and request logs
+// are written.
+type SQLiteConfig struct {
+	// JournalMode is the journal_mode pragma, e.g. wal; the driver default when empty
+	JournalMode string `json:"journal_mode" yaml:"journal_mode"`
+	// Synchronous is the synchronous pragma: off, normal, full or extra; the driver default when empty
+	Synchronous string `json:"synchronous" yaml:"synchronous"`
+	// BusyTimeoutMs is how long a statement waits for a locked database; defaults to 5000
+	BusyTimeoutMs int `json:"busy_timeout_ms" yaml:"busy_timeout_ms"`
+	// WriteBatchSize sends writes through a single writer committing up to this many per
+	// transaction; 0 writes each record directly
+	WriteBatchSize int `json:"write_batch_size" yaml:"write_batch_size"`
+	// WriteFlushMs is how long the writer waits for a batch to fill; defaults to 50
+	WriteFlushMs int `json:"write_flush_ms" yaml:"write_flush_ms"`
+	// CheckpointIntervalSeconds truncates the WAL periodically; 0 leaves checkpoints to sqlite
+	CheckpointIntervalSeconds int `json:"checkpoint_interval_seconds" yaml:"checkpoint_interval_seconds"`
+}
+
+// OpenRouterConfig configures a provider of type openrouter. Models without a
+// vendor are sent as vendor/model, e.g. gpt-4o as openai/gpt-4o.
+type OpenRouterConfig struct {
+	// Referer and Title are sent as HTTP-Referer and X-Title to attribute requests to an app
+	Referer string `json:"referer" yaml:"referer"`
+	Title   string `json:"title" yaml:"title"`
+	// Routing is the provider routing preference sent as the request's provider field unless the
+	// client set one, e.g. order, allow_fallbacks, sort or data_collection
+	Routing map[string]any `json:"routing" yaml:"routing"`
+	// Fallback appends the provider to every model and group as the last provider tried
+	Fallback bool `json:"fallback" yaml:"fallback"`
+}
+
+// Endpoint keys of ProviderConfig.Paths.
+const (
+	PathChatCompletions = "chat_completions"
+	PathResponses       = "responses"
+	PathMessages        = "messages"
+	PathModels          = "models"
+)
+
+// SLOConfig defines a latency objective for a provider.
+type SLOConfig struct {
+	// Metric is first_token (time to first token) or duration (whole request); defaults to first_token
+	Metric string `json:"metric" yaml:"metric"`
+	// Percentile of successful requests that must meet the threshold; defaults to 95
+	Percentile float64 `json:"percentile" yaml:"percentile"`
+	// ThresholdMs is the latency objective in milliseconds
+	ThresholdMs int `json:"threshold_ms" yaml:"threshold_ms"`
+	// WindowSeconds is the sliding window compliance is computed over; defaults to 600
+	WindowSeconds int `json:"window_seconds" yaml:"window_seconds"`
+	// MinSamples is the number of requests needed before the SLO is judged; defaults to 20
+	MinSamples int `json:"min_samples" yaml:"min_samples"`
+	// Deprioritize moves the provider behind the other candidates while the SLO is violated
+	Deprioritize bool `json:"deprioritize" yaml:"deprioritize"`
+}
+
+type ModelConfig struct {
+	Name      string         `json:"model" yaml:"model"`
+	Providers ModelProviders `json:"providers" yaml:"providers"`
+	Rules     []RuleConfig   `json:"rules" yaml:"rules"`
+	// Capabilities apply to every provider of the model unless the provider overrides them
+	Capabilities *Capabilities `json:"capabilities" yaml:"capabilities"`
+	// Limits restrict the request parameters clients may send for the model
+	Limits *ParamLimits `json:"limits" yaml:"limits"`
+	// Strategy is how the providers are ordered when no rule matches: "priority" (default) tries them
+	// in configured order, "lowest_latency" fastest first by recent first token latency, "lowest_cost"
+	// cheapest first by the estimated cost of the request
+	Strategy string `json:"strategy" yaml:"strategy"`
+	// Rotation "round_robin" starts each request at the next provider when no rule matches, the others
+	// following in configured order for failover
+	Rotation string `json:"rotation" yaml:"rotation"`
+	// Sticky sends the requests of the same user or conversation to the same provider
+	Sticky *StickyConfig `json:"sticky" yaml:"sticky"`
+	// Retry replaces the global retry policy for requests to the model
+	Retry *RetryConfig `json:"retry" yaml:"retry"`
+}
+
+// StickyConfig pins the requests of a model sharing a key to one provider, so
+// they hit its prompt cache.
+type StickyConfig struct {
+	// Header is the request header holding the key, e.g. X-Session-ID; the user field of the request
+	// body (metadata.user_id for messages) when empty or absent
+	Header string `json:"header" yaml:"header"`
+}
+
+// Provider selection strategies of a model.
+const (
+	StrategyPriority      = "priority"
+	StrategyLowestLatency = "lowest_latency"
+	StrategyLowestCost    = "lowest_cost"
+)
+
+// RoutingStrategy returns the strategy of the model, priority when unset.
+func (m *ModelConfig) RoutingStrategy() string {
+	if m.Strategy == "" {
+		return StrategyPriority
+	}
+	return m.Strategy
+}
+
+func (l *ParamLimits) validate() error {
+	if l.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens must not be negative")
+	}
+	if l.MinTemperature != nil && l.MaxTemperature != nil && *l.MinTemperature > *l.MaxTemperature {
+		return fmt.Errorf("min_temperature is greater than max_temperature")
+	}
+	for _, param := range l.ForbiddenParams {
+		if param == "" || param == "model" || param == "messages" || param == "input" {
+			return fmt.Errorf("cannot forbid param %q", param)
+		}
+	}
+	return nil
+}
+
+// RotationRoundRobin rotates the provider a request is first sent to.
+const RotationRoundRobin = "round_robin"
+
+// ParamLimits caps and sanitizes request parameters before they are forwarded.
+type ParamLimits struct {
+	// MaxTokens caps max_tokens, max_completion_tokens and max_output_tokens, and
+	// is set as the output limit of requests that have none
+	MaxTokens int `json:"max_tokens" yaml:"max_tokens"`
+	// MinTemperature and MaxTemperature bound the temperature
+	MinTemperature *float64 `json:"min_temperature" yaml:"min_temperature"`
+	MaxTemperature *float64 `json:"max_temperature" yaml:"max_temperature"`
+	// ForbiddenParams are top level request fields that are removed
+	ForbiddenParams []string `json:"forbidden_params" yaml:"forbidden_params"`
+	// Reject refuses violating requests with 400 instead of rewriting them
+	Reject bool `json:"reject" yaml:"reject"`
+}
+
+type ModelProviders []ModelProvider
+
+type ModelProvider struct {
+	ID           string        `json:"provider" yaml:"provider"`
+	Model        string        `json:"model" yaml:"model"`
+	Capabilities *Capabilities `json:"capabilities" yaml:"capabilities"`
+	// Weight is the share of the model's requests sent to the provider first; when any provider of
+	// the model has a weight, providers without one are only used for failover
+	Weight int `json:"weight" yaml:"weight"`
+}
+
+// Capabilities describe the requests a model can serve. Unset flags are
+// assumed to be supported.
+type Capabilities struct {
+	Vision   *bool `json:"vision" yaml:"vision"`
+	Tools    *bool `json:"tools" yaml:"tools"`
+	JSONMode *bool `json:"json_mode" yaml:"json_mode"`
+	// MaxContext is the context window in tokens, prompt and output together; 0 means unknown
+	MaxContext int `json:"max_context" yaml:"max_context"`
+}
+
+// Merge returns the capabilities with the fields set in override replacing its own.
+func (c Capabilities) Merge(override *Capabilities) Capabilities {
+	if override == nil {
+		return c
+	}
+	if override.Vision != nil {
+		c.Vision = override.Vision
+	}
+	if override.Tools != nil {
+		c.Tools = override.Tools
+	}
+	if override.JSONMode != nil {
+		c.JSONMode = override.JSONMode
+	}
+	if override.MaxContext > 0 {
+		c.MaxContext = override.MaxContext
+	}
+	return c
+}
+
+type RuleConfig struct {
+	Expression string                 `json:"rule" yaml:"rule"`
+	Providers  ProviderOverrideConfig `json:"providers" yaml:"providers"`
+	// Rotation "round_robin" starts each matching request at the next provider of the rule
+	Rotation string `json:"rotation" yaml:"rotation"`
+}
+
+type ProviderOverrideConfig []ProviderOverride
+
+type ProviderOverride struct {
+	Provider string `json:"provider" yaml:"provider"`
+	Model    string `json:"model" yaml:"model"`
+}
+
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	var cfg Config
+	if err := unmarshalYAML(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unmarshal config: %w", err)
+	}
+
+	cfg.setDefaults()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func (c *Config) setDefaults() {
+	for i := range c.Providers {
+		if c.Providers[i].Type == "" {
+			c.Providers[i].Type = ProviderTypeOpenAI
+		}
+		if c.Providers[i].Type == ProviderTypeOpenRouter && c.Providers[i].BaseURL == "" {
+			c.Providers[i].BaseURL = OpenRouterBaseURL
+		}
+		if c.Providers[i].Timeout <= 0 {
+			c.Providers[i].Timeout = 10 * time.Minute
+		} else {
+			c.Providers[i].Timeout = c.Providers[i].Timeout * time.Second
+		}
+		if c.Providers[i].Retry != nil {
+			c.Providers[i].Retry.setDefaults()
+		}
+	}
+	for i := range c.Models {
+		if c.Models[i].Retry != nil {
+			c.Models[i].Retry.setDefaults()
+		}
+	}
+	if c.Retry != nil {
+		c.Retry.setDefaults()
+	}
+
+	if c.StorageType == "" {
+		c.StorageType = "sqlite"
+	}
+	if c.ResponseLogs != nil {
+		if c.ResponseLogs.SampleRate <= 0 {
+			c.ResponseLogs.SampleRate = 1
+		}
+		if c.ResponseLogs.MaxBytes <= 0 {
+			c.ResponseLogs.MaxBytes = 65536
+		}
+	}
+	if c.SQLite != nil {
+		if c.SQLite.BusyTimeoutMs <= 0 {
+			c.SQLite.BusyTimeoutMs = 5000
+		}
+		if c.SQLite.WriteFlushMs <= 0 {
+			c.SQLite.WriteFlushMs = 50
+		}
+	}
+	if c.HeartbeatIntervalSeconds <= 0 {
+		c.HeartbeatIntervalSeconds = 60
+	}
+	if c.NotifyCooldownSeconds <= 0 {
+		c.NotifyCooldownSeconds = 300
+	}
+	if c.ProviderUnhealthyThreshold <= 0 {
+		c.ProviderUnhealthyThreshold = 3
+	}
+	if e := c.ProviderEviction; e != nil {
+		if e.AfterSeconds <= 0 {
+			e.AfterSeconds = 300
+		}
+		if e.ProbeIntervalSeconds <= 0 {
+			e.ProbeIntervalSeconds = 60
+		}
+		if e.TimeoutSeconds <= 0 {
+			e.TimeoutSeconds = 10
+		}
+	}
+	if h := c.HealthCheck; h != nil {
+		if h.Mode == "" {
+			h.Mode = WarmupConnect
+		}
+		if h.IntervalSeconds <= 0 {
+			h.IntervalSeconds = 30
+		}
+		if h.TimeoutSeconds <= 0 {
+			h.TimeoutSeconds = 5
+		}
+		if h.FailureThreshold <= 0 {
+			h.FailureThreshold = 3
+		}
+	}
+	if e := c.Exporters; e != nil {
+		if e.BatchSize <= 0 {
+			e.BatchSize = 50
+		}
+		if e.FlushIntervalSeconds <= 0 {
+			e.FlushIntervalSeconds = 5
+		}
+		if e.QueueSize <= 0 {
+			e.QueueSize = 10000
+		}
+		if e.Langfuse != nil && e.Langfuse.Host == "" {
+			e.Langfuse.Host = "https://cloud.langfuse.com"
+		}
+		if e.LangSmith != nil {
+			if e.LangSmith.Endpoint == "" {
+				e.LangSmith.Endpoint = "https://api.smith.langchain.com"
+			}
+			if e.LangSmith.Project == "" {
+				e.LangSmith.Project = "default"
+			}
+		}
+	}
+	if m := c.MetricsPush; m != nil {
+		if m.Format == "" {
+			m.Format = MetricsPushRemoteWrite
+		}
+		if m.IntervalSeconds <= 0 {
+			m.IntervalSeconds = 30
+		}
+		if m.Job == "" {
+			m.Job = "openai-cost-optimal-gateway"
+		}
+	}
+	if sd := c.StatsD; sd != nil {
+		if sd.Format == "" {
+			sd.Format = StatsDFormatDogStatsD
+		}
+		if sd.Prefix == "" {
+			sd.Prefix = "gateway."
+		}
+	}
+	if cb := c.Callbacks; cb != nil {
+		if cb.TimeoutSeconds <= 0 {
+			cb.TimeoutSeconds = 10
+		}
+		if cb.MaxAttempts <= 0 {
+			cb.MaxAttempts = 3
+		}
+	}
+	if c.ErrorRateAlert != nil {
+		if c.ErrorRateAlert.WindowSeconds <= 0 {
+			c.ErrorRateAlert.WindowSeconds = 300
+		}
+		if c.ErrorRateAlert.MinRequests <= 0 {
+			c.ErrorRateAlert.MinRequests = 20
+		}
+	}
+	for i := range c.Providers {
+		slo := c.Providers[i].SLO
+		if slo == nil {
+			continue
+		}
+		if slo.Metric == "" {
+			slo.Metric = "first_token"
+		}
+		if slo.Percentile <= 0 {
+			slo.Percentile = 95
+		}
+		if slo.WindowSeconds <= 0 {
+			slo.WindowSeconds = 600
+		}
+		if slo.MinSamples <= 0 {
+			slo.MinSamples = 20
+		}
+	}
+	for i := range c.Alerts {
+		if c.Alerts[i].WindowSeconds <= 0 {
+			c.Alerts[i].WindowSeconds = 300
+		}
+		if c.Alerts[i].Severity == "" {
+			c.Alerts[i].Severity = "warning"
+		}
+	}
+	for i := range c.Reports {
+		if c.Reports[i].Period == "" {
+			c.Reports[i].Period = "daily"
+		}
+		if c.Reports[i].TopModels <= 0 {
+			c.Reports[i].TopModels = 5
+		}
+	}
+	if c.AnomalyDetection != nil {
+		if c.AnomalyDetection.BaselineHours <= 0 {
+			c.AnomalyDetection.BaselineHours = 24
+		}
+		if c.AnomalyDetection.CheckIntervalSeconds <= 0 {
+			c.AnomalyDetection.CheckIntervalSeconds = 300
+		}
+	}
+	if c.ModelUnavailableTTLSeconds <= 0 {
+		c.ModelUnavailableTTLSeconds = 600
+	}
+	if m := c.Moderation; m != nil {
+		if m.Action == "" {
+			m.Action = ModerationBlock
+		}
+		if m.Model == "" {
+			m.Model = "omni-moderation-latest"
+		}
+		if m.TimeoutSeconds <= 0 {
+			m.TimeoutSeconds = 10
+		}
+		if m.URL == "" && m.Provider == "" {
+			m.URL = "https://api.openai.com/v1/moderations"
+		}
+	}
+	if p := c.ExternalProcessor; p != nil && p.TimeoutMs <= 0 {
+		p.TimeoutMs = 1000
+	}
+	if t := c.TLS; t != nil {
+		if t.MinVersion == "" {
+			t.MinVersion = "1.2"
+		}
+		if t.HSTS != nil && t.HSTS.MaxAgeSeconds <= 0 {
+			t.HSTS.MaxAgeSeconds = 31536000
+		}
+	}
+	if cors := c.CORS; cors != nil {
+		if len(cors.AllowedMethods) == 0 {
+			cors.AllowedMethods = []string{"GET", "POST", "HEAD", "OPTIONS"}
+		}
+		for i, method := range cors.AllowedMethods {
+			cors.AllowedMethods[i] = strings.ToUpper(strings.TrimSpace(method))
+		}
+		if cors.MaxAgeSeconds <= 0 {
+			cors.MaxAgeSeconds = 600
+		}
+	}
+	if c.SecretDetection != nil && c.SecretDetection.Mode == "" {
+		c.SecretDetection.Mode = SecretBlock
+	}
+	if p := c.PromptInspection; p != nil {
+		if p.Action == "" {
+			p.Action = InspectionFlag
+		}
+		if p.Classifier != nil {
+			if p.Classifier.Threshold <= 0 {
+				p.Classifier.Threshold = 0.5
+			}
+			if p.Classifier.TimeoutSeconds <= 0 {
+				p.Classifier.TimeoutSeconds = 5
+			}
+		}
+	}
+	if c.ModelDiscovery != nil && c.ModelDiscovery.IntervalSeconds <= 0 {
+		c.ModelDiscovery.IntervalSeconds = 3600
+	}
+	if c.Pricing != nil && c.Pricing.Sync != nil {
+		sync := c.Pricing.Sync
+		if sync.IntervalSeconds <= 0 {
+			sync.IntervalSeconds = 86400
+		}
+		if sync.TimeoutSeconds <= 0 {
+			sync.TimeoutSeconds = 30
+		}
+	}
+	if c.Pricing != nil && c.Pricing.EstimatedOutputTokens <= 0 {
+		c.Pricing.EstimatedOutputTokens = 512
+	}
+	if c.Warmup != nil {
+		if c.Warmup.Mode == "" {
+			c.Warmup.Mode = WarmupConnect
+		}
+		if c.Warmup.TimeoutSeconds <= 0 {
+			c.Warmup.TimeoutSeconds = 10
+		}
+	}
+	if c.StorageURI == "" {
+		c.StorageURI = "file:usage.db?_pragma=busy_timeout=5000&_pragma=journal_mode=WAL"
+	}
+	if c.BackupDir == "" {
+		c.BackupDir = "backups"
+	}
+}
+
+func (c *Config) Validate() error {
+	if c.Listen == "" {
+		return fmt.Errorf("listen address is required")
+	}
+	if len(c.APIKeys) == 0 && len(c.AdminKeys) == 0 && len(c.Keys) == 0 && !c.hasTenantKeys() {
+		return fmt.Errorf("at least one api key is required")
+	}
+	if c.StreamKeepaliveSeconds < 0 {
+		return fmt.Errorf("stream_keepalive_seconds must not be negative")
+	}
+	if c.ConfigWatchIntervalSeconds < 0 {
+		return fmt.Errorf("config_watch_interval_seconds must not be negative")
+	}
+	if c.StreamWriteTimeoutSeconds < 0 {
+		return fmt.Errorf("stream_write_timeout_seconds must not be negative")
+	}
+	if c.StreamBufferBytes < 0 {
+		return fmt.Errorf("stream_buffer_bytes must not be negative")
+	}
+	if c.MaxRequestTimeoutSeconds < 0 {
+		return fmt.Errorf("max_request_timeout_seconds must not be negative")
+	}
+	switch c.Compression {
+	case "", CompressionPassthrough, CompressionIdentity, CompressionDecode:
+	default:
+		return fmt.Errorf("unsupported compression %s, expected passthrough, identity or decode", c.Compression)
+	}
+
+	providers := make(map[string]struct{})
+	for _, p := range c.Providers {
+		if p.ID == "" {
+			return fmt.Errorf("provider id is required")
+		}
+		if _, ok := providers[p.ID]; ok {
+			return fmt.Errorf("duplicated provider id: %s", p.ID)
+		}
+		providers[p.ID] = struct{}{}
+		if p.OpenRouter != nil && p.Type != ProviderTypeOpenRouter {
+			return fmt.Errorf("provider %s sets openrouter but is not of type openrouter", p.ID)
+		}
+		if p.BaseURL == "" {
+			return fmt.Errorf("provider %s base_url is required", p.ID)
+		}
+		if p.AccessToken == "" {
+			return fmt.Errorf("provider %s access_token is required", p.ID)
+		}
+		for key, path := range p.Paths {
+			switch key {
+			case PathChatCompletions, PathResponses, PathMessages, PathModels:
+			default:
+				return fmt.Errorf("provider %s has unknown path %s", p.ID, key)
+			}
+			if !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+				return fmt.Errorf("provider %s path %s must start with / or be an http(s) url", p.ID, key)
+			}
+		}
+		if _, err := ParseTLSVersion(p.MinTLSVersion); err != nil {
+			return fmt.Errorf("provider %s min_tls_version: %w", p.ID, err)
+		}
+		if slo := p.SLO; slo != nil {
+			if slo.Metric != "first_token" && slo.Metric != "duration" {
+				return fmt.Errorf("provider %s slo metric must be first_token or duration", p.ID)
+			}
+			if slo.Percentile <= 0 || slo.Percentile > 100 {
+				return fmt.Errorf("provider %s slo percentile must be between 0 and 100", p.ID)
+			}
+			if slo.ThresholdMs <= 0 {
+				return fmt.Errorf("provider %s slo threshold_ms must be positive", p.ID)
+			}
+		}
+		if p.Retry != nil {
+			if err := p.Retry.validate(); err != nil {
+				return fmt.Errorf("provider %s retry: %w", p.ID, err)
+			}
+		}
+	}
+	if c.Retry != nil {
+		if err := c.Retry.validate(); err != nil {
+			return fmt.Errorf("retry: %w", err)
+		}
+	}
+	if c.DefaultLimits != nil {
+		if err := c.DefaultLimits.validate(); err != nil {
+			return fmt.Errorf("default_limits: %w", err)
+		}
+	}
+
+	for _, m := range c.Models {
+		if m.Name == "" {
+			return fmt.Errorf("model name is required")
+		}
+		if len(m.Providers) == 0 {
+			return fmt.Errorf("model %s must have at least one provider", m.Name)
+		}
+		if m.Retry != nil {
+			if err := m.Retry.validate(); err != nil {
+				return fmt.Errorf("model %s retry: %w", m.Name, err)
+			}
+		}
+		if m.Limits != nil {
+			if err := m.Limits.validate(); err != nil {
+				return fmt.Errorf("model %s limits: %w", m.Name, err)
+			}
+		}
+		if m.Capabilities != nil && m.Capabilities.MaxContext < 0 {
+			return fmt.Errorf("model %s max_context must not be negative", m.Name)
+		}
+		strategy := m.RoutingStrategy()
+		switch strategy {
+		case StrategyPriority, StrategyLowestLatency, StrategyLowestCost:
+		default:
+			return fmt.Errorf("model %s strategy %s is not supported, use priority, lowest_latency or lowest_cost", m.Name, m.Strategy)
+		}
+		switch m.Rotation {
+		case "":
+		case RotationRoundRobin:
+			if strategy != StrategyPriority {
+				return fmt.Errorf("model %s rotation %s requires the priority strategy", m.Name, m.Rotation)
+			}
+		default:
+			return fmt.Errorf("model %s rotation %s is not supported, use round_robin", m.Name, m.Rotation)
+		}
+		for _, provider := range m.Providers {
+			if provider.ID == "" {
+				return fmt.Errorf("model %s provider id is required", m.Name)
+			}
+			if provider.Capabilities != nil && provider.Capabilities.MaxContext < 0 {
+				return fmt.Errorf("model %s provider %s max_context must not be negative", m.Name, provider.ID)
+			}
+			if provider.Weight < 0 {
+				return fmt.Errorf("model %s provider %s weight must not be negative", m.Name, provider.ID)
+			}
+			if provider.Weight > 0 && strategy != StrategyPriority {
+				return fmt.Errorf("model %s cannot combine strategy %s with provider weights", m.Name, strategy)
+			}
+			if provider.Weight > 0 && m.Rotation != "" {
+				return fmt.Errorf("model %s cannot combine rotation %s with provider weights", m.Name, m.Rotation)
+			}
+			if _, ok := providers[provider.ID]; !ok {
+				return fmt.Errorf("model %s references unknown provider %s", m.Name, provider.ID)
+			}
+		}
+		for _, r := range m.Rules {
+			if r.Expression == "" {
+				return fmt.Errorf("model %s has rule with empty expression", m.Name)
+			}
+			if len(r.Providers) == 0 {
+				return fmt.Errorf("model %s rule %s must specify providers", m.Name, r.Expression)
+			}
+			if r.Rotation != "" && r.Rotation != RotationRoundRobin {
+				return fmt.Errorf("model %s rule %s rotation %s is not supported, use round_robin", m.Name, r.Expression, r.Rotation)
+			}
+			for _, override := range r.Providers {
+				if override.Provider == "" {
+					return fmt.Errorf("model %s rule %s provider is required", m.Name, r.Expression)
+				}
+				if _, ok := providers[override.Provider]; !ok {
+					return fmt.Errorf("model %s rule %s references unknown provider %s", m.Name, r.Expression, override.Provider)
+				}
+			}
+		}
+	}
+
+	if err := c.validateGroups(providers); err != nil {
+		return err
+	}
+	if c.Pricing != nil && c.Pricing.Sync != nil {
+		sync := c.Pricing.Sync
+		if strings.TrimSpace(sync.URL) == "" {
+			return fmt.Errorf("pricing sync url is required")
+		}
+		if err := validateHTTPURL(sync.URL); err != nil {
+			return fmt.Errorf("pricing sync url: %w", err)
+		}
+	}
+	if c.Warmup != nil && c.Warmup.Mode != WarmupConnect && c.Warmup.Mode != WarmupRequest {
+		return fmt.Errorf("warmup mode %s is not supported, use connect or request", c.Warmup.Mode)
+	}
+	if c.HealthCheck != nil && c.HealthCheck.Mode != WarmupConnect && c.HealthCheck.Mode != WarmupRequest {
+		return fmt.Errorf("health_check mode %s is not supported, use connect or request", c.HealthCheck.Mode)
+	}
+	if c.Pricing != nil {
+		for _, price := range c.Pricing.Prices {
+			if _, ok := providers[price.Provider]; price.Provider != "" && !ok {
+				return fmt.Errorf("pricing references unknown provider %s", price.Provider)
+			}
+			if price.Model == "" {
+				return fmt.Errorf("pricing entry is missing the model")
+			}
+			if price.Input < 0 || price.Output < 0 {
+				return fmt.Errorf("pricing of %s must not be negative", price.Model)
+			}
+		}
+	}
+	if d := c.ModelDiscovery; d != nil {
+		for _, id := range d.Providers {
+			if _, ok := providers[id]; !ok {
+				return fmt.Errorf("model_discovery references unknown provider %s", id)
+			}
+		}
+	}
+
+	if h := c.RateLimitHeaders; h != nil && strings.IndexFunc(h.RenamePrefix, func(r rune) bool {
+		return !(r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	}) >= 0 {
+		return fmt.Errorf("rate_limit_headers.rename_prefix %q may only contain letters, digits, '-' and '_'", h.RenamePrefix)
+	}
+
+	if c.Default != "" {
+		if _, ok := providers[c.Default]; !ok {
+			return fmt.Errorf("default provider %s not found", c.Default)
+		}
+	}
+
+	if c.SaveUsage {
+		if c.StorageType != "sqlite" && c.StorageType != "mysql" {
+			return fmt.Errorf("unsupported storage_type %s", c.StorageType)
+		}
+		if strings.TrimSpace(c.StorageURI) == "" {
+			return fmt.Errorf("storage_uri is required when save_usage is enabled")
+		}
+	}
+	if r := c.Retention; r != nil && (r.UsageDays < 0 || r.RequestLogDays < 0 || r.ResponseLogDays < 0 || r.AlertDays < 0 || r.AuditDays < 0) {
+		return fmt.Errorf("retention days must not be negative")
+	}
+	if c.ResponseLogs != nil && c.ResponseLogs.SampleRate > 1 {
+		return fmt.Errorf("response_logs sample_rate must be between 0 and 1")
+	}
+	if sq := c.SQLite; sq != nil {
+		switch strings.ToLower(sq.JournalMode) {
+		case "", "delete", "truncate", "persist", "memory", "wal", "off":
+		default:
+			return fmt.Errorf("sqlite journal_mode %s is not supported", sq.JournalMode)
+		}
+		switch strings.ToLower(sq.Synchronous) {
+		case "", "off", "normal", "full", "extra":
+		default:
+			return fmt.Errorf("sqlite synchronous must be off, normal, full or extra")
+		}
+		if sq.WriteBatchSize < 0 || sq.CheckpointIntervalSeconds < 0 {
+			return fmt.Errorf("sqlite write_batch_size and checkpoint_interval_seconds must not be negative")
+		}
+	}
+
+	if err := c.TLS.validate(); err != nil {
+		return err
+	}
+	if err := c.CORS.validate(); err != nil {
+		return err
+	}
+	if err := c.RequestLogEncryption.validate(); err != nil {
+		return err
+	}
+	if err := c.PIIScrubbing.validate(); err != nil {
+		return err
+	}
+	for _, path := range c.LogRedactPaths {
+		if strings.TrimSpace(path) == "" || strings.HasPrefix(path, ".") || strings.HasSuffix(path, ".") {
+			return fmt.Errorf("invalid log_redact_paths entry %q", path)
+		}
+	}
+	if err := c.PromptInspection.validate(); err != nil {
+		return err
+	}
+	if err := c.SecretDetection.validate(); err != nil {
+		return err
+	}
+	if m := c.Moderation; m != nil {
+		switch m.Action {
+		case ModerationBlock, ModerationTag:
+		default:
+			return fmt.Errorf("unsupported moderation action %s, expected block or tag", m.Action)
+		}
+		if m.Provider != "" {
+			if _, ok := providers[m.Provider]; !ok {
+				return fmt.Errorf("moderation provider %s not found", m.Provider)
+			}
+		}
+		if m.URL != "" {
+			if u, err := url.Parse(m.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("invalid moderation url %s", m.URL)
+			}
+		}
+	}
+
+	if p := c.ExternalProcessor; p != nil {
+		if p.Address == "" {
+			return fmt.Errorf("external_processor address is required")
+		}
+		if err := validateHTTPURL(p.Address); err != nil {
+			return fmt.Errorf("external_processor address: %w", err)
+		}
+	}
+
+	switch c.UpstreamUserID {
+	case "", "tenant", "key":
+	default:
+		return fmt.Errorf("unsupported upstream_user_id %s, expected tenant or key", c.UpstreamUserID)
+	}
+
+	if c.HeartbeatURL != "" {
+		u, err := url.Parse(c.HeartbeatURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid heartbeat_url %s", c.HeartbeatURL)
+		}
+	}
+
+	if err := c.validateNotifiers(); err != nil {
+		return err
+	}
+
+	if err := c.validateReports(); err != nil {
+		return err
+	}
+	if err := c.validateAlerts(); err != nil {
+		return err
+	}
+	if err := c.Exporters.validate(); err != nil {
+		return err
+	}
+	if err := c.MetricsPush.validate(); err != nil {
+		return err
+	}
+	if err := c.StatsD.validate(); err != nil {
+		return err
+	}
+	if err := c.validateCallbacks(); err != nil {
+		return err
+	}
+
+	if err := c.RateLimit.validate("rate_limit"); err != nil {
+		return err
+	}
+	if err := c.validateTenants(providers); err != nil {
+		return err
+	}
+	if err := c.validateTenantTemplates(); err != nil {
+		return err
+	}
+
+	for model, replacement := range c.Deprecations {
+		if replacement == "" || replacement == model {
+			return fmt.Errorf("deprecated model %s needs a different replacement", model)
+		}
+	}
+
+	for _, alias := range c.Alias {
+		if alias.Model == "" {
+			return fmt.Errorf("alias model is required")
+		}
+		if alias.Target == "" {
+			return fmt.Errorf("alias target is required")
+		}
+		for name := range alias.Params {
+			if name == "" || name == "model" {
+				return fmt.Errorf("alias %s: invalid param %q", alias.Model, name)
+			}
+		}
+		// We don't strictly validate that the target exists in Models here,
+		// because it might be useful to alias to a model that is provided by a default provider
+		// or handled dynamically. However, typically it should exist.
+		// For now, let's just ensure it's not empty.
+	}
+
+	return nil
+}
+
+func (e *ExportersConfig) validate() error {
+	if e == nil {
+		return nil
+	}
+	if e.Langfuse == nil && e.LangSmith == nil {
+		return fmt.Errorf("exporters needs langfuse or langsmith")
+	}
+	if e.BatchSize < 0 || e.FlushIntervalSeconds < 0 || e.QueueSize < 0 {
+		return fmt.Errorf("exporters batch_size, flush_interval_seconds and queue_size must not be negative")
+	}
+	if l := e.Langfuse; l != nil {
+		if strings.TrimSpace(l.PublicKey) == "" || strings.TrimSpace(l.SecretKey) == "" {
+			return fmt.Errorf("exporters langfuse public_key and secret_key are required")
+		}
+		if err := validateHTTPURL(l.Host); err != nil {
+			return fmt.Errorf("exporters langfuse host: %w", err)
+		}
+	}
+	if l := e.LangSmith; l != nil {
+		if strings.TrimSpace(l.APIKey) == "" {
+			return fmt.Errorf("exporters langsmith api_key is required")
+		}
+		if err := validateHTTPURL(l.Endpoint); err != nil {
+			return fmt.Errorf("exporters langsmith endpoint: %w", err)
+		}
+	}
+	return nil
+}
+
+func (m *MetricsPushConfig) validate() error {
+	if m == nil {
+		return nil
+	}
+	if m.URL == "" {
+		return fmt.Errorf("metrics_push url is required")
+	}
+	if err := validateHTTPURL(m.URL); err != nil {
+		return fmt.Errorf("metrics_push: %w", err)
+	}
+	if m.Format != MetricsPushRemoteWrite && m.Format != MetricsPushPushgateway {
+		return fmt.Errorf("metrics_push format must be remote_write or pushgateway")
+	}
+	for name := range m.Labels {
+		if !metricLabelPattern.MatchString(name) || strings.HasPrefix(name, "__") || name == "job" {
+			return fmt.Errorf("metrics_push label %q is not a valid label name", name)
+		}
+	}
+	return nil
+}
+
+func (sd *StatsDConfig) validate() error {
+	if sd == nil {
+		return nil
+	}
+	if path, ok := strings.CutPrefix(sd.Address, "unix://"); ok {
+		if path == "" {
+			return fmt.Errorf("statsd address %s has no socket path", sd.Address)
+		}
+	} else if _, _, err := net.SplitHostPort(sd.Address); err != nil {
+		return fmt.Errorf("statsd address must be host:port or unix:///path: %w", err)
+	}
+	if sd.Format != StatsDFormatDogStatsD && sd.Format != StatsDFormatStatsD {
+		return fmt.Errorf("statsd format must be dogstatsd or statsd")
+	}
+	return nil
+}
+
+func (c *Config) validateCallbacks() error {
+	for _, key := range c.Keys {
+		if key.CallbackURL == "" {
+			continue
+		}
+		if c.Callbacks == nil {
+			return fmt.Errorf("keys: callback_url needs the callbacks section")
+		}
+		if err := validateHTTPURL(key.CallbackURL); err != nil {
+			return fmt.Errorf("keys: callback_url: %w", err)
+		}
+	}
+	if c.Callbacks != nil {
+		// Without a host list any client could have the gateway POST to internal addresses.
+		if c.Callbacks.AllowHeader && len(c.Callbacks.AllowedHosts) == 0 {
+			return fmt.Errorf("callbacks allow_header needs allowed_hosts")
+		}
+		for _, host := range c.Callbacks.AllowedHosts {
+			if host == "" || strings.Contains(host, "/") {
+				return fmt.Errorf("callbacks allowed_hosts entry %q must be a host name", host)
+			}
+		}
+	}
+	return nil
+}
+
+var metricLabelPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validateHTTPURL accepts empty values, left to the defaults, and http(s) URLs.
+func validateHTTPURL(value string) error {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %s", value)
+	}
+	return nil
+}
+
+func (e *RequestLogEncryptionConfig) validate() error {
+	if e == nil {
+		return nil
+	}
+	sources := 0
+	for _, source := range []string{e.Key, e.KeyEnv, e.KeyFile, e.KeyCommand} {
+		if strings.TrimSpace(source) != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("request_log_encryption needs exactly one of key, key_env, key_file or key_command")
+	}
+	if e.Key != "" {
+		if _, err := DecodeEncryptionKey(e.Key); err != nil {
+			return fmt.Errorf("request_log_encryption: %w", err)
+		}
+	}
+	return nil
+}
+
+func (t *TLSConfig) validate() error {
+	if t == nil {
+		return nil
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("tls cert_file and key_file must be set together")
+	}
+	if _, err := ParseTLSVersion(t.MinVersion); err != nil {
+		return fmt.Errorf("tls min_version: %w", err)
+	}
+	if _, err := CipherSuiteIDs(t.CipherSuites); err != nil {
+		return fmt.Errorf("tls cipher_suites: %w", err)
+	}
+	if len(t.CipherSuites) > 0 && t.MinVersion == "1.3" {
+		return fmt.Errorf("tls cipher_suites only apply to TLS 1.2 and cannot be combined with min_version 1.3")
+	}
+	return nil
 }
 
-type ModelConfig struct {
-	Name      string         `json:"model" yaml:"model"`
-	Providers ModelProviders `json:"providers" yaml:"providers"`
-	Rules     []RuleConfig   `json:"rules" yaml:"rules"`
+func (c *CORSConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	if len(c.AllowedOrigins) == 0 {
+		return fmt.Errorf("cors allowed_origins must not be empty")
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("cors allowed_origins: %q must be * or a scheme and host such as https://app.example.com", origin)
+		}
+	}
+	for _, header := range c.AllowedHeaders {
+		if strings.TrimSpace(header) == "" {
+			return fmt.Errorf("cors allowed_headers must not contain empty names")
+		}
+	}
+	for _, method := range c.AllowedMethods {
+		if method == "" {
+			return fmt.Errorf("cors allowed_methods must not contain empty names")
+		}
+	}
+	return nil
 }
 
-type ModelProviders []ModelProvider
+func (d *SecretDetectionConfig) validate() error {
+	if d == nil {
+		return nil
+	}
+	switch d.Mode {
+	case SecretBlock, SecretMask, SecretLog:
+	default:
+		return fmt.Errorf("unsupported secret_detection mode %s, expected block, mask or log", d.Mode)
+	}
+	for _, name := range d.Detectors {
+		switch name {
+		case SecretAWSAccessKey, SecretAWSSecretKey, SecretPrivateKey, SecretBearerToken, SecretGitHubToken, SecretSlackToken:
+		default:
+			return fmt.Errorf("secret_detection: unknown detector %s", name)
+		}
+	}
+	return validatePII("secret_detection", nil, d.Patterns)
+}
 
-type ModelProvider struct {
-	ID    string `json:"provider" yaml:"provider"`
-	Model string `json:"model" yaml:"model"`
+func (p *PromptInspectionConfig) validate() error {
+	if p == nil {
+		return nil
+	}
+	switch p.Action {
+	case InspectionFlag, InspectionBlock:
+	default:
+		return fmt.Errorf("unsupported prompt_inspection action %s, expected flag or block", p.Action)
+	}
+	for _, rule := range p.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("prompt_inspection rule name is required")
+		}
+		if _, err := regexp.Compile("(?i)" + rule.Regex); err != nil || rule.Regex == "" {
+			return fmt.Errorf("prompt_inspection rule %s has an invalid regex", rule.Name)
+		}
+	}
+	if p.DisableBuiltin && len(p.Rules) == 0 && p.Classifier == nil {
+		return fmt.Errorf("prompt_inspection needs rules or a classifier when the built-in rules are disabled")
+	}
+	if cl := p.Classifier; cl != nil {
+		if u, err := url.Parse(cl.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid prompt_inspection classifier url %s", cl.URL)
+		}
+		if cl.Threshold > 1 {
+			return fmt.Errorf("prompt_inspection classifier threshold must be between 0 and 1")
+		}
+	}
+	return nil
 }
 
-type RuleConfig struct {
-	Expression string                 `json:"rule" yaml:"rule"`
-	Providers  ProviderOverrideConfig `json:"providers" yaml:"providers"`
+func (p *PIIScrubbingConfig) validate() error {
+	if p == nil {
+		return nil
+	}
+	if err := validatePII("pii_scrubbing", p.Builtin, p.Patterns); err != nil {
+		return err
+	}
+	seen := make(map[string]struct{})
+	for _, path := range p.Paths {
+		if !strings.HasPrefix(path.Path, "/") {
+			return fmt.Errorf("pii_scrubbing path %q must start with /", path.Path)
+		}
+		if _, ok := seen[path.Path]; ok {
+			return fmt.Errorf("duplicated pii_scrubbing path %s", path.Path)
+		}
+		seen[path.Path] = struct{}{}
+		if err := validatePII("pii_scrubbing path "+path.Path, path.Builtin, path.Patterns); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-type ProviderOverrideConfig []ProviderOverride
+func validatePII(scope string, builtin []string, patterns []PIIPattern) error {
+	for _, name := range builtin {
+		switch name {
+		case PIIEmail, PIIPhone, PIICreditCard, PIIAPIKey:
+		default:
+			return fmt.Errorf("%s: unknown builtin pattern %s", scope, name)
+		}
+	}
+	for _, pattern := range patterns {
+		if pattern.Name == "" {
+			return fmt.Errorf("%s: pattern name is required", scope)
+		}
+		if _, err := regexp.Compile(pattern.Regex); err != nil || pattern.Regex == "" {
+			return fmt.Errorf("%s: invalid regex of pattern %s", scope, pattern.Name)
+		}
+	}
+	return nil
+}
 
-type ProviderOverride struct {
-	Provider string `json:"provider" yaml:"provider"`
-	Model    string `json:"model" yaml:"model"`
+// ResolveKey reads the request log key from its configured source.
+func (e *RequestLogEncryptionConfig) ResolveKey() ([]byte, error) {
+	var raw string
+	switch {
+	case e.Key != "":
+		raw = e.Key
+	case e.KeyEnv != "":
+		raw = os.Getenv(e.KeyEnv)
+		if raw == "" {
+			return nil, fmt.Errorf("environment variable %s is empty", e.KeyEnv)
+		}
+	case e.KeyFile != "":
+		data, err := os.ReadFile(e.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read key file: %w", err)
+		}
+		raw = string(data)
+	case e.KeyCommand != "":
+		out, err := exec.Command("sh", "-c", e.KeyCommand).Output()
+		if err != nil {
+			return nil, fmt.Errorf("run key command: %w", err)
+		}
+		raw = string(out)
+	}
+	return DecodeEncryptionKey(raw)
 }
 
-func Load(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+// DecodeEncryptionKey decodes a base64 encoded AES-256 key.
+func DecodeEncryptionKey(raw string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(raw))
 	if err != nil {
-		return nil, fmt.Errorf("read config: %w", err)
+		return nil, fmt.Errorf("key must be base64 encoded: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
 	}
+	return key, nil
+}
 
-	var cfg Config
-	if err := unmarshalYAML(data, &cfg); err != nil {
-		return nil, fmt.Errorf("unmarshal config: %w", err)
+func (c *Config) validateNotifiers() error {
+	names := make(map[string]struct{})
+	for _, n := range c.Notifiers {
+		if n.Name == "" {
+			return fmt.Errorf("notifier name is required")
+		}
+		if _, ok := names[n.Name]; ok {
+			return fmt.Errorf("duplicated notifier name: %s", n.Name)
+		}
+		names[n.Name] = struct{}{}
+		switch n.Type {
+		case "webhook", "slack", "discord", "feishu":
+			if strings.TrimSpace(n.URL) == "" {
+				return fmt.Errorf("notifier %s url is required", n.Name)
+			}
+		case "email":
+			if strings.TrimSpace(n.Host) == "" || strings.TrimSpace(n.From) == "" || len(n.To) == 0 {
+				return fmt.Errorf("notifier %s requires host, from and to", n.Name)
+			}
+		case "pagerduty", "opsgenie":
+			if strings.TrimSpace(n.APIKey) == "" {
+				return fmt.Errorf("notifier %s api_key is required", n.Name)
+			}
+		default:
+			return fmt.Errorf("notifier %s has unsupported type %s", n.Name, n.Type)
+		}
+		if n.Retries < 0 {
+			return fmt.Errorf("notifier %s retries must not be negative", n.Name)
+		}
+	}
+	if a := c.ErrorRateAlert; a != nil && (a.Threshold <= 0 || a.Threshold > 1) {
+		return fmt.Errorf("error_rate_alert threshold must be between 0 and 1")
 	}
+	if a := c.AnomalyDetection; a != nil && a.Factor <= 1 {
+		return fmt.Errorf("anomaly_detection factor must be greater than 1")
+	}
+	return nil
+}
 
-	cfg.setDefaults()
+func (c *Config) validateReports() error {
+	names := make(map[string]struct{})
+	for _, r := range c.Reports {
+		if r.Name == "" {
+			return fmt.Errorf("report name is required")
+		}
+		if _, ok := names[r.Name]; ok {
+			return fmt.Errorf("duplicated report name: %s", r.Name)
+		}
+		names[r.Name] = struct{}{}
+		if _, err := cron.Parse(r.Schedule); err != nil {
+			return fmt.Errorf("report %s: %w", r.Name, err)
+		}
+		switch r.Period {
+		case "", "daily", "weekly":
+		default:
+			return fmt.Errorf("report %s has unsupported period %s, expected daily or weekly", r.Name, r.Period)
+		}
+	}
+	return nil
+}
 
-	if err := cfg.Validate(); err != nil {
-		return nil, err
+func (c *Config) validateAlerts() error {
+	notifiers := make(map[string]struct{}, len(c.Notifiers))
+	for _, n := range c.Notifiers {
+		notifiers[n.Name] = struct{}{}
+	}
+	names := make(map[string]struct{})
+	for _, a := range c.Alerts {
+		if a.Name == "" {
+			return fmt.Errorf("alert name is required")
+		}
+		if _, ok := names[a.Name]; ok {
+			return fmt.Errorf("duplicated alert name: %s", a.Name)
+		}
+		names[a.Name] = struct{}{}
+		expression, _, err := a.ParseCondition()
+		if err != nil {
+			return fmt.Errorf("alert %s: %w", a.Name, err)
+		}
+		if expression == "" {
+			return fmt.Errorf("alert %s condition is required", a.Name)
+		}
+		switch a.Severity {
+		case "", "info", "warning", "critical":
+		default:
+			return fmt.Errorf("alert %s has unsupported severity %s", a.Name, a.Severity)
+		}
+		for _, name := range a.Notifiers {
+			if _, ok := notifiers[name]; !ok {
+				return fmt.Errorf("alert %s references unknown notifier %s", a.Name, name)
+			}
+		}
 	}
+	return nil
+}
 
-	return &cfg, nil
+func (r *RateLimitConfig) validate(name string) error {
+	if r == nil {
+		return nil
+	}
+	if r.RequestsPerMinute <= 0 {
+		return fmt.Errorf("%s requests_per_minute must be positive", name)
+	}
+	if r.Burst < 0 {
+		return fmt.Errorf("%s burst must not be negative", name)
+	}
+	return nil
 }
 
-func (c *Config) setDefaults() {
-	for i := range c.Providers {
-		if c.Providers[i].Type == "" {
-			c.Providers[i].Type = ProviderTypeOpenAI
-			if c.Providers[i].Timeout <= 0 {
-				c.Providers[i].Timeout = 10 * time.Minute
-			} else {
-				c.Providers[i].Timeout = c.Providers[i].Timeout * time.Second
+// HasAdminKey reports whether an admin_keys entry or a key with the admin role
+// is configured. Without one, no key may call the admin endpoints.
+func (c *Config) HasAdminKey() bool {
+	if len(c.AdminKeys) > 0 {
+		return true
+	}
+	for _, key := range c.Keys {
+		for _, role := range key.Roles {
+			if role == RoleAdmin {
+				return true
 			}
 		}
 	}
+	return false
+}
 
-	if c.StorageType == "" {
-		c.StorageType = "sqlite"
-	}
-	if c.StorageURI == "" {
-		c.StorageURI = "file:usage.db?_pragma=busy_timeout=5000&_pragma=journal_mode=WAL"
+func (c *Config) hasTenantKeys() bool {
+	for _, t := range c.Tenants {
+		if len(t.APIKeys) > 0 || len(t.APIKeyDigests) > 0 {
+			return true
+		}
 	}
+	return false
 }
 
-func (c *Config) Validate() error {
-	if c.Listen == "" {
-		return fmt.Errorf("listen address is required")
+func (c *Config) validateGroups(providers map[string]struct{}) error {
+	models := make(map[string]struct{}, len(c.Models))
+	for _, m := range c.Models {
+		models[m.Name] = struct{}{}
 	}
-	if len(c.APIKeys) == 0 {
-		return fmt.Errorf("at least one api key is required")
+	names := make(map[string]struct{}, len(c.Groups))
+	for _, g := range c.Groups {
+		if g.Name == "" {
+			return fmt.Errorf("group name is required")
+		}
+		if _, ok := names[g.Name]; ok {
+			return fmt.Errorf("duplicated group name: %s", g.Name)
+		}
+		names[g.Name] = struct{}{}
+		if _, ok := models[g.Name]; ok {
+			return fmt.Errorf("group %s conflicts with a model of the same name", g.Name)
+		}
+		if len(g.Models) == 0 {
+			return fmt.Errorf("group %s must have at least one model", g.Name)
+		}
+		for _, member := range g.Models {
+			if member.Model == "" {
+				return fmt.Errorf("group %s model is required", g.Name)
+			}
+			if member.Provider != "" {
+				if _, ok := providers[member.Provider]; !ok {
+					return fmt.Errorf("group %s references unknown provider %s", g.Name, member.Provider)
+				}
+				continue
+			}
+			if _, ok := models[member.Model]; !ok {
+				return fmt.Errorf("group %s model %s is not configured, set its provider", g.Name, member.Model)
+			}
+		}
 	}
+	return nil
+}
 
-	providers := make(map[string]struct{})
-	for _, p := range c.Providers {
-		if p.ID == "" {
-			return fmt.Errorf("provider id is required")
+func (c *Config) validateTenants(providers map[string]struct{}) error {
+	keys := make(map[string]string)
+	for _, key := range c.APIKeys {
+		if err := validateKey(key.Key, key.KeyMetadata); err != nil {
+			return fmt.Errorf("api_keys: %w", err)
 		}
-		if _, ok := providers[p.ID]; ok {
-			return fmt.Errorf("duplicated provider id: %s", p.ID)
+		if _, ok := keys[key.Key]; ok {
+			return fmt.Errorf("api_keys: key %s... is configured more than once", key.Key[:min(4, len(key.Key))])
 		}
-		providers[p.ID] = struct{}{}
-		if p.BaseURL == "" {
-			return fmt.Errorf("provider %s base_url is required", p.ID)
+		keys[key.Key] = ""
+	}
+	for _, key := range c.AdminKeys {
+		keys[key] = ""
+	}
+	for _, key := range c.Keys {
+		if err := validateKey(key.Key, key.KeyMetadata); err != nil {
+			return fmt.Errorf("keys: %w", err)
 		}
-		if p.AccessToken == "" {
-			return fmt.Errorf("provider %s access_token is required", p.ID)
+		if _, ok := keys[key.Key]; ok {
+			return fmt.Errorf("keys: key %s... is configured more than once", key.Key[:min(4, len(key.Key))])
+		}
+		keys[key.Key] = ""
+		if len(key.Roles) == 0 {
+			return fmt.Errorf("keys: key %s... needs at least one role", key.Key[:min(4, len(key.Key))])
+		}
+		for _, role := range key.Roles {
+			switch role {
+			case RoleProxy, RoleReadUsage, RoleAdmin:
+			default:
+				return fmt.Errorf("keys: unknown role %s, expected proxy, read-usage or admin", role)
+			}
+		}
+		if key.Budget != nil {
+			if err := key.Budget.validate(); err != nil {
+				return fmt.Errorf("keys: key %s...: %w", key.Key[:min(4, len(key.Key))], err)
+			}
+			if !c.SaveUsage {
+				return fmt.Errorf("keys: key %s... budget requires save_usage to be enabled", key.Key[:min(4, len(key.Key))])
+			}
 		}
 	}
 
-	for _, m := range c.Models {
-		if m.Name == "" {
-			return fmt.Errorf("model name is required")
+	tenants := make(map[string]struct{})
+	digests := make(map[string]string)
+	for _, t := range c.Tenants {
+		if t.ID == "" {
+			return fmt.Errorf("tenant id is required")
 		}
-		if len(m.Providers) == 0 {
-			return fmt.Errorf("model %s must have at least one provider", m.Name)
+		if _, ok := tenants[t.ID]; ok {
+			return fmt.Errorf("duplicated tenant id: %s", t.ID)
 		}
-		for _, provider := range m.Providers {
-			if provider.ID == "" {
-				return fmt.Errorf("model %s provider id is required", m.Name)
+		tenants[t.ID] = struct{}{}
+		if len(t.APIKeys) == 0 && len(t.APIKeyDigests) == 0 {
+			return fmt.Errorf("tenant %s must have at least one api key", t.ID)
+		}
+		for _, key := range t.APIKeys {
+			if key == "" {
+				return fmt.Errorf("tenant %s has an empty api key", t.ID)
 			}
-			if _, ok := providers[provider.ID]; !ok {
-				return fmt.Errorf("model %s references unknown provider %s", m.Name, provider.ID)
+			if owner, ok := keys[key]; ok {
+				if owner == "" {
+					return fmt.Errorf("tenant %s api key is already used as a global api key", t.ID)
+				}
+				return fmt.Errorf("tenant %s api key is already used by tenant %s", t.ID, owner)
 			}
+			keys[key] = t.ID
 		}
-		for _, r := range m.Rules {
-			if r.Expression == "" {
-				return fmt.Errorf("model %s has rule with empty expression", m.Name)
+		for _, digest := range t.APIKeyDigests {
+			if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size || digest != strings.ToLower(digest) {
+				return fmt.Errorf("tenant %s api_key_digests must be lowercase SHA-256 hex digests", t.ID)
 			}
-			if len(r.Providers) == 0 {
-				return fmt.Errorf("model %s rule %s must specify providers", m.Name, r.Expression)
+			if owner, ok := digests[digest]; ok {
+				return fmt.Errorf("tenant %s api key is already used by tenant %s", t.ID, owner)
 			}
-			for _, override := range r.Providers {
-				if override.Provider == "" {
-					return fmt.Errorf("model %s rule %s provider is required", m.Name, r.Expression)
-				}
-				if _, ok := providers[override.Provider]; !ok {
-					return fmt.Errorf("model %s rule %s references unknown provider %s", m.Name, r.Expression, override.Provider)
+			digests[digest] = t.ID
+		}
+		if t.Budget != nil {
+			if err := t.Budget.validate(); err != nil {
+				return fmt.Errorf("tenant %s: %w", t.ID, err)
+			}
+			if !c.SaveUsage {
+				return fmt.Errorf("tenant %s budget requires save_usage to be enabled", t.ID)
+			}
+		}
+		if err := t.RateLimit.validate("tenant " + t.ID + " rate_limit"); err != nil {
+			return err
+		}
+		for _, override := range t.Overrides {
+			if override.Model == "" {
+				return fmt.Errorf("tenant %s override model is required", t.ID)
+			}
+			if len(override.Providers) == 0 {
+				return fmt.Errorf("tenant %s override for model %s must specify providers", t.ID, override.Model)
+			}
+			for _, provider := range override.Providers {
+				if _, ok := providers[provider.ID]; !ok {
+					return fmt.Errorf("tenant %s override for model %s references unknown provider %s", t.ID, override.Model, provider.ID)
 				}
 			}
 		}
 	}
-
-	if c.Default != "" {
-		if _, ok := providers[c.Default]; !ok {
-			return fmt.Errorf("default provider %s not found", c.Default)
+	for key, owner := range keys {
+		if tenant, ok := digests[APIKeyDigest(key)]; ok {
+			if owner == "" {
+				return fmt.Errorf("tenant %s api key is already used as a global api key", tenant)
+			}
+			return fmt.Errorf("tenant %s api key is already used by tenant %s", tenant, owner)
 		}
 	}
+	return nil
+}
 
-	if c.SaveUsage {
-		if c.StorageType != "sqlite" && c.StorageType != "mysql" {
-			return fmt.Errorf("unsupported storage_type %s", c.StorageType)
+// validateTenantTemplates checks the templates by validating a sample tenant built from each.
+func (c *Config) validateTenantTemplates() error {
+	names := make(map[string]struct{})
+	for _, tpl := range c.TenantTemplates {
+		if tpl.Name == "" {
+			return fmt.Errorf("tenant template name is required")
 		}
-		if strings.TrimSpace(c.StorageURI) == "" {
-			return fmt.Errorf("storage_uri is required when save_usage is enabled")
+		if _, ok := names[tpl.Name]; ok {
+			return fmt.Errorf("duplicated tenant template name: %s", tpl.Name)
+		}
+		names[tpl.Name] = struct{}{}
+
+		sample := TenantConfig{ID: "template-" + tpl.Name, APIKeys: []string{"template-" + tpl.Name}}
+		tpl.Apply(&sample)
+		candidate := Config{SaveUsage: c.SaveUsage, Providers: c.Providers, Tenants: []TenantConfig{sample}}
+		providers := make(map[string]struct{}, len(c.Providers))
+		for _, p := range c.Providers {
+			providers[p.ID] = struct{}{}
+		}
+		if err := candidate.validateTenants(providers); err != nil {
+			return fmt.Errorf("tenant template %s: %w", tpl.Name, err)
 		}
 	}
+	return nil
+}
 
-	for _, alias := range c.Alias {
-		if alias.Model == "" {
-			return fmt.Errorf("alias model is required")
+// TenantTemplateByName returns the tenant template with the given name.
+func (c Config) TenantTemplateByName(name string) (*TenantTemplate, bool) {
+	for i := range c.TenantTemplates {
+		if c.TenantTemplates[i].Name == name {
+			return &c.TenantTemplates[i], true
 		}
-		if alias.Target == "" {
-			return fmt.Errorf("alias target is required")
+	}
+	return nil, false
+}
+
+// TenantByID returns the tenant with the given id.
+func (c Config) TenantByID(id string) (*TenantConfig, bool) {
+	for i := range c.Tenants {
+		if c.Tenants[i].ID == id {
+			return &c.Tenants[i], true
 		}
-		// We don't strictly validate that the target exists in Models here,
-		// because it might be useful to alias to a model that is provided by a default provider
-		// or handled dynamically. However, typically it should exist.
-		// For now, let's just ensure it's not empty.
 	}
+	return nil, false
+}
 
-	return nil
+// AllowsModel reports whether the tenant may request the given model.
+func (t TenantConfig) AllowsModel(model string) bool {
+	if len(t.Models) == 0 {
+		return true
+	}
+	for _, m := range t.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
 }
 
 func (m *ModelProviders) UnmarshalJSON(data []byte) error {
@@ -222,6 +2532,29 @@ func (m *ModelProviders) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+func (a *APIKeys) UnmarshalJSON(data []byte) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+
+	keys := make(APIKeys, 0, len(items))
+	for _, item := range items {
+		var key string
+		if err := json.Unmarshal(item, &key); err == nil {
+			keys = append(keys, APIKeyConfig{Key: key})
+			continue
+		}
+		var obj APIKeyConfig
+		if err := json.Unmarshal(item, &obj); err != nil {
+			return err
+		}
+		keys = append(keys, obj)
+	}
+	*a = keys
+	return nil
+}
+
 func (p *ProviderOverrideConfig) UnmarshalJSON(data []byte) error {
 	var arr []ProviderOverride
 	if err := json.Unmarshal(data, &arr); err == nil {
@@ -353,21 +2686,45 @@ func unmarshalYAML(data []byte, out interface{}) error {
 }
 
 func parseKeyValue(text string) (string, interface{}, bool) {
-	parts := strings.SplitN(text, ":", 2)
-	key := strings.TrimSpace(parts[0])
+	sep := keySeparator(text)
+	if sep < 0 {
+		return text, nil, false
+	}
+	key := strings.TrimSpace(text[:sep])
 	if key == "" {
 		return "", nil, false
 	}
-	if len(parts) == 1 {
-		return key, nil, false
-	}
-	valueStr := strings.TrimSpace(parts[1])
+	valueStr := strings.TrimSpace(text[sep+1:])
 	if valueStr == "" {
 		return key, nil, false
 	}
 	return key, parseScalar(valueStr), true
 }
 
+// keySeparator returns the index of the colon ending the key of a mapping: the
+// first one outside quotes followed by a space or the end of the line, so
+// values such as "env:prod" stay scalars.
+func keySeparator(text string) int {
+	inSingle, inDouble := false, false
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\'':
+			if !inDouble {
+				inSingle = !inSingle
+			}
+		case '"':
+			if !inSingle {
+				inDouble = !inDouble
+			}
+		case ':':
+			if !inSingle && !inDouble && (i == len(text)-1 || text[i+1] == ' ' || text[i+1] == '\t') {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
 func parseScalar(text string) interface{} {
 	if strings.HasPrefix(text, "\"") && strings.HasSuffix(text, "\"") && len(text) >= 2 {
 		return strings.Trim(text, "\"")
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadConfig(t *testing.T, data string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestLoadConvertsProviderTimeoutsOfEveryType(t *testing.T) {
+	cfg, err := loadConfig(t, `
+listen: ":8080"
+api_keys:
+  - sk-test
+providers:
+  - id: untyped
+    base_url: https://untyped.example.com/v1
+    access_token: sk-upstream
+    timeout: 30
+  - id: anthropic
+    type: anthropic
+    base_url: https://api.anthropic.com/v1
+    access_token: sk-upstream
+    timeout: 45
+  - id: defaulted
+    type: openai
+    base_url: https://defaulted.example.com/v1
+    access_token: sk-upstream
+models:
+  - model: m
+    providers:
+      - provider: untyped
+`)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	want := map[string]time.Duration{
+		"untyped":   30 * time.Second,
+		"anthropic": 45 * time.Second,
+		"defaulted": 10 * time.Minute,
+	}
+	for _, provider := range cfg.Providers {
+		if provider.Timeout != want[provider.ID] {
+			t.Errorf("provider %s: timeout %s, want %s", provider.ID, provider.Timeout, want[provider.ID])
+		}
+	}
+}
+
+func TestCallbackHeaderNeedsAllowedHosts(t *testing.T) {
+	const base = `
+listen: ":8080"
+api_keys:
+  - sk-test
+providers:
+  - id: p
+    base_url: https://p.example.com/v1
+    access_token: sk-upstream
+models:
+  - model: m
+    providers:
+      - provider: p
+callbacks:
+  allow_header: true
+`
+	if _, err := loadConfig(t, base); err == nil || !strings.Contains(err.Error(), "allowed_hosts") {
+		t.Fatalf("expected allow_header without allowed_hosts to be rejected, got %v", err)
+	}
+	if _, err := loadConfig(t, base+"  allowed_hosts:\n    - hooks.example.com\n"); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+}
+
+func TestRoutingStrategy(t *testing.T) {
+	if got := (&ModelConfig{}).RoutingStrategy(); got != StrategyPriority {
+		t.Fatalf("expected the priority default, got %s", got)
+	}
+
+	const base = `
+listen: ":8080"
+api_keys:
+  - sk-test
+providers:
+  - id: p
+    base_url: https://p.example.com/v1
+    access_token: sk-upstream
+models:
+  - model: m
+    providers:
+      - provider: p
+`
+	cfg, err := loadConfig(t, base+"    strategy: lowest_cost\npricing:\n  sync:\n    url: https://prices.example.com\n")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := cfg.Models[0].RoutingStrategy(); got != StrategyLowestCost {
+		t.Fatalf("expected lowest_cost, got %s", got)
+	}
+	if sync := cfg.Pricing.Sync; sync.IntervalSeconds != 86400 || sync.TimeoutSeconds != 30 {
+		t.Fatalf("expected the pricing sync defaults, got %+v", sync)
+	}
+	if _, err := loadConfig(t, base+"    strategy: cheapest\n"); err == nil {
+		t.Fatal("expected an unknown strategy to be rejected")
+	}
+}
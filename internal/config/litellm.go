@@ -0,0 +1,393 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// liteLLMConfig is the part of a LiteLLM proxy config.yaml the converter reads.
+type liteLLMConfig struct {
+	ModelList       []liteLLMDeployment `json:"model_list"`
+	RouterSettings  map[string]any      `json:"router_settings"`
+	LiteLLMSettings map[string]any      `json:"litellm_settings"`
+	GeneralSettings map[string]any      `json:"general_settings"`
+}
+
+type liteLLMDeployment struct {
+	ModelName string         `json:"model_name"`
+	Params    map[string]any `json:"litellm_params"`
+}
+
+// liteLLMProvider describes how a LiteLLM provider prefix maps to a gateway provider.
+type liteLLMProvider struct {
+	Type    ProviderType
+	BaseURL string
+	KeyEnv  string
+}
+
+// liteLLMProviders are the LiteLLM provider prefixes the converter knows the
+// endpoint of. Every other prefix needs an api_base serving the OpenAI API.
+var liteLLMProviders = map[string]liteLLMProvider{
+	"openai":       {ProviderTypeOpenAI, "https://api.openai.com/v1", "OPENAI_API_KEY"},
+	"anthropic":    {ProviderTypeAnthropic, "https://api.anthropic.com/v1", "ANTHROPIC_API_KEY"},
+	"azure":        {ProviderTypeOpenAI, "", "AZURE_API_KEY"},
+	"openrouter":   {ProviderTypeOpenRouter, OpenRouterBaseURL, "OPENROUTER_API_KEY"},
+	"groq":         {ProviderTypeOpenAI, "https://api.groq.com/openai/v1", "GROQ_API_KEY"},
+	"together_ai":  {ProviderTypeOpenAI, "https://api.together.xyz/v1", "TOGETHERAI_API_KEY"},
+	"deepseek":     {ProviderTypeOpenAI, "https://api.deepseek.com/v1", "DEEPSEEK_API_KEY"},
+	"mistral":      {ProviderTypeOpenAI, "https://api.mistral.ai/v1", "MISTRAL_API_KEY"},
+	"fireworks_ai": {ProviderTypeOpenAI, "https://api.fireworks.ai/inference/v1", "FIREWORKS_AI_API_KEY"},
+	"perplexity":   {ProviderTypeOpenAI, "https://api.perplexity.ai", "PERPLEXITYAI_API_KEY"},
+	"xai":          {ProviderTypeOpenAI, "https://api.x.ai/v1", "XAI_API_KEY"},
+}
+
+// liteLLMAzureAPIVersion is used for Azure deployments without an api_version.
+const liteLLMAzureAPIVersion = "2024-10-21"
+
+// liteLLMParams are the litellm_params the converter carries over.
+var liteLLMParams = map[string]bool{
+	"model": true, "custom_llm_provider": true, "api_base": true, "base_url": true,
+	"api_key": true, "api_version": true, "timeout": true, "organization": true,
+}
+
+// ConvertLiteLLM converts a LiteLLM proxy config.yaml into a gateway
+// configuration. Deployments sharing a model_name become the providers of one
+// model, tried in the order they are listed, followed by the deployments of
+// their fallbacks; model_group_alias entries become aliases and the master_key
+// the gateway API key. Keys written as os.environ/NAME are resolved with
+// getenv. Settings without a gateway equivalent are reported as warnings.
+func ConvertLiteLLM(data []byte, getenv func(string) string) (*Config, []string, error) {
+	var src liteLLMConfig
+	if err := unmarshalYAML(data, &src); err != nil {
+		return nil, nil, fmt.Errorf("parse litellm config: %w", err)
+	}
+	if len(src.ModelList) == 0 {
+		return nil, nil, fmt.Errorf("litellm config has no model_list entries")
+	}
+
+	c := &liteLLMConverter{getenv: getenv, providerKeys: map[string]string{}, models: map[string]int{}}
+	cfg := &Config{Listen: "0.0.0.0:8000"}
+
+	for i, deployment := range src.ModelList {
+		provider, model, ok := c.convertDeployment(i, deployment)
+		if !ok {
+			continue
+		}
+		idx, exists := c.models[deployment.ModelName]
+		if !exists {
+			idx = len(cfg.Models)
+			c.models[deployment.ModelName] = idx
+			cfg.Models = append(cfg.Models, ModelConfig{Name: deployment.ModelName})
+		}
+		cfg.Models[idx].Providers = appendModelProvider(cfg.Models[idx].Providers, ModelProvider{ID: provider, Model: model})
+	}
+	cfg.Providers = c.providers
+
+	c.applyFallbacks(cfg, src)
+	c.applyAliases(cfg, src.RouterSettings["model_group_alias"])
+
+	if key := c.resolveKey(src.GeneralSettings["master_key"], "LITELLM_MASTER_KEY", "general_settings.master_key"); key != "" {
+		cfg.APIKeys = APIKeys{{Key: key}}
+	} else {
+		cfg.APIKeys = APIKeys{{Key: "sk-your-gateway-key"}}
+		c.warnf("general_settings.master_key is not set; replace the generated gateway API key")
+	}
+
+	if strategy, ok := src.RouterSettings["routing_strategy"].(string); ok && strategy != "simple-shuffle" {
+		c.warnf("router_settings.routing_strategy %q is not supported; providers are tried in the order listed", strategy)
+	}
+	for _, section := range []struct {
+		name     string
+		settings map[string]any
+		handled  map[string]bool
+	}{
+		{"router_settings", src.RouterSettings, map[string]bool{"model_group_alias": true, "fallbacks": true, "routing_strategy": true}},
+		{"litellm_settings", src.LiteLLMSettings, map[string]bool{"fallbacks": true}},
+		{"general_settings", src.GeneralSettings, map[string]bool{"master_key": true}},
+	} {
+		for _, key := range sortedKeys(section.settings) {
+			if !section.handled[key] {
+				c.warnf("%s.%s is not supported and was ignored", section.name, key)
+			}
+		}
+	}
+
+	return cfg, c.warnings, nil
+}
+
+type liteLLMConverter struct {
+	getenv       func(string) string
+	providers    []ProviderConfig
+	providerKeys map[string]string
+	models       map[string]int
+	warnings     []string
+}
+
+func (c *liteLLMConverter) warnf(format string, args ...any) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// convertDeployment returns the provider serving a model_list entry and the
+// provider side model name.
+func (c *liteLLMConverter) convertDeployment(i int, deployment liteLLMDeployment) (string, string, bool) {
+	scope := fmt.Sprintf("model_list[%d] (%s)", i, deployment.ModelName)
+	model := paramString(deployment.Params, "model")
+	if deployment.ModelName == "" || model == "" {
+		c.warnf("model_list[%d]: model_name and litellm_params.model are required, skipped", i)
+		return "", "", false
+	}
+	if strings.Contains(deployment.ModelName, "*") {
+		c.warnf("%s: wildcard model names are not supported, skipped; see model_discovery", scope)
+		return "", "", false
+	}
+
+	prefix, name := "openai", model
+	if p, rest, ok := strings.Cut(model, "/"); ok {
+		prefix, name = p, rest
+	} else if strings.HasPrefix(model, "claude") {
+		prefix = "anthropic"
+	}
+	if custom := paramString(deployment.Params, "custom_llm_provider"); custom != "" {
+		prefix, name = custom, model
+	}
+
+	known, ok := liteLLMProviders[prefix]
+	baseURL := paramString(deployment.Params, "api_base")
+	if baseURL == "" {
+		baseURL = paramString(deployment.Params, "base_url")
+	}
+	if baseURL == "" {
+		baseURL = known.BaseURL
+	}
+	if baseURL == "" {
+		c.warnf("%s: provider %q needs an api_base, skipped", scope, prefix)
+		return "", "", false
+	}
+	if !ok {
+		c.warnf("%s: provider %q is assumed to serve the OpenAI API at %s", scope, prefix, baseURL)
+		known = liteLLMProvider{Type: ProviderTypeOpenAI, KeyEnv: strings.ToUpper(prefix) + "_API_KEY"}
+	}
+
+	provider := ProviderConfig{
+		Type:        known.Type,
+		BaseURL:     strings.TrimRight(baseURL, "/"),
+		AccessToken: c.resolveKey(deployment.Params["api_key"], known.KeyEnv, scope+" api_key"),
+	}
+	if provider.AccessToken == "" {
+		provider.AccessToken = "REPLACE_ME_" + known.KeyEnv
+		c.warnf("%s: no API key found, set access_token of the generated provider", scope)
+	}
+	switch prefix {
+	case "anthropic":
+		provider.Headers = map[string]string{"anthropic-version": "2023-06-01"}
+	case "azure":
+		version := paramString(deployment.Params, "api_version")
+		if version == "" {
+			version = liteLLMAzureAPIVersion
+		}
+		provider.Headers = map[string]string{"api-key": provider.AccessToken}
+		provider.Paths = map[string]string{PathChatCompletions: "/openai/deployments/{model}/chat/completions?api-version=" + url.QueryEscape(version)}
+	}
+	if org := paramString(deployment.Params, "organization"); org != "" {
+		if provider.Headers == nil {
+			provider.Headers = map[string]string{}
+		}
+		provider.Headers["OpenAI-Organization"] = org
+	}
+	if timeout, ok := paramSeconds(deployment.Params["timeout"]); ok {
+		provider.Timeout = timeout
+	} else if deployment.Params["timeout"] != nil {
+		c.warnf("%s: timeout %v is not a number of seconds, ignored", scope, deployment.Params["timeout"])
+	}
+
+	var ignored []string
+	for _, key := range sortedKeys(deployment.Params) {
+		if !liteLLMParams[key] {
+			ignored = append(ignored, key)
+		}
+	}
+	if len(ignored) > 0 {
+		c.warnf("%s: litellm_params %s are not supported and were ignored", scope, strings.Join(ignored, ", "))
+	}
+
+	return c.addProvider(prefix, provider), name, true
+}
+
+// addProvider returns the ID of the provider, reusing an identical provider
+// added before. IDs are the LiteLLM prefix, suffixed when it is taken.
+func (c *liteLLMConverter) addProvider(prefix string, provider ProviderConfig) string {
+	key, _ := json.Marshal(provider)
+	if id, ok := c.providerKeys[string(key)]; ok {
+		return id
+	}
+
+	base := strings.ReplaceAll(prefix, "_", "-")
+	provider.ID = base
+	for n := 2; c.hasProvider(provider.ID); n++ {
+		provider.ID = base + "-" + strconv.Itoa(n)
+	}
+	c.providers = append(c.providers, provider)
+	c.providerKeys[string(key)] = provider.ID
+	return provider.ID
+}
+
+func (c *liteLLMConverter) hasProvider(id string) bool {
+	for _, provider := range c.providers {
+		if provider.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveKey returns a literal key, resolves os.environ/NAME references and
+// falls back to the provider's environment variable when no key is given.
+func (c *liteLLMConverter) resolveKey(value any, defaultEnv, scope string) string {
+	raw, _ := value.(string)
+	if raw == "" {
+		if defaultEnv == "" {
+			return ""
+		}
+		return c.getenv(defaultEnv)
+	}
+	name, ok := strings.CutPrefix(raw, "os.environ/")
+	if !ok {
+		return raw
+	}
+	if resolved := c.getenv(name); resolved != "" {
+		return resolved
+	}
+	c.warnf("%s: environment variable %s is not set", scope, name)
+	return ""
+}
+
+// applyFallbacks appends the deployments of each fallback model to the
+// providers of the model it backs up. Fallbacks are not transitive.
+func (c *liteLLMConverter) applyFallbacks(cfg *Config, src liteLLMConfig) {
+	deployments := make([]ModelProviders, len(cfg.Models))
+	for i, model := range cfg.Models {
+		deployments[i] = append(ModelProviders(nil), model.Providers...)
+	}
+	for _, scope := range []string{"router_settings", "litellm_settings"} {
+		settings := src.RouterSettings
+		if scope == "litellm_settings" {
+			settings = src.LiteLLMSettings
+		}
+		entries, _ := flowValue(settings["fallbacks"]).([]any)
+		for _, entry := range entries {
+			mapping, _ := flowValue(entry).(map[string]any)
+			for _, name := range sortedKeys(mapping) {
+				idx, ok := c.models[name]
+				if !ok {
+					c.warnf("%s.fallbacks: model %q is not in model_list, ignored", scope, name)
+					continue
+				}
+				targets, _ := flowValue(mapping[name]).([]any)
+				for _, target := range targets {
+					fallback, _ := target.(string)
+					fallbackIdx, ok := c.models[fallback]
+					if !ok {
+						c.warnf("%s.fallbacks: fallback %q of %q is not in model_list, ignored", scope, fallback, name)
+						continue
+					}
+					for _, provider := range deployments[fallbackIdx] {
+						cfg.Models[idx].Providers = appendModelProvider(cfg.Models[idx].Providers, provider)
+					}
+				}
+			}
+		}
+	}
+}
+
+// applyAliases converts router_settings.model_group_alias, whose values are
+// either the target model or a mapping with a model field.
+func (c *liteLLMConverter) applyAliases(cfg *Config, value any) {
+	aliases, _ := flowValue(value).(map[string]any)
+	for _, alias := range sortedKeys(aliases) {
+		target, _ := aliases[alias].(string)
+		if mapping, ok := flowValue(aliases[alias]).(map[string]any); ok {
+			target, _ = mapping["model"].(string)
+		}
+		if _, ok := c.models[target]; !ok {
+			c.warnf("router_settings.model_group_alias: target %q of %q is not in model_list, ignored", target, alias)
+			continue
+		}
+		cfg.Alias = append(cfg.Alias, AliasConfig{Model: alias, Target: target})
+	}
+}
+
+func appendModelProvider(providers ModelProviders, provider ModelProvider) ModelProviders {
+	for _, existing := range providers {
+		if existing.ID == provider.ID && existing.Model == provider.Model {
+			return providers
+		}
+	}
+	return append(providers, provider)
+}
+
+// flowValue decodes flow style values such as ["a", "b"] or {"a": "b"},
+// which the YAML parser keeps as strings. Unquoted lists like [a, b] are
+// split on commas.
+func flowValue(value any) any {
+	text, ok := value.(string)
+	if !ok {
+		return value
+	}
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "[") && !strings.HasPrefix(text, "{") {
+		return value
+	}
+	var decoded any
+	if err := json.Unmarshal([]byte(text), &decoded); err == nil {
+		return decoded
+	}
+	if !strings.HasPrefix(text, "[") || !strings.HasSuffix(text, "]") {
+		return value
+	}
+	var items []any
+	for _, item := range strings.Split(text[1:len(text)-1], ",") {
+		if item = strings.Trim(strings.TrimSpace(item), `"'`); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func paramString(params map[string]any, key string) string {
+	value, _ := params[key].(string)
+	return strings.TrimSpace(value)
+}
+
+func paramSeconds(value any) (time.Duration, bool) {
+	var seconds float64
+	switch v := value.(type) {
+	case float64:
+		seconds = v
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, false
+		}
+		seconds = parsed
+	default:
+		return 0, false
+	}
+	if seconds <= 0 {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,258 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/notify"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// alertEvalInterval is how often alert rules are evaluated.
+const alertEvalInterval = 10 * time.Second
+
+// AlertEnv holds the runtime metrics alert conditions are evaluated against.
+// Conditions that reference a provider_* metric are evaluated once per provider.
+type AlertEnv struct {
+	Provider           string  `expr:"provider"`
+	ProviderRequests   int     `expr:"provider_requests"`
+	ProviderFailures   int     `expr:"provider_failures"`
+	ProviderErrorRate  float64 `expr:"provider_error_rate"`
+	Requests           int     `expr:"requests"`
+	Failures           int     `expr:"failures"`
+	ErrorRate          float64 `expr:"error_rate"`
+	UnhealthyProviders int     `expr:"unhealthy_providers"`
+}
+
+type compiledAlert struct {
+	rule        config.AlertRule
+	program     *vm.Program
+	expression  string
+	hold        time.Duration
+	window      time.Duration
+	perProvider bool
+}
+
+type alertState struct {
+	pendingSince time.Time
+	firing       bool
+}
+
+// alertTransition is an alert that started or stopped firing for a series.
+type alertTransition struct {
+	alert  *compiledAlert
+	series string
+	firing bool
+	env    AlertEnv
+}
+
+// alertEngine evaluates alert rules over per-provider request statistics.
+type alertEngine struct {
+	rules []*compiledAlert
+	stats *errorRateWindow
+
+	mu     sync.Mutex
+	states map[string]*alertState
+	now    func() time.Time
+}
+
+func newAlertEngine(rules []config.AlertRule) (*alertEngine, error) {
+	e := &alertEngine{states: make(map[string]*alertState), now: time.Now}
+	var longest time.Duration
+	for _, rule := range rules {
+		expression, hold, err := rule.ParseCondition()
+		if err != nil {
+			return nil, fmt.Errorf("alert %s: %w", rule.Name, err)
+		}
+		program, err := expr.Compile(expression, expr.Env(AlertEnv{}), expr.AsBool())
+		if err != nil {
+			return nil, fmt.Errorf("compile alert %s: %w", rule.Name, err)
+		}
+		perProvider := ast.Find(program.Node(), func(node ast.Node) bool {
+			ident, ok := node.(*ast.IdentifierNode)
+			return ok && strings.HasPrefix(ident.Value, "provider")
+		}) != nil
+		window := time.Duration(rule.WindowSeconds) * time.Second
+		if window > longest {
+			longest = window
+		}
+		e.rules = append(e.rules, &compiledAlert{
+			rule:        rule,
+			program:     program,
+			expression:  expression,
+			hold:        hold,
+			window:      window,
+			perProvider: perProvider,
+		})
+	}
+	e.stats = newErrorRateWindow(longest)
+	e.stats.now = func() time.Time { return e.now() }
+	return e, nil
+}
+
+// evaluate runs every rule against the current statistics and returns the
+// alerts that started or stopped firing.
+func (e *alertEngine) evaluate(providers []string, unhealthy int) []alertTransition {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	var transitions []alertTransition
+	for _, alert := range e.rules {
+		base := AlertEnv{UnhealthyProviders: unhealthy}
+		perProvider := make(map[string][2]int, len(providers))
+		for _, id := range providers {
+			total, failures := e.stats.sum(id, alert.window)
+			perProvider[id] = [2]int{total, failures}
+			base.Requests += total
+			base.Failures += failures
+		}
+		base.ErrorRate = ratio(base.Failures, base.Requests)
+
+		series := []string{""}
+		if alert.perProvider {
+			series = providers
+		}
+		for _, id := range series {
+			env := base
+			if id != "" {
+				env.Provider = id
+				env.ProviderRequests = perProvider[id][0]
+				env.ProviderFailures = perProvider[id][1]
+				env.ProviderErrorRate = ratio(env.ProviderFailures, env.ProviderRequests)
+			}
+
+			out, err := vm.Run(alert.program, env)
+			if err != nil {
+				log.Warningf("eval alert %s: %v", alert.rule.Name, err)
+				continue
+			}
+			holds, _ := out.(bool)
+
+			key := alert.rule.Name + "/" + id
+			st, ok := e.states[key]
+			if !ok {
+				st = &alertState{}
+				e.states[key] = st
+			}
+			switch {
+			case holds && !st.firing:
+				if st.pendingSince.IsZero() {
+					st.pendingSince = now
+				}
+				if now.Sub(st.pendingSince) >= alert.hold {
+					st.firing = true
+					transitions = append(transitions, alertTransition{alert: alert, series: id, firing: true, env: env})
+				}
+			case !holds:
+				if st.firing {
+					transitions = append(transitions, alertTransition{alert: alert, series: id, firing: false, env: env})
+				}
+				st.firing = false
+				st.pendingSince = time.Time{}
+			}
+		}
+	}
+	return transitions
+}
+
+func ratio(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
+
+// RunAlerts evaluates the configured alert rules until ctx is done.
+func (g *Gateway) RunAlerts(ctx context.Context) {
+	if g.alerts == nil {
+		return
+	}
+	ticker := time.NewTicker(alertEvalInterval)
+	defer ticker.Stop()
+
+	providers := make([]string, 0, len(g.providers))
+	for id := range g.providers {
+		providers = append(providers, id)
+	}
+	sort.Strings(providers)
+
+	log.Infof("alert rules started: %d rules", len(g.alerts.rules))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, t := range g.alerts.evaluate(providers, g.health.unhealthyCount()) {
+				g.notifyAlert(t)
+			}
+		}
+	}
+}
+
+func (g *Gateway) notifyAlert(t alertTransition) {
+	rule := t.alert.rule
+	event := notify.Event{
+		Type:     notify.EventAlertFiring,
+		Severity: notify.Severity(rule.Severity),
+		Provider: t.series,
+		Message:  fmt.Sprintf("alert %s is firing: %s", rule.Name, rule.Condition),
+		Details: map[string]any{
+			"alert":          rule.Name,
+			"condition":      rule.Condition,
+			"requests":       t.env.Requests,
+			"failures":       t.env.Failures,
+			"error_rate":     fmt.Sprintf("%.2f", t.env.ErrorRate),
+			"window_seconds": rule.WindowSeconds,
+		},
+	}
+	if t.series != "" {
+		event.Details["provider_requests"] = t.env.ProviderRequests
+		event.Details["provider_failures"] = t.env.ProviderFailures
+		event.Details["provider_error_rate"] = fmt.Sprintf("%.2f", t.env.ProviderErrorRate)
+	}
+	if !t.firing {
+		event.Type = notify.EventAlertResolved
+		event.Severity = notify.SeverityInfo
+		event.Message = fmt.Sprintf("alert %s resolved: %s", rule.Name, rule.Condition)
+	}
+	event.Key = fmt.Sprintf("%s/%s/%s", event.Type, rule.Name, t.series)
+	log.Infof("%s", event.Message)
+	g.notifier.PublishTo(event, rule.Notifiers)
+}
+
+// recordAlert keeps a published event in the alert history. Usage reports are
+// summaries rather than alerts and are left out.
+func recordAlert(store storage.AlertStore, event notify.Event) {
+	if event.Type == notify.EventUsageReport {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := store.RecordAlert(ctx, storage.AlertRecord{
+		CreatedAt: event.Time,
+		EventID:   event.ID,
+		Type:      string(event.Type),
+		Severity:  string(event.Severity),
+		Message:   event.Message,
+		Provider:  event.Provider,
+		Model:     event.Model,
+		Tenant:    event.Tenant,
+		Key:       event.Key,
+		Details:   event.Details,
+	})
+	if err != nil {
+		log.Warningf("record alert %s: %v", event.Type, err)
+	}
+}
@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestAlertEngineFiresAfterHoldAndResolves(t *testing.T) {
+	engine, err := newAlertEngine([]config.AlertRule{
+		{Name: "provider-errors", Condition: "provider_error_rate > 0.2 && provider_requests >= 5 for 1m", WindowSeconds: 300},
+		{Name: "gateway-errors", Condition: "failures > 100", WindowSeconds: 300},
+	})
+	if err != nil {
+		t.Fatalf("create engine: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	engine.now = func() time.Time { return now }
+	providers := []string{"p1", "p2"}
+
+	for i := 0; i < 10; i++ {
+		engine.stats.add("p1", i%2 == 0)
+		engine.stats.add("p2", false)
+	}
+	if got := engine.evaluate(providers, 0); len(got) != 0 {
+		t.Fatalf("expected the alert to be pending, got %+v", got)
+	}
+
+	now = now.Add(time.Minute)
+	got := engine.evaluate(providers, 0)
+	if len(got) != 1 || !got[0].firing || got[0].series != "p1" || got[0].alert.rule.Name != "provider-errors" {
+		t.Fatalf("expected provider-errors to fire for p1, got %+v", got)
+	}
+	if got[0].env.ProviderErrorRate != 0.5 || got[0].env.Requests != 20 {
+		t.Fatalf("unexpected metrics %+v", got[0].env)
+	}
+	if got := engine.evaluate(providers, 0); len(got) != 0 {
+		t.Fatalf("expected a firing alert to be reported once, got %+v", got)
+	}
+
+	// Once the failures leave the window the alert resolves.
+	now = now.Add(10 * time.Minute)
+	got = engine.evaluate(providers, 0)
+	if len(got) != 1 || got[0].firing || got[0].series != "p1" {
+		t.Fatalf("expected provider-errors to resolve, got %+v", got)
+	}
+}
+
+func TestAlertEngineRejectsInvalidConditions(t *testing.T) {
+	for _, condition := range []string{"unknown_metric > 1", "provider_error_rate", "error_rate > 0.1 for soon"} {
+		if _, err := newAlertEngine([]config.AlertRule{{Name: "bad", Condition: condition}}); err == nil {
+			t.Errorf("expected %q to be rejected", condition)
+		}
+	}
+}
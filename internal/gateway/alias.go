@@ -0,0 +1,24 @@
+package gateway
+
+import (
+	"fmt"
+
+	"github.com/tidwall/sjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// applyAlias rewrites the request body for an alias: the model becomes the
+// alias target and the pinned params replace whatever the client sent.
+func applyAlias(body []byte, alias config.AliasConfig) ([]byte, error) {
+	body, err := sjson.SetBytes(body, "model", alias.Target)
+	if err != nil {
+		return nil, fmt.Errorf("set model: %w", err)
+	}
+	for name, value := range alias.Params {
+		if body, err = sjson.SetBytes(body, name, value); err != nil {
+			return nil, fmt.Errorf("set %s: %w", name, err)
+		}
+	}
+	return body, nil
+}
@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -54,7 +55,7 @@ func TestProxyAliasResolution(t *testing.T) {
 	}
 
 	// Test ModelList
-	listResp := gw.ModelList()
+	listResp := gw.ModelList(context.Background())
 	found := false
 	for _, m := range listResp.Data {
 		if m.ID == "alias-model" {
@@ -66,3 +67,35 @@ func TestProxyAliasResolution(t *testing.T) {
 		t.Errorf("alias-model not found in ModelList")
 	}
 }
+
+func TestApplyAliasPinsParams(t *testing.T) {
+	alias := config.AliasConfig{
+		Model:  "my-fast",
+		Target: "gpt-4o-mini",
+		Params: map[string]any{
+			"temperature":     0.2,
+			"max_tokens":      1024,
+			"response_format": map[string]any{"type": "json_object"},
+		},
+	}
+	body, err := applyAlias([]byte(`{"model":"my-fast","temperature":1,"messages":[]}`), alias)
+	if err != nil {
+		t.Fatalf("apply alias: %v", err)
+	}
+
+	if got := gjson.GetBytes(body, "model").String(); got != "gpt-4o-mini" {
+		t.Fatalf("expected target model, got %s", got)
+	}
+	if got := gjson.GetBytes(body, "temperature").Float(); got != 0.2 {
+		t.Fatalf("expected pinned temperature 0.2, got %v", got)
+	}
+	if got := gjson.GetBytes(body, "max_tokens").Int(); got != 1024 {
+		t.Fatalf("expected max_tokens 1024, got %d", got)
+	}
+	if got := gjson.GetBytes(body, "response_format.type").String(); got != "json_object" {
+		t.Fatalf("expected response_format to be set, got %s", body)
+	}
+	if !gjson.GetBytes(body, "messages").IsArray() {
+		t.Fatalf("expected other fields to be kept, got %s", body)
+	}
+}
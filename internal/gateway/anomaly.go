@@ -0,0 +1,214 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/notify"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// anomalyBucket is the granularity usage is aggregated at.
+const anomalyBucket = 10 * time.Minute
+
+// anomalyDetector aggregates spend and token usage per key and model so the
+// last hour can be compared with the average hour of the preceding baseline
+// window. Series of priced models are compared by spend, the others by tokens.
+type anomalyDetector struct {
+	mu       sync.Mutex
+	baseline time.Duration
+	series   map[anomalySeriesKey]*anomalySeries
+	now      func() time.Time
+}
+
+type anomalySeriesKey struct {
+	key   string
+	model string
+}
+
+type anomalySeries struct {
+	tenant string
+	first  time.Time
+	// priced is set once a request of the series had a price
+	priced  bool
+	buckets map[int64]*anomalyUsage
+}
+
+type anomalyUsage struct {
+	tokens int
+	cost   float64
+}
+
+// spendAnomaly describes a key and model whose last hour deviates from the
+// baseline. The cost figures are zero for models without a price.
+type spendAnomaly struct {
+	key          string
+	model        string
+	tenant       string
+	lastHour     int
+	baseline     float64
+	lastHourCost float64
+	baselineCost float64
+}
+
+func newAnomalyDetector(baseline time.Duration) *anomalyDetector {
+	return &anomalyDetector{baseline: baseline, series: make(map[anomalySeriesKey]*anomalySeries), now: time.Now}
+}
+
+// add records tokens used by a key for a model and what they cost.
+func (d *anomalyDetector) add(key, model, tenant string, tokens int, cost float64) {
+	if tokens <= 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	id := anomalySeriesKey{key: key, model: model}
+	s, ok := d.series[id]
+	if !ok {
+		s = &anomalySeries{first: now, buckets: make(map[int64]*anomalyUsage)}
+		d.series[id] = s
+	}
+	s.tenant = tenant
+	s.priced = s.priced || cost > 0
+	start := now.Truncate(anomalyBucket).Unix()
+	bucket, ok := s.buckets[start]
+	if !ok {
+		bucket = &anomalyUsage{}
+		s.buckets[start] = bucket
+	}
+	bucket.tokens += tokens
+	bucket.cost += cost
+}
+
+// detect returns the series whose last hour used at least minTokens and spent
+// more than factor times the average hour of the baseline, or used more than
+// factor times its tokens for models without a price. Series seen for less
+// than an hour have no baseline yet and are skipped. Expired buckets are dropped.
+func (d *anomalyDetector) detect(factor float64, minTokens int) []spendAnomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	hourAgo := now.Add(-time.Hour)
+	cutoff := hourAgo.Add(-d.baseline)
+
+	var anomalies []spendAnomaly
+	for id, s := range d.series {
+		var lastHour, history anomalyUsage
+		for start, usage := range s.buckets {
+			at := time.Unix(start, 0)
+			switch {
+			case !at.Add(anomalyBucket).After(cutoff):
+				delete(s.buckets, start)
+			case !at.Before(hourAgo):
+				lastHour.tokens += usage.tokens
+				lastHour.cost += usage.cost
+			default:
+				history.tokens += usage.tokens
+				history.cost += usage.cost
+			}
+		}
+		if len(s.buckets) == 0 {
+			delete(d.series, id)
+			continue
+		}
+
+		since := s.first
+		if since.Before(cutoff) {
+			since = cutoff
+		}
+		span := hourAgo.Sub(since)
+		if span < time.Hour || lastHour.tokens < minTokens {
+			continue
+		}
+		anomaly := spendAnomaly{
+			key:      id.key,
+			model:    id.model,
+			tenant:   s.tenant,
+			lastHour: lastHour.tokens,
+			baseline: float64(history.tokens) / span.Hours(),
+		}
+		if s.priced {
+			anomaly.lastHourCost = lastHour.cost
+			anomaly.baselineCost = history.cost / span.Hours()
+			if anomaly.lastHourCost <= factor*anomaly.baselineCost {
+				continue
+			}
+		} else if float64(anomaly.lastHour) <= factor*anomaly.baseline {
+			continue
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+	sort.Slice(anomalies, func(i, j int) bool {
+		if anomalies[i].key != anomalies[j].key {
+			return anomalies[i].key < anomalies[j].key
+		}
+		return anomalies[i].model < anomalies[j].model
+	})
+	return anomalies
+}
+
+// observeSpend feeds a finished request, priced by its provider model, into
+// the anomaly detector. It is registered as a metrics sink, so it sees every
+// request whether or not usage is saved.
+func (g *Gateway) observeSpend(record storage.UsageRecord) {
+	key := record.KeyID
+	if key == "" {
+		key = "anonymous"
+	}
+	var cost float64
+	if c := g.requestCost(record); c != nil {
+		cost = c.input + c.output
+	}
+	g.anomalies.add(key, exportedModel(record), record.Tenant, record.RequestTokens+record.ResponseTokens, cost)
+}
+
+// RunAnomalyDetection periodically compares each key's token usage of the last
+// hour with its baseline and raises spend_anomaly alerts until ctx is done.
+func (g *Gateway) RunAnomalyDetection(ctx context.Context) {
+	cfg := g.cfg.AnomalyDetection
+	if cfg == nil || g.anomalies == nil {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(cfg.CheckIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	log.Infof("spend anomaly detection started: factor=%.1f, baseline=%dh, interval=%ds", cfg.Factor, cfg.BaselineHours, cfg.CheckIntervalSeconds)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, a := range g.anomalies.detect(cfg.Factor, cfg.MinTokens) {
+				g.notifySpendAnomaly(a, cfg.Factor)
+			}
+		}
+	}
+}
+
+func (g *Gateway) notifySpendAnomaly(a spendAnomaly, factor float64) {
+	details := map[string]any{"key": a.key, "last_hour_tokens": a.lastHour, "baseline_tokens_per_hour": int(a.baseline), "factor": factor}
+	message := fmt.Sprintf("key %s used %d tokens of %s in the last hour, %.0f per hour is usual", a.key, a.lastHour, a.model, a.baseline)
+	if a.lastHourCost > 0 {
+		details["last_hour_cost"] = a.lastHourCost
+		details["baseline_cost_per_hour"] = a.baselineCost
+		message = fmt.Sprintf("key %s spent %.4f on %s in the last hour, %.4f per hour is usual", a.key, a.lastHourCost, a.model, a.baselineCost)
+	}
+	log.Warningf("spend anomaly: %s", message)
+	g.notifier.Publish(notify.Event{
+		Type:     notify.EventSpendAnomaly,
+		Severity: notify.SeverityWarning,
+		Model:    a.model,
+		Tenant:   a.tenant,
+		Message:  message,
+		Details:  details,
+		Key:      fmt.Sprintf("%s/%s/%s", notify.EventSpendAnomaly, a.key, a.model),
+	})
+}
@@ -0,0 +1,114 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func TestAnomalyDetectorComparesLastHourWithBaseline(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := newAnomalyDetector(24 * time.Hour)
+	d.now = func() time.Time { return now }
+
+	// Six hours of steady usage: 1000 tokens per hour for both keys.
+	for i := 0; i < 36; i++ {
+		d.add("key-a", "gpt-4o", "acme", 1000/6, 0)
+		d.add("key-b", "gpt-4o", "", 1000/6, 0)
+		now = now.Add(10 * time.Minute)
+	}
+	if got := d.detect(3, 100); len(got) != 0 {
+		t.Fatalf("expected no anomaly for steady usage, got %+v", got)
+	}
+
+	// key-a suddenly uses ten times as much, key-b stays steady.
+	for i := 0; i < 6; i++ {
+		d.add("key-a", "gpt-4o", "acme", 10000/6, 0)
+		d.add("key-b", "gpt-4o", "", 1000/6, 0)
+		now = now.Add(10 * time.Minute)
+	}
+	got := d.detect(3, 100)
+	if len(got) != 1 {
+		t.Fatalf("expected one anomaly, got %+v", got)
+	}
+	if got[0].key != "key-a" || got[0].model != "gpt-4o" || got[0].tenant != "acme" {
+		t.Fatalf("unexpected anomaly %+v", got[0])
+	}
+	if got[0].lastHour < 9000 || got[0].baseline > 1100 {
+		t.Fatalf("unexpected usage figures %+v", got[0])
+	}
+
+	// A higher minimum hides the anomaly.
+	if got := d.detect(3, 100000); len(got) != 0 {
+		t.Fatalf("expected min_tokens to suppress the anomaly, got %+v", got)
+	}
+}
+
+func TestAnomalyDetectorNeedsHistoryAndExpiresBuckets(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := newAnomalyDetector(2 * time.Hour)
+	d.now = func() time.Time { return now }
+
+	d.add("key-a", "gpt-4o", "", 50000, 0)
+	if got := d.detect(2, 1); len(got) != 0 {
+		t.Fatalf("expected new keys to be skipped without a baseline, got %+v", got)
+	}
+
+	now = now.Add(4 * time.Hour)
+	if got := d.detect(2, 1); len(got) != 0 {
+		t.Fatalf("expected no anomaly, got %+v", got)
+	}
+	if len(d.series) != 0 {
+		t.Fatalf("expected expired series to be dropped, got %d", len(d.series))
+	}
+}
+
+func TestAnomalyDetectorComparesSpendOfPricedModels(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := newAnomalyDetector(24 * time.Hour)
+	d.now = func() time.Time { return now }
+
+	// The same tokens each hour, but the last hour is mostly expensive output.
+	for i := 0; i < 36; i++ {
+		d.add("key-a", "gpt-4o", "", 1000/6, 0.01/6)
+		now = now.Add(10 * time.Minute)
+	}
+	for i := 0; i < 6; i++ {
+		d.add("key-a", "gpt-4o", "", 1000/6, 0.1/6)
+		now = now.Add(10 * time.Minute)
+	}
+	got := d.detect(3, 100)
+	if len(got) != 1 {
+		t.Fatalf("expected the spend spike to be detected, got %+v", got)
+	}
+	if got[0].lastHourCost < 0.09 || got[0].baselineCost > 0.011 {
+		t.Fatalf("unexpected spend figures %+v", got[0])
+	}
+}
+
+func TestAnomalyDetectionWithoutSavedUsage(t *testing.T) {
+	cfg := &config.Config{
+		AnomalyDetection: &config.AnomalyDetectionConfig{Factor: 3, BaselineHours: 24, CheckIntervalSeconds: 300},
+		Pricing:          &config.PricingConfig{Prices: []config.ProviderPrice{{Provider: "p1", Model: "gpt-4o", Input: 2, Output: 8}}},
+		Providers:        []config.ProviderConfig{{ID: "p1", BaseURL: "http://127.0.0.1:1", AccessToken: "t"}},
+		Models:           []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	gw.saveUsageRecord(context.Background(), storage.UsageRecord{Provider: "p1", Model: "gpt-4o", KeyID: "key-a", RequestTokens: 1000000, ResponseTokens: 1000000})
+
+	series, ok := gw.anomalies.series[anomalySeriesKey{key: "key-a", model: "gpt-4o"}]
+	if !ok {
+		t.Fatalf("expected the request to reach the detector")
+	}
+	for _, usage := range series.buckets {
+		if usage.cost != 10 {
+			t.Fatalf("expected the request to be priced at 10, got %v", usage.cost)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// providerHeaders are response headers that identify the provider, its
+// hosting or its account.
+var providerHeaders = map[string]bool{
+	"server":                        true,
+	"via":                           true,
+	"x-powered-by":                  true,
+	"x-request-id":                  true,
+	"request-id":                    true,
+	"apim-request-id":               true,
+	"azureml-model-session":         true,
+	"x-envoy-upstream-service-time": true,
+	"x-cloud-trace-context":         true,
+	"alt-svc":                       true,
+	"nel":                           true,
+	"report-to":                     true,
+}
+
+// providerHeaderPrefixes are prefixes of provider identifying headers.
+var providerHeaderPrefixes = []string{"cf-", "openai-", "anthropic-", "x-ms-", "x-amzn-", "x-envoy-", "x-groq-", "x-openrouter-"}
+
+// stripProviderHeaders removes the headers identifying the provider from a
+// response. Rate limit headers stay so client backoff keeps working; they can
+// be renamed with rate_limit_headers.rename_prefix.
+func stripProviderHeaders(header http.Header) {
+	for name := range header {
+		lower := strings.ToLower(name)
+		if isRateLimitHeader(lower) {
+			continue
+		}
+		if providerHeaders[lower] {
+			header.Del(name)
+			continue
+		}
+		for _, prefix := range providerHeaderPrefixes {
+			if strings.HasPrefix(lower, prefix) {
+				header.Del(name)
+				break
+			}
+		}
+	}
+}
+
+// chatCompletionFields and chatChoiceFields are the fields of the OpenAI chat
+// completion and chunk objects; anything else is vendor specific, such as
+// system_fingerprint, x_groq, provider or content_filter_results.
+var (
+	chatCompletionFields = map[string]bool{"id": true, "object": true, "created": true, "model": true, "choices": true, "usage": true, "error": true}
+	chatChoiceFields     = map[string]bool{"index": true, "message": true, "delta": true, "finish_reason": true, "logprobs": true}
+)
+
+// normalizeChatCompletion removes the vendor specific fields of a chat
+// completion or chunk.
+func normalizeChatCompletion(data []byte) []byte {
+	var remove []string
+	gjson.ParseBytes(data).ForEach(func(key, value gjson.Result) bool {
+		name := key.String()
+		switch {
+		case !chatCompletionFields[name]:
+			remove = append(remove, gjson.Escape(name))
+		case name == "choices" && value.IsArray():
+			for i, choice := range value.Array() {
+				choice.ForEach(func(field, _ gjson.Result) bool {
+					if !chatChoiceFields[field.String()] {
+						remove = append(remove, "choices."+strconv.Itoa(i)+"."+gjson.Escape(field.String()))
+					}
+					return true
+				})
+			}
+		}
+		return true
+	})
+	for _, path := range remove {
+		if out, err := sjson.DeleteBytes(data, path); err == nil {
+			data = out
+		}
+	}
+	return data
+}
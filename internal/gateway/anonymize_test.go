@@ -0,0 +1,105 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestStripProviderHeaders(t *testing.T) {
+	header := http.Header{}
+	for _, name := range []string{"Server", "Via", "Cf-Ray", "Openai-Organization", "Openai-Processing-Ms", "X-Request-Id", "X-Ms-Region", "Content-Type", "X-Ratelimit-Remaining-Requests", "Anthropic-Ratelimit-Requests-Remaining", "Retry-After"} {
+		header.Set(name, "v")
+	}
+	stripProviderHeaders(header)
+
+	want := []string{"Anthropic-Ratelimit-Requests-Remaining", "Content-Type", "Retry-After", "X-Ratelimit-Remaining-Requests"}
+	if len(header) != len(want) {
+		t.Fatalf("unexpected headers %v", header)
+	}
+	for _, name := range want {
+		if header.Get(name) == "" {
+			t.Fatalf("header %s must be kept: %v", name, header)
+		}
+	}
+}
+
+func TestNormalizeChatCompletion(t *testing.T) {
+	data := normalizeChatCompletion([]byte(`{"id":"c1","object":"chat.completion","created":1,"model":"m","system_fingerprint":"fp_1","x_groq":{"id":"g"},"choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop","content_filter_results":{},"native_finish_reason":"stop"}],"usage":{"total_tokens":3}}`))
+	want := `{"id":"c1","object":"chat.completion","created":1,"model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"total_tokens":3}}`
+	if string(data) != want {
+		t.Fatalf("unexpected normalized completion %s", data)
+	}
+}
+
+func TestProxyAnonymizesProvider(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Openai-Organization", "org-secret")
+		w.Header().Set("Cf-Ray", "1234-SJC")
+		w.Header().Set("X-Request-Id", "provider-req")
+		_, _ = w.Write([]byte(`{"id":"gen-1","object":"chat.completion","model":"vendor/model","provider":"VendorCloud","system_fingerprint":"fp","choices":[]}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		AnonymizeProviders: true,
+		Providers:          []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:             []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1", Model: "vendor/model"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o"}`)))
+	req.Header.Set("X-Request-ID", "req-1")
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+
+	if body := rec.Body.String(); body != `{"id":"chatcmpl-req1","object":"chat.completion","model":"gpt-4o","choices":[]}` {
+		t.Fatalf("unexpected response %s", body)
+	}
+	for name, values := range rec.Header() {
+		if joined := strings.Join(values, ","); strings.Contains(joined, "secret") || strings.Contains(joined, "SJC") || strings.Contains(joined, "provider-req") {
+			t.Fatalf("provider header %s leaked: %v", name, rec.Header())
+		}
+	}
+	if got := rec.Header().Get("X-Request-ID"); got != "req-1" {
+		t.Fatalf("expected the gateway request id, got %q", got)
+	}
+}
+
+func TestProxyPropagatesRequestID(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-Request-ID"); got != "req-1" {
+			t.Errorf("unexpected upstream request id %q", got)
+		}
+		w.Header().Set("X-Request-Id", "provider-req")
+		http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:    []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	for _, body := range []string{`{"model":"gpt-4o"}`, `{"model":"gpt-4o","stream":true}`, `{}`} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("X-Request-ID", "req-1")
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+		if got := rec.Header().Get("X-Request-ID"); got != "req-1" {
+			t.Fatalf("%s: unexpected response request id %q (status %d)", body, got, rec.Code)
+		}
+	}
+}
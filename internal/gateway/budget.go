@@ -0,0 +1,259 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// budgetScope identifies a group of usage records that shares one budget.
+type budgetScope struct {
+	name   string
+	filter storage.UsageSumQuery
+	limits config.BudgetConfig
+}
+
+func tenantBudgetScope(t config.TenantConfig) budgetScope {
+	scope := budgetScope{name: "tenant " + t.ID, filter: storage.UsageSumQuery{Tenant: t.ID}}
+	if t.Budget != nil {
+		scope.limits = *t.Budget
+	}
+	return scope
+}
+
+// keyBudgetScope is the budget of an API key, identified by its digest.
+func keyBudgetScope(keyID string, limits config.BudgetConfig) budgetScope {
+	return budgetScope{name: "key " + keyID, filter: storage.UsageSumQuery{KeyID: keyID}, limits: limits}
+}
+
+func (s budgetScope) matches(rec storage.UsageRecord) bool {
+	if s.filter.KeyID != "" && s.filter.KeyID != rec.KeyID {
+		return false
+	}
+	return s.filter.Tenant == "" || s.filter.Tenant == rec.Tenant
+}
+
+func (s budgetScope) hasCostLimits() bool {
+	return s.limits.DailyCost > 0 || s.limits.MonthlyCost > 0
+}
+
+// budgetTracker keeps the token consumption and cost of every budget scope for
+// the current day and month in memory. Totals are seeded from the store on
+// first use and after each period rollover, then advanced as usage records are
+// saved.
+type budgetTracker struct {
+	mu     sync.Mutex
+	store  storage.Store
+	scopes map[string]*budgetUsage
+	now    func() time.Time
+	// cost prices the tokens of a provider model; nil prices nothing
+	cost func(provider, model string, requestTokens, responseTokens int64) float64
+}
+
+type budgetUsage struct {
+	day           time.Time
+	month         time.Time
+	dailyTokens   int64
+	monthlyTokens int64
+	dailyCost     float64
+	monthlyCost   float64
+}
+
+func newBudgetTracker(store storage.Store) *budgetTracker {
+	return &budgetTracker{store: store, scopes: make(map[string]*budgetUsage), now: time.Now}
+}
+
+// check returns an error when the scope has used up its daily or monthly budget.
+func (b *budgetTracker) check(ctx context.Context, scope budgetScope) error {
+	if scope.limits.DailyTokens <= 0 && scope.limits.MonthlyTokens <= 0 && !scope.hasCostLimits() {
+		return nil
+	}
+	usage, err := b.usage(ctx, scope)
+	if err != nil {
+		// Accounting problems should not take the gateway down.
+		log.Warningf("load budget usage for %s: %v", scope.name, err)
+		return nil
+	}
+	if scope.limits.DailyTokens > 0 && usage.dailyTokens >= scope.limits.DailyTokens {
+		return fmt.Errorf("%s daily token budget exceeded (%d/%d)", scope.name, usage.dailyTokens, scope.limits.DailyTokens)
+	}
+	if scope.limits.MonthlyTokens > 0 && usage.monthlyTokens >= scope.limits.MonthlyTokens {
+		return fmt.Errorf("%s monthly token budget exceeded (%d/%d)", scope.name, usage.monthlyTokens, scope.limits.MonthlyTokens)
+	}
+	if scope.limits.DailyCost > 0 && usage.dailyCost >= scope.limits.DailyCost {
+		return fmt.Errorf("%s daily cost budget exceeded ($%.4f/$%.2f)", scope.name, usage.dailyCost, scope.limits.DailyCost)
+	}
+	if scope.limits.MonthlyCost > 0 && usage.monthlyCost >= scope.limits.MonthlyCost {
+		return fmt.Errorf("%s monthly cost budget exceeded ($%.4f/$%.2f)", scope.name, usage.monthlyCost, scope.limits.MonthlyCost)
+	}
+	return nil
+}
+
+func (b *budgetTracker) usage(ctx context.Context, scope budgetScope) (budgetUsage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	day, month := periodStarts(b.now())
+	if cached, ok := b.scopes[scope.name]; ok && cached.day.Equal(day) && cached.month.Equal(month) {
+		return *cached, nil
+	}
+
+	usage := &budgetUsage{day: day, month: month}
+	if b.store != nil {
+		monthly := scope.filter
+		monthly.Since = month
+		totals, err := b.store.SumUsage(ctx, monthly)
+		if err != nil {
+			return budgetUsage{}, err
+		}
+		usage.monthlyTokens = totals.RequestTokens + totals.ResponseTokens
+
+		daily := scope.filter
+		daily.Since = day
+		totals, err = b.store.SumUsage(ctx, daily)
+		if err != nil {
+			return budgetUsage{}, err
+		}
+		usage.dailyTokens = totals.RequestTokens + totals.ResponseTokens
+
+		if scope.hasCostLimits() {
+			if usage.monthlyCost, err = b.sumCost(ctx, monthly); err != nil {
+				return budgetUsage{}, err
+			}
+			if usage.dailyCost, err = b.sumCost(ctx, daily); err != nil {
+				return budgetUsage{}, err
+			}
+		}
+	}
+	b.scopes[scope.name] = usage
+	return *usage, nil
+}
+
+// sumCost prices the usage matching query per provider model. Stores that do
+// not aggregate per provider model report no cost.
+func (b *budgetTracker) sumCost(ctx context.Context, query storage.UsageSumQuery) (float64, error) {
+	summer, ok := b.store.(storage.ProviderModelSummer)
+	if !ok || b.cost == nil {
+		return 0, nil
+	}
+	totals, err := summer.SumUsageByProviderModel(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	var cost float64
+	for _, t := range totals {
+		cost += b.cost(t.Provider, t.Model, t.RequestTokens, t.ResponseTokens)
+	}
+	return cost, nil
+}
+
+// budgetThresholds are the fractions of a budget that trigger a notification when crossed.
+var budgetThresholds = []int{80, 100}
+
+// budgetCrossing reports that a scope's usage crossed one of the budgetThresholds.
+type budgetCrossing struct {
+	scope  budgetScope
+	period string
+	// unit is "token" or "cost"
+	unit    string
+	percent int
+	used    float64
+	limit   float64
+}
+
+// format renders an amount of the crossing's unit.
+func (c budgetCrossing) format(amount float64) string {
+	if c.unit == "cost" {
+		return fmt.Sprintf("$%.2f", amount)
+	}
+	return fmt.Sprintf("%d", int64(amount))
+}
+
+// record advances every already loaded scope that the record belongs to and
+// returns the thresholds the record pushed the scopes over.
+func (b *budgetTracker) record(rec storage.UsageRecord, scopes []budgetScope) []budgetCrossing {
+	if !rec.Billable() {
+		return nil
+	}
+	tokens := int64(rec.RequestTokens + rec.ResponseTokens)
+	if tokens == 0 {
+		return nil
+	}
+	var cost float64
+	if b.cost != nil {
+		cost = b.cost(rec.Provider, rec.Model, int64(rec.RequestTokens), int64(rec.ResponseTokens))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var crossings []budgetCrossing
+	day, month := periodStarts(b.now())
+	for _, scope := range scopes {
+		if !scope.matches(rec) {
+			continue
+		}
+		usage, ok := b.scopes[scope.name]
+		if !ok || !usage.day.Equal(day) || !usage.month.Equal(month) {
+			continue
+		}
+		crossings = appendCrossings(crossings, scope, "daily", "token", float64(usage.dailyTokens), float64(usage.dailyTokens+tokens), float64(scope.limits.DailyTokens))
+		crossings = appendCrossings(crossings, scope, "monthly", "token", float64(usage.monthlyTokens), float64(usage.monthlyTokens+tokens), float64(scope.limits.MonthlyTokens))
+		crossings = appendCrossings(crossings, scope, "daily", "cost", usage.dailyCost, usage.dailyCost+cost, scope.limits.DailyCost)
+		crossings = appendCrossings(crossings, scope, "monthly", "cost", usage.monthlyCost, usage.monthlyCost+cost, scope.limits.MonthlyCost)
+		usage.dailyTokens += tokens
+		usage.monthlyTokens += tokens
+		usage.dailyCost += cost
+		usage.monthlyCost += cost
+	}
+	return crossings
+}
+
+func appendCrossings(crossings []budgetCrossing, scope budgetScope, period, unit string, before, after, limit float64) []budgetCrossing {
+	if limit <= 0 {
+		return crossings
+	}
+	for _, percent := range budgetThresholds {
+		mark := limit * float64(percent) / 100
+		if before < mark && after >= mark {
+			crossings = append(crossings, budgetCrossing{scope: scope, period: period, unit: unit, percent: percent, used: after, limit: limit})
+		}
+	}
+	return crossings
+}
+
+func periodStarts(now time.Time) (time.Time, time.Time) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return day, month
+}
+
+// budgetScopesFor returns the budgets that apply to a request of the given
+// tenant made with the API key of the given digest.
+func (g *Gateway) budgetScopesFor(tenant *tenantRoute, keyID string) []budgetScope {
+	var scopes []budgetScope
+	if tenant != nil && tenant.config.Budget != nil {
+		scopes = append(scopes, tenantBudgetScope(tenant.config))
+	}
+	if limits, ok := g.keyBudgets[keyID]; ok && keyID != "" {
+		scopes = append(scopes, keyBudgetScope(keyID, limits))
+	}
+	return scopes
+}
+
+func (g *Gateway) checkBudgets(ctx context.Context, tenant *tenantRoute) error {
+	identity, _ := internalmw.IdentityFromContext(ctx)
+	for _, scope := range g.budgetScopesFor(tenant, keyIDOf(identity)) {
+		if err := g.budgets.check(ctx, scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func TestProxyRejectsTenantOverBudget(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	store, err := storage.New(context.Background(), "sqlite", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "usage.db")))
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close(context.Background()) })
+
+	if err := store.RecordUsage(context.Background(), storage.UsageRecord{Tenant: "team-a", Outcome: "success", RequestTokens: 80, ResponseTokens: 40}); err != nil {
+		t.Fatalf("seed usage: %v", err)
+	}
+
+	cfg := &config.Config{
+		SaveUsage: true,
+		Providers: []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "token"}},
+		Models:    []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+		Tenants: []config.TenantConfig{
+			{ID: "team-a", APIKeys: []string{"sk-a"}, Budget: &config.BudgetConfig{DailyTokens: 100}},
+			{ID: "team-b", APIKeys: []string{"sk-b"}, Budget: &config.BudgetConfig{DailyTokens: 100}},
+		},
+	}
+	gw, err := New(cfg, store)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	send := func(tenant string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o"}`)))
+		req = req.WithContext(internalmw.WithIdentity(req.Context(), internalmw.Identity{Tenant: tenant}))
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+		return rec.Code
+	}
+
+	if code := send("team-a"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected team-a to be rejected with 429, got %d", code)
+	}
+	if code := send("team-b"); code != http.StatusOK {
+		t.Fatalf("expected team-b to be unaffected, got %d", code)
+	}
+}
+
+func TestBudgetTrackerReportsThresholdCrossings(t *testing.T) {
+	tracker := newBudgetTracker(nil)
+	scope := tenantBudgetScope(config.TenantConfig{ID: "team-a", Budget: &config.BudgetConfig{DailyTokens: 100, MonthlyTokens: 1000}})
+	if _, err := tracker.usage(context.Background(), scope); err != nil {
+		t.Fatalf("load usage: %v", err)
+	}
+
+	rec := storage.UsageRecord{Tenant: "team-a", Outcome: "success", RequestTokens: 50}
+	if crossings := tracker.record(rec, []budgetScope{scope}); len(crossings) != 0 {
+		t.Fatalf("expected no crossing at 50%%, got %+v", crossings)
+	}
+	rec.RequestTokens = 40
+	crossings := tracker.record(rec, []budgetScope{scope})
+	if len(crossings) != 1 || crossings[0].percent != 80 || crossings[0].period != "daily" || crossings[0].used != 90 {
+		t.Fatalf("expected daily 80%% crossing, got %+v", crossings)
+	}
+	rec.RequestTokens = 20
+	crossings = tracker.record(rec, []budgetScope{scope})
+	if len(crossings) != 1 || crossings[0].percent != 100 {
+		t.Fatalf("expected daily 100%% crossing, got %+v", crossings)
+	}
+}
+
+func TestProxyRejectsKeyOverCostBudget(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	store, err := storage.New(context.Background(), "sqlite", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "usage.db")))
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close(context.Background()) })
+
+	seed := storage.UsageRecord{KeyID: keyDigest("sk-a"), Provider: "p1", Model: "gpt-4o", Outcome: "success", RequestTokens: 400_000, ResponseTokens: 100_000}
+	if err := store.RecordUsage(context.Background(), seed); err != nil {
+		t.Fatalf("seed usage: %v", err)
+	}
+
+	cfg := &config.Config{
+		SaveUsage: true,
+		Providers: []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "token"}},
+		Models:    []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+		Pricing:   &config.PricingConfig{Prices: []config.ProviderPrice{{Provider: "p1", Model: "gpt-4o", Input: 2.5, Output: 10}}},
+		Keys: []config.KeyConfig{
+			{Key: "sk-a", Budget: &config.BudgetConfig{DailyCost: 2}},
+			{Key: "sk-b", Budget: &config.BudgetConfig{DailyCost: 2, MonthlyTokens: 1_000_000}},
+		},
+	}
+	gw, err := New(cfg, store)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	send := func(key string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o"}`)))
+		req = req.WithContext(internalmw.WithIdentity(req.Context(), internalmw.Identity{Key: key}))
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+		return rec.Code
+	}
+
+	// 400k input tokens at $2.5/M and 100k output tokens at $10/M cost $2.
+	if code := send("sk-a"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected sk-a to be rejected with 429, got %d", code)
+	}
+	if code := send("sk-b"); code != http.StatusOK {
+		t.Fatalf("expected sk-b to be unaffected, got %d", code)
+	}
+}
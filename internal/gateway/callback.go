@@ -0,0 +1,265 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/notify"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// callbackHeader names the callback URL of a single request.
+const callbackHeader = "X-Callback-Url"
+
+// callbackEvent is the X-Gateway-Event header of completion callbacks.
+const callbackEvent = "request.completed"
+
+// callbackSender POSTs a summary of each finished request to its callback URL.
+type callbackSender struct {
+	secret       string
+	allowHeader  bool
+	allowedHosts map[string]bool
+	keyURLs      map[string]string
+	client       *http.Client
+	maxAttempts  int
+	backoff      time.Duration
+}
+
+func newCallbackSender(cfg *config.Config) *callbackSender {
+	if cfg.Callbacks == nil {
+		return nil
+	}
+	s := &callbackSender{
+		secret:       cfg.Callbacks.Secret,
+		allowHeader:  cfg.Callbacks.AllowHeader,
+		allowedHosts: make(map[string]bool),
+		keyURLs:      make(map[string]string),
+		client:       &http.Client{Timeout: time.Duration(cfg.Callbacks.TimeoutSeconds) * time.Second},
+		maxAttempts:  cfg.Callbacks.MaxAttempts,
+		backoff:      time.Second,
+	}
+	for _, host := range cfg.Callbacks.AllowedHosts {
+		s.allowedHosts[strings.ToLower(host)] = true
+	}
+	for _, key := range cfg.Keys {
+		if key.CallbackURL != "" {
+			s.keyURLs[key.Key] = key.CallbackURL
+		}
+	}
+	return s
+}
+
+// callbackURL returns the URL of the x-callback-url header of a request, or
+// else the callback_url of its key. Header URLs the gateway does not accept are
+// errors, so clients do not wait for callbacks that never come.
+func (s *callbackSender) callbackURL(r *http.Request) (string, error) {
+	header := strings.TrimSpace(r.Header.Get(callbackHeader))
+	if header != "" {
+		if s == nil || !s.allowHeader {
+			return "", fmt.Errorf("x-callback-url is not enabled on this gateway")
+		}
+		u, err := url.Parse(header)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", fmt.Errorf("invalid x-callback-url %s", header)
+		}
+		if !s.allowedHosts[strings.ToLower(u.Hostname())] {
+			return "", fmt.Errorf("x-callback-url host %s is not allowed", u.Hostname())
+		}
+		return header, nil
+	}
+	if s == nil {
+		return "", nil
+	}
+	identity, _ := internalmw.IdentityFromContext(r.Context())
+	return s.keyURLs[identity.Key], nil
+}
+
+// completionSummary is the body of a completion callback. Tokens and cost add
+// up the billable provider attempts of the request.
+type completionSummary struct {
+	RequestID string `json:"request_id"`
+	// Status is the outcome of the last attempt: success, failure, blocked,
+	// client_cancelled or slow_client
+	Status           string `json:"status"`
+	StatusCode       int    `json:"status_code"`
+	Model            string `json:"model"`
+	Provider         string `json:"provider,omitempty"`
+	ProviderModel    string `json:"provider_model,omitempty"`
+	Tenant           string `json:"tenant,omitempty"`
+	Attempts         int    `json:"attempts"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	// CostUSD is left out when a billable attempt has no price
+	CostUSD      *float64  `json:"cost_usd,omitempty"`
+	LatencyMS    int64     `json:"latency_ms"`
+	FirstTokenMS int64     `json:"first_token_ms,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	FinishedAt   time.Time `json:"finished_at"`
+}
+
+// requestCompletion collects the usage records of a request with a callback.
+type requestCompletion struct {
+	url     string
+	started time.Time
+
+	mu       sync.Mutex
+	summary  completionSummary
+	last     *storage.UsageRecord
+	cost     float64
+	unpriced bool
+}
+
+func newRequestCompletion(ctx context.Context, callbackURL, requestID, model string) *requestCompletion {
+	identity, _ := internalmw.IdentityFromContext(ctx)
+	return &requestCompletion{
+		url:     callbackURL,
+		started: time.Now(),
+		summary: completionSummary{RequestID: requestID, Model: model, Tenant: identity.Tenant},
+	}
+}
+
+func (c *requestCompletion) observe(record storage.UsageRecord, cost *requestCost) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = &record
+	c.summary.Attempts = max(c.summary.Attempts, record.Attempt)
+	if !record.Billable() {
+		return
+	}
+	c.summary.PromptTokens += record.RequestTokens
+	c.summary.CompletionTokens += record.ResponseTokens
+	if cost == nil {
+		c.unpriced = true
+		return
+	}
+	c.cost += cost.input + cost.output
+}
+
+// finish returns the summary of the request answered with status.
+func (c *requestCompletion) finish(status int) completionSummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	summary := c.summary
+	summary.StatusCode = status
+	summary.FinishedAt = time.Now()
+	summary.LatencyMS = summary.FinishedAt.Sub(c.started).Milliseconds()
+	if !c.unpriced {
+		cost := c.cost
+		summary.CostUSD = &cost
+	}
+	if c.last == nil {
+		summary.Status = "success"
+		if status >= http.StatusBadRequest {
+			summary.Status = "failure"
+		}
+		return summary
+	}
+	summary.Status = c.last.Outcome
+	summary.Provider = c.last.Provider
+	summary.ProviderModel = c.last.Model
+	summary.FirstTokenMS = c.last.FirstTokenLatency.Milliseconds()
+	summary.Error = c.last.Error
+	return summary
+}
+
+type requestCompletionKey struct{}
+
+func withRequestCompletion(ctx context.Context, completion *requestCompletion) context.Context {
+	return context.WithValue(ctx, requestCompletionKey{}, completion)
+}
+
+func requestCompletionFrom(ctx context.Context) *requestCompletion {
+	if ctx == nil {
+		return nil
+	}
+	completion, _ := ctx.Value(requestCompletionKey{}).(*requestCompletion)
+	return completion
+}
+
+// deliver POSTs the summary, retrying failed deliveries with a growing delay.
+func (s *callbackSender) deliver(callbackURL string, summary completionSummary) {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		log.Warningf("encode completion callback of request %s: %v", summary.RequestID, err)
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		err := s.post(callbackURL, summary.FinishedAt, body)
+		if err == nil {
+			return
+		}
+		if attempt >= s.maxAttempts {
+			log.Warningf("completion callback of request %s: %v", summary.RequestID, err)
+			return
+		}
+		time.Sleep(time.Duration(attempt) * s.backoff)
+	}
+}
+
+func (s *callbackSender) post(callbackURL string, finishedAt time.Time, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gateway-Event", callbackEvent)
+	if s.secret != "" {
+		timestamp := strconv.FormatInt(finishedAt.Unix(), 10)
+		req.Header.Set("X-Gateway-Timestamp", timestamp)
+		req.Header.Set("X-Gateway-Signature", "sha256="+notify.Sign(s.secret, timestamp, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// statusRecorder remembers the status code sent to the client.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
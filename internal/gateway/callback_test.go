@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/notify"
+)
+
+func TestProxySendsSignedCompletionCallback(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"id":"chatcmpl-1","usage":{"prompt_tokens":1000,"completion_tokens":500}}`)
+	}))
+	t.Cleanup(provider.Close)
+
+	calls := 0
+	received := make(chan completionSummary, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get("X-Gateway-Signature"), "sha256="+notify.Sign("s3cret", r.Header.Get("X-Gateway-Timestamp"), body); got != want {
+			t.Errorf("unexpected signature %q, want %q", got, want)
+		}
+		var summary completionSummary
+		if err := json.Unmarshal(body, &summary); err != nil {
+			t.Errorf("decode callback: %v", err)
+		}
+		received <- summary
+	}))
+	t.Cleanup(callback.Close)
+
+	cfg := &config.Config{
+		Keys:      []config.KeyConfig{{Key: "sk-billing", Roles: []string{config.RoleProxy}, CallbackURL: callback.URL}},
+		Providers: []config.ProviderConfig{{ID: "openai", BaseURL: provider.URL, AccessToken: "token"}},
+		Models:    []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "openai"}}}},
+		Pricing:   &config.PricingConfig{Prices: []config.ProviderPrice{{Model: "gpt-4o", Input: 2, Output: 10}}},
+		Callbacks: &config.CallbacksConfig{Secret: "s3cret", TimeoutSeconds: 5, MaxAttempts: 2},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	gw.callbacks.backoff = 0
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hello there"}]}`)))
+	req.Header.Set("X-Request-ID", "req-1")
+	req = req.WithContext(internalmw.WithIdentity(req.Context(), internalmw.Identity{Key: "sk-billing"}))
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	select {
+	case summary := <-received:
+		if summary.RequestID != "req-1" || summary.Status != "success" || summary.StatusCode != http.StatusOK ||
+			summary.Provider != "openai" || summary.Attempts != 1 || summary.CompletionTokens != 500 {
+			t.Fatalf("unexpected summary %+v", summary)
+		}
+		if want := float64(summary.PromptTokens)*2/1e6 + 500*10/1e6; summary.CostUSD == nil || math.Abs(*summary.CostUSD-want) > 1e-12 {
+			t.Fatalf("unexpected cost %v", summary.CostUSD)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not delivered")
+	}
+}
+
+func TestCallbackHeaderRules(t *testing.T) {
+	cfg := &config.Config{Callbacks: &config.CallbacksConfig{AllowHeader: true, AllowedHosts: []string{"hooks.example.com"}}}
+	sender := newCallbackSender(cfg)
+	for value, ok := range map[string]bool{
+		"https://hooks.example.com/done": true,
+		"https://evil.example.com/done":  false,
+		"ftp://hooks.example.com/done":   false,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		req.Header.Set(callbackHeader, value)
+		got, err := sender.callbackURL(req)
+		if ok != (err == nil) || (ok && got != value) {
+			t.Fatalf("%s: unexpected result %q %v", value, got, err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set(callbackHeader, "https://hooks.example.com/done")
+	if _, err := newCallbackSender(&config.Config{Callbacks: &config.CallbacksConfig{}}).callbackURL(req); err == nil {
+		t.Fatal("expected the header to be rejected without allow_header")
+	}
+	if _, err := (*callbackSender)(nil).callbackURL(req); err == nil {
+		t.Fatal("expected the header to be rejected without callbacks")
+	}
+}
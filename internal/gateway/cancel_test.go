@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// notifyingRecorder signals the first body write.
+type notifyingRecorder struct {
+	*httptest.ResponseRecorder
+	once    sync.Once
+	written chan struct{}
+}
+
+func (w *notifyingRecorder) Write(p []byte) (int, error) {
+	n, err := w.ResponseRecorder.Write(p)
+	w.once.Do(func() { close(w.written) })
+	return n, err
+}
+
+// waitForStoredUsage waits until the usage record of requestID was written,
+// so the store is not closed while the record is saved in the background.
+func waitForStoredUsage(t *testing.T, store storage.Store, requestID string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if records, err := store.QueryUsage(context.Background(), storage.UsageQuery{RequestID: requestID}); err == nil && len(records) > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("usage record %s was not stored", requestID)
+}
+
+func TestProxyRecordsClientCancelledStream(t *testing.T) {
+	upstreamCancelled := make(chan struct{})
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"delta\":{\"content\":\"hi\"}}],\"usage\":{\"completion_tokens\":7}}\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(upstreamCancelled)
+	}))
+	t.Cleanup(provider.Close)
+
+	store, err := storage.New(context.Background(), "sqlite", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "usage.db")))
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close(context.Background()) })
+
+	cfg := &config.Config{
+		SaveUsage: true,
+		Providers: []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:    []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, store)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	records, unsubscribe := gw.SubscribeUsage()
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o","stream":true}`))).WithContext(ctx)
+	rec := &notifyingRecorder{ResponseRecorder: httptest.NewRecorder(), written: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+	}()
+
+	select {
+	case <-rec.written:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no data was streamed to the client")
+	}
+	cancel()
+
+	select {
+	case <-upstreamCancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("upstream request was not cancelled")
+	}
+	<-done
+
+	select {
+	case record := <-records:
+		if record.Outcome != storage.OutcomeClientCancelled || record.ResponseTokens != 7 || record.ProviderRequestID != "chatcmpl-1" {
+			t.Fatalf("unexpected usage record %+v", record)
+		}
+		waitForStoredUsage(t, store, record.RequestID)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no usage record was published")
+	}
+}
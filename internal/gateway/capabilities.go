@@ -0,0 +1,109 @@
+package gateway
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/mylxsw/asteria/log"
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// requestNeeds are the capabilities a request requires from a model.
+type requestNeeds struct {
+	vision   bool
+	tools    bool
+	jsonMode bool
+	// promptTokens and outputTokens together must fit the context window
+	promptTokens int
+	outputTokens int
+}
+
+func detectNeeds(body []byte, tokenCount int) requestNeeds {
+	needs := requestNeeds{promptTokens: tokenCount}
+	for _, path := range []string{"messages", "input"} {
+		gjson.GetBytes(body, path).ForEach(func(_, message gjson.Result) bool {
+			message.Get("content").ForEach(func(_, part gjson.Result) bool {
+				switch part.Get("type").String() {
+				case "image_url", "image", "input_image":
+					needs.vision = true
+				}
+				return !needs.vision
+			})
+			return !needs.vision
+		})
+	}
+	needs.tools = len(gjson.GetBytes(body, "tools").Array()) > 0 || len(gjson.GetBytes(body, "functions").Array()) > 0
+	for _, path := range []string{"response_format.type", "text.format.type"} {
+		switch gjson.GetBytes(body, path).String() {
+		case "json_object", "json_schema":
+			needs.jsonMode = true
+		}
+	}
+	for _, path := range []string{"max_tokens", "max_completion_tokens", "max_output_tokens"} {
+		if v := gjson.GetBytes(body, path); v.Exists() {
+			needs.outputTokens = int(v.Int())
+			break
+		}
+	}
+	return needs
+}
+
+// unsupported returns the needs the capabilities cannot serve.
+func (n requestNeeds) unsupported(caps config.Capabilities) []string {
+	var missing []string
+	if n.vision && caps.Vision != nil && !*caps.Vision {
+		missing = append(missing, "vision")
+	}
+	if n.tools && caps.Tools != nil && !*caps.Tools {
+		missing = append(missing, "tools")
+	}
+	if n.jsonMode && caps.JSONMode != nil && !*caps.JSONMode {
+		missing = append(missing, "json_mode")
+	}
+	if caps.MaxContext > 0 && n.promptTokens+n.outputTokens > caps.MaxContext {
+		missing = append(missing, "max_context")
+	}
+	return missing
+}
+
+// capabilities returns what the provider serves for a configured model.
+func (r *modelRoute) capabilities(providerID string) config.Capabilities {
+	var caps config.Capabilities
+	if r == nil {
+		return caps
+	}
+	caps = caps.Merge(r.config.Capabilities)
+	for _, p := range r.config.Providers {
+		if p.ID == providerID {
+			return caps.Merge(p.Capabilities)
+		}
+	}
+	return caps
+}
+
+// filterCapable drops the candidates of a model that cannot serve the request,
+// returning the kept candidates and the capabilities that ruled out the others.
+func (g *Gateway) filterCapable(model string, candidates []ruleProvider, needs requestNeeds) ([]ruleProvider, []string) {
+	route := g.models[model]
+	if route == nil {
+		return candidates, nil
+	}
+	var kept []ruleProvider
+	var reasons []string
+	for _, c := range candidates {
+		missing := needs.unsupported(route.capabilities(c.id))
+		if len(missing) == 0 {
+			kept = append(kept, c)
+			continue
+		}
+		log.Debugf("[%s] skip provider %s(%s): no %s support", model, c.id, c.model, strings.Join(missing, ", "))
+		for _, m := range missing {
+			if !slices.Contains(reasons, m) {
+				reasons = append(reasons, m)
+			}
+		}
+	}
+	return kept, reasons
+}
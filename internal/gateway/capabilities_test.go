@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestDetectNeeds(t *testing.T) {
+	body := []byte(`{"model":"m","max_tokens":100,"tools":[{"type":"function"}],"response_format":{"type":"json_object"},
+		"messages":[{"role":"user","content":[{"type":"text","text":"hi"},{"type":"image_url","image_url":{"url":"x"}}]}]}`)
+	needs := detectNeeds(body, 50)
+	if !needs.vision || !needs.tools || !needs.jsonMode || needs.promptTokens != 50 || needs.outputTokens != 100 {
+		t.Fatalf("unexpected needs: %+v", needs)
+	}
+
+	plain := detectNeeds([]byte(`{"model":"m","input":"hello","messages":[{"role":"user","content":"hi"}]}`), 5)
+	if plain.vision || plain.tools || plain.jsonMode {
+		t.Fatalf("expected a plain request to need nothing, got %+v", plain)
+	}
+}
+
+func TestProxySkipsIncapableProviders(t *testing.T) {
+	hits := map[string]int{}
+	newProvider := func(id string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[id]++
+			_, _ = w.Write([]byte(`{"id":"ok"}`))
+		}))
+	}
+	textOnly := newProvider("text-only")
+	defer textOnly.Close()
+	vision := newProvider("vision")
+	defer vision.Close()
+
+	no, yes := false, true
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "text-only", BaseURL: textOnly.URL, AccessToken: "token"},
+			{ID: "vision", BaseURL: vision.URL, AccessToken: "token"},
+		},
+		Models: []config.ModelConfig{{
+			Name:         "gpt-4o",
+			Capabilities: &config.Capabilities{Vision: &yes, MaxContext: 1000},
+			Providers: []config.ModelProvider{
+				{ID: "text-only", Capabilities: &config.Capabilities{Vision: &no}},
+				{ID: "vision"},
+			},
+		}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	image := `{"model":"gpt-4o","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"x"}}]}]}`
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(image))), RequestTypeChatCompletions)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if hits["text-only"] != 0 || hits["vision"] != 1 {
+		t.Fatalf("expected the image request to skip the text-only provider, got %v", hits)
+	}
+
+	tooLong := `{"model":"gpt-4o","max_tokens":5000,"messages":[{"role":"user","content":"hi"}]}`
+	rec = httptest.NewRecorder()
+	gw.Proxy(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(tooLong))), RequestTypeChatCompletions)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 when no provider fits, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,196 @@
+package gateway
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// contentEncoding returns the single content coding of a response, lower
+// cased, with "x-gzip" as "gzip".
+func contentEncoding(header http.Header) string {
+	encoding := strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding")))
+	if encoding == "x-gzip" {
+		return "gzip"
+	}
+	return encoding
+}
+
+// decodable reports whether the gateway can decompress the encoding.
+func decodable(encoding string) bool {
+	return encoding == "gzip" || encoding == "br"
+}
+
+// newDecoder returns a reader decompressing r. The gzip header is only read
+// with the first Read so a stream is not waited for before it is relayed.
+func newDecoder(r io.Reader, encoding string) io.Reader {
+	switch encoding {
+	case "gzip":
+		return &lazyGzipReader{source: r}
+	case "br":
+		return brotli.NewReader(r)
+	}
+	return r
+}
+
+type lazyGzipReader struct {
+	source io.Reader
+	reader *gzip.Reader
+}
+
+func (r *lazyGzipReader) Read(p []byte) (int, error) {
+	if r.reader == nil {
+		reader, err := gzip.NewReader(r.source)
+		if err != nil {
+			return 0, err
+		}
+		r.reader = reader
+	}
+	return r.reader.Read(p)
+}
+
+// decodeBody decompresses a body. A truncated body, as captured from a broken
+// stream, returns what could be decoded along with the error.
+func decodeBody(data []byte, encoding string) ([]byte, error) {
+	if !decodable(encoding) {
+		return nil, errors.New("unsupported content encoding " + encoding)
+	}
+	decoded, err := io.ReadAll(newDecoder(bytes.NewReader(data), encoding))
+	if errors.Is(err, io.ErrUnexpectedEOF) && len(decoded) == 0 {
+		return nil, err
+	}
+	return decoded, err
+}
+
+// decodeBodyForAnalysis returns the body to extract usage and errors from:
+// the decompressed body, as far as it decodes, or the body as is.
+func decodeBodyForAnalysis(data []byte, encoding string) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	encoding = contentEncoding(http.Header{"Content-Encoding": {encoding}})
+	if !decodable(encoding) {
+		return data
+	}
+	if decoded, err := decodeBody(data, encoding); err == nil || len(decoded) > 0 {
+		return decoded
+	}
+	return data
+}
+
+// setUpstreamEncoding sets the Accept-Encoding sent to providers. With
+// identity the header is dropped, so the transport asks for gzip and
+// decompresses the response itself; with decode only the encodings the
+// gateway can decompress are accepted.
+func (g *Gateway) setUpstreamEncoding(header http.Header) {
+	switch g.cfg.Compression {
+	case config.CompressionIdentity:
+		header.Del("Accept-Encoding")
+	case config.CompressionDecode:
+		header.Set("Accept-Encoding", "gzip, br")
+	}
+}
+
+// decodeResponse replaces the body of a compressed response with its
+// decompressed content, so usage analysis and response rewriting see plain
+// data. It returns the encoding that was removed.
+func decodeResponse(resp *http.Response, body io.Reader) (io.Reader, string) {
+	encoding := contentEncoding(resp.Header)
+	if !decodable(encoding) {
+		return body, ""
+	}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	return newDecoder(body, encoding), encoding
+}
+
+// clientEncoding picks the encoding to compress a decoded response with:
+// the provider's when the client accepts it, else gzip, else none.
+func clientEncoding(acceptEncoding, providerEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	switch {
+	case accepted[providerEncoding] || (providerEncoding == "gzip" && accepted["x-gzip"]):
+		return providerEncoding
+	case accepted["gzip"]:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressWriter compresses a response for the client. Flushes compress the
+// pending data, so streamed events reach the client as they arrive.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	encoder  interface {
+		io.WriteCloser
+		Flush() error
+	}
+	wroteHeader bool
+}
+
+func newCompressWriter(w http.ResponseWriter, encoding string) *compressWriter {
+	cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+	if encoding == "br" {
+		cw.encoder = brotli.NewWriter(w)
+	} else {
+		cw.encoder = gzip.NewWriter(w)
+	}
+	return cw
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set("Content-Encoding", w.encoding)
+		w.Header().Del("Content-Length")
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.encoder.Write(p)
+}
+
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	_ = w.encoder.Flush()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes the end of the compressed data, unless nothing was written.
+func (w *compressWriter) Close() error {
+	if !w.wroteHeader {
+		return nil
+	}
+	return w.encoder.Close()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func compress(t *testing.T, encoding, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser = gzip.NewWriter(&buf)
+	if encoding == "br" {
+		w = brotli.NewWriter(&buf)
+	}
+	_, _ = io.WriteString(w, data)
+	if err := w.Close(); err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProxyDecodesAndRecompressesResponses(t *testing.T) {
+	const completion = `{"id":"c1","model":"vendor-model","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":5}}`
+	encoding := "br"
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Accept-Encoding"); got != "gzip, br" {
+			t.Errorf("unexpected upstream Accept-Encoding %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", encoding)
+		_, _ = w.Write(compress(t, encoding, completion))
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		Compression:          config.CompressionDecode,
+		RewriteResponseModel: true,
+		Providers:            []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:               []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1", Model: "vendor-model"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	send := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+		return rec
+	}
+
+	for _, tc := range []struct {
+		provider, accept, want string
+	}{
+		{"br", "gzip, br", "br"},
+		{"br", "gzip", "gzip"},
+		{"gzip", "br;q=1, gzip;q=0", ""},
+		{"gzip", "", ""},
+	} {
+		encoding = tc.provider
+		rec := send(tc.accept)
+		if got := rec.Header().Get("Content-Encoding"); got != tc.want {
+			t.Fatalf("%s for %q: unexpected encoding %q", tc.provider, tc.accept, got)
+		}
+		body := rec.Body.Bytes()
+		if tc.want != "" {
+			decoded, err := decodeBody(body, tc.want)
+			if err != nil {
+				t.Fatalf("%s for %q: decode response: %v", tc.provider, tc.accept, err)
+			}
+			body = decoded
+		}
+		if !strings.Contains(string(body), `"model":"gpt-4o"`) {
+			t.Fatalf("%s for %q: response was not rewritten: %s", tc.provider, tc.accept, body)
+		}
+	}
+}
+
+func TestDecodeBodyForAnalysisOfTruncatedStream(t *testing.T) {
+	stream := strings.Repeat(`data: {"choices":[{"delta":{"content":"hello"}}]}`+"\n\n", 50)
+	data := compress(t, "gzip", stream)
+	partial := decodeBodyForAnalysis(data[:len(data)-10], "gzip")
+	if len(partial) == 0 || !strings.HasPrefix(stream, string(partial)) {
+		t.Fatalf("unexpected partial body %q", partial)
+	}
+	if got := decodeBodyForAnalysis([]byte("plain"), "gzip"); string(got) != "plain" {
+		t.Fatalf("undecodable body must be returned as is, got %q", got)
+	}
+}
+
+func TestProxyIdentityDropsAcceptEncoding(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Accept-Encoding"); strings.Contains(got, "br") {
+			t.Errorf("client Accept-Encoding was forwarded: %q", got)
+		}
+		_, _ = io.WriteString(w, `{"id":"c1"}`)
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		Compression: config.CompressionIdentity,
+		Providers:   []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:      []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+	req.Header.Set("Accept-Encoding", "br")
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != `{"id":"c1"}` {
+		t.Fatalf("unexpected response %d %q: %s", rec.Code, rec.Header().Get("Content-Encoding"), rec.Body.String())
+	}
+}
@@ -0,0 +1,314 @@
+package gateway
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// ConfigDiff lists the changes in routing behavior between two
+// configurations.
+type ConfigDiff struct {
+	ModelsAdded      []string      `json:"models_added,omitempty"`
+	ModelsRemoved    []string      `json:"models_removed,omitempty"`
+	ModelsChanged    []ModelChange `json:"models_changed,omitempty"`
+	ProvidersAdded   []string      `json:"providers_added,omitempty"`
+	ProvidersRemoved []string      `json:"providers_removed,omitempty"`
+	// ProvidersChanged are providers whose endpoint, credentials or other
+	// settings changed
+	ProvidersChanged []string      `json:"providers_changed,omitempty"`
+	GroupsAdded      []string      `json:"groups_added,omitempty"`
+	GroupsRemoved    []string      `json:"groups_removed,omitempty"`
+	GroupsChanged    []ListChange  `json:"groups_changed,omitempty"`
+	Aliases          []ValueChange `json:"aliases,omitempty"`
+	Deprecations     []ValueChange `json:"deprecations,omitempty"`
+	DefaultProvider  *ValueChange  `json:"default_provider,omitempty"`
+}
+
+// ModelChange describes how the routing of a model changed.
+type ModelChange struct {
+	Model string `json:"model"`
+	// Providers is set when the default provider order changed
+	Providers    *ListChange  `json:"providers,omitempty"`
+	RulesAdded   []string     `json:"rules_added,omitempty"`
+	RulesRemoved []string     `json:"rules_removed,omitempty"`
+	RulesChanged []ListChange `json:"rules_changed,omitempty"`
+}
+
+// ListChange is an ordered list of "provider/model" targets before and after
+// the change. Name is the group or rule expression it belongs to.
+type ListChange struct {
+	Name   string   `json:"name,omitempty"`
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+}
+
+// ValueChange is a setting before and after the change; an empty Before
+// means it was added and an empty After that it was removed.
+type ValueChange struct {
+	Name   string `json:"name,omitempty"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// DiffConfig compares the routing behavior of two configurations.
+func DiffConfig(before, after *config.Config) ConfigDiff {
+	var diff ConfigDiff
+
+	beforeModels := modelsByName(before.Models)
+	afterModels := modelsByName(after.Models)
+	diff.ModelsAdded, diff.ModelsRemoved = addedRemoved(beforeModels, afterModels)
+	for _, name := range sortedKeys(afterModels) {
+		old, ok := beforeModels[name]
+		if !ok {
+			continue
+		}
+		if change := diffModel(old, afterModels[name]); change != nil {
+			diff.ModelsChanged = append(diff.ModelsChanged, *change)
+		}
+	}
+
+	beforeProviders := providersByID(before.Providers)
+	afterProviders := providersByID(after.Providers)
+	diff.ProvidersAdded, diff.ProvidersRemoved = addedRemoved(beforeProviders, afterProviders)
+	for _, id := range sortedKeys(afterProviders) {
+		if old, ok := beforeProviders[id]; ok && !reflect.DeepEqual(old, afterProviders[id]) {
+			diff.ProvidersChanged = append(diff.ProvidersChanged, id)
+		}
+	}
+
+	beforeGroups := groupsByName(before.Groups)
+	afterGroups := groupsByName(after.Groups)
+	diff.GroupsAdded, diff.GroupsRemoved = addedRemoved(beforeGroups, afterGroups)
+	for _, name := range sortedKeys(afterGroups) {
+		old, ok := beforeGroups[name]
+		if !ok {
+			continue
+		}
+		if oldTargets, newTargets := groupTargets(old), groupTargets(afterGroups[name]); !reflect.DeepEqual(oldTargets, newTargets) {
+			diff.GroupsChanged = append(diff.GroupsChanged, ListChange{Name: name, Before: oldTargets, After: newTargets})
+		}
+	}
+
+	diff.Aliases = diffValues(aliasTargets(before.Alias), aliasTargets(after.Alias))
+	diff.Deprecations = diffValues(before.Deprecations, after.Deprecations)
+	if before.Default != after.Default {
+		diff.DefaultProvider = &ValueChange{Before: before.Default, After: after.Default}
+	}
+	return diff
+}
+
+// Empty reports whether the routing behavior is unchanged.
+func (d ConfigDiff) Empty() bool {
+	return reflect.DeepEqual(d, ConfigDiff{})
+}
+
+// Lines renders the diff as one human readable line per change.
+func (d ConfigDiff) Lines() []string {
+	var lines []string
+	for _, name := range d.ModelsAdded {
+		lines = append(lines, "model "+name+" added")
+	}
+	for _, name := range d.ModelsRemoved {
+		lines = append(lines, "model "+name+" removed")
+	}
+	for _, change := range d.ModelsChanged {
+		if change.Providers != nil {
+			lines = append(lines, fmt.Sprintf("model %s providers: %s", change.Model, formatListChange(*change.Providers)))
+		}
+		for _, rule := range change.RulesAdded {
+			lines = append(lines, fmt.Sprintf("model %s rule added: %s", change.Model, rule))
+		}
+		for _, rule := range change.RulesRemoved {
+			lines = append(lines, fmt.Sprintf("model %s rule removed: %s", change.Model, rule))
+		}
+		for _, rule := range change.RulesChanged {
+			lines = append(lines, fmt.Sprintf("model %s rule %s providers: %s", change.Model, rule.Name, formatListChange(rule)))
+		}
+	}
+	for _, id := range d.ProvidersAdded {
+		lines = append(lines, "provider "+id+" added")
+	}
+	for _, id := range d.ProvidersRemoved {
+		lines = append(lines, "provider "+id+" removed")
+	}
+	for _, id := range d.ProvidersChanged {
+		lines = append(lines, "provider "+id+" settings changed")
+	}
+	for _, name := range d.GroupsAdded {
+		lines = append(lines, "group "+name+" added")
+	}
+	for _, name := range d.GroupsRemoved {
+		lines = append(lines, "group "+name+" removed")
+	}
+	for _, change := range d.GroupsChanged {
+		lines = append(lines, fmt.Sprintf("group %s models: %s", change.Name, formatListChange(change)))
+	}
+	for _, change := range d.Aliases {
+		lines = append(lines, "alias "+formatValueChange(change))
+	}
+	for _, change := range d.Deprecations {
+		lines = append(lines, "deprecation "+formatValueChange(change))
+	}
+	if d.DefaultProvider != nil {
+		lines = append(lines, fmt.Sprintf("default provider: %q -> %q", d.DefaultProvider.Before, d.DefaultProvider.After))
+	}
+	return lines
+}
+
+func diffModel(before, after config.ModelConfig) *ModelChange {
+	change := ModelChange{Model: after.Name}
+	if oldTargets, newTargets := providerTargets(before.Providers), providerTargets(after.Providers); !reflect.DeepEqual(oldTargets, newTargets) {
+		change.Providers = &ListChange{Before: oldTargets, After: newTargets}
+	}
+
+	beforeRules := rulesByExpression(before.Rules)
+	afterRules := rulesByExpression(after.Rules)
+	change.RulesAdded, change.RulesRemoved = addedRemoved(beforeRules, afterRules)
+	for _, rule := range after.Rules {
+		old, ok := beforeRules[rule.Expression]
+		if !ok {
+			continue
+		}
+		if oldTargets, newTargets := overrideTargets(old), overrideTargets(rule.Providers); !reflect.DeepEqual(oldTargets, newTargets) {
+			change.RulesChanged = append(change.RulesChanged, ListChange{Name: rule.Expression, Before: oldTargets, After: newTargets})
+		}
+	}
+
+	if change.Providers == nil && len(change.RulesAdded) == 0 && len(change.RulesRemoved) == 0 && len(change.RulesChanged) == 0 {
+		return nil
+	}
+	return &change
+}
+
+func modelsByName(models []config.ModelConfig) map[string]config.ModelConfig {
+	out := make(map[string]config.ModelConfig, len(models))
+	for _, model := range models {
+		out[model.Name] = model
+	}
+	return out
+}
+
+func providersByID(providers []config.ProviderConfig) map[string]config.ProviderConfig {
+	out := make(map[string]config.ProviderConfig, len(providers))
+	for _, provider := range providers {
+		out[provider.ID] = provider
+	}
+	return out
+}
+
+func groupsByName(groups []config.GroupConfig) map[string]config.GroupConfig {
+	out := make(map[string]config.GroupConfig, len(groups))
+	for _, group := range groups {
+		out[group.Name] = group
+	}
+	return out
+}
+
+func rulesByExpression(rules []config.RuleConfig) map[string]config.ProviderOverrideConfig {
+	out := make(map[string]config.ProviderOverrideConfig, len(rules))
+	for _, rule := range rules {
+		out[rule.Expression] = rule.Providers
+	}
+	return out
+}
+
+func aliasTargets(aliases []config.AliasConfig) map[string]string {
+	out := make(map[string]string, len(aliases))
+	for _, alias := range aliases {
+		out[alias.Model] = alias.Target
+	}
+	return out
+}
+
+func providerTargets(providers config.ModelProviders) []string {
+	targets := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		targets = append(targets, joinTarget(provider.ID, provider.Model))
+	}
+	return targets
+}
+
+func overrideTargets(overrides config.ProviderOverrideConfig) []string {
+	targets := make([]string, 0, len(overrides))
+	for _, override := range overrides {
+		targets = append(targets, joinTarget(override.Provider, override.Model))
+	}
+	return targets
+}
+
+func groupTargets(group config.GroupConfig) []string {
+	targets := make([]string, 0, len(group.Models))
+	for _, member := range group.Models {
+		if member.Provider != "" {
+			targets = append(targets, member.Provider+"/"+member.Model)
+		} else {
+			targets = append(targets, member.Model)
+		}
+	}
+	return targets
+}
+
+func joinTarget(provider, model string) string {
+	if model == "" {
+		return provider
+	}
+	return provider + "/" + model
+}
+
+func diffValues(before, after map[string]string) []ValueChange {
+	var changes []ValueChange
+	for _, name := range sortedKeys(before) {
+		if _, ok := after[name]; !ok {
+			changes = append(changes, ValueChange{Name: name, Before: before[name]})
+		}
+	}
+	for _, name := range sortedKeys(after) {
+		if before[name] != after[name] {
+			changes = append(changes, ValueChange{Name: name, Before: before[name], After: after[name]})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+func addedRemoved[V any](before, after map[string]V) (added, removed []string) {
+	for _, name := range sortedKeys(after) {
+		if _, ok := before[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	for _, name := range sortedKeys(before) {
+		if _, ok := after[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	return added, removed
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatListChange(change ListChange) string {
+	return "[" + strings.Join(change.Before, ", ") + "] -> [" + strings.Join(change.After, ", ") + "]"
+}
+
+func formatValueChange(change ValueChange) string {
+	switch {
+	case change.Before == "":
+		return fmt.Sprintf("%s -> %s added", change.Name, change.After)
+	case change.After == "":
+		return fmt.Sprintf("%s -> %s removed", change.Name, change.Before)
+	default:
+		return fmt.Sprintf("%s: %s -> %s", change.Name, change.Before, change.After)
+	}
+}
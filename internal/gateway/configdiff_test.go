@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestDiffConfig(t *testing.T) {
+	before := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "p1", BaseURL: "http://p1"},
+			{ID: "p2", BaseURL: "http://p2"},
+			{ID: "old", BaseURL: "http://old"},
+		},
+		Models: []config.ModelConfig{
+			{
+				Name:      "gpt-4o",
+				Providers: config.ModelProviders{{ID: "p1"}, {ID: "p2", Model: "openai/gpt-4o"}},
+				Rules: []config.RuleConfig{
+					{Expression: "TokenCount > 1000", Providers: config.ProviderOverrideConfig{{Provider: "p2"}}},
+					{Expression: `Path == "/v1/responses"`, Providers: config.ProviderOverrideConfig{{Provider: "p1"}}},
+				},
+			},
+			{Name: "retired", Providers: config.ModelProviders{{ID: "old"}}},
+		},
+		Groups:       []config.GroupConfig{{Name: "smart", Models: []config.GroupMember{{Model: "gpt-4o"}, {Model: "claude", Provider: "p2"}}}},
+		Alias:        []config.AliasConfig{{Model: "fast", Target: "gpt-4o"}},
+		Deprecations: map[string]string{"gpt-4": "gpt-4o"},
+		Default:      "p1",
+	}
+	after := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "p1", BaseURL: "http://p1"},
+			{ID: "p2", BaseURL: "http://p2.example"},
+			{ID: "p3", BaseURL: "http://p3"},
+		},
+		Models: []config.ModelConfig{
+			{
+				Name:      "gpt-4o",
+				Providers: config.ModelProviders{{ID: "p2", Model: "openai/gpt-4o"}, {ID: "p1"}},
+				Rules: []config.RuleConfig{
+					{Expression: "TokenCount > 1000", Providers: config.ProviderOverrideConfig{{Provider: "p3"}}},
+					{Expression: "TokenCount > 8000", Providers: config.ProviderOverrideConfig{{Provider: "p2"}}},
+				},
+			},
+			{Name: "mini", Providers: config.ModelProviders{{ID: "p3"}}},
+		},
+		Groups:       []config.GroupConfig{{Name: "smart", Models: []config.GroupMember{{Model: "claude", Provider: "p2"}, {Model: "gpt-4o"}}}},
+		Alias:        []config.AliasConfig{{Model: "fast", Target: "mini"}, {Model: "cheap", Target: "mini"}},
+		Deprecations: map[string]string{},
+		Default:      "p1",
+	}
+
+	diff := DiffConfig(before, after)
+	want := ConfigDiff{
+		ModelsAdded:   []string{"mini"},
+		ModelsRemoved: []string{"retired"},
+		ModelsChanged: []ModelChange{{
+			Model:        "gpt-4o",
+			Providers:    &ListChange{Before: []string{"p1", "p2/openai/gpt-4o"}, After: []string{"p2/openai/gpt-4o", "p1"}},
+			RulesAdded:   []string{"TokenCount > 8000"},
+			RulesRemoved: []string{`Path == "/v1/responses"`},
+			RulesChanged: []ListChange{{Name: "TokenCount > 1000", Before: []string{"p2"}, After: []string{"p3"}}},
+		}},
+		ProvidersAdded:   []string{"p3"},
+		ProvidersRemoved: []string{"old"},
+		ProvidersChanged: []string{"p2"},
+		GroupsChanged:    []ListChange{{Name: "smart", Before: []string{"gpt-4o", "p2/claude"}, After: []string{"p2/claude", "gpt-4o"}}},
+		Aliases: []ValueChange{
+			{Name: "cheap", After: "mini"},
+			{Name: "fast", Before: "gpt-4o", After: "mini"},
+		},
+		Deprecations: []ValueChange{{Name: "gpt-4", Before: "gpt-4o"}},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Fatalf("unexpected diff\n got %+v\nwant %+v", diff, want)
+	}
+	if diff.Empty() {
+		t.Fatalf("diff should not be empty")
+	}
+	if lines := diff.Lines(); len(lines) != 13 || lines[2] != "model gpt-4o providers: [p1, p2/openai/gpt-4o] -> [p2/openai/gpt-4o, p1]" {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+
+	if diff := DiffConfig(before, before); !diff.Empty() || len(diff.Lines()) != 0 {
+		t.Fatalf("expected no changes, got %+v", diff)
+	}
+}
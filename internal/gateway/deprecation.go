@@ -0,0 +1,51 @@
+package gateway
+
+import (
+	"net/http"
+)
+
+// deprecationHeader tells clients that a retired model was replaced, as
+// "<requested> -> <replacement>".
+const deprecationHeader = "X-Gateway-Deprecated-Model"
+
+// headerWriter adds headers to the response when it is written. Headers set
+// before forwarding cannot be used because the upstream response headers
+// replace them.
+type headerWriter struct {
+	http.ResponseWriter
+	header      http.Header
+	wroteHeader bool
+}
+
+func withResponseHeader(w http.ResponseWriter, key, value string) *headerWriter {
+	hw := &headerWriter{ResponseWriter: w, header: http.Header{}}
+	hw.header.Set(key, value)
+	return hw
+}
+
+func (w *headerWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		for k, values := range w.header {
+			w.Header()[k] = values
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *headerWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *headerWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *headerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
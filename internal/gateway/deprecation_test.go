@@ -0,0 +1,50 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestProxyRemapsDeprecatedModels(t *testing.T) {
+	var forwarded string
+	providerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded = gjson.GetBytes(body, "model").String()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	}))
+	defer providerServer.Close()
+
+	cfg := &config.Config{
+		Providers:    []config.ProviderConfig{{ID: "p1", BaseURL: providerServer.URL, AccessToken: "token"}},
+		Models:       []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+		Deprecations: map[string]string{"gpt-4-32k": "gpt-4o"},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4-32k"}`))), RequestTypeChatCompletions)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if forwarded != "gpt-4o" {
+		t.Fatalf("expected the replacement to be forwarded, got %s", forwarded)
+	}
+	if got := rec.Header().Get(deprecationHeader); got != "gpt-4-32k -> gpt-4o" {
+		t.Fatalf("expected substitution header, got %q", got)
+	}
+	if rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected upstream headers to be kept, got %v", rec.Header())
+	}
+}
@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+)
+
+// RouteDiscovered tags usage records of requests routed to automatically
+// discovered models.
+const RouteDiscovered = "discovered"
+
+type routeContextKey struct{}
+
+// withRoute marks the request context with how its model was routed, so usage
+// records created for it carry the tag.
+func withRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeContextKey{}, route)
+}
+
+func routeFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	route, _ := ctx.Value(routeContextKey{}).(string)
+	return route
+}
+
+// RunModelDiscovery registers pass-through routes for the models the providers
+// list, refreshing them every interval until ctx is done. Models configured
+// explicitly, as groups or as aliases are left alone.
+func (g *Gateway) RunModelDiscovery(ctx context.Context) {
+	if g.cfg.ModelDiscovery == nil {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(g.cfg.ModelDiscovery.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	log.Infof("model discovery started: interval=%ds", g.cfg.ModelDiscovery.IntervalSeconds)
+	g.discoverModels(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.discoverModels(ctx)
+		}
+	}
+}
+
+func (g *Gateway) discoverModels(ctx context.Context) {
+	g.discoveredMu.RLock()
+	previous := g.discovered
+	g.discoveredMu.RUnlock()
+
+	routes := make(map[string][]ruleProvider)
+	for _, provider := range g.cfg.Providers {
+		if only := g.cfg.ModelDiscovery.Providers; len(only) > 0 && !slices.Contains(only, provider.ID) {
+			continue
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		models, err := g.fetchProviderModelsContext(fetchCtx, provider)
+		cancel()
+		if err != nil {
+			// Keep serving what the provider listed last time.
+			log.Warningf("discover models of provider %s: %v", provider.ID, err)
+			for model, providers := range previous {
+				if slices.Contains(providers, ruleProvider{id: provider.ID}) {
+					routes[model] = append(routes[model], ruleProvider{id: provider.ID})
+				}
+			}
+			continue
+		}
+		for _, model := range models {
+			if model.ID == "" || g.configuredModel(model.ID) || slices.Contains(routes[model.ID], ruleProvider{id: provider.ID}) {
+				continue
+			}
+			routes[model.ID] = append(routes[model.ID], ruleProvider{id: provider.ID})
+		}
+	}
+
+	g.discoveredMu.Lock()
+	g.discovered = routes
+	g.discoveredMu.Unlock()
+	log.Debugf("model discovery: %d models registered", len(routes))
+}
+
+// configuredModel reports whether a model name is routed by the configuration.
+func (g *Gateway) configuredModel(name string) bool {
+	if _, ok := g.models[name]; ok {
+		return true
+	}
+	if _, ok := g.groups[name]; ok {
+		return true
+	}
+	_, ok := g.aliases[name]
+	return ok
+}
+
+// discoveredProviders returns the providers that listed the model, in
+// provider configuration order.
+func (g *Gateway) discoveredProviders(model string) []ruleProvider {
+	g.discoveredMu.RLock()
+	defer g.discoveredMu.RUnlock()
+	return g.discovered[model]
+}
+
+// discoveredModelList returns the discovered models for /v1/models, owned by
+// the first provider that listed them.
+func (g *Gateway) discoveredModelList() []ModelInfo {
+	g.discoveredMu.RLock()
+	defer g.discoveredMu.RUnlock()
+
+	created := time.Now().Unix()
+	models := make([]ModelInfo, 0, len(g.discovered))
+	for id, providers := range g.discovered {
+		models = append(models, ModelInfo{
+			ID:         id,
+			Object:     "model",
+			Created:    created,
+			OwnedBy:    providers[0].id,
+			Discovered: true,
+		})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models
+}
@@ -0,0 +1,65 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestModelDiscoveryRegistersUnconfiguredModels(t *testing.T) {
+	var served []string
+	providerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/models" {
+			_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"gpt-4o"},{"id":"o3-mini"}]}`))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		served = append(served, gjson.GetBytes(body, "model").String())
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	}))
+	defer providerServer.Close()
+
+	cfg := &config.Config{
+		Providers:      []config.ProviderConfig{{ID: "p1", BaseURL: providerServer.URL, AccessToken: "token"}},
+		Models:         []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+		ModelDiscovery: &config.ModelDiscoveryConfig{IntervalSeconds: 3600},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	gw.discoverModels(context.Background())
+
+	if got := gw.discoveredProviders("gpt-4o"); got != nil {
+		t.Fatalf("configured model should not be discovered, got %v", got)
+	}
+	discovered := map[string]bool{}
+	for _, m := range gw.ModelList(context.Background()).Data {
+		discovered[m.ID] = m.Discovered
+	}
+	if discovered["gpt-4o"] || !discovered["o3-mini"] {
+		t.Fatalf("expected only o3-mini to be tagged as discovered, got %v", discovered)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"o3-mini"}`)))
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(served) != 1 || served[0] != "o3-mini" {
+		t.Fatalf("expected o3-mini to be forwarded, got %v", served)
+	}
+
+	ctx := withRoute(context.Background(), RouteDiscovered)
+	if got := routeFromContext(ctx); got != RouteDiscovered {
+		t.Fatalf("expected route tag %q, got %q", RouteDiscovered, got)
+	}
+}
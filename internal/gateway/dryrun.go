@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+)
+
+// Routes reported by DryRun besides RouteDiscovered.
+const (
+	RouteModel   = "model"
+	RouteGroup   = "group"
+	RouteDefault = "default"
+)
+
+// RoutePlan describes how the gateway would route a request.
+type RoutePlan struct {
+	// Model is the requested model, ResolvedModel the one routed after
+	// deprecations and aliases
+	Model         string `json:"model"`
+	ResolvedModel string `json:"resolved_model"`
+	// Route is model, group, discovered or default
+	Route string `json:"route"`
+	// Rule is the expression of the matching rule; empty when the default
+	// provider order applies
+	Rule       string `json:"rule,omitempty"`
+	TokenCount int    `json:"token_count"`
+	// Providers are the candidates in the order they would be tried
+	Providers []PlannedProvider `json:"providers"`
+	// Unsupported lists the capabilities that ruled out candidates
+	Unsupported []string `json:"unsupported,omitempty"`
+}
+
+// PlannedProvider is a candidate of a RoutePlan.
+type PlannedProvider struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+}
+
+// DryRun resolves the providers a request would be sent to without sending
+// it. Tenant overrides, limits, budgets and the inspection stages are not
+// applied.
+func (g *Gateway) DryRun(body []byte, reqType RequestType, path string) (*RoutePlan, error) {
+	normalized, changed, err := normalizeRequestBody(body, reqType)
+	if err != nil {
+		return nil, fmt.Errorf("normalize request body: %w", err)
+	}
+	if changed {
+		body = normalized
+	}
+
+	plan := &RoutePlan{Model: gjson.GetBytes(body, "model").String()}
+	if plan.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	modelName := plan.Model
+	if replacement, ok := g.cfg.Deprecations[modelName]; ok {
+		modelName = replacement
+	}
+	if alias, ok := g.aliases[modelName]; ok {
+		modelName = alias.Target
+		if body, err = applyAlias(body, alias); err != nil {
+			return nil, fmt.Errorf("apply alias %s: %w", alias.Model, err)
+		}
+	}
+	plan.ResolvedModel = modelName
+	plan.TokenCount = CountTokens(modelName, reqType, body)
+
+	needs := detectNeeds(body, plan.TokenCount)
+	var candidates []ruleProvider
+	route, ok := g.models[modelName]
+	if ok {
+		plan.Route = RouteModel
+		if rule := matchRule(route, g.evalEnv(modelName, plan.TokenCount, path)); rule != nil {
+			plan.Rule = rule.expression
+		}
+		candidates, plan.Unsupported = g.filterCapable(modelName, g.selectProviders(route, modelName, plan.TokenCount, path), needs)
+	} else if group, ok := g.groups[modelName]; ok {
+		plan.Route = RouteGroup
+		candidates, plan.Unsupported = g.resolveGroup(nil, group, needs, path)
+	} else if discovered := g.discoveredProviders(modelName); discovered != nil {
+		plan.Route = RouteDiscovered
+		candidates = discovered
+	} else if g.defaultProvider != nil {
+		plan.Route = RouteDefault
+		candidates = []ruleProvider{{id: g.defaultProvider.ID}}
+	} else {
+		return nil, fmt.Errorf("model %s not configured", modelName)
+	}
+	key := stickyKey(route, nil, body, reqType)
+	candidates = stickTo(key, candidates)
+	sticky := stickyHead(key, candidates)
+	candidates = g.withFallbackProviders(candidates)
+
+	candidates = g.skipFailingChecks(modelName, g.skipEvicted(modelName, g.skipUnavailable(modelName, candidates)))
+	for _, c := range g.orderBySLO(candidates, sticky) {
+		plan.Providers = append(plan.Providers, PlannedProvider{Provider: c.id, Model: g.targetModelOf(c, modelName)})
+	}
+	return plan, nil
+}
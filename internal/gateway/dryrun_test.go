@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestDryRun(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "p1", BaseURL: "http://p1", AccessToken: "t"},
+			{ID: "p2", BaseURL: "http://p2", AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{{
+			Name:      "gpt-4o",
+			Providers: []config.ModelProvider{{ID: "p1"}, {ID: "p2"}},
+			Rules: []config.RuleConfig{{
+				Expression: `Path == "/v1/responses"`,
+				Providers:  config.ProviderOverrideConfig{{Provider: "p2", Model: "openai/gpt-4o"}},
+			}},
+		}},
+		Alias:   []config.AliasConfig{{Model: "smart", Target: "gpt-4o"}},
+		Default: "p1",
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	plan, err := gw.DryRun([]byte(`{"model":"smart","messages":[{"role":"user","content":"hi"}]}`), RequestTypeChatCompletions, "/v1/chat/completions")
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if plan.ResolvedModel != "gpt-4o" || plan.Route != RouteModel || plan.Rule != "" || len(plan.Providers) != 2 || plan.Providers[0] != (PlannedProvider{Provider: "p1", Model: "gpt-4o"}) {
+		t.Fatalf("unexpected default order plan %+v", plan)
+	}
+
+	plan, err = gw.DryRun([]byte(`{"model":"gpt-4o","input":"hi"}`), RequestTypeResponses, "/v1/responses")
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if plan.Rule != `Path == "/v1/responses"` || len(plan.Providers) != 1 || plan.Providers[0] != (PlannedProvider{Provider: "p2", Model: "openai/gpt-4o"}) {
+		t.Fatalf("unexpected rule plan %+v", plan)
+	}
+
+	plan, err = gw.DryRun([]byte(`{"model":"unknown"}`), RequestTypeChatCompletions, "/v1/chat/completions")
+	if err != nil || plan.Route != RouteDefault || plan.Providers[0].Provider != "p1" {
+		t.Fatalf("expected unknown models to use the default provider, got %+v %v", plan, err)
+	}
+}
+
+func TestTimeWindowRules(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "peak", BaseURL: "http://peak", AccessToken: "t"},
+			{ID: "offpeak", BaseURL: "http://offpeak", AccessToken: "t"},
+			{ID: "holiday", BaseURL: "http://holiday", AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{{
+			Name:      "gpt-4o",
+			Providers: []config.ModelProvider{{ID: "peak"}},
+			Rules: []config.RuleConfig{
+				{Expression: `Date == "2024-12-25"`, Providers: config.ProviderOverrideConfig{{Provider: "holiday"}}},
+				{Expression: `Hour >= 22 || Hour < 6 || Weekday in [0, 6]`, Providers: config.ProviderOverrideConfig{{Provider: "offpeak"}}},
+			},
+		}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	for _, tc := range []struct {
+		at   time.Time
+		want string
+	}{
+		{time.Date(2024, 12, 24, 14, 0, 0, 0, time.Local), "peak"},
+		{time.Date(2024, 12, 24, 23, 0, 0, 0, time.Local), "offpeak"},
+		{time.Date(2024, 12, 24, 5, 59, 0, 0, time.Local), "offpeak"},
+		{time.Date(2024, 12, 21, 14, 0, 0, 0, time.Local), "offpeak"},
+		{time.Date(2024, 12, 25, 14, 0, 0, 0, time.Local), "holiday"},
+	} {
+		gw.now = func() time.Time { return tc.at }
+		if got := gw.selectProviders(gw.models["gpt-4o"], "gpt-4o", 0, "/v1/chat/completions")[0].id; got != tc.want {
+			t.Fatalf("at %s expected %s, got %s", tc.at, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func (t RequestType) pathKey() string {
+	switch t {
+	case RequestTypeResponses:
+		return config.PathResponses
+	case RequestTypeAnthropicMessages:
+		return config.PathMessages
+	default:
+		return config.PathChatCompletions
+	}
+}
+
+// providerURL builds the URL of a provider endpoint. A path template configured
+// for the endpoint replaces the path of base_url as is, with {model} substituted;
+// otherwise defaultPath is joined to base_url. The client query is filtered and
+// completed by the provider's query rules.
+func providerURL(provider config.ProviderConfig, key, defaultPath, model, rawQuery string) (string, error) {
+	target, err := endpointURL(provider, key, defaultPath, model, forwardedQuery(provider.Query, rawQuery))
+	if err != nil || provider.Query == nil || len(provider.Query.Set) == 0 {
+		return target, err
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	values := u.Query()
+	for name, value := range provider.Query.Set {
+		values.Set(name, value)
+	}
+	u.RawQuery = values.Encode()
+	return u.String(), nil
+}
+
+func endpointURL(provider config.ProviderConfig, key, defaultPath, model, rawQuery string) (string, error) {
+	template := provider.Paths[key]
+	if template == "" {
+		return joinURL(provider.BaseURL, defaultPath, rawQuery)
+	}
+
+	ref, err := url.Parse(strings.ReplaceAll(template, "{model}", url.PathEscape(model)))
+	if err != nil {
+		return "", fmt.Errorf("parse %s path template: %w", key, err)
+	}
+	target := ref
+	if !ref.IsAbs() {
+		baseURL, err := url.Parse(provider.BaseURL)
+		if err != nil {
+			return "", err
+		}
+		target = baseURL
+		target.Path = ref.Path
+		target.RawPath = ref.RawPath
+	}
+	target.RawQuery = mergeQuery(ref.RawQuery, rawQuery)
+	return target.String(), nil
+}
+
+// mergeQuery appends the client query to the query of the path template.
+func mergeQuery(template, client string) string {
+	switch {
+	case template == "":
+		return client
+	case client == "":
+		return template
+	default:
+		return template + "&" + client
+	}
+}
+
+// forwardedQuery keeps the client query parameters the provider allows. All
+// parameters are forwarded when the provider has no forward list.
+func forwardedQuery(rules *config.QueryConfig, rawQuery string) string {
+	if rules == nil || len(rules.Forward) == 0 || rawQuery == "" {
+		return rawQuery
+	}
+	values, _ := url.ParseQuery(rawQuery)
+	kept := url.Values{}
+	for _, name := range rules.Forward {
+		if v, ok := values[name]; ok {
+			kept[name] = v
+		}
+	}
+	return kept.Encode()
+}
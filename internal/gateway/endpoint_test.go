@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestProviderURL(t *testing.T) {
+	provider := config.ProviderConfig{
+		BaseURL: "https://example.com/v1",
+		Paths: map[string]string{
+			config.PathChatCompletions: "/openai/deployments/{model}/chat/completions?api-version=2024-06-01",
+			config.PathModels:          "https://models.example.com/list",
+		},
+	}
+	cases := []struct {
+		key, defaultPath, model, query, want string
+	}{
+		{config.PathChatCompletions, "chat/completions", "gpt-4o", "", "https://example.com/openai/deployments/gpt-4o/chat/completions?api-version=2024-06-01"},
+		{config.PathChatCompletions, "chat/completions", "gpt-4o", "trace=1", "https://example.com/openai/deployments/gpt-4o/chat/completions?api-version=2024-06-01&trace=1"},
+		{config.PathModels, "/models", "", "", "https://models.example.com/list"},
+		{config.PathResponses, "responses", "gpt-4o", "", "https://example.com/v1/responses"},
+	}
+	for _, c := range cases {
+		got, err := providerURL(provider, c.key, c.defaultPath, c.model, c.query)
+		if err != nil {
+			t.Fatalf("provider url for %s: %v", c.key, err)
+		}
+		if got != c.want {
+			t.Errorf("provider url for %s = %s, want %s", c.key, got, c.want)
+		}
+	}
+}
+
+func TestProviderURLQueryRules(t *testing.T) {
+	provider := config.ProviderConfig{
+		BaseURL: "https://example.com/v1?tenant=acme",
+		Query: &config.QueryConfig{
+			Forward: []string{"trace"},
+			Set:     map[string]string{"api-version": "2024-06-01"},
+		},
+	}
+	cases := []struct {
+		query, want string
+	}{
+		{"", "https://example.com/v1/chat/completions?api-version=2024-06-01&tenant=acme"},
+		{"trace=1&debug=true", "https://example.com/v1/chat/completions?api-version=2024-06-01&tenant=acme&trace=1"},
+		{"api-version=2023-01-01", "https://example.com/v1/chat/completions?api-version=2024-06-01&tenant=acme"},
+	}
+	for _, c := range cases {
+		got, err := providerURL(provider, config.PathChatCompletions, "chat/completions", "gpt-4o", c.query)
+		if err != nil {
+			t.Fatalf("provider url for %q: %v", c.query, err)
+		}
+		if got != c.want {
+			t.Errorf("provider url for %q = %s, want %s", c.query, got, c.want)
+		}
+	}
+
+	// Without a forward list the client parameters are kept.
+	provider.Query.Forward = nil
+	got, err := providerURL(provider, config.PathChatCompletions, "chat/completions", "gpt-4o", "trace=1&api-version=2023-01-01")
+	if err != nil {
+		t.Fatalf("provider url: %v", err)
+	}
+	if want := "https://example.com/v1/chat/completions?api-version=2024-06-01&tenant=acme&trace=1"; got != want {
+		t.Errorf("provider url = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"sync"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// usageFeedBuffer is the number of records a subscriber may fall behind
+// before records are dropped for it.
+const usageFeedBuffer = 64
+
+// usageFeed fans completed usage records out to live subscribers.
+type usageFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan storage.UsageRecord]struct{}
+}
+
+func newUsageFeed() *usageFeed {
+	return &usageFeed{subscribers: make(map[chan storage.UsageRecord]struct{})}
+}
+
+// publish never blocks: slow subscribers miss records instead of delaying
+// requests.
+func (f *usageFeed) publish(record storage.UsageRecord) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subscribers {
+		select {
+		case ch <- record:
+		default:
+		}
+	}
+}
+
+// SubscribeUsage streams usage records as requests complete. The returned
+// function stops the subscription and closes the channel.
+func (g *Gateway) SubscribeUsage() (<-chan storage.UsageRecord, func()) {
+	ch := make(chan storage.UsageRecord, usageFeedBuffer)
+	g.feed.mu.Lock()
+	g.feed.subscribers[ch] = struct{}{}
+	g.feed.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			g.feed.mu.Lock()
+			delete(g.feed.subscribers, ch)
+			g.feed.mu.Unlock()
+			close(ch)
+		})
+	}
+}
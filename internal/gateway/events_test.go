@@ -0,0 +1,34 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func TestSubscribeUsage(t *testing.T) {
+	gw := &Gateway{feed: newUsageFeed()}
+	records, unsubscribe := gw.SubscribeUsage()
+
+	gw.feed.publish(storage.UsageRecord{RequestID: "req-1"})
+	if got := <-records; got.RequestID != "req-1" {
+		t.Fatalf("unexpected record %+v", got)
+	}
+
+	// A subscriber that stops reading must not block publishing.
+	for range usageFeedBuffer + 10 {
+		gw.feed.publish(storage.UsageRecord{RequestID: "req-2"})
+	}
+	if len(records) != usageFeedBuffer {
+		t.Fatalf("expected a full buffer, got %d records", len(records))
+	}
+
+	unsubscribe()
+	unsubscribe()
+	gw.feed.publish(storage.UsageRecord{RequestID: "req-3"})
+	for record := range records {
+		if record.RequestID == "req-3" {
+			t.Fatalf("unsubscribed channel must not receive records")
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/notify"
+)
+
+// RunProviderEviction evicts providers that stay unhealthy for longer than
+// provider_eviction.after_seconds from rotation, and probes the evicted ones
+// every interval with a one token completion until ctx is done. A provider
+// that passes a probe, or serves a request while every candidate is evicted,
+// is restored.
+func (g *Gateway) RunProviderEviction(ctx context.Context) {
+	if g.cfg.ProviderEviction == nil {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(g.cfg.ProviderEviction.ProbeIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.evictProviders()
+			for _, id := range g.health.evictedProviders() {
+				g.probeEvicted(ctx, id)
+			}
+		}
+	}
+}
+
+func (g *Gateway) evictProviders() {
+	after := time.Duration(g.cfg.ProviderEviction.AfterSeconds) * time.Second
+	for _, id := range g.health.evict(after) {
+		failures, _ := g.health.snapshot(id)
+		log.Warningf("provider %s evicted from rotation after being unhealthy for %s", id, after)
+		g.notifier.Publish(notify.Event{
+			Type:     notify.EventProviderEvicted,
+			Severity: notify.SeverityCritical,
+			Provider: id,
+			Message:  fmt.Sprintf("provider %s has been unhealthy for %s and is out of rotation until it passes a probe", id, after),
+			Details:  map[string]any{"consecutive_failures": failures},
+		})
+	}
+}
+
+// probeEvicted sends a probe to an evicted provider and restores it when the
+// probe succeeds.
+func (g *Gateway) probeEvicted(ctx context.Context, id string) {
+	provider, ok := g.providers[id]
+	if !ok {
+		return
+	}
+	model := g.warmupModel(id)
+	if model == "" {
+		log.Debugf("skip probe of evicted provider %s: no model is configured for it", id)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(g.cfg.ProviderEviction.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	result := SelfTestResult{}
+	g.probeProvider(ctx, provider, model, &result)
+	if !result.Success {
+		log.Debugf("probe of evicted provider %s failed: %s", id, result.Error)
+		return
+	}
+	if !g.health.success(id) {
+		return
+	}
+	log.Infof("provider %s passed a probe and is back in rotation", id)
+	g.notifier.Publish(notify.Event{
+		Type:     notify.EventProviderRecovered,
+		Severity: notify.SeverityInfo,
+		Provider: id,
+		Model:    model,
+		Message:  fmt.Sprintf("provider %s passed a probe and is back in rotation", id),
+		Details:  map[string]any{"probe_latency_ms": result.Latency.Milliseconds()},
+	})
+}
+
+// skipEvicted drops candidates whose provider is evicted. If that would leave
+// nothing, all candidates are kept and tried.
+func (g *Gateway) skipEvicted(modelName string, candidates []ruleProvider) []ruleProvider {
+	var kept []ruleProvider
+	for _, c := range candidates {
+		if g.health.isEvicted(c.id) {
+			log.Debugf("[%s] skip provider %s: evicted", modelName, c.id)
+			continue
+		}
+		kept = append(kept, c)
+	}
+	if len(kept) == 0 {
+		return candidates
+	}
+	return kept
+}
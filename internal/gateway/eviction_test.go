@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/notify"
+)
+
+func TestProviderEvictionAndProbeRecovery(t *testing.T) {
+	events := make(chan notify.Event, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event notify.Event
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	t.Cleanup(hook.Close)
+
+	var down atomic.Bool
+	down.Store(true)
+	var flakyCalls atomic.Int64
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flakyCalls.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"c1"}`))
+	}))
+	t.Cleanup(flaky.Close)
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"c2"}`))
+	}))
+	t.Cleanup(healthy.Close)
+
+	cfg := &config.Config{
+		ProviderUnhealthyThreshold: 1,
+		ProviderEviction:           &config.ProviderEvictionConfig{AfterSeconds: 300, ProbeIntervalSeconds: 60, TimeoutSeconds: 5},
+		Notifiers:                  []config.NotifierConfig{{Name: "ops", Type: "webhook", URL: hook.URL, Events: []string{string(notify.EventProviderEvicted), string(notify.EventProviderRecovered)}}},
+		Providers: []config.ProviderConfig{
+			{ID: "flaky", BaseURL: flaky.URL, AccessToken: "t"},
+			{ID: "healthy", BaseURL: healthy.URL, AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "flaky"}, {ID: "healthy"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	gw.health.now = func() time.Time { return now }
+
+	proxy := func() {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o"}`)))
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected the healthy provider to answer, got %d", rec.Code)
+		}
+	}
+	proxy()
+	if calls := flakyCalls.Load(); calls != 1 {
+		t.Fatalf("expected one request to the flaky provider, got %d", calls)
+	}
+
+	gw.evictProviders()
+	if gw.health.isEvicted("flaky") {
+		t.Fatal("the provider must not be evicted before after_seconds")
+	}
+	now = now.Add(5 * time.Minute)
+	gw.evictProviders()
+	if !gw.health.isEvicted("flaky") {
+		t.Fatal("expected the provider to be evicted")
+	}
+	proxy()
+	if calls := flakyCalls.Load(); calls != 1 {
+		t.Fatalf("evicted providers must be skipped, got %d requests", calls)
+	}
+
+	gw.probeEvicted(context.Background(), "flaky")
+	if !gw.health.isEvicted("flaky") {
+		t.Fatal("a failed probe must keep the provider evicted")
+	}
+	down.Store(false)
+	gw.probeEvicted(context.Background(), "flaky")
+	if gw.health.isEvicted("flaky") {
+		t.Fatal("expected a passing probe to restore the provider")
+	}
+
+	seen := make(map[notify.EventType]int)
+	timeout := time.After(2 * time.Second)
+	for len(seen) < 2 {
+		select {
+		case event := <-events:
+			seen[event.Type]++
+		case <-timeout:
+			t.Fatalf("missing notifications, got %v", seen)
+		}
+	}
+	if seen[notify.EventProviderEvicted] != 1 || seen[notify.EventProviderRecovered] != 1 {
+		t.Fatalf("unexpected notifications %v", seen)
+	}
+}
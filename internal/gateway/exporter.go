@@ -0,0 +1,274 @@
+package gateway
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// exportedRequest is a provider attempt, or a request blocked before any, as
+// sent to the tracing backends.
+type exportedRequest struct {
+	record storage.UsageRecord
+	input  any
+	params map[string]any
+	output string
+	cost   *requestCost
+}
+
+// requestCost is the price of the tokens of a request in USD.
+type requestCost struct {
+	input  float64
+	output float64
+}
+
+// traceSink is a tracing backend.
+type traceSink interface {
+	name() string
+	send(ctx context.Context, batch []exportedRequest) error
+}
+
+// traceExporter sends requests to a backend in batches from a background
+// goroutine. Requests never wait for it: those that do not fit the queue are
+// dropped.
+type traceExporter struct {
+	sink      traceSink
+	queue     chan exportedRequest
+	batchSize int
+	interval  time.Duration
+}
+
+// newTraceExporters returns an exporter for every configured backend.
+func newTraceExporters(cfg *config.ExportersConfig) []*traceExporter {
+	if cfg == nil {
+		return nil
+	}
+	var sinks []traceSink
+	if cfg.Langfuse != nil {
+		sinks = append(sinks, newLangfuseSink(*cfg.Langfuse))
+	}
+	if cfg.LangSmith != nil {
+		sinks = append(sinks, newLangSmithSink(*cfg.LangSmith))
+	}
+
+	batchSize, queueSize := cfg.BatchSize, cfg.QueueSize
+	if batchSize <= 0 {
+		batchSize = 50
+	}
+	if queueSize <= 0 {
+		queueSize = 10000
+	}
+	interval := time.Duration(cfg.FlushIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	exporters := make([]*traceExporter, 0, len(sinks))
+	for _, sink := range sinks {
+		exporters = append(exporters, &traceExporter{
+			sink:      sink,
+			queue:     make(chan exportedRequest, queueSize),
+			batchSize: batchSize,
+			interval:  interval,
+		})
+	}
+	return exporters
+}
+
+func (e *traceExporter) enqueue(req exportedRequest) {
+	select {
+	case e.queue <- req:
+	default:
+		log.Warningf("%s export queue is full, dropping request %s", e.sink.name(), req.record.RequestID)
+	}
+}
+
+// run sends the queued requests whenever a batch is full or the flush
+// interval passed, until ctx is done; the requests still queued then are sent
+// last.
+func (e *traceExporter) run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	batch := make([]exportedRequest, 0, e.batchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.sink.send(ctx, batch); err != nil {
+			log.Warningf("export %d requests to %s: %v", len(batch), e.sink.name(), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			for {
+				select {
+				case req := <-e.queue:
+					if batch = append(batch, req); len(batch) >= e.batchSize {
+						flush(shutdownCtx)
+					}
+				default:
+					flush(shutdownCtx)
+					return
+				}
+			}
+		case req := <-e.queue:
+			if batch = append(batch, req); len(batch) >= e.batchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+// RunExporters sends the exported requests to the tracing backends until ctx
+// is done and the queued requests are sent.
+func (g *Gateway) RunExporters(ctx context.Context) {
+	if len(g.exporters) == 0 {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, exporter := range g.exporters {
+		log.Infof("%s export started: batch=%d, interval=%s", exporter.sink.name(), exporter.batchSize, exporter.interval)
+		wg.Add(1)
+		go func(e *traceExporter) {
+			defer wg.Done()
+			e.run(ctx)
+		}(exporter)
+	}
+	wg.Wait()
+}
+
+// traceContent is the prompt and latest completion of a request, kept in its
+// context until the usage record of each attempt is exported.
+type traceContent struct {
+	input  any
+	params map[string]any
+	output string
+}
+
+type traceContentKey struct{}
+
+func withTraceContent(ctx context.Context, content *traceContent) context.Context {
+	return context.WithValue(ctx, traceContentKey{}, content)
+}
+
+func traceContentFrom(ctx context.Context) *traceContent {
+	if ctx == nil {
+		return nil
+	}
+	content, _ := ctx.Value(traceContentKey{}).(*traceContent)
+	return content
+}
+
+// exportedParams are the request fields exported as model parameters.
+var exportedParams = []string{"temperature", "top_p", "max_tokens", "max_completion_tokens", "max_output_tokens", "stream", "reasoning_effort"}
+
+// newTraceContent extracts the prompt of a request body as stored in the
+// request logs, with the redacted paths and scrubbed personal data removed.
+func (g *Gateway) newTraceContent(path string, reqType RequestType, body []byte) *traceContent {
+	content := &traceContent{params: map[string]any{}}
+	for _, name := range exportedParams {
+		if value := gjson.GetBytes(body, name); value.Exists() {
+			content.params[name] = value.Value()
+		}
+	}
+	if g.cfg.Exporters.OmitContent {
+		return content
+	}
+	body = []byte(g.scrubber.scrub(path, string(redactPaths(body, g.cfg.LogRedactPaths))))
+	field := "messages"
+	if reqType == RequestTypeResponses {
+		field = "input"
+	}
+	if prompt := gjson.GetBytes(body, field); prompt.Exists() {
+		content.input = prompt.Value()
+	} else {
+		content.input = gjson.ParseBytes(body).Value()
+	}
+	return content
+}
+
+// setTraceOutput keeps the completion text of the response being recorded.
+func (g *Gateway) setTraceOutput(ctx context.Context, reqType RequestType, body []byte, stream bool) {
+	content := traceContentFrom(ctx)
+	if content == nil || g.cfg.Exporters.OmitContent {
+		return
+	}
+	texts, _ := extractResponseTexts(reqType, stream, body)
+	content.output = strings.Join(texts, "\n")
+}
+
+// exportTrace queues the request of a usage record for every tracing backend.
+func (g *Gateway) exportTrace(ctx context.Context, record storage.UsageRecord) {
+	if len(g.exporters) == 0 {
+		return
+	}
+	req := exportedRequest{record: record, cost: g.requestCost(record)}
+	if content := traceContentFrom(ctx); content != nil {
+		req.input, req.params, req.output = content.input, content.params, content.output
+		content.output = ""
+	}
+	for _, exporter := range g.exporters {
+		exporter.enqueue(req)
+	}
+}
+
+// requestCost prices the tokens of a record with the price of its provider
+// model, or else of the requested model.
+func (g *Gateway) requestCost(record storage.UsageRecord) *requestCost {
+	price, ok := g.priceOf(record.Provider, record.Model)
+	if !ok {
+		if price, ok = g.priceOf(record.Provider, record.OriginalModel); !ok {
+			return nil
+		}
+	}
+	return &requestCost{
+		input:  float64(record.RequestTokens) * price.Input / 1e6,
+		output: float64(record.ResponseTokens) * price.Output / 1e6,
+	}
+}
+
+// exportedModel is the model the client asked for.
+func exportedModel(record storage.UsageRecord) string {
+	if record.OriginalModel != "" {
+		return record.OriginalModel
+	}
+	return record.Model
+}
+
+// exportedMetadata describes how the gateway served a request.
+func exportedMetadata(record storage.UsageRecord) map[string]any {
+	metadata := map[string]any{
+		"request_id":  record.RequestID,
+		"provider":    record.Provider,
+		"outcome":     record.Outcome,
+		"status_code": record.StatusCode,
+		"attempt":     record.Attempt,
+		"path":        record.Path,
+	}
+	if record.Route != "" {
+		metadata["route"] = record.Route
+	}
+	if record.Tenant != "" {
+		metadata["tenant"] = record.Tenant
+	}
+	if record.Session != "" {
+		metadata["session"] = record.Session
+	}
+	if record.ProviderRequestID != "" {
+		metadata["provider_request_id"] = record.ProviderRequestID
+	}
+	return metadata
+}
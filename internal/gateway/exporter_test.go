@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func TestTraceContentOmitContent(t *testing.T) {
+	gw, err := New(&config.Config{Exporters: &config.ExportersConfig{OmitContent: true, Langfuse: &config.LangfuseConfig{PublicKey: "pk", SecretKey: "sk"}}}, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	content := gw.newTraceContent("/v1/chat/completions", RequestTypeChatCompletions, []byte(`{"messages":[{"role":"user","content":"secret"}],"max_tokens":5}`))
+	if content.input != nil || content.params["max_tokens"] != float64(5) {
+		t.Fatalf("unexpected trace content %+v", content)
+	}
+}
+
+type recordingSink struct {
+	batches chan []exportedRequest
+}
+
+func (s *recordingSink) name() string { return "recording" }
+
+func (s *recordingSink) send(_ context.Context, batch []exportedRequest) error {
+	s.batches <- append([]exportedRequest(nil), batch...)
+	return nil
+}
+
+func TestTraceExporterBatches(t *testing.T) {
+	sink := &recordingSink{batches: make(chan []exportedRequest, 4)}
+	exporter := &traceExporter{sink: sink, queue: make(chan exportedRequest, 3), batchSize: 2, interval: time.Hour}
+	for _, id := range []string{"r1", "r2", "r3", "r4"} {
+		exporter.enqueue(exportedRequest{record: storage.UsageRecord{RequestID: id}})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		exporter.run(ctx)
+	}()
+	if batch := <-sink.batches; len(batch) != 2 || batch[0].record.RequestID != "r1" {
+		t.Fatalf("unexpected full batch %+v", batch)
+	}
+	cancel()
+	<-done
+	// r4 did not fit the queue; r3 is sent on shutdown.
+	if batch := <-sink.batches; len(batch) != 1 || batch[0].record.RequestID != "r3" {
+		t.Fatalf("unexpected final batch %+v", batch)
+	}
+}
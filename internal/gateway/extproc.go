@@ -0,0 +1,441 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/apierror"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+)
+
+// extProcService is the gRPC service of api/extproc/v1/extproc.proto.
+const extProcService = "/gateway.extproc.v1.ExternalProcessor/"
+
+// extProcHiddenHeaders are the request headers not sent to the processor: the
+// gateway credentials of the caller.
+var extProcHiddenHeaders = map[string]bool{"authorization": true, "x-api-key": true}
+
+// extProcClient makes unary gRPC calls to the external processor over HTTP/2,
+// with the messages encoded by hand like the remote-write requests.
+type extProcClient struct {
+	address         string
+	headers         map[string]string
+	timeout         time.Duration
+	processResponse bool
+	failOpen        bool
+	client          *http.Client
+}
+
+func newExtProcClient(cfg *config.ExternalProcessorConfig) *extProcClient {
+	if cfg == nil {
+		return nil
+	}
+	var protocols http.Protocols
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return &extProcClient{
+		address:         strings.TrimRight(cfg.Address, "/"),
+		headers:         cfg.Headers,
+		timeout:         time.Duration(cfg.TimeoutMs) * time.Millisecond,
+		processResponse: cfg.ProcessResponse,
+		failOpen:        cfg.FailOpen,
+		client:          &http.Client{Transport: &http.Transport{Protocols: &protocols}},
+	}
+}
+
+// extProcMessage is a ProcessingRequest.
+type extProcMessage struct {
+	requestID  string
+	method     string
+	path       string
+	headers    http.Header
+	body       []byte
+	model      string
+	tenant     string
+	statusCode int
+}
+
+func (m extProcMessage) marshal() []byte {
+	var out []byte
+	out = appendProtoString(out, 1, m.requestID)
+	out = appendProtoString(out, 2, m.method)
+	out = appendProtoString(out, 3, m.path)
+	out = appendProtoHeaders(out, 4, m.headers)
+	if len(m.body) > 0 {
+		out = appendProtoBytes(out, 5, m.body)
+	}
+	out = appendProtoString(out, 6, m.model)
+	out = appendProtoString(out, 7, m.tenant)
+	if m.statusCode != 0 {
+		out = binary.AppendUvarint(out, 8<<3)
+		out = binary.AppendUvarint(out, uint64(m.statusCode))
+	}
+	return out
+}
+
+// extProcResult is a ProcessingResponse.
+type extProcResult struct {
+	setHeaders    [][2]string
+	removeHeaders []string
+	body          []byte
+	replaceBody   bool
+	immediate     *extProcImmediate
+}
+
+// extProcImmediate is an ImmediateResponse.
+type extProcImmediate struct {
+	statusCode int
+	body       []byte
+	headers    [][2]string
+}
+
+func parseExtProcResult(data []byte) (*extProcResult, error) {
+	result := &extProcResult{}
+	err := protoFields(data, func(field int, num uint64, value []byte) error {
+		switch field {
+		case 1:
+			header, err := parseProtoHeader(value)
+			if err != nil {
+				return err
+			}
+			result.setHeaders = append(result.setHeaders, header)
+		case 2:
+			result.removeHeaders = append(result.removeHeaders, string(value))
+		case 3:
+			result.body = value
+		case 4:
+			result.replaceBody = num != 0
+		case 5:
+			immediate := &extProcImmediate{}
+			if err := protoFields(value, func(field int, num uint64, value []byte) error {
+				switch field {
+				case 1:
+					immediate.statusCode = int(num)
+				case 2:
+					immediate.body = value
+				case 3:
+					header, err := parseProtoHeader(value)
+					if err != nil {
+						return err
+					}
+					immediate.headers = append(immediate.headers, header)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if immediate.statusCode == 0 {
+				immediate.statusCode = http.StatusForbidden
+			}
+			result.immediate = immediate
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decode processing response: %w", err)
+	}
+	return result, nil
+}
+
+// applyHeaders applies the header mutations of the result to header.
+func (r *extProcResult) applyHeaders(header http.Header) {
+	for _, name := range r.removeHeaders {
+		header.Del(name)
+	}
+	for _, h := range r.setHeaders {
+		header.Set(h[0], h[1])
+	}
+}
+
+// call sends a message to a method of the processor and returns its answer.
+func (c *extProcClient) call(ctx context.Context, method string, msg extProcMessage) (*extProcResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	payload := msg.marshal()
+	frame := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	frame = append(frame, payload...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.address+extProcService+method, bytes.NewReader(frame))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("Grpc-Timeout", strconv.FormatInt(c.timeout.Milliseconds(), 10)+"m")
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("processor returned HTTP status %d", resp.StatusCode)
+	}
+	// Trailers-only responses, as sent for errors, carry the status among the
+	// headers.
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		if message, err := url.PathUnescape(message); err == nil && message != "" {
+			return nil, fmt.Errorf("processor returned grpc status %s: %s", status, message)
+		}
+		return nil, fmt.Errorf("processor returned grpc status %q", status)
+	}
+	if len(body) < 5 {
+		return nil, errors.New("processor returned no message")
+	}
+	if body[0] != 0 {
+		return nil, errors.New("processor returned a compressed message")
+	}
+	size := binary.BigEndian.Uint32(body[1:5])
+	if uint32(len(body)-5) < size {
+		return nil, errors.New("processor returned a truncated message")
+	}
+	return parseExtProcResult(body[5 : 5+size])
+}
+
+// processRequest sends a request to the external processor and returns the
+// body to proxy. When the request must not be proxied, the response has been
+// written and ok is false.
+func (g *Gateway) processRequest(w http.ResponseWriter, r *http.Request, requestID string, body []byte) ([]byte, bool) {
+	if g.extProc == nil {
+		return body, true
+	}
+	identity, _ := internalmw.IdentityFromContext(r.Context())
+	headers := make(http.Header, len(r.Header))
+	for k, values := range r.Header {
+		if !extProcHiddenHeaders[strings.ToLower(k)] {
+			headers[k] = values
+		}
+	}
+	model := gjson.GetBytes(body, "model").String()
+	result, err := g.extProc.call(r.Context(), "ProcessRequest", extProcMessage{
+		requestID: requestID,
+		method:    r.Method,
+		path:      r.URL.Path,
+		headers:   headers,
+		body:      body,
+		model:     model,
+		tenant:    identity.Tenant,
+	})
+	if err != nil {
+		if g.extProc.failOpen {
+			internalmw.Logger(r.Context()).Warningf("external processor failed, request continues unchanged: %v", err)
+			return body, true
+		}
+		apierror.Write(w, r, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, fmt.Sprintf("external processor: %v", err))
+		return nil, false
+	}
+	if result.immediate != nil {
+		if rec := g.prepareUsageRecord(r.Context(), "", model, model, r.URL.Path, requestID, 0, result.immediate.statusCode, 1); rec != nil {
+			rec.Outcome = "blocked"
+			rec.Error = "rejected by the external processor"
+			g.saveUsageRecord(r.Context(), *rec)
+		}
+		writeExtProcImmediate(w, result.immediate)
+		return nil, false
+	}
+	result.applyHeaders(r.Header)
+	if result.replaceBody {
+		return result.body, true
+	}
+	return body, true
+}
+
+// processResponse sends the buffered response to the external processor and
+// writes the processed response to the client.
+func (g *Gateway) processResponse(buffered *bufferedResponse, r *http.Request, requestID, model string) {
+	identity, _ := internalmw.IdentityFromContext(r.Context())
+	status := buffered.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	result, err := g.extProc.call(r.Context(), "ProcessResponse", extProcMessage{
+		requestID:  requestID,
+		method:     r.Method,
+		path:       r.URL.Path,
+		headers:    buffered.header,
+		body:       buffered.body.Bytes(),
+		model:      model,
+		tenant:     identity.Tenant,
+		statusCode: status,
+	})
+	w := buffered.target
+	if err != nil {
+		if !g.extProc.failOpen {
+			apierror.Write(w, r, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, fmt.Sprintf("external processor: %v", err))
+			return
+		}
+		internalmw.Logger(r.Context()).Warningf("external processor failed, response is sent unchanged: %v", err)
+		result = &extProcResult{}
+	}
+	if result.immediate != nil {
+		writeExtProcImmediate(w, result.immediate)
+		return
+	}
+
+	body := buffered.body.Bytes()
+	result.applyHeaders(buffered.header)
+	if result.replaceBody {
+		body = result.body
+		buffered.header.Del("Content-Length")
+	}
+	for k, values := range buffered.header {
+		w.Header()[k] = values
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func writeExtProcImmediate(w http.ResponseWriter, immediate *extProcImmediate) {
+	for _, h := range immediate.headers {
+		w.Header().Set(h[0], h[1])
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(immediate.statusCode)
+	_, _ = w.Write(immediate.body)
+}
+
+// bufferedResponse holds a response until the external processor has seen
+// it. It is only used for non-streaming responses, so flushes are ignored.
+type bufferedResponse struct {
+	target http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse(target http.ResponseWriter) *bufferedResponse {
+	return &bufferedResponse{target: target, header: make(http.Header)}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) Flush() {}
+
+func appendProtoString(b []byte, field int, value string) []byte {
+	if value == "" {
+		return b
+	}
+	return appendProtoBytes(b, field, []byte(value))
+}
+
+// appendProtoHeaders appends the headers as Header messages, sorted by name.
+func appendProtoHeaders(b []byte, field int, headers http.Header) []byte {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range headers[name] {
+			var header []byte
+			header = appendProtoString(header, 1, strings.ToLower(name))
+			header = appendProtoString(header, 2, value)
+			b = appendProtoBytes(b, field, header)
+		}
+	}
+	return b
+}
+
+func parseProtoHeader(data []byte) ([2]string, error) {
+	var header [2]string
+	err := protoFields(data, func(field int, _ uint64, value []byte) error {
+		if field == 1 || field == 2 {
+			header[field-1] = string(value)
+		}
+		return nil
+	})
+	if err == nil && header[0] == "" {
+		err = errors.New("header without a key")
+	}
+	return header, err
+}
+
+// protoFields calls fn with each field of a protobuf message: num holds the
+// value of varint fields and value the content of length-delimited ones.
+// Fixed size fields are skipped.
+func protoFields(data []byte, fn func(field int, num uint64, value []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("invalid field key")
+		}
+		data = data[n:]
+		field := int(key >> 3)
+		var num uint64
+		var value []byte
+		switch key & 7 {
+		case 0:
+			if num, n = binary.Uvarint(data); n <= 0 {
+				return errors.New("invalid varint")
+			}
+			data = data[n:]
+		case 1, 5:
+			size := 8
+			if key&7 == 5 {
+				size = 4
+			}
+			if len(data) < size {
+				return errors.New("truncated fixed field")
+			}
+			data = data[size:]
+			continue
+		case 2:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return errors.New("truncated field")
+			}
+			value = data[n : n+int(size)]
+			data = data[n+int(size):]
+		default:
+			return fmt.Errorf("unsupported wire type %d", key&7)
+		}
+		if err := fn(field, num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// newTestExtProc starts a cleartext HTTP/2 gRPC server whose methods answer
+// with the ProcessingResponse built by handle.
+func newTestExtProc(t *testing.T, handle func(method string, headers map[string]string, body []byte) []byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		frame, _ := io.ReadAll(r.Body)
+		if r.ProtoMajor != 2 || len(frame) < 5 || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("unexpected call %s %s with %d bytes", r.Proto, r.Header.Get("Content-Type"), len(frame))
+			return
+		}
+		headers := map[string]string{}
+		var body []byte
+		_ = protoFields(frame[5:], func(field int, _ uint64, value []byte) error {
+			switch field {
+			case 4:
+				header, _ := parseProtoHeader(value)
+				headers[header[0]] = header[1]
+			case 5:
+				body = value
+			}
+			return nil
+		})
+		payload := handle(strings.TrimPrefix(r.URL.Path, extProcService), headers, body)
+		out := make([]byte, 5, 5+len(payload))
+		binary.BigEndian.PutUint32(out[1:], uint32(len(payload)))
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		_, _ = w.Write(append(out, payload...))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProxyAppliesExternalProcessorMutations(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get("X-Policy"); got != "checked" {
+			t.Errorf("unexpected policy header %q", got)
+		}
+		if !bytes.Contains(body, []byte(`"content":"rewritten"`)) {
+			t.Errorf("request body was not replaced: %s", body)
+		}
+		_, _ = io.WriteString(w, `{"id":"chatcmpl-1","choices":[{"message":{"content":"secret plan"}}]}`)
+	}))
+	t.Cleanup(provider.Close)
+
+	processor := newTestExtProc(t, func(method string, headers map[string]string, body []byte) []byte {
+		var out []byte
+		switch method {
+		case "ProcessRequest":
+			if _, ok := headers["authorization"]; ok {
+				t.Error("gateway credentials were sent to the processor")
+			}
+			if bytes.Contains(body, []byte("forbidden")) {
+				var immediate []byte
+				immediate = binary.AppendUvarint(immediate, 1<<3)
+				immediate = binary.AppendUvarint(immediate, http.StatusUnavailableForLegalReasons)
+				immediate = appendProtoString(immediate, 2, "not allowed")
+				return appendProtoBytes(out, 5, immediate)
+			}
+			var header []byte
+			header = appendProtoString(header, 1, "x-policy")
+			header = appendProtoString(header, 2, "checked")
+			out = appendProtoBytes(out, 1, header)
+			out = appendProtoString(out, 3, `{"model":"gpt-4o","messages":[{"role":"user","content":"rewritten"}]}`)
+		case "ProcessResponse":
+			out = appendProtoString(out, 3, strings.ReplaceAll(string(body), "secret plan", "[removed]"))
+		}
+		out = binary.AppendUvarint(out, 4<<3)
+		return binary.AppendUvarint(out, 1)
+	})
+
+	cfg := &config.Config{
+		Providers:         []config.ProviderConfig{{ID: "openai", BaseURL: provider.URL, AccessToken: "token"}},
+		Models:            []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "openai"}}}},
+		ExternalProcessor: &config.ExternalProcessorConfig{Address: processor.URL, ProcessResponse: true, TimeoutMs: 5000},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`))
+	req.Header.Set("Authorization", "Bearer sk-client")
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	if body := rec.Body.String(); strings.Contains(body, "secret plan") || !strings.Contains(body, "[removed]") {
+		t.Fatalf("response body was not processed: %s", body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"forbidden"}]}`))
+	rec = httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+	if rec.Code != http.StatusUnavailableForLegalReasons || rec.Body.String() != "not allowed" {
+		t.Fatalf("unexpected immediate response %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProxyExternalProcessorFailure(t *testing.T) {
+	cfg := &config.Config{
+		Providers:         []config.ProviderConfig{{ID: "openai", BaseURL: "http://127.0.0.1:1", AccessToken: "token"}},
+		Models:            []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "openai"}}}},
+		ExternalProcessor: &config.ExternalProcessorConfig{Address: "http://127.0.0.1:1", TimeoutMs: 1000},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[]}`))
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -2,7 +2,6 @@ package gateway
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
@@ -12,6 +11,8 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/expr-lang/expr"
@@ -22,7 +23,10 @@ import (
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/apierror"
 	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/notify"
 	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
 )
 
@@ -39,25 +43,72 @@ type Gateway struct {
 	providers       map[string]config.ProviderConfig
 	models          map[string]*modelRoute
 	httpClient      *http.Client
+	providerClients map[string]*http.Client
 	modelList       []ModelInfo
 	defaultProvider *config.ProviderConfig
 	usageStore      storage.Store
-	aliases         map[string]string
+	aliases         map[string]config.AliasConfig
+	groups          map[string]config.GroupConfig
+	unavailable     *unavailableModels
+	discoveredMu    sync.RWMutex
+	discovered      map[string][]ruleProvider
+	tenantsMu       sync.RWMutex
+	tenants         map[string]*tenantRoute
+	budgets         *budgetTracker
+	keyBudgets      map[string]config.BudgetConfig
+	limiter         *rateLimiter
+	health          *providerHealth
+	errorRates      *errorRateWindow
+	anomalies       *anomalyDetector
+	alerts          *alertEngine
+	slos            *sloTracker
+	notifier        *notify.Dispatcher
+	scrubber        *piiScrubber
+	inspector       *promptInspector
+	secrets         *secretScanner
+	feed            *usageFeed
+	exporters       []*traceExporter
+	metrics         *usageMetrics
+	metricSinks     []metricsSink
+	live            *liveStats
+	warmups         warmupResults
+	checks          healthChecks
+	prices          syncedPrices
+	priceTable      map[ruleProvider]config.ModelPrice
+	callbacks       *callbackSender
+	extProc         *extProcClient
+	now             func() time.Time
+}
+
+type tenantRoute struct {
+	config    config.TenantConfig
+	overrides map[string][]ruleProvider
 }
 
 type modelRoute struct {
 	config config.ModelConfig
 	rules  []compiledRule
+	// balancer spreads requests over weighted providers; nil without weights
+	balancer *weightedBalancer
+	// selections counts the requests ordered by the lowest_latency strategy
+	selections atomic.Uint64
+	// rotation rotates the first provider when no rule matches; nil without round_robin
+	rotation *roundRobin
 }
 
 type compiledRule struct {
-	program   *vm.Program
-	providers []ruleProvider
+	expression string
+	program    *vm.Program
+	providers  []ruleProvider
+	// rotation rotates the first provider of the rule; nil without round_robin
+	rotation *roundRobin
 }
 
 type ruleProvider struct {
 	id    string
 	model string
+	// member is the group model the candidate was resolved from
+	member string
 }
 
 type ModelInfo struct {
@@ -65,6 +116,8 @@ type ModelInfo struct {
 	Object  string `json:"object"`
 	Created int64  `json:"created"`
 	OwnedBy string `json:"owned_by"`
+	// Discovered marks models registered from the providers' model lists
+	Discovered bool `json:"discovered,omitempty"`
 }
 
 type ModelListResponse struct {
@@ -76,21 +129,100 @@ type EvalEnv struct {
 	TokenCount int
 	Model      string
 	Path       string
+	// Hour (0-23), Weekday (0 is Sunday) and Date (2006-01-02) are the local time of the request
+	Hour    int
+	Weekday int
+	Date    string
+	live    *liveStats
+	// cost estimates the cost of the request on a provider
+	cost func(provider string) (float64, bool)
 }
 
 func New(cfg *config.Config, usageStore storage.Store) (*Gateway, error) {
 	gw := &Gateway{
-		cfg:        cfg,
-		providers:  make(map[string]config.ProviderConfig),
-		models:     make(map[string]*modelRoute),
-		httpClient: &http.Client{Timeout: 30 * time.Minute},
-		usageStore: usageStore,
-		aliases:    make(map[string]string),
+		cfg:         cfg,
+		providers:   make(map[string]config.ProviderConfig),
+		models:      make(map[string]*modelRoute),
+		httpClient:  &http.Client{Timeout: 30 * time.Minute},
+		usageStore:  usageStore,
+		aliases:     make(map[string]config.AliasConfig),
+		groups:      make(map[string]config.GroupConfig),
+		tenants:     make(map[string]*tenantRoute),
+		budgets:     newBudgetTracker(usageStore),
+		limiter:     newRateLimiter(),
+		health:      newProviderHealth(cfg.ProviderUnhealthyThreshold),
+		slos:        newSLOTracker(cfg.Providers),
+		live:        newLiveStats(),
+		now:         time.Now,
+		unavailable: newUnavailableModels(time.Duration(cfg.ModelUnavailableTTLSeconds) * time.Second),
+		scrubber:    newPIIScrubber(cfg.PIIScrubbing),
+		inspector:   newPromptInspector(cfg.PromptInspection),
+		secrets:     newSecretScanner(cfg.SecretDetection),
+		feed:        newUsageFeed(),
+		exporters:   newTraceExporters(cfg.Exporters),
+		callbacks:   newCallbackSender(cfg),
+		extProc:     newExtProcClient(cfg.ExternalProcessor),
+	}
+
+	notifier, err := notify.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	gw.notifier = notifier
+	if alertStore, ok := usageStore.(storage.AlertStore); ok {
+		notifier.OnPublish(func(event notify.Event) { recordAlert(alertStore, event) })
+	}
+	gw.priceTable = make(map[ruleProvider]config.ModelPrice)
+	if cfg.Pricing != nil {
+		for _, p := range cfg.Pricing.Prices {
+			key := ruleProvider{id: p.Provider, model: p.Model}
+			if _, ok := gw.priceTable[key]; !ok {
+				gw.priceTable[key] = config.ModelPrice{Input: p.Input, Output: p.Output}
+			}
+		}
+	}
+	gw.budgets.cost = gw.tokenCost
+	for _, k := range cfg.Keys {
+		if k.Budget == nil {
+			continue
+		}
+		if gw.keyBudgets == nil {
+			gw.keyBudgets = make(map[string]config.BudgetConfig)
+		}
+		gw.keyBudgets[keyDigest(k.Key)] = *k.Budget
+	}
+	if cfg.ErrorRateAlert != nil {
+		gw.errorRates = newErrorRateWindow(time.Duration(cfg.ErrorRateAlert.WindowSeconds) * time.Second)
+	}
+	if cfg.AnomalyDetection != nil {
+		gw.anomalies = newAnomalyDetector(time.Duration(cfg.AnomalyDetection.BaselineHours) * time.Hour)
+	}
+	gw.metricSinks = append(gw.metricSinks, gw.live)
+	if gw.anomalies != nil {
+		gw.metricSinks = append(gw.metricSinks, sinkFunc(gw.observeSpend))
+	}
+	if gw.slos != nil {
+		gw.metricSinks = append(gw.metricSinks, sinkFunc(gw.observeLatency))
+	}
+	if cfg.MetricsPush != nil {
+		gw.metrics = newUsageMetrics()
+		gw.metricSinks = append(gw.metricSinks, gw.metrics)
+	}
+	if cfg.StatsD != nil {
+		gw.metricSinks = append(gw.metricSinks, newStatsDSink(*cfg.StatsD))
+	}
+	if len(cfg.Alerts) > 0 {
+		if gw.alerts, err = newAlertEngine(cfg.Alerts); err != nil {
+			return nil, err
+		}
 	}
 
 	for _, p := range cfg.Providers {
 		gw.providers[p.ID] = p
 	}
+	if gw.providerClients, err = newProviderClients(cfg.Providers, gw.httpClient); err != nil {
+		return nil, err
+	}
 
 	if cfg.Default != "" {
 		if provider, ok := gw.providers[cfg.Default]; ok {
@@ -101,7 +233,7 @@ func New(cfg *config.Config, usageStore storage.Store) (*Gateway, error) {
 
 	created := time.Now().Unix()
 	for _, m := range cfg.Models {
-		mr := &modelRoute{config: m}
+		mr := &modelRoute{config: m, balancer: newWeightedBalancer(m.Providers), rotation: newRoundRobin(m.Rotation)}
 		for _, r := range m.Rules {
 			program, err := expr.Compile(r.Expression, expr.Env(EvalEnv{}), expr.AsBool())
 			if err != nil {
@@ -111,7 +243,7 @@ func New(cfg *config.Config, usageStore storage.Store) (*Gateway, error) {
 			for _, override := range r.Providers {
 				providers = append(providers, ruleProvider{id: override.Provider, model: override.Model})
 			}
-			mr.rules = append(mr.rules, compiledRule{program: program, providers: providers})
+			mr.rules = append(mr.rules, compiledRule{expression: r.Expression, program: program, providers: providers, rotation: newRoundRobin(r.Rotation)})
 		}
 		gw.models[m.Name] = mr
 		gw.modelList = append(gw.modelList, ModelInfo{
@@ -122,7 +254,7 @@ func New(cfg *config.Config, usageStore storage.Store) (*Gateway, error) {
 		})
 	}
 	for _, alias := range cfg.Alias {
-		gw.aliases[alias.Model] = alias.Target
+		gw.aliases[alias.Model] = alias
 		gw.modelList = append(gw.modelList, ModelInfo{
 			ID:      alias.Model,
 			Object:  "model",
@@ -130,14 +262,113 @@ func New(cfg *config.Config, usageStore storage.Store) (*Gateway, error) {
 			OwnedBy: "openai-cost-optimal-gateway",
 		})
 	}
+	for _, group := range cfg.Groups {
+		gw.groups[group.Name] = group
+		gw.modelList = append(gw.modelList, ModelInfo{
+			ID:      group.Name,
+			Object:  "model",
+			Created: created,
+			OwnedBy: "openai-cost-optimal-gateway",
+		})
+	}
+	for _, t := range cfg.Tenants {
+		gw.tenants[t.ID] = newTenantRoute(t)
+	}
 
 	return gw, nil
 }
 
-func (g *Gateway) ModelList() ModelListResponse {
+func newTenantRoute(t config.TenantConfig) *tenantRoute {
+	tr := &tenantRoute{config: t, overrides: make(map[string][]ruleProvider)}
+	for _, override := range t.Overrides {
+		providers := make([]ruleProvider, 0, len(override.Providers))
+		for _, p := range override.Providers {
+			providers = append(providers, ruleProvider{id: p.ID, model: p.Model})
+		}
+		tr.overrides[override.Model] = providers
+	}
+	return tr
+}
+
+// AddTenant starts routing requests of a tenant created after startup.
+func (g *Gateway) AddTenant(t config.TenantConfig) {
+	g.tenantsMu.Lock()
+	defer g.tenantsMu.Unlock()
+	g.tenants[t.ID] = newTenantRoute(t)
+}
+
+// Notifier returns the dispatcher alerts are published through, so other
+// components can deliver their events to the same destinations.
+func (g *Gateway) Notifier() *notify.Dispatcher {
+	return g.notifier
+}
+
+func (g *Gateway) tenant(id string) *tenantRoute {
+	if id == "" {
+		return nil
+	}
+	g.tenantsMu.RLock()
+	defer g.tenantsMu.RUnlock()
+	return g.tenants[id]
+}
+
+// tenantFor returns the routing state of the tenant that owns the request, or nil.
+func (g *Gateway) tenantFor(ctx context.Context) *tenantRoute {
+	identity, ok := internalmw.IdentityFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return g.tenant(identity.Tenant)
+}
+
+func (t *tenantRoute) overrideFor(model string) []ruleProvider {
+	if t == nil {
+		return nil
+	}
+	return t.overrides[model]
+}
+
+// allowsModel reports whether the tenant, if any, may request the model.
+func (t *tenantRoute) allowsModel(model string) bool {
+	return t == nil || t.config.AllowsModel(model)
+}
+
+// ModelList returns the models visible to the caller. Tenant keys only see the
+// models their tenant is allowed to request, plus models routed by tenant overrides.
+func (g *Gateway) ModelList(ctx context.Context) ModelListResponse {
+	tenant := g.tenantFor(ctx)
+	visible := tenant.allowsModel
+
 	data := make([]ModelInfo, 0, len(g.modelList))
 	seen := make(map[string]struct{}, len(g.modelList))
 	for _, model := range g.modelList {
+		if !visible(model.ID) {
+			continue
+		}
+		data = append(data, model)
+		seen[model.ID] = struct{}{}
+	}
+
+	if tenant != nil {
+		created := time.Now().Unix()
+		for _, override := range tenant.config.Overrides {
+			if _, ok := seen[override.Model]; ok || !visible(override.Model) {
+				continue
+			}
+			data = append(data, ModelInfo{
+				ID:      override.Model,
+				Object:  "model",
+				Created: created,
+				OwnedBy: "openai-cost-optimal-gateway",
+			})
+			seen[override.Model] = struct{}{}
+		}
+	}
+
+	for _, model := range g.discoveredModelList() {
+		if _, ok := seen[model.ID]; ok || !visible(model.ID) {
+			continue
+		}
 		data = append(data, model)
 		seen[model.ID] = struct{}{}
 	}
@@ -147,7 +378,7 @@ func (g *Gateway) ModelList() ModelListResponse {
 			log.Errorf("fetch default provider models: %v", err)
 		} else {
 			for _, model := range models {
-				if _, ok := seen[model.ID]; ok {
+				if _, ok := seen[model.ID]; ok || !visible(model.ID) {
 					continue
 				}
 				data = append(data, model)
@@ -165,92 +396,266 @@ func (g *Gateway) ModelList() ModelListResponse {
 func (g *Gateway) Proxy(w http.ResponseWriter, r *http.Request, reqType RequestType) {
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("read request body: %v", err), http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, fmt.Sprintf("read request body: %v", err))
 		return
 	}
 	_ = r.Body.Close()
 
+	// The server assigns request ids; direct callers of Proxy get one here.
+	requestID, ok := internalmw.RequestIDFromContext(r.Context())
+	if !ok {
+		requestID = strings.TrimSpace(r.Header.Get(internalmw.RequestIDHeader))
+		if requestID == "" {
+			requestID = uuid.NewString()
+		}
+		r = r.WithContext(internalmw.WithRequestID(r.Context(), requestID))
+		w = withResponseHeader(w, internalmw.RequestIDHeader, requestID)
+	}
+	logger := internalmw.Logger(r.Context())
+	bodyBytes, ok = g.processRequest(w, r, requestID, bodyBytes)
+	if !ok {
+		return
+	}
+
 	normalized, changed, err := normalizeRequestBody(bodyBytes, reqType)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("normalize request body: %v", err), http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, fmt.Sprintf("normalize request body: %v", err))
 		return
 	}
 	if changed {
 		bodyBytes = normalized
 	}
 
-	if log.DebugEnabled() {
-		log.Debug("request body: ", string(bodyBytes))
-	}
+	g.debugRequest(r, bodyBytes)
 
 	modelName := gjson.GetBytes(bodyBytes, "model").String()
 	if modelName == "" {
-		http.Error(w, "model is required", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "model is required")
+		return
+	}
+	requestedModel := modelName
+	if session := sessionOf(r, bodyBytes); session != "" {
+		r = r.WithContext(withSession(r.Context(), session))
+	}
+
+	timeout, err := g.requestTimeout(r)
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+	if timeout > 0 {
+		r = r.WithContext(withRequestTimeout(r.Context(), timeout))
+	}
+
+	callbackURL, err := g.callbacks.callbackURL(r)
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+	if callbackURL != "" {
+		completion := newRequestCompletion(r.Context(), callbackURL, requestID, requestedModel)
+		recorder := &statusRecorder{ResponseWriter: w}
+		w = recorder
+		r = r.WithContext(withRequestCompletion(r.Context(), completion))
+		defer func() {
+			go g.callbacks.deliver(completion.url, completion.finish(recorder.status))
+		}()
+	}
+	if g.extProc != nil && g.extProc.processResponse && !gjson.GetBytes(bodyBytes, "stream").Bool() {
+		buffered := newBufferedResponse(w)
+		w = buffered
+		defer g.processResponse(buffered, r, requestID, requestedModel)
+	}
+
+	if replacement, ok := g.cfg.Deprecations[modelName]; ok {
+		logger.Debugf("deprecated model: %s -> %s", modelName, replacement)
+		w = withResponseHeader(w, deprecationHeader, modelName+" -> "+replacement)
+		modelName = replacement
+		bodyBytes, err = sjson.SetBytes(bodyBytes, "model", modelName)
+		if err != nil {
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, fmt.Sprintf("update model in request body: %v", err))
+			return
+		}
+	}
+
+	tenant := g.tenantFor(r.Context())
+	if !tenant.allowsModel(modelName) {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CodeModelNotAllowed, fmt.Sprintf("model %s is not available for this api key", modelName))
+		return
+	}
+	if err := g.checkRateLimits(r.Context(), tenant); err != nil {
+		var limited *errRateLimited
+		if errors.As(err, &limited) {
+			w.Header().Set("Retry-After", limited.retryAfterSeconds())
+		}
+		apierror.Write(w, r, http.StatusTooManyRequests, apierror.CodeRateLimitExceeded, err.Error())
+		return
+	}
+	if err := g.checkBudgets(r.Context(), tenant); err != nil {
+		g.notifyBudgetExceeded(tenant, err)
+		apierror.Write(w, r, http.StatusTooManyRequests, apierror.CodeBudgetExceeded, err.Error())
 		return
 	}
 
-	if target, ok := g.aliases[modelName]; ok {
-		if log.DebugEnabled() {
-			log.Debugf("alias match: %s -> %s", modelName, target)
+	if alias, ok := g.aliases[modelName]; ok {
+		if logger.DebugEnabled() {
+			logger.Debugf("alias match: %s -> %s", modelName, alias.Target)
 		}
-		modelName = target
+		modelName = alias.Target
 		// We need to update the model in the request body so that the provider knows the correct model
-		bodyBytes, err = sjson.SetBytes(bodyBytes, "model", modelName)
+		bodyBytes, err = applyAlias(bodyBytes, alias)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("update model in request body: %v", err), http.StatusInternalServerError)
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, fmt.Sprintf("apply alias %s: %v", alias.Model, err))
 			return
 		}
 	}
+	bodyBytes, err = injectUserID(bodyBytes, reqType, g.upstreamUserID(r.Context()))
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, fmt.Sprintf("set user in request body: %v", err))
+		return
+	}
 
 	tokenCount := CountTokens(modelName, reqType, bodyBytes)
-	requestID := strings.TrimSpace(r.Header.Get("X-Request-ID"))
-	if requestID == "" {
-		requestID = uuid.NewString()
+
+	logTags := make(map[string]string)
+	bodyBytes, loggedBody, secrets, secretErr := g.secrets.scan(bodyBytes)
+	if secrets != nil {
+		logger.Warningf("[%s] request contains credentials: %s", modelName, strings.Join(secrets, ", "))
+		logTags["secrets"] = strings.Join(secrets, ",")
+	}
+	found, inspectErr := g.inspectPrompt(r.Context(), modelName, bodyBytes)
+	if found != nil {
+		logger.Warningf("[%s] request flagged by prompt inspection: %s", modelName, found)
+		logTags["inspection"] = found.String()
+	}
+	if len(logTags) == 0 {
+		logTags = nil
+	}
+	g.saveRequestLog(r.Context(), r, loggedBody, requestID, logTags)
+	if g.sampleResponseLog() {
+		r = r.WithContext(withResponseLog(r.Context()))
+	}
+	if len(g.exporters) > 0 {
+		r = r.WithContext(withTraceContent(r.Context(), g.newTraceContent(r.URL.Path, reqType, loggedBody)))
+	}
+	if secretErr != nil {
+		if rec := g.prepareUsageRecord(r.Context(), "", modelName, modelName, r.URL.Path, requestID, 0, http.StatusBadRequest, 1); rec != nil {
+			rec.Outcome = "blocked"
+			rec.Error = secretErr.Error()
+			g.saveUsageRecord(r.Context(), *rec)
+		}
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeContentBlocked, secretErr.Error())
+		return
+	}
+	if inspectErr != nil {
+		if rec := g.prepareUsageRecord(r.Context(), "", modelName, modelName, r.URL.Path, requestID, 0, http.StatusBadRequest, 1); rec != nil {
+			rec.Outcome = "blocked"
+			rec.Error = inspectErr.Error() + ": " + found.String()
+			g.saveUsageRecord(r.Context(), *rec)
+		}
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeContentBlocked, inspectErr.Error())
+		return
+	}
+
+	verdict, err := g.moderate(r.Context(), bodyBytes)
+	if verdict != "" {
+		r = r.WithContext(withModeration(r.Context(), verdict))
+	}
+	if err != nil {
+		status, code := http.StatusServiceUnavailable, apierror.CodeServiceUnavailable
+		var blocked *errModerationBlocked
+		if errors.As(err, &blocked) {
+			status, code = http.StatusBadRequest, apierror.CodeContentBlocked
+		}
+		// Nothing was sent to a provider, so the prompt is not counted.
+		if rec := g.prepareUsageRecord(r.Context(), "", modelName, modelName, r.URL.Path, requestID, 0, status, 1); rec != nil {
+			rec.Outcome = "blocked"
+			rec.Error = err.Error()
+			g.saveUsageRecord(r.Context(), *rec)
+		}
+		apierror.Write(w, r, status, code, err.Error())
+		return
 	}
 
-	g.saveRequestLog(r.Context(), r, bodyBytes, requestID)
+	if g.cfg.RewriteResponseModel || g.cfg.AnonymizeProviders {
+		r = r.WithContext(withResponseRewrite(r.Context(), responseRewrite{
+			model:     requestedModel,
+			id:        "chatcmpl-" + strings.ReplaceAll(requestID, "-", ""),
+			normalize: g.cfg.AnonymizeProviders,
+		}))
+	}
+	if g.wantsStreamUsage(reqType, bodyBytes) {
+		r = r.WithContext(withStreamUsage(r.Context()))
+	}
 
 	route, ok := g.models[modelName]
-	if !ok {
-		if g.defaultProvider != nil {
-			stream := gjson.GetBytes(bodyBytes, "stream").Bool()
-			record, fwdErr := g.forwardRequest(w, r, *g.defaultProvider, modelName, bodyBytes, tokenCount, r.URL.Path, stream, reqType, 1, requestID, modelName)
-			if record != nil {
-				g.saveUsageRecord(r.Context(), *record)
-			}
-			if fwdErr != nil {
-				log.Errorf("forward to default provider: %v", fwdErr)
-				status := http.StatusBadGateway
-				if errors.Is(fwdErr, errShouldRetry) {
-					http.Error(w, fwdErr.Error(), status)
-				} else {
-					http.Error(w, fmt.Sprintf("forward to default provider: %v", fwdErr), status)
-				}
-				return
-			}
-			return
-		}
-		http.Error(w, fmt.Sprintf("model %s not configured", modelName), http.StatusNotFound)
+	overrides := tenant.overrideFor(modelName)
+	group, isGroup := g.groups[modelName]
+	var discovered []ruleProvider
+	if !ok && overrides == nil && !isGroup {
+		discovered = g.discoveredProviders(modelName)
+	}
+	if discovered != nil {
+		r = r.WithContext(withRoute(r.Context(), RouteDiscovered))
+	}
+	useDefault := !ok && overrides == nil && !isGroup && discovered == nil
+	if useDefault && g.defaultProvider == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeModelNotFound, fmt.Sprintf("model %s not configured", modelName))
 		return
 	}
 
-	candidates := g.selectProviders(route, modelName, tokenCount, r.URL.Path)
+	needs := detectNeeds(bodyBytes, tokenCount)
+	candidates := overrides
+	var unsupported []string
+	switch {
+	case candidates != nil:
+		candidates, unsupported = g.filterCapable(modelName, candidates, needs)
+	case isGroup:
+		if !tenant.allowsGroup(group) {
+			apierror.Write(w, r, http.StatusForbidden, apierror.CodeModelNotAllowed, fmt.Sprintf("no model of group %s is available for this api key", modelName))
+			return
+		}
+		candidates, unsupported = g.resolveGroup(tenant, group, needs, r.URL.Path)
+	case discovered != nil:
+		candidates = discovered
+	case useDefault:
+		candidates = []ruleProvider{{id: g.defaultProvider.ID}}
+	default:
+		candidates, unsupported = g.filterCapable(modelName, g.selectProviders(route, modelName, tokenCount, r.URL.Path), needs)
+	}
+	// Requests stick to a provider of the model, never to an openrouter fallback.
+	key := stickyKey(route, r.Header, bodyBytes, reqType)
+	candidates = stickTo(key, candidates)
+	sticky := stickyHead(key, candidates)
+	candidates = g.withFallbackProviders(candidates)
 	if len(candidates) == 0 {
-		http.Error(w, "no provider available", http.StatusBadGateway)
+		if len(unsupported) > 0 {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeNotSupported, fmt.Sprintf("no provider of model %s supports this request: %s", modelName, strings.Join(unsupported, ", ")))
+			return
+		}
+		apierror.Write(w, r, http.StatusBadGateway, apierror.CodeNoProvider, "no provider available")
 		return
 	}
+	candidates = g.skipFailingChecks(modelName, g.skipEvicted(modelName, g.skipUnavailable(modelName, candidates)))
+	candidates = g.orderBySLO(candidates, sticky)
 
-	log.Debugf("[%s] select providers: %v", modelName, candidates)
+	logger.Debugf("[%s] select providers: %v", modelName, candidates)
 
 	var lastErr error
+	var retry retryAfterTracker
 	stream := gjson.GetBytes(bodyBytes, "stream").Bool()
-	for attemptIdx, candidate := range candidates {
-		attempt := attemptIdx + 1
+	// Failures that cannot be retried are answered with a 502 unless the
+	// provider's response was already started.
+	recorder := &statusRecorder{ResponseWriter: w}
+	w = recorder
+	attempt := 0
+	for _, candidate := range candidates {
+		attempt++
 		provider, ok := g.providers[candidate.id]
 		if !ok {
 			err := fmt.Errorf("provider %s not found", candidate.id)
 			lastErr = err
-			if rec := g.prepareUsageRecord(candidate.id, candidate.model, modelName, r.URL.Path, requestID, tokenCount, 0, attempt); rec != nil {
+			if rec := g.prepareUsageRecord(r.Context(), candidate.id, candidate.model, modelName, r.URL.Path, requestID, tokenCount, 0, attempt); rec != nil {
 				rec.Outcome = "failure"
 				rec.Error = err.Error()
 				rec.Duration = 0
@@ -260,36 +665,69 @@ func (g *Gateway) Proxy(w http.ResponseWriter, r *http.Request, reqType RequestT
 			continue
 		}
 
-		targetModel := modelName
-		if candidate.model != "" {
-			targetModel = candidate.model
-		}
+		targetModel := g.targetModelOf(candidate, modelName)
 
-		modifiedBody := bodyBytes
-		if targetModel != modelName {
-			modifiedBody, err = sjson.SetBytes(bodyBytes, "model", targetModel)
-			if err != nil {
-				lastErr = fmt.Errorf("modify request body: %w", err)
-				if rec := g.prepareUsageRecord(provider.ID, targetModel, modelName, r.URL.Path, requestID, tokenCount, 0, attempt); rec != nil {
-					rec.Outcome = "failure"
-					rec.Error = err.Error()
-					rec.Duration = 0
-					g.saveUsageRecord(r.Context(), *rec)
-				}
-				continue
+		modifiedBody, err := providerBody(bodyBytes, modelName, targetModel, provider)
+		if err == nil {
+			modifiedBody, err = applyParamLimits(modifiedBody, targetModel, reqType, g.limitsFor(modelName, candidate))
+			var limitErr *errParamLimit
+			if errors.As(err, &limitErr) {
+				apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+				return
 			}
 		}
+		if err != nil {
+			lastErr = fmt.Errorf("modify request body: %w", err)
+			if rec := g.prepareUsageRecord(r.Context(), provider.ID, targetModel, modelName, r.URL.Path, requestID, tokenCount, 0, attempt); rec != nil {
+				rec.Outcome = "failure"
+				rec.Error = err.Error()
+				rec.Duration = 0
+				g.saveUsageRecord(r.Context(), *rec)
+			}
+			continue
+		}
 
-		record, err := g.forwardRequest(w, r, provider, targetModel, modifiedBody, tokenCount, r.URL.Path, stream, reqType, attempt, requestID, modelName)
-		if record != nil {
-			g.saveUsageRecord(r.Context(), *record)
+		policy := g.retryPolicy(modelName, provider.ID)
+		for try := 1; ; try++ {
+			var record *storage.UsageRecord
+			record, err = g.forwardRequest(w, r, provider, targetModel, modifiedBody, tokenCount, r.URL.Path, stream, reqType, attempt, requestID, modelName)
+			if record != nil {
+				g.saveUsageRecord(r.Context(), *record)
+			}
+			g.observeProvider(r, provider.ID, targetModel, err)
+			var retryErr *retryableError
+			if policy == nil || try >= policy.MaxAttempts || !errors.As(err, &retryErr) || !policy.Retryable(retryErr.status) {
+				break
+			}
+			wait := retryWait(policy, try, retryErr.header, time.Now())
+			logger.Warningf("[%s] provider %s(%s) returned status %d, retrying in %s", modelName, candidate.id, candidate.model, retryErr.status, wait)
+			if !sleepContext(r.Context(), wait) {
+				break
+			}
+			attempt++
 		}
 		if err != nil {
+			g.markIfModelNotFound(provider.ID, targetModel, err)
 			lastErr = err
+			var retryErr *retryableError
+			if errors.As(err, &retryErr) {
+				retry.observe(retryErr)
+				// Errors the policy does not retry are the client's to handle,
+				// unless another provider may serve the model.
+				if policy != nil && !policy.Retryable(retryErr.status) && !retryErr.modelNotFound() {
+					logger.Warningf("[%s] provider %s(%s) returned status %d, which is not retried", modelName, candidate.id, candidate.model, retryErr.status)
+					g.writeProviderError(w, retryErr, retry)
+					return
+				}
+			}
 			if errors.Is(err, errShouldRetry) {
-				log.Warningf("[%s] provider %s(%s) failed, we will try another provider: %v", modelName, candidate.id, candidate.model, err)
+				logger.Warningf("[%s] provider %s(%s) failed, we will try another provider: %v", modelName, candidate.id, candidate.model, err)
 				continue
 			}
+			if recorder.status == 0 {
+				logger.Errorf("[%s] forward to provider %s: %v", modelName, provider.ID, err)
+				apierror.Write(w, r, http.StatusBadGateway, apierror.CodeNoProvider, err.Error())
+			}
 			return
 		}
 		return
@@ -299,18 +737,15 @@ func (g *Gateway) Proxy(w http.ResponseWriter, r *http.Request, reqType RequestT
 	if lastErr == nil {
 		lastErr = fmt.Errorf("no available provider")
 	}
+	g.notifyAllProvidersFailed(r.Context(), modelName, len(candidates), lastErr)
 
 	var retryErr *retryableError
 	if errors.As(lastErr, &retryErr) {
-		copyResponseHeaders(w.Header(), retryErr.header)
-		w.WriteHeader(retryErr.status)
-		if len(retryErr.body) > 0 {
-			_, _ = w.Write(retryErr.body)
-		}
+		g.writeProviderError(w, retryErr, retry)
 		return
 	}
 
-	http.Error(w, lastErr.Error(), status)
+	apierror.Write(w, r, status, apierror.CodeNoProvider, lastErr.Error())
 }
 
 var errShouldRetry = errors.New("should retry")
@@ -323,32 +758,42 @@ type retryableError struct {
 }
 
 func (e *retryableError) Error() string {
-	bodyStr := string(e.body)
-	if contentEncoding := e.header.Get("Content-Encoding"); strings.Contains(strings.ToLower(contentEncoding), "gzip") {
-		if decodedBody, err := decodeGzip(e.body); err == nil {
-			bodyStr = string(decodedBody)
-		}
-	}
+	body := decodeBodyForAnalysis(e.body, e.header.Get("Content-Encoding"))
+	return fmt.Sprintf("provider %s returned status %d, body: %s", e.providerID, e.status, body)
+}
 
-	return fmt.Sprintf("provider %s returned status %d, body: %s", e.providerID, e.status, bodyStr)
+func (e *retryableError) Unwrap() error {
+	return errShouldRetry
 }
 
-func decodeGzip(data []byte) ([]byte, error) {
-	reader, err := gzip.NewReader(bytes.NewReader(data))
-	if err != nil {
+// providerBody adapts the request body to a provider: the model is set to the
+// provider's model name, OpenRouter routing preferences are added and the
+// parameters the provider rejects are removed.
+func providerBody(body []byte, modelName, targetModel string, provider config.ProviderConfig) ([]byte, error) {
+	var err error
+	if targetModel != modelName {
+		if body, err = sjson.SetBytes(body, "model", targetModel); err != nil {
+			return nil, err
+		}
+	}
+	if body, err = setOpenRouterRouting(body, provider); err != nil {
 		return nil, err
 	}
-	defer reader.Close()
-	return io.ReadAll(reader)
-}
-
-func (e *retryableError) Unwrap() error {
-	return errShouldRetry
+	for _, param := range provider.UnsupportedParams {
+		if !gjson.GetBytes(body, param).Exists() {
+			continue
+		}
+		if body, err = sjson.DeleteBytes(body, param); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
 }
 
 func (g *Gateway) forwardRequest(w http.ResponseWriter, r *http.Request, provider config.ProviderConfig, model string, body []byte, tokenCount int, path string, stream bool, reqType RequestType, attempt int, requestID, originalModel string) (*storage.UsageRecord, error) {
-	endpoint, err := joinURL(provider.BaseURL, strings.TrimPrefix(r.URL.Path, "/v1/"), r.URL.RawQuery)
-	record := g.prepareUsageRecord(provider.ID, model, originalModel, path, requestID, tokenCount, 0, attempt)
+	logger := internalmw.Logger(r.Context())
+	endpoint, err := providerURL(provider, reqType.pathKey(), strings.TrimPrefix(r.URL.Path, "/v1/"), model, r.URL.RawQuery)
+	record := g.prepareUsageRecord(r.Context(), provider.ID, model, originalModel, path, requestID, tokenCount, 0, attempt)
 	started := time.Now()
 	if record != nil {
 		record.CreatedAt = started
@@ -362,9 +807,9 @@ func (g *Gateway) forwardRequest(w http.ResponseWriter, r *http.Request, provide
 	}
 
 	ctx := r.Context()
-	if provider.Timeout > 0 {
+	if timeout := providerTimeout(ctx, provider); timeout > 0 {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, provider.Timeout)
+		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 	}
 
@@ -378,26 +823,21 @@ func (g *Gateway) forwardRequest(w http.ResponseWriter, r *http.Request, provide
 	}
 
 	copyHeaders(req.Header, r.Header)
-
-	if provider.Type == config.ProviderTypeAnthropic {
-		req.Header.Set("x-api-key", provider.AccessToken)
-		req.Header.Del("Authorization")
-	} else {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", provider.AccessToken))
-		req.Header.Del("x-api-key")
-	}
+	req.Header.Del(timeoutHeader)
+	req.Header.Set(internalmw.RequestIDHeader, requestID)
+	g.setUpstreamEncoding(req.Header)
+	setProviderAuth(req.Header, provider)
 	req.Host = req.URL.Host
 	req.ContentLength = int64(len(body))
-	if provider.Headers != nil {
-		for k, v := range provider.Headers {
-			req.Header.Set(k, v)
-		}
-	}
 
-	log.Debugf("[%s] forward request to %s, url: %s", model, provider.ID, endpoint)
+	logger.Debugf("[%s] forward request to %s, url: %s", model, provider.ID, endpoint)
 
-	resp, err := g.httpClient.Do(req)
+	resp, err := g.clientFor(provider.ID).Do(req)
 	if err != nil {
+		if r.Context().Err() != nil {
+			markClientCancelled(record, model, reqType, nil, "", stream, started, 0)
+			return record, fmt.Errorf("[%s] client cancelled request to %s: %w", model, provider.ID, r.Context().Err())
+		}
 		if record != nil {
 			record.Outcome = "failure"
 			record.Error = err.Error()
@@ -413,9 +853,14 @@ func (g *Gateway) forwardRequest(w http.ResponseWriter, r *http.Request, provide
 	}
 
 	tracker := newFirstByteReader(resp.Body, started)
+	var respReader io.Reader = tracker
+	var decodedEncoding string
+	if g.cfg.Compression == config.CompressionDecode {
+		respReader, decodedEncoding = decodeResponse(resp, tracker)
+	}
 
 	if shouldRetryStatus(resp.StatusCode) {
-		respBody, _ := io.ReadAll(tracker)
+		respBody, _ := io.ReadAll(respReader)
 		if record != nil {
 			record.Duration = time.Since(started)
 			record.FirstTokenLatency = tracker.Latency()
@@ -438,26 +883,120 @@ func (g *Gateway) forwardRequest(w http.ResponseWriter, r *http.Request, provide
 		}
 	}
 
+	// Decoded responses are compressed again for clients that accept it.
+	if decodedEncoding != "" {
+		if encoding := clientEncoding(r.Header.Get("Accept-Encoding"), decodedEncoding); encoding != "" {
+			cw := newCompressWriter(w, encoding)
+			defer cw.Close()
+			w = cw
+		}
+	}
+
+	// Compressed bodies are copied as is: neither pings, a usage chunk nor
+	// rewritten fields can be spliced into them.
+	compressed := resp.Header.Get("Content-Encoding") != ""
+	// Newline delimited JSON streams are converted to the events clients of
+	// the inbound protocol expect, unless they asked for that format.
+	convertNDJSON := stream && !compressed && isNDJSONResponse(resp.Header) && !acceptsNDJSON(r.Header)
+	editable := (isEventStream || convertNDJSON) && !compressed
+	rewrite, rewriting := responseRewriteFrom(r.Context())
+	rewriting = rewriting && !compressed
+	synthesizeUsage := g.cfg.SynthesizeUsage && !stream && !isEventStream && !compressed && resp.StatusCode < http.StatusMultipleChoices
+	var out http.ResponseWriter = w
+	var usageWriter *streamUsageWriter
+	if editable && streamUsageRequested(r.Context()) {
+		usageWriter = newStreamUsageWriter(out)
+		out = usageWriter
+	}
+	var eventRewriter *rewriteWriter
+	if editable && rewriting {
+		eventRewriter = newRewriteWriter(out, rewrite, reqType)
+		out = eventRewriter
+	}
+	var ndjsonConverter *ndjsonWriter
+	if convertNDJSON {
+		ndjsonConverter = newNDJSONWriter(out, reqType)
+		out = ndjsonConverter
+	}
+
 	copyResponseHeaders(w.Header(), resp.Header)
+	g.relayRateLimitHeaders(w.Header())
+	if g.cfg.AnonymizeProviders {
+		stripProviderHeaders(w.Header())
+	}
+	if convertNDJSON {
+		w.Header().Set("Content-Type", "text/event-stream")
+	}
+	if usageWriter != nil || rewriting || convertNDJSON || synthesizeUsage {
+		w.Header().Del("Content-Length")
+	}
 	w.WriteHeader(resp.StatusCode)
 
 	var respBody []byte
+	var analysis *responseAnalysis
 	if stream || isEventStream {
-		var buf bytes.Buffer
-		writer := io.MultiWriter(w, &buf)
-		if _, err = io.Copy(writer, tracker); err != nil {
+		tee := newStreamTee(model, reqType, resp.Header.Get("Content-Encoding"))
+		copyOpts := streamCopy{
+			writeTimeout: time.Duration(g.cfg.StreamWriteTimeoutSeconds) * time.Second,
+			bufferBytes:  g.cfg.StreamBufferBytes,
+		}
+		if editable && isEventStream {
+			copyOpts.keepalive = time.Duration(g.cfg.StreamKeepaliveSeconds) * time.Second
+		}
+		if copyOpts != (streamCopy{}) {
+			err = copyStream(out, respReader, tee, copyOpts)
+		} else {
+			_, err = io.Copy(io.MultiWriter(out, tee), respReader)
+		}
+		captured, streamed := tee.Close()
+		if err != nil {
+			// Checked first: the failed write also cancels the request context.
+			if errors.Is(err, errSlowClient) {
+				logger.Warningf("[%s] stream from %s terminated: %v", model, provider.ID, err)
+				markPartialResponse(record, model, reqType, storage.OutcomeSlowClient, err.Error(), captured, resp.Header.Get("Content-Encoding"), true, started, tracker.Latency())
+				return record, fmt.Errorf("[%s] stream from %s: %w", model, provider.ID, err)
+			}
+			if r.Context().Err() != nil {
+				markClientCancelled(record, model, reqType, captured, resp.Header.Get("Content-Encoding"), true, started, tracker.Latency())
+				return record, fmt.Errorf("[%s] client cancelled stream from %s: %w", model, provider.ID, r.Context().Err())
+			}
 			if record != nil {
 				record.Outcome = "failure"
 				record.Error = err.Error()
 				record.Duration = time.Since(started)
 				record.FirstTokenLatency = tracker.Latency()
 			}
+			if editable {
+				if werr := writeStreamError(w, reqType, captured); werr != nil {
+					logger.Debugf("[%s] write stream error event: %v", model, werr)
+				}
+			}
 			return record, fmt.Errorf("[%s] stream response from %s: %w", model, provider.ID, err)
 		}
-		respBody = buf.Bytes()
+		respBody = captured
+		analysis = &streamed
+		if ndjsonConverter != nil {
+			if err := ndjsonConverter.finish(); err != nil {
+				logger.Debugf("[%s] write converted stream: %v", model, err)
+			}
+		}
+		if eventRewriter != nil {
+			if err := eventRewriter.finish(); err != nil {
+				logger.Debugf("[%s] write rewritten stream: %v", model, err)
+			}
+		}
+		if usageWriter != nil {
+			if err := usageWriter.finish(tokenCount, streamed.completionTokens); err != nil {
+				logger.Debugf("[%s] write usage chunk: %v", model, err)
+			}
+		}
 	} else {
-		data, readErr := io.ReadAll(tracker)
+		data, readErr := io.ReadAll(respReader)
 		if readErr != nil {
+			if r.Context().Err() != nil {
+				markClientCancelled(record, model, reqType, nil, "", false, started, tracker.Latency())
+				return record, fmt.Errorf("[%s] client cancelled request to %s: %w", model, provider.ID, r.Context().Err())
+			}
 			if record != nil {
 				record.Outcome = "failure"
 				record.Error = readErr.Error()
@@ -467,7 +1006,19 @@ func (g *Gateway) forwardRequest(w http.ResponseWriter, r *http.Request, provide
 			return record, fmt.Errorf("[%s] read response from %s: %w", model, provider.ID, readErr)
 		}
 		respBody = data
-		if _, err = w.Write(respBody); err != nil {
+		written := respBody
+		if synthesizeUsage {
+			_, completion := extractResponseMetadata(model, reqType, respBody, false)
+			written = withSynthesizedUsage(reqType, written, tokenCount, completion)
+		}
+		if rewriting {
+			written = rewrite.apply(reqType, written)
+		}
+		if _, err = w.Write(written); err != nil {
+			if r.Context().Err() != nil {
+				markClientCancelled(record, model, reqType, respBody, resp.Header.Get("Content-Encoding"), isEventStream, started, tracker.Latency())
+				return record, fmt.Errorf("[%s] client cancelled request to %s: %w", model, provider.ID, r.Context().Err())
+			}
 			if record != nil {
 				record.Outcome = "failure"
 				record.Error = err.Error()
@@ -484,19 +1035,53 @@ func (g *Gateway) forwardRequest(w http.ResponseWriter, r *http.Request, provide
 		if record.Outcome == "" {
 			record.Outcome = "success"
 		}
-		decoded := decodeBodyForAnalysis(respBody, resp.Header.Get("Content-Encoding"))
-		providerReqID, completion := extractResponseMetadata(model, reqType, decoded, stream || isEventStream)
-		if providerReqID != "" {
-			record.ProviderRequestID = providerReqID
+		if analysis == nil {
+			body := analyzeResponse(model, reqType, respBody, resp.Header.Get("Content-Encoding"), false)
+			analysis = &body
+		}
+		if analysis.providerRequestID != "" {
+			record.ProviderRequestID = analysis.providerRequestID
 		}
-		if completion > 0 {
-			record.ResponseTokens = completion
+		if analysis.completionTokens > 0 {
+			record.ResponseTokens = analysis.completionTokens
 		}
+		g.setTraceOutput(r.Context(), reqType, analysis.body, stream || isEventStream)
+	}
+	if responseLogRequested(r.Context()) {
+		body := decodeBodyForAnalysis(respBody, resp.Header.Get("Content-Encoding"))
+		if analysis != nil {
+			body = analysis.body
+		}
+		g.saveResponseLog(r, requestID, provider.ID, model, resp.StatusCode, body)
 	}
 
 	return record, nil
 }
 
+// markClientCancelled records a request the client abandoned, with the
+// response tokens the provider generated up to that point.
+func markClientCancelled(record *storage.UsageRecord, model string, reqType RequestType, partial []byte, encoding string, stream bool, started time.Time, firstTokenLatency time.Duration) {
+	log.Debugf("[%s] client disconnected, upstream request cancelled", model)
+	markPartialResponse(record, model, reqType, storage.OutcomeClientCancelled, "client disconnected before the response completed", partial, encoding, stream, started, firstTokenLatency)
+}
+
+// markPartialResponse records a request that ended early with outcome, with
+// the response tokens counted from the partial response.
+func markPartialResponse(record *storage.UsageRecord, model string, reqType RequestType, outcome, reason string, partial []byte, encoding string, stream bool, started time.Time, firstTokenLatency time.Duration) {
+	if record == nil {
+		return
+	}
+	record.Outcome = outcome
+	record.Error = reason
+	record.Duration = time.Since(started)
+	record.FirstTokenLatency = firstTokenLatency
+	providerReqID, completion := extractResponseMetadata(model, reqType, decodeBodyForAnalysis(partial, encoding), stream)
+	if providerReqID != "" {
+		record.ProviderRequestID = providerReqID
+	}
+	record.ResponseTokens = completion
+}
+
 func shouldRetryStatus(status int) bool {
 	return status >= 400
 }
@@ -534,18 +1119,6 @@ func isEventStreamResponse(header http.Header) bool {
 	return strings.Contains(contentType, "text/event-stream")
 }
 
-func decodeBodyForAnalysis(data []byte, encoding string) []byte {
-	if len(data) == 0 {
-		return data
-	}
-	if strings.Contains(strings.ToLower(encoding), "gzip") {
-		if decoded, err := decodeGzip(data); err == nil {
-			return decoded
-		}
-	}
-	return data
-}
-
 func extractErrorMessage(body []byte, encoding string, status int) string {
 	decoded := decodeBodyForAnalysis(body, encoding)
 	if trimmed := strings.TrimSpace(string(decoded)); trimmed != "" {
@@ -822,10 +1395,13 @@ func parseSSEPayloads(body []byte) [][]byte {
 		if len(line) == 0 {
 			continue
 		}
-		if !bytes.HasPrefix(line, []byte("data:")) {
+		// Newline delimited JSON streams carry the payloads as plain lines.
+		payload := line
+		if bytes.HasPrefix(line, []byte("data:")) {
+			payload = bytes.TrimSpace(line[len("data:"):])
+		} else if line[0] != '{' {
 			continue
 		}
-		payload := bytes.TrimSpace(line[len("data:"):])
 		if len(payload) == 0 || bytes.Equal(payload, []byte("[DONE]")) {
 			continue
 		}
@@ -835,8 +1411,53 @@ func parseSSEPayloads(body []byte) [][]byte {
 }
 
 func (g *Gateway) selectProviders(route *modelRoute, model string, tokenCount int, path string) []ruleProvider {
-	env := EvalEnv{TokenCount: tokenCount, Model: model, Path: path}
-	for _, rule := range route.rules {
+	if rule := matchRule(route, g.evalEnv(model, tokenCount, path)); rule != nil {
+		if rule.rotation != nil {
+			return rule.rotation.rotate(rule.providers)
+		}
+		return rule.providers
+	}
+
+	providers := make([]ruleProvider, 0, len(route.config.Providers))
+	for _, provider := range route.config.Providers {
+		providers = append(providers, ruleProvider{id: provider.ID, model: provider.Model})
+	}
+	if route.balancer != nil {
+		return route.balancer.order(providers)
+	}
+	if route.rotation != nil {
+		return route.rotation.rotate(providers)
+	}
+	switch route.config.RoutingStrategy() {
+	case config.StrategyLowestLatency:
+		return g.orderByLatency(route, providers, model)
+	case config.StrategyLowestCost:
+		return g.orderByCost(providers, model, tokenCount)
+	}
+	return providers
+}
+
+// evalEnv returns the environment rule expressions of a request are evaluated with.
+func (g *Gateway) evalEnv(model string, tokenCount int, path string) EvalEnv {
+	now := g.now()
+	return EvalEnv{
+		TokenCount: tokenCount,
+		Model:      model,
+		Path:       path,
+		Hour:       now.Hour(),
+		Weekday:    int(now.Weekday()),
+		Date:       now.Format("2006-01-02"),
+		live:       g.live,
+		cost: func(provider string) (float64, bool) {
+			return g.estimatedCost(ruleProvider{id: provider, model: g.providerModelOf(model, provider)}, model, tokenCount)
+		},
+	}
+}
+
+// matchRule returns the first rule of the route matching the request, or nil
+// when the default provider order applies.
+func matchRule(route *modelRoute, env EvalEnv) *compiledRule {
+	for i, rule := range route.rules {
 		out, err := vm.Run(rule.program, env)
 		if err != nil {
 			log.Warningf("eval rule %v", err)
@@ -844,15 +1465,10 @@ func (g *Gateway) selectProviders(route *modelRoute, model string, tokenCount in
 		}
 
 		if matched, ok := out.(bool); ok && matched {
-			return rule.providers
+			return &route.rules[i]
 		}
 	}
-
-	providers := make([]ruleProvider, 0, len(route.config.Providers))
-	for _, provider := range route.config.Providers {
-		providers = append(providers, ruleProvider{id: provider.ID, model: provider.Model})
-	}
-	return providers
+	return nil
 }
 
 func joinURL(base, path, rawQuery string) (string, error) {
@@ -884,7 +1500,7 @@ func joinURL(base, path, rawQuery string) (string, error) {
 	target := *baseURL
 	target.Path = joinedPath
 	target.RawPath = ""
-	target.RawQuery = rawQuery
+	target.RawQuery = mergeQuery(baseURL.RawQuery, rawQuery)
 
 	return target.String(), nil
 }
@@ -947,12 +1563,15 @@ func copyResponseHeaders(dst, src http.Header) {
 }
 
 func (g *Gateway) fetchProviderModels(provider config.ProviderConfig) ([]ModelInfo, error) {
-	endpoint, err := joinURL(provider.BaseURL, "/models", "")
+	return g.fetchProviderModelsContext(context.Background(), provider)
+}
+
+func (g *Gateway) fetchProviderModelsContext(ctx context.Context, provider config.ProviderConfig) ([]ModelInfo, error) {
+	endpoint, err := providerURL(provider, config.PathModels, "/models", "", "")
 	if err != nil {
 		return nil, fmt.Errorf("build provider url: %w", err)
 	}
 
-	ctx := context.Background()
 	if provider.Timeout > 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, provider.Timeout)
@@ -965,17 +1584,11 @@ func (g *Gateway) fetchProviderModels(provider config.ProviderConfig) ([]ModelIn
 	}
 
 	if provider.Type == config.ProviderTypeAnthropic {
-		req.Header.Set("x-api-key", provider.AccessToken)
-	} else {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", provider.AccessToken))
-	}
-	if provider.Headers != nil {
-		for k, v := range provider.Headers {
-			req.Header.Set(k, v)
-		}
+		req.Header.Set("anthropic-version", "2023-06-01")
 	}
+	setProviderAuth(req.Header, provider)
 
-	resp, err := g.httpClient.Do(req)
+	resp, err := g.clientFor(provider.ID).Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("fetch models from %s: %w", provider.ID, err)
 	}
@@ -994,6 +1607,22 @@ func (g *Gateway) fetchProviderModels(provider config.ProviderConfig) ([]ModelIn
 	return result.Data, nil
 }
 
+// HasReachableProvider reports whether at least one configured provider answers
+// its model listing endpoint successfully.
+func (g *Gateway) HasReachableProvider(ctx context.Context) bool {
+	for _, provider := range g.cfg.Providers {
+		if ctx.Err() != nil {
+			return false
+		}
+		_, err := g.fetchProviderModelsContext(ctx, provider)
+		if err == nil {
+			return true
+		}
+		log.Debugf("readiness probe for provider %s failed: %v", provider.ID, err)
+	}
+	return false
+}
+
 func CountTokens(model string, reqType RequestType, body []byte) int {
 	encoding, err := tiktoken.EncodingForModel(model)
 	if err != nil {
@@ -7,6 +7,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/tidwall/gjson"
+
 	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
 )
 
@@ -186,3 +188,75 @@ func TestProxyReturnsBadRequestWhenAllProvidersFail(t *testing.T) {
 		t.Fatalf("expected response body, got empty")
 	}
 }
+
+func TestProxyDefaultProviderFailsOver(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(primary.Close)
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	}))
+	t.Cleanup(fallback.Close)
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "p1", BaseURL: primary.URL, AccessToken: "t"},
+			{ID: "or", Type: config.ProviderTypeOpenRouter, BaseURL: fallback.URL, AccessToken: "t", OpenRouter: &config.OpenRouterConfig{Fallback: true}},
+		},
+		Default: "p1",
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"unknown"}`)))
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"id":"ok"}` {
+		t.Fatalf("expected the fallback to answer for the default provider, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProxyAnswersUnreachableProvider(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{ID: "p1", BaseURL: closed.URL, AccessToken: "t"}},
+		Models:    []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o"}`)))
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+
+	if rec.Code != http.StatusBadGateway || gjson.Get(rec.Body.String(), "error.message").String() == "" {
+		t.Fatalf("expected a 502 error, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProviderBodyStripsUnsupportedParams(t *testing.T) {
+	provider := config.ProviderConfig{ID: "p1", UnsupportedParams: []string{"reasoning_effort", "parallel_tool_calls", "logprobs"}}
+	body := []byte(`{"model":"gpt-4o","reasoning_effort":"high","parallel_tool_calls":false,"temperature":0.5}`)
+
+	got, err := providerBody(body, "gpt-4o", "openai/gpt-4o", provider)
+	if err != nil {
+		t.Fatalf("provider body: %v", err)
+	}
+	if gjson.GetBytes(got, "reasoning_effort").Exists() || gjson.GetBytes(got, "parallel_tool_calls").Exists() {
+		t.Fatalf("expected unsupported params to be removed, got %s", got)
+	}
+	if gjson.GetBytes(got, "model").String() != "openai/gpt-4o" || gjson.GetBytes(got, "temperature").Float() != 0.5 {
+		t.Fatalf("unexpected body %s", got)
+	}
+	if !gjson.GetBytes(body, "reasoning_effort").Exists() {
+		t.Fatalf("the original body must be left intact for other providers")
+	}
+}
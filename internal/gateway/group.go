@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"slices"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// resolveGroup expands a virtual model into the providers of its models, in
+// group order. Each model is routed as if it had been requested directly, so
+// its rules, capabilities, the caller's tenant overrides and model allowlist
+// apply; a member with a provider keeps only that provider. It also returns
+// the capabilities that ruled out candidates.
+func (g *Gateway) resolveGroup(tenant *tenantRoute, group config.GroupConfig, needs requestNeeds, path string) ([]ruleProvider, []string) {
+	var candidates []ruleProvider
+	var reasons []string
+	seen := make(map[ruleProvider]struct{})
+	for _, member := range group.Models {
+		if !tenant.allowsModel(member.Model) {
+			continue
+		}
+		providers := tenant.overrideFor(member.Model)
+		if providers == nil {
+			if route, ok := g.models[member.Model]; ok {
+				providers = g.selectProviders(route, member.Model, needs.promptTokens, path)
+			}
+		}
+
+		var resolved []ruleProvider
+		for _, p := range providers {
+			if member.Provider != "" && p.id != member.Provider {
+				continue
+			}
+			if p.model == "" {
+				p.model = member.Model
+			}
+			p.member = member.Model
+			resolved = append(resolved, p)
+		}
+		if len(resolved) == 0 && member.Provider != "" {
+			resolved = []ruleProvider{{id: member.Provider, model: member.Model, member: member.Model}}
+		}
+		resolved, missing := g.filterCapable(member.Model, resolved, needs)
+		for _, m := range missing {
+			if !slices.Contains(reasons, m) {
+				reasons = append(reasons, m)
+			}
+		}
+
+		for _, p := range resolved {
+			key := ruleProvider{id: p.id, model: p.model}
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			candidates = append(candidates, p)
+		}
+	}
+	return candidates, reasons
+}
+
+// allowsGroup reports whether the tenant may request at least one model of the group.
+func (t *tenantRoute) allowsGroup(group config.GroupConfig) bool {
+	for _, member := range group.Models {
+		if t.allowsModel(member.Model) {
+			return true
+		}
+	}
+	return false
+}
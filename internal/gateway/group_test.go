@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+)
+
+func TestResolveGroupFollowsMemberRoutes(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "p1", BaseURL: "http://p1", AccessToken: "t"},
+			{ID: "p2", BaseURL: "http://p2", AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{
+			{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}, {ID: "p2", Model: "openai/gpt-4o"}}},
+			{Name: "claude", Providers: []config.ModelProvider{{ID: "p2"}}},
+		},
+		Groups: []config.GroupConfig{{Name: "smart", Models: []config.GroupMember{
+			{Model: "claude"},
+			{Model: "gpt-4o", Provider: "p2"},
+			{Model: "gemini", Provider: "p1"},
+		}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	got, _ := gw.resolveGroup(nil, gw.groups["smart"], requestNeeds{promptTokens: 10}, "/v1/chat/completions")
+	want := []ruleProvider{{id: "p2", model: "claude", member: "claude"}, {id: "p2", model: "openai/gpt-4o", member: "gpt-4o"}, {id: "p1", model: "gemini", member: "gemini"}}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestResolveGroupSkipsModelsTheTenantMayNotUse(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "p1", BaseURL: "http://p1", AccessToken: "t"},
+			{ID: "p2", BaseURL: "http://p2", AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{
+			{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}},
+			{Name: "claude", Providers: []config.ModelProvider{{ID: "p2"}}},
+		},
+		Groups: []config.GroupConfig{{Name: "smart", Models: []config.GroupMember{{Model: "claude"}, {Model: "gpt-4o"}}}},
+		Tenants: []config.TenantConfig{
+			{ID: "team-a", APIKeys: []string{"sk-team-a"}, Models: []string{"smart", "gpt-4o"}},
+			{ID: "team-b", APIKeys: []string{"sk-team-b"}, Models: []string{"smart"}},
+		},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	got, _ := gw.resolveGroup(gw.tenants["team-a"], gw.groups["smart"], requestNeeds{promptTokens: 10}, "/v1/chat/completions")
+	if len(got) != 1 || got[0] != (ruleProvider{id: "p1", model: "gpt-4o", member: "gpt-4o"}) {
+		t.Fatalf("expected only the allowed member, got %v", got)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"smart"}`)))
+	req = req.WithContext(internalmw.WithIdentity(req.Context(), internalmw.Identity{Key: "sk-team-b", Tenant: "team-b"}))
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a group without allowed members to be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProxyGroupFailsOverAcrossModels(t *testing.T) {
+	var models []string
+	providerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		model := gjson.GetBytes(body, "model").String()
+		models = append(models, model)
+		if model == "fast-a" {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	}))
+	defer providerServer.Close()
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{ID: "p1", BaseURL: providerServer.URL, AccessToken: "token"}},
+		Models: []config.ModelConfig{
+			{Name: "fast-a", Providers: []config.ModelProvider{{ID: "p1"}}},
+			{Name: "fast-b", Providers: []config.ModelProvider{{ID: "p1"}}},
+		},
+		Groups: []config.GroupConfig{{Name: "fast", Models: []config.GroupMember{{Model: "fast-a"}, {Model: "fast-b"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"fast"}`)))
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(models) != 2 || models[0] != "fast-a" || models[1] != "fast-b" {
+		t.Fatalf("expected fast-a then fast-b, got %v", models)
+	}
+}
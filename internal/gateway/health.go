@@ -0,0 +1,382 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/notify"
+)
+
+// providerHealth counts consecutive failures per provider. A provider becomes
+// unhealthy once the count reaches the threshold and healthy again on its next
+// successful request. With provider_eviction, providers unhealthy for long
+// are evicted from rotation until a request or probe succeeds.
+type providerHealth struct {
+	mu        sync.Mutex
+	threshold int
+	states    map[string]*healthState
+	now       func() time.Time
+}
+
+type healthState struct {
+	failures  int
+	unhealthy bool
+	// since is when the provider turned unhealthy
+	since   time.Time
+	evicted bool
+}
+
+func newProviderHealth(threshold int) *providerHealth {
+	if threshold <= 0 {
+		threshold = 3
+	}
+	return &providerHealth{threshold: threshold, states: make(map[string]*healthState), now: time.Now}
+}
+
+func (h *providerHealth) state(id string) *healthState {
+	st, ok := h.states[id]
+	if !ok {
+		st = &healthState{}
+		h.states[id] = st
+	}
+	return st
+}
+
+// failure records a failed request and reports whether the provider just turned unhealthy.
+func (h *providerHealth) failure(id string) (bool, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st := h.state(id)
+	st.failures++
+	if !st.unhealthy && st.failures >= h.threshold {
+		st.unhealthy = true
+		st.since = h.now()
+		return true, st.failures
+	}
+	return false, st.failures
+}
+
+// success records a served request and reports whether the provider just recovered.
+func (h *providerHealth) success(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st := h.state(id)
+	recovered := st.unhealthy
+	st.failures = 0
+	st.unhealthy = false
+	st.evicted = false
+	return recovered
+}
+
+// evict marks the providers unhealthy for at least after as evicted and
+// returns those evicted by this call.
+func (h *providerHealth) evict(after time.Duration) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var evicted []string
+	for id, st := range h.states {
+		if st.unhealthy && !st.evicted && h.now().Sub(st.since) >= after {
+			st.evicted = true
+			evicted = append(evicted, id)
+		}
+	}
+	sort.Strings(evicted)
+	return evicted
+}
+
+// evictedProviders returns the providers currently evicted, sorted.
+func (h *providerHealth) evictedProviders() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var evicted []string
+	for id, st := range h.states {
+		if st.evicted {
+			evicted = append(evicted, id)
+		}
+	}
+	sort.Strings(evicted)
+	return evicted
+}
+
+// isEvicted reports whether a provider is out of rotation.
+func (h *providerHealth) isEvicted(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st, ok := h.states[id]
+	return ok && st.evicted
+}
+
+// snapshot returns the consecutive failures of a provider and whether it is unhealthy.
+func (h *providerHealth) snapshot(id string) (int, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st, ok := h.states[id]
+	if !ok {
+		return 0, false
+	}
+	return st.failures, st.unhealthy
+}
+
+// unhealthyCount returns the number of providers currently marked unhealthy.
+func (h *providerHealth) unhealthyCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	count := 0
+	for _, st := range h.states {
+		if st.unhealthy {
+			count++
+		}
+	}
+	return count
+}
+
+// providerFault reports whether a failed attempt is the provider's fault: a
+// server error, a rate limit or a transport error. Other client errors show
+// the provider is up and answer the request it was sent.
+func providerFault(err error) bool {
+	var retryErr *retryableError
+	if !errors.As(err, &retryErr) {
+		return true
+	}
+	return retryErr.status >= http.StatusInternalServerError || retryErr.status == http.StatusTooManyRequests
+}
+
+// observeProvider updates the health of a provider after an attempt and emits
+// notifications on state changes. Errors caused by the client going away or
+// reading too slowly are ignored, and client errors leave the health as it is.
+func (g *Gateway) observeProvider(r *http.Request, providerID, model string, err error) {
+	if err != nil && !errors.Is(err, errShouldRetry) && (r.Context().Err() != nil || errors.Is(err, errSlowClient)) {
+		return
+	}
+	failed := err != nil && providerFault(err)
+	g.checkErrorRate(providerID, failed)
+	if g.alerts != nil {
+		g.alerts.stats.add(providerID, failed)
+	}
+	if err != nil && !failed {
+		return
+	}
+
+	if err == nil {
+		if g.health.success(providerID) {
+			log.Infof("provider %s recovered", providerID)
+			g.notifier.Publish(notify.Event{
+				Type:     notify.EventProviderRecovered,
+				Severity: notify.SeverityInfo,
+				Provider: providerID,
+				Model:    model,
+				Message:  fmt.Sprintf("provider %s is serving requests again", providerID),
+			})
+		}
+		return
+	}
+
+	turned, failures := g.health.failure(providerID)
+	if !turned {
+		return
+	}
+	log.Warningf("provider %s marked unhealthy after %d consecutive failures: %v", providerID, failures, err)
+	g.notifier.Publish(notify.Event{
+		Type:     notify.EventProviderUnhealthy,
+		Severity: notify.SeverityWarning,
+		Provider: providerID,
+		Model:    model,
+		Message:  fmt.Sprintf("provider %s failed %d requests in a row", providerID, failures),
+		Details:  map[string]any{"consecutive_failures": failures, "last_error": shortenErrorMessage(err.Error())},
+	})
+}
+
+// errorRateWindow keeps per-second request and failure counts of each provider
+// over a sliding window.
+type errorRateWindow struct {
+	mu      sync.Mutex
+	window  time.Duration
+	samples map[string][]rateSample
+	now     func() time.Time
+}
+
+type rateSample struct {
+	second int64
+	total  int
+	failed int
+}
+
+func newErrorRateWindow(window time.Duration) *errorRateWindow {
+	return &errorRateWindow{window: window, samples: make(map[string][]rateSample), now: time.Now}
+}
+
+// add records one request and returns the totals within the window.
+func (w *errorRateWindow) add(id string, failed bool) (int, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	cutoff := now.Add(-w.window).Unix()
+	samples := w.samples[id]
+	drop := 0
+	for drop < len(samples) && samples[drop].second <= cutoff {
+		drop++
+	}
+	samples = samples[drop:]
+
+	second := now.Unix()
+	if n := len(samples); n == 0 || samples[n-1].second != second {
+		samples = append(samples, rateSample{second: second})
+	}
+	last := &samples[len(samples)-1]
+	last.total++
+	if failed {
+		last.failed++
+	}
+	w.samples[id] = samples
+	return w.sumLocked(id, w.window, now)
+}
+
+// sum returns the totals of a provider within the last window, which is
+// capped at the window the samples are kept for.
+func (w *errorRateWindow) sum(id string, window time.Duration) (int, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sumLocked(id, window, w.now())
+}
+
+func (w *errorRateWindow) sumLocked(id string, window time.Duration, now time.Time) (int, int) {
+	cutoff := now.Add(-window).Unix()
+	total, failures := 0, 0
+	for _, sample := range w.samples[id] {
+		if sample.second <= cutoff {
+			continue
+		}
+		total += sample.total
+		failures += sample.failed
+	}
+	return total, failures
+}
+
+// checkErrorRate raises an error_rate_spike alert once a provider's failure ratio
+// within the window crosses the configured threshold.
+func (g *Gateway) checkErrorRate(providerID string, failed bool) {
+	alert := g.cfg.ErrorRateAlert
+	if alert == nil || g.errorRates == nil {
+		return
+	}
+	total, failures := g.errorRates.add(providerID, failed)
+	if !failed || total < alert.MinRequests {
+		return
+	}
+	rate := float64(failures) / float64(total)
+	if rate < alert.Threshold {
+		return
+	}
+	g.notifier.Publish(notify.Event{
+		Type:     notify.EventErrorRateSpike,
+		Severity: notify.SeverityWarning,
+		Provider: providerID,
+		Message:  fmt.Sprintf("provider %s error rate is %.0f%% over the last %ds", providerID, rate*100, alert.WindowSeconds),
+		Details:  map[string]any{"requests": total, "failures": failures, "threshold": alert.Threshold},
+	})
+}
+
+// notifyBudgetThreshold reports a budget crossing, with a usage summary of the
+// scope for the current day and month taken from the store.
+func (g *Gateway) notifyBudgetThreshold(c budgetCrossing) {
+	severity := notify.SeverityWarning
+	if c.percent >= 100 {
+		severity = notify.SeverityCritical
+	}
+	details := map[string]any{
+		"period":  c.period,
+		"percent": c.percent,
+		"unit":    c.unit,
+		"used":    c.used,
+		"limit":   c.limit,
+	}
+	if g.usageStore != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		day, month := periodStarts(time.Now())
+		for _, period := range []struct {
+			name  string
+			since time.Time
+		}{{"today", day}, {"this_month", month}} {
+			query := c.scope.filter
+			query.Since = period.since
+			totals, err := g.usageStore.SumUsage(ctx, query)
+			if err != nil {
+				log.Warningf("summarize usage for %s: %v", c.scope.name, err)
+				break
+			}
+			details[period.name] = fmt.Sprintf("%d requests, %d failures, %d prompt tokens, %d completion tokens",
+				totals.Requests, totals.Failures, totals.RequestTokens, totals.ResponseTokens)
+		}
+	}
+	g.notifier.Publish(notify.Event{
+		Type:     notify.EventBudgetThreshold,
+		Severity: severity,
+		Tenant:   c.scope.filter.Tenant,
+		Message:  fmt.Sprintf("%s reached %d%% of its %s %s budget (%s/%s)", c.scope.name, c.percent, c.period, c.unit, c.format(c.used), c.format(c.limit)),
+		Details:  details,
+		Key:      fmt.Sprintf("%s/%s/%s/%s/%d", notify.EventBudgetThreshold, c.scope.name, c.period, c.unit, c.percent),
+	})
+}
+
+// notifyBudgetExceeded reports a request rejected by a budget.
+func (g *Gateway) notifyBudgetExceeded(tenant *tenantRoute, err error) {
+	event := notify.Event{
+		Type:     notify.EventBudgetExceeded,
+		Severity: notify.SeverityWarning,
+		Message:  err.Error(),
+	}
+	if tenant != nil {
+		event.Tenant = tenant.config.ID
+	}
+	g.notifier.Publish(event)
+}
+
+// notifyAllProvidersFailed reports a request that no candidate provider could serve.
+func (g *Gateway) notifyAllProvidersFailed(ctx context.Context, model string, attempts int, lastErr error) {
+	identity, _ := internalmw.IdentityFromContext(ctx)
+	g.notifier.Publish(notify.Event{
+		Type:     notify.EventAllProvidersFailed,
+		Severity: notify.SeverityCritical,
+		Model:    model,
+		Tenant:   identity.Tenant,
+		Message:  fmt.Sprintf("all providers failed for model %s", model),
+		Details:  map[string]any{"attempts": attempts, "last_error": shortenErrorMessage(lastErr.Error())},
+		Key:      fmt.Sprintf("%s/%s/%s", notify.EventAllProvidersFailed, g.routeName(model), identity.Tenant),
+	})
+}
+
+// routeName returns the configured model, group or discovered model a request
+// for model is routed by, or "default_provider" for models that are not
+// configured, so names chosen by clients do not end up in notification keys.
+func (g *Gateway) routeName(model string) string {
+	if _, ok := g.models[model]; ok {
+		return model
+	}
+	if _, ok := g.groups[model]; ok {
+		return model
+	}
+	g.discoveredMu.RLock()
+	_, ok := g.discovered[model]
+	g.discoveredMu.RUnlock()
+	if ok {
+		return model
+	}
+	return "default_provider"
+}
@@ -0,0 +1,109 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/notify"
+)
+
+func TestProxyNotifiesOnProviderFailures(t *testing.T) {
+	events := make(chan notify.Event, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event notify.Event
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	t.Cleanup(hook.Close)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+
+	cfg := &config.Config{
+		ProviderUnhealthyThreshold: 2,
+		Notifiers:                  []config.NotifierConfig{{Name: "ops", Type: "webhook", URL: hook.URL}},
+		Providers:                  []config.ProviderConfig{{ID: "p1", BaseURL: failing.URL, AccessToken: "token"}},
+		Models:                     []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o"}`)))
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("expected upstream status to be relayed, got %d", rec.Code)
+		}
+	}
+
+	seen := make(map[notify.EventType]int)
+	timeout := time.After(2 * time.Second)
+	for len(seen) < 2 || seen[notify.EventAllProvidersFailed] < 2 {
+		select {
+		case event := <-events:
+			seen[event.Type]++
+		case <-timeout:
+			t.Fatalf("missing notifications, got %v", seen)
+		}
+	}
+	if seen[notify.EventProviderUnhealthy] != 1 {
+		t.Fatalf("expected a single unhealthy notification, got %v", seen)
+	}
+}
+
+func TestClientErrorsLeaveProviderHealthy(t *testing.T) {
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(rejecting.Close)
+
+	cfg := &config.Config{
+		ProviderUnhealthyThreshold: 1,
+		Providers:                  []config.ProviderConfig{{ID: "p1", BaseURL: rejecting.URL, AccessToken: "token"}},
+		Models:                     []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o"}`)))
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected upstream status to be relayed, got %d", rec.Code)
+	}
+	if failures, _ := gw.health.snapshot("p1"); failures != 0 {
+		t.Fatalf("expected a client error not to count as a failure, got %d", failures)
+	}
+	if got := gw.routeName("made-up-model"); got != "default_provider" {
+		t.Fatalf("expected unconfigured models to share a key, got %q", got)
+	}
+}
+
+func TestErrorRateWindowSlides(t *testing.T) {
+	w := newErrorRateWindow(time.Minute)
+	now := time.Unix(1700000000, 0)
+	w.now = func() time.Time { return now }
+
+	w.add("p1", true)
+	w.add("p1", false)
+	if total, failures := w.add("p1", true); total != 3 || failures != 2 {
+		t.Fatalf("expected 3 requests with 2 failures, got %d/%d", total, failures)
+	}
+
+	now = now.Add(61 * time.Second)
+	if total, failures := w.add("p1", false); total != 1 || failures != 0 {
+		t.Fatalf("expected old samples to expire, got %d/%d", total, failures)
+	}
+}
@@ -0,0 +1,175 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/notify"
+)
+
+// HealthCheckStatus is the last active health check of a provider.
+type HealthCheckStatus struct {
+	WarmupResult
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// Failing reports that the provider is skipped until a check passes
+	Failing bool `json:"failing"`
+}
+
+// healthChecks keeps the outcome of the active health checks per provider.
+type healthChecks struct {
+	mu       sync.Mutex
+	statuses map[string]*HealthCheckStatus
+}
+
+// record stores a check result and reports whether the provider just started
+// or stopped failing.
+func (h *healthChecks) record(provider string, result WarmupResult, threshold int) (failing, recovered bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.statuses == nil {
+		h.statuses = make(map[string]*HealthCheckStatus)
+	}
+	st, ok := h.statuses[provider]
+	if !ok {
+		st = &HealthCheckStatus{}
+		h.statuses[provider] = st
+	}
+	st.WarmupResult = result
+	if result.Success {
+		recovered = st.Failing
+		st.ConsecutiveFailures = 0
+		st.Failing = false
+		return false, recovered
+	}
+	st.ConsecutiveFailures++
+	if !st.Failing && st.ConsecutiveFailures >= threshold {
+		st.Failing = true
+		return true, false
+	}
+	return false, false
+}
+
+func (h *healthChecks) status(provider string) (HealthCheckStatus, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st, ok := h.statuses[provider]
+	if !ok {
+		return HealthCheckStatus{}, false
+	}
+	return *st, true
+}
+
+func (h *healthChecks) failing(provider string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st, ok := h.statuses[provider]
+	return ok && st.Failing
+}
+
+// RunHealthChecks checks every provider at startup and then every
+// health_check.interval_seconds until ctx is done. Providers failing
+// failure_threshold checks in a row are skipped when routing until a check
+// passes again.
+func (g *Gateway) RunHealthChecks(ctx context.Context) {
+	if g.cfg.HealthCheck == nil {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(g.cfg.HealthCheck.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		g.checkProviders(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkProviders checks the providers with health checks enabled in parallel
+// and returns when all of them answered or timed out.
+func (g *Gateway) checkProviders(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, provider := range g.cfg.Providers {
+		if !provider.HealthChecked() {
+			continue
+		}
+		wg.Add(1)
+		go func(provider config.ProviderConfig) {
+			defer wg.Done()
+			g.checkProvider(ctx, provider)
+		}(provider)
+	}
+	wg.Wait()
+}
+
+func (g *Gateway) checkProvider(ctx context.Context, provider config.ProviderConfig) {
+	check := g.cfg.HealthCheck
+	checkCtx, cancel := context.WithTimeout(ctx, time.Duration(check.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	result := g.pingProvider(checkCtx, provider, check.Mode)
+	if ctx.Err() != nil {
+		// The gateway is shutting down, the failure says nothing about the provider.
+		return
+	}
+	// In connect mode a client error still shows the provider is up.
+	if result.Success && result.StatusCode >= http.StatusInternalServerError {
+		result.Success = false
+		result.Error = fmt.Sprintf("unexpected status %d", result.StatusCode)
+	}
+
+	failing, recovered := g.checks.record(provider.ID, result, check.FailureThreshold)
+	switch {
+	case failing:
+		log.Warningf("provider %s failed %d health checks in a row and is skipped: %s", provider.ID, check.FailureThreshold, result.Error)
+		g.notifier.Publish(notify.Event{
+			Type:     notify.EventCircuitOpen,
+			Severity: notify.SeverityWarning,
+			Provider: provider.ID,
+			Message:  fmt.Sprintf("provider %s failed %d health checks in a row and is out of rotation until one passes", provider.ID, check.FailureThreshold),
+			Details:  map[string]any{"last_error": shortenErrorMessage(result.Error), "mode": check.Mode},
+		})
+	case recovered:
+		log.Infof("provider %s passed a health check and is back in rotation", provider.ID)
+		g.notifier.Publish(notify.Event{
+			Type:     notify.EventProviderRecovered,
+			Severity: notify.SeverityInfo,
+			Provider: provider.ID,
+			Message:  fmt.Sprintf("provider %s passed a health check and is back in rotation", provider.ID),
+			Details:  map[string]any{"check_latency_ms": result.Latency.Milliseconds()},
+		})
+	case !result.Success:
+		log.Debugf("health check of provider %s failed: %s", provider.ID, result.Error)
+	}
+}
+
+// skipFailingChecks drops candidates whose provider fails its health checks.
+// If that would leave nothing, all candidates are kept and tried.
+func (g *Gateway) skipFailingChecks(modelName string, candidates []ruleProvider) []ruleProvider {
+	if g.cfg.HealthCheck == nil {
+		return candidates
+	}
+	var kept []ruleProvider
+	for _, c := range candidates {
+		if g.checks.failing(c.id) {
+			log.Debugf("[%s] skip provider %s: failing health checks", modelName, c.id)
+			continue
+		}
+		kept = append(kept, c)
+	}
+	if len(kept) == 0 {
+		return candidates
+	}
+	return kept
+}
@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestHealthChecksSkipFailingProviders(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" {
+			t.Errorf("unexpected health check path %s", r.URL.Path)
+		}
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(flaky.Close)
+	var unchecked atomic.Int64
+	quiet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		unchecked.Add(1)
+	}))
+	t.Cleanup(quiet.Close)
+
+	disabled := false
+	cfg := &config.Config{
+		HealthCheck: &config.HealthCheckConfig{Mode: config.WarmupConnect, IntervalSeconds: 30, TimeoutSeconds: 5, FailureThreshold: 2},
+		Providers: []config.ProviderConfig{
+			{ID: "flaky", BaseURL: flaky.URL, AccessToken: "t"},
+			{ID: "quiet", BaseURL: quiet.URL, AccessToken: "t", HealthCheck: &disabled},
+		},
+		Models: []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "flaky"}, {ID: "quiet"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	first := func() string {
+		candidates := gw.selectProviders(gw.models["gpt-4o"], "gpt-4o", 0, "/v1/chat/completions")
+		return gw.skipFailingChecks("gpt-4o", candidates)[0].id
+	}
+
+	gw.checkProviders(context.Background())
+	if got := first(); got != "flaky" {
+		t.Fatalf("one failed check must not skip the provider, got %s first", got)
+	}
+	gw.checkProviders(context.Background())
+	if got := first(); got != "quiet" {
+		t.Fatalf("expected the failing provider to be skipped, got %s first", got)
+	}
+	status, ok := gw.checks.status("flaky")
+	if !ok || !status.Failing || status.ConsecutiveFailures != 2 || status.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected health check status %+v", status)
+	}
+
+	down.Store(false)
+	gw.checkProviders(context.Background())
+	if got := first(); got != "flaky" {
+		t.Fatalf("expected a client error to pass the check, got %s first", got)
+	}
+	if unchecked.Load() != 0 {
+		t.Fatal("providers with health_check disabled must not be checked")
+	}
+	if _, ok := gw.checks.status("quiet"); ok {
+		t.Fatal("expected no health check status for a disabled provider")
+	}
+}
@@ -0,0 +1,287 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// Sources of inspected text.
+const (
+	sourcePrompt     = "prompt"
+	sourceToolOutput = "tool_output"
+)
+
+// classifierRule names detections made by the external classifier.
+const classifierRule = "classifier"
+
+var builtinInspectionRules = []config.InspectionRule{
+	{Name: "ignore_instructions", Regex: `\b(ignore|disregard|forget|override)\b.{0,40}\b(previous|prior|above|earlier|all|your)\b.{0,40}\b(instructions?|prompts?|rules|directions|guidelines)\b`},
+	{Name: "reveal_system_prompt", Regex: `\b(reveal|show|print|repeat|output|leak)\b.{0,40}\b(system prompt|hidden instructions|initial instructions|developer message)\b`},
+	{Name: "jailbreak_persona", Regex: `\b(do anything now|developer mode|jailbreak(ed)?|DAN mode)\b`},
+	{Name: "restriction_bypass", Regex: `\b(without|no|bypass|remove)\b.{0,20}\b(restrictions|filters|guardrails|safety (rules|guidelines))\b`},
+}
+
+type inspectionRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// detection is a suspicious piece of text found in a request.
+type detection struct {
+	rule   string
+	source string
+}
+
+func (d detection) String() string {
+	return d.rule + "@" + d.source
+}
+
+// errPromptBlocked rejects requests the inspection stage considers malicious.
+// The message deliberately does not name the rule that matched.
+var errPromptBlocked = errors.New("request blocked by prompt inspection")
+
+// InspectionStats counts the work of the prompt inspection stage since startup.
+type InspectionStats struct {
+	Inspected        int64            `json:"inspected"`
+	Detections       int64            `json:"detections"`
+	Blocked          int64            `json:"blocked"`
+	ClassifierErrors int64            `json:"classifier_errors"`
+	ByRule           map[string]int64 `json:"by_rule"`
+	ByModel          map[string]int64 `json:"by_model"`
+	BySource         map[string]int64 `json:"by_source"`
+}
+
+type promptInspector struct {
+	cfg   *config.PromptInspectionConfig
+	rules []inspectionRule
+
+	mu    sync.Mutex
+	stats InspectionStats
+}
+
+func newPromptInspector(cfg *config.PromptInspectionConfig) *promptInspector {
+	if cfg == nil {
+		return nil
+	}
+	var rules []config.InspectionRule
+	if !cfg.DisableBuiltin {
+		rules = append(rules, builtinInspectionRules...)
+	}
+	rules = append(rules, cfg.Rules...)
+
+	p := &promptInspector{cfg: cfg, stats: InspectionStats{
+		ByRule:   make(map[string]int64),
+		ByModel:  make(map[string]int64),
+		BySource: make(map[string]int64),
+	}}
+	for _, rule := range rules {
+		// Rules were validated with the configuration.
+		p.rules = append(p.rules, inspectionRule{name: rule.Name, pattern: regexp.MustCompile("(?i)" + rule.Regex)})
+	}
+	return p
+}
+
+func (p *promptInspector) enabledFor(model string) bool {
+	return p != nil && (len(p.cfg.Models) == 0 || slices.Contains(p.cfg.Models, model))
+}
+
+// inspectPrompt checks the prompt and tool outputs of a request for the model.
+// It returns the first detection, and errPromptBlocked when the request must
+// be rejected.
+func (g *Gateway) inspectPrompt(ctx context.Context, model string, body []byte) (*detection, error) {
+	p := g.inspector
+	if !p.enabledFor(model) {
+		return nil, nil
+	}
+	prompt, toolOutput := inspectionText(body)
+
+	var found *detection
+	for _, part := range []struct{ source, text string }{{sourcePrompt, prompt}, {sourceToolOutput, toolOutput}} {
+		if part.text == "" {
+			continue
+		}
+		if rule := p.match(part.text); rule != "" {
+			found = &detection{rule: rule, source: part.source}
+			break
+		}
+		if p.cfg.Classifier != nil && g.classify(ctx, p.cfg.Classifier, part.text) {
+			found = &detection{rule: classifierRule, source: part.source}
+			break
+		}
+	}
+
+	blocked := found != nil && p.cfg.Action == config.InspectionBlock
+	p.record(model, found, blocked)
+	if blocked {
+		return found, errPromptBlocked
+	}
+	return found, nil
+}
+
+func (p *promptInspector) match(text string) string {
+	for _, rule := range p.rules {
+		if rule.pattern.MatchString(text) {
+			return rule.name
+		}
+	}
+	return ""
+}
+
+func (p *promptInspector) record(model string, found *detection, blocked bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Inspected++
+	if found == nil {
+		return
+	}
+	p.stats.Detections++
+	if blocked {
+		p.stats.Blocked++
+	}
+	p.stats.ByRule[found.rule]++
+	p.stats.ByModel[model]++
+	p.stats.BySource[found.source]++
+}
+
+// classify asks the external classifier about text. Failures are counted and
+// treated as clean text, so an unavailable classifier does not block traffic.
+func (g *Gateway) classify(ctx context.Context, cfg *config.InspectionClassifier, text string) bool {
+	flagged, err := g.callClassifier(ctx, cfg, text)
+	if err != nil {
+		g.inspector.mu.Lock()
+		g.inspector.stats.ClassifierErrors++
+		g.inspector.mu.Unlock()
+		return false
+	}
+	return flagged
+}
+
+func (g *Gateway) callClassifier(ctx context.Context, cfg *config.InspectionClassifier, text string) (bool, error) {
+	payload, err := json.Marshal(map[string]string{"input": text})
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.AccessToken)
+	}
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("classifier returned status %d", resp.StatusCode)
+	}
+	if score := gjson.GetBytes(respBody, "score"); score.Exists() {
+		return score.Float() >= cfg.Threshold, nil
+	}
+	if flagged := gjson.GetBytes(respBody, "flagged"); flagged.Exists() {
+		return flagged.Bool(), nil
+	}
+	return false, fmt.Errorf("unexpected classifier response: %s", strings.TrimSpace(string(respBody)))
+}
+
+// InspectionStats returns a snapshot of the prompt inspection counters, or
+// nil when prompt inspection is disabled.
+func (g *Gateway) InspectionStats() *InspectionStats {
+	p := g.inspector
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.ByRule = maps.Clone(p.stats.ByRule)
+	stats.ByModel = maps.Clone(p.stats.ByModel)
+	stats.BySource = maps.Clone(p.stats.BySource)
+	return &stats
+}
+
+// inspectionText splits the text of a request into what the client wrote and
+// what tools returned: OpenAI "tool" messages, Anthropic "tool_result" blocks
+// and Responses API "function_call_output" items.
+func inspectionText(body []byte) (string, string) {
+	var prompt, tools []string
+	text := func(value gjson.Result) []string {
+		if value.Type == gjson.String {
+			return []string{value.String()}
+		}
+		var parts []string
+		value.ForEach(func(_, item gjson.Result) bool {
+			if item.Type == gjson.String {
+				parts = append(parts, item.String())
+			} else if t := item.Get("text"); t.Exists() {
+				parts = append(parts, t.String())
+			}
+			return true
+		})
+		return parts
+	}
+
+	for _, field := range []string{"system", "instructions", "prompt"} {
+		if value := gjson.GetBytes(body, field); value.Exists() {
+			prompt = append(prompt, text(value)...)
+		}
+	}
+	if input := gjson.GetBytes(body, "input"); input.Type == gjson.String {
+		prompt = append(prompt, input.String())
+	} else {
+		input.ForEach(func(_, item gjson.Result) bool {
+			if item.Get("type").String() == "function_call_output" {
+				tools = append(tools, item.Get("output").String())
+			} else if content := item.Get("content"); content.Exists() {
+				prompt = append(prompt, text(content)...)
+			}
+			return true
+		})
+	}
+	gjson.GetBytes(body, "messages").ForEach(func(_, message gjson.Result) bool {
+		content := message.Get("content")
+		switch message.Get("role").String() {
+		case "tool", "function":
+			tools = append(tools, text(content)...)
+			return true
+		}
+		if content.Type == gjson.String {
+			prompt = append(prompt, content.String())
+			return true
+		}
+		content.ForEach(func(_, block gjson.Result) bool {
+			if block.Get("type").String() == "tool_result" {
+				tools = append(tools, text(block.Get("content"))...)
+			} else if t := block.Get("text"); t.Exists() {
+				prompt = append(prompt, t.String())
+			}
+			return true
+		})
+		return true
+	})
+	return strings.Join(prompt, "\n"), strings.Join(tools, "\n")
+}
@@ -0,0 +1,15 @@
+package gateway
+
+import (
+	"bytes"
+)
+
+// keepalivePing is an SSE comment; clients ignore it, but it keeps proxies and
+// browsers from closing a stream the provider is silent on.
+var keepalivePing = []byte(": ping\n\n")
+
+// endsEvent reports whether data ends with the blank line that terminates an
+// SSE event.
+func endsEvent(data []byte) bool {
+	return bytes.HasSuffix(data, []byte("\n\n")) || bytes.HasSuffix(data, []byte("\r\n\r\n"))
+}
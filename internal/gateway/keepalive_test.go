@@ -0,0 +1,54 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopyStreamSendsPingsBetweenEvents(t *testing.T) {
+	src, upstream := io.Pipe()
+	go func() {
+		for _, part := range []string{"data: a\n\n", "data: b", "\n\n"} {
+			_, _ = upstream.Write([]byte(part))
+			time.Sleep(60 * time.Millisecond)
+		}
+		_ = upstream.Close()
+	}()
+
+	rec := httptest.NewRecorder()
+	var capture bytes.Buffer
+	if err := copyStream(rec, src, &capture, streamCopy{keepalive: 20 * time.Millisecond}); err != nil {
+		t.Fatalf("copy event stream: %v", err)
+	}
+
+	if got := capture.String(); got != "data: a\n\ndata: b\n\n" {
+		t.Fatalf("unexpected captured stream %q", got)
+	}
+	body := rec.Body.String()
+	first, second, ok := strings.Cut(body, "data: b")
+	if !ok {
+		t.Fatalf("missing second event in %q", body)
+	}
+	if !strings.HasPrefix(first, "data: a\n\n: ping\n\n") {
+		t.Fatalf("expected pings after the first event, got %q", first)
+	}
+	if second != "\n\n" && !strings.HasPrefix(second, "\n\n: ping") {
+		t.Fatalf("ping split an event: %q", second)
+	}
+	if !rec.Flushed {
+		t.Fatalf("expected the stream to be flushed")
+	}
+}
+
+func TestCopyStreamReturnsSourceError(t *testing.T) {
+	src, upstream := io.Pipe()
+	_ = upstream.CloseWithError(io.ErrUnexpectedEOF)
+	var capture bytes.Buffer
+	if err := copyStream(httptest.NewRecorder(), src, &capture, streamCopy{keepalive: time.Second}); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected unexpected EOF, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// langfuseEvent is an event of the Langfuse ingestion API.
+type langfuseEvent struct {
+	ID        string         `json:"id"`
+	Timestamp time.Time      `json:"timestamp"`
+	Type      string         `json:"type"`
+	Body      map[string]any `json:"body"`
+}
+
+// langfuseSink sends each request as a trace, with a generation for every
+// provider attempt.
+type langfuseSink struct {
+	cfg    config.LangfuseConfig
+	client *http.Client
+}
+
+func newLangfuseSink(cfg config.LangfuseConfig) *langfuseSink {
+	if cfg.Host == "" {
+		cfg.Host = "https://cloud.langfuse.com"
+	}
+	return &langfuseSink{cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (s *langfuseSink) name() string { return "langfuse" }
+
+func (s *langfuseSink) send(ctx context.Context, batch []exportedRequest) error {
+	events := make([]langfuseEvent, 0, 2*len(batch))
+	for _, req := range batch {
+		events = append(events, langfuseEvents(req)...)
+	}
+	payload, err := json.Marshal(map[string]any{"batch": events})
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.cfg.Host, "/")+"/api/public/ingestion", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.SetBasicAuth(s.cfg.PublicKey, s.cfg.SecretKey)
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	// Events are validated one by one: 207 lists the rejected ones.
+	if rejected := gjson.GetBytes(body, "errors"); rejected.IsArray() && len(rejected.Array()) > 0 {
+		first := rejected.Array()[0]
+		return fmt.Errorf("%d events rejected, first: %s", len(rejected.Array()), first.Get("message").String())
+	}
+	return nil
+}
+
+// langfuseEvents returns the trace of a request and, when a provider was
+// called, the generation of the attempt.
+func langfuseEvents(req exportedRequest) []langfuseEvent {
+	record := req.record
+	metadata := exportedMetadata(record)
+
+	trace := map[string]any{
+		"id":        record.RequestID,
+		"timestamp": record.CreatedAt,
+		"name":      exportedModel(record),
+		"metadata":  metadata,
+	}
+	if req.input != nil {
+		trace["input"] = req.input
+	}
+	if req.output != "" {
+		trace["output"] = req.output
+	}
+	if record.Tenant != "" {
+		trace["userId"] = record.Tenant
+	}
+	events := []langfuseEvent{{ID: uuid.NewString(), Timestamp: time.Now(), Type: "trace-create", Body: trace}}
+	if record.Provider == "" {
+		return events
+	}
+
+	generation := map[string]any{
+		"id":              record.RequestID + "-" + strconv.Itoa(record.Attempt),
+		"traceId":         record.RequestID,
+		"name":            record.Provider,
+		"startTime":       record.CreatedAt,
+		"endTime":         record.CreatedAt.Add(record.Duration),
+		"model":           record.Model,
+		"modelParameters": req.params,
+		"metadata":        metadata,
+		"usageDetails": map[string]int{
+			"input":  record.RequestTokens,
+			"output": record.ResponseTokens,
+			"total":  record.RequestTokens + record.ResponseTokens,
+		},
+	}
+	if record.FirstTokenLatency > 0 {
+		generation["completionStartTime"] = record.CreatedAt.Add(record.FirstTokenLatency)
+	}
+	if req.input != nil {
+		generation["input"] = req.input
+	}
+	if req.output != "" {
+		generation["output"] = req.output
+	}
+	if req.cost != nil {
+		generation["costDetails"] = map[string]float64{"input": req.cost.input, "output": req.cost.output, "total": req.cost.input + req.cost.output}
+	}
+	if record.Outcome != "success" {
+		generation["level"] = "ERROR"
+		if record.Outcome == storage.OutcomeClientCancelled || record.Outcome == storage.OutcomeSlowClient {
+			generation["level"] = "WARNING"
+		}
+		generation["statusMessage"] = record.Error
+	}
+	return append(events, langfuseEvent{ID: uuid.NewString(), Timestamp: time.Now(), Type: "generation-create", Body: generation})
+}
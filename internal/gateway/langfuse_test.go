@@ -0,0 +1,92 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestLangfuseExportsTraces(t *testing.T) {
+	batches := make(chan []byte, 4)
+	langfuse := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "pk-lf" || pass != "sk-lf" || r.URL.Path != "/api/public/ingestion" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		batches <- body
+		w.WriteHeader(http.StatusMultiStatus)
+		_, _ = w.Write([]byte(`{"successes":[],"errors":[]}`))
+	}))
+	t.Cleanup(langfuse.Close)
+
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"c1","choices":[{"message":{"role":"assistant","content":"hello"}}],"usage":{"completion_tokens":4}}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		Exporters: &config.ExportersConfig{
+			FlushIntervalSeconds: 3600,
+			Langfuse:             &config.LangfuseConfig{Host: langfuse.URL, PublicKey: "pk-lf", SecretKey: "sk-lf"},
+		},
+		Pricing:   &config.PricingConfig{Prices: []config.ProviderPrice{{Model: "gpt-4o-2024", Input: 2.5, Output: 10}}},
+		Providers: []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:    []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1", Model: "gpt-4o-2024"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gw.RunExporters(ctx)
+	}()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o","temperature":0.2,"messages":[{"role":"user","content":"hi"}]}`)))
+	req.Header.Set("X-Request-ID", "req-1")
+	gw.Proxy(httptest.NewRecorder(), req, RequestTypeChatCompletions)
+
+	// The queued events are sent when the exporter stops.
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("exporter did not stop")
+	}
+
+	var batch []byte
+	select {
+	case batch = <-batches:
+	default:
+		t.Fatal("no batch was sent")
+	}
+	trace := gjson.GetBytes(batch, `batch.#(type=="trace-create").body`)
+	if trace.Get("id").String() != "req-1" || trace.Get("name").String() != "gpt-4o" || trace.Get("output").String() != "hello" {
+		t.Fatalf("unexpected trace %s", trace.Raw)
+	}
+	if trace.Get("input.0.content").String() != "hi" {
+		t.Fatalf("prompt missing from trace %s", trace.Raw)
+	}
+	generation := gjson.GetBytes(batch, `batch.#(type=="generation-create").body`)
+	if generation.Get("traceId").String() != "req-1" || generation.Get("model").String() != "gpt-4o-2024" || generation.Get("name").String() != "p1" {
+		t.Fatalf("unexpected generation %s", generation.Raw)
+	}
+	if generation.Get("usageDetails.output").Int() != 4 || generation.Get("modelParameters.temperature").Float() != 0.2 {
+		t.Fatalf("unexpected usage or parameters %s", generation.Raw)
+	}
+	if cost := generation.Get("costDetails.output").Float(); cost != 4*10/1e6 {
+		t.Fatalf("unexpected output cost %v", cost)
+	}
+}
@@ -0,0 +1,124 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// langsmithSink sends each provider attempt as a run through the LangSmith
+// batch run API. Requests blocked before reaching a provider are chain runs.
+type langsmithSink struct {
+	cfg    config.LangSmithConfig
+	client *http.Client
+}
+
+func newLangSmithSink(cfg config.LangSmithConfig) *langsmithSink {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://api.smith.langchain.com"
+	}
+	if cfg.Project == "" {
+		cfg.Project = "default"
+	}
+	return &langsmithSink{cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (s *langsmithSink) name() string { return "langsmith" }
+
+func (s *langsmithSink) send(ctx context.Context, batch []exportedRequest) error {
+	runs := make([]map[string]any, 0, len(batch))
+	for _, req := range batch {
+		runs = append(runs, s.run(req))
+	}
+	payload, err := json.Marshal(map[string]any{"post": runs})
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.cfg.Endpoint, "/")+"/runs/batch", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", s.cfg.APIKey)
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (s *langsmithSink) run(req exportedRequest) map[string]any {
+	record := req.record
+	// The id is derived from the request so a resent batch does not create duplicates.
+	id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(record.RequestID+"-"+strconv.Itoa(record.Attempt))).String()
+
+	metadata := exportedMetadata(record)
+	runType := "chain"
+	if record.Provider != "" {
+		runType = "llm"
+		metadata["ls_provider"] = record.Provider
+		metadata["ls_model_name"] = record.Model
+	}
+	usage := map[string]any{
+		"input_tokens":  record.RequestTokens,
+		"output_tokens": record.ResponseTokens,
+		"total_tokens":  record.RequestTokens + record.ResponseTokens,
+	}
+	if req.cost != nil {
+		usage["input_cost"] = req.cost.input
+		usage["output_cost"] = req.cost.output
+		usage["total_cost"] = req.cost.input + req.cost.output
+	}
+	outputs := map[string]any{"usage_metadata": usage}
+	if req.output != "" {
+		outputs["output"] = req.output
+	}
+	inputs := map[string]any{}
+	if req.input != nil {
+		inputs["messages"] = req.input
+	}
+
+	run := map[string]any{
+		"id":           id,
+		"trace_id":     id,
+		"dotted_order": langsmithDottedOrder(record.CreatedAt, id),
+		"name":         exportedModel(record),
+		"run_type":     runType,
+		"start_time":   record.CreatedAt.UTC(),
+		"end_time":     record.CreatedAt.Add(record.Duration).UTC(),
+		"inputs":       inputs,
+		"outputs":      outputs,
+		"extra":        map[string]any{"metadata": metadata, "invocation_params": req.params},
+		"session_name": s.cfg.Project,
+	}
+	if record.FirstTokenLatency > 0 {
+		run["events"] = []map[string]any{{"name": "new_token", "time": record.CreatedAt.Add(record.FirstTokenLatency).UTC()}}
+	}
+	if record.Outcome != "success" {
+		run["error"] = record.Outcome + ": " + record.Error
+	}
+	return run
+}
+
+// langsmithDottedOrder is the ordering key of a root run: its start time in
+// microseconds followed by its id.
+func langsmithDottedOrder(start time.Time, id string) string {
+	start = start.UTC()
+	return fmt.Sprintf("%s%06dZ%s", start.Format("20060102T150405"), start.Nanosecond()/1000, id)
+}
@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestLangsmithDottedOrder(t *testing.T) {
+	start := time.Date(2025, 3, 4, 5, 6, 7, 8009000, time.UTC)
+	if got := langsmithDottedOrder(start, "abc"); got != "20250304T050607008009Zabc" {
+		t.Fatalf("unexpected dotted order %q", got)
+	}
+}
+
+func TestLangSmithExportsRuns(t *testing.T) {
+	batches := make(chan []byte, 4)
+	langsmith := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "ls-key" || r.URL.Path != "/runs/batch" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		batches <- body
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(langsmith.Close)
+
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"c1","choices":[{"message":{"role":"assistant","content":"hello"}}],"usage":{"completion_tokens":4}}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		Exporters: &config.ExportersConfig{
+			FlushIntervalSeconds: 3600,
+			LangSmith:            &config.LangSmithConfig{Endpoint: langsmith.URL, APIKey: "ls-key", Project: "gateway"},
+		},
+		Providers: []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:    []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gw.RunExporters(ctx)
+	}()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)))
+	req.Header.Set("X-Request-ID", "req-1")
+	gw.Proxy(httptest.NewRecorder(), req, RequestTypeChatCompletions)
+	cancel()
+	<-done
+
+	var batch []byte
+	select {
+	case batch = <-batches:
+	default:
+		t.Fatal("no batch was sent")
+	}
+	run := gjson.GetBytes(batch, "post.0")
+	if run.Get("run_type").String() != "llm" || run.Get("session_name").String() != "gateway" || run.Get("name").String() != "gpt-4o" {
+		t.Fatalf("unexpected run %s", run.Raw)
+	}
+	if run.Get("trace_id").String() != run.Get("id").String() || !bytes.HasSuffix([]byte(run.Get("dotted_order").String()), []byte(run.Get("id").String())) {
+		t.Fatalf("run is not a root run %s", run.Raw)
+	}
+	if run.Get("inputs.messages.0.content").String() != "hi" || run.Get("outputs.output").String() != "hello" {
+		t.Fatalf("unexpected run content %s", run.Raw)
+	}
+	if run.Get("outputs.usage_metadata.output_tokens").Int() != 4 || run.Get("extra.metadata.request_id").String() != "req-1" {
+		t.Fatalf("unexpected run usage or metadata %s", run.Raw)
+	}
+}
@@ -0,0 +1,46 @@
+package gateway
+
+import (
+	"sort"
+)
+
+const (
+	// latencyMinSamples is the number of recent first token latencies a
+	// provider needs to be ranked by the lowest_latency strategy.
+	latencyMinSamples = 5
+	// latencyExploreEvery sends one request in that many to a provider without
+	// enough samples first, so its latency is measured again.
+	latencyExploreEvery = 20
+)
+
+// orderByLatency sorts candidates by the median first token latency of the
+// model on their provider over the last minutes, fastest first. Candidates
+// without enough samples follow in their order, and every
+// latencyExploreEvery-th request tries the first of them first.
+func (g *Gateway) orderByLatency(route *modelRoute, candidates []ruleProvider, modelName string) []ruleProvider {
+	type measured struct {
+		candidate ruleProvider
+		p50       float64
+	}
+	var ranked []measured
+	var unmeasured []ruleProvider
+	for _, c := range candidates {
+		stat := g.live.model(c.id, modelName)
+		if stat.FirstTokenSamples < latencyMinSamples {
+			unmeasured = append(unmeasured, c)
+			continue
+		}
+		ranked = append(ranked, measured{candidate: c, p50: stat.FirstTokenP50Ms})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].p50 < ranked[j].p50 })
+
+	ordered := make([]ruleProvider, 0, len(candidates))
+	if len(unmeasured) > 0 && len(ranked) > 0 && route.selections.Add(1)%latencyExploreEvery == 0 {
+		ordered = append(ordered, unmeasured[0])
+		unmeasured = unmeasured[1:]
+	}
+	for _, m := range ranked {
+		ordered = append(ordered, m.candidate)
+	}
+	return append(ordered, unmeasured...)
+}
@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func TestLowestLatencyStrategy(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "slow", BaseURL: "http://slow", AccessToken: "t"},
+			{ID: "fast", BaseURL: "http://fast", AccessToken: "t"},
+			{ID: "new", BaseURL: "http://new", AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{{
+			Name:      "gpt-4o",
+			Strategy:  config.StrategyLowestLatency,
+			Providers: []config.ModelProvider{{ID: "slow"}, {ID: "fast"}, {ID: "new"}},
+		}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	route := gw.models["gpt-4o"]
+	ids := func() []string {
+		var ids []string
+		for _, p := range gw.selectProviders(route, "gpt-4o", 0, "/v1/chat/completions") {
+			ids = append(ids, p.id)
+		}
+		return ids
+	}
+
+	if got := ids(); got[0] != "slow" || got[1] != "fast" || got[2] != "new" {
+		t.Fatalf("expected the configured order without samples, got %v", got)
+	}
+
+	for i := 0; i < latencyMinSamples; i++ {
+		gw.live.observe(storage.UsageRecord{Provider: "slow", OriginalModel: "gpt-4o", Outcome: "success", FirstTokenLatency: 900 * time.Millisecond})
+		gw.live.observe(storage.UsageRecord{Provider: "fast", OriginalModel: "gpt-4o", Outcome: "success", FirstTokenLatency: 200 * time.Millisecond})
+		// Latencies of other models do not count.
+		gw.live.observe(storage.UsageRecord{Provider: "new", OriginalModel: "gpt-4o-mini", Outcome: "success", FirstTokenLatency: time.Millisecond})
+	}
+	explored := 0
+	for i := 1; i <= latencyExploreEvery; i++ {
+		got := ids()
+		switch {
+		case got[0] == "new":
+			explored++
+			if got[1] != "fast" || got[2] != "slow" {
+				t.Fatalf("unexpected exploration order %v", got)
+			}
+		case got[0] != "fast" || got[1] != "slow" || got[2] != "new":
+			t.Fatalf("expected the fastest provider first, got %v", got)
+		}
+	}
+	if explored != 1 {
+		t.Fatalf("expected one exploration in %d requests, got %d", latencyExploreEvery, explored)
+	}
+}
@@ -0,0 +1,114 @@
+package gateway
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// errParamLimit reports a request parameter that violates the model limits.
+type errParamLimit struct {
+	model  string
+	reason string
+}
+
+func (e *errParamLimit) Error() string {
+	return fmt.Sprintf("request for model %s rejected: %s", e.model, e.reason)
+}
+
+// limitsFor returns the parameter limits of the model a candidate serves: the
+// group member it was resolved from or the requested model, falling back to
+// default_limits for models without their own, such as discovered models and
+// models sent to the default provider.
+func (g *Gateway) limitsFor(modelName string, c ruleProvider) *config.ParamLimits {
+	name := modelName
+	if c.member != "" {
+		name = c.member
+	}
+	if route, ok := g.models[name]; ok && route.config.Limits != nil {
+		return route.config.Limits
+	}
+	return g.cfg.DefaultLimits
+}
+
+// outputLimitParam is the field a request type sets its output limit with.
+func outputLimitParam(reqType RequestType) string {
+	if reqType == RequestTypeResponses {
+		return "max_output_tokens"
+	}
+	return "max_tokens"
+}
+
+// applyParamLimits enforces the model's parameter limits on the request body.
+// Violations are rewritten (capped, clamped or removed), or returned as
+// *errParamLimit when the limits reject instead. A request without an output
+// limit gets max_tokens set in the field of its request type.
+func applyParamLimits(body []byte, model string, reqType RequestType, limits *config.ParamLimits) ([]byte, error) {
+	if limits == nil {
+		return body, nil
+	}
+	var err error
+	violation := func(reason string) error {
+		if limits.Reject {
+			return &errParamLimit{model: model, reason: reason}
+		}
+		return nil
+	}
+
+	for _, param := range limits.ForbiddenParams {
+		if !gjson.GetBytes(body, param).Exists() {
+			continue
+		}
+		if err := violation(fmt.Sprintf("param %s is not allowed", param)); err != nil {
+			return nil, err
+		}
+		if body, err = sjson.DeleteBytes(body, param); err != nil {
+			return nil, fmt.Errorf("remove %s: %w", param, err)
+		}
+	}
+
+	if limits.MaxTokens > 0 {
+		limited := false
+		for _, param := range []string{"max_tokens", "max_completion_tokens", "max_output_tokens"} {
+			value := gjson.GetBytes(body, param)
+			limited = limited || value.Exists()
+			if !value.Exists() || value.Int() <= int64(limits.MaxTokens) {
+				continue
+			}
+			if err := violation(fmt.Sprintf("%s %d exceeds the limit of %d", param, value.Int(), limits.MaxTokens)); err != nil {
+				return nil, err
+			}
+			if body, err = sjson.SetBytes(body, param, limits.MaxTokens); err != nil {
+				return nil, fmt.Errorf("cap %s: %w", param, err)
+			}
+		}
+		if !limited {
+			param := outputLimitParam(reqType)
+			if body, err = sjson.SetBytes(body, param, limits.MaxTokens); err != nil {
+				return nil, fmt.Errorf("set %s: %w", param, err)
+			}
+		}
+	}
+
+	if temperature := gjson.GetBytes(body, "temperature"); temperature.Exists() {
+		clamped := temperature.Float()
+		if limits.MinTemperature != nil && clamped < *limits.MinTemperature {
+			clamped = *limits.MinTemperature
+		}
+		if limits.MaxTemperature != nil && clamped > *limits.MaxTemperature {
+			clamped = *limits.MaxTemperature
+		}
+		if clamped != temperature.Float() {
+			if err := violation(fmt.Sprintf("temperature %g is out of the allowed range", temperature.Float())); err != nil {
+				return nil, err
+			}
+			if body, err = sjson.SetBytes(body, "temperature", clamped); err != nil {
+				return nil, fmt.Errorf("clamp temperature: %w", err)
+			}
+		}
+	}
+	return body, nil
+}
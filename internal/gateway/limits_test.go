@@ -0,0 +1,105 @@
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestApplyParamLimitsRewrites(t *testing.T) {
+	minT, maxT := 0.0, 1.0
+	limits := &config.ParamLimits{MaxTokens: 1024, MinTemperature: &minT, MaxTemperature: &maxT, ForbiddenParams: []string{"logit_bias", "n"}}
+	body := []byte(`{"model":"m","max_tokens":8000,"max_completion_tokens":512,"temperature":1.8,"n":4,"logit_bias":{"1":100}}`)
+
+	got, err := applyParamLimits(body, "m", RequestTypeChatCompletions, limits)
+	if err != nil {
+		t.Fatalf("apply limits: %v", err)
+	}
+	if v := gjson.GetBytes(got, "max_tokens").Int(); v != 1024 {
+		t.Fatalf("expected max_tokens capped to 1024, got %d", v)
+	}
+	if v := gjson.GetBytes(got, "max_completion_tokens").Int(); v != 512 {
+		t.Fatalf("expected max_completion_tokens below the cap to be kept, got %d", v)
+	}
+	if v := gjson.GetBytes(got, "temperature").Float(); v != 1 {
+		t.Fatalf("expected temperature clamped to 1, got %v", v)
+	}
+	if gjson.GetBytes(got, "n").Exists() || gjson.GetBytes(got, "logit_bias").Exists() {
+		t.Fatalf("expected forbidden params to be removed, got %s", got)
+	}
+}
+
+func TestApplyParamLimitsRejects(t *testing.T) {
+	limits := &config.ParamLimits{MaxTokens: 1024, Reject: true}
+
+	if _, err := applyParamLimits([]byte(`{"model":"m","max_tokens":100}`), "m", RequestTypeChatCompletions, limits); err != nil {
+		t.Fatalf("expected a compliant request to pass, got %v", err)
+	}
+	_, err := applyParamLimits([]byte(`{"model":"m","max_tokens":2000}`), "m", RequestTypeChatCompletions, limits)
+	var limitErr *errParamLimit
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected errParamLimit, got %v", err)
+	}
+}
+
+func TestApplyParamLimitsSetsMissingOutputLimit(t *testing.T) {
+	limits := &config.ParamLimits{MaxTokens: 1024}
+
+	got, err := applyParamLimits([]byte(`{"model":"m","input":"hi"}`), "m", RequestTypeResponses, limits)
+	if err != nil {
+		t.Fatalf("apply limits: %v", err)
+	}
+	if v := gjson.GetBytes(got, "max_output_tokens").Int(); v != 1024 {
+		t.Fatalf("expected max_output_tokens to be set to 1024, got %s", got)
+	}
+	got, err = applyParamLimits([]byte(`{"model":"m","max_completion_tokens":10}`), "m", RequestTypeChatCompletions, limits)
+	if err != nil {
+		t.Fatalf("apply limits: %v", err)
+	}
+	if gjson.GetBytes(got, "max_tokens").Exists() {
+		t.Fatalf("expected an existing output limit to be kept, got %s", got)
+	}
+}
+
+func TestProxyAppliesLimitsOfTheResolvedModel(t *testing.T) {
+	bodies := make(chan []byte, 4)
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+		_, _ = w.Write([]byte(`{"id":"c1"}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		Default:       "p1",
+		DefaultLimits: &config.ParamLimits{MaxTokens: 100},
+		Providers:     []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models: []config.ModelConfig{
+			{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}, Limits: &config.ParamLimits{MaxTokens: 500}},
+		},
+		Groups: []config.GroupConfig{{Name: "smart", Models: []config.GroupMember{{Model: "gpt-4o"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	for model, want := range map[string]int64{"smart": 500, "unconfigured": 100} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"`+model+`","max_tokens":4000}`)))
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d: %s", model, rec.Code, rec.Body.String())
+		}
+		if got := gjson.GetBytes(<-bodies, "max_tokens").Int(); got != want {
+			t.Fatalf("%s: expected max_tokens capped to %d, got %d", model, want, got)
+		}
+	}
+}
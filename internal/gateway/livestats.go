@@ -0,0 +1,234 @@
+package gateway
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+const (
+	// liveStatsBuckets one second buckets make up the sliding window of the
+	// request and error counts.
+	liveStatsBuckets = 60
+	// liveStatsAlpha is the weight of a new latency in the moving averages.
+	liveStatsAlpha = 0.2
+	// liveStatsLatencySamples and liveStatsLatencyWindow bound the first token
+	// latencies the percentiles are computed from.
+	liveStatsLatencySamples = 100
+	liveStatsLatencyWindow  = 5 * time.Minute
+)
+
+// LiveStat is the recent traffic of a provider, or of a model on a provider,
+// as seen by the gateway over the last minute.
+type LiveStat struct {
+	Provider string `json:"provider"`
+	// Model is empty for the totals of the provider
+	Model    string `json:"model,omitempty"`
+	Requests int64  `json:"requests"`
+	Failures int64  `json:"failures"`
+	// ErrorRate is failures divided by requests in the window
+	ErrorRate float64 `json:"error_rate"`
+	// RequestsPerSecond and TokensPerSecond are the throughput over the window
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	TokensPerSecond   float64 `json:"tokens_per_second"`
+	// LatencyMs and FirstTokenMs are exponentially weighted moving averages
+	// of successful requests
+	LatencyMs    float64 `json:"latency_ms"`
+	FirstTokenMs float64 `json:"first_token_ms"`
+	// FirstTokenP50Ms and FirstTokenP95Ms are percentiles of the last
+	// FirstTokenSamples first token latencies within five minutes
+	FirstTokenP50Ms   float64 `json:"first_token_p50_ms"`
+	FirstTokenP95Ms   float64 `json:"first_token_p95_ms"`
+	FirstTokenSamples int     `json:"first_token_samples"`
+	WindowSecs        int     `json:"window_seconds"`
+}
+
+type liveStatsKey struct {
+	provider string
+	model    string
+}
+
+// liveStats aggregates the usage records of provider attempts in memory, so
+// routing rules and the admin API see current error rates and latencies
+// without querying the store. Each series has its own lock.
+type liveStats struct {
+	series sync.Map // liveStatsKey -> *liveSeries
+	now    func() time.Time
+}
+
+type liveSeries struct {
+	mu           sync.Mutex
+	buckets      [liveStatsBuckets]liveBucket
+	latencyMs    float64
+	firstTokenMs float64
+	firstTokens  []latencySample
+}
+
+type liveBucket struct {
+	second   int64
+	requests int64
+	failures int64
+	tokens   int64
+}
+
+func newLiveStats() *liveStats {
+	return &liveStats{now: time.Now}
+}
+
+// observe counts a provider attempt for its provider and for its model.
+// Blocked requests never reached a provider and are left out.
+func (s *liveStats) observe(record storage.UsageRecord) {
+	if record.Provider == "" || record.Outcome == "blocked" {
+		return
+	}
+	now := s.now()
+	s.seriesFor(liveStatsKey{provider: record.Provider}).observe(now, record)
+	s.seriesFor(liveStatsKey{provider: record.Provider, model: exportedModel(record)}).observe(now, record)
+}
+
+func (s *liveStats) seriesFor(key liveStatsKey) *liveSeries {
+	if series, ok := s.series.Load(key); ok {
+		return series.(*liveSeries)
+	}
+	series, _ := s.series.LoadOrStore(key, &liveSeries{})
+	return series.(*liveSeries)
+}
+
+func (l *liveSeries) observe(at time.Time, record storage.UsageRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := at.Unix()
+	b := &l.buckets[now%liveStatsBuckets]
+	if b.second != now {
+		*b = liveBucket{second: now}
+	}
+	b.requests++
+	b.tokens += int64(record.RequestTokens + record.ResponseTokens)
+	if record.Outcome != "success" {
+		b.failures++
+		return
+	}
+	l.latencyMs = ewma(l.latencyMs, float64(record.Duration.Milliseconds()))
+	if record.FirstTokenLatency > 0 {
+		l.firstTokenMs = ewma(l.firstTokenMs, float64(record.FirstTokenLatency.Milliseconds()))
+		if len(l.firstTokens) == liveStatsLatencySamples {
+			l.firstTokens = append(l.firstTokens[:0], l.firstTokens[1:]...)
+		}
+		l.firstTokens = append(l.firstTokens, latencySample{at: at, latency: record.FirstTokenLatency})
+	}
+}
+
+func (l *liveSeries) snapshot(at time.Time, key liveStatsKey) LiveStat {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := at.Unix()
+	stat := LiveStat{Provider: key.provider, Model: key.model, LatencyMs: l.latencyMs, FirstTokenMs: l.firstTokenMs, WindowSecs: liveStatsBuckets}
+	cutoff := at.Add(-liveStatsLatencyWindow)
+	drop := 0
+	for drop < len(l.firstTokens) && !l.firstTokens[drop].at.After(cutoff) {
+		drop++
+	}
+	l.firstTokens = l.firstTokens[drop:]
+	if recent := l.firstTokens; len(recent) > 0 {
+		stat.FirstTokenSamples = len(recent)
+		stat.FirstTokenP50Ms = float64(percentile(recent, 50).Milliseconds())
+		stat.FirstTokenP95Ms = float64(percentile(recent, 95).Milliseconds())
+	}
+	var tokens int64
+	for _, b := range l.buckets {
+		if now-b.second >= liveStatsBuckets {
+			continue
+		}
+		stat.Requests += b.requests
+		stat.Failures += b.failures
+		tokens += b.tokens
+	}
+	if stat.Requests > 0 {
+		stat.ErrorRate = float64(stat.Failures) / float64(stat.Requests)
+	}
+	stat.RequestsPerSecond = float64(stat.Requests) / liveStatsBuckets
+	stat.TokensPerSecond = float64(tokens) / liveStatsBuckets
+	return stat
+}
+
+// ewma starts the average at the first value.
+func ewma(avg, value float64) float64 {
+	if avg == 0 {
+		return value
+	}
+	return avg + liveStatsAlpha*(value-avg)
+}
+
+// provider returns the totals of a provider, zero when it had no traffic.
+func (s *liveStats) provider(id string) LiveStat {
+	key := liveStatsKey{provider: id}
+	series, ok := s.series.Load(key)
+	if !ok {
+		return LiveStat{Provider: id, WindowSecs: liveStatsBuckets}
+	}
+	return series.(*liveSeries).snapshot(s.now(), key)
+}
+
+// model returns the stats of a model on a provider, zero when it had no traffic.
+func (s *liveStats) model(provider, model string) LiveStat {
+	key := liveStatsKey{provider: provider, model: model}
+	series, ok := s.series.Load(key)
+	if !ok {
+		return LiveStat{Provider: provider, Model: model, WindowSecs: liveStatsBuckets}
+	}
+	return series.(*liveSeries).snapshot(s.now(), key)
+}
+
+// snapshot returns every series, sorted by provider then model.
+func (s *liveStats) snapshot() []LiveStat {
+	now := s.now()
+	stats := []LiveStat{}
+	s.series.Range(func(k, v any) bool {
+		stats = append(stats, v.(*liveSeries).snapshot(now, k.(liveStatsKey)))
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Provider != stats[j].Provider {
+			return stats[i].Provider < stats[j].Provider
+		}
+		return stats[i].Model < stats[j].Model
+	})
+	return stats
+}
+
+// LiveStats returns the traffic of every provider and provider model over the
+// last minute.
+func (g *Gateway) LiveStats() []LiveStat {
+	return g.live.snapshot()
+}
+
+// ErrorRate returns the share of failed requests of a provider over the last
+// minute, for routing rules such as ErrorRate("openai") > 0.2.
+func (e EvalEnv) ErrorRate(provider string) float64 {
+	if e.live == nil {
+		return 0
+	}
+	return e.live.provider(provider).ErrorRate
+}
+
+// LatencyMs returns the moving average duration of a provider's successful
+// requests.
+func (e EvalEnv) LatencyMs(provider string) float64 {
+	if e.live == nil {
+		return 0
+	}
+	return e.live.provider(provider).LatencyMs
+}
+
+// RequestsPerSecond returns the request rate of a provider over the last
+// minute.
+func (e EvalEnv) RequestsPerSecond(provider string) float64 {
+	if e.live == nil {
+		return 0
+	}
+	return e.live.provider(provider).RequestsPerSecond
+}
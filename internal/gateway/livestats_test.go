@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func TestLiveStatsWindowAndAverages(t *testing.T) {
+	stats := newLiveStats()
+	now := time.Unix(1700000000, 0)
+	stats.now = func() time.Time { return now }
+
+	stats.observe(storage.UsageRecord{Provider: "p1", Model: "m", Outcome: "success", Duration: 100 * time.Millisecond, RequestTokens: 30, ResponseTokens: 30})
+	stats.observe(storage.UsageRecord{Provider: "p1", Model: "m", Outcome: "success", Duration: 200 * time.Millisecond})
+	stats.observe(storage.UsageRecord{Provider: "p1", Model: "other", Outcome: "failure"})
+	stats.observe(storage.UsageRecord{Outcome: "blocked"})
+
+	total := stats.provider("p1")
+	if total.Requests != 3 || total.Failures != 1 || total.ErrorRate != 1.0/3 || total.TokensPerSecond != 1 {
+		t.Fatalf("unexpected provider totals %+v", total)
+	}
+	if total.LatencyMs != 120 {
+		t.Fatalf("expected moving average of 120ms, got %v", total.LatencyMs)
+	}
+	snapshot := stats.snapshot()
+	if len(snapshot) != 3 || snapshot[0].Model != "" || snapshot[1].Model != "m" || snapshot[1].Requests != 2 || snapshot[2].Failures != 1 {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	// Requests leave the window after a minute; the averages are kept.
+	now = now.Add(liveStatsBuckets * time.Second)
+	if total := stats.provider("p1"); total.Requests != 0 || total.ErrorRate != 0 || total.LatencyMs != 120 {
+		t.Fatalf("expected an empty window, got %+v", total)
+	}
+}
+
+func TestRuleUsesLiveErrorRate(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "p1", BaseURL: "http://p1", AccessToken: "t"},
+			{ID: "p2", BaseURL: "http://p2", AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{{
+			Name:      "gpt-4o",
+			Providers: []config.ModelProvider{{ID: "p1"}, {ID: "p2"}},
+			Rules: []config.RuleConfig{{
+				Expression: `ErrorRate("p1") > 0.5`,
+				Providers:  config.ProviderOverrideConfig{{Provider: "p2"}},
+			}},
+		}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	body := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)
+
+	plan, err := gw.DryRun(body, RequestTypeChatCompletions, "/v1/chat/completions")
+	if err != nil || plan.Rule != "" || plan.Providers[0].Provider != "p1" {
+		t.Fatalf("expected the default order, got %+v %v", plan, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		gw.live.observe(storage.UsageRecord{Provider: "p1", Model: "gpt-4o", Outcome: "failure"})
+	}
+	plan, err = gw.DryRun(body, RequestTypeChatCompletions, "/v1/chat/completions")
+	if err != nil || plan.Rule == "" || len(plan.Providers) != 1 || plan.Providers[0].Provider != "p2" {
+		t.Fatalf("expected the failing provider to be routed around, got %+v %v", plan, err)
+	}
+}
+
+func TestLiveStatsFirstTokenPercentiles(t *testing.T) {
+	stats := newLiveStats()
+	now := time.Unix(1700000000, 0)
+	stats.now = func() time.Time { return now }
+
+	for i := 1; i <= 20; i++ {
+		stats.observe(storage.UsageRecord{Provider: "p1", OriginalModel: "m", Outcome: "success", FirstTokenLatency: time.Duration(i*10) * time.Millisecond})
+	}
+	stats.observe(storage.UsageRecord{Provider: "p1", OriginalModel: "m", Outcome: "failure", FirstTokenLatency: time.Second})
+
+	stat := stats.model("p1", "m")
+	if stat.FirstTokenSamples != 20 || stat.FirstTokenP50Ms != 100 || stat.FirstTokenP95Ms != 190 {
+		t.Fatalf("unexpected first token percentiles %+v", stat)
+	}
+
+	now = now.Add(liveStatsLatencyWindow)
+	if stat := stats.model("p1", "m"); stat.FirstTokenSamples != 0 || stat.FirstTokenP50Ms != 0 {
+		t.Fatalf("expected old latencies to expire, got %+v", stat)
+	}
+}
@@ -0,0 +1,150 @@
+package gateway
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// metricsSink receives the usage record of every provider attempt and blocked
+// request. Sinks are called on the request path and must not block.
+type metricsSink interface {
+	observe(record storage.UsageRecord)
+}
+
+// sinkFunc adapts a function to a metricsSink.
+type sinkFunc func(record storage.UsageRecord)
+
+func (f sinkFunc) observe(record storage.UsageRecord) { f(record) }
+
+// metricFamily is a Prometheus metric with its series.
+type metricFamily struct {
+	name    string
+	kind    string
+	help    string
+	samples []metricSample
+}
+
+// metricSample is a series of a family. Its name differs from the family name
+// for the _sum and _count series of summaries.
+type metricSample struct {
+	name   string
+	labels []metricLabel
+	value  float64
+}
+
+type metricLabel struct {
+	name  string
+	value string
+}
+
+type usageSeriesKey struct {
+	provider string
+	model    string
+	outcome  string
+}
+
+type usageSeries struct {
+	requests          int64
+	inputTokens       int64
+	outputTokens      int64
+	durationSeconds   float64
+	firstTokenSeconds float64
+	firstTokens       int64
+}
+
+// usageMetrics aggregates usage records into counters since the gateway
+// started. Series are keyed by provider, requested model and outcome.
+type usageMetrics struct {
+	mu     sync.Mutex
+	series map[usageSeriesKey]*usageSeries
+}
+
+func newUsageMetrics() *usageMetrics {
+	return &usageMetrics{series: make(map[usageSeriesKey]*usageSeries)}
+}
+
+func (m *usageMetrics) observe(record storage.UsageRecord) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := usageSeriesKey{provider: record.Provider, model: exportedModel(record), outcome: record.Outcome}
+	s, ok := m.series[key]
+	if !ok {
+		s = &usageSeries{}
+		m.series[key] = s
+	}
+	s.requests++
+	s.inputTokens += int64(record.RequestTokens)
+	s.outputTokens += int64(record.ResponseTokens)
+	s.durationSeconds += record.Duration.Seconds()
+	if record.FirstTokenLatency > 0 {
+		s.firstTokenSeconds += record.FirstTokenLatency.Seconds()
+		s.firstTokens++
+	}
+}
+
+// families returns the current values of the usage metrics, in a stable order.
+func (m *usageMetrics) families() []metricFamily {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]usageSeriesKey, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.provider != b.provider {
+			return a.provider < b.provider
+		}
+		if a.model != b.model {
+			return a.model < b.model
+		}
+		return a.outcome < b.outcome
+	})
+
+	requests := metricFamily{name: "gateway_requests_total", kind: "counter", help: "Provider attempts and blocked requests."}
+	tokens := metricFamily{name: "gateway_tokens_total", kind: "counter", help: "Tokens of the requests and responses."}
+	duration := metricFamily{name: "gateway_request_duration_seconds", kind: "summary", help: "Time spent serving requests."}
+	firstToken := metricFamily{name: "gateway_first_token_seconds", kind: "summary", help: "Time to the first token of streamed responses."}
+	for _, key := range keys {
+		s := m.series[key]
+		labels := []metricLabel{{"model", key.model}, {"outcome", key.outcome}, {"provider", key.provider}}
+		requests.samples = append(requests.samples, metricSample{name: requests.name, labels: labels, value: float64(s.requests)})
+		tokens.samples = append(tokens.samples,
+			metricSample{name: tokens.name, labels: withLabel(labels, "type", "input"), value: float64(s.inputTokens)},
+			metricSample{name: tokens.name, labels: withLabel(labels, "type", "output"), value: float64(s.outputTokens)},
+		)
+		duration.samples = append(duration.samples,
+			metricSample{name: duration.name + "_sum", labels: labels, value: s.durationSeconds},
+			metricSample{name: duration.name + "_count", labels: labels, value: float64(s.requests)},
+		)
+		if s.firstTokens > 0 {
+			firstToken.samples = append(firstToken.samples,
+				metricSample{name: firstToken.name + "_sum", labels: labels, value: s.firstTokenSeconds},
+				metricSample{name: firstToken.name + "_count", labels: labels, value: float64(s.firstTokens)},
+			)
+		}
+	}
+	return []metricFamily{requests, tokens, duration, firstToken}
+}
+
+// withLabel returns a copy of labels with one more label, sorted by name.
+func withLabel(labels []metricLabel, name, value string) []metricLabel {
+	out := append(append(make([]metricLabel, 0, len(labels)+1), labels...), metricLabel{name, value})
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+// metricFamilies returns the usage metrics and the provider health gauge.
+func (g *Gateway) metricFamilies() []metricFamily {
+	families := g.metrics.families()
+	return append(families, metricFamily{
+		name:    "gateway_unhealthy_providers",
+		kind:    "gauge",
+		help:    "Providers marked unhealthy after consecutive failures.",
+		samples: []metricSample{{name: "gateway_unhealthy_providers", value: float64(g.health.unhealthyCount())}},
+	})
+}
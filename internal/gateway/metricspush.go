@@ -0,0 +1,218 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// RunMetricsPush pushes the usage metrics on every interval until ctx is done,
+// then once more so the final counts are not lost.
+func (g *Gateway) RunMetricsPush(ctx context.Context) {
+	cfg := g.cfg.MetricsPush
+	if cfg == nil || g.metrics == nil {
+		return
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	ticker := time.NewTicker(time.Duration(cfg.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	log.Infof("metrics push started: format=%s, interval=%ds", cfg.Format, cfg.IntervalSeconds)
+	for {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := pushMetrics(shutdownCtx, client, *cfg, g.metricFamilies(), time.Now()); err != nil {
+				log.Warningf("push metrics: %v", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := pushMetrics(ctx, client, *cfg, g.metricFamilies(), time.Now()); err != nil {
+				log.Warningf("push metrics: %v", err)
+			}
+		}
+	}
+}
+
+// pushMetrics sends the metrics with a remote-write request or, for a
+// Pushgateway, replaces the metrics of the gateway's group.
+func pushMetrics(ctx context.Context, client *http.Client, cfg config.MetricsPushConfig, families []metricFamily, now time.Time) error {
+	var req *http.Request
+	var err error
+	if cfg.Format == config.MetricsPushPushgateway {
+		body := encodeMetricsText(families)
+		req, err = http.NewRequestWithContext(ctx, http.MethodPut, pushgatewayURL(cfg), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	} else {
+		extra := map[string]string{"job": cfg.Job}
+		for name, value := range cfg.Labels {
+			extra[name] = value
+		}
+		body := snappyEncode(encodeRemoteWrite(families, extra, now))
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	}
+	for name, value := range cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// pushgatewayURL is the URL of the group identified by the job and the
+// configured labels. Values that cannot appear in a path are base64 encoded.
+func pushgatewayURL(cfg config.MetricsPushConfig) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(cfg.URL, "/"))
+	b.WriteString("/metrics")
+	appendSegment := func(name, value string) {
+		switch {
+		case value == "":
+			b.WriteString("/" + name + "@base64/=")
+		case strings.Contains(value, "/"):
+			b.WriteString("/" + name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value)))
+		default:
+			b.WriteString("/" + name + "/" + url.PathEscape(value))
+		}
+	}
+	appendSegment("job", cfg.Job)
+	names := make([]string, 0, len(cfg.Labels))
+	for name := range cfg.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		appendSegment(name, cfg.Labels[name])
+	}
+	return b.String()
+}
+
+// encodeMetricsText writes the metrics in the Prometheus text format.
+func encodeMetricsText(families []metricFamily) []byte {
+	var b bytes.Buffer
+	for _, family := range families {
+		if len(family.samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", family.name, family.help, family.name, family.kind)
+		for _, sample := range family.samples {
+			b.WriteString(sample.name)
+			if len(sample.labels) > 0 {
+				b.WriteByte('{')
+				for i, label := range sample.labels {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+					fmt.Fprintf(&b, "%s=\"%s\"", label.name, escapeLabelValue(label.value))
+				}
+				b.WriteByte('}')
+			}
+			b.WriteString(" " + strconv.FormatFloat(sample.value, 'g', -1, 64) + "\n")
+		}
+	}
+	return b.Bytes()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+// encodeRemoteWrite returns the protobuf encoded remote-write request of the
+// metrics, with the extra labels added to every series. Empty labels are left
+// out as Prometheus treats them as missing.
+func encodeRemoteWrite(families []metricFamily, extra map[string]string, now time.Time) []byte {
+	var out []byte
+	for _, family := range families {
+		for _, sample := range family.samples {
+			labels := map[string]string{"__name__": sample.name}
+			for name, value := range extra {
+				labels[name] = value
+			}
+			for _, label := range sample.labels {
+				labels[label.name] = label.value
+			}
+			names := make([]string, 0, len(labels))
+			for name, value := range labels {
+				if value != "" {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+
+			var series []byte
+			for _, name := range names {
+				var label []byte
+				label = appendProtoBytes(label, 1, []byte(name))
+				label = appendProtoBytes(label, 2, []byte(labels[name]))
+				series = appendProtoBytes(series, 1, label)
+			}
+			var point []byte
+			point = append(point, 1<<3|1) // value, 64-bit
+			point = binary.LittleEndian.AppendUint64(point, math.Float64bits(sample.value))
+			point = append(point, 2<<3|0) // timestamp in milliseconds, varint
+			point = binary.AppendUvarint(point, uint64(now.UnixMilli()))
+			series = appendProtoBytes(series, 2, point)
+			out = appendProtoBytes(out, 1, series)
+		}
+	}
+	return out
+}
+
+// appendProtoBytes appends a length-delimited protobuf field.
+func appendProtoBytes(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// snappyEncode frames data as a snappy block made of literals only. The
+// payload is not compressed, but any snappy decoder reads it.
+func snappyEncode(data []byte) []byte {
+	out := binary.AppendUvarint(make([]byte, 0, len(data)+len(data)/65536*3+16), uint64(len(data)))
+	for len(data) > 0 {
+		n := min(len(data), 65536)
+		if n <= 60 {
+			out = append(out, byte(n-1)<<2)
+		} else {
+			// Tag 61: the literal length minus one follows in two bytes.
+			out = append(out, 61<<2, byte(n-1), byte((n-1)>>8))
+		}
+		out = append(out, data[:n]...)
+		data = data[n:]
+	}
+	return out
+}
@@ -0,0 +1,148 @@
+package gateway
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func testUsageMetrics() *usageMetrics {
+	m := newUsageMetrics()
+	m.observe(storage.UsageRecord{Provider: "openai", Model: "gpt-4o-2024", OriginalModel: "gpt-4o", Outcome: "success",
+		RequestTokens: 10, ResponseTokens: 5, Duration: 2 * time.Second, FirstTokenLatency: 500 * time.Millisecond})
+	m.observe(storage.UsageRecord{Provider: "openai", Model: "gpt-4o-2024", OriginalModel: "gpt-4o", Outcome: "success",
+		RequestTokens: 20, ResponseTokens: 7, Duration: time.Second})
+	m.observe(storage.UsageRecord{Model: "gpt-4o", Outcome: "blocked"})
+	return m
+}
+
+func TestPushMetricsToPushgateway(t *testing.T) {
+	var path, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		path = r.URL.EscapedPath()
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer srv.Close()
+
+	cfg := config.MetricsPushConfig{
+		URL:    srv.URL,
+		Format: config.MetricsPushPushgateway,
+		Job:    "gateway",
+		Labels: map[string]string{"instance": "eu/1"},
+	}
+	if err := pushMetrics(context.Background(), srv.Client(), cfg, testUsageMetrics().families(), time.Now()); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if path != "/metrics/job/gateway/instance@base64/ZXUvMQ" {
+		t.Fatalf("unexpected path %s", path)
+	}
+	for _, want := range []string{
+		"# TYPE gateway_requests_total counter\n",
+		`gateway_requests_total{model="gpt-4o",outcome="success",provider="openai"} 2` + "\n",
+		`gateway_requests_total{model="gpt-4o",outcome="blocked",provider=""} 1` + "\n",
+		`gateway_tokens_total{model="gpt-4o",outcome="success",provider="openai",type="output"} 12` + "\n",
+		`gateway_request_duration_seconds_sum{model="gpt-4o",outcome="success",provider="openai"} 3` + "\n",
+		`gateway_first_token_seconds_count{model="gpt-4o",outcome="success",provider="openai"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("body misses %q:\n%s", want, body)
+		}
+	}
+}
+
+// decodeSnappyLiterals reads a snappy block made of literals only.
+func decodeSnappyLiterals(t *testing.T, data []byte) []byte {
+	t.Helper()
+	size, n := binary.Uvarint(data)
+	data = data[n:]
+	var out []byte
+	for len(data) > 0 {
+		tag := data[0]
+		if tag&3 != 0 {
+			t.Fatalf("unexpected snappy element %d", tag&3)
+		}
+		length := int(tag>>2) + 1
+		data = data[1:]
+		if tag>>2 == 61 {
+			length = int(data[0]) | int(data[1])<<8 + 1
+			data = data[2:]
+		}
+		out = append(out, data[:length]...)
+		data = data[length:]
+	}
+	if uint64(len(out)) != size {
+		t.Fatalf("decoded %d bytes, header says %d", len(out), size)
+	}
+	return out
+}
+
+func TestPushMetricsRemoteWrite(t *testing.T) {
+	var header http.Header
+	var payload []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		payload, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	cfg := config.MetricsPushConfig{
+		URL:     srv.URL + "/api/v1/write",
+		Format:  config.MetricsPushRemoteWrite,
+		Job:     "gateway",
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	}
+	if err := pushMetrics(context.Background(), srv.Client(), cfg, testUsageMetrics().families(), time.UnixMilli(1700000000000)); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if header.Get("Content-Encoding") != "snappy" || header.Get("Authorization") != "Bearer token" {
+		t.Fatalf("unexpected headers %v", header)
+	}
+
+	decoded := decodeSnappyLiterals(t, payload)
+	want := snappyEncode(encodeRemoteWrite(testUsageMetrics().families(), map[string]string{"job": "gateway"}, time.UnixMilli(1700000000000)))
+	if string(payload) != string(want) {
+		t.Fatalf("payload differs from the encoded metrics")
+	}
+	for _, label := range []string{"__name__", "gateway_requests_total", "job", "gateway", "provider", "openai"} {
+		if !strings.Contains(string(decoded), label) {
+			t.Fatalf("payload misses %q", label)
+		}
+	}
+
+	// The first series is the blocked request: its empty provider label is
+	// left out and the labels are sorted by name.
+	series := encodeRemoteWrite(testUsageMetrics().families()[:1], map[string]string{"job": "gateway"}, time.UnixMilli(1))
+	var names []string
+	_, n := binary.Uvarint(series[1:])
+	body := series[1+n:]
+	for len(body) > 0 && body[0] == 1<<3|2 {
+		size, n := binary.Uvarint(body[1:])
+		label := body[1+n : 1+n+int(size)]
+		nameSize := int(label[1])
+		names = append(names, string(label[2:2+nameSize]))
+		body = body[1+n+int(size):]
+	}
+	if strings.Join(names, ",") != "__name__,job,model,outcome" {
+		t.Fatalf("unexpected labels %v", names)
+	}
+}
+
+func TestSnappyEncodeLongLiterals(t *testing.T) {
+	data := []byte(strings.Repeat("metrics", 30000))
+	if got := decodeSnappyLiterals(t, snappyEncode(data)); string(got) != string(data) {
+		t.Fatalf("round trip changed the data")
+	}
+}
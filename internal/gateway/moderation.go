@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// Moderation verdicts stored in usage records; flagged verdicts list the
+// categories as "flagged:<category>,<category>".
+const (
+	moderationPassed = "passed"
+	moderationError  = "error"
+)
+
+type moderationContextKey struct{}
+
+// withModeration stores the moderation verdict of the request so usage records
+// created for it carry the verdict.
+func withModeration(ctx context.Context, verdict string) context.Context {
+	return context.WithValue(ctx, moderationContextKey{}, verdict)
+}
+
+func moderationFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	verdict, _ := ctx.Value(moderationContextKey{}).(string)
+	return verdict
+}
+
+// errModerationBlocked rejects requests the moderation endpoint flagged.
+type errModerationBlocked struct {
+	verdict string
+}
+
+func (e *errModerationBlocked) Error() string {
+	return "request blocked by content moderation: " + strings.TrimPrefix(e.verdict, "flagged:")
+}
+
+// moderate sends the prompt text of body to the moderation endpoint. It returns
+// the verdict to record and an *errModerationBlocked when the request must be
+// rejected; moderation failures only reject requests in fail closed mode.
+func (g *Gateway) moderate(ctx context.Context, body []byte) (string, error) {
+	cfg := g.cfg.Moderation
+	text := promptText(body)
+	if cfg == nil || text == "" {
+		return "", nil
+	}
+
+	categories, err := g.callModeration(ctx, cfg, text)
+	if err != nil {
+		if cfg.FailClosed {
+			return moderationError, fmt.Errorf("content moderation unavailable: %w", err)
+		}
+		return moderationError, nil
+	}
+	if categories == nil {
+		return moderationPassed, nil
+	}
+	verdict := "flagged:" + strings.Join(categories, ",")
+	if cfg.Action == config.ModerationBlock {
+		return verdict, &errModerationBlocked{verdict: verdict}
+	}
+	return verdict, nil
+}
+
+// callModeration returns the flagged categories, or nil when the text passed.
+func (g *Gateway) callModeration(ctx context.Context, cfg *config.ModerationConfig, text string) ([]string, error) {
+	payload, err := json.Marshal(map[string]any{"model": cfg.Model, "input": text})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	endpoint := cfg.URL
+	var provider *config.ProviderConfig
+	if cfg.Provider != "" {
+		p := g.providers[cfg.Provider]
+		provider = &p
+		if endpoint == "" {
+			endpoint = strings.TrimRight(p.BaseURL, "/") + "/moderations"
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if provider != nil {
+		setProviderAuth(req.Header, *provider)
+	} else if cfg.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.AccessToken)
+	}
+
+	client := g.httpClient
+	if provider != nil {
+		client = g.clientFor(provider.ID)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read moderation response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation endpoint returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	results := gjson.GetBytes(respBody, "results")
+	if !results.IsArray() {
+		return nil, fmt.Errorf("unexpected moderation response: %s", strings.TrimSpace(string(respBody)))
+	}
+	flagged := false
+	seen := make(map[string]struct{})
+	results.ForEach(func(_, result gjson.Result) bool {
+		if !result.Get("flagged").Bool() {
+			return true
+		}
+		flagged = true
+		result.Get("categories").ForEach(func(name, value gjson.Result) bool {
+			if value.Bool() {
+				seen[name.String()] = struct{}{}
+			}
+			return true
+		})
+		return true
+	})
+	if !flagged {
+		return nil, nil
+	}
+	categories := make([]string, 0, len(seen))
+	for name := range seen {
+		categories = append(categories, name)
+	}
+	sort.Strings(categories)
+	return categories, nil
+}
+
+// promptText collects the text a client sent in a chat completions, responses
+// or messages request, one part per line.
+func promptText(body []byte) string {
+	var parts []string
+	collect := func(value gjson.Result) {
+		switch {
+		case value.Type == gjson.String:
+			parts = append(parts, value.String())
+		case value.IsArray():
+			value.ForEach(func(_, item gjson.Result) bool {
+				if item.Type == gjson.String {
+					parts = append(parts, item.String())
+				} else if text := item.Get("text"); text.Exists() {
+					parts = append(parts, text.String())
+				} else if content := item.Get("content"); content.Exists() {
+					if content.Type == gjson.String {
+						parts = append(parts, content.String())
+					} else {
+						content.ForEach(func(_, c gjson.Result) bool {
+							if text := c.Get("text"); text.Exists() {
+								parts = append(parts, text.String())
+							}
+							return true
+						})
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	for _, field := range []string{"system", "instructions", "prompt", "input"} {
+		collect(gjson.GetBytes(body, field))
+	}
+	gjson.GetBytes(body, "messages").ForEach(func(_, message gjson.Result) bool {
+		collect(message.Get("content"))
+		return true
+	})
+
+	text := strings.Join(parts, "\n")
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	return text
+}
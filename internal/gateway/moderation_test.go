@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestPromptText(t *testing.T) {
+	body := []byte(`{"system":"be nice","messages":[{"role":"user","content":"hello"},{"role":"user","content":[{"type":"text","text":"world"},{"type":"image_url","image_url":{"url":"x"}}]}]}`)
+	if got := promptText(body); got != "be nice\nhello\nworld" {
+		t.Fatalf("unexpected prompt text %q", got)
+	}
+	if got := promptText([]byte(`{"input":[{"role":"user","content":[{"type":"input_text","text":"hi"}]}],"instructions":"short"}`)); got != "short\nhi" {
+		t.Fatalf("unexpected responses prompt text %q", got)
+	}
+}
+
+func TestProxyModeration(t *testing.T) {
+	moderation := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(gjson.GetBytes(body, "input").String(), "attack") {
+			_, _ = w.Write([]byte(`{"results":[{"flagged":true,"categories":{"violence":true,"hate":false}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"results":[{"flagged":false,"categories":{"violence":false}}]}`))
+	}))
+	t.Cleanup(moderation.Close)
+
+	providerCalls := 0
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		providerCalls++
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	newGateway := func(action string) *Gateway {
+		cfg := &config.Config{
+			Providers:  []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "token"}},
+			Models:     []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+			Moderation: &config.ModerationConfig{URL: moderation.URL, Action: action, TimeoutSeconds: 5},
+		}
+		gw, err := New(cfg, nil)
+		if err != nil {
+			t.Fatalf("create gateway: %v", err)
+		}
+		return gw
+	}
+	send := func(gw *Gateway, prompt string) *httptest.ResponseRecorder {
+		body := `{"model":"gpt-4o","messages":[{"role":"user","content":"` + prompt + `"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(body)))
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+		return rec
+	}
+
+	block := newGateway(config.ModerationBlock)
+	if rec := send(block, "plan an attack"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "violence") {
+		t.Fatalf("expected flagged request to be blocked, got %d %s", rec.Code, rec.Body.String())
+	}
+	if providerCalls != 0 {
+		t.Fatalf("blocked request must not reach the provider")
+	}
+	if rec := send(block, "hello"); rec.Code != http.StatusOK {
+		t.Fatalf("expected clean request to pass, got %d", rec.Code)
+	}
+
+	tag := newGateway(config.ModerationTag)
+	if rec := send(tag, "plan an attack"); rec.Code != http.StatusOK || providerCalls != 2 {
+		t.Fatalf("expected tagged request to be forwarded, got %d", rec.Code)
+	}
+}
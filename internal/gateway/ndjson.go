@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// ndjsonContentTypes are the content types of providers that stream newline
+// delimited JSON instead of server-sent events.
+var ndjsonContentTypes = []string{"application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines"}
+
+func isNDJSONResponse(header http.Header) bool {
+	return hasContentType(header.Get("Content-Type"), ndjsonContentTypes)
+}
+
+// acceptsNDJSON reports whether the client asked for newline delimited JSON,
+// in which case such a stream is passed through instead of converted.
+func acceptsNDJSON(header http.Header) bool {
+	for _, accept := range header.Values("Accept") {
+		for _, value := range strings.Split(accept, ",") {
+			if hasContentType(value, ndjsonContentTypes) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasContentType(value string, types []string) bool {
+	mediaType, _, _ := strings.Cut(value, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, t := range types {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ndjsonWriter converts a newline delimited JSON stream into the server-sent
+// events of the inbound protocol: chat completion chunks become data events
+// ended by "data: [DONE]", Responses and Anthropic events are named after
+// their "type" field.
+type ndjsonWriter struct {
+	http.ResponseWriter
+	reqType RequestType
+	pending []byte
+	done    bool
+}
+
+func newNDJSONWriter(w http.ResponseWriter, reqType RequestType) *ndjsonWriter {
+	return &ndjsonWriter{ResponseWriter: w, reqType: reqType}
+}
+
+func (w *ndjsonWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		end := bytes.IndexByte(w.pending, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		line := w.pending[:end]
+		w.pending = w.pending[end+1:]
+		if err := w.writeLine(line); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (w *ndjsonWriter) writeLine(line []byte) error {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil
+	}
+	if bytes.Equal(line, []byte("[DONE]")) {
+		w.done = true
+	}
+	var event []byte
+	if w.reqType != RequestTypeChatCompletions {
+		if name := gjson.GetBytes(line, "type").String(); name != "" {
+			event = append(event, "event: "+name+"\n"...)
+		}
+	}
+	event = append(event, "data: "...)
+	event = append(event, line...)
+	event = append(event, "\n\n"...)
+	_, err := w.ResponseWriter.Write(event)
+	return err
+}
+
+// finish converts a last line without a trailing newline and ends a chat
+// completion stream with "data: [DONE]" unless the provider sent it.
+func (w *ndjsonWriter) finish() error {
+	if err := w.writeLine(w.pending); err != nil {
+		return err
+	}
+	w.pending = nil
+	if w.reqType == RequestTypeChatCompletions && !w.done {
+		w.done = true
+		if _, err := w.ResponseWriter.Write([]byte("data: [DONE]\n\n")); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *ndjsonWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *ndjsonWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
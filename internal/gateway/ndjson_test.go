@@ -0,0 +1,82 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestNDJSONWriterConvertsToEvents(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := newNDJSONWriter(rec, RequestTypeChatCompletions)
+	for _, part := range []string{"{\"id\":\"c1\"}\n{\"id\"", ":\"c2\"}\n\n", "{\"id\":\"c3\"}"} {
+		if _, err := w.Write([]byte(part)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := w.finish(); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	if want := "data: {\"id\":\"c1\"}\n\ndata: {\"id\":\"c2\"}\n\ndata: {\"id\":\"c3\"}\n\ndata: [DONE]\n\n"; rec.Body.String() != want {
+		t.Fatalf("unexpected chat stream %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	w = newNDJSONWriter(rec, RequestTypeAnthropicMessages)
+	_, _ = w.Write([]byte("{\"type\":\"message_start\"}\n{\"type\":\"message_stop\"}\n"))
+	if err := w.finish(); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	if want := "event: message_start\ndata: {\"type\":\"message_start\"}\n\nevent: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"; rec.Body.String() != want {
+		t.Fatalf("unexpected anthropic stream %q", rec.Body.String())
+	}
+}
+
+func TestExtractResponseMetadataFromNDJSON(t *testing.T) {
+	body := []byte("{\"id\":\"c1\",\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n{\"id\":\"c1\",\"choices\":[],\"usage\":{\"completion_tokens\":5}}\n")
+	if id, tokens := extractResponseMetadata("gpt-4o", RequestTypeChatCompletions, body, true); id != "c1" || tokens != 5 {
+		t.Fatalf("unexpected metadata %q, %d", id, tokens)
+	}
+}
+
+func TestProxyConvertsNDJSONStream(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = w.Write([]byte("{\"id\":\"c1\",\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n"))
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:    []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	for _, tc := range []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", "text/event-stream", "data: {\"id\":\"c1\",\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n"},
+		{"application/x-ndjson", "application/x-ndjson", "{\"id\":\"c1\",\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o","stream":true}`)))
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+		if got := rec.Header().Get("Content-Type"); got != tc.contentType {
+			t.Fatalf("accept %q: unexpected content type %q", tc.accept, got)
+		}
+		if rec.Body.String() != tc.body {
+			t.Fatalf("accept %q: unexpected stream %q", tc.accept, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// openRouterVendors are the vendors OpenRouter lists models under, keyed by
+// model name prefix. Longer prefixes come first.
+var openRouterVendors = []struct {
+	prefix string
+	vendor string
+}{
+	{"text-embedding-", "openai"},
+	{"chatgpt-", "openai"},
+	{"gpt-", "openai"},
+	{"o1", "openai"},
+	{"o3", "openai"},
+	{"o4", "openai"},
+	{"claude-", "anthropic"},
+	{"gemini-", "google"},
+	{"gemma-", "google"},
+	{"llama-", "meta-llama"},
+	{"codestral", "mistralai"},
+	{"ministral", "mistralai"},
+	{"mistral-", "mistralai"},
+	{"mixtral-", "mistralai"},
+	{"deepseek-", "deepseek"},
+	{"qwen", "qwen"},
+	{"grok-", "x-ai"},
+	{"command-", "cohere"},
+}
+
+// openRouterModel returns the OpenRouter name of a model. Names that already
+// carry a vendor and names of unknown vendors are returned unchanged.
+func openRouterModel(model string) string {
+	if strings.Contains(model, "/") {
+		return model
+	}
+	lower := strings.ToLower(model)
+	for _, v := range openRouterVendors {
+		if strings.HasPrefix(lower, v.prefix) {
+			return v.vendor + "/" + model
+		}
+	}
+	return model
+}
+
+// targetModelOf returns the model name sent to the provider of a candidate.
+func (g *Gateway) targetModelOf(c ruleProvider, modelName string) string {
+	model := modelName
+	if c.model != "" {
+		model = c.model
+	}
+	if g.providers[c.id].Type == config.ProviderTypeOpenRouter {
+		return openRouterModel(model)
+	}
+	return model
+}
+
+// setOpenRouterHeaders sets the attribution headers of an openrouter provider.
+func setOpenRouterHeaders(header http.Header, provider config.ProviderConfig) {
+	if provider.Type != config.ProviderTypeOpenRouter || provider.OpenRouter == nil {
+		return
+	}
+	if provider.OpenRouter.Referer != "" {
+		header.Set("HTTP-Referer", provider.OpenRouter.Referer)
+	}
+	if provider.OpenRouter.Title != "" {
+		header.Set("X-Title", provider.OpenRouter.Title)
+	}
+}
+
+// setOpenRouterRouting sets the provider routing preference of an openrouter
+// provider unless the client sent one.
+func setOpenRouterRouting(body []byte, provider config.ProviderConfig) ([]byte, error) {
+	if provider.Type != config.ProviderTypeOpenRouter || provider.OpenRouter == nil || len(provider.OpenRouter.Routing) == 0 {
+		return body, nil
+	}
+	if gjson.GetBytes(body, "provider").Exists() {
+		return body, nil
+	}
+	return sjson.SetBytes(body, "provider", provider.OpenRouter.Routing)
+}
+
+// withFallbackProviders appends the openrouter providers configured as
+// fallback to the candidates they are not part of yet.
+func (g *Gateway) withFallbackProviders(candidates []ruleProvider) []ruleProvider {
+	for _, provider := range g.cfg.Providers {
+		if provider.Type != config.ProviderTypeOpenRouter || provider.OpenRouter == nil || !provider.OpenRouter.Fallback {
+			continue
+		}
+		listed := false
+		for _, c := range candidates {
+			if c.id == provider.ID {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			candidates = append(candidates, ruleProvider{id: provider.ID})
+		}
+	}
+	return candidates
+}
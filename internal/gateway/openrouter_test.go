@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestOpenRouterModel(t *testing.T) {
+	for model, want := range map[string]string{
+		"gpt-4o":                  "openai/gpt-4o",
+		"o3-mini":                 "openai/o3-mini",
+		"claude-3-5-sonnet":       "anthropic/claude-3-5-sonnet",
+		"gemini-2.0-flash":        "google/gemini-2.0-flash",
+		"Llama-3.1-70b":           "meta-llama/Llama-3.1-70b",
+		"mistralai/mistral-large": "mistralai/mistral-large",
+		"some-unknown-model":      "some-unknown-model",
+		"openrouter/auto":         "openrouter/auto",
+	} {
+		if got := openRouterModel(model); got != want {
+			t.Fatalf("openRouterModel(%q) = %q, want %q", model, got, want)
+		}
+	}
+}
+
+func TestProxyFallsBackToOpenRouter(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(primary.Close)
+
+	var header http.Header
+	var body []byte
+	openrouter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"gen-1","choices":[]}`))
+	}))
+	t.Cleanup(openrouter.Close)
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "p1", BaseURL: primary.URL, AccessToken: "t"},
+			{ID: "or", Type: config.ProviderTypeOpenRouter, BaseURL: openrouter.URL, AccessToken: "sk-or", OpenRouter: &config.OpenRouterConfig{
+				Referer:  "https://example.com",
+				Title:    "Example",
+				Routing:  map[string]any{"sort": "price"},
+				Fallback: true,
+			}},
+		},
+		Models: []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o"}`)))
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the fallback to answer, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := gjson.GetBytes(body, "model").String(); got != "openai/gpt-4o" {
+		t.Fatalf("unexpected model %q", got)
+	}
+	if got := gjson.GetBytes(body, "provider.sort").String(); got != "price" {
+		t.Fatalf("routing preference not sent: %s", body)
+	}
+	if header.Get("HTTP-Referer") != "https://example.com" || header.Get("X-Title") != "Example" || header.Get("Authorization") != "Bearer sk-or" {
+		t.Fatalf("unexpected headers %v", header)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o","provider":{"order":["Azure"]}}`)))
+	gw.Proxy(httptest.NewRecorder(), req, RequestTypeChatCompletions)
+	if got := gjson.GetBytes(body, "provider").Raw; got != `{"order":["Azure"]}` {
+		t.Fatalf("client routing preference replaced: %s", got)
+	}
+}
@@ -0,0 +1,206 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// syncedPrices holds the prices fetched by the pricing sync.
+type syncedPrices struct {
+	mu     sync.RWMutex
+	prices map[string]config.ModelPrice
+}
+
+func (p *syncedPrices) get(model string) (config.ModelPrice, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	price, ok := p.prices[model]
+	return price, ok
+}
+
+func (p *syncedPrices) set(prices map[string]config.ModelPrice) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prices = prices
+}
+
+// priceOf returns the price of a model served by a provider, the one lookup
+// behind costs, budgets and cost routing: the price table entry of the
+// provider model, else the entry of the model on every provider, else the
+// synced price of the model or of the model prefixed with the provider type,
+// as in "openrouter/openai/gpt-4o".
+func (g *Gateway) priceOf(providerID, model string) (config.ModelPrice, bool) {
+	if model == "" {
+		return config.ModelPrice{}, false
+	}
+	if price, ok := g.priceTable[ruleProvider{id: providerID, model: model}]; ok {
+		return price, true
+	}
+	if price, ok := g.priceTable[ruleProvider{model: model}]; ok {
+		return price, true
+	}
+	if price, ok := g.prices.get(model); ok {
+		return price, true
+	}
+	if provider, ok := g.providers[providerID]; ok && provider.Type != "" {
+		return g.prices.get(string(provider.Type) + "/" + model)
+	}
+	return config.ModelPrice{}, false
+}
+
+// tokenCost prices tokens of a provider model in USD, 0 when the model has no
+// price.
+func (g *Gateway) tokenCost(providerID, model string, requestTokens, responseTokens int64) float64 {
+	price, ok := g.priceOf(providerID, model)
+	if !ok {
+		return 0
+	}
+	return (float64(requestTokens)*price.Input + float64(responseTokens)*price.Output) / 1e6
+}
+
+// RunPricingSync fetches the pricing feed on startup and every interval until
+// ctx is done. A failed fetch keeps the prices of the last successful one.
+func (g *Gateway) RunPricingSync(ctx context.Context) {
+	if g.cfg.Pricing == nil || g.cfg.Pricing.Sync == nil {
+		return
+	}
+	sync := g.cfg.Pricing.Sync
+	ticker := time.NewTicker(time.Duration(sync.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	log.Infof("pricing sync started: url=%s, interval=%ds", sync.URL, sync.IntervalSeconds)
+	g.syncPrices(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.syncPrices(ctx)
+		}
+	}
+}
+
+func (g *Gateway) syncPrices(ctx context.Context) {
+	prices, err := g.fetchPrices(ctx)
+	if err != nil {
+		log.Warningf("pricing sync failed: %v", err)
+		return
+	}
+	g.prices.set(prices)
+	log.Infof("pricing sync loaded %d model prices", len(prices))
+}
+
+func (g *Gateway) fetchPrices(ctx context.Context) (map[string]config.ModelPrice, error) {
+	cfg := g.cfg.Pricing.Sync
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch pricing feed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read pricing feed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pricing feed returned status %d", resp.StatusCode)
+	}
+	return parsePrices(body)
+}
+
+// parsePrices reads a pricing feed keyed by model. LiteLLM entries carry
+// prices per token, ModelPrice entries per million tokens; entries without
+// prices, such as LiteLLM's sample_spec, are skipped.
+func parsePrices(data []byte) (map[string]config.ModelPrice, error) {
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("decode pricing feed: %w", err)
+	}
+	prices := make(map[string]config.ModelPrice, len(entries))
+	for model, raw := range entries {
+		entry := gjson.ParseBytes(raw)
+		input, output := entry.Get("input_cost_per_token"), entry.Get("output_cost_per_token")
+		switch {
+		case input.Type == gjson.Number || output.Type == gjson.Number:
+			prices[model] = config.ModelPrice{Input: input.Float() * 1e6, Output: output.Float() * 1e6}
+		case entry.Get("input").Type == gjson.Number || entry.Get("output").Type == gjson.Number:
+			prices[model] = config.ModelPrice{Input: entry.Get("input").Float(), Output: entry.Get("output").Float()}
+		}
+	}
+	if len(prices) == 0 {
+		return nil, fmt.Errorf("pricing feed has no model prices")
+	}
+	return prices, nil
+}
+
+// estimatedCost returns the cost of a request of tokenCount prompt tokens on
+// a candidate, assuming a completion of pricing.estimated_output_tokens.
+func (g *Gateway) estimatedCost(c ruleProvider, modelName string, tokenCount int) (float64, bool) {
+	price, ok := g.priceOf(c.id, g.targetModelOf(c, modelName))
+	if !ok {
+		return 0, false
+	}
+	outputTokens := 512
+	if g.cfg.Pricing != nil {
+		outputTokens = g.cfg.Pricing.EstimatedOutputTokens
+	}
+	return (float64(tokenCount)*price.Input + float64(outputTokens)*price.Output) / 1e6, true
+}
+
+// EstimatedCost returns the estimated cost in USD of the request on a
+// provider, or 0 when the provider model has no price, for routing rules such
+// as EstimatedCost("openai") > 0.05.
+func (e EvalEnv) EstimatedCost(provider string) float64 {
+	if e.cost == nil {
+		return 0
+	}
+	cost, _ := e.cost(provider)
+	return cost
+}
+
+// orderByCost sorts candidates by the estimated cost of the request,
+// cheapest first. Candidates without a price keep their order after the
+// priced ones.
+func (g *Gateway) orderByCost(candidates []ruleProvider, modelName string, tokenCount int) []ruleProvider {
+	type priced struct {
+		candidate ruleProvider
+		cost      float64
+		known     bool
+	}
+	entries := make([]priced, len(candidates))
+	for i, c := range candidates {
+		cost, ok := g.estimatedCost(c, modelName, tokenCount)
+		entries[i] = priced{candidate: c, cost: cost, known: ok}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].known != entries[j].known {
+			return entries[i].known
+		}
+		return entries[i].known && entries[i].cost < entries[j].cost
+	})
+	ordered := make([]ruleProvider, len(entries))
+	for i, e := range entries {
+		ordered[i] = e.candidate
+	}
+	return ordered
+}
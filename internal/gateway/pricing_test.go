@@ -0,0 +1,171 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func TestPricingSyncFeedsCostAndRouting(t *testing.T) {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer feed" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{
+			"sample_spec": {"max_tokens": "set to max_output_tokens if provider specifies it"},
+			"gpt-4o": {"input_cost_per_token": 2.5e-06, "output_cost_per_token": 1e-05},
+			"openrouter/openai/gpt-4o": {"input_cost_per_token": 2e-06, "output_cost_per_token": 8e-06},
+			"gpt-4o-mini": {"input": 0.15, "output": 0.6}
+		}`))
+	}))
+	t.Cleanup(feed.Close)
+
+	cfg := &config.Config{
+		Pricing: &config.PricingConfig{
+			EstimatedOutputTokens: 512,
+			Sync:                  &config.PricingSyncConfig{URL: feed.URL, Headers: map[string]string{"Authorization": "Bearer feed"}, TimeoutSeconds: 5},
+			Prices:                []config.ProviderPrice{{Model: "gpt-4o-mini", Input: 1, Output: 1}},
+		},
+		Providers: []config.ProviderConfig{
+			{ID: "official", BaseURL: "http://official", AccessToken: "t"},
+			{ID: "unpriced", BaseURL: "http://unpriced", AccessToken: "t"},
+			{ID: "router", Type: config.ProviderTypeOpenRouter, BaseURL: "http://router", AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{{
+			Name:      "gpt-4o",
+			Strategy:  config.StrategyLowestCost,
+			Providers: []config.ModelProvider{{ID: "official"}, {ID: "unpriced", Model: "custom-4o"}, {ID: "router"}},
+		}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	if cost := gw.requestCost(storage.UsageRecord{Provider: "official", Model: "gpt-4o", RequestTokens: 1000}); cost != nil {
+		t.Fatalf("expected no price before the sync, got %+v", cost)
+	}
+
+	gw.syncPrices(context.Background())
+
+	cost := gw.requestCost(storage.UsageRecord{Provider: "official", Model: "gpt-4o", RequestTokens: 1000, ResponseTokens: 100})
+	if cost == nil || cost.input != 0.0025 || cost.output != 0.001 {
+		t.Fatalf("unexpected synced cost %+v", cost)
+	}
+	if price, ok := gw.priceOf("official", "gpt-4o-mini"); !ok || price.Input != 1 {
+		t.Fatalf("expected pricing.prices to override the feed, got %+v %v", price, ok)
+	}
+	if price, ok := gw.priceOf("router", "openai/gpt-4o"); !ok || price.Input != 2 {
+		t.Fatalf("expected the provider type prefixed price, got %+v %v", price, ok)
+	}
+
+	plan, err := gw.DryRun([]byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`), RequestTypeChatCompletions, "/v1/chat/completions")
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	order := []string{plan.Providers[0].Provider, plan.Providers[1].Provider, plan.Providers[2].Provider}
+	if order[0] != "router" || order[1] != "official" || order[2] != "unpriced" {
+		t.Fatalf("expected cheapest first and unpriced last, got %v", order)
+	}
+}
+
+func TestParsePricesRejectsFeedWithoutPrices(t *testing.T) {
+	if _, err := parsePrices([]byte(`{"sample_spec": {"mode": "chat"}}`)); err == nil {
+		t.Fatal("expected an error for a feed without prices")
+	}
+	if _, err := parsePrices([]byte(`[]`)); err == nil {
+		t.Fatal("expected an error for a feed that is not an object")
+	}
+}
+
+func TestLowestCostStrategyAndEstimatedCost(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "cheap-input", BaseURL: "http://a", AccessToken: "t"},
+			{ID: "cheap-output", BaseURL: "http://b", AccessToken: "t"},
+			{ID: "unpriced", BaseURL: "http://c", AccessToken: "t"},
+		},
+		Pricing: &config.PricingConfig{EstimatedOutputTokens: 1000, Prices: []config.ProviderPrice{
+			{Provider: "cheap-input", Model: "gpt-4o", Input: 1, Output: 20},
+			{Provider: "cheap-output", Model: "gpt-4o-2024", Input: 5, Output: 10},
+			{Model: "gpt-4o", Input: 100, Output: 100},
+		}},
+		Models: []config.ModelConfig{
+			{
+				Name:      "gpt-4o",
+				Strategy:  config.StrategyLowestCost,
+				Providers: []config.ModelProvider{{ID: "unpriced", Model: "other"}, {ID: "cheap-input"}, {ID: "cheap-output", Model: "gpt-4o-2024"}},
+			},
+			{
+				Name:      "routed",
+				Providers: []config.ModelProvider{{ID: "cheap-input", Model: "gpt-4o"}},
+				Rules: []config.RuleConfig{{
+					Expression: `EstimatedCost("cheap-input") > 0.025`,
+					Providers:  config.ProviderOverrideConfig{{Provider: "cheap-output", Model: "gpt-4o-2024"}},
+				}},
+			},
+		},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	ids := func(model string, tokens int) []string {
+		var ids []string
+		for _, p := range gw.selectProviders(gw.models[model], model, tokens, "/v1/chat/completions") {
+			ids = append(ids, p.id)
+		}
+		return ids
+	}
+
+	// 1000 prompt tokens: 0.021 on cheap-input and 0.015 on cheap-output.
+	if got := ids("gpt-4o", 1000); got[0] != "cheap-output" || got[1] != "cheap-input" || got[2] != "unpriced" {
+		t.Fatalf("expected the cheapest estimate first, got %v", got)
+	}
+	// 10000 prompt tokens: 0.03 on cheap-input and 0.06 on cheap-output.
+	if got := ids("gpt-4o", 10000); got[0] != "cheap-input" || got[1] != "cheap-output" {
+		t.Fatalf("expected cheap-input for a large prompt, got %v", got)
+	}
+
+	if got := ids("routed", 0); got[0] != "cheap-input" {
+		t.Fatalf("expected the default providers under the cost limit, got %v", got)
+	}
+	if got := ids("routed", 10000); got[0] != "cheap-output" {
+		t.Fatalf("expected the rule to route expensive requests, got %v", got)
+	}
+}
+
+func TestPriceTableLookupOrder(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "official", BaseURL: "http://official", AccessToken: "t"},
+			{ID: "reseller", BaseURL: "http://reseller", AccessToken: "t"},
+		},
+		Pricing: &config.PricingConfig{Prices: []config.ProviderPrice{
+			{Model: "gpt-4o", Input: 2.5, Output: 10},
+			{Provider: "reseller", Model: "gpt-4o", Input: 1, Output: 4},
+			{Model: "gpt-4o-mini", Input: 0.15, Output: 0.6},
+		}},
+		Models: []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "official"}, {ID: "reseller"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	for _, c := range []struct {
+		provider, model string
+		input           float64
+	}{
+		{"reseller", "gpt-4o", 1},
+		{"official", "gpt-4o", 2.5},
+		{"official", "gpt-4o-mini", 0.15},
+	} {
+		if price, ok := gw.priceOf(c.provider, c.model); !ok || price.Input != c.input {
+			t.Errorf("price of %s on %s: got %+v %v, want input %v", c.model, c.provider, price, ok, c.input)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+)
+
+// rateScope identifies a token bucket shared by all requests that map to the same id.
+type rateScope struct {
+	id    string
+	name  string
+	limit config.RateLimitConfig
+}
+
+func (s rateScope) capacity() float64 {
+	if s.limit.Burst > 0 {
+		return float64(s.limit.Burst)
+	}
+	return float64(s.limit.RequestsPerMinute)
+}
+
+func (s rateScope) perSecond() float64 {
+	return float64(s.limit.RequestsPerMinute) / 60
+}
+
+type rateBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter keeps one token bucket per scope in memory.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+	now     func() time.Time
+}
+
+// errRateLimited reports which scope rejected the request and when to retry.
+type errRateLimited struct {
+	scope      string
+	retryAfter time.Duration
+}
+
+func (e *errRateLimited) Error() string {
+	return fmt.Sprintf("%s rate limit exceeded, retry after %s", e.scope, e.retryAfter.Round(time.Second))
+}
+
+// retryAfterSeconds formats the wait for the Retry-After header, rounded up to whole seconds.
+func (e *errRateLimited) retryAfterSeconds() string {
+	return strconv.Itoa(int(math.Ceil(e.retryAfter.Seconds())))
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*rateBucket), now: time.Now}
+}
+
+// allow takes one token from every scope, or none of them when any scope is exhausted.
+func (l *rateLimiter) allow(scopes []rateScope) error {
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	buckets := make([]*rateBucket, len(scopes))
+	for i, scope := range scopes {
+		capacity, rate := scope.capacity(), scope.perSecond()
+		bucket, ok := l.buckets[scope.id]
+		if !ok {
+			bucket = &rateBucket{tokens: capacity, updated: now}
+			l.buckets[scope.id] = bucket
+		}
+		bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+		bucket.updated = now
+		if bucket.tokens < 1 {
+			wait := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+			return &errRateLimited{scope: scope.name, retryAfter: wait}
+		}
+		buckets[i] = bucket
+	}
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return nil
+}
+
+// rateScopesFor returns the rate limits that apply to the calling key and its tenant.
+func (g *Gateway) rateScopesFor(ctx context.Context, tenant *tenantRoute) []rateScope {
+	var scopes []rateScope
+	if g.cfg.RateLimit != nil {
+		if identity, ok := internalmw.IdentityFromContext(ctx); ok && identity.Key != "" {
+			scopes = append(scopes, rateScope{id: "key:" + identity.Key, name: "key " + maskKey(identity.Key), limit: *g.cfg.RateLimit})
+		}
+	}
+	if tenant != nil && tenant.config.RateLimit != nil {
+		scopes = append(scopes, rateScope{id: "tenant:" + tenant.config.ID, name: "tenant " + tenant.config.ID, limit: *tenant.config.RateLimit})
+	}
+	return scopes
+}
+
+func (g *Gateway) checkRateLimits(ctx context.Context, tenant *tenantRoute) error {
+	return g.limiter.allow(g.rateScopesFor(ctx, tenant))
+}
+
+// maskKey keeps API keys out of error messages while leaving them distinguishable.
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+)
+
+func TestProxySharesTenantRateLimitAcrossKeys(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "token"}},
+		Models:    []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+		Tenants: []config.TenantConfig{
+			{ID: "team-a", APIKeys: []string{"sk-a1", "sk-a2"}, RateLimit: &config.RateLimitConfig{RequestsPerMinute: 2}},
+		},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	gw.limiter.now = func() time.Time { return now }
+
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o"}`)))
+		req = req.WithContext(internalmw.WithIdentity(req.Context(), internalmw.Identity{Key: key, Tenant: "team-a"}))
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+		return rec
+	}
+
+	if rec := send("sk-a1"); rec.Code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", rec.Code)
+	}
+	if rec := send("sk-a2"); rec.Code != http.StatusOK {
+		t.Fatalf("expected second request to pass, got %d", rec.Code)
+	}
+	rec := send("sk-a1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected third request to be limited, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Fatalf("expected Retry-After 30, got %q", got)
+	}
+
+	now = now.Add(30 * time.Second)
+	if rec := send("sk-a2"); rec.Code != http.StatusOK {
+		t.Fatalf("expected request to pass after refill, got %d", rec.Code)
+	}
+}
+
+func TestRateLimiterDoesNotConsumeOnRejection(t *testing.T) {
+	limiter := newRateLimiter()
+	now := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return now }
+
+	key := rateScope{id: "key:a", name: "key a", limit: config.RateLimitConfig{RequestsPerMinute: 60, Burst: 5}}
+	tenant := rateScope{id: "tenant:t", name: "tenant t", limit: config.RateLimitConfig{RequestsPerMinute: 1}}
+
+	if err := limiter.allow([]rateScope{key, tenant}); err != nil {
+		t.Fatalf("expected first request to pass: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := limiter.allow([]rateScope{key, tenant}); err == nil {
+			t.Fatalf("expected tenant limit to reject request %d", i)
+		}
+	}
+	// The rejected requests must not have drained the key bucket.
+	for i := 0; i < 4; i++ {
+		if err := limiter.allow([]rateScope{key}); err != nil {
+			t.Fatalf("expected key bucket to still have tokens: %v", err)
+		}
+	}
+}
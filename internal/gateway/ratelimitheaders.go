@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isRateLimitHeader reports whether a provider response header describes the
+// provider's rate limits.
+func isRateLimitHeader(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "x-ratelimit-") || strings.HasPrefix(name, "anthropic-ratelimit-")
+}
+
+// relayRateLimitHeaders adapts the provider rate limit headers of a response
+// about to be sent to the client as configured by rate_limit_headers.
+func (g *Gateway) relayRateLimitHeaders(header http.Header) {
+	cfg := g.cfg.RateLimitHeaders
+	if cfg == nil || cfg.RenamePrefix == "" {
+		return
+	}
+	for name, values := range header {
+		if !isRateLimitHeader(name) {
+			continue
+		}
+		header.Del(name)
+		header[http.CanonicalHeaderKey(cfg.RenamePrefix+name)] = values
+	}
+}
+
+// retryAfter returns the wait a response asks for in its retry-after-ms or
+// retry-after header, the latter in seconds or as an HTTP date.
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if ms, err := strconv.ParseFloat(strings.TrimSpace(header.Get("retry-after-ms")), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// setRetryAfter sets retry-after, rounded up to whole seconds, and
+// retry-after-ms, which the OpenAI SDKs prefer.
+func setRetryAfter(header http.Header, wait time.Duration) {
+	header.Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	header.Set("retry-after-ms", strconv.FormatInt(wait.Milliseconds(), 10))
+}
+
+// retryAfterTracker keeps the shortest wait the providers attempted for a
+// request asked for.
+type retryAfterTracker struct {
+	shortest time.Duration
+	found    bool
+}
+
+func (t *retryAfterTracker) observe(err *retryableError) {
+	wait, ok := retryAfter(err.header, time.Now())
+	if !ok {
+		return
+	}
+	if !t.found || wait < t.shortest {
+		t.shortest, t.found = wait, true
+	}
+}
+
+// writeProviderError relays the error response of the last provider tried.
+// With aggregate_retry_after, rate limited and unavailable responses carry the
+// shortest wait any attempted provider asked for.
+func (g *Gateway) writeProviderError(w http.ResponseWriter, err *retryableError, retry retryAfterTracker) {
+	copyResponseHeaders(w.Header(), err.header)
+	if cfg := g.cfg.RateLimitHeaders; cfg != nil && cfg.AggregateRetryAfter && retry.found &&
+		(err.status == http.StatusTooManyRequests || err.status >= http.StatusInternalServerError) {
+		setRetryAfter(w.Header(), retry.shortest)
+	}
+	g.relayRateLimitHeaders(w.Header())
+	if g.cfg.AnonymizeProviders {
+		stripProviderHeaders(w.Header())
+	}
+	w.WriteHeader(err.status)
+	if len(err.body) > 0 {
+		_, _ = w.Write(err.body)
+	}
+}
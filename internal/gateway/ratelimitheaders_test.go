@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		header http.Header
+		want   time.Duration
+		ok     bool
+	}{
+		{http.Header{"Retry-After": {"3"}}, 3 * time.Second, true},
+		{http.Header{"Retry-After": {"3"}, "Retry-After-Ms": {"1500"}}, 1500 * time.Millisecond, true},
+		{http.Header{"Retry-After": {now.Add(20 * time.Second).Format(http.TimeFormat)}}, 20 * time.Second, true},
+		{http.Header{"Retry-After": {"soon"}}, 0, false},
+		{http.Header{}, 0, false},
+	} {
+		got, ok := retryAfter(tc.header, now)
+		if got != tc.want || ok != tc.ok {
+			t.Fatalf("retryAfter(%v) = %v, %v; want %v, %v", tc.header, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestProxyRelaysRateLimitHeaders(t *testing.T) {
+	limited := func(wait string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", wait)
+			w.Header().Set("X-Ratelimit-Remaining-Requests", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error":{"message":"rate limited"}}`))
+		}))
+	}
+	first, second := limited("2"), limited("30")
+	t.Cleanup(first.Close)
+	t.Cleanup(second.Close)
+
+	cfg := &config.Config{
+		RateLimitHeaders: &config.RateLimitHeadersConfig{RenamePrefix: "upstream-", AggregateRetryAfter: true},
+		Providers: []config.ProviderConfig{
+			{ID: "p1", BaseURL: first.URL, AccessToken: "t"},
+			{ID: "p2", BaseURL: second.URL, AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}, {ID: "p2"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o"}`)))
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Fatalf("expected the shortest retry-after, got %q", got)
+	}
+	if got := rec.Header().Get("Retry-After-Ms"); got != "2000" {
+		t.Fatalf("unexpected retry-after-ms %q", got)
+	}
+	if rec.Header().Get("X-Ratelimit-Remaining-Requests") != "" || rec.Header().Get("Upstream-X-Ratelimit-Remaining-Requests") != "0" {
+		t.Fatalf("rate limit headers were not renamed: %v", rec.Header())
+	}
+}
@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"maps"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// Reload compiles cfg into a new gateway that continues what g observed at
+// runtime: live statistics, rate limit buckets, usage event subscribers,
+// provider health, models found missing or discovered, warm-up and health
+// check results and synced prices. g is left as it is, so the requests it is
+// serving finish with the configuration they started with.
+//
+// Budgets are loaded from the usage store again by the new gateway; tenants
+// onboarded at runtime must be part of cfg.
+func (g *Gateway) Reload(cfg *config.Config) (*Gateway, error) {
+	next, err := New(cfg, g.usageStore)
+	if err != nil {
+		return nil, err
+	}
+
+	next.live = g.live
+	// The live statistics are the first metric sink of every gateway.
+	next.metricSinks[0] = next.live
+	next.limiter = g.limiter
+	next.feed = g.feed
+
+	next.health.inherit(g.health)
+	next.unavailable.inherit(g.unavailable)
+	next.warmups.inherit(&g.warmups)
+	next.checks.inherit(&g.checks)
+	next.prices.inherit(&g.prices)
+
+	g.discoveredMu.RLock()
+	// Discovery replaces the map rather than changing it, so it can be shared.
+	next.discovered = g.discovered
+	g.discoveredMu.RUnlock()
+	return next, nil
+}
+
+// inherit copies the provider states of prev; the failure threshold stays the
+// configured one.
+func (h *providerHealth) inherit(prev *providerHealth) {
+	prev.mu.Lock()
+	defer prev.mu.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id, st := range prev.states {
+		copied := *st
+		h.states[id] = &copied
+	}
+}
+
+// inherit copies the models prev marked missing; they stay missing until the
+// time prev set.
+func (u *unavailableModels) inherit(prev *unavailableModels) {
+	prev.mu.Lock()
+	defer prev.mu.Unlock()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	maps.Copy(u.until, prev.until)
+}
+
+func (w *warmupResults) inherit(prev *warmupResults) {
+	prev.mu.Lock()
+	defer prev.mu.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.results = maps.Clone(prev.results)
+}
+
+func (h *healthChecks) inherit(prev *healthChecks) {
+	prev.mu.Lock()
+	defer prev.mu.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.statuses = make(map[string]*HealthCheckStatus, len(prev.statuses))
+	for id, st := range prev.statuses {
+		copied := *st
+		h.statuses[id] = &copied
+	}
+}
+
+func (p *syncedPrices) inherit(prev *syncedPrices) {
+	prev.mu.RLock()
+	defer prev.mu.RUnlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// The pricing sync replaces the map rather than changing it.
+	p.prices = prev.prices
+}
@@ -0,0 +1,51 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestReloadKeepsRuntimeState(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "p1", BaseURL: "http://p1", AccessToken: "t"},
+			{ID: "p2", BaseURL: "http://p2", AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}, {ID: "p2"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	gw.health.failure("p2")
+
+	next := &config.Config{
+		Providers: cfg.Providers,
+		Models:    []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p2"}, {ID: "p1"}}}},
+	}
+	reloaded, err := gw.Reload(next)
+	if err != nil {
+		t.Fatalf("reload gateway: %v", err)
+	}
+	first := func(g *Gateway) string {
+		return g.selectProviders(g.models["gpt-4o"], "gpt-4o", 0, "/v1/chat/completions")[0].id
+	}
+	if got := first(gw); got != "p1" {
+		t.Fatalf("the previous gateway must keep its provider order, got %s first", got)
+	}
+	if got := first(reloaded); got != "p2" {
+		t.Fatalf("expected the reloaded provider order, got %s first", got)
+	}
+	if failures, _ := reloaded.health.snapshot("p2"); failures != 1 {
+		t.Fatalf("expected the provider failures to carry over, got %d", failures)
+	}
+	if reloaded.live != gw.live || reloaded.limiter != gw.limiter {
+		t.Fatal("expected live statistics and rate limits to be shared")
+	}
+
+	next.Models[0].Rules = []config.RuleConfig{{Expression: "TokenCount >"}}
+	if _, err := gw.Reload(next); err == nil {
+		t.Fatal("expected an invalid configuration to be rejected")
+	}
+}
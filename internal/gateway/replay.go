@@ -0,0 +1,138 @@
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tidwall/gjson"
+
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// ReplayHeader names the request a replayed response belongs to.
+const ReplayHeader = "X-Gateway-Replay-Of"
+
+var (
+	// ErrUnknownProvider is returned by Replay for a provider that is not configured.
+	ErrUnknownProvider = errors.New("unknown provider")
+	// ErrNotReplayable is returned by Replay for a request log of an endpoint
+	// that is not proxied.
+	ErrNotReplayable = errors.New("request is not replayable")
+)
+
+// requestTypeOfPath returns the request type of a proxied endpoint.
+func requestTypeOfPath(path string) (RequestType, bool) {
+	switch path {
+	case "/v1/chat/completions":
+		return RequestTypeChatCompletions, true
+	case "/v1/responses":
+		return RequestTypeResponses, true
+	case "/v1/messages":
+		return RequestTypeAnthropicMessages, true
+	}
+	return 0, false
+}
+
+// Replay sends a stored request to one provider and writes its response to w,
+// for debugging provider specific failures and comparing outputs. The body is
+// sent as stored, so scrubbed or redacted fields stay that way. Model is the
+// provider model, by default the one configured for the provider under the
+// requested model. Replays bypass routing, limits and budgets and are not
+// recorded as usage.
+func (g *Gateway) Replay(w http.ResponseWriter, r *http.Request, entry storage.RequestLog, providerID, model string) error {
+	provider, ok := g.providers[providerID]
+	if !ok {
+		return fmt.Errorf("%w %s", ErrUnknownProvider, providerID)
+	}
+	target, err := url.Parse(entry.Path)
+	if err != nil {
+		return fmt.Errorf("%w: parse path: %v", ErrNotReplayable, err)
+	}
+	reqType, ok := requestTypeOfPath(target.Path)
+	if !ok {
+		return fmt.Errorf("%w: %s is not a proxied endpoint", ErrNotReplayable, target.Path)
+	}
+
+	body := []byte(entry.Body)
+	modelName := gjson.GetBytes(body, "model").String()
+	if model == "" {
+		model = g.targetModelOf(ruleProvider{id: providerID, model: g.providerModelOf(modelName, providerID)}, modelName)
+	}
+	if body, err = providerBody(body, modelName, model, provider); err != nil {
+		return fmt.Errorf("modify request body: %w", err)
+	}
+
+	method := entry.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(r.Context(), method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create replay request: %w", err)
+	}
+	for k, values := range entry.Headers {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+
+	requestID, _ := internalmw.RequestIDFromContext(r.Context())
+	internalmw.Logger(r.Context()).Infof("replay request %s to provider %s(%s)", entry.RequestID, providerID, model)
+	recorder := &replayWriter{statusRecorder: statusRecorder{ResponseWriter: w}, requestID: entry.RequestID}
+	stream := gjson.GetBytes(body, "stream").Bool()
+	_, err = g.forwardRequest(recorder, req, provider, model, body, 0, target.Path, stream, reqType, 1, requestID, modelName)
+	var retryErr *retryableError
+	if errors.As(err, &retryErr) {
+		// The provider's error response is the outcome being debugged.
+		copyResponseHeaders(recorder.Header(), retryErr.header)
+		recorder.WriteHeader(retryErr.status)
+		_, _ = recorder.Write(retryErr.body)
+		return nil
+	}
+	if err != nil && recorder.status != 0 {
+		internalmw.Logger(r.Context()).Warningf("replay request %s to provider %s: %v", entry.RequestID, providerID, err)
+		return nil
+	}
+	return err
+}
+
+// providerModelOf returns the provider model configured for a provider under
+// a model, or "" when it is not configured or uses the requested name.
+func (g *Gateway) providerModelOf(modelName, providerID string) string {
+	route, ok := g.models[strings.TrimSpace(modelName)]
+	if !ok {
+		return ""
+	}
+	for _, p := range route.config.Providers {
+		if p.ID == providerID {
+			return p.Model
+		}
+	}
+	return ""
+}
+
+// replayWriter sets the replay header when the response is written, since the
+// provider's response headers replace those set before.
+type replayWriter struct {
+	statusRecorder
+	requestID string
+}
+
+func (w *replayWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.Header().Set(ReplayHeader, w.requestID)
+	}
+	w.statusRecorder.WriteHeader(status)
+}
+
+func (w *replayWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.statusRecorder.Write(p)
+}
@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func TestReplaySendsStoredRequestToProvider(t *testing.T) {
+	var gotModel, gotAuth, gotPath string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotModel = gjson.GetBytes(body, "model").String()
+		gotAuth = r.Header.Get("Authorization")
+		gotPath = r.URL.Path
+		if gotModel == "broken" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":"overloaded"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"c1"}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "p1", BaseURL: "http://p1.invalid", AccessToken: "t1"},
+			{ID: "p2", BaseURL: provider.URL, AccessToken: "t2"},
+		},
+		Models: []config.ModelConfig{{
+			Name:      "gpt-4o",
+			Providers: []config.ModelProvider{{ID: "p1"}, {ID: "p2", Model: "gpt-4o-2024"}},
+		}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	entry := storage.RequestLog{
+		RequestID: "req-1",
+		Method:    http.MethodPost,
+		Path:      "/v1/chat/completions",
+		Headers:   map[string][]string{"Authorization": {"Bearer sk-c****"}},
+		Body:      `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`,
+	}
+
+	rec := httptest.NewRecorder()
+	if err := gw.Replay(rec, httptest.NewRequest(http.MethodPost, "/admin/replay/req-1", nil), entry, "p2", ""); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"id":"c1"}` || rec.Header().Get(ReplayHeader) != "req-1" {
+		t.Fatalf("unexpected replay response %d %q %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+	if gotModel != "gpt-4o-2024" || gotAuth != "Bearer t2" || gotPath != "/chat/completions" {
+		t.Fatalf("unexpected provider request: model %q, auth %q, path %q", gotModel, gotAuth, gotPath)
+	}
+	if gw.live.provider("p2").Requests != 0 {
+		t.Fatal("replays must not be recorded as usage")
+	}
+
+	rec = httptest.NewRecorder()
+	if err := gw.Replay(rec, httptest.NewRequest(http.MethodPost, "/admin/replay/req-1", nil), entry, "p2", "broken"); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != `{"error":"overloaded"}` || rec.Header().Get(ReplayHeader) != "req-1" {
+		t.Fatalf("expected the provider error to be relayed, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	if err := gw.Replay(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil), entry, "missing", ""); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("expected an unknown provider error, got %v", err)
+	}
+	entry.Path = "/usage"
+	if err := gw.Replay(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil), entry, "p2", ""); !errors.Is(err, ErrNotReplayable) {
+		t.Fatalf("expected a not replayable error, got %v", err)
+	}
+}
@@ -2,16 +2,21 @@ package gateway
 
 import (
 	"context"
+	"math/rand/v2"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/mylxsw/asteria/log"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
 
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
 	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
 )
 
-func (g *Gateway) saveRequestLog(ctx context.Context, r *http.Request, body []byte, requestID string) {
+func (g *Gateway) saveRequestLog(ctx context.Context, r *http.Request, body []byte, requestID string, tags map[string]string) {
 	if g.usageStore == nil || !g.cfg.SaveUsage {
 		return
 	}
@@ -27,7 +32,11 @@ func (g *Gateway) saveRequestLog(ctx context.Context, r *http.Request, body []by
 		Method:    r.Method,
 		Path:      path,
 		Headers:   sanitizeHeaders(r.Header),
-		Body:      string(body),
+		Body:      g.scrubber.scrub(r.URL.Path, string(redactPaths(body, g.cfg.LogRedactPaths))),
+		Tags:      tags,
+	}
+	if identity, ok := internalmw.IdentityFromContext(ctx); ok && identity.Tenant != "" {
+		entry.Meta = map[string]string{"tenant": identity.Tenant}
 	}
 
 	go func(logEntry storage.RequestLog) {
@@ -38,11 +47,123 @@ func (g *Gateway) saveRequestLog(ctx context.Context, r *http.Request, body []by
 		ctxWithTimeout, cancel := context.WithTimeout(base, 5*time.Second)
 		defer cancel()
 		if err := g.usageStore.RecordRequestLog(ctxWithTimeout, logEntry); err != nil {
-			log.Warningf("save request log: %v", err)
+			internalmw.Logger(ctx).Warningf("save request log: %v", err)
+		}
+	}(entry)
+}
+
+type responseLogKey struct{}
+
+// withResponseLog marks a request whose final response body is stored.
+func withResponseLog(ctx context.Context) context.Context {
+	return context.WithValue(ctx, responseLogKey{}, true)
+}
+
+func responseLogRequested(ctx context.Context) bool {
+	requested, _ := ctx.Value(responseLogKey{}).(bool)
+	return requested
+}
+
+// sampleResponseLog decides whether the response of a request is stored.
+func (g *Gateway) sampleResponseLog() bool {
+	if g.usageStore == nil || !g.cfg.SaveUsage || g.cfg.ResponseLogs == nil {
+		return false
+	}
+	if _, ok := g.usageStore.(storage.ResponseLogStore); !ok {
+		return false
+	}
+	return rand.Float64() < g.cfg.ResponseLogs.SampleRate
+}
+
+// saveResponseLog stores the response body of a sampled request, scrubbed like
+// its request body and cut at response_logs.max_bytes.
+func (g *Gateway) saveResponseLog(r *http.Request, requestID, providerID, model string, status int, body []byte) {
+	store, ok := g.usageStore.(storage.ResponseLogStore)
+	if !ok {
+		return
+	}
+	entry := storage.ResponseLog{
+		CreatedAt:  time.Now(),
+		RequestID:  requestID,
+		Provider:   providerID,
+		Model:      model,
+		StatusCode: status,
+	}
+	if len(body) > g.cfg.ResponseLogs.MaxBytes {
+		body = body[:g.cfg.ResponseLogs.MaxBytes]
+		entry.Truncated = true
+	}
+	entry.Body = g.scrubber.scrub(r.URL.Path, string(body))
+	if identity, ok := internalmw.IdentityFromContext(r.Context()); ok {
+		entry.Tenant = identity.Tenant
+	}
+
+	ctx := r.Context()
+	go func(logEntry storage.ResponseLog) {
+		ctxWithTimeout, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if err := store.RecordResponseLog(ctxWithTimeout, logEntry); err != nil {
+			internalmw.Logger(ctx).Warningf("save response log: %v", err)
 		}
 	}(entry)
 }
 
+// debugRequest logs the request headers and body with credentials masked and
+// the log_redact_paths fields removed.
+func (g *Gateway) debugRequest(r *http.Request, body []byte) {
+	logger := internalmw.Logger(r.Context())
+	if !logger.DebugEnabled() {
+		return
+	}
+	logger.Debugf("request headers: %v", sanitizeHeaders(r.Header))
+	logger.Debug("request body: ", string(redactPaths(body, g.cfg.LogRedactPaths)))
+}
+
+// redactPaths replaces the values at the JSON paths with "[REDACTED]". A "#"
+// segment matches every element of an array. Bodies that are not JSON and
+// paths that are absent are left alone.
+func redactPaths(body []byte, paths []string) []byte {
+	if len(paths) == 0 || !gjson.ValidBytes(body) {
+		return body
+	}
+	for _, path := range paths {
+		for _, concrete := range expandRedactPath(body, path) {
+			if redacted, err := sjson.SetBytes(body, concrete, "[REDACTED]"); err == nil {
+				body = redacted
+			}
+		}
+	}
+	return body
+}
+
+// expandRedactPath resolves the "#" segments of path to the array indexes
+// present in body.
+func expandRedactPath(body []byte, path string) []string {
+	segments := strings.Split(path, ".")
+	i := slices.Index(segments, "#")
+	if i < 0 {
+		if gjson.GetBytes(body, path).Exists() {
+			return []string{path}
+		}
+		return nil
+	}
+
+	prefix := strings.Join(segments[:i], ".")
+	array := gjson.ParseBytes(body)
+	if prefix != "" {
+		array = gjson.GetBytes(body, prefix)
+	}
+	if !array.IsArray() {
+		return nil
+	}
+	var paths []string
+	for n := range len(array.Array()) {
+		element := append(slices.Clone(segments[:i]), strconv.Itoa(n))
+		paths = append(paths, expandRedactPath(body, strings.Join(append(element, segments[i+1:]...), "."))...)
+	}
+	return paths
+}
+
 func sanitizeHeaders(headers http.Header) map[string][]string {
 	if headers == nil {
 		return nil
@@ -52,9 +173,9 @@ func sanitizeHeaders(headers http.Header) map[string][]string {
 		cleanVals := make([]string, 0, len(values))
 		for _, v := range values {
 			switch strings.ToLower(k) {
-			case "authorization":
+			case "authorization", "proxy-authorization":
 				cleanVals = append(cleanVals, maskAuthorizationValue(v))
-			case "x-api-key":
+			case "x-api-key", "api-key", "x-goog-api-key":
 				cleanVals = append(cleanVals, maskToken(v))
 			default:
 				cleanVals = append(cleanVals, v)
@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func TestRedactPaths(t *testing.T) {
+	body := []byte(`{"model":"gpt-4o","messages":[{"role":"system","content":"secret a"},{"role":"user","content":[{"type":"text","text":"secret b"},{"type":"text","text":"secret c"}]}],"metadata":{"token":"t"}}`)
+	got := string(redactPaths(body, []string{"messages.#.content.#.text", "metadata.token", "tools.#.function"}))
+	want := `{"model":"gpt-4o","messages":[{"role":"system","content":"secret a"},{"role":"user","content":[{"type":"text","text":"[REDACTED]"},{"type":"text","text":"[REDACTED]"}]}],"metadata":{"token":"[REDACTED]"}}`
+	if got != want {
+		t.Fatalf("unexpected redacted body\n got %s\nwant %s", got, want)
+	}
+	if got := string(redactPaths([]byte("not json"), []string{"messages"})); got != "not json" {
+		t.Fatalf("expected non JSON bodies to be left alone, got %s", got)
+	}
+}
+
+func TestSanitizeHeaders(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer sk-abcdefghijklmnop")
+	headers.Set("x-api-key", "sk-ant-0123456789")
+	headers.Set("api-key", "azure-0123456789")
+	headers.Set("Content-Type", "application/json")
+
+	sanitized := sanitizeHeaders(headers)
+	if got := sanitized["Authorization"][0]; got != "Bearer sk-a***********mnop" {
+		t.Fatalf("unexpected authorization %s", got)
+	}
+	if got := sanitized["X-Api-Key"][0]; got != "sk-a*********6789" {
+		t.Fatalf("unexpected x-api-key %s", got)
+	}
+	if got := sanitized["Api-Key"][0]; got != "azur********6789" {
+		t.Fatalf("unexpected api-key %s", got)
+	}
+	if got := sanitized["Content-Type"][0]; got != "application/json" {
+		t.Fatalf("unexpected content type %s", got)
+	}
+}
+
+func TestProxyStoresSampledResponse(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"c1","choices":[{"message":{"content":"reach me at jane@example.com"}}]}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	store, err := storage.New(context.Background(), "sqlite", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "usage.db")))
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close(context.Background()) })
+
+	cfg := &config.Config{
+		SaveUsage:    true,
+		ResponseLogs: &config.ResponseLogConfig{SampleRate: 1, MaxBytes: 75},
+		PIIScrubbing: &config.PIIScrubbingConfig{},
+		Providers:    []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:       []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, store)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o"}`)))
+	req = req.WithContext(internalmw.WithRequestID(req.Context(), "req-1"))
+	gw.Proxy(httptest.NewRecorder(), req, RequestTypeChatCompletions)
+
+	responses := store.(storage.ResponseLogStore)
+	deadline := time.Now().Add(5 * time.Second)
+	var stored *storage.ResponseLog
+	for stored == nil && time.Now().Before(deadline) {
+		if stored, err = responses.GetResponseLog(context.Background(), "req-1"); err != nil {
+			t.Fatalf("get response log: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stored == nil {
+		t.Fatal("response log was not stored")
+	}
+	if stored.Provider != "p1" || stored.StatusCode != http.StatusOK || !stored.Truncated || bytes.Contains([]byte(stored.Body), []byte("jane@example.com")) {
+		t.Fatalf("unexpected response log %+v", stored)
+	}
+	waitForStoredUsage(t, store, "req-1")
+}
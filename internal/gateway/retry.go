@@ -0,0 +1,60 @@
+package gateway
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// retryPolicy returns the retry policy of requests for a model sent to a
+// provider: the provider's, else the model's, else the global one. It is nil
+// when none is configured.
+func (g *Gateway) retryPolicy(modelName, providerID string) *config.RetryConfig {
+	if provider, ok := g.providers[providerID]; ok && provider.Retry != nil {
+		return provider.Retry
+	}
+	if route, ok := g.models[modelName]; ok && route.config.Retry != nil {
+		return route.config.Retry
+	}
+	return g.cfg.Retry
+}
+
+// retryWait returns how long to wait after the given attempt of a provider
+// failed: the base backoff doubled for each earlier attempt, or a random share
+// of it with jitter, or the retry-after the provider asked for if longer. The
+// wait never exceeds the maximum backoff.
+func retryWait(policy *config.RetryConfig, attempt int, header http.Header, now time.Time) time.Duration {
+	limit := time.Duration(policy.BackoffMaxMs) * time.Millisecond
+	wait := time.Duration(policy.BackoffBaseMs) * time.Millisecond
+	for i := 1; i < attempt && wait < limit; i++ {
+		wait *= 2
+	}
+	if wait > limit {
+		wait = limit
+	}
+	if policy.Jitter {
+		wait = time.Duration(rand.Int63n(int64(wait) + 1))
+	}
+	if after, ok := retryAfter(header, now); ok && after > wait {
+		wait = after
+		if wait > limit {
+			wait = limit
+		}
+	}
+	return wait
+}
+
+// sleepContext waits for d and reports whether ctx is still alive.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestRetryWaitBacksOffExponentially(t *testing.T) {
+	policy := &config.RetryConfig{BackoffBaseMs: 100, BackoffMaxMs: 1000}
+	now := time.Now()
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 5: time.Second, 80: time.Second} {
+		if got := retryWait(policy, attempt, http.Header{}, now); got != want {
+			t.Fatalf("attempt %d: expected %s, got %s", attempt, want, got)
+		}
+	}
+
+	header := http.Header{}
+	header.Set("Retry-After", "1")
+	policy.BackoffMaxMs = 5000
+	if got := retryWait(policy, 1, header, now); got != time.Second {
+		t.Fatalf("expected the provider's retry-after, got %s", got)
+	}
+	header.Set("Retry-After", "60")
+	if got := retryWait(policy, 1, header, now); got != 5*time.Second {
+		t.Fatalf("expected the retry-after capped at the maximum backoff, got %s", got)
+	}
+
+	policy.Jitter = true
+	for i := 0; i < 20; i++ {
+		if got := retryWait(policy, 2, http.Header{}, now); got < 0 || got > 200*time.Millisecond {
+			t.Fatalf("expected a jittered wait up to the backoff, got %s", got)
+		}
+	}
+}
+
+func TestProxyHonorsRetryPolicy(t *testing.T) {
+	var statuses atomic.Value
+	var firstCalls, secondCalls atomic.Int64
+	first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := firstCalls.Add(1)
+		list := statuses.Load().([]int)
+		if int(call) <= len(list) {
+			http.Error(w, `{"error":{"message":"failed"}}`, list[call-1])
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"first"}`))
+	}))
+	t.Cleanup(first.Close)
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondCalls.Add(1)
+		_, _ = w.Write([]byte(`{"id":"second"}`))
+	}))
+	t.Cleanup(second.Close)
+
+	cfg := &config.Config{
+		Retry: &config.RetryConfig{MaxAttempts: 2, RetryableStatuses: []int{429, 503}, BackoffBaseMs: 1, BackoffMaxMs: 5},
+		Providers: []config.ProviderConfig{
+			{ID: "first", BaseURL: first.URL, AccessToken: "t"},
+			{ID: "second", BaseURL: second.URL, AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{
+			{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "first"}, {ID: "second"}}},
+			{Name: "gpt-4o-mini", Providers: []config.ModelProvider{{ID: "first"}, {ID: "second"}}, Retry: &config.RetryConfig{MaxAttempts: 1, RetryableStatuses: []int{503}, BackoffBaseMs: 1, BackoffMaxMs: 5}},
+		},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		model      string
+		statuses   []int
+		wantStatus int
+		wantBody   string
+		wantFirst  int64
+		wantSecond int64
+	}{
+		{"retried on the same provider", "gpt-4o", []int{503}, http.StatusOK, `{"id":"first"}`, 2, 0},
+		{"failed over after max_attempts", "gpt-4o", []int{429, 429}, http.StatusOK, `{"id":"second"}`, 2, 1},
+		{"bad requests are relayed", "gpt-4o", []int{400}, http.StatusBadRequest, "failed", 1, 0},
+		{"model policy replaces the global one", "gpt-4o-mini", []int{503}, http.StatusOK, `{"id":"second"}`, 1, 1},
+		{"model policy statuses", "gpt-4o-mini", []int{429}, http.StatusTooManyRequests, "failed", 1, 0},
+	} {
+		statuses.Store(tc.statuses)
+		firstCalls.Store(0)
+		secondCalls.Store(0)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"`+tc.model+`"}`)))
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+
+		if rec.Code != tc.wantStatus || !bytes.Contains(rec.Body.Bytes(), []byte(tc.wantBody)) {
+			t.Fatalf("%s: unexpected response %d %s", tc.name, rec.Code, rec.Body.String())
+		}
+		if firstCalls.Load() != tc.wantFirst || secondCalls.Load() != tc.wantSecond {
+			t.Fatalf("%s: expected %d/%d calls, got %d/%d", tc.name, tc.wantFirst, tc.wantSecond, firstCalls.Load(), secondCalls.Load())
+		}
+	}
+}
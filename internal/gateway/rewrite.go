@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+type responseRewriteContextKey struct{}
+
+// responseRewrite replaces routing details in responses: the provider's model
+// name with the requested one and, for chat completions, the provider's
+// completion id with one derived from the request id. With normalize, vendor
+// specific chat completion fields are removed as well.
+type responseRewrite struct {
+	model     string
+	id        string
+	normalize bool
+}
+
+func withResponseRewrite(ctx context.Context, rewrite responseRewrite) context.Context {
+	return context.WithValue(ctx, responseRewriteContextKey{}, rewrite)
+}
+
+func responseRewriteFrom(ctx context.Context) (responseRewrite, bool) {
+	rewrite, ok := ctx.Value(responseRewriteContextKey{}).(responseRewrite)
+	return rewrite, ok
+}
+
+// responseModelPaths are the fields naming the model in responses and stream
+// events: chat completions and Anthropic messages, Responses API stream
+// events, and the Anthropic message_start event.
+var responseModelPaths = []string{"model", "response.model", "message.model"}
+
+// apply rewrites a JSON response body or stream chunk; other data is returned
+// unchanged.
+func (rw responseRewrite) apply(reqType RequestType, data []byte) []byte {
+	if !gjson.ValidBytes(data) {
+		return data
+	}
+	if rw.normalize && reqType == RequestTypeChatCompletions {
+		data = normalizeChatCompletion(data)
+	}
+	for _, path := range responseModelPaths {
+		if !gjson.GetBytes(data, path).Exists() {
+			continue
+		}
+		if out, err := sjson.SetBytes(data, path, rw.model); err == nil {
+			data = out
+		}
+	}
+	// Responses and message ids stay: clients pass them back to the provider.
+	if reqType == RequestTypeChatCompletions && rw.id != "" && gjson.GetBytes(data, "id").Exists() {
+		if out, err := sjson.SetBytes(data, "id", rw.id); err == nil {
+			data = out
+		}
+	}
+	return data
+}
+
+// applyEvent rewrites the JSON data lines of a server-sent event.
+func (rw responseRewrite) applyEvent(reqType RequestType, event []byte) []byte {
+	lines := bytes.SplitAfter(event, []byte("\n"))
+	for i, line := range lines {
+		payload, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			continue
+		}
+		data := bytes.TrimSpace(payload)
+		if len(data) == 0 || data[0] != '{' {
+			continue
+		}
+		lineEnd := payload[len(bytes.TrimRight(payload, "\r\n")):]
+		rewritten := append([]byte("data: "), rw.apply(reqType, data)...)
+		lines[i] = append(rewritten, lineEnd...)
+	}
+	return bytes.Join(lines, nil)
+}
+
+// rewriteWriter applies a responseRewrite to every event of a stream.
+type rewriteWriter struct {
+	http.ResponseWriter
+	events  eventSplitter
+	rewrite responseRewrite
+	reqType RequestType
+}
+
+func newRewriteWriter(w http.ResponseWriter, rewrite responseRewrite, reqType RequestType) *rewriteWriter {
+	return &rewriteWriter{ResponseWriter: w, rewrite: rewrite, reqType: reqType}
+}
+
+func (w *rewriteWriter) Write(p []byte) (int, error) {
+	err := w.events.split(p, func(event []byte) error {
+		_, err := w.ResponseWriter.Write(w.rewrite.applyEvent(w.reqType, event))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// finish writes the trailing data that did not form a complete event.
+func (w *rewriteWriter) finish() error {
+	if len(w.events.pending) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.events.pending)
+	return err
+}
+
+func (w *rewriteWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *rewriteWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
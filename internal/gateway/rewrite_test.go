@@ -0,0 +1,110 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestResponseRewriteApply(t *testing.T) {
+	rw := responseRewrite{model: "smart", id: "chatcmpl-req1"}
+
+	chat := rw.apply(RequestTypeChatCompletions, []byte(`{"id":"chatcmpl-upstream","model":"gpt-4o-2024-08-06","choices":[]}`))
+	if gjson.GetBytes(chat, "model").String() != "smart" || gjson.GetBytes(chat, "id").String() != "chatcmpl-req1" {
+		t.Fatalf("unexpected chat response %s", chat)
+	}
+
+	event := rw.applyEvent(RequestTypeResponses, []byte("event: response.created\ndata: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_1\",\"model\":\"gpt-4o\"}}\n\n"))
+	if want := "event: response.created\ndata: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_1\",\"model\":\"smart\"}}\n\n"; string(event) != want {
+		t.Fatalf("unexpected responses event %q", event)
+	}
+
+	event = rw.applyEvent(RequestTypeAnthropicMessages, []byte("event: message_start\r\ndata: {\"message\":{\"id\":\"msg_1\",\"model\":\"claude-3-5-sonnet\"}}\r\n\r\n"))
+	if want := "event: message_start\r\ndata: {\"message\":{\"id\":\"msg_1\",\"model\":\"smart\"}}\r\n\r\n"; string(event) != want {
+		t.Fatalf("unexpected anthropic event %q", event)
+	}
+
+	if done := rw.applyEvent(RequestTypeChatCompletions, []byte("data: [DONE]\n\n")); string(done) != "data: [DONE]\n\n" {
+		t.Fatalf("non JSON data must stay, got %q", done)
+	}
+}
+
+func TestProxyRewritesResponseModel(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if gjson.GetBytes(body, "stream").Bool() {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("data: {\"id\":\"up-1\",\"model\":\"internal-model\",\"choices\":[]}\n\ndata: {\"id\":\"up-2\",\"model\":\"internal-model\",\"choices\":[]}\n\ndata: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"up-1","model":"internal-model","choices":[]}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		RewriteResponseModel: true,
+		Providers:            []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:               []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1", Model: "internal-model"}}}},
+		Alias:                []config.AliasConfig{{Model: "smart", Target: "gpt-4o"}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"smart"}`)))
+	req.Header.Set("X-Request-ID", "req-1")
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+	if body := rec.Body.String(); body != `{"id":"chatcmpl-req1","model":"smart","choices":[]}` {
+		t.Fatalf("unexpected response %s", body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"smart","stream":true}`)))
+	req.Header.Set("X-Request-ID", "req-2")
+	rec = httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+	body := rec.Body.String()
+	if strings.Contains(body, "internal-model") || strings.Contains(body, "up-") || strings.Count(body, `"id":"chatcmpl-req2","model":"smart"`) != 2 || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Fatalf("unexpected stream %q", body)
+	}
+}
+
+func TestProxyRewritesResponseModelWithSynthesizedUsage(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"up-1","model":"internal-model","choices":[{"message":{"role":"assistant","content":"hello there"}}]}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		RewriteResponseModel: true,
+		SynthesizeUsage:      true,
+		Providers:            []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:               []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1", Model: "internal-model"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)))
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+
+	body := rec.Body.Bytes()
+	if model := gjson.GetBytes(body, "model").String(); model != "gpt-4o" {
+		t.Fatalf("expected the rewritten model, got %s", body)
+	}
+	if usage := gjson.GetBytes(body, "usage"); !usage.Get("prompt_tokens").Exists() || !usage.Get("completion_tokens").Exists() {
+		t.Fatalf("expected the synthesized usage to survive the rewrite, got %s", body)
+	}
+}
@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+var builtinPII = map[string]*regexp.Regexp{
+	config.PIIEmail:      regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	config.PIIPhone:      regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,4}\)|\d{2,4})[\s.-]\d{3,4}[\s.-]?\d{3,4}\b`),
+	config.PIICreditCard: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+	config.PIIAPIKey:     regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_-]{16,}|\bAKIA[0-9A-Z]{16}\b|\bgh[pousr]_[A-Za-z0-9]{36}\b|\bAIza[0-9A-Za-z_-]{35}`),
+}
+
+// builtinPIIOrder applies api keys and card numbers before phone numbers,
+// which would otherwise match parts of them.
+var builtinPIIOrder = []string{config.PIIAPIKey, config.PIIEmail, config.PIICreditCard, config.PIIPhone}
+
+type piiRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+type scrubProfile struct {
+	disabled bool
+	rules    []piiRule
+}
+
+// piiScrubber redacts personal data from request bodies before they are
+// persisted. Matches are replaced with "[REDACTED:<name>]".
+type piiScrubber struct {
+	global scrubProfile
+	// paths holds the per path profiles, longest prefix first.
+	paths    []string
+	profiles map[string]scrubProfile
+}
+
+func newPIIScrubber(cfg *config.PIIScrubbingConfig) *piiScrubber {
+	if cfg == nil {
+		return nil
+	}
+	s := &piiScrubber{profiles: make(map[string]scrubProfile)}
+	s.global.rules = append(builtinRules(cfg.Builtin), customRules(cfg.Patterns)...)
+	for _, path := range cfg.Paths {
+		builtin := cfg.Builtin
+		if len(path.Builtin) > 0 {
+			builtin = path.Builtin
+		}
+		rules := append(builtinRules(builtin), customRules(cfg.Patterns)...)
+		s.profiles[path.Path] = scrubProfile{disabled: path.Disabled, rules: append(rules, customRules(path.Patterns)...)}
+		s.paths = append(s.paths, path.Path)
+	}
+	sort.SliceStable(s.paths, func(i, j int) bool { return len(s.paths[i]) > len(s.paths[j]) })
+	return s
+}
+
+func builtinRules(names []string) []piiRule {
+	rules := make([]piiRule, 0, len(builtinPIIOrder))
+	for _, name := range builtinPIIOrder {
+		if len(names) == 0 || slices.Contains(names, name) {
+			rules = append(rules, piiRule{name: name, pattern: builtinPII[name]})
+		}
+	}
+	return rules
+}
+
+func customRules(patterns []config.PIIPattern) []piiRule {
+	rules := make([]piiRule, 0, len(patterns))
+	for _, pattern := range patterns {
+		// Patterns were validated with the configuration.
+		rules = append(rules, piiRule{name: pattern.Name, pattern: regexp.MustCompile(pattern.Regex)})
+	}
+	return rules
+}
+
+// scrub returns content with the personal data matched for path redacted.
+func (s *piiScrubber) scrub(path, content string) string {
+	if s == nil || content == "" {
+		return content
+	}
+	profile := s.global
+	for _, prefix := range s.paths {
+		if strings.HasPrefix(path, prefix) {
+			profile = s.profiles[prefix]
+			break
+		}
+	}
+	if profile.disabled {
+		return content
+	}
+	for _, rule := range profile.rules {
+		replacement := "[REDACTED:" + rule.name + "]"
+		if rule.name == config.PIICreditCard && rule.pattern == builtinPII[config.PIICreditCard] {
+			content = rule.pattern.ReplaceAllStringFunc(content, func(match string) string {
+				if !luhnValid(match) {
+					return match
+				}
+				return replacement
+			})
+			continue
+		}
+		content = rule.pattern.ReplaceAllLiteralString(content, replacement)
+	}
+	return content
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum, which
+// tells card numbers apart from other long numbers.
+func luhnValid(s string) bool {
+	sum, digits := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
@@ -0,0 +1,47 @@
+package gateway
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestPIIScrubberBuiltinPatterns(t *testing.T) {
+	s := newPIIScrubber(&config.PIIScrubbingConfig{})
+	body := `{"messages":[{"role":"user","content":"mail jane.doe@example.com or call +1 415-555-0123, card 4111 1111 1111 1111, key sk-abcdefghijklmnopqrstuvwx"}],"max_tokens":1024,"seed":1234567890123}`
+
+	got := s.scrub("/v1/chat/completions", body)
+	for _, leaked := range []string{"jane.doe@example.com", "415-555-0123", "4111 1111 1111 1111", "sk-abcdefghijklmnopqrstuvwx"} {
+		if strings.Contains(got, leaked) {
+			t.Fatalf("expected %q to be redacted, got %s", leaked, got)
+		}
+	}
+	for _, kept := range []string{"[REDACTED:email]", "[REDACTED:phone]", "[REDACTED:credit_card]", "[REDACTED:api_key]", `"max_tokens":1024`, `"seed":1234567890123`} {
+		if !strings.Contains(got, kept) {
+			t.Fatalf("expected %q in %s", kept, got)
+		}
+	}
+}
+
+func TestPIIScrubberPaths(t *testing.T) {
+	s := newPIIScrubber(&config.PIIScrubbingConfig{
+		Builtin:  []string{config.PIIEmail},
+		Patterns: []config.PIIPattern{{Name: "employee", Regex: `EMP-\d{6}`}},
+		Paths: []config.PIIPathConfig{
+			{Path: "/v1/embeddings", Disabled: true},
+			{Path: "/v1/messages", Builtin: []string{config.PIIPhone}, Patterns: []config.PIIPattern{{Name: "ticket", Regex: `TICKET-\d+`}}},
+		},
+	})
+	body := "a@b.io EMP-123456 TICKET-42 (415) 555-0123"
+
+	if got := s.scrub("/v1/chat/completions", body); got != "[REDACTED:email] [REDACTED:employee] TICKET-42 (415) 555-0123" {
+		t.Fatalf("unexpected global scrub: %s", got)
+	}
+	if got := s.scrub("/v1/messages", body); got != "a@b.io [REDACTED:employee] [REDACTED:ticket] [REDACTED:phone]" {
+		t.Fatalf("unexpected path scrub: %s", got)
+	}
+	if got := s.scrub("/v1/embeddings", body); got != body {
+		t.Fatalf("expected disabled path to keep the body, got %s", got)
+	}
+}
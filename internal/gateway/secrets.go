@@ -0,0 +1,105 @@
+package gateway
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// builtinSecrets recognise credentials in the raw request body. None of them
+// matches a double quote, so masking keeps the JSON intact. Where the pattern
+// has a group, only the group is the secret.
+var builtinSecrets = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{config.SecretPrivateKey, regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----(?:[^"]*?-----END [A-Z ]*PRIVATE KEY-----|[^"]*)`)},
+	{config.SecretAWSAccessKey, regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA)[0-9A-Z]{16}\b`)},
+	{config.SecretAWSSecretKey, regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key\W{0,6}([A-Za-z0-9/+]{40})`)},
+	{config.SecretGitHubToken, regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{config.SecretSlackToken, regexp.MustCompile(`\bxox[baprs]-[A-Za-z0-9-]{10,}\b`)},
+	{config.SecretBearerToken, regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]{20,}=*)`)},
+}
+
+// errSecretDetected rejects requests carrying credentials in block mode.
+type errSecretDetected struct {
+	secrets []string
+}
+
+func (e *errSecretDetected) Error() string {
+	return "request blocked: it contains credentials (" + strings.Join(e.secrets, ", ") + "); remove them and retry"
+}
+
+// secretScanner finds credentials in outgoing prompts.
+type secretScanner struct {
+	mode  string
+	rules []piiRule
+}
+
+func newSecretScanner(cfg *config.SecretDetectionConfig) *secretScanner {
+	if cfg == nil {
+		return nil
+	}
+	s := &secretScanner{mode: cfg.Mode}
+	for _, secret := range builtinSecrets {
+		if len(cfg.Detectors) == 0 || slices.Contains(cfg.Detectors, secret.name) {
+			s.rules = append(s.rules, piiRule{name: secret.name, pattern: secret.pattern})
+		}
+	}
+	s.rules = append(s.rules, customRules(cfg.Patterns)...)
+	return s
+}
+
+// scan returns the body to forward, the body with the secrets replaced by
+// "[REDACTED:<name>]" for the request log, and the names of the secrets found.
+// Only mask mode forwards the masked body; block mode returns an
+// *errSecretDetected.
+func (s *secretScanner) scan(body []byte) ([]byte, []byte, []string, error) {
+	if s == nil {
+		return body, body, nil, nil
+	}
+	content := string(body)
+	var found []string
+	for _, rule := range s.rules {
+		if !rule.pattern.MatchString(content) {
+			continue
+		}
+		found = append(found, rule.name)
+		content = maskMatches(rule.pattern, content, "[REDACTED:"+rule.name+"]")
+	}
+	if found == nil {
+		return body, body, nil, nil
+	}
+	masked := []byte(content)
+	switch s.mode {
+	case config.SecretBlock:
+		return body, masked, found, &errSecretDetected{secrets: found}
+	case config.SecretMask:
+		return masked, masked, found, nil
+	default:
+		return body, masked, found, nil
+	}
+}
+
+// maskMatches replaces each match of pattern, or its first group when it has
+// one, with replacement.
+func maskMatches(pattern *regexp.Regexp, content, replacement string) string {
+	if pattern.NumSubexp() == 0 {
+		return pattern.ReplaceAllLiteralString(content, replacement)
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range pattern.FindAllStringSubmatchIndex(content, -1) {
+		start, end := loc[2], loc[3]
+		if start < 0 {
+			start, end = loc[0], loc[1]
+		}
+		b.WriteString(content[last:start])
+		b.WriteString(replacement)
+		last = end
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
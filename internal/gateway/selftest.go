@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// SelfTestResult describes the outcome of probing a single provider/model pair.
+type SelfTestResult struct {
+	Model         string        `json:"model"`
+	Provider      string        `json:"provider"`
+	UpstreamModel string        `json:"upstream_model"`
+	Success       bool          `json:"success"`
+	StatusCode    int           `json:"status_code"`
+	Latency       time.Duration `json:"latency"`
+	ReturnedModel string        `json:"returned_model,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// SelfTest sends a minimal completion to every provider/model pair referenced by
+// the configured models, including rule overrides, and reports the results.
+func (g *Gateway) SelfTest(ctx context.Context) []SelfTestResult {
+	type target struct {
+		model    string
+		provider string
+		upstream string
+	}
+
+	var targets []target
+	seen := make(map[string]struct{})
+	add := func(model, provider, upstream string) {
+		if upstream == "" {
+			upstream = model
+		}
+		key := provider + "\x00" + upstream
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		targets = append(targets, target{model: model, provider: provider, upstream: upstream})
+	}
+	for _, m := range g.cfg.Models {
+		for _, p := range m.Providers {
+			add(m.Name, p.ID, p.Model)
+		}
+		for _, r := range m.Rules {
+			for _, p := range r.Providers {
+				add(m.Name, p.Provider, p.Model)
+			}
+		}
+	}
+
+	results := make([]SelfTestResult, 0, len(targets))
+	for _, t := range targets {
+		result := SelfTestResult{Model: t.model, Provider: t.provider, UpstreamModel: t.upstream}
+		provider, ok := g.providers[t.provider]
+		if !ok {
+			result.Error = fmt.Sprintf("provider %s not found", t.provider)
+			results = append(results, result)
+			continue
+		}
+		g.probeProvider(ctx, provider, t.upstream, &result)
+		results = append(results, result)
+	}
+	return results
+}
+
+func (g *Gateway) probeProvider(ctx context.Context, provider config.ProviderConfig, model string, result *SelfTestResult) {
+	path, key := "/chat/completions", config.PathChatCompletions
+	body := fmt.Sprintf(`{"model":%q,"messages":[{"role":"user","content":"ping"}],"max_tokens":1}`, model)
+	if provider.Type == config.ProviderTypeAnthropic {
+		path, key = "/messages", config.PathMessages
+	}
+
+	endpoint, err := providerURL(provider, key, path, model, "")
+	if err != nil {
+		result.Error = fmt.Sprintf("build provider url: %v", err)
+		return
+	}
+
+	if provider.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, provider.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader([]byte(body)))
+	if err != nil {
+		result.Error = fmt.Sprintf("create request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if provider.Type == config.ProviderTypeAnthropic {
+		req.Header.Set("anthropic-version", "2023-06-01")
+	}
+	setProviderAuth(req.Header, provider)
+
+	started := time.Now()
+	resp, err := g.clientFor(provider.ID).Do(req)
+	result.Latency = time.Since(started)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 400 {
+		result.Error = shortenErrorMessage(extractErrorMessage(respBody, resp.Header.Get("Content-Encoding"), resp.StatusCode))
+		return
+	}
+
+	decoded := decodeBodyForAnalysis(respBody, resp.Header.Get("Content-Encoding"))
+	result.ReturnedModel = strings.TrimSpace(gjson.GetBytes(decoded, "model").String())
+	result.Success = true
+}
+
+// setProviderAuth applies the provider credentials and custom headers to an outbound request.
+func setProviderAuth(header http.Header, provider config.ProviderConfig) {
+	if provider.Type == config.ProviderTypeAnthropic {
+		header.Set("x-api-key", provider.AccessToken)
+		header.Del("Authorization")
+	} else {
+		header.Set("Authorization", fmt.Sprintf("Bearer %s", provider.AccessToken))
+		header.Del("x-api-key")
+	}
+	setOpenRouterHeaders(header, provider)
+	for k, v := range provider.Headers {
+		header.Set(k, v)
+	}
+}
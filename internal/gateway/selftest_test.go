@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestSelfTestReportsEachProviderModelPair(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer good" {
+			t.Errorf("unexpected authorization header %q", r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"1","model":"gpt-4o-2024-08-06"}`))
+	}))
+	t.Cleanup(healthy.Close)
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+	}))
+	t.Cleanup(broken.Close)
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "healthy", BaseURL: healthy.URL, AccessToken: "good"},
+			{ID: "broken", BaseURL: broken.URL, AccessToken: "bad"},
+		},
+		Models: []config.ModelConfig{
+			{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "healthy"}, {ID: "broken", Model: "openai/gpt-4o"}}},
+		},
+	}
+
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	results := gw.SelfTest(context.Background())
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if !results[0].Success || results[0].ReturnedModel != "gpt-4o-2024-08-06" {
+		t.Fatalf("unexpected healthy result: %+v", results[0])
+	}
+	if results[1].Success || results[1].StatusCode != http.StatusUnauthorized || results[1].UpstreamModel != "openai/gpt-4o" {
+		t.Fatalf("unexpected broken result: %+v", results[1])
+	}
+}
@@ -0,0 +1,91 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// SessionHeader carries the session a request belongs to, so the requests of
+// a multi-turn conversation or agent run can be costed as a unit. Requests
+// without it may set metadata.session_id in the body instead.
+const SessionHeader = "X-Session-ID"
+
+// maxSessionLength caps the stored session identifier.
+const maxSessionLength = 128
+
+type sessionContextKey struct{}
+
+// withSession marks the request context with its session, so usage records
+// created for it carry the session.
+func withSession(ctx context.Context, session string) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, session)
+}
+
+func sessionFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	session, _ := ctx.Value(sessionContextKey{}).(string)
+	return session
+}
+
+// sessionOf returns the session of a request, from the header or else the
+// metadata.session_id body field.
+func sessionOf(r *http.Request, body []byte) string {
+	session := strings.TrimSpace(r.Header.Get(SessionHeader))
+	if session == "" {
+		session = strings.TrimSpace(gjson.GetBytes(body, "metadata.session_id").String())
+	}
+	if len(session) > maxSessionLength {
+		session = session[:maxSessionLength]
+	}
+	return session
+}
+
+// SessionProviderUsage is the usage of a session served by one provider model.
+type SessionProviderUsage struct {
+	storage.ProviderModelTotals
+	// Cost is nil when the model has no price
+	Cost *float64 `json:"cost,omitempty"`
+}
+
+// SessionUsage aggregates the usage of a session.
+type SessionUsage struct {
+	Session string `json:"session"`
+	storage.UsageTotals
+	// Cost sums the cost of the priced provider models
+	Cost    float64   `json:"cost"`
+	FirstAt time.Time `json:"first_at"`
+	LastAt  time.Time `json:"last_at"`
+	// Providers breaks the usage down by provider and provider model
+	Providers []SessionProviderUsage `json:"providers"`
+}
+
+// SummarizeSession prices the per provider model totals of a session and
+// adds them up.
+func (g *Gateway) SummarizeSession(session string, totals []storage.ProviderModelTotals) SessionUsage {
+	summary := SessionUsage{Session: session, Providers: make([]SessionProviderUsage, 0, len(totals))}
+	for _, t := range totals {
+		entry := SessionProviderUsage{ProviderModelTotals: t}
+		if price, ok := g.priceOf(t.Provider, t.Model); ok {
+			cost := (float64(t.RequestTokens)*price.Input + float64(t.ResponseTokens)*price.Output) / 1e6
+			entry.Cost = &cost
+			summary.Cost += cost
+		}
+		summary.Add(t.UsageTotals)
+		if summary.FirstAt.IsZero() || t.FirstAt.Before(summary.FirstAt) {
+			summary.FirstAt = t.FirstAt
+		}
+		if t.LastAt.After(summary.LastAt) {
+			summary.LastAt = t.LastAt
+		}
+		summary.Providers = append(summary.Providers, entry)
+	}
+	return summary
+}
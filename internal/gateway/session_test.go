@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func TestProxyRecordsSessionUsage(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"c1","usage":{"completion_tokens":100}}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	store, err := storage.New(context.Background(), "sqlite", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "usage.db")))
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close(context.Background()) })
+
+	cfg := &config.Config{
+		SaveUsage: true,
+		Providers: []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:    []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+		Pricing:   &config.PricingConfig{Prices: []config.ProviderPrice{{Model: "gpt-4o", Input: 2, Output: 10}}},
+	}
+	gw, err := New(cfg, store)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	records, unsubscribe := gw.SubscribeUsage()
+	defer unsubscribe()
+
+	send := func(header, body string) storage.UsageRecord {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(body)))
+		if header != "" {
+			req.Header.Set(SessionHeader, header)
+		}
+		gw.Proxy(httptest.NewRecorder(), req, RequestTypeChatCompletions)
+		record := <-records
+		waitForStoredUsage(t, store, record.RequestID)
+		return record
+	}
+	if record := send("run-1", `{"model":"gpt-4o","messages":[]}`); record.Session != "run-1" {
+		t.Fatalf("expected the session of the header, got %q", record.Session)
+	}
+	if record := send("", `{"model":"gpt-4o","messages":[],"metadata":{"session_id":"run-1"}}`); record.Session != "run-1" {
+		t.Fatalf("expected the session of the body, got %q", record.Session)
+	}
+	if record := send("", `{"model":"gpt-4o","messages":[]}`); record.Session != "" {
+		t.Fatalf("expected no session, got %q", record.Session)
+	}
+
+	totals, err := store.(storage.SessionStore).SumSessionUsage(context.Background(), storage.SessionUsageQuery{Session: "run-1"})
+	if err != nil {
+		t.Fatalf("sum session usage: %v", err)
+	}
+	summary := gw.SummarizeSession("run-1", totals)
+	if summary.Requests != 2 || summary.ResponseTokens != 200 || len(summary.Providers) != 1 {
+		t.Fatalf("unexpected session summary %+v", summary)
+	}
+	want := (float64(summary.RequestTokens)*2 + 200*10) / 1e6
+	if summary.Cost != want || summary.Providers[0].Cost == nil || *summary.Providers[0].Cost != want {
+		t.Fatalf("expected a cost of %v, got %v", want, summary.Cost)
+	}
+}
@@ -0,0 +1,218 @@
+package gateway
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/notify"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// sloRecheckInterval limits how often a provider's percentile is recomputed.
+const sloRecheckInterval = 10 * time.Second
+
+// sloTracker checks each provider's latency percentile against its objective
+// over a sliding window of successful requests.
+type sloTracker struct {
+	mu         sync.Mutex
+	objectives map[string]config.SLOConfig
+	providers  map[string]*sloState
+	now        func() time.Time
+}
+
+type sloState struct {
+	samples   []latencySample
+	violating bool
+	checked   time.Time
+	observed  time.Duration
+}
+
+type latencySample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// sloTransition is a provider that started or stopped violating its objective.
+type sloTransition struct {
+	provider  string
+	violating bool
+	observed  time.Duration
+	samples   int
+	objective config.SLOConfig
+}
+
+func newSLOTracker(providers []config.ProviderConfig) *sloTracker {
+	t := &sloTracker{objectives: make(map[string]config.SLOConfig), providers: make(map[string]*sloState), now: time.Now}
+	for _, p := range providers {
+		if p.SLO != nil {
+			t.objectives[p.ID] = *p.SLO
+			t.providers[p.ID] = &sloState{}
+		}
+	}
+	if len(t.objectives) == 0 {
+		return nil
+	}
+	return t
+}
+
+// observe records the latency of a successful request.
+func (t *sloTracker) observe(provider string, latency time.Duration) *sloTransition {
+	if latency <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.providers[provider]
+	if !ok {
+		return nil
+	}
+	st.samples = append(st.samples, latencySample{at: t.now(), latency: latency})
+	return t.checkLocked(provider, st)
+}
+
+// violating reports whether the provider currently misses its objective, and
+// the transition if the answer just changed because old samples expired.
+func (t *sloTracker) violating(provider string) (bool, *sloTransition) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.providers[provider]
+	if !ok || !st.violating {
+		return false, nil
+	}
+	transition := t.checkLocked(provider, st)
+	return st.violating, transition
+}
+
+// checkLocked recomputes the percentile at most once per sloRecheckInterval.
+// Providers with fewer than MinSamples requests in the window are compliant,
+// so a deprioritized provider that no longer gets traffic is eventually retried.
+func (t *sloTracker) checkLocked(provider string, st *sloState) *sloTransition {
+	now := t.now()
+	if now.Sub(st.checked) < sloRecheckInterval {
+		return nil
+	}
+	st.checked = now
+
+	objective := t.objectives[provider]
+	cutoff := now.Add(-time.Duration(objective.WindowSeconds) * time.Second)
+	drop := 0
+	for drop < len(st.samples) && !st.samples[drop].at.After(cutoff) {
+		drop++
+	}
+	st.samples = st.samples[drop:]
+
+	violating := false
+	st.observed = 0
+	if len(st.samples) >= objective.MinSamples {
+		st.observed = percentile(st.samples, objective.Percentile)
+		violating = st.observed > time.Duration(objective.ThresholdMs)*time.Millisecond
+	}
+	if violating == st.violating {
+		return nil
+	}
+	st.violating = violating
+	return &sloTransition{provider: provider, violating: violating, observed: st.observed, samples: len(st.samples), objective: objective}
+}
+
+// percentile returns the nearest-rank percentile of the sample latencies.
+func percentile(samples []latencySample, p float64) time.Duration {
+	values := make([]time.Duration, len(samples))
+	for i, s := range samples {
+		values[i] = s.latency
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	rank := int(math.Ceil(p/100*float64(len(values)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return values[rank]
+}
+
+// observeLatency feeds a finished request into the SLO tracker. It is
+// registered as a metrics sink, so it sees every request whether or not usage
+// is saved.
+func (g *Gateway) observeLatency(record storage.UsageRecord) {
+	if record.Outcome != "success" {
+		return
+	}
+	objective, ok := g.slos.objectives[record.Provider]
+	if !ok {
+		return
+	}
+	latency := record.FirstTokenLatency
+	if objective.Metric == "duration" {
+		latency = record.Duration
+	}
+	if transition := g.slos.observe(record.Provider, latency); transition != nil {
+		g.notifySLO(*transition)
+	}
+}
+
+// orderBySLO moves candidates whose provider violates an SLO with
+// deprioritize enabled behind the others, keeping the relative order. A first
+// candidate that is the sticky provider stays first.
+func (g *Gateway) orderBySLO(candidates []ruleProvider, sticky string) []ruleProvider {
+	if g.slos == nil {
+		return candidates
+	}
+	if sticky != "" && len(candidates) > 0 && candidates[0].id == sticky {
+		return append([]ruleProvider{candidates[0]}, g.orderBySLO(candidates[1:], "")...)
+	}
+	var preferred, demoted []ruleProvider
+	for _, c := range candidates {
+		violating, transition := g.slos.violating(c.id)
+		if transition != nil {
+			g.notifySLO(*transition)
+		}
+		if violating && g.slos.objectives[c.id].Deprioritize {
+			demoted = append(demoted, c)
+			continue
+		}
+		preferred = append(preferred, c)
+	}
+	if len(demoted) == 0 {
+		return candidates
+	}
+	return append(preferred, demoted...)
+}
+
+func (g *Gateway) notifySLO(t sloTransition) {
+	metric := "first token latency"
+	if t.objective.Metric == "duration" {
+		metric = "request duration"
+	}
+	event := notify.Event{
+		Type:     notify.EventSLOViolated,
+		Severity: notify.SeverityWarning,
+		Provider: t.provider,
+		Message: fmt.Sprintf("provider %s p%g %s is %s, objective %dms",
+			t.provider, t.objective.Percentile, metric, t.observed.Round(time.Millisecond), t.objective.ThresholdMs),
+		Details: map[string]any{
+			"metric":         t.objective.Metric,
+			"percentile":     t.objective.Percentile,
+			"observed_ms":    t.observed.Milliseconds(),
+			"threshold_ms":   t.objective.ThresholdMs,
+			"samples":        t.samples,
+			"window_seconds": t.objective.WindowSeconds,
+			"deprioritized":  t.objective.Deprioritize,
+		},
+	}
+	if !t.violating {
+		event.Type = notify.EventSLORecovered
+		event.Severity = notify.SeverityInfo
+		event.Message = fmt.Sprintf("provider %s meets its p%g %s objective of %dms again", t.provider, t.objective.Percentile, metric, t.objective.ThresholdMs)
+		event.Details["deprioritized"] = false
+		log.Infof("%s", event.Message)
+	} else {
+		log.Warningf("%s", event.Message)
+	}
+	g.notifier.Publish(event)
+}
@@ -0,0 +1,72 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestSLOTrackerDetectsViolationAndDeprioritizes(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "slow", BaseURL: "http://slow", AccessToken: "x", SLO: &config.SLOConfig{
+				Metric: "first_token", Percentile: 90, ThresholdMs: 1000, WindowSeconds: 60, MinSamples: 10, Deprioritize: true,
+			}},
+			{ID: "fast", BaseURL: "http://fast", AccessToken: "x"},
+		},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	gw.slos.now = func() time.Time { return now }
+
+	// Eight fast and two slow requests: p90 is still within the objective.
+	for i := 0; i < 10; i++ {
+		latency := 200 * time.Millisecond
+		if i >= 8 {
+			latency = 3 * time.Second
+		}
+		if transition := gw.slos.observe("slow", latency); transition != nil {
+			t.Fatalf("unexpected transition %+v", transition)
+		}
+	}
+	now = now.Add(sloRecheckInterval)
+	transition := gw.slos.observe("slow", 3*time.Second)
+	if transition == nil || !transition.violating || transition.observed != 3*time.Second {
+		t.Fatalf("expected a violation, got %+v", transition)
+	}
+
+	candidates := []ruleProvider{{id: "slow"}, {id: "fast", model: "m"}}
+	ordered := gw.orderBySLO(candidates, "")
+	if ordered[0].id != "fast" || ordered[1].id != "slow" {
+		t.Fatalf("expected slow provider to be deprioritized, got %+v", ordered)
+	}
+	if candidates[0].id != "slow" {
+		t.Fatal("candidates must not be reordered in place")
+	}
+
+	// Once the samples expire the provider is compliant again.
+	now = now.Add(2 * time.Minute)
+	violating, transition := gw.slos.violating("slow")
+	if violating || transition == nil || transition.violating {
+		t.Fatalf("expected recovery after the window, got %v %+v", violating, transition)
+	}
+	if ordered := gw.orderBySLO(candidates, ""); ordered[0].id != "slow" {
+		t.Fatalf("expected original order after recovery, got %+v", ordered)
+	}
+}
+
+func TestPercentileNearestRank(t *testing.T) {
+	var samples []latencySample
+	for i := 1; i <= 20; i++ {
+		samples = append(samples, latencySample{latency: time.Duration(i) * time.Millisecond})
+	}
+	for p, want := range map[float64]time.Duration{50: 10 * time.Millisecond, 95: 19 * time.Millisecond, 100: 20 * time.Millisecond} {
+		if got := percentile(samples, p); got != want {
+			t.Errorf("p%g: expected %s, got %s", p, want, got)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package gateway
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// statsdWriteTimeout bounds a write to a full unix socket buffer, the only
+// case where sending a datagram can block.
+const statsdWriteTimeout = 50 * time.Millisecond
+
+// statsdSink sends the metrics of each usage record as one datagram to a
+// statsd or DogStatsD agent. Metrics that cannot be sent are dropped.
+type statsdSink struct {
+	cfg config.StatsDConfig
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newStatsDSink(cfg config.StatsDConfig) *statsdSink {
+	if cfg.Format == "" {
+		cfg.Format = config.StatsDFormatDogStatsD
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "gateway."
+	}
+	return &statsdSink{cfg: cfg}
+}
+
+func (s *statsdSink) observe(record storage.UsageRecord) {
+	packet := s.packet(record)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The agent is dialed on first use and again after a failed write, so an
+	// agent that starts after the gateway or restarts is picked up.
+	if s.conn == nil {
+		network, address := "udp", s.cfg.Address
+		if path, ok := strings.CutPrefix(address, "unix://"); ok {
+			network, address = "unixgram", path
+		}
+		conn, err := net.DialTimeout(network, address, time.Second)
+		if err != nil {
+			log.Warningf("dial statsd %s: %v", s.cfg.Address, err)
+			return
+		}
+		s.conn = conn
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(statsdWriteTimeout))
+	if _, err := s.conn.Write(packet); err != nil {
+		log.Debugf("send statsd metrics: %v", err)
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// packet returns the metrics of a record, one per line: the request and retry
+// counts, the token counts and the request and first token latencies.
+func (s *statsdSink) packet(record storage.UsageRecord) []byte {
+	var b bytes.Buffer
+	write := func(name, value, kind string) {
+		b.WriteString(s.metricName(name, record))
+		b.WriteString(":" + value + "|" + kind)
+		if s.cfg.Format == config.StatsDFormatDogStatsD {
+			b.WriteString(s.tags(record))
+		}
+		b.WriteByte('\n')
+	}
+	write("requests", "1", "c")
+	if record.Attempt > 1 {
+		write("retries", "1", "c")
+	}
+	write("tokens.input", strconv.Itoa(record.RequestTokens), "c")
+	write("tokens.output", strconv.Itoa(record.ResponseTokens), "c")
+	write("request.duration", strconv.FormatInt(record.Duration.Milliseconds(), 10), "ms")
+	if record.FirstTokenLatency > 0 {
+		write("first_token", strconv.FormatInt(record.FirstTokenLatency.Milliseconds(), 10), "ms")
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+}
+
+// metricName is the prefixed name of a metric. Plain statsd has no tags, so
+// the provider, model and outcome become segments of the name.
+func (s *statsdSink) metricName(name string, record storage.UsageRecord) string {
+	if s.cfg.Format == config.StatsDFormatDogStatsD {
+		return s.cfg.Prefix + name
+	}
+	provider := record.Provider
+	if provider == "" {
+		provider = "none"
+	}
+	return s.cfg.Prefix + name + "." + statsdSegment(provider) + "." + statsdSegment(exportedModel(record)) + "." + statsdSegment(record.Outcome)
+}
+
+func (s *statsdSink) tags(record storage.UsageRecord) string {
+	tags := append([]string{}, s.cfg.Tags...)
+	if record.Provider != "" {
+		tags = append(tags, "provider:"+statsdTagValue(record.Provider))
+	}
+	tags = append(tags, "model:"+statsdTagValue(exportedModel(record)), "outcome:"+statsdTagValue(record.Outcome))
+	return "|#" + strings.Join(tags, ",")
+}
+
+var (
+	statsdSegmentReplacer  = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "#", "_", "/", "_", " ", "_", "\n", "_")
+	statsdTagValueReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", " ", "_", "\n", "_")
+)
+
+func statsdSegment(value string) string {
+	return statsdSegmentReplacer.Replace(value)
+}
+
+func statsdTagValue(value string) string {
+	return statsdTagValueReplacer.Replace(value)
+}
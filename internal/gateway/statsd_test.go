@@ -0,0 +1,60 @@
+package gateway
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func TestStatsDSinkSendsDogStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+
+	sink := newStatsDSink(config.StatsDConfig{Address: conn.LocalAddr().String(), Tags: []string{"env:test"}})
+	sink.observe(storage.UsageRecord{
+		Provider:          "openai",
+		Model:             "gpt-4o-2024",
+		OriginalModel:     "gpt-4o",
+		Outcome:           "success",
+		Attempt:           2,
+		RequestTokens:     12,
+		ResponseTokens:    3,
+		Duration:          1500 * time.Millisecond,
+		FirstTokenLatency: 200 * time.Millisecond,
+	})
+
+	buf := make([]byte, 2048)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	tags := "|#env:test,provider:openai,model:gpt-4o,outcome:success"
+	want := "gateway.requests:1|c" + tags + "\n" +
+		"gateway.retries:1|c" + tags + "\n" +
+		"gateway.tokens.input:12|c" + tags + "\n" +
+		"gateway.tokens.output:3|c" + tags + "\n" +
+		"gateway.request.duration:1500|ms" + tags + "\n" +
+		"gateway.first_token:200|ms" + tags
+	if got := string(buf[:n]); got != want {
+		t.Fatalf("unexpected packet:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestStatsDSinkPlainNames(t *testing.T) {
+	sink := newStatsDSink(config.StatsDConfig{Address: "127.0.0.1:8125", Format: config.StatsDFormatStatsD, Prefix: "llm."})
+	got := string(sink.packet(storage.UsageRecord{Model: "meta/llama-3.1", Outcome: "blocked", Attempt: 1}))
+	want := "llm.requests.none.meta_llama-3_1.blocked:1|c\n" +
+		"llm.tokens.input.none.meta_llama-3_1.blocked:0|c\n" +
+		"llm.tokens.output.none.meta_llama-3_1.blocked:0|c\n" +
+		"llm.request.duration.none.meta_llama-3_1.blocked:0|ms"
+	if got != want {
+		t.Fatalf("unexpected packet:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// stickyKey returns the key that pins the requests of a model with sticky
+// routing to one provider: the configured header, or else the end user of the
+// request body. It is empty when the model is not sticky or the request
+// carries no key.
+func stickyKey(route *modelRoute, header http.Header, body []byte, reqType RequestType) string {
+	if route == nil || route.config.Sticky == nil {
+		return ""
+	}
+	if name := route.config.Sticky.Header; name != "" {
+		if key := strings.TrimSpace(header.Get(name)); key != "" {
+			return key
+		}
+	}
+	if reqType == RequestTypeAnthropicMessages {
+		return gjson.GetBytes(body, "metadata.user_id").String()
+	}
+	return gjson.GetBytes(body, "user").String()
+}
+
+// stickyHead returns the provider stickTo pinned the key to, or "" without a
+// key.
+func stickyHead(key string, candidates []ruleProvider) string {
+	if key == "" || len(candidates) == 0 {
+		return ""
+	}
+	return candidates[0].id
+}
+
+// stickTo moves the provider the key hashes to first, the others keeping their
+// order for failover. Providers are picked by rendezvous hashing, so when one
+// drops out of the candidates only its keys move to other providers.
+func stickTo(key string, candidates []ruleProvider) []ruleProvider {
+	if key == "" || len(candidates) < 2 {
+		return candidates
+	}
+	best, bestScore := 0, uint64(0)
+	for i, c := range candidates {
+		sum := sha256.Sum256([]byte(c.id + "\x00" + key))
+		if score := binary.BigEndian.Uint64(sum[:8]); i == 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	ordered := make([]ruleProvider, 0, len(candidates))
+	ordered = append(ordered, candidates[best])
+	ordered = append(ordered, candidates[:best]...)
+	return append(ordered, candidates[best+1:]...)
+}
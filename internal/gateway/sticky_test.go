@@ -0,0 +1,120 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestStickToIsConsistent(t *testing.T) {
+	all := []ruleProvider{{id: "p1"}, {id: "p2"}, {id: "p3"}}
+	withoutP2 := []ruleProvider{{id: "p1"}, {id: "p3"}}
+
+	firsts := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		ordered := stickTo(key, all)
+		if len(ordered) != 3 {
+			t.Fatalf("expected every provider for failover, got %v", ordered)
+		}
+		if again := stickTo(key, all); again[0] != ordered[0] {
+			t.Fatalf("key %s moved from %s to %s", key, ordered[0].id, again[0].id)
+		}
+		firsts[ordered[0].id]++
+		if ordered[0].id != "p2" && stickTo(key, withoutP2)[0] != ordered[0] {
+			t.Fatalf("key %s moved although its provider is still a candidate", key)
+		}
+	}
+	for _, p := range all {
+		if firsts[p.id] < 50 {
+			t.Fatalf("expected keys spread over the providers, got %v", firsts)
+		}
+	}
+	if got := stickTo("", all); got[0].id != "p1" {
+		t.Fatalf("requests without a key must keep their order, got %v", got)
+	}
+}
+
+func TestStickyRoutingKeys(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "p1", BaseURL: "http://p1", AccessToken: "t"},
+			{ID: "p2", BaseURL: "http://p2", AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{
+			{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}, {ID: "p2"}}, Sticky: &config.StickyConfig{Header: "X-Conversation"}},
+			{Name: "gpt-4o-mini", Providers: []config.ModelProvider{{ID: "p1"}, {ID: "p2"}}},
+		},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	header := http.Header{}
+	header.Set("X-Conversation", "conv-1")
+	route := gw.models["gpt-4o"]
+	if key := stickyKey(route, header, []byte(`{"user":"alice"}`), RequestTypeChatCompletions); key != "conv-1" {
+		t.Fatalf("expected the header to win, got %q", key)
+	}
+	if key := stickyKey(route, nil, []byte(`{"user":"alice"}`), RequestTypeChatCompletions); key != "alice" {
+		t.Fatalf("expected the user field, got %q", key)
+	}
+	if key := stickyKey(route, nil, []byte(`{"metadata":{"user_id":"bob"}}`), RequestTypeAnthropicMessages); key != "bob" {
+		t.Fatalf("expected the messages user id, got %q", key)
+	}
+	if key := stickyKey(gw.models["gpt-4o-mini"], header, []byte(`{"user":"alice"}`), RequestTypeChatCompletions); key != "" {
+		t.Fatalf("models without sticky routing must not have a key, got %q", key)
+	}
+
+	for _, user := range []string{"alice", "bob", "carol", "dave"} {
+		body := []byte(fmt.Sprintf(`{"model":"gpt-4o","user":%q,"messages":[]}`, user))
+		plan, err := gw.DryRun(body, RequestTypeChatCompletions, "/v1/chat/completions")
+		if err != nil {
+			t.Fatalf("dry run: %v", err)
+		}
+		if want := stickTo(user, []ruleProvider{{id: "p1"}, {id: "p2"}})[0].id; plan.Providers[0].Provider != want {
+			t.Fatalf("expected %s first for %s, got %v", want, user, plan.Providers)
+		}
+	}
+}
+
+func TestStickyRoutingIgnoresFallbacksAndSLOOrder(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "p1", BaseURL: "http://p1", AccessToken: "t", SLO: &config.SLOConfig{
+				Metric: "first_token", Percentile: 50, ThresholdMs: 100, WindowSeconds: 60, MinSamples: 1, Deprioritize: true,
+			}},
+			{ID: "p2", BaseURL: "http://p2", AccessToken: "t", SLO: &config.SLOConfig{
+				Metric: "first_token", Percentile: 50, ThresholdMs: 100, WindowSeconds: 60, MinSamples: 1, Deprioritize: true,
+			}},
+			{ID: "or", Type: config.ProviderTypeOpenRouter, BaseURL: "http://or", AccessToken: "t", OpenRouter: &config.OpenRouterConfig{Fallback: true}},
+		},
+		Models: []config.ModelConfig{
+			{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}, {ID: "p2"}}, Sticky: &config.StickyConfig{}},
+		},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	// Both providers miss their objective, so the SLO order would otherwise
+	// move the sticky provider behind the fallback.
+	gw.slos.observe("p1", time.Second)
+	gw.slos.observe("p2", time.Second)
+
+	for i := 0; i < 20; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		plan, err := gw.DryRun([]byte(fmt.Sprintf(`{"model":"gpt-4o","user":%q,"messages":[]}`, user)), RequestTypeChatCompletions, "/v1/chat/completions")
+		if err != nil {
+			t.Fatalf("dry run: %v", err)
+		}
+		want := stickTo(user, []ruleProvider{{id: "p1"}, {id: "p2"}})[0].id
+		if len(plan.Providers) != 3 || plan.Providers[0].Provider != want {
+			t.Fatalf("expected %s first for %s, got %v", want, user, plan.Providers)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// errSlowClient marks a stream the gateway ended because its client did not
+// read it fast enough.
+var errSlowClient = errors.New("client too slow")
+
+// streamCopy configures how a streaming response is copied to the client.
+type streamCopy struct {
+	// keepalive writes keepalivePing while the source is silent for that
+	// long; 0 disables pings, which only suit uncompressed event streams
+	keepalive time.Duration
+	// writeTimeout bounds every write to the client; 0 disables it
+	writeTimeout time.Duration
+	// bufferBytes is how much data read from the source may wait for the
+	// client; 0 reads the source only as fast as the client takes it
+	bufferBytes int
+}
+
+// copyStream copies a streaming response to the client, flushing every chunk.
+// The source is read ahead of the client into a buffer of at most
+// opts.bufferBytes, so a slow client does not hold up the provider. When the
+// buffer overflows or a write takes longer than opts.writeTimeout, the copy
+// ends with errSlowClient and the client's write deadline is left expired, so
+// the server drops the connection. Pings are only sent between events so they
+// never split one. The data read from the source, without pings, is also
+// written to capture, including the data the client did not get.
+func copyStream(w http.ResponseWriter, src io.Reader, capture io.Writer, opts streamCopy) (err error) {
+	rc := http.NewResponseController(w)
+	queue := newStreamQueue(opts.bufferBytes)
+	defer queue.close()
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := src.Read(buf)
+			if !queue.push(buf[:n], err) {
+				if queue.overflowed() {
+					// Unblocks a write the client is not accepting.
+					_ = rc.SetWriteDeadline(time.Now())
+				}
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	if opts.writeTimeout > 0 {
+		defer func() {
+			if !errors.Is(err, errSlowClient) {
+				_ = rc.SetWriteDeadline(time.Time{})
+			}
+		}()
+	}
+	write := func(p []byte) error {
+		if opts.writeTimeout > 0 {
+			_ = rc.SetWriteDeadline(time.Now().Add(opts.writeTimeout))
+		}
+		_, err := w.Write(p)
+		if err == nil {
+			if err = rc.Flush(); errors.Is(err, http.ErrNotSupported) {
+				err = nil
+			}
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if queue.overflowed() {
+				return fmt.Errorf("%w: more than %d bytes waiting to be sent", errSlowClient, opts.bufferBytes)
+			}
+			return fmt.Errorf("%w: write not accepted within %s", errSlowClient, opts.writeTimeout)
+		}
+		return err
+	}
+
+	var tick <-chan time.Time
+	var timer *time.Timer
+	if opts.keepalive > 0 {
+		timer = time.NewTimer(opts.keepalive)
+		defer timer.Stop()
+		tick = timer.C
+	}
+	// tail holds the last bytes copied, enough to tell whether they end an event.
+	var tail []byte
+	atBoundary := true
+	for {
+		select {
+		case <-queue.ready:
+			chunks, overflow, srcErr := queue.take()
+			var writeErr error
+			for _, chunk := range chunks {
+				if writeErr == nil && !overflow {
+					writeErr = write(chunk)
+				}
+				// Data the client no longer gets still counts towards usage.
+				_, _ = capture.Write(chunk)
+				tail = append(tail, chunk...)
+				tail = tail[max(0, len(tail)-4):]
+			}
+			if writeErr != nil {
+				return writeErr
+			}
+			if overflow {
+				return fmt.Errorf("%w: more than %d bytes waiting to be sent", errSlowClient, opts.bufferBytes)
+			}
+			if len(chunks) > 0 {
+				atBoundary = endsEvent(tail)
+			}
+			if srcErr == io.EOF {
+				return nil
+			}
+			if srcErr != nil {
+				return srcErr
+			}
+		case <-tick:
+			if atBoundary {
+				if err := write(keepalivePing); err != nil {
+					return err
+				}
+			}
+		}
+		if timer != nil {
+			timer.Reset(opts.keepalive)
+		}
+	}
+}
+
+// streamQueue hands data from the goroutine reading the source to the one
+// writing to the client.
+type streamQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	chunks [][]byte
+	size   int
+	// err ends the source after the queued chunks
+	err      error
+	overflow bool
+	closed   bool
+	// ready is signalled when chunks, err or overflow change
+	ready chan struct{}
+}
+
+func newStreamQueue(limit int) *streamQueue {
+	q := &streamQueue{limit: limit, ready: make(chan struct{}, 1)}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues the data and error of a source read. Without a limit it waits
+// until the writer took the data. It returns false when the source must not
+// be read any more: the queue overflowed or the writer is gone.
+func (q *streamQueue) push(p []byte, err error) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	if len(p) > 0 {
+		q.chunks = append(q.chunks, append([]byte(nil), p...))
+		q.size += len(p)
+	}
+	q.err = err
+	if q.limit > 0 && q.size > q.limit {
+		q.overflow = true
+	}
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	if q.overflow {
+		return false
+	}
+	for q.limit == 0 && q.size > 0 && !q.closed {
+		q.cond.Wait()
+	}
+	return !q.closed
+}
+
+// take returns the queued chunks, whether the queue overflowed and the
+// source error.
+func (q *streamQueue) take() ([][]byte, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	chunks := q.chunks
+	q.chunks, q.size = nil, 0
+	q.cond.Broadcast()
+	return chunks, q.overflow, q.err
+}
+
+func (q *streamQueue) overflowed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.overflow
+}
+
+// close releases a source reader waiting for the writer.
+func (q *streamQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
@@ -0,0 +1,149 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// stalledWriter passes the first accepted writes through, then blocks every write
+// until its write deadline passes, like a client that stopped reading.
+type stalledWriter struct {
+	*httptest.ResponseRecorder
+	mu       sync.Mutex
+	accepted int
+	deadline time.Time
+}
+
+func (w *stalledWriter) SetWriteDeadline(deadline time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.deadline = deadline
+	return nil
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	if w.accepted > 0 {
+		w.accepted--
+		w.mu.Unlock()
+		return w.ResponseRecorder.Write(p)
+	}
+	w.mu.Unlock()
+	for {
+		w.mu.Lock()
+		deadline := w.deadline
+		w.mu.Unlock()
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCopyStreamBuffersAheadOfClient(t *testing.T) {
+	data := strings.Repeat("data: x\n\n", 10000)
+	rec := httptest.NewRecorder()
+	var capture bytes.Buffer
+	if err := copyStream(rec, strings.NewReader(data), &capture, streamCopy{writeTimeout: time.Second, bufferBytes: 1 << 20}); err != nil {
+		t.Fatalf("copy stream: %v", err)
+	}
+	if rec.Body.String() != data || capture.String() != data {
+		t.Fatalf("stream was not copied intact")
+	}
+}
+
+func TestCopyStreamEndsOnWriteTimeout(t *testing.T) {
+	w := &stalledWriter{ResponseRecorder: httptest.NewRecorder()}
+	var capture bytes.Buffer
+	err := copyStream(w, strings.NewReader("data: a\n\n"), &capture, streamCopy{writeTimeout: 20 * time.Millisecond})
+	if !errors.Is(err, errSlowClient) || !strings.Contains(err.Error(), "write not accepted within 20ms") {
+		t.Fatalf("expected slow client error, got %v", err)
+	}
+	if capture.String() != "data: a\n\n" {
+		t.Fatalf("unsent data must still be captured, got %q", capture.String())
+	}
+}
+
+func TestCopyStreamEndsWhenBufferOverflows(t *testing.T) {
+	w := &stalledWriter{ResponseRecorder: httptest.NewRecorder()}
+	var capture bytes.Buffer
+	src := strings.NewReader(strings.Repeat("x", 256*1024))
+	err := copyStream(w, src, &capture, streamCopy{bufferBytes: 64 * 1024})
+	if !errors.Is(err, errSlowClient) || !strings.Contains(err.Error(), "more than 65536 bytes waiting") {
+		t.Fatalf("expected buffer overflow, got %v", err)
+	}
+	if src.Len() == 0 {
+		t.Fatalf("source must not be read past the buffer")
+	}
+}
+
+func TestProxyRecordsSlowClient(t *testing.T) {
+	upstreamClosed := make(chan struct{})
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"delta\":{\"content\":\"hi\"}}],\"usage\":{\"completion_tokens\":7}}\n\n"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte(strings.Repeat("data: {\"choices\":[]}\n\n", 10000)))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(upstreamClosed)
+	}))
+	t.Cleanup(provider.Close)
+
+	store, err := storage.New(context.Background(), "sqlite", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "usage.db")))
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close(context.Background()) })
+
+	cfg := &config.Config{
+		SaveUsage:         true,
+		StreamBufferBytes: 16 * 1024,
+		Providers:         []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:            []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, store)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	records, unsubscribe := gw.SubscribeUsage()
+	defer unsubscribe()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o","stream":true}`)))
+	w := &stalledWriter{ResponseRecorder: httptest.NewRecorder(), accepted: 1}
+	gw.Proxy(w, req, RequestTypeChatCompletions)
+
+	select {
+	case <-upstreamClosed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("upstream request was not released")
+	}
+	select {
+	case record := <-records:
+		if record.Outcome != storage.OutcomeSlowClient || record.ResponseTokens != 7 || !strings.Contains(record.Error, "client too slow") {
+			t.Fatalf("unexpected usage record %+v", record)
+		}
+		waitForStoredUsage(t, store, record.RequestID)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no usage record was published")
+	}
+	gw.health.mu.Lock()
+	failures := gw.health.state("p1").failures
+	gw.health.mu.Unlock()
+	if failures != 0 {
+		t.Fatalf("a slow client must not count as a provider failure, got %d", failures)
+	}
+}
@@ -0,0 +1,61 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// streamInterruptedMessage is sent to clients whose upstream stream broke.
+// The cause stays in the logs and usage record so routing details are not
+// exposed.
+const streamInterruptedMessage = "the upstream stream was interrupted before the response completed"
+
+// writeStreamError ends a broken event stream with an error event in the
+// format of the inbound protocol followed by its terminal event, so client
+// SDKs fail instead of waiting for more data. sent is the data forwarded so
+// far; the error starts a new event even when it ended mid-event.
+func writeStreamError(w http.ResponseWriter, reqType RequestType, sent []byte) error {
+	var events []byte
+	if len(sent) > 0 && !endsEvent(sent) {
+		events = append(events, "\n\n"...)
+	}
+	switch reqType {
+	case RequestTypeAnthropicMessages:
+		events = appendEvent(events, "error", map[string]any{
+			"type":  "error",
+			"error": map[string]string{"type": "api_error", "message": streamInterruptedMessage},
+		})
+		events = appendEvent(events, "message_stop", map[string]string{"type": "message_stop"})
+	case RequestTypeResponses:
+		events = appendEvent(events, "error", map[string]any{
+			"type":    "error",
+			"code":    "stream_interrupted",
+			"message": streamInterruptedMessage,
+			"param":   nil,
+		})
+	default:
+		events = appendEvent(events, "", map[string]any{
+			"error": map[string]any{
+				"message": streamInterruptedMessage,
+				"type":    "server_error",
+				"code":    "stream_interrupted",
+				"param":   nil,
+			},
+		})
+		events = append(events, "data: [DONE]\n\n"...)
+	}
+	if _, err := w.Write(events); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+func appendEvent(dst []byte, name string, payload any) []byte {
+	data, _ := json.Marshal(payload)
+	if name != "" {
+		dst = append(dst, "event: "+name+"\n"...)
+	}
+	dst = append(dst, "data: "...)
+	dst = append(dst, data...)
+	return append(dst, "\n\n"...)
+}
@@ -0,0 +1,74 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestWriteStreamError(t *testing.T) {
+	for _, tc := range []struct {
+		reqType RequestType
+		sent    string
+		want    string
+	}{
+		{
+			RequestTypeChatCompletions,
+			"data: {\"choices\":[]}\n\n",
+			"data: {\"error\":{\"code\":\"stream_interrupted\",\"message\":\"" + streamInterruptedMessage + "\",\"param\":null,\"type\":\"server_error\"}}\n\ndata: [DONE]\n\n",
+		},
+		{
+			RequestTypeResponses,
+			"",
+			"event: error\ndata: {\"code\":\"stream_interrupted\",\"message\":\"" + streamInterruptedMessage + "\",\"param\":null,\"type\":\"error\"}\n\n",
+		},
+		{
+			RequestTypeAnthropicMessages,
+			"event: content_block_delta\ndata: {\"type\":",
+			"\n\nevent: error\ndata: {\"error\":{\"message\":\"" + streamInterruptedMessage + "\",\"type\":\"api_error\"},\"type\":\"error\"}\n\nevent: message_stop\ndata: {\"type\":\"message_stop\"}\n\n",
+		},
+	} {
+		rec := httptest.NewRecorder()
+		if err := writeStreamError(rec, tc.reqType, []byte(tc.sent)); err != nil {
+			t.Fatalf("%v: write: %v", tc.reqType, err)
+		}
+		if rec.Body.String() != tc.want {
+			t.Fatalf("%v: unexpected events %q", tc.reqType, rec.Body.String())
+		}
+	}
+}
+
+func TestProxyEndsBrokenStreamWithError(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"id\":\"c1\",\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:    []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o","stream":true}`)))
+	rec := httptest.NewRecorder()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, "data: {\"id\":\"c1\"") || !strings.Contains(body, `"code":"stream_interrupted"`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Fatalf("unexpected stream %q", body)
+	}
+}
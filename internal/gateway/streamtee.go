@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"bytes"
+	"sync"
+)
+
+// responseAnalysis is what the usage accounting takes from a response body.
+type responseAnalysis struct {
+	// body is the response decoded from its content encoding
+	body              []byte
+	providerRequestID string
+	completionTokens  int
+}
+
+func analyzeResponse(model string, reqType RequestType, data []byte, encoding string, stream bool) responseAnalysis {
+	decoded := decodeBodyForAnalysis(data, encoding)
+	providerReqID, completion := extractResponseMetadata(model, reqType, decoded, stream)
+	return responseAnalysis{body: decoded, providerRequestID: providerReqID, completionTokens: completion}
+}
+
+// streamTee collects the chunks of a streaming response for usage and metadata
+// analysis. Chunks are queued for a background goroutine that also counts the
+// tokens once the stream ends, so the client write path only copies them. The
+// queue is unbounded: a slow analyzer never holds up the stream, and no part of
+// the response is left out of the accounting. The analyzer keeps the whole
+// response anyway, so the queue adds at most that much memory.
+type streamTee struct {
+	mu      sync.Mutex
+	pending [][]byte
+	closed  bool
+	// wake tells the analyzer that chunks are pending or the tee was closed
+	wake     chan struct{}
+	done     chan struct{}
+	data     bytes.Buffer
+	analysis responseAnalysis
+
+	model    string
+	reqType  RequestType
+	encoding string
+}
+
+func newStreamTee(model string, reqType RequestType, encoding string) *streamTee {
+	t := &streamTee{
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		model:    model,
+		reqType:  reqType,
+		encoding: encoding,
+	}
+	go t.collect()
+	return t
+}
+
+func (t *streamTee) collect() {
+	defer close(t.done)
+	for closed := false; !closed; {
+		<-t.wake
+		t.mu.Lock()
+		chunks := t.pending
+		t.pending, closed = nil, t.closed
+		t.mu.Unlock()
+		for _, chunk := range chunks {
+			t.data.Write(chunk)
+		}
+	}
+	t.analysis = analyzeResponse(t.model, t.reqType, t.data.Bytes(), t.encoding, true)
+}
+
+func (t *streamTee) notify() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Write queues a copy of p for the analyzer without waiting for it; it never
+// fails.
+func (t *streamTee) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	chunk := append([]byte(nil), p...)
+	t.mu.Lock()
+	t.pending = append(t.pending, chunk)
+	t.mu.Unlock()
+	t.notify()
+	return len(p), nil
+}
+
+// Close waits for the analyzer and returns the collected data with its
+// analysis. The tee must not be written afterwards.
+func (t *streamTee) Close() ([]byte, responseAnalysis) {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	t.notify()
+	<-t.done
+	return t.data.Bytes(), t.analysis
+}
@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreamTeeCollectsChunks(t *testing.T) {
+	tee := newStreamTee("m", RequestTypeChatCompletions, "")
+	buf := []byte("data: a\n\n")
+	for i := 0; i < 3; i++ {
+		if n, err := tee.Write(buf); n != len(buf) || err != nil {
+			t.Fatalf("write: %d, %v", n, err)
+		}
+		// The tee must copy: writers reuse their buffers.
+		buf[6]++
+	}
+	data, _ := tee.Close()
+	if string(data) != "data: a\n\ndata: b\n\ndata: c\n\n" {
+		t.Fatalf("unexpected collected data %q", data)
+	}
+}
+
+func TestStreamTeeAnalyzesTheStream(t *testing.T) {
+	tee := newStreamTee("m", RequestTypeChatCompletions, "")
+	_, _ = tee.Write([]byte(`data: {"id":"chatcmpl-1","choices":[{"delta":{"content":"hi"}}]}` + "\n\n"))
+	_, _ = tee.Write([]byte(`data: {"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":7}}` + "\n\ndata: [DONE]\n\n"))
+
+	_, analysis := tee.Close()
+	if analysis.providerRequestID != "chatcmpl-1" || analysis.completionTokens != 7 {
+		t.Fatalf("unexpected analysis %q, %d tokens", analysis.providerRequestID, analysis.completionTokens)
+	}
+}
+
+func TestStreamTeeWritesDoNotWaitForAStalledAnalyzer(t *testing.T) {
+	// The analyzer is not started until every write returned.
+	tee := &streamTee{wake: make(chan struct{}, 1), done: make(chan struct{}), reqType: RequestTypeChatCompletions}
+	const chunks = 10000
+
+	written := make(chan struct{})
+	go func() {
+		for i := 0; i < chunks; i++ {
+			_, _ = tee.Write([]byte("data: a\n\n"))
+		}
+		close(written)
+	}()
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writes must not wait for a stalled analyzer")
+	}
+	go tee.collect()
+
+	data, _ := tee.Close()
+	if want := chunks * len("data: a\n\n"); len(data) != want {
+		t.Fatalf("expected every chunk to be analyzed, got %d of %d bytes", len(data), want)
+	}
+}
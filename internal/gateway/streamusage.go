@@ -0,0 +1,162 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+type streamUsageContextKey struct{}
+
+// withStreamUsage marks a chat completion stream whose client asked for a
+// usage chunk with stream_options.include_usage.
+func withStreamUsage(ctx context.Context) context.Context {
+	return context.WithValue(ctx, streamUsageContextKey{}, true)
+}
+
+func streamUsageRequested(ctx context.Context) bool {
+	requested, _ := ctx.Value(streamUsageContextKey{}).(bool)
+	return requested
+}
+
+// wantsStreamUsage reports whether a usage chunk should be synthesized for the
+// request when its provider does not send one.
+func (g *Gateway) wantsStreamUsage(reqType RequestType, body []byte) bool {
+	return g.cfg.SynthesizeStreamUsage &&
+		reqType == RequestTypeChatCompletions &&
+		gjson.GetBytes(body, "stream").Bool() &&
+		gjson.GetBytes(body, "stream_options.include_usage").Bool()
+}
+
+// streamUsageWriter passes a chat completion event stream through while
+// holding back its "data: [DONE]" event, so a usage chunk can be written
+// before it when the provider sent none.
+type streamUsageWriter struct {
+	http.ResponseWriter
+	events   eventSplitter
+	done     []byte
+	sawUsage bool
+	id       string
+	model    string
+	created  int64
+}
+
+func newStreamUsageWriter(w http.ResponseWriter) *streamUsageWriter {
+	return &streamUsageWriter{ResponseWriter: w}
+}
+
+func (w *streamUsageWriter) Write(p []byte) (int, error) {
+	if err := w.events.split(p, w.passEvent); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *streamUsageWriter) passEvent(event []byte) error {
+	data := eventData(event)
+	if data == "[DONE]" {
+		w.done = append([]byte(nil), event...)
+		return nil
+	}
+	if data != "" && gjson.Valid(data) {
+		chunk := gjson.Parse(data)
+		if chunk.Get("usage").IsObject() {
+			w.sawUsage = true
+		}
+		if w.id == "" {
+			w.id = chunk.Get("id").String()
+			w.model = chunk.Get("model").String()
+			w.created = chunk.Get("created").Int()
+		}
+	}
+	_, err := w.ResponseWriter.Write(event)
+	return err
+}
+
+// finish writes the usage chunk unless the provider sent one, followed by the
+// held back data.
+func (w *streamUsageWriter) finish(promptTokens, completionTokens int) error {
+	if !w.sawUsage {
+		chunk, err := json.Marshal(map[string]any{
+			"id":      w.id,
+			"object":  "chat.completion.chunk",
+			"created": w.created,
+			"model":   w.model,
+			"choices": []any{},
+			"usage": map[string]int{
+				"prompt_tokens":     promptTokens,
+				"completion_tokens": completionTokens,
+				"total_tokens":      promptTokens + completionTokens,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := w.ResponseWriter.Write([]byte("data: " + string(chunk) + "\n\n")); err != nil {
+			return err
+		}
+	}
+	if _, err := w.ResponseWriter.Write(append(w.done, w.events.pending...)); err != nil {
+		return err
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *streamUsageWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *streamUsageWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// eventSplitter buffers the data of an event stream until events complete.
+type eventSplitter struct {
+	// pending is the incomplete event at the end of the data split so far
+	pending []byte
+}
+
+// split hands every event completed by p to emit.
+func (s *eventSplitter) split(p []byte, emit func(event []byte) error) error {
+	s.pending = append(s.pending, p...)
+	for {
+		end := eventEnd(s.pending)
+		if end < 0 {
+			return nil
+		}
+		if err := emit(s.pending[:end]); err != nil {
+			return err
+		}
+		s.pending = s.pending[end:]
+	}
+}
+
+// eventEnd returns the length of the first complete event in data, or -1.
+func eventEnd(data []byte) int {
+	lf := bytes.Index(data, []byte("\n\n"))
+	crlf := bytes.Index(data, []byte("\r\n\r\n"))
+	switch {
+	case crlf >= 0 && (lf < 0 || crlf < lf):
+		return crlf + 4
+	case lf >= 0:
+		return lf + 2
+	default:
+		return -1
+	}
+}
+
+// eventData joins the data lines of an event.
+func eventData(event []byte) string {
+	var data []string
+	for _, line := range strings.Split(string(event), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimSpace(value))
+		}
+	}
+	return strings.Join(data, "\n")
+}
@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestStreamUsageWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := newStreamUsageWriter(rec)
+	for _, part := range []string{
+		"data: {\"id\":\"c1\",\"created\":7,\"model\":\"gpt-4o\",\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n",
+		"data: [DO",
+		"NE]\n\n",
+	} {
+		if _, err := w.Write([]byte(part)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if strings.Contains(rec.Body.String(), "[DONE]") {
+		t.Fatalf("[DONE] must be held back until finish, got %q", rec.Body.String())
+	}
+	if err := w.finish(5, 2); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+
+	events := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n\n"), "\n\n")
+	if len(events) != 3 || events[2] != "data: [DONE]" {
+		t.Fatalf("unexpected events %q", events)
+	}
+	usage := gjson.Parse(strings.TrimPrefix(events[1], "data: "))
+	if usage.Get("id").String() != "c1" || usage.Get("model").String() != "gpt-4o" || usage.Get("created").Int() != 7 ||
+		usage.Get("usage.prompt_tokens").Int() != 5 || usage.Get("usage.completion_tokens").Int() != 2 || usage.Get("usage.total_tokens").Int() != 7 {
+		t.Fatalf("unexpected usage chunk %s", events[1])
+	}
+}
+
+func TestStreamUsageWriterKeepsProviderUsage(t *testing.T) {
+	stream := "data: {\"id\":\"c1\",\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":4}}\n\ndata: [DONE]\n\n"
+	rec := httptest.NewRecorder()
+	w := newStreamUsageWriter(rec)
+	if _, err := w.Write([]byte(stream)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.finish(5, 2); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	if rec.Body.String() != stream {
+		t.Fatalf("stream with usage must pass unchanged, got %q", rec.Body.String())
+	}
+}
+
+func TestProxySynthesizesStreamUsage(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"id\":\"c1\",\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n"))
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		SynthesizeStreamUsage: true,
+		Providers:             []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:                []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	for _, tc := range []struct {
+		body      string
+		wantUsage bool
+	}{
+		{`{"model":"gpt-4o","stream":true,"stream_options":{"include_usage":true}}`, true},
+		{`{"model":"gpt-4o","stream":true}`, false},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(tc.body)))
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+
+		body := rec.Body.String()
+		if got := strings.Contains(body, `"usage":`); got != tc.wantUsage {
+			t.Fatalf("body %s: usage chunk present = %v, want %v: %q", tc.body, got, tc.wantUsage, body)
+		}
+		if !strings.HasSuffix(body, "data: [DONE]\n\n") {
+			t.Fatalf("stream must end with [DONE], got %q", body)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+)
+
+func TestProxyAppliesTenantModelVisibilityAndOverrides(t *testing.T) {
+	sharedCalls := 0
+	shared := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sharedCalls++
+		_, _ = w.Write([]byte(`{"id":"shared"}`))
+	}))
+	t.Cleanup(shared.Close)
+
+	dedicatedCalls := 0
+	dedicated := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dedicatedCalls++
+		_, _ = w.Write([]byte(`{"id":"dedicated"}`))
+	}))
+	t.Cleanup(dedicated.Close)
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "shared", BaseURL: shared.URL, AccessToken: "token1"},
+			{ID: "dedicated", BaseURL: dedicated.URL, AccessToken: "token2"},
+		},
+		Models: []config.ModelConfig{
+			{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "shared"}}},
+			{Name: "o1", Providers: []config.ModelProvider{{ID: "shared"}}},
+		},
+		Tenants: []config.TenantConfig{
+			{
+				ID:        "team-a",
+				APIKeys:   []string{"sk-team-a"},
+				Models:    []string{"gpt-4o"},
+				Overrides: []config.TenantModelOverride{{Model: "gpt-4o", Providers: config.ModelProviders{{ID: "dedicated"}}}},
+			},
+		},
+	}
+
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	send := func(model string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"`+model+`"}`)))
+		req = req.WithContext(internalmw.WithIdentity(req.Context(), internalmw.Identity{Key: "sk-team-a", Tenant: "team-a"}))
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+		return rec
+	}
+
+	if rec := send("o1"); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for hidden model, got %d", rec.Code)
+	}
+	if rec := send("gpt-4o"); rec.Code != http.StatusOK || rec.Body.String() != `{"id":"dedicated"}` {
+		t.Fatalf("unexpected response: %d %s", rec.Code, rec.Body.String())
+	}
+	if sharedCalls != 0 || dedicatedCalls != 1 {
+		t.Fatalf("expected only the dedicated provider to be called, shared=%d dedicated=%d", sharedCalls, dedicatedCalls)
+	}
+
+	ctx := internalmw.WithIdentity(context.Background(), internalmw.Identity{Key: "sk-team-a", Tenant: "team-a"})
+	models := gw.ModelList(ctx).Data
+	if len(models) != 1 || models[0].ID != "gpt-4o" {
+		t.Fatalf("expected tenant to see only gpt-4o, got %+v", models)
+	}
+	if all := gw.ModelList(context.Background()).Data; len(all) != 2 {
+		t.Fatalf("expected global key to see all models, got %+v", all)
+	}
+}
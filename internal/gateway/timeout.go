@@ -0,0 +1,60 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// timeoutHeader overrides the provider timeout of a single request, in seconds.
+const timeoutHeader = "X-Gateway-Timeout"
+
+type requestTimeoutContextKey struct{}
+
+func withRequestTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, requestTimeoutContextKey{}, timeout)
+}
+
+func requestTimeoutFrom(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(requestTimeoutContextKey{}).(time.Duration)
+	return timeout, ok
+}
+
+// requestTimeout returns the timeout of the x-gateway-timeout header of a
+// request, capped at max_request_timeout_seconds, or 0 without the header.
+// The header is an error when the gateway does not accept it, so clients do
+// not rely on a timeout that is not applied.
+func (g *Gateway) requestTimeout(r *http.Request) (time.Duration, error) {
+	header := strings.TrimSpace(r.Header.Get(timeoutHeader))
+	if header == "" {
+		return 0, nil
+	}
+	if g.cfg.MaxRequestTimeoutSeconds <= 0 {
+		return 0, fmt.Errorf("x-gateway-timeout is not enabled on this gateway")
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) || seconds <= 0 {
+		return 0, fmt.Errorf("invalid x-gateway-timeout %s, expected a positive number of seconds", header)
+	}
+	seconds = math.Min(seconds, float64(g.cfg.MaxRequestTimeoutSeconds))
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid x-gateway-timeout %s, expected a positive number of seconds", header)
+	}
+	return timeout, nil
+}
+
+// providerTimeout is the timeout of a call to provider: the request's
+// x-gateway-timeout when set, else the provider's timeout.
+func providerTimeout(ctx context.Context, provider config.ProviderConfig) time.Duration {
+	if timeout, ok := requestTimeoutFrom(ctx); ok {
+		return timeout
+	}
+	return provider.Timeout
+}
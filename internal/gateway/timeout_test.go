@@ -0,0 +1,83 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	g := &Gateway{cfg: &config.Config{MaxRequestTimeoutSeconds: 60}}
+	cases := []struct {
+		header  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, false},
+		{"0.5", 500 * time.Millisecond, false},
+		{"3600", 60 * time.Second, false},
+		{"0", 0, true},
+		{"soon", 0, true},
+		{"NaN", 0, true},
+		{"+Inf", 0, true},
+		{"1e-12", 0, true},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		if c.header != "" {
+			req.Header.Set(timeoutHeader, c.header)
+		}
+		got, err := g.requestTimeout(req)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("header %q: got %v, %v; want %v, error %v", c.header, got, err, c.want, c.wantErr)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set(timeoutHeader, "5")
+	if _, err := (&Gateway{cfg: &config.Config{}}).requestTimeout(req); err == nil {
+		t.Fatal("the header must be rejected when max_request_timeout_seconds is not set")
+	}
+}
+
+func TestProxyAppliesRequestTimeout(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(timeoutHeader) != "" {
+			t.Errorf("x-gateway-timeout must not be forwarded")
+		}
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"c1"}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	cfg := &config.Config{
+		MaxRequestTimeoutSeconds: 60,
+		Providers:                []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t", Timeout: time.Minute}},
+		Models:                   []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o"}`)))
+	req.Header.Set(timeoutHeader, "0.1")
+	rec := httptest.NewRecorder()
+	started := time.Now()
+	gw.Proxy(rec, req, RequestTypeChatCompletions)
+
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("request took %v, the header timeout was not applied", elapsed)
+	}
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("timed out request must fail, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
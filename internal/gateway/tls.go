@@ -0,0 +1,37 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// newProviderClients creates a dedicated client for each provider with a
+// min_tls_version, so its policy does not weaken or tighten the connections to
+// the other providers.
+func newProviderClients(providers []config.ProviderConfig, base *http.Client) (map[string]*http.Client, error) {
+	clients := make(map[string]*http.Client)
+	for _, p := range providers {
+		minVersion, err := config.ParseTLSVersion(p.MinTLSVersion)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: %w", p.ID, err)
+		}
+		if minVersion == 0 {
+			continue
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{MinVersion: minVersion}
+		clients[p.ID] = &http.Client{Timeout: base.Timeout, Transport: transport}
+	}
+	return clients, nil
+}
+
+// clientFor returns the HTTP client for requests to the provider.
+func (g *Gateway) clientFor(providerID string) *http.Client {
+	if client, ok := g.providerClients[providerID]; ok {
+		return client
+	}
+	return g.httpClient
+}
@@ -0,0 +1,54 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestProviderMinTLSVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	base := &http.Client{}
+	clients, err := newProviderClients([]config.ProviderConfig{
+		{ID: "legacy", MinTLSVersion: "1.2"},
+		{ID: "strict", MinTLSVersion: "1.3"},
+		{ID: "default"},
+	}, base)
+	if err != nil {
+		t.Fatalf("create clients: %v", err)
+	}
+	gw := &Gateway{httpClient: base, providerClients: clients}
+	if gw.clientFor("default") != base {
+		t.Fatalf("expected providers without min_tls_version to share the default client")
+	}
+
+	trusted := server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	get := func(provider string) error {
+		client := gw.clientFor(provider)
+		client.Transport.(*http.Transport).TLSClientConfig.RootCAs = trusted
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	if err := get("legacy"); err != nil {
+		t.Fatalf("expected TLS 1.2 to be accepted, got %v", err)
+	}
+	if err := get("strict"); err == nil {
+		t.Fatalf("expected a TLS 1.2 server to be rejected by a provider requiring TLS 1.3")
+	}
+
+	if _, err := newProviderClients([]config.ProviderConfig{{ID: "bad", MinTLSVersion: "1.0"}}, base); err == nil {
+		t.Fatalf("expected unsupported TLS versions to be rejected")
+	}
+}
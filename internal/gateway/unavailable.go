@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+	"github.com/tidwall/gjson"
+)
+
+// unavailableModels remembers the provider models that reported they do not
+// exist, so later requests skip them until the TTL passes.
+type unavailableModels struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	until map[ruleProvider]time.Time
+	now   func() time.Time
+}
+
+func newUnavailableModels(ttl time.Duration) *unavailableModels {
+	return &unavailableModels{ttl: ttl, until: make(map[ruleProvider]time.Time), now: time.Now}
+}
+
+func (u *unavailableModels) mark(provider, model string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.until[ruleProvider{id: provider, model: model}] = u.now().Add(u.ttl)
+}
+
+func (u *unavailableModels) unavailable(provider, model string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := ruleProvider{id: provider, model: model}
+	until, ok := u.until[key]
+	if !ok {
+		return false
+	}
+	if !u.now().Before(until) {
+		delete(u.until, key)
+		return false
+	}
+	return true
+}
+
+// skipUnavailable drops candidates whose model is known to be missing at the
+// provider. If that would leave nothing, all candidates are kept and tried.
+func (g *Gateway) skipUnavailable(modelName string, candidates []ruleProvider) []ruleProvider {
+	var kept []ruleProvider
+	for _, c := range candidates {
+		if g.unavailable.unavailable(c.id, g.targetModelOf(c, modelName)) {
+			log.Debugf("[%s] skip provider %s(%s): model not found recently", modelName, c.id, c.model)
+			continue
+		}
+		kept = append(kept, c)
+	}
+	if len(kept) == 0 {
+		return candidates
+	}
+	return kept
+}
+
+// markIfModelNotFound records the provider model as unavailable when err is a
+// model-not-found response.
+func (g *Gateway) markIfModelNotFound(provider, model string, err error) {
+	var retryErr *retryableError
+	if !errors.As(err, &retryErr) || !retryErr.modelNotFound() {
+		return
+	}
+	log.Warningf("provider %s does not serve model %s, skipping it for %s", provider, model, g.unavailable.ttl)
+	g.unavailable.mark(provider, model)
+}
+
+// modelNotFound reports whether the provider answered that the model does not exist.
+func (e *retryableError) modelNotFound() bool {
+	return isModelNotFound(e.status, decodeBodyForAnalysis(e.body, e.header.Get("Content-Encoding")))
+}
+
+// isModelNotFound recognizes the model-not-found errors of OpenAI compatible
+// and Anthropic APIs: a model_not_found code or type, or a 404 about the model.
+// Other 400 errors mentioning the model usually reject a parameter for it and
+// do not mean the provider lacks the model.
+func isModelNotFound(status int, body []byte) bool {
+	if status != 400 && status != 404 {
+		return false
+	}
+	for _, path := range []string{"error.code", "error.type", "code"} {
+		if gjson.GetBytes(body, path).String() == "model_not_found" {
+			return true
+		}
+	}
+	message := strings.ToLower(gjson.GetBytes(body, "error.message").String())
+	if message == "" {
+		message = strings.ToLower(string(body))
+	}
+	return status == 404 && strings.Contains(message, "model")
+}
@@ -0,0 +1,83 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestIsModelNotFound(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+		want   bool
+	}{
+		{404, `{"error":{"message":"The model gpt-5 does not exist or you do not have access to it.","code":"model_not_found"}}`, true},
+		{404, `{"type":"error","error":{"type":"not_found_error","message":"model: claude-9"}}`, true},
+		{400, `{"error":{"message":"Unknown model: foo","code":"model_not_found"}}`, true},
+		{400, `{"error":{"message":"Unknown model: foo"}}`, false},
+		{400, `{"error":{"message":"temperature is not supported with this model"}}`, false},
+		{400, `{"error":{"message":"max_tokens is too large"}}`, false},
+		{429, `{"error":{"code":"model_not_found"}}`, false},
+		{404, `not found`, false},
+	}
+	for _, c := range cases {
+		if got := isModelNotFound(c.status, []byte(c.body)); got != c.want {
+			t.Errorf("isModelNotFound(%d, %s) = %v, want %v", c.status, c.body, got, c.want)
+		}
+	}
+}
+
+func TestProxySkipsModelNotFoundUntilTTL(t *testing.T) {
+	hits := map[string]int{}
+	missing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits["missing"]++
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"message":"model not found","code":"model_not_found"}}`))
+	}))
+	defer missing.Close()
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits["ok"]++
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	}))
+	defer ok.Close()
+
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "missing", BaseURL: missing.URL, AccessToken: "token"},
+			{ID: "ok", BaseURL: ok.URL, AccessToken: "token"},
+		},
+		Models:                     []config.ModelConfig{{Name: "m", Providers: []config.ModelProvider{{ID: "missing"}, {ID: "ok"}}}},
+		ModelUnavailableTTLSeconds: 600,
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	gw.unavailable.now = func() time.Time { return now }
+
+	send := func() {
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"m"}`))), RequestTypeChatCompletions)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	send()
+	send()
+	if hits["missing"] != 1 || hits["ok"] != 2 {
+		t.Fatalf("expected the missing model to be skipped after the first failure, got %v", hits)
+	}
+
+	now = now.Add(11 * time.Minute)
+	send()
+	if hits["missing"] != 2 {
+		t.Fatalf("expected the provider to be retried after the ttl, got %v", hits)
+	}
+}
@@ -4,19 +4,23 @@ import (
 	"context"
 	"time"
 
-	"github.com/mylxsw/asteria/log"
 	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
 
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
 	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
 )
 
-func (g *Gateway) prepareUsageRecord(providerID, providerModel, originalModel, path, requestID string, tokenCount, statusCode, attempt int) *storage.UsageRecord {
-	if g.usageStore == nil || !g.cfg.SaveUsage {
+func (g *Gateway) prepareUsageRecord(ctx context.Context, providerID, providerModel, originalModel, path, requestID string, tokenCount, statusCode, attempt int) *storage.UsageRecord {
+	// Records are also built without save_usage to be sent to the exporters,
+	// the metrics sinks and the completion callback.
+	if (g.usageStore == nil || !g.cfg.SaveUsage) && len(g.exporters) == 0 && len(g.metricSinks) == 0 && requestCompletionFrom(ctx) == nil {
 		return nil
 	}
 	if attempt <= 0 {
 		attempt = 1
 	}
+	identity, _ := internalmw.IdentityFromContext(ctx)
 	return &storage.UsageRecord{
 		CreatedAt:     time.Now(),
 		Provider:      providerID,
@@ -26,15 +30,33 @@ func (g *Gateway) prepareUsageRecord(providerID, providerModel, originalModel, p
 		RequestTokens: tokenCount,
 		StatusCode:    statusCode,
 		RequestID:     requestID,
+		Tenant:        identity.Tenant,
+		Route:         routeFromContext(ctx),
+		Moderation:    moderationFromContext(ctx),
+		Session:       sessionFromContext(ctx),
+		KeyID:         keyIDOf(identity),
+		KeyName:       identity.Name,
 		Attempt:       attempt,
 	}
 }
 
 func (g *Gateway) saveUsageRecord(ctx context.Context, record storage.UsageRecord) {
+	g.exportTrace(ctx, record)
+	for _, sink := range g.metricSinks {
+		sink.observe(record)
+	}
+	if completion := requestCompletionFrom(ctx); completion != nil {
+		completion.observe(record, g.requestCost(record))
+	}
 	if g.usageStore == nil || !g.cfg.SaveUsage {
 		return
 	}
 
+	for _, crossing := range g.budgets.record(record, g.budgetScopesFor(g.tenant(record.Tenant), record.KeyID)) {
+		go g.notifyBudgetThreshold(crossing)
+	}
+	g.feed.publish(record)
+
 	go func(rec storage.UsageRecord) {
 		base := context.Background()
 		if ctx != nil {
@@ -43,7 +65,7 @@ func (g *Gateway) saveUsageRecord(ctx context.Context, record storage.UsageRecor
 		ctxWithTimeout, cancel := context.WithTimeout(base, 5*time.Second)
 		defer cancel()
 		if err := g.usageStore.RecordUsage(ctxWithTimeout, rec); err != nil {
-			log.Warningf("save usage record: %v", err)
+			internalmw.Logger(ctx).Warningf("save usage record: %v", err)
 		}
 	}(record)
 }
@@ -66,3 +88,39 @@ func extractUsageTokens(body []byte) (int, int) {
 
 	return prompt, completion
 }
+
+// withSynthesizedUsage adds a usage object to a non-stream response that has
+// none, in the field names of the request type, so clients reading usage get
+// the tokens the gateway counted.
+func withSynthesizedUsage(reqType RequestType, body []byte, promptTokens, completionTokens int) []byte {
+	if !gjson.ValidBytes(body) || !gjson.ParseBytes(body).IsObject() || gjson.GetBytes(body, "usage").Exists() {
+		return body
+	}
+	var usage map[string]int
+	switch reqType {
+	case RequestTypeChatCompletions:
+		usage = map[string]int{
+			"prompt_tokens":     promptTokens,
+			"completion_tokens": completionTokens,
+			"total_tokens":      promptTokens + completionTokens,
+		}
+	case RequestTypeResponses:
+		usage = map[string]int{
+			"input_tokens":  promptTokens,
+			"output_tokens": completionTokens,
+			"total_tokens":  promptTokens + completionTokens,
+		}
+	case RequestTypeAnthropicMessages:
+		usage = map[string]int{
+			"input_tokens":  promptTokens,
+			"output_tokens": completionTokens,
+		}
+	default:
+		return body
+	}
+	out, err := sjson.SetBytes(body, "usage", usage)
+	if err != nil {
+		return body
+	}
+	return out
+}
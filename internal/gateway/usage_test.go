@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+func TestWithSynthesizedUsage(t *testing.T) {
+	cases := []struct {
+		reqType RequestType
+		body    string
+		want    map[string]int64
+	}{
+		{RequestTypeChatCompletions, `{"id":"c1"}`, map[string]int64{"prompt_tokens": 5, "completion_tokens": 2, "total_tokens": 7}},
+		{RequestTypeResponses, `{"id":"r1"}`, map[string]int64{"input_tokens": 5, "output_tokens": 2, "total_tokens": 7}},
+		{RequestTypeAnthropicMessages, `{"id":"m1"}`, map[string]int64{"input_tokens": 5, "output_tokens": 2}},
+	}
+	for _, c := range cases {
+		usage := gjson.GetBytes(withSynthesizedUsage(c.reqType, []byte(c.body), 5, 2), "usage")
+		for field, want := range c.want {
+			if got := usage.Get(field).Int(); got != want {
+				t.Errorf("%v usage %s = %d, want %d", c.reqType, field, got, want)
+			}
+		}
+	}
+
+	for _, body := range []string{`{"id":"c1","usage":{"prompt_tokens":3}}`, `not json`, `[1]`} {
+		if got := withSynthesizedUsage(RequestTypeChatCompletions, []byte(body), 5, 2); string(got) != body {
+			t.Errorf("body %s must be unchanged, got %s", body, got)
+		}
+	}
+}
+
+func TestProxySynthesizesUsage(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"c1","choices":[{"message":{"role":"assistant","content":"hello there"}}]}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	for _, enabled := range []bool{true, false} {
+		cfg := &config.Config{
+			SynthesizeUsage: enabled,
+			Providers:       []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+			Models:          []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+		}
+		gw, err := New(cfg, nil)
+		if err != nil {
+			t.Fatalf("create gateway: %v", err)
+		}
+		body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(body)))
+		rec := httptest.NewRecorder()
+		gw.Proxy(rec, req, RequestTypeChatCompletions)
+
+		usage := gjson.Get(rec.Body.String(), "usage")
+		if usage.Exists() != enabled {
+			t.Fatalf("synthesize_usage %v: usage present = %v in %s", enabled, usage.Exists(), rec.Body.String())
+		}
+		if enabled && (!usage.Get("prompt_tokens").Exists() || !usage.Get("completion_tokens").Exists() ||
+			usage.Get("total_tokens").Int() != usage.Get("prompt_tokens").Int()+usage.Get("completion_tokens").Int()) {
+			t.Fatalf("unexpected usage %s", usage.Raw)
+		}
+	}
+}
+
+func TestProxyRecordsAPIKeyOfRequest(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	store, err := storage.New(context.Background(), "sqlite", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "usage.db")))
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close(context.Background()) })
+
+	cfg := &config.Config{
+		SaveUsage: true,
+		Providers: []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "t"}},
+		Models:    []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+	}
+	gw, err := New(cfg, store)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"gpt-4o"}`)))
+	req = req.WithContext(internalmw.WithIdentity(req.Context(), internalmw.Identity{Key: "sk-secret", Name: "batch-jobs"}))
+	gw.Proxy(httptest.NewRecorder(), req, RequestTypeChatCompletions)
+
+	var records []storage.UsageRecord
+	for deadline := time.Now().Add(5 * time.Second); len(records) == 0 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		records, _ = store.QueryUsage(context.Background(), storage.UsageQuery{KeyID: keyDigest("sk-secret")})
+	}
+	if len(records) != 1 || records[0].KeyName != "batch-jobs" || records[0].KeyID == "sk-secret" {
+		t.Fatalf("expected the record to carry the key digest and name, got %+v", records)
+	}
+}
@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/tidwall/sjson"
+
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+)
+
+const (
+	upstreamUserIDTenant = "tenant"
+	upstreamUserIDKey    = "key"
+)
+
+// upstreamUserID returns the identifier reported to providers for the caller, or
+// an empty string when injection is disabled or the caller is anonymous.
+func (g *Gateway) upstreamUserID(ctx context.Context) string {
+	mode := g.cfg.UpstreamUserID
+	if mode == "" {
+		return ""
+	}
+	identity, ok := internalmw.IdentityFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if mode == upstreamUserIDTenant && identity.Tenant != "" {
+		return identity.Tenant
+	}
+	if identity.Key == "" {
+		return identity.Tenant
+	}
+	// Providers only ever see a digest of the key, never the key itself.
+	id := keyDigest(identity.Key)
+	if identity.Tenant != "" {
+		id = identity.Tenant + ":" + id
+	}
+	return id
+}
+
+// keyIDOf returns the digest usage records identify the key of the caller by,
+// or an empty string for anonymous callers.
+func keyIDOf(identity internalmw.Identity) string {
+	if identity.Key == "" {
+		return ""
+	}
+	return keyDigest(identity.Key)
+}
+
+// keyDigest identifies an API key without revealing it.
+func keyDigest(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key-" + hex.EncodeToString(sum[:])[:16]
+}
+
+// injectUserID sets the end-user field of the request body so that provider-side
+// abuse tracking maps back to individual gateway consumers.
+func injectUserID(body []byte, reqType RequestType, userID string) ([]byte, error) {
+	if userID == "" {
+		return body, nil
+	}
+	if reqType == RequestTypeAnthropicMessages {
+		return sjson.SetBytes(body, "metadata.user_id", userID)
+	}
+	return sjson.SetBytes(body, "user", userID)
+}
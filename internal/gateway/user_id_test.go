@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+)
+
+func TestProxyInjectsUpstreamUserID(t *testing.T) {
+	var received []byte
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	cases := []struct {
+		name     string
+		mode     string
+		reqType  RequestType
+		path     string
+		identity internalmw.Identity
+		field    string
+		check    func(string) bool
+	}{
+		{"tenant", "tenant", RequestTypeChatCompletions, "/v1/chat/completions", internalmw.Identity{Key: "sk-a", Tenant: "team-a"}, "user", func(v string) bool { return v == "team-a" }},
+		{"key", "key", RequestTypeResponses, "/v1/responses", internalmw.Identity{Key: "sk-a", Tenant: "team-a"}, "user", func(v string) bool {
+			return strings.HasPrefix(v, "team-a:key-") && !strings.Contains(v, "sk-a")
+		}},
+		{"tenant without tenant falls back to key", "tenant", RequestTypeChatCompletions, "/v1/chat/completions", internalmw.Identity{Key: "sk-global"}, "user", func(v string) bool {
+			return strings.HasPrefix(v, "key-")
+		}},
+		{"anthropic", "tenant", RequestTypeAnthropicMessages, "/v1/messages", internalmw.Identity{Key: "sk-a", Tenant: "team-a"}, "metadata.user_id", func(v string) bool { return v == "team-a" }},
+		{"disabled", "", RequestTypeChatCompletions, "/v1/chat/completions", internalmw.Identity{Key: "sk-a", Tenant: "team-a"}, "user", func(v string) bool { return v == "" }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{
+				UpstreamUserID: tc.mode,
+				Providers:      []config.ProviderConfig{{ID: "p1", BaseURL: provider.URL, AccessToken: "token"}},
+				Models:         []config.ModelConfig{{Name: "gpt-4o", Providers: []config.ModelProvider{{ID: "p1"}}}},
+			}
+			gw, err := New(cfg, nil)
+			if err != nil {
+				t.Fatalf("create gateway: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, tc.path, bytes.NewReader([]byte(`{"model":"gpt-4o","user":""}`)))
+			req = req.WithContext(internalmw.WithIdentity(req.Context(), tc.identity))
+			rec := httptest.NewRecorder()
+			gw.Proxy(rec, req, tc.reqType)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if got := gjson.GetBytes(received, tc.field).String(); !tc.check(got) {
+				t.Fatalf("unexpected %s %q in upstream body %s", tc.field, got, received)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// WarmupResult is the outcome of warming up a provider.
+type WarmupResult struct {
+	Mode       string        `json:"mode"`
+	At         time.Time     `json:"at"`
+	Success    bool          `json:"success"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Latency    time.Duration `json:"latency"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// ProviderStatus is the runtime state of a provider reported by the admin API.
+type ProviderStatus struct {
+	ID                  string              `json:"id"`
+	Type                config.ProviderType `json:"type"`
+	Healthy             bool                `json:"healthy"`
+	ConsecutiveFailures int                 `json:"consecutive_failures"`
+	// Evicted reports that the provider is out of rotation until a probe passes
+	Evicted bool          `json:"evicted,omitempty"`
+	Warmup  *WarmupResult `json:"warmup,omitempty"`
+	// HealthCheck is the last active health check of the provider
+	HealthCheck *HealthCheckStatus `json:"health_check,omitempty"`
+}
+
+type warmupResults struct {
+	mu      sync.Mutex
+	results map[string]WarmupResult
+}
+
+func (w *warmupResults) set(provider string, result WarmupResult) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.results == nil {
+		w.results = make(map[string]WarmupResult)
+	}
+	w.results[provider] = result
+}
+
+func (w *warmupResults) get(provider string) (WarmupResult, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	result, ok := w.results[provider]
+	return result, ok
+}
+
+// Warmup sends a warm-up request to every provider in parallel, so the
+// connections of the first user requests are already established, and logs
+// the results. It returns when every provider answered or timed out.
+func (g *Gateway) Warmup(ctx context.Context) {
+	if g.cfg.Warmup == nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, provider := range g.cfg.Providers {
+		wg.Add(1)
+		go func(provider config.ProviderConfig) {
+			defer wg.Done()
+			result := g.warmupProvider(ctx, provider)
+			g.warmups.set(provider.ID, result)
+			if result.Success {
+				log.Infof("warm-up of provider %s succeeded in %s", provider.ID, result.Latency.Round(time.Millisecond))
+			} else {
+				log.Warningf("warm-up of provider %s failed after %s: %s", provider.ID, result.Latency.Round(time.Millisecond), result.Error)
+			}
+		}(provider)
+	}
+	wg.Wait()
+}
+
+func (g *Gateway) warmupProvider(ctx context.Context, provider config.ProviderConfig) WarmupResult {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(g.cfg.Warmup.TimeoutSeconds)*time.Second)
+	defer cancel()
+	return g.pingProvider(ctx, provider, g.cfg.Warmup.Mode)
+}
+
+// pingProvider sends a one token completion to the provider in request mode
+// and requests its models endpoint in connect mode, where any answer counts
+// as a success.
+func (g *Gateway) pingProvider(ctx context.Context, provider config.ProviderConfig, mode string) WarmupResult {
+	result := WarmupResult{Mode: mode, At: time.Now()}
+	if mode == config.WarmupRequest {
+		model := g.warmupModel(provider.ID)
+		if model == "" {
+			result.Error = "no model is configured for the provider"
+			return result
+		}
+		probe := SelfTestResult{}
+		g.probeProvider(ctx, provider, model, &probe)
+		result.Success, result.StatusCode, result.Latency, result.Error = probe.Success, probe.StatusCode, probe.Latency, probe.Error
+		return result
+	}
+
+	// Any answer establishes the connection, so error statuses count as warm.
+	endpoint, err := providerURL(provider, config.PathModels, "/models", "", "")
+	if err != nil {
+		result.Error = fmt.Sprintf("build provider url: %v", err)
+		return result
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		result.Error = fmt.Sprintf("create request: %v", err)
+		return result
+	}
+	if provider.Type == config.ProviderTypeAnthropic {
+		req.Header.Set("anthropic-version", "2023-06-01")
+	}
+	setProviderAuth(req.Header, provider)
+
+	resp, err := g.clientFor(provider.ID).Do(req)
+	result.Latency = time.Since(result.At)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	// Reading the body returns the connection to the pool.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	result.StatusCode = resp.StatusCode
+	result.Success = true
+	return result
+}
+
+// warmupModel returns the provider model of the first configured model the
+// provider serves.
+func (g *Gateway) warmupModel(providerID string) string {
+	for _, m := range g.cfg.Models {
+		for _, p := range m.Providers {
+			if p.ID != providerID {
+				continue
+			}
+			if p.Model != "" {
+				return p.Model
+			}
+			return m.Name
+		}
+	}
+	return ""
+}
+
+// ProviderStatuses returns the health and warm-up result of every provider,
+// sorted by id.
+func (g *Gateway) ProviderStatuses() []ProviderStatus {
+	statuses := make([]ProviderStatus, 0, len(g.cfg.Providers))
+	for _, provider := range g.cfg.Providers {
+		failures, unhealthy := g.health.snapshot(provider.ID)
+		status := ProviderStatus{ID: provider.ID, Type: provider.Type, Healthy: !unhealthy, ConsecutiveFailures: failures, Evicted: g.health.isEvicted(provider.ID)}
+		if result, ok := g.warmups.get(provider.ID); ok {
+			status.Warmup = &result
+		}
+		if check, ok := g.checks.status(provider.ID); ok {
+			status.HealthCheck = &check
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ID < statuses[j].ID })
+	return statuses
+}
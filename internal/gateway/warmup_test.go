@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestWarmupReportsProviders(t *testing.T) {
+	var models, completions atomic.Int32
+	var completionModel atomic.Value
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/models":
+			models.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		case "/chat/completions":
+			completions.Add(1)
+			body, _ := io.ReadAll(r.Body)
+			completionModel.Store(gjson.GetBytes(body, "model").String())
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":"c1","model":"m-up"}`))
+		}
+	}))
+	t.Cleanup(provider.Close)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	cfg := &config.Config{
+		Warmup: &config.WarmupConfig{Mode: config.WarmupConnect, TimeoutSeconds: 5},
+		Providers: []config.ProviderConfig{
+			{ID: "up", BaseURL: provider.URL, AccessToken: "t"},
+			{ID: "down", BaseURL: unreachable.URL, AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{{Name: "m", Providers: []config.ModelProvider{{ID: "up", Model: "m-up"}}}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	if statuses := gw.ProviderStatuses(); len(statuses) != 2 || statuses[0].Warmup != nil {
+		t.Fatalf("expected no warm-up results before the warm-up, got %+v", statuses)
+	}
+	gw.Warmup(context.Background())
+	statuses := gw.ProviderStatuses()
+	if statuses[0].ID != "down" || statuses[0].Warmup == nil || statuses[0].Warmup.Success || statuses[0].Warmup.Error == "" {
+		t.Fatalf("expected the unreachable provider to fail, got %+v", statuses[0])
+	}
+	if statuses[1].ID != "up" || statuses[1].Warmup == nil || !statuses[1].Warmup.Success || statuses[1].Warmup.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected any answer to warm the provider, got %+v", statuses[1])
+	}
+	if models.Load() != 1 || completions.Load() != 0 {
+		t.Fatalf("connect mode must only request the models endpoint, got %d %d", models.Load(), completions.Load())
+	}
+
+	cfg.Warmup.Mode = config.WarmupRequest
+	gw.Warmup(context.Background())
+	if completions.Load() != 1 || completionModel.Load() != "m-up" {
+		t.Fatalf("expected a completion with the provider model, got %d %v", completions.Load(), completionModel.Load())
+	}
+	if up := gw.ProviderStatuses()[1]; !up.Warmup.Success || up.Warmup.Mode != config.WarmupRequest {
+		t.Fatalf("unexpected request warm-up result %+v", up.Warmup)
+	}
+	if down := gw.ProviderStatuses()[0]; down.Warmup.Success || down.Warmup.Error != "no model is configured for the provider" {
+		t.Fatalf("unexpected warm-up result of a provider without models %+v", down.Warmup)
+	}
+}
@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// weightedBalancer picks the provider tried first for a model by smooth
+// weighted round robin, so each provider gets its share of the requests
+// evenly spread rather than in bursts.
+type weightedBalancer struct {
+	weights []int
+	total   int
+
+	mu      sync.Mutex
+	current []int
+}
+
+// newWeightedBalancer returns a balancer over the providers of a model, or nil
+// when none of them has a weight.
+func newWeightedBalancer(providers []config.ModelProvider) *weightedBalancer {
+	weights := make([]int, len(providers))
+	total := 0
+	for i, p := range providers {
+		weights[i] = p.Weight
+		total += p.Weight
+	}
+	if total == 0 {
+		return nil
+	}
+	return &weightedBalancer{weights: weights, total: total, current: make([]int, len(providers))}
+}
+
+// next returns the index of the provider to try first.
+func (b *weightedBalancer) next() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	best := -1
+	for i, w := range b.weights {
+		if w == 0 {
+			continue
+		}
+		b.current[i] += w
+		if best < 0 || b.current[i] > b.current[best] {
+			best = i
+		}
+	}
+	b.current[best] -= b.total
+	return best
+}
+
+// order moves the next provider to the front of providers, which are in the
+// configured order; the others keep that order for failover.
+func (b *weightedBalancer) order(providers []ruleProvider) []ruleProvider {
+	first := b.next()
+	ordered := make([]ruleProvider, 0, len(providers))
+	ordered = append(ordered, providers[first])
+	ordered = append(ordered, providers[:first]...)
+	return append(ordered, providers[first+1:]...)
+}
+
+// roundRobin rotates the provider a request is first sent to, so a provider
+// list without weights shares the load evenly.
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+// newRoundRobin returns a rotation for the rotation setting of a model or
+// rule, or nil when it is not round_robin.
+func newRoundRobin(rotation string) *roundRobin {
+	if rotation != config.RotationRoundRobin {
+		return nil
+	}
+	return &roundRobin{}
+}
+
+// rotate starts providers at the next one in turn; the ones after it follow,
+// wrapping around, so failover still walks the configured order.
+func (r *roundRobin) rotate(providers []ruleProvider) []ruleProvider {
+	if len(providers) < 2 {
+		return providers
+	}
+	start := int((r.next.Add(1) - 1) % uint64(len(providers)))
+	ordered := make([]ruleProvider, 0, len(providers))
+	ordered = append(ordered, providers[start:]...)
+	return append(ordered, providers[:start]...)
+}
@@ -0,0 +1,103 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestWeightedBalancerSpreadsRequests(t *testing.T) {
+	if newWeightedBalancer([]config.ModelProvider{{ID: "p1"}, {ID: "p2"}}) != nil {
+		t.Fatal("expected no balancer without weights")
+	}
+
+	b := newWeightedBalancer([]config.ModelProvider{{ID: "cheap", Weight: 4}, {ID: "reliable", Weight: 1}, {ID: "backup"}})
+	counts := make([]int, 3)
+	previous := -1
+	for i := 0; i < 100; i++ {
+		next := b.next()
+		if next == 1 && previous == 1 {
+			t.Fatal("smooth round robin must not pick the light provider twice in a row")
+		}
+		counts[next]++
+		previous = next
+	}
+	if counts[0] != 80 || counts[1] != 20 || counts[2] != 0 {
+		t.Fatalf("expected an 80/20 split, got %v", counts)
+	}
+}
+
+func TestSelectProvidersUsesWeights(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "cheap", BaseURL: "http://cheap", AccessToken: "t"},
+			{ID: "reliable", BaseURL: "http://reliable", AccessToken: "t"},
+			{ID: "backup", BaseURL: "http://backup", AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{{
+			Name:      "gpt-4o",
+			Providers: []config.ModelProvider{{ID: "backup"}, {ID: "cheap", Weight: 80}, {ID: "reliable", Weight: 20}},
+		}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	first := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		providers := gw.selectProviders(gw.models["gpt-4o"], "gpt-4o", 0, "/v1/chat/completions")
+		if len(providers) != 3 {
+			t.Fatalf("expected every provider for failover, got %v", providers)
+		}
+		first[providers[0].id]++
+		if providers[0].id == "cheap" && (providers[1].id != "backup" || providers[2].id != "reliable") {
+			t.Fatalf("expected the others in configured order, got %v", providers)
+		}
+	}
+	if first["cheap"] != 8 || first["reliable"] != 2 {
+		t.Fatalf("expected an 80/20 split, got %v", first)
+	}
+}
+
+func TestSelectProvidersRotatesRoundRobin(t *testing.T) {
+	cfg := &config.Config{
+		Providers: []config.ProviderConfig{
+			{ID: "p1", BaseURL: "http://p1", AccessToken: "t"},
+			{ID: "p2", BaseURL: "http://p2", AccessToken: "t"},
+			{ID: "p3", BaseURL: "http://p3", AccessToken: "t"},
+		},
+		Models: []config.ModelConfig{{
+			Name:      "gpt-4o",
+			Providers: []config.ModelProvider{{ID: "p1"}, {ID: "p2"}, {ID: "p3"}},
+			Rotation:  config.RotationRoundRobin,
+			Rules: []config.RuleConfig{{
+				Expression: "TokenCount > 100",
+				Providers:  config.ProviderOverrideConfig{{Provider: "p3"}, {Provider: "p1"}},
+				Rotation:   config.RotationRoundRobin,
+			}},
+		}},
+	}
+	gw, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	order := func(tokens int) string {
+		var ids string
+		for _, p := range gw.selectProviders(gw.models["gpt-4o"], "gpt-4o", tokens, "/v1/chat/completions") {
+			ids += p.id
+		}
+		return ids
+	}
+
+	for i, want := range []string{"p1p2p3", "p2p3p1", "p3p1p2", "p1p2p3"} {
+		if got := order(0); got != want {
+			t.Fatalf("request %d: expected %s, got %s", i, want, got)
+		}
+	}
+	for i, want := range []string{"p3p1", "p1p3", "p3p1"} {
+		if got := order(200); got != want {
+			t.Fatalf("rule request %d: expected %s, got %s", i, want, got)
+		}
+	}
+}
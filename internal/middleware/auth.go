@@ -1,30 +1,120 @@
 package middleware
 
 import (
-	"encoding/json"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/mylxsw/asteria/log"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/apierror"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
 )
 
 type APIKeyAuth struct {
-	keys map[string]struct{}
+	mu   sync.RWMutex
+	keys map[string]authKey
+	// digests holds the tenant keys only known by their digest
+	digests map[string]authKey
+	now     func() time.Time
 }
 
-type errorResponse struct {
-	Error string `json:"error"`
+// authKey is a configured key with the identity it resolves to.
+type authKey struct {
+	identity Identity
+	// expiresAt is zero for keys that do not expire
+	expiresAt time.Time
+	disabled  bool
 }
 
-func NewAPIKeyAuth(keys []string) *APIKeyAuth {
-	m := make(map[string]struct{}, len(keys))
-	for _, key := range keys {
+func newAuthKey(key string, meta config.KeyMetadata, roles ...Role) authKey {
+	// Config validation already rejected unparsable expiry times.
+	expiresAt, _ := meta.Expiry()
+	return authKey{
+		identity:  Identity{Key: key, Name: meta.Name, Roles: roles},
+		expiresAt: expiresAt,
+		disabled:  meta.Disabled(),
+	}
+}
+
+// NewAPIKeyAuth maps every configured key to its identity: api_keys may use
+// the proxy, admin_keys everything, and keys the roles listed for them.
+func NewAPIKeyAuth(cfg *config.Config) *APIKeyAuth {
+	m := make(map[string]authKey, len(cfg.APIKeys)+len(cfg.AdminKeys)+len(cfg.Keys))
+	for _, key := range cfg.APIKeys {
+		if key.Key == "" {
+			continue
+		}
+		m[key.Key] = newAuthKey(key.Key, key.KeyMetadata, RoleProxy)
+	}
+	for _, key := range cfg.AdminKeys {
+		if key == "" {
+			continue
+		}
+		m[key] = authKey{identity: Identity{Key: key, Roles: []Role{RoleAdmin}}}
+	}
+	for _, key := range cfg.Keys {
+		if key.Key == "" {
+			continue
+		}
+		var roles []Role
+		for _, role := range key.Roles {
+			roles = append(roles, Role(role))
+		}
+		m[key.Key] = newAuthKey(key.Key, key.KeyMetadata, roles...)
+	}
+	a := &APIKeyAuth{keys: m, digests: make(map[string]authKey), now: time.Now}
+	for _, tenant := range cfg.Tenants {
+		a.addTenant(tenant)
+	}
+	return a
+}
+
+// Reload replaces the accepted keys with those of cfg.
+func (a *APIKeyAuth) Reload(cfg *config.Config) {
+	next := NewAPIKeyAuth(cfg)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = next.keys
+	a.digests = next.digests
+}
+
+// AddTenant accepts the keys of a tenant created after startup.
+func (a *APIKeyAuth) AddTenant(tenant config.TenantConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.addTenant(tenant)
+}
+
+func (a *APIKeyAuth) addTenant(tenant config.TenantConfig) {
+	for _, key := range tenant.APIKeys {
 		if key == "" {
 			continue
 		}
-		m[key] = struct{}{}
+		a.keys[key] = authKey{identity: Identity{Key: key, Tenant: tenant.ID, Roles: []Role{RoleProxy}}}
+	}
+	for _, digest := range tenant.APIKeyDigests {
+		a.digests[digest] = authKey{identity: Identity{Tenant: tenant.ID, Roles: []Role{RoleProxy}}}
+	}
+}
+
+func (a *APIKeyAuth) enabled() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.keys) > 0 || len(a.digests) > 0
+}
+
+func (a *APIKeyAuth) lookup(key string) (authKey, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if entry, ok := a.keys[key]; ok {
+		return entry, true
+	}
+	if len(a.digests) == 0 {
+		return authKey{}, false
 	}
-	return &APIKeyAuth{keys: m}
+	entry, ok := a.digests[config.APIKeyDigest(key)]
+	entry.identity.Key = key
+	return entry, ok
 }
 
 func (a *APIKeyAuth) Middleware(next http.Handler) http.Handler {
@@ -34,7 +124,7 @@ func (a *APIKeyAuth) Middleware(next http.Handler) http.Handler {
 func (a *APIKeyAuth) MiddlewareWithSkipper(skipper func(*http.Request) bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if len(a.keys) == 0 {
+			if !a.enabled() {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -45,21 +135,54 @@ func (a *APIKeyAuth) MiddlewareWithSkipper(skipper func(*http.Request) bool) fun
 
 			key := extractAPIKey(r)
 			if key == "" {
-				log.Warningf("Missing API key from %s", r.RemoteAddr)
-				writeAuthError(w, http.StatusUnauthorized, "missing api key")
+				Logger(r.Context()).Warningf("Missing API key from %s", r.RemoteAddr)
+				apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeMissingAPIKey, "missing api key")
+				return
+			}
+			entry, ok := a.lookup(key)
+			if !ok {
+				Logger(r.Context()).Warningf("Invalid API key from %s", r.RemoteAddr)
+				apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeInvalidAPIKey, "invalid api key")
 				return
 			}
-			if _, ok := a.keys[key]; !ok {
-				log.Warningf("Invalid API key from %s", r.RemoteAddr)
-				writeAuthError(w, http.StatusUnauthorized, "invalid api key")
+			identity := entry.identity
+			if entry.disabled {
+				Logger(r.Context()).Warningf("Disabled API key %s from %s", identity.label(), r.RemoteAddr)
+				apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeDisabledAPIKey, "api key is disabled")
+				return
+			}
+			if !entry.expiresAt.IsZero() && !a.now().Before(entry.expiresAt) {
+				Logger(r.Context()).Warningf("Expired API key %s from %s", identity.label(), r.RemoteAddr)
+				apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeExpiredAPIKey, "api key expired")
+				return
+			}
+			if !authorize(identity, r.URL.Path) {
+				Logger(r.Context()).Warningf("API key with roles %v from %s denied access to %s", identity.Roles, r.RemoteAddr, r.URL.Path)
+				apierror.Write(w, r, http.StatusForbidden, apierror.CodePermissionDenied, "api key is not allowed to access this endpoint")
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
 		})
 	}
 }
 
+// authorize applies the role checks of each route group.
+func authorize(identity Identity, path string) bool {
+	if identity.Has(RoleAdmin) {
+		return true
+	}
+	switch {
+	case path == "/admin" || strings.HasPrefix(path, "/admin/"):
+		return false
+	case path == "/usage" || strings.HasPrefix(path, "/usage/"):
+		// Tenant keys are limited to their own tenant by the usage handlers.
+		return identity.Has(RoleReadUsage) || identity.Tenant != ""
+	default:
+		return identity.Has(RoleProxy)
+	}
+}
+
 func extractAPIKey(r *http.Request) string {
 	auth := r.Header.Get("Authorization")
 	if auth != "" {
@@ -73,9 +196,3 @@ func extractAPIKey(r *http.Request) string {
 	}
 	return ""
 }
-
-func writeAuthError(w http.ResponseWriter, status int, msg string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(errorResponse{Error: msg})
-}
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestAPIKeyAuthEnforcesRoles(t *testing.T) {
+	cfg := &config.Config{
+		APIKeys:   config.APIKeys{{Key: "sk-client"}},
+		AdminKeys: []string{"sk-admin"},
+		Tenants:   []config.TenantConfig{{ID: "team-a", APIKeys: []string{"sk-tenant"}}},
+	}
+	auth := NewAPIKeyAuth(cfg)
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := []struct {
+		key  string
+		path string
+		want int
+	}{
+		{"sk-client", "/v1/chat/completions", http.StatusOK},
+		{"sk-client", "/usage", http.StatusForbidden},
+		{"sk-client", "/admin/loglevel", http.StatusForbidden},
+		{"sk-tenant", "/usage", http.StatusOK},
+		{"sk-tenant", "/admin/backup", http.StatusForbidden},
+		{"sk-admin", "/usage", http.StatusOK},
+		{"sk-admin", "/admin/loglevel", http.StatusOK},
+		{"sk-unknown", "/v1/chat/completions", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s %s: expected %d, got %d", tc.key, tc.path, tc.want, rec.Code)
+		}
+	}
+}
+
+func TestAPIKeyAuthWithoutAdminKeysDeniesAdminAccess(t *testing.T) {
+	auth := NewAPIKeyAuth(&config.Config{APIKeys: config.APIKeys{{Key: "sk-legacy"}}})
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/loglevel", nil)
+	req.Header.Set("Authorization", "Bearer sk-legacy")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("api_keys must not get admin access without an admin key, got %d", rec.Code)
+	}
+}
+
+func TestAPIKeyAuthKeyRoles(t *testing.T) {
+	auth := NewAPIKeyAuth(&config.Config{
+		APIKeys: config.APIKeys{{Key: "sk-legacy"}},
+		Keys: []config.KeyConfig{
+			{Key: "sk-reader", Roles: []string{config.RoleReadUsage}},
+			{Key: "sk-both", Roles: []string{config.RoleProxy, config.RoleReadUsage}},
+			{Key: "sk-admin", Roles: []string{config.RoleAdmin}},
+		},
+	})
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := []struct {
+		key  string
+		path string
+		want int
+	}{
+		{"sk-legacy", "/v1/chat/completions", http.StatusOK},
+		{"sk-legacy", "/usage", http.StatusForbidden},
+		{"sk-legacy", "/admin/loglevel", http.StatusForbidden},
+		{"sk-reader", "/usage", http.StatusOK},
+		{"sk-reader", "/usage/request_detail", http.StatusOK},
+		{"sk-reader", "/v1/chat/completions", http.StatusForbidden},
+		{"sk-reader", "/admin/alerts", http.StatusForbidden},
+		{"sk-both", "/v1/messages", http.StatusOK},
+		{"sk-both", "/usage", http.StatusOK},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s %s: expected %d, got %d", tc.key, tc.path, tc.want, rec.Code)
+		}
+	}
+}
+
+func TestAPIKeyAuthRejectsExpiredAndDisabledKeys(t *testing.T) {
+	disabled := false
+	auth := NewAPIKeyAuth(&config.Config{
+		APIKeys: config.APIKeys{
+			{Key: "sk-named", KeyMetadata: config.KeyMetadata{Name: "batch-jobs", ExpiresAt: "2030-01-31"}},
+			{Key: "sk-expired", KeyMetadata: config.KeyMetadata{ExpiresAt: "2020-06-01T12:00:00Z"}},
+			{Key: "sk-disabled", KeyMetadata: config.KeyMetadata{Name: "retired", Enabled: &disabled}},
+		},
+		Keys: []config.KeyConfig{
+			{Key: "sk-old-reader", KeyMetadata: config.KeyMetadata{ExpiresAt: "2020-01-01"}, Roles: []string{config.RoleReadUsage}},
+		},
+	})
+	var name string
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := IdentityFromContext(r.Context())
+		name = identity.Name
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := []struct {
+		key  string
+		path string
+		want int
+	}{
+		{"sk-named", "/v1/chat/completions", http.StatusOK},
+		{"sk-expired", "/v1/chat/completions", http.StatusUnauthorized},
+		{"sk-disabled", "/v1/chat/completions", http.StatusUnauthorized},
+		{"sk-old-reader", "/usage", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s %s: expected %d, got %d", tc.key, tc.path, tc.want, rec.Code)
+		}
+	}
+	if name != "batch-jobs" {
+		t.Fatalf("expected the key name in the request context, got %q", name)
+	}
+
+	// A date stays valid through that day.
+	auth.now = func() time.Time { return time.Date(2030, 1, 31, 23, 0, 0, 0, time.Local) }
+	req := httptest.NewRequest(http.MethodGet, "/v1/chat/completions", nil)
+	req.Header.Set("Authorization", "Bearer sk-named")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the key to be valid on its expiry date, got %d", rec.Code)
+	}
+	auth.now = func() time.Time { return time.Date(2030, 2, 1, 0, 0, 0, 0, time.Local) }
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "expired_api_key") {
+		t.Fatalf("expected the key to expire after its date, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAPIKeyAuthMatchesTenantKeyDigests(t *testing.T) {
+	tenant := config.TenantConfig{ID: "team-a", APIKeys: []string{"sk-onboarded"}}.WithKeyDigests()
+	if len(tenant.APIKeys) != 0 || len(tenant.APIKeyDigests) != 1 {
+		t.Fatalf("expected the key to be replaced by its digest, got %+v", tenant)
+	}
+	auth := NewAPIKeyAuth(&config.Config{APIKeys: config.APIKeys{{Key: "sk-client"}}})
+	auth.AddTenant(tenant)
+
+	var identity Identity
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ = IdentityFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+	for key, want := range map[string]int{"sk-onboarded": http.StatusOK, tenant.APIKeyDigests[0]: http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("%s: expected %d, got %d", key, want, rec.Code)
+		}
+	}
+	if identity.Tenant != "team-a" || identity.Key != "sk-onboarded" {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+}
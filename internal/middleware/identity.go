@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// Role determines which route groups an API key may access.
+type Role string
+
+const (
+	// RoleProxy keys may call the /v1 proxy routes.
+	RoleProxy Role = config.RoleProxy
+	// RoleReadUsage keys may read the usage data of every tenant.
+	RoleReadUsage Role = config.RoleReadUsage
+	// RoleAdmin keys may call every endpoint.
+	RoleAdmin Role = config.RoleAdmin
+)
+
+// Identity describes the caller resolved from the presented API key. Tenant
+// keys may always read their own tenant's usage.
+type Identity struct {
+	Key string
+	// Name is the configured name of the key, empty for unnamed keys
+	Name   string
+	Tenant string
+	Roles  []Role
+}
+
+// label names the key in logs without revealing it.
+func (id Identity) label() string {
+	if id.Name != "" {
+		return id.Name
+	}
+	return id.Key[:min(4, len(id.Key))] + "..."
+}
+
+// Has reports whether the identity was granted role.
+func (id Identity) Has(role Role) bool {
+	return slices.Contains(id.Roles, role)
+}
+
+type identityContextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the caller identity.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, id)
+}
+
+// IdentityFromContext returns the caller identity attached by the auth middleware.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	if ctx == nil {
+		return Identity{}, false
+	}
+	id, ok := ctx.Value(identityContextKey{}).(Identity)
+	return id, ok
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mylxsw/asteria/log"
+)
+
+// RequestIDHeader carries the id correlating a request across the client, the
+// gateway logs and storage, and the providers.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDContextKey struct{}
+
+// WithRequestID attaches the request id to ctx.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestIDFromContext returns the request id attached by RequestID.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(requestIDContextKey{}).(string)
+	return id, ok
+}
+
+// Logger returns a logger whose lines carry the request id of ctx, or the
+// default logger outside of a request.
+func Logger(ctx context.Context) log.Logger {
+	id, ok := RequestIDFromContext(ctx)
+	if !ok {
+		return log.Default()
+	}
+	return log.WithFields(log.Fields{"request_id": id})
+}
+
+// RequestID keeps the X-Request-ID of a request, or assigns one, and returns
+// it in the response headers. The header is applied when the status is
+// written because the proxy replaces response headers with the upstream ones.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSpace(r.Header.Get(RequestIDHeader))
+		if id == "" {
+			id = uuid.NewString()
+		}
+		r.Header.Set(RequestIDHeader, id)
+		next.ServeHTTP(newRequestIDWriter(w, id), r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+// requestIDWriter sets the X-Request-ID response header when the response is
+// written.
+type requestIDWriter struct {
+	http.ResponseWriter
+	id          string
+	wroteHeader bool
+}
+
+func newRequestIDWriter(w http.ResponseWriter, id string) *requestIDWriter {
+	return &requestIDWriter{ResponseWriter: w, id: id}
+}
+
+func (w *requestIDWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set(RequestIDHeader, w.id)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *requestIDWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *requestIDWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *requestIDWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
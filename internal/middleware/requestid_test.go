@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestIDKeepsOrAssignsID(t *testing.T) {
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := RequestIDFromContext(r.Context())
+		if r.Header.Get(RequestIDHeader) != id {
+			t.Errorf("request header %q does not match context id %q", r.Header.Get(RequestIDHeader), id)
+		}
+		seen = id
+		w.Header().Set(RequestIDHeader, "provider-id")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set(RequestIDHeader, " client-id ")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if seen != "client-id" || rec.Header().Get(RequestIDHeader) != "client-id" {
+		t.Fatalf("unexpected ids: handler %q, response %q", seen, rec.Header().Get(RequestIDHeader))
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	if seen == "" || rec.Header().Get(RequestIDHeader) != seen {
+		t.Fatalf("unexpected ids: handler %q, response %q", seen, rec.Header().Get(RequestIDHeader))
+	}
+}
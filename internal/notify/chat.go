@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// chatWebhook posts a human readable rendering of the event to a chat incoming
+// webhook; payload builds the JSON body expected by the chat service.
+type chatWebhook struct {
+	url     string
+	client  *http.Client
+	payload func(text string, event Event) any
+}
+
+func newSlack(nc config.NotifierConfig) *chatWebhook {
+	return &chatWebhook{url: nc.URL, client: http.DefaultClient, payload: func(text string, _ Event) any {
+		return map[string]any{"text": text}
+	}}
+}
+
+func newDiscord(nc config.NotifierConfig) *chatWebhook {
+	return &chatWebhook{url: nc.URL, client: http.DefaultClient, payload: func(text string, _ Event) any {
+		// Discord rejects messages longer than 2000 characters.
+		if runes := []rune(text); len(runes) > 2000 {
+			text = string(runes[:1997]) + "..."
+		}
+		return map[string]any{"content": text}
+	}}
+}
+
+// newFeishu supports Feishu/Lark custom bots, including the optional signature check.
+func newFeishu(nc config.NotifierConfig) *chatWebhook {
+	secret := nc.Secret
+	return &chatWebhook{url: nc.URL, client: http.DefaultClient, payload: func(text string, event Event) any {
+		body := map[string]any{
+			"msg_type": "text",
+			"content":  map[string]string{"text": text},
+		}
+		if secret != "" {
+			timestamp := strconv.FormatInt(event.Time.Unix(), 10)
+			mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+			body["timestamp"] = timestamp
+			body["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		}
+		return body
+	}}
+}
+
+func (c *chatWebhook) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(c.payload(formatText(event), event))
+	if err != nil {
+		return fmt.Errorf("encode message: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	// Feishu reports failures with a non-zero code in a 200 response.
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if json.Unmarshal(respBody, &result) == nil && result.Code != 0 {
+		return fmt.Errorf("webhook returned code %d: %s", result.Code, result.Msg)
+	}
+	return nil
+}
+
+// formatText renders an event as a short plain text message.
+func formatText(event Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s", strings.ToUpper(string(event.Severity)), event.Message)
+	for _, field := range []struct{ name, value string }{
+		{"provider", event.Provider},
+		{"model", event.Model},
+		{"tenant", event.Tenant},
+	} {
+		if field.value != "" {
+			fmt.Fprintf(&b, "\n%s: %s", field.name, field.value)
+		}
+	}
+	keys := make([]string, 0, len(event.Details))
+	for k := range event.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\n%s: %v", k, event.Details[k])
+	}
+	fmt.Fprintf(&b, "\nevent: %s at %s", event.Type, event.Time.UTC().Format("2006-01-02 15:04:05 MST"))
+	return b.String()
+}
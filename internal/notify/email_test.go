@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// fakeSMTP accepts a single message and returns its DATA section.
+func fakeSMTP(t *testing.T) (string, int, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+		reply("220 fake smtp")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 fake")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				messages <- data.String()
+				reply("250 ok")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return host, p, messages
+}
+
+func TestEmailNotifierSendsMessage(t *testing.T) {
+	host, port, messages := fakeSMTP(t)
+	notifier, err := newNotifier(config.NotifierConfig{
+		Name: "mail", Type: "email", Host: host, Port: port,
+		From: "gateway@example.com", To: []string{"ops@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("create notifier: %v", err)
+	}
+
+	event := Event{
+		Type:     EventBudgetThreshold,
+		Severity: SeverityWarning,
+		Time:     time.Unix(1700000000, 0),
+		Message:  "tenant team-a reached 80% of its daily token budget (80/100)",
+		Details:  map[string]any{"today": "4 requests, 0 failures, 60 prompt tokens, 20 completion tokens"},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := notifier.Notify(ctx, event); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+
+	msg := <-messages
+	for _, want := range []string{"To: ops@example.com", "Subject: [gateway warning] tenant team-a reached 80%", "today: 4 requests"} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("message is missing %q:\n%s", want, msg)
+		}
+	}
+}
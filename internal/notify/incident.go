@@ -0,0 +1,169 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// incidentKey returns the deduplication key of an event for incident
+// management tools and whether the event resolves the incident rather than
+// opening it. Problems that recover share the key of the event that opened them.
+func incidentKey(event Event) (string, bool) {
+	switch event.Type {
+	case EventProviderUnhealthy, EventProviderEvicted, EventCircuitOpen, EventProviderRecovered:
+		return "gateway/provider/" + event.Provider, event.Type == EventProviderRecovered
+	case EventSLOViolated, EventSLORecovered:
+		return "gateway/slo/" + event.Provider, event.Type == EventSLORecovered
+	case EventAlertFiring, EventAlertResolved:
+		return fmt.Sprintf("gateway/alert/%v/%s", event.Details["alert"], event.Provider), event.Type == EventAlertResolved
+	default:
+		return "gateway/" + event.Key, false
+	}
+}
+
+// pagerDuty sends events to the PagerDuty Events API v2.
+type pagerDuty struct {
+	url        string
+	routingKey string
+	client     *http.Client
+}
+
+func newPagerDuty(nc config.NotifierConfig) *pagerDuty {
+	endpoint := nc.URL
+	if endpoint == "" {
+		endpoint = "https://events.pagerduty.com/v2/enqueue"
+	}
+	return &pagerDuty{url: endpoint, routingKey: nc.APIKey, client: http.DefaultClient}
+}
+
+func (p *pagerDuty) Notify(ctx context.Context, event Event) error {
+	dedupKey, resolve := incidentKey(event)
+	body := map[string]any{
+		"routing_key":  p.routingKey,
+		"event_action": "trigger",
+		"dedup_key":    dedupKey,
+	}
+	if resolve {
+		body["event_action"] = "resolve"
+	} else {
+		severity := string(event.Severity)
+		if severity == "" {
+			severity = string(SeverityWarning)
+		}
+		body["payload"] = map[string]any{
+			"summary":        truncate(event.Message, 1024),
+			"source":         "openai-cost-optimal-gateway",
+			"severity":       severity,
+			"timestamp":      event.Time.UTC().Format(time.RFC3339),
+			"component":      event.Provider,
+			"class":          string(event.Type),
+			"custom_details": incidentDetails(event),
+		}
+	}
+	return postIncident(ctx, p.client, p.url, nil, body)
+}
+
+// opsgenie creates and closes Opsgenie alerts, using the deduplication key as alias.
+type opsgenie struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func newOpsgenie(nc config.NotifierConfig) *opsgenie {
+	endpoint := strings.TrimRight(nc.URL, "/")
+	if endpoint == "" {
+		endpoint = "https://api.opsgenie.com/v2/alerts"
+	}
+	return &opsgenie{url: endpoint, apiKey: nc.APIKey, client: http.DefaultClient}
+}
+
+func (o *opsgenie) Notify(ctx context.Context, event Event) error {
+	alias, resolve := incidentKey(event)
+	headers := map[string]string{"Authorization": "GenieKey " + o.apiKey}
+	if resolve {
+		endpoint := fmt.Sprintf("%s/%s/close?identifierType=alias", o.url, url.PathEscape(alias))
+		return postIncident(ctx, o.client, endpoint, headers, map[string]any{
+			"source": "openai-cost-optimal-gateway",
+			"note":   event.Message,
+		})
+	}
+
+	priority := "P3"
+	switch event.Severity {
+	case SeverityCritical:
+		priority = "P1"
+	case SeverityInfo:
+		priority = "P5"
+	}
+	return postIncident(ctx, o.client, o.url, headers, map[string]any{
+		"message":     truncate(event.Message, 130),
+		"alias":       truncate(alias, 512),
+		"description": formatText(event),
+		"priority":    priority,
+		"source":      "openai-cost-optimal-gateway",
+		"tags":        []string{string(event.Type)},
+		"details":     incidentDetails(event),
+	})
+}
+
+// incidentDetails flattens the event context into string values, which both
+// services accept.
+func incidentDetails(event Event) map[string]string {
+	details := make(map[string]string, len(event.Details)+3)
+	for k, v := range event.Details {
+		details[k] = fmt.Sprint(v)
+	}
+	for _, field := range []struct{ name, value string }{
+		{"provider", event.Provider},
+		{"model", event.Model},
+		{"tenant", event.Tenant},
+	} {
+		if field.value != "" {
+			details[field.name] = field.value
+		}
+	}
+	return details
+}
+
+func postIncident(ctx context.Context, client *http.Client, endpoint string, headers map[string]string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("incident api returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n-3]) + "..."
+	}
+	return s
+}
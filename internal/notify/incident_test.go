@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+type capturedRequest struct {
+	path  string
+	query string
+	auth  string
+	body  map[string]any
+}
+
+func captureServer(t *testing.T) (*httptest.Server, chan capturedRequest) {
+	t.Helper()
+	requests := make(chan capturedRequest, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		requests <- capturedRequest{path: r.URL.Path, query: r.URL.RawQuery, auth: r.Header.Get("Authorization"), body: body}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestPagerDutyTriggersAndResolvesWithSharedDedupKey(t *testing.T) {
+	server, requests := captureServer(t)
+	pd := newPagerDuty(config.NotifierConfig{URL: server.URL, APIKey: "routing-key"})
+	now := time.Unix(1700000000, 0)
+
+	if err := pd.Notify(context.Background(), Event{Type: EventProviderUnhealthy, Severity: SeverityWarning, Provider: "p1", Message: "provider p1 failed", Time: now}); err != nil {
+		t.Fatalf("trigger: %v", err)
+	}
+	trigger := <-requests
+	payload, _ := trigger.body["payload"].(map[string]any)
+	if trigger.body["routing_key"] != "routing-key" || trigger.body["event_action"] != "trigger" || payload["severity"] != "warning" || payload["summary"] != "provider p1 failed" {
+		t.Fatalf("unexpected trigger body %+v", trigger.body)
+	}
+
+	if err := pd.Notify(context.Background(), Event{Type: EventProviderRecovered, Provider: "p1", Time: now}); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	resolve := <-requests
+	if resolve.body["event_action"] != "resolve" || resolve.body["dedup_key"] != trigger.body["dedup_key"] {
+		t.Fatalf("expected resolve with dedup key %v, got %+v", trigger.body["dedup_key"], resolve.body)
+	}
+}
+
+func TestOpsgenieCreatesAndClosesByAlias(t *testing.T) {
+	server, requests := captureServer(t)
+	og := newOpsgenie(config.NotifierConfig{URL: server.URL + "/v2/alerts", APIKey: "genie"})
+	details := map[string]any{"alert": "provider-errors"}
+
+	if err := og.Notify(context.Background(), Event{Type: EventAlertFiring, Severity: SeverityCritical, Provider: "p1", Message: "alert firing", Details: details}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	create := <-requests
+	if create.path != "/v2/alerts" || create.auth != "GenieKey genie" || create.body["priority"] != "P1" || create.body["alias"] != "gateway/alert/provider-errors/p1" {
+		t.Fatalf("unexpected create request %+v", create)
+	}
+
+	if err := og.Notify(context.Background(), Event{Type: EventAlertResolved, Provider: "p1", Message: "resolved", Details: details}); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	closeReq := <-requests
+	if closeReq.path != "/v2/alerts/gateway/alert/provider-errors/p1/close" || closeReq.query != "identifierType=alias" {
+		t.Fatalf("unexpected close request %+v", closeReq)
+	}
+}
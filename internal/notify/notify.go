@@ -0,0 +1,242 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// EventType names the situation an event reports.
+type EventType string
+
+const (
+	// EventProviderUnhealthy fires when a provider fails several requests in a row.
+	EventProviderUnhealthy EventType = "provider_unhealthy"
+	// EventProviderRecovered fires when an unhealthy provider serves a request or passes a probe again.
+	EventProviderRecovered EventType = "provider_recovered"
+	// EventProviderEvicted fires when a provider unhealthy for long is taken out of rotation.
+	EventProviderEvicted EventType = "provider_evicted"
+	// EventCircuitOpen fires when failed health checks take a provider out of rotation.
+	EventCircuitOpen EventType = "circuit_open"
+	// EventAllProvidersFailed fires when no provider could serve a request for a model.
+	EventAllProvidersFailed EventType = "all_providers_failed"
+	// EventBudgetExceeded fires when requests are rejected because a budget is used up.
+	EventBudgetExceeded EventType = "budget_exceeded"
+	// EventBudgetThreshold fires when a budget's usage crosses 80% or 100%.
+	EventBudgetThreshold EventType = "budget_threshold"
+	// EventErrorRateSpike fires when a provider's error rate crosses the configured threshold.
+	EventErrorRateSpike EventType = "error_rate_spike"
+	// EventSpendAnomaly fires when a key's hourly token usage of a model jumps far above its baseline.
+	EventSpendAnomaly EventType = "spend_anomaly"
+	// EventUsageReport carries a scheduled usage summary.
+	EventUsageReport EventType = "usage_report"
+	// EventAlertFiring fires when the condition of an alert rule starts to hold.
+	EventAlertFiring EventType = "alert_firing"
+	// EventAlertResolved fires when the condition of a firing alert rule no longer holds.
+	EventAlertResolved EventType = "alert_resolved"
+	// EventSLOViolated fires when a provider's latency percentile misses its objective.
+	EventSLOViolated EventType = "slo_violated"
+	// EventSLORecovered fires when a provider meets its latency objective again.
+	EventSLORecovered EventType = "slo_recovered"
+)
+
+// Severity ranks events for drivers that distinguish between levels.
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Event is the payload delivered to notifiers.
+type Event struct {
+	ID       string         `json:"id"`
+	Type     EventType      `json:"type"`
+	Severity Severity       `json:"severity"`
+	Time     time.Time      `json:"time"`
+	Message  string         `json:"message"`
+	Provider string         `json:"provider,omitempty"`
+	Model    string         `json:"model,omitempty"`
+	Tenant   string         `json:"tenant,omitempty"`
+	Details  map[string]any `json:"details,omitempty"`
+	// Key groups repeated occurrences of the same problem; it defaults to the
+	// event type plus provider, model and tenant.
+	Key string `json:"key"`
+}
+
+// Notifier delivers events to one destination.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+type target struct {
+	name     string
+	notifier Notifier
+	events   map[EventType]struct{}
+	retries  int
+}
+
+func (t target) wants(event Event) bool {
+	if len(t.events) == 0 {
+		return true
+	}
+	_, ok := t.events[event.Type]
+	return ok
+}
+
+// Dispatcher fans events out to the configured notifiers in the background,
+// retrying failed deliveries and suppressing repeats of the same event key
+// within the cooldown.
+type Dispatcher struct {
+	targets  []target
+	cooldown time.Duration
+	backoff  time.Duration
+	recorder func(Event)
+
+	mu   sync.Mutex
+	sent map[string]time.Time
+	// pruned is when keys past their cooldown were last dropped from sent
+	pruned time.Time
+	now    func() time.Time
+}
+
+// New builds a dispatcher for the notifiers in cfg.
+func New(cfg *config.Config) (*Dispatcher, error) {
+	d := &Dispatcher{
+		cooldown: time.Duration(cfg.NotifyCooldownSeconds) * time.Second,
+		backoff:  time.Second,
+		sent:     make(map[string]time.Time),
+		now:      time.Now,
+	}
+	for _, nc := range cfg.Notifiers {
+		notifier, err := newNotifier(nc)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %s: %w", nc.Name, err)
+		}
+		t := target{name: nc.Name, notifier: notifier, retries: nc.Retries}
+		if len(nc.Events) > 0 {
+			t.events = make(map[EventType]struct{}, len(nc.Events))
+			for _, e := range nc.Events {
+				t.events[EventType(e)] = struct{}{}
+			}
+		}
+		d.targets = append(d.targets, t)
+	}
+	return d, nil
+}
+
+func newNotifier(nc config.NotifierConfig) (Notifier, error) {
+	switch nc.Type {
+	case "webhook":
+		return newWebhook(nc), nil
+	case "slack":
+		return newSlack(nc), nil
+	case "discord":
+		return newDiscord(nc), nil
+	case "feishu":
+		return newFeishu(nc), nil
+	case "email":
+		return newEmail(nc), nil
+	case "pagerduty":
+		return newPagerDuty(nc), nil
+	case "opsgenie":
+		return newOpsgenie(nc), nil
+	default:
+		return nil, fmt.Errorf("unsupported notifier type %s", nc.Type)
+	}
+}
+
+// OnPublish registers a function that receives, in the background, every event
+// that passes the cooldown, even when no notifier subscribes to it.
+func (d *Dispatcher) OnPublish(fn func(Event)) {
+	d.recorder = fn
+}
+
+// Publish delivers the event asynchronously. It never blocks the caller.
+func (d *Dispatcher) Publish(event Event) {
+	d.PublishTo(event, nil)
+}
+
+// PublishTo is like Publish but only delivers to the named notifiers, regardless
+// of the events they subscribe to. No names means every subscribed notifier.
+func (d *Dispatcher) PublishTo(event Event, names []string) {
+	if d == nil || (len(d.targets) == 0 && d.recorder == nil) {
+		return
+	}
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.Time.IsZero() {
+		event.Time = d.now()
+	}
+	if event.Key == "" {
+		event.Key = fmt.Sprintf("%s/%s/%s/%s", event.Type, event.Provider, event.Model, event.Tenant)
+	}
+	if !d.admit(event.Key) {
+		log.Debugf("notification %s suppressed by cooldown", event.Key)
+		return
+	}
+	if d.recorder != nil {
+		go d.recorder(event)
+	}
+
+	for _, t := range d.targets {
+		if len(names) > 0 {
+			if !slices.Contains(names, t.name) {
+				continue
+			}
+		} else if !t.wants(event) {
+			continue
+		}
+		go d.deliver(t, event)
+	}
+}
+
+// admit reports whether an event with the given key is outside its cooldown.
+func (d *Dispatcher) admit(key string) bool {
+	if d.cooldown <= 0 {
+		return true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	if now.Sub(d.pruned) >= d.cooldown {
+		for k, last := range d.sent {
+			if now.Sub(last) >= d.cooldown {
+				delete(d.sent, k)
+			}
+		}
+		d.pruned = now
+	}
+	if last, ok := d.sent[key]; ok && now.Sub(last) < d.cooldown {
+		return false
+	}
+	d.sent[key] = now
+	return true
+}
+
+func (d *Dispatcher) deliver(t target, event Event) {
+	var err error
+	for attempt := 0; attempt <= t.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(d.backoff << (attempt - 1))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = t.notifier.Notify(ctx, event)
+		cancel()
+		if err == nil {
+			return
+		}
+		log.Warningf("notifier %s: deliver %s (attempt %d): %v", t.name, event.Type, attempt+1, err)
+	}
+	log.Errorf("notifier %s: giving up on %s after %d attempts: %v", t.name, event.Type, t.retries+1, err)
+}
@@ -0,0 +1,216 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+func TestWebhookRetriesAndSigns(t *testing.T) {
+	var calls atomic.Int32
+	received := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get("X-Gateway-Signature"), "sha256="+Sign("s3cret", r.Header.Get("X-Gateway-Timestamp"), body); got != want {
+			t.Errorf("unexpected signature %q, want %q", got, want)
+		}
+		var event Event
+		_ = json.Unmarshal(body, &event)
+		received <- event
+	}))
+	t.Cleanup(server.Close)
+
+	d, err := New(&config.Config{Notifiers: []config.NotifierConfig{
+		{Name: "ops", Type: "webhook", URL: server.URL, Secret: "s3cret", Retries: 2},
+	}})
+	if err != nil {
+		t.Fatalf("create dispatcher: %v", err)
+	}
+	d.backoff = time.Millisecond
+
+	d.Publish(Event{Type: EventAllProvidersFailed, Model: "gpt-4o"})
+
+	select {
+	case event := <-received:
+		if event.Type != EventAllProvidersFailed || event.Model != "gpt-4o" || event.ID == "" {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("webhook was not delivered")
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected one retry, got %d calls", calls.Load())
+	}
+}
+
+func TestDispatcherCooldownAndEventFilter(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	t.Cleanup(server.Close)
+
+	d, err := New(&config.Config{
+		NotifyCooldownSeconds: 60,
+		Notifiers: []config.NotifierConfig{
+			{Name: "ops", Type: "webhook", URL: server.URL, Events: []string{string(EventProviderUnhealthy)}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create dispatcher: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	d.now = func() time.Time { return now }
+
+	d.Publish(Event{Type: EventProviderUnhealthy, Provider: "p1"})
+	d.Publish(Event{Type: EventProviderUnhealthy, Provider: "p1"})
+	d.Publish(Event{Type: EventAllProvidersFailed, Model: "gpt-4o"})
+	now = now.Add(2 * time.Minute)
+	d.Publish(Event{Type: EventProviderUnhealthy, Provider: "p1"})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for calls.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", got)
+	}
+}
+
+func TestDispatcherDropsExpiredCooldowns(t *testing.T) {
+	d, err := New(&config.Config{NotifyCooldownSeconds: 60})
+	if err != nil {
+		t.Fatalf("create dispatcher: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	d.now = func() time.Time { return now }
+
+	for _, key := range []string{"a", "b", "c"} {
+		if !d.admit(key) {
+			t.Fatalf("expected %s to be admitted", key)
+		}
+	}
+	now = now.Add(2 * time.Minute)
+	if !d.admit("d") {
+		t.Fatalf("expected d to be admitted")
+	}
+	if len(d.sent) != 1 {
+		t.Fatalf("expected expired keys to be dropped, got %v", d.sent)
+	}
+}
+
+func TestDispatcherPublishToNamedNotifiers(t *testing.T) {
+	hits := make(chan string, 4)
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { hits <- name }
+	}
+	ops := httptest.NewServer(handler("ops"))
+	t.Cleanup(ops.Close)
+	oncall := httptest.NewServer(handler("oncall"))
+	t.Cleanup(oncall.Close)
+
+	d, err := New(&config.Config{Notifiers: []config.NotifierConfig{
+		{Name: "ops", Type: "webhook", URL: ops.URL},
+		// Explicit targeting bypasses the event filter.
+		{Name: "oncall", Type: "webhook", URL: oncall.URL, Events: []string{string(EventBudgetExceeded)}},
+	}})
+	if err != nil {
+		t.Fatalf("create dispatcher: %v", err)
+	}
+
+	d.PublishTo(Event{Type: EventAlertFiring, Key: "a"}, []string{"oncall"})
+	select {
+	case name := <-hits:
+		if name != "oncall" {
+			t.Fatalf("expected delivery to oncall, got %s", name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not delivered")
+	}
+	select {
+	case name := <-hits:
+		t.Fatalf("unexpected delivery to %s", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDispatcherOnPublishWithoutNotifiers(t *testing.T) {
+	d, err := New(&config.Config{NotifyCooldownSeconds: 60})
+	if err != nil {
+		t.Fatalf("create dispatcher: %v", err)
+	}
+	recorded := make(chan Event, 4)
+	d.OnPublish(func(event Event) { recorded <- event })
+
+	d.Publish(Event{Type: EventProviderUnhealthy, Provider: "p1"})
+	d.Publish(Event{Type: EventProviderUnhealthy, Provider: "p1"})
+	select {
+	case event := <-recorded:
+		if event.ID == "" || event.Time.IsZero() || event.Key == "" {
+			t.Fatalf("expected recorded event to be filled in, got %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not recorded")
+	}
+	select {
+	case event := <-recorded:
+		t.Fatalf("cooldown should suppress the repeat, got %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestChatNotifierPayloads(t *testing.T) {
+	bodies := make(chan map[string]any, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		bodies <- body
+		_, _ = w.Write([]byte(`{"code":0}`))
+	}))
+	t.Cleanup(server.Close)
+
+	event := Event{
+		Type:     EventBudgetExceeded,
+		Severity: SeverityWarning,
+		Time:     time.Unix(1700000000, 0),
+		Message:  "tenant team-a daily token budget exceeded (100/100)",
+		Tenant:   "team-a",
+	}
+	for _, nc := range []config.NotifierConfig{
+		{Name: "slack", Type: "slack", URL: server.URL},
+		{Name: "discord", Type: "discord", URL: server.URL},
+		{Name: "feishu", Type: "feishu", URL: server.URL, Secret: "s3cret"},
+	} {
+		notifier, err := newNotifier(nc)
+		if err != nil {
+			t.Fatalf("create %s notifier: %v", nc.Type, err)
+		}
+		if err := notifier.Notify(context.Background(), event); err != nil {
+			t.Fatalf("%s notify: %v", nc.Type, err)
+		}
+	}
+
+	slack, discord, feishu := <-bodies, <-bodies, <-bodies
+	if text, _ := slack["text"].(string); !strings.HasPrefix(text, "[WARNING] tenant team-a daily token budget exceeded") || !strings.Contains(text, "tenant: team-a") {
+		t.Fatalf("unexpected slack payload: %v", slack)
+	}
+	if content, _ := discord["content"].(string); content != slack["text"] {
+		t.Fatalf("unexpected discord payload: %v", discord)
+	}
+	if feishu["msg_type"] != "text" || feishu["timestamp"] != "1700000000" || feishu["sign"] == "" {
+		t.Fatalf("unexpected feishu payload: %v", feishu)
+	}
+}
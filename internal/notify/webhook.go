@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// webhook POSTs the event as JSON. With a secret, requests carry an
+// X-Gateway-Signature header holding "sha256=" + HMAC-SHA256(secret, timestamp + "." + body),
+// where timestamp is the X-Gateway-Timestamp header.
+type webhook struct {
+	url     string
+	secret  string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newWebhook(nc config.NotifierConfig) *webhook {
+	return &webhook{url: nc.URL, secret: nc.Secret, headers: nc.Headers, client: http.DefaultClient}
+}
+
+func (w *webhook) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gateway-Event", string(event.Type))
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	if w.secret != "" {
+		timestamp := strconv.FormatInt(event.Time.Unix(), 10)
+		req.Header.Set("X-Gateway-Timestamp", timestamp)
+		req.Header.Set("X-Gateway-Signature", "sha256="+Sign(w.secret, timestamp, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of timestamp + "." + body, the
+// signature of the webhooks the gateway sends.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,183 @@
+// Package report builds usage summaries from the usage store and delivers them
+// through the notifiers on cron schedules.
+package report
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/cron"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/notify"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// Publisher delivers report events, usually a *notify.Dispatcher.
+type Publisher interface {
+	Publish(event notify.Event)
+}
+
+type scheduledReport struct {
+	config   config.ReportConfig
+	schedule cron.Schedule
+}
+
+// Scheduler generates the configured reports when their schedules fire.
+type Scheduler struct {
+	reports   []scheduledReport
+	store     storage.Store
+	publisher Publisher
+	now       func() time.Time
+}
+
+// New prepares a scheduler for the given reports.
+func New(reports []config.ReportConfig, store storage.Store, publisher Publisher) (*Scheduler, error) {
+	s := &Scheduler{store: store, publisher: publisher, now: time.Now}
+	for _, rc := range reports {
+		schedule, err := cron.Parse(rc.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("report %s: %w", rc.Name, err)
+		}
+		s.reports = append(s.reports, scheduledReport{config: rc, schedule: schedule})
+	}
+	return s, nil
+}
+
+// Run sends each report when its schedule fires until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	if len(s.reports) == 0 {
+		return
+	}
+	now := s.now()
+	next := make([]time.Time, len(s.reports))
+	for i, r := range s.reports {
+		next[i] = r.schedule.Next(now)
+		log.Infof("usage report %s scheduled, next run at %s", r.config.Name, next[i].Format(time.RFC3339))
+	}
+
+	for {
+		earliest := time.Time{}
+		for _, t := range next {
+			if !t.IsZero() && (earliest.IsZero() || t.Before(earliest)) {
+				earliest = t
+			}
+		}
+		if earliest.IsZero() {
+			return
+		}
+
+		timer := time.NewTimer(earliest.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		now := s.now()
+		for i, r := range s.reports {
+			if next[i].IsZero() || next[i].After(now) {
+				continue
+			}
+			s.send(ctx, r.config, next[i])
+			next[i] = r.schedule.Next(now)
+		}
+	}
+}
+
+func (s *Scheduler) send(ctx context.Context, rc config.ReportConfig, end time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	event, err := s.Generate(ctx, rc, end)
+	if err != nil {
+		log.Errorf("generate usage report %s: %v", rc.Name, err)
+		return
+	}
+	s.publisher.Publish(event)
+}
+
+// Generate summarizes the usage of the report period ending at end.
+func (s *Scheduler) Generate(ctx context.Context, rc config.ReportConfig, end time.Time) (notify.Event, error) {
+	start := end.AddDate(0, 0, -1)
+	if rc.Period == "weekly" {
+		start = end.AddDate(0, 0, -7)
+	}
+	query := storage.UsageSumQuery{Since: start, Until: end, Tenant: rc.Tenant}
+
+	totals, err := s.store.SumUsage(ctx, query)
+	if err != nil {
+		return notify.Event{}, fmt.Errorf("sum usage: %w", err)
+	}
+	byModel, err := s.store.SumUsageByModel(ctx, query)
+	if err != nil {
+		return notify.Event{}, fmt.Errorf("sum usage by model: %w", err)
+	}
+
+	period := rc.Period
+	if period == "" {
+		period = "daily"
+	}
+	tokens := totals.RequestTokens + totals.ResponseTokens
+	errorRate := 0.0
+	if totals.Requests > 0 {
+		errorRate = float64(totals.Failures) / float64(totals.Requests)
+	}
+	return notify.Event{
+		Type:     notify.EventUsageReport,
+		Severity: notify.SeverityInfo,
+		Time:     end,
+		Tenant:   rc.Tenant,
+		Message:  fmt.Sprintf("%s usage report %s: %d requests, %d tokens", period, rc.Name, totals.Requests, tokens),
+		Details: map[string]any{
+			"period":            fmt.Sprintf("%s - %s", start.Format("2006-01-02 15:04"), end.Format("2006-01-02 15:04 MST")),
+			"requests":          totals.Requests,
+			"failures":          totals.Failures,
+			"error_rate":        fmt.Sprintf("%.2f%%", errorRate*100),
+			"prompt_tokens":     totals.RequestTokens,
+			"completion_tokens": totals.ResponseTokens,
+			"top_models":        topModels(byModel, rc.TopModels),
+		},
+		Key: fmt.Sprintf("%s/%s/%d", notify.EventUsageReport, rc.Name, end.Unix()),
+	}, nil
+}
+
+// topModels lists the n models with the most tokens, then the most requests.
+func topModels(byModel map[string]storage.UsageTotals, n int) string {
+	type entry struct {
+		model  string
+		totals storage.UsageTotals
+	}
+	entries := make([]entry, 0, len(byModel))
+	for model, totals := range byModel {
+		entries = append(entries, entry{model: model, totals: totals})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		ti := entries[i].totals.RequestTokens + entries[i].totals.ResponseTokens
+		tj := entries[j].totals.RequestTokens + entries[j].totals.ResponseTokens
+		if ti != tj {
+			return ti > tj
+		}
+		if entries[i].totals.Requests != entries[j].totals.Requests {
+			return entries[i].totals.Requests > entries[j].totals.Requests
+		}
+		return entries[i].model < entries[j].model
+	})
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	if len(entries) == 0 {
+		return "none"
+	}
+
+	parts := make([]string, 0, len(entries))
+	for _, e := range entries {
+		parts = append(parts, fmt.Sprintf("%s (%d requests, %d tokens)", e.model, e.totals.Requests, e.totals.RequestTokens+e.totals.ResponseTokens))
+	}
+	return strings.Join(parts, "; ")
+}
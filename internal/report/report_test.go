@@ -0,0 +1,106 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/notify"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+type recordingPublisher struct {
+	events chan notify.Event
+}
+
+func (p *recordingPublisher) Publish(event notify.Event) {
+	p.events <- event
+}
+
+func newStore(t *testing.T) storage.Store {
+	t.Helper()
+	store, err := storage.New(context.Background(), "sqlite", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "usage.db")))
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close(context.Background())
+	})
+	return store
+}
+
+func TestGenerateSummarizesPeriod(t *testing.T) {
+	store := newStore(t)
+	end := time.Date(2025, 1, 8, 9, 0, 0, 0, time.UTC)
+	for _, rec := range []storage.UsageRecord{
+		{CreatedAt: end.Add(-time.Hour), OriginalModel: "gpt-4o", Outcome: "success", RequestTokens: 100, ResponseTokens: 50},
+		{CreatedAt: end.Add(-2 * time.Hour), OriginalModel: "gpt-4o", Outcome: "success", RequestTokens: 100, ResponseTokens: 50},
+		{CreatedAt: end.Add(-3 * time.Hour), OriginalModel: "claude", Outcome: "success", RequestTokens: 10},
+		{CreatedAt: end.Add(-4 * time.Hour), OriginalModel: "claude", Outcome: "failure"},
+		{CreatedAt: end.Add(-3 * 24 * time.Hour), OriginalModel: "gemini", Outcome: "success", RequestTokens: 1000},
+	} {
+		if err := store.RecordUsage(context.Background(), rec); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+
+	reports := []config.ReportConfig{
+		{Name: "daily", Schedule: "0 9 * * *", Period: "daily", TopModels: 1},
+		{Name: "weekly", Schedule: "0 9 * * 1", Period: "weekly", TopModels: 5},
+	}
+	s, err := New(reports, store, &recordingPublisher{})
+	if err != nil {
+		t.Fatalf("create scheduler: %v", err)
+	}
+
+	daily, err := s.Generate(context.Background(), reports[0], end)
+	if err != nil {
+		t.Fatalf("generate daily report: %v", err)
+	}
+	if daily.Type != notify.EventUsageReport || daily.Details["requests"] != int64(4) || daily.Details["failures"] != int64(1) {
+		t.Fatalf("unexpected daily report: %+v", daily)
+	}
+	if daily.Details["error_rate"] != "25.00%" {
+		t.Fatalf("unexpected error rate %v", daily.Details["error_rate"])
+	}
+	if daily.Details["top_models"] != "gpt-4o (2 requests, 300 tokens)" {
+		t.Fatalf("unexpected top models %v", daily.Details["top_models"])
+	}
+
+	weekly, err := s.Generate(context.Background(), reports[1], end)
+	if err != nil {
+		t.Fatalf("generate weekly report: %v", err)
+	}
+	top, _ := weekly.Details["top_models"].(string)
+	if weekly.Details["requests"] != int64(5) || !strings.HasPrefix(top, "gemini") {
+		t.Fatalf("unexpected weekly report: %+v", weekly)
+	}
+}
+
+func TestRunPublishesWhenScheduleFires(t *testing.T) {
+	publisher := &recordingPublisher{events: make(chan notify.Event, 1)}
+	s, err := New([]config.ReportConfig{{Name: "minutely", Schedule: "* * * * *", Period: "daily"}}, newStore(t), publisher)
+	if err != nil {
+		t.Fatalf("create scheduler: %v", err)
+	}
+	// Pretend it is just before the next minute starts.
+	offset := time.Now().Truncate(time.Minute).Add(time.Minute - 50*time.Millisecond).Sub(time.Now())
+	s.now = func() time.Time { return time.Now().Add(offset) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	select {
+	case event := <-publisher.events:
+		if !strings.Contains(event.Message, "minutely") {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("report was not published")
+	}
+}
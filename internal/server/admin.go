@@ -0,0 +1,326 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mylxsw/asteria/level"
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/apierror"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/gateway"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+type logLevelResponse struct {
+	Level string `json:"level"`
+}
+
+// handleAdminLogLevel reports or switches the global log level without a restart.
+func (s *Server) handleAdminLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req logLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "decode request body: "+err.Error())
+			return
+		}
+		le, ok := parseLogLevel(req.Level)
+		if !ok {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "unsupported log level "+req.Level)
+			return
+		}
+		setAuditDiff(r, currentLogLevel(), le.GetLevelName())
+		log.All().LogLevel(le)
+		log.Infof("log level changed to %s", le.GetLevelName())
+	default:
+		methodNotAllowed(w, r, "GET, PUT")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(logLevelResponse{Level: currentLogLevel()})
+}
+
+func parseLogLevel(name string) (level.Level, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return level.Debug, true
+	case "info":
+		return level.Info, true
+	case "warn", "warning":
+		return level.Warning, true
+	case "error":
+		return level.Error, true
+	default:
+		return 0, false
+	}
+}
+
+func currentLogLevel() string {
+	switch {
+	case log.DebugEnabled():
+		return "debug"
+	case log.InfoEnabled():
+		return "info"
+	case log.WarningEnabled():
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// handleAdminInspection reports the prompt inspection counters since startup.
+func (s *Server) handleAdminInspection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	stats := s.currentGateway().InspectionStats()
+	if stats == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "prompt inspection is disabled")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stats)
+}
+
+type liveStatsResponse struct {
+	Stats []gateway.LiveStat `json:"stats"`
+}
+
+// handleAdminStats reports the traffic of each provider and provider model
+// over the last minute, from the gateway's in-memory aggregator.
+func (s *Server) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(liveStatsResponse{Stats: s.currentGateway().LiveStats()})
+}
+
+type providersResponse struct {
+	Providers []gateway.ProviderStatus `json:"providers"`
+}
+
+// handleAdminProviders reports the health and warm-up result of each provider.
+func (s *Server) handleAdminProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(providersResponse{Providers: s.currentGateway().ProviderStatuses()})
+}
+
+type backupRequest struct {
+	Name string `json:"name"`
+}
+
+type backupResponse struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// handleAdminBackup snapshots the usage database while the gateway keeps running.
+// With a "name" the snapshot is kept under backup_dir, otherwise it is streamed
+// back to the caller as a download.
+func (s *Server) handleAdminBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	backuper, ok := s.usage.(storage.Backuper)
+	if !ok {
+		apierror.Write(w, r, http.StatusNotImplemented, apierror.CodeNotSupported, "backup is not supported by the configured storage")
+		return
+	}
+
+	var req backupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "decode request body: "+err.Error())
+		return
+	}
+
+	if name := strings.TrimSpace(req.Name); name != "" {
+		name = filepath.Base(name)
+		if name == "." || name == ".." || name == string(filepath.Separator) {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid backup name")
+			return
+		}
+		dest := filepath.Join(s.config().BackupDir, name)
+		if err := backuper.Backup(r.Context(), dest); err != nil {
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "backup storage: "+err.Error())
+			return
+		}
+		var size int64
+		if info, err := os.Stat(dest); err == nil {
+			size = info.Size()
+		}
+		setAuditDiff(r, nil, map[string]any{"path": dest, "size": size})
+		log.Infof("storage backup written to %s (%d bytes)", dest, size)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(backupResponse{Path: dest, Size: size})
+		return
+	}
+
+	filename := fmt.Sprintf("usage-%s.db", time.Now().Format("20060102-150405"))
+	streamSnapshot(w, r, filename, func(dest string) error {
+		return backuper.Backup(r.Context(), dest)
+	})
+}
+
+// streamSnapshot has snapshot write into a temporary file and sends it to the
+// client as a download.
+func streamSnapshot(w http.ResponseWriter, r *http.Request, filename string, snapshot func(dest string) error) {
+	tmpDir, err := os.MkdirTemp("", "gateway-backup-*")
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "create temp directory: "+err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dest := filepath.Join(tmpDir, filename)
+	if err := snapshot(dest); err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "backup storage: "+err.Error())
+		return
+	}
+	file, err := os.Open(dest)
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "open backup: "+err.Error())
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if info, err := file.Stat(); err == nil {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size()))
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		log.Warningf("stream storage backup: %v", err)
+	}
+}
+
+type storageResponse struct {
+	storage.Stats
+	// LastCleanupAt is when the retention cleanup last ran, absent before the first run
+	LastCleanupAt *time.Time `json:"last_cleanup_at,omitempty"`
+}
+
+type vacuumResponse struct {
+	SizeBefore int64 `json:"size_before"`
+	SizeAfter  int64 `json:"size_after"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// handleAdminStorage reports the size, row counts and write backlog of the
+// usage storage.
+func (s *Server) handleAdminStorage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	reporter, ok := s.usage.(storage.StatsReporter)
+	if !ok {
+		apierror.Write(w, r, http.StatusNotImplemented, apierror.CodeNotSupported, "storage stats are not supported by the configured storage")
+		return
+	}
+	stats, err := reporter.Stats(r.Context())
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "storage stats: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(storageResponse{Stats: stats, LastCleanupAt: s.lastCleanup.Load()})
+}
+
+// handleAdminStorageVacuum rebuilds the sqlite database to reclaim the space
+// of deleted rows.
+func (s *Server) handleAdminStorageVacuum(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	vacuumer, ok := s.usage.(storage.Vacuumer)
+	if !ok {
+		apierror.Write(w, r, http.StatusNotImplemented, apierror.CodeNotSupported, storage.ErrVacuumNotSupported.Error())
+		return
+	}
+	reporter, _ := s.usage.(storage.StatsReporter)
+	size := func() int64 {
+		if reporter == nil {
+			return 0
+		}
+		stats, err := reporter.Stats(r.Context())
+		if err != nil {
+			return 0
+		}
+		return stats.SizeBytes
+	}
+
+	resp := vacuumResponse{SizeBefore: size()}
+	start := time.Now()
+	if err := vacuumer.Vacuum(r.Context()); err != nil {
+		if errors.Is(err, storage.ErrVacuumNotSupported) {
+			apierror.Write(w, r, http.StatusNotImplemented, apierror.CodeNotSupported, err.Error())
+			return
+		}
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "vacuum storage: "+err.Error())
+		return
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	resp.SizeAfter = size()
+	setAuditDiff(r, map[string]any{"size": resp.SizeBefore}, map[string]any{"size": resp.SizeAfter})
+	log.Infof("storage vacuumed in %dms: %d bytes before, %d bytes after", resp.DurationMs, resp.SizeBefore, resp.SizeAfter)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleAdminReplay sends a stored request again to the provider named by
+// ?provider=, answering with the provider's response.
+func (s *Server) handleAdminReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	providerID := strings.TrimSpace(r.URL.Query().Get("provider"))
+	if providerID == "" {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "provider is required")
+		return
+	}
+	requestID := r.PathValue("request_id")
+	entry, err := s.usage.GetRequestLog(r.Context(), requestID)
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "query request log: "+err.Error())
+		return
+	}
+	if entry == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "request not found")
+		return
+	}
+
+	err = s.currentGateway().Replay(w, r, *entry, providerID, strings.TrimSpace(r.URL.Query().Get("model")))
+	switch {
+	case err == nil:
+	case errors.Is(err, gateway.ErrUnknownProvider):
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, err.Error())
+	case errors.Is(err, gateway.ErrNotReplayable):
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+	default:
+		apierror.Write(w, r, http.StatusBadGateway, apierror.CodeNoProvider, err.Error())
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/apierror"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// maxAlertsLimit caps the number of alerts returned by a single query.
+const maxAlertsLimit = 1000
+
+type alertsResponse struct {
+	Data []storage.AlertRecord `json:"data"`
+}
+
+// handleAdminAlerts lists the alert history, newest first. Supported filters:
+// since and until (RFC3339), type, severity, provider, tenant and limit.
+func (s *Server) handleAdminAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	alertStore, ok := s.usage.(storage.AlertStore)
+	if !ok {
+		apierror.Write(w, r, http.StatusNotImplemented, apierror.CodeNotSupported, "alert history is not supported by the configured storage")
+		return
+	}
+
+	params := r.URL.Query()
+	query := storage.AlertQuery{
+		Type:     strings.TrimSpace(params.Get("type")),
+		Severity: strings.TrimSpace(params.Get("severity")),
+		Provider: strings.TrimSpace(params.Get("provider")),
+		Tenant:   strings.TrimSpace(params.Get("tenant")),
+		Limit:    100,
+	}
+	for _, f := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &query.Since}, {"until", &query.Until}} {
+		value := strings.TrimSpace(params.Get(f.name))
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid "+f.name+": expected RFC3339 time")
+			return
+		}
+		*f.dst = parsed
+	}
+	if l := params.Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid limit")
+			return
+		}
+		query.Limit = min(parsed, maxAlertsLimit)
+	}
+	// Tenant keys can only see their own alerts; global keys may filter by tenant.
+	if identity, ok := internalmw.IdentityFromContext(r.Context()); ok && identity.Tenant != "" {
+		query.Tenant = identity.Tenant
+	}
+
+	alerts, err := alertStore.QueryAlerts(r.Context(), query)
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "query alerts: "+err.Error())
+		return
+	}
+	if alerts == nil {
+		alerts = []storage.AlertRecord{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(alertsResponse{Data: alerts})
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/apierror"
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// maxAuditLimit caps the number of audit records returned by a single query.
+const maxAuditLimit = 1000
+
+type auditResponse struct {
+	Data []storage.AuditRecord `json:"data"`
+}
+
+type auditContextKey struct{}
+
+// auditMiddleware records every state changing call to the admin API, with the
+// diff the handler attached through setAuditDiff.
+func (s *Server) auditMiddleware(next http.Handler) http.Handler {
+	auditStore, ok := s.usage.(storage.AuditStore)
+	if !ok {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/admin/") || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		record := &storage.AuditRecord{CreatedAt: time.Now(), Method: r.Method, Path: r.URL.Path}
+		if identity, ok := internalmw.IdentityFromContext(r.Context()); ok {
+			record.Actor = maskKey(identity.Key)
+			record.Tenant = identity.Tenant
+		}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), auditContextKey{}, record)))
+		record.Status = sw.status
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+		defer cancel()
+		if err := auditStore.RecordAudit(ctx, *record); err != nil {
+			log.Warningf("record audit log: %v", err)
+		}
+	})
+}
+
+// setAuditDiff attaches the state before and after an admin action to its
+// audit record. Either side may be nil.
+func setAuditDiff(r *http.Request, before, after any) {
+	record, ok := r.Context().Value(auditContextKey{}).(*storage.AuditRecord)
+	if !ok {
+		return
+	}
+	record.Diff = map[string]any{}
+	if before != nil {
+		record.Diff["before"] = before
+	}
+	if after != nil {
+		record.Diff["after"] = after
+	}
+}
+
+// handleAdminAudit lists the audit log, newest first. Supported filters:
+// since and until (RFC3339), actor (masked key), path prefix and limit.
+func (s *Server) handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	auditStore, ok := s.usage.(storage.AuditStore)
+	if !ok {
+		apierror.Write(w, r, http.StatusNotImplemented, apierror.CodeNotSupported, "audit log is not supported by the configured storage")
+		return
+	}
+
+	params := r.URL.Query()
+	query := storage.AuditQuery{
+		Actor: strings.TrimSpace(params.Get("actor")),
+		Path:  strings.TrimSpace(params.Get("path")),
+		Limit: 100,
+	}
+	for _, f := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &query.Since}, {"until", &query.Until}} {
+		value := strings.TrimSpace(params.Get(f.name))
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid "+f.name+": expected RFC3339 time")
+			return
+		}
+		*f.dst = parsed
+	}
+	if l := params.Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid limit")
+			return
+		}
+		query.Limit = min(parsed, maxAuditLimit)
+	}
+
+	records, err := auditStore.QueryAudit(r.Context(), query)
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "query audit log: "+err.Error())
+		return
+	}
+	if records == nil {
+		records = []storage.AuditRecord{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(auditResponse{Data: records})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// maskKey keeps API keys out of the audit log while leaving them distinguishable.
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminAuditRecordsAdminActions(t *testing.T) {
+	handler := newTestServer(t, "https://p1.example.com/v1", "").buildHandler()
+
+	started := time.Now().Add(-time.Second)
+	rec := serve(handler, http.MethodPost, "/admin/tenants", "sk-admin-key", `{"id":"team-x"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var tenant createTenantResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &tenant); err != nil {
+		t.Fatalf("decode tenant: %v", err)
+	}
+	// Reads are not audited.
+	serve(handler, http.MethodGet, "/admin/providers", "sk-admin-key", "")
+
+	rec = serve(handler, http.MethodGet, "/admin/audit", "sk-admin-key", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp auditResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode audit log: %v", err)
+	}
+	if len(resp.Data) != 1 {
+		t.Fatalf("expected one audit record, got %+v", resp.Data)
+	}
+	record := resp.Data[0]
+	if record.Actor != maskKey("sk-admin-key") || record.Method != http.MethodPost || record.Path != "/admin/tenants" || record.Status != http.StatusCreated {
+		t.Fatalf("unexpected audit record %+v", record)
+	}
+	if record.CreatedAt.Before(started) || record.CreatedAt.After(time.Now()) {
+		t.Fatalf("unexpected audit time %s", record.CreatedAt)
+	}
+	if record.Diff["after"] == nil || strings.Contains(rec.Body.String(), tenant.APIKey) {
+		t.Fatalf("expected a diff without the issued key, got %+v", record.Diff)
+	}
+}
+
+func TestAdminAuditRequiresAdmin(t *testing.T) {
+	handler := newTestServer(t, "https://p1.example.com/v1", "").buildHandler()
+
+	rec := serve(handler, http.MethodPost, "/admin/tenants", "sk-admin-key", `{"id":"team-x"}`)
+	var tenant createTenantResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &tenant); err != nil {
+		t.Fatalf("decode tenant: %v", err)
+	}
+	for _, key := range []string{"sk-client-key", tenant.APIKey} {
+		if rec := serve(handler, http.MethodGet, "/admin/audit", key, ""); rec.Code != http.StatusForbidden {
+			t.Errorf("expected key %s to be forbidden, got %d", maskKey(key), rec.Code)
+		}
+	}
+	if rec := serve(handler, http.MethodGet, "/admin/audit", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected a missing key to be rejected, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/apierror"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/gateway"
+)
+
+type configDiffResponse struct {
+	Path    string             `json:"path"`
+	Changed bool               `json:"changed"`
+	Diff    gateway.ConfigDiff `json:"diff"`
+	Summary []string           `json:"summary"`
+}
+
+// SetConfigPath sets the file the running configuration was loaded from, so
+// changes to it can be previewed and reloaded.
+func (s *Server) SetConfigPath(path string) {
+	s.configPath = path
+}
+
+// diffConfigFile loads and validates the configuration file and compares its
+// routing behavior with the running configuration.
+func (s *Server) diffConfigFile() (gateway.ConfigDiff, error) {
+	if s.configPath == "" {
+		return gateway.ConfigDiff{}, errors.New("configuration file path is unknown")
+	}
+	next, err := config.Load(s.configPath)
+	if err != nil {
+		return gateway.ConfigDiff{}, err
+	}
+	if _, err := gateway.New(next, nil); err != nil {
+		return gateway.ConfigDiff{}, err
+	}
+	return gateway.DiffConfig(s.config(), next), nil
+}
+
+// handleAdminConfigDiff previews the routing changes the configuration file
+// would apply when reloaded.
+func (s *Server) handleAdminConfigDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	diff, err := s.diffConfigFile()
+	if err != nil {
+		apierror.Write(w, r, http.StatusUnprocessableEntity, apierror.CodeInvalidRequest, "invalid configuration: "+err.Error())
+		return
+	}
+
+	summary := diff.Lines()
+	if summary == nil {
+		summary = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(configDiffResponse{Path: s.configPath, Changed: !diff.Empty(), Diff: diff, Summary: summary})
+}
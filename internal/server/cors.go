@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// corsMiddleware applies the cross-origin policy. It runs before
+// authentication: browsers send preflight requests without credentials, and
+// rejected requests must still carry the headers for the client to read the
+// error.
+func corsMiddleware(cors *config.CORSConfig) func(http.Handler) http.Handler {
+	methods := strings.Join(cors.AllowedMethods, ", ")
+	headers := strings.Join(cors.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(cors.MaxAgeSeconds)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+			if !cors.AllowsOrigin(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+
+			if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// Preflight request
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				w.Header().Set("Access-Control-Allow-Headers", requested)
+			}
+			w.Header().Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// answerOptionsOrHead answers OPTIONS and HEAD requests to a proxy route,
+// which accepts the allowed method, with the methods it supports. It reports
+// whether the request was answered.
+func answerOptionsOrHead(w http.ResponseWriter, r *http.Request, allowed string) bool {
+	if r.Method != http.MethodOptions && r.Method != http.MethodHead {
+		return false
+	}
+	w.Header().Set("Allow", allowed+", HEAD, OPTIONS")
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+const corsConfig = `
+cors:
+  allowed_origins:
+    - https://app.example.com
+  allowed_headers:
+    - Authorization
+    - Content-Type
+`
+
+func TestCORSPreflightFromAllowedOrigin(t *testing.T) {
+	handler := newTestServer(t, "https://p1.example.com/v1", corsConfig).buildHandler()
+
+	req := httptest.NewRequest(http.MethodOptions, "/v1/chat/completions", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, POST, HEAD, OPTIONS",
+		"Access-Control-Allow-Headers": "Authorization, Content-Type",
+		"Access-Control-Max-Age":       "600",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCORSIgnoresDisallowedOrigin(t *testing.T) {
+	handler := newTestServer(t, "https://p1.example.com/v1", corsConfig).buildHandler()
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("a disallowed origin must not be allowed, got %q", got)
+	}
+	if !slices.Contains(rec.Header().Values("Vary"), "Origin") {
+		t.Fatalf("expected Vary: Origin, got %v", rec.Header().Values("Vary"))
+	}
+}
+
+func TestCORSSimpleRequestExposesRequestID(t *testing.T) {
+	handler := newTestServer(t, "https://p1.example.com/v1", corsConfig).buildHandler()
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Fatalf("expected the origin to be allowed, got %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-ID" {
+		t.Fatalf("expected X-Request-ID to be exposed, got %q", got)
+	}
+}
+
+func TestProxyRoutesAnswerOptionsAndHead(t *testing.T) {
+	// Without cors the proxy routes still list their methods.
+	handler := newTestServer(t, "https://p1.example.com/v1", "").buildHandler()
+
+	cases := []struct {
+		method, path, key string
+		status            int
+		allow             string
+	}{
+		{http.MethodOptions, "/v1/chat/completions", "", http.StatusNoContent, "POST, HEAD, OPTIONS"},
+		{http.MethodHead, "/v1/messages", "sk-client-key", http.StatusNoContent, "POST, HEAD, OPTIONS"},
+		{http.MethodOptions, "/v1/models", "", http.StatusNoContent, "GET, HEAD, OPTIONS"},
+		{http.MethodHead, "/v1/models", "sk-client-key", http.StatusOK, ""},
+	}
+	for _, c := range cases {
+		rec := serve(handler, c.method, c.path, c.key, "")
+		if rec.Code != c.status || rec.Header().Get("Allow") != c.allow {
+			t.Errorf("%s %s: got %d with Allow %q, want %d with %q", c.method, c.path, rec.Code, rec.Header().Get("Allow"), c.status, c.allow)
+		}
+	}
+}
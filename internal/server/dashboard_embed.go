@@ -10,6 +10,8 @@ import (
 	"strings"
 
 	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/apierror"
 )
 
 //go:embed dashboard/dist
@@ -69,7 +71,7 @@ func newDashboardHandler() http.Handler {
 func serveDashboardIndex(w http.ResponseWriter, r *http.Request, sub fs.FS) {
 	data, err := fs.ReadFile(sub, "index.html")
 	if err != nil {
-		http.Error(w, "dashboard not available", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "dashboard not available")
 		return
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+)
+
+// eventsKeepAlive is the interval of the comments that keep idle event
+// streams open through proxies.
+const eventsKeepAlive = 15 * time.Second
+
+// handleUsageEvents streams usage records as server-sent "usage" events while
+// requests complete. Supported filters: model, provider and tenant. Tenant
+// keys only receive their own tenant's records.
+func (s *Server) handleUsageEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	params := r.URL.Query()
+	model := strings.TrimSpace(params.Get("model"))
+	provider := strings.TrimSpace(params.Get("provider"))
+	tenant := strings.TrimSpace(params.Get("tenant"))
+	if identity, ok := internalmw.IdentityFromContext(r.Context()); ok && identity.Tenant != "" {
+		tenant = identity.Tenant
+	}
+
+	records, unsubscribe := s.currentGateway().SubscribeUsage()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.shutdown:
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case record := <-records:
+			if (model != "" && record.OriginalModel != model && record.Model != model) ||
+				(provider != "" && record.Provider != provider) ||
+				(tenant != "" && record.Tenant != tenant) {
+				continue
+			}
+			data, err := json.Marshal(record)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: usage\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+)
+
+// runHeartbeat pings the heartbeat URL on startup, on every interval while the
+// gateway is ready and once more on shutdown. Skipping pings while the gateway
+// is not ready lets the external monitor raise the alarm. The X-Gateway-Heartbeat
+// header tells the pings apart: start, alive or shutdown.
+func (s *Server) runHeartbeat(ctx context.Context) {
+	interval := time.Duration(s.config().HeartbeatIntervalSeconds) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Infof("heartbeat started: interval=%ds", s.config().HeartbeatIntervalSeconds)
+	s.sendHeartbeat(ctx, "start")
+	for {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			s.sendHeartbeat(shutdownCtx, "shutdown")
+			cancel()
+			return
+		case <-ticker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			if err := s.ready(checkCtx); err != nil {
+				log.Warningf("heartbeat skipped, gateway not ready: %v", err)
+			} else {
+				s.sendHeartbeat(checkCtx, "alive")
+			}
+			cancel()
+		}
+	}
+}
+
+func (s *Server) sendHeartbeat(ctx context.Context, kind string) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := pingHeartbeat(ctx, s.config().HeartbeatURL, kind); err != nil {
+		log.Warningf("send %s heartbeat: %v", kind, err)
+	}
+}
+
+func pingHeartbeat(ctx context.Context, url, kind string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("X-Gateway-Heartbeat", kind)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("heartbeat url returned status %d", resp.StatusCode)
+	}
+	return nil
+}
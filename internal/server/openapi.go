@@ -0,0 +1,375 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/gateway"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/version"
+)
+
+// proxyRequest is the part of an OpenAI or Anthropic request body the gateway
+// routes on. The other fields are forwarded to the provider unchanged.
+type proxyRequest struct {
+	// Model is a configured model, alias or group; the provider is picked by its routing rules
+	Model  string `json:"model"`
+	Stream bool   `json:"stream,omitempty"`
+}
+
+// apiOperation is an endpoint of the gateway as described in /openapi.json.
+type apiOperation struct {
+	method  string
+	path    string
+	tag     string
+	summary string
+	params  []apiParam
+	// body and response are values whose types are the JSON request and
+	// response bodies; nil when there is none
+	body     any
+	response any
+	// media are the other content types of the success response
+	media  []string
+	status int
+	// public operations are served without an API key
+	public bool
+}
+
+type apiParam struct {
+	name        string
+	in          string
+	description string
+	required    bool
+	// kind is the JSON type of the value; defaults to string
+	kind string
+}
+
+func queryParam(name, description string) apiParam {
+	return apiParam{name: name, in: "query", description: description}
+}
+
+// apiOperations lists the endpoints registered by buildHandler.
+func (s *Server) apiOperations() []apiOperation {
+	ops := []apiOperation{
+		{method: http.MethodGet, path: "/healthz", tag: "health", summary: "Liveness probe", media: []string{"text/plain"}, public: true},
+		{method: http.MethodGet, path: "/readyz", tag: "health", summary: "Readiness probe: storage and, optionally, a provider are reachable", media: []string{"text/plain"}, public: true},
+		{method: http.MethodGet, path: "/version", tag: "health", summary: "Build information", response: version.Info{}, public: true},
+		{method: http.MethodGet, path: "/openapi.json", tag: "health", summary: "This OpenAPI document", response: map[string]any{}, public: true},
+
+		{method: http.MethodPost, path: "/v1/chat/completions", tag: "proxy", summary: "OpenAI chat completions, routed to the cheapest matching provider",
+			body: proxyRequest{}, response: map[string]any{}, media: []string{"text/event-stream"}},
+		{method: http.MethodPost, path: "/v1/responses", tag: "proxy", summary: "OpenAI responses, routed to the cheapest matching provider",
+			body: proxyRequest{}, response: map[string]any{}, media: []string{"text/event-stream"}},
+		{method: http.MethodPost, path: "/v1/messages", tag: "proxy", summary: "Anthropic messages, routed to the cheapest matching provider",
+			body: proxyRequest{}, response: map[string]any{}, media: []string{"text/event-stream"}},
+		{method: http.MethodGet, path: "/v1/models", tag: "proxy", summary: "Models, aliases and groups served by the gateway", response: gateway.ModelListResponse{}},
+
+		{method: http.MethodGet, path: "/admin/loglevel", tag: "admin", summary: "Current log level", response: logLevelResponse{}},
+		{method: http.MethodPut, path: "/admin/loglevel", tag: "admin", summary: "Switch the log level: debug, info, warn or error", body: logLevelRequest{}, response: logLevelResponse{}},
+		{method: http.MethodGet, path: "/admin/inspection", tag: "admin", summary: "Prompt inspection counters since startup", response: gateway.InspectionStats{}},
+		{method: http.MethodGet, path: "/admin/stats", tag: "admin", summary: "Request counts, error rate, throughput and latency of each provider and model over the last minute", response: liveStatsResponse{}},
+		{method: http.MethodGet, path: "/admin/providers", tag: "admin", summary: "Health and startup warm-up result of each provider", response: providersResponse{}},
+		{method: http.MethodGet, path: "/admin/config/diff", tag: "admin", summary: "Routing changes the configuration file would apply when reloaded", response: configDiffResponse{}},
+		{method: http.MethodPost, path: "/admin/config/reload", tag: "admin", summary: "Reload the configuration file and return the routing changes applied", response: configDiffResponse{}},
+		{method: http.MethodGet, path: "/admin/state", tag: "admin", summary: "Export the effective configuration and the onboarded tenants", response: stateSnapshot{}},
+		{method: http.MethodPost, path: "/admin/state", tag: "admin", summary: "Import the tenants of a state snapshot",
+			params: []apiParam{{name: "dry_run", in: "query", description: "Report what would be imported without importing it", kind: "boolean"}}, body: stateSnapshot{}, response: importStateResponse{}},
+		{method: http.MethodPost, path: "/admin/route/preview", tag: "admin", summary: "Rule and provider order a request body would be routed with, without sending it",
+			params: []apiParam{queryParam("path", "Endpoint the body is meant for; defaults to /v1/chat/completions")}, body: proxyRequest{}, response: gateway.RoutePlan{}},
+	}
+	if !s.config().SaveUsage || s.usage == nil {
+		return ops
+	}
+
+	since := queryParam("since", "Oldest record, RFC3339")
+	until := queryParam("until", "Newest record, RFC3339")
+	limit := apiParam{name: "limit", in: "query", description: "Maximum number of records", kind: "integer"}
+	tenantID := apiParam{name: "id", in: "path", description: "Tenant id", required: true}
+	return append(ops,
+		apiOperation{method: http.MethodGet, path: "/usage", tag: "usage", summary: "Latest usage records",
+			params: []apiParam{limit, queryParam("request_id", "Records of one request"), queryParam("tenant", "Records of one tenant"),
+				queryParam("key_id", "Records of one API key, by its digest"), queryParam("key_name", "Records of one named API key"), queryParam("since", "Records created at or after this RFC 3339 time")}, response: usageResponse{}},
+		apiOperation{method: http.MethodGet, path: "/usage/request_detail", tag: "usage", summary: "Stored request log of a request",
+			params: []apiParam{{name: "request_id", in: "query", required: true}}, response: storage.RequestLog{}},
+		apiOperation{method: http.MethodGet, path: "/usage/session", tag: "usage", summary: "Tokens, cost and provider mix of a session",
+			params: []apiParam{{name: "session_id", in: "query", required: true}, queryParam("tenant", "Records of one tenant")}, response: gateway.SessionUsage{}},
+		apiOperation{method: http.MethodGet, path: "/usage/events", tag: "usage", summary: "Server-sent usage events, one per completed request",
+			params: []apiParam{queryParam("model", ""), queryParam("provider", ""), queryParam("tenant", "")}, media: []string{"text/event-stream"}},
+		apiOperation{method: http.MethodPost, path: "/admin/backup", tag: "admin", summary: "Snapshot the usage database, kept under backup_dir when named or downloaded otherwise",
+			body: backupRequest{}, response: backupResponse{}, media: []string{"application/octet-stream"}},
+		apiOperation{method: http.MethodGet, path: "/admin/storage", tag: "admin", summary: "Storage size, row counts, write backlog and last cleanup time",
+			response: storageResponse{}},
+		apiOperation{method: http.MethodPost, path: "/admin/storage/vacuum", tag: "admin", summary: "Vacuum the sqlite database to reclaim the space of deleted rows",
+			response: vacuumResponse{}},
+		apiOperation{method: http.MethodPost, path: "/admin/replay/{request_id}", tag: "admin", summary: "Send a stored request again to one provider and return its response, not recorded as usage",
+			params: []apiParam{{name: "request_id", in: "path", required: true}, {name: "provider", in: "query", required: true}, queryParam("model", "Provider model, by default the one configured for the provider")},
+			media:  []string{"application/json", "text/event-stream"}},
+		apiOperation{method: http.MethodGet, path: "/admin/alerts", tag: "admin", summary: "Alert history, newest first",
+			params: []apiParam{since, until, queryParam("type", ""), queryParam("severity", ""), queryParam("provider", ""), queryParam("tenant", ""), limit}, response: alertsResponse{}},
+		apiOperation{method: http.MethodGet, path: "/admin/audit", tag: "admin", summary: "Audit log of admin actions, newest first",
+			params: []apiParam{since, until, queryParam("actor", "Masked API key"), queryParam("path", "Path prefix"), limit}, response: auditResponse{}},
+		apiOperation{method: http.MethodPost, path: "/admin/tenants", tag: "admin", summary: "Onboard a tenant and generate its first API key",
+			body: createTenantRequest{}, response: createTenantResponse{}, status: http.StatusCreated},
+		apiOperation{method: http.MethodGet, path: "/admin/tenants/{id}/export", tag: "admin", summary: "Download the usage data of a tenant",
+			params: []apiParam{tenantID}, media: []string{"application/octet-stream"}},
+		apiOperation{method: http.MethodDelete, path: "/admin/tenants/{id}/data", tag: "admin", summary: "Delete the usage data of a tenant",
+			params: []apiParam{tenantID}, status: http.StatusNoContent},
+	)
+}
+
+// openAPIDocument describes the endpoints of the gateway, with the schemas of
+// the bodies derived from the Go types through their json tags.
+func (s *Server) openAPIDocument() map[string]any {
+	schemas := newSchemaRegistry()
+	paths := map[string]any{}
+	for _, op := range s.apiOperations() {
+		item, ok := paths[op.path].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = op.document(schemas)
+	}
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":       "OpenAI Cost Optimal Gateway",
+			"version":     version.Version,
+			"description": "OpenAI and Anthropic compatible gateway routing each request to the cheapest suitable provider.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+				"apiKey":     map[string]any{"type": "apiKey", "in": "header", "name": "x-api-key"},
+			},
+		},
+		"security": []any{map[string]any{"bearerAuth": []string{}}, map[string]any{"apiKey": []string{}}},
+	}
+}
+
+func (op apiOperation) document(schemas *schemaRegistry) map[string]any {
+	doc := map[string]any{
+		"summary":     op.summary,
+		"tags":        []string{op.tag},
+		"operationId": operationID(op.method, op.path),
+	}
+	if op.public {
+		doc["security"] = []any{}
+	}
+	if len(op.params) > 0 {
+		params := make([]any, 0, len(op.params))
+		for _, p := range op.params {
+			kind := p.kind
+			if kind == "" {
+				kind = "string"
+			}
+			param := map[string]any{"name": p.name, "in": p.in, "required": p.required, "schema": map[string]any{"type": kind}}
+			if p.description != "" {
+				param["description"] = p.description
+			}
+			params = append(params, param)
+		}
+		doc["parameters"] = params
+	}
+	if op.body != nil {
+		doc["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": schemas.schema(reflect.TypeOf(op.body))}},
+		}
+	}
+
+	success := map[string]any{"description": http.StatusText(op.statusCode())}
+	content := map[string]any{}
+	if op.response != nil {
+		content["application/json"] = map[string]any{"schema": schemas.schema(reflect.TypeOf(op.response))}
+	}
+	for _, media := range op.media {
+		content[media] = map[string]any{"schema": map[string]any{"type": "string"}}
+	}
+	if len(content) > 0 {
+		success["content"] = content
+	}
+	doc["responses"] = map[string]any{
+		strconv.Itoa(op.statusCode()): success,
+		"default": map[string]any{
+			"description": "Error",
+			"content":     map[string]any{"application/json": map[string]any{"schema": errorSchema}},
+		},
+	}
+	return doc
+}
+
+// errorSchema describes the errors of the gateway: OpenAI errors, or Anthropic
+// errors with a top-level type of "error" and no code on /v1/messages.
+var errorSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"type": map[string]any{"type": "string"},
+		"error": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"message": map[string]any{"type": "string"},
+				"type":    map[string]any{"type": "string"},
+				"code":    map[string]any{"type": "string", "nullable": true},
+			},
+			"required": []string{"message", "type"},
+		},
+	},
+	"required": []string{"error"},
+}
+
+func (op apiOperation) statusCode() int {
+	if op.status == 0 {
+		return http.StatusOK
+	}
+	return op.status
+}
+
+// operationID derives an identifier from the method and path, e.g.
+// getAdminTenantsIdExport.
+func operationID(method, route string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, word := range strings.FieldsFunc(route, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		b.WriteString(exportedName(word))
+	}
+	return b.String()
+}
+
+// handleOpenAPI serves the OpenAPI document of the gateway.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.openAPIDocument())
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// schemaRegistry derives JSON schemas from Go types the way encoding/json
+// encodes them. Named structs become components referenced by name.
+type schemaRegistry struct {
+	schemas map[string]any
+	names   map[reflect.Type]string
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{schemas: map[string]any{}, names: map[reflect.Type]string{}}
+}
+
+func (r *schemaRegistry) schema(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]any{"type": "integer", "description": "nanoseconds"}
+	case rawMessageType:
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return r.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": r.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": r.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.object(t)
+		}
+		name, ok := r.names[t]
+		if !ok {
+			name = r.componentName(t)
+			r.names[t] = name
+			// Registered before the properties so recursive types terminate.
+			r.schemas[name] = map[string]any{}
+			r.schemas[name] = r.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]any{}
+	}
+}
+
+// object is the schema of the fields of a struct, with the fields of embedded
+// structs promoted as encoding/json does.
+func (r *schemaRegistry) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	r.addFields(t, properties)
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+func (r *schemaRegistry) addFields(t reflect.Type, properties map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				r.addFields(embedded, properties)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, exists := properties[name]; !exists {
+			properties[name] = r.schema(field.Type)
+		}
+	}
+}
+
+// componentName is the exported type name, qualified with its package when
+// another type already uses it.
+func (r *schemaRegistry) componentName(t reflect.Type) string {
+	name := exportedName(t.Name())
+	if _, taken := r.schemas[name]; taken {
+		name = exportedName(path.Base(t.PkgPath())) + name
+	}
+	return name
+}
+
+func exportedName(name string) string {
+	if name == "" {
+		return name
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
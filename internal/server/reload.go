@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/apierror"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/gateway"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// gatewayJobs are the background jobs of the serving gateway. A reload stops
+// them and starts those of the new gateway.
+type gatewayJobs struct {
+	parent context.Context
+	cancel context.CancelFunc
+	// flushed waits for the jobs that deliver what they queued when stopped
+	flushed sync.WaitGroup
+}
+
+func startGatewayJobs(parent context.Context, gw *gateway.Gateway, cfg *config.Config) *gatewayJobs {
+	ctx, cancel := context.WithCancel(parent)
+	jobs := &gatewayJobs{parent: parent, cancel: cancel}
+
+	go gw.Warmup(ctx)
+	go gw.RunAnomalyDetection(ctx)
+	go gw.RunAlerts(ctx)
+	go gw.RunModelDiscovery(ctx)
+	go gw.RunPricingSync(ctx)
+	go gw.RunProviderEviction(ctx)
+	go gw.RunHealthChecks(ctx)
+	if cfg.Exporters != nil {
+		jobs.flushed.Add(1)
+		go func() {
+			defer jobs.flushed.Done()
+			gw.RunExporters(ctx)
+		}()
+	}
+	if cfg.MetricsPush != nil {
+		jobs.flushed.Add(1)
+		go func() {
+			defer jobs.flushed.Done()
+			gw.RunMetricsPush(ctx)
+		}()
+	}
+	return jobs
+}
+
+// stop stops the jobs and waits until the queued traces and metrics are sent.
+func (j *gatewayJobs) stop() {
+	j.cancel()
+	j.flushed.Wait()
+}
+
+// restartOnlyChanges names the changed settings that are only read at startup.
+func restartOnlyChanges(prev, next *config.Config) []string {
+	settings := []struct {
+		name       string
+		prev, next any
+	}{
+		{"listen", prev.Listen, next.Listen},
+		{"tls", prev.TLS, next.TLS},
+		{"cors", prev.CORS, next.CORS},
+		{"save_usage", prev.SaveUsage, next.SaveUsage},
+		{"storage_type", prev.StorageType, next.StorageType},
+		{"storage_uri", prev.StorageURI, next.StorageURI},
+		{"storage_partition_by_tenant", prev.StoragePartitionByTenant, next.StoragePartitionByTenant},
+		{"sqlite", prev.SQLite, next.SQLite},
+		{"request_log_encryption", prev.RequestLogEncryption, next.RequestLogEncryption},
+		{"cleanup_enabled", prev.CleanupEnabled, next.CleanupEnabled},
+		{"reports", prev.Reports, next.Reports},
+		{"heartbeat_url", prev.HeartbeatURL, next.HeartbeatURL},
+		{"config_watch_interval_seconds", prev.ConfigWatchIntervalSeconds, next.ConfigWatchIntervalSeconds},
+	}
+	var changed []string
+	for _, setting := range settings {
+		if !reflect.DeepEqual(setting.prev, setting.next) {
+			changed = append(changed, setting.name)
+		}
+	}
+	return changed
+}
+
+// reloadConfig loads the configuration file again and, when it is valid,
+// swaps in a gateway compiled from it. Requests in flight finish on the
+// previous gateway. It returns the routing changes it applied.
+func (s *Server) reloadConfig(ctx context.Context) (gateway.ConfigDiff, error) {
+	if s.configPath == "" {
+		return gateway.ConfigDiff{}, errors.New("configuration file path is unknown")
+	}
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	next, err := config.Load(s.configPath)
+	if err != nil {
+		return gateway.ConfigDiff{}, err
+	}
+	// No tenant may be onboarded between reading the stored tenants and the swap.
+	s.tenantMu.Lock()
+	defer s.tenantMu.Unlock()
+	return s.applyConfigLocked(ctx, next)
+}
+
+// applyConfigLocked adds the stored tenants to next and swaps in a gateway
+// compiled from it. The caller holds reloadMu and tenantMu.
+func (s *Server) applyConfigLocked(ctx context.Context, next *config.Config) (gateway.ConfigDiff, error) {
+	if s.usage != nil {
+		if err := LoadStoredTenants(ctx, next, s.usage); err != nil {
+			return gateway.ConfigDiff{}, err
+		}
+	}
+	gw, err := s.currentGateway().Reload(next)
+	if err != nil {
+		return gateway.ConfigDiff{}, err
+	}
+
+	prev := s.config()
+	for _, name := range restartOnlyChanges(prev, next) {
+		log.Warningf("config reload: %s changed, restart the gateway to apply it", name)
+	}
+	s.cfg.Store(next)
+	s.gateway.Store(gw)
+	s.auth.Reload(next)
+	if s.jobs != nil {
+		s.jobs.stop()
+		s.jobs = startGatewayJobs(s.jobs.parent, gw, next)
+	}
+	return gateway.DiffConfig(prev, next), nil
+}
+
+// reloadAndLog reloads the configuration and logs the routing changes, or
+// why the running configuration was kept. The reload is written to the audit
+// log with actor as its actor.
+func (s *Server) reloadAndLog(ctx context.Context, trigger, actor string) {
+	diff, err := s.reloadConfig(ctx)
+	if err != nil {
+		log.Errorf("%s: configuration %s is invalid, keeping the running one: %v", trigger, s.configPath, err)
+		s.auditReload(ctx, actor, http.StatusUnprocessableEntity, nil)
+		return
+	}
+	s.auditReload(ctx, actor, http.StatusOK, reloadAuditDiff(s.configPath, diff))
+	if diff.Empty() {
+		log.Infof("%s: configuration %s reloaded without routing changes", trigger, s.configPath)
+		return
+	}
+	for _, line := range diff.Lines() {
+		log.Infof("%s: applied config change: %s", trigger, line)
+	}
+}
+
+// auditReload records a reload that did not come through the admin API, so
+// the audit log covers every configuration change.
+func (s *Server) auditReload(ctx context.Context, actor string, status int, after map[string]any) {
+	auditStore, ok := s.usage.(storage.AuditStore)
+	if !ok {
+		return
+	}
+	record := storage.AuditRecord{CreatedAt: time.Now(), Actor: actor, Path: "/admin/config/reload", Status: status}
+	if after != nil {
+		record.Diff = map[string]any{"after": after}
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := auditStore.RecordAudit(ctx, record); err != nil {
+		log.Warningf("record audit log: %v", err)
+	}
+}
+
+// reloadAuditDiff is the audited result of a reload.
+func reloadAuditDiff(path string, diff gateway.ConfigDiff) map[string]any {
+	summary := diff.Lines()
+	if summary == nil {
+		summary = []string{}
+	}
+	return map[string]any{"path": path, "config_changes": summary}
+}
+
+// reloadOnHangup reloads the configuration whenever the process receives SIGHUP.
+func (s *Server) reloadOnHangup(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			s.reloadAndLog(ctx, "SIGHUP", "signal")
+		}
+	}
+}
+
+// watchConfigFile reloads the configuration when the content of its file
+// changes, checking at every interval.
+func (s *Server) watchConfigFile(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last, _ := fileDigest(s.configPath)
+	log.Infof("config watch started: path=%s, interval=%s", s.configPath, interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		digest, err := fileDigest(s.configPath)
+		if err != nil {
+			log.Warningf("config watch: %v", err)
+			continue
+		}
+		if digest == last {
+			continue
+		}
+		last = digest
+		s.reloadAndLog(ctx, "config watch", "watch")
+	}
+}
+
+func fileDigest(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// handleAdminConfigReload reloads the configuration file and returns the
+// routing changes it applied.
+func (s *Server) handleAdminConfigReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	diff, err := s.reloadConfig(r.Context())
+	if err != nil {
+		apierror.Write(w, r, http.StatusUnprocessableEntity, apierror.CodeInvalidRequest, "invalid configuration: "+err.Error())
+		return
+	}
+	setAuditDiff(r, nil, reloadAuditDiff(s.configPath, diff))
+
+	summary := diff.Lines()
+	if summary == nil {
+		summary = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(configDiffResponse{Path: s.configPath, Changed: !diff.Empty(), Diff: diff, Summary: summary})
+}
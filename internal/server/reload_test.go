@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// auditRecords returns the audit records of actor, newest first.
+func auditRecords(t *testing.T, s *Server, actor string) []storage.AuditRecord {
+	t.Helper()
+	records, err := s.usage.(storage.AuditStore).QueryAudit(context.Background(), storage.AuditQuery{Actor: actor})
+	if err != nil {
+		t.Fatalf("query audit log: %v", err)
+	}
+	return records
+}
+
+// appendTestConfig adds settings to the configuration file of the server.
+func appendTestConfig(t *testing.T, s *Server, extra string) {
+	t.Helper()
+	data, err := os.ReadFile(s.configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestConfig(t, s.configPath, string(data)+extra)
+}
+
+const extraModel = `
+  - model: gpt-4o-mini
+    providers:
+      - provider: p1
+`
+
+func TestAdminConfigReloadSwapsConfigAndAudits(t *testing.T) {
+	s := newTestServer(t, "https://p1.example.com/v1", "")
+	handler := s.buildHandler()
+	appendTestConfig(t, s, extraModel)
+
+	rec := serve(handler, http.MethodPost, "/admin/config/reload", "sk-admin-key", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(s.config().Models) != 2 {
+		t.Fatalf("expected the reloaded models to be served, got %+v", s.config().Models)
+	}
+
+	records := auditRecords(t, s, maskKey("sk-admin-key"))
+	if len(records) != 1 || records[0].Path != "/admin/config/reload" || records[0].Status != http.StatusOK {
+		t.Fatalf("expected one audit record of the reload, got %+v", records)
+	}
+	after, _ := records[0].Diff["after"].(map[string]any)
+	if changes, _ := after["config_changes"].([]any); len(changes) == 0 {
+		t.Fatalf("expected the audit record to carry the config changes, got %+v", records[0].Diff)
+	}
+}
+
+func TestSignalReloadAudits(t *testing.T) {
+	s := newTestServer(t, "https://p1.example.com/v1", "")
+	appendTestConfig(t, s, extraModel)
+
+	s.reloadAndLog(context.Background(), "SIGHUP", "signal")
+	if len(s.config().Models) != 2 {
+		t.Fatalf("expected the reloaded models to be served, got %+v", s.config().Models)
+	}
+	records := auditRecords(t, s, "signal")
+	if len(records) != 1 || records[0].Status != http.StatusOK || records[0].Diff["after"] == nil {
+		t.Fatalf("expected one audit record of the signal reload, got %+v", records)
+	}
+}
+
+func TestFailedReloadKeepsConfigAndAudits(t *testing.T) {
+	s := newTestServer(t, "https://p1.example.com/v1", "")
+	running := s.config()
+	// A model without providers is invalid.
+	appendTestConfig(t, s, "  - model: broken\n")
+
+	s.reloadAndLog(context.Background(), "config watch", "watch")
+	if s.config() != running {
+		t.Fatal("an invalid file must keep the running configuration")
+	}
+	records := auditRecords(t, s, "watch")
+	if len(records) != 1 || records[0].Status != http.StatusUnprocessableEntity {
+		t.Fatalf("expected one audit record of the failed reload, got %+v", records)
+	}
+}
+
+func TestReloadWarmsUpProvidersAgain(t *testing.T) {
+	var warmups atomic.Int32
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		warmups.Add(1)
+		_, _ = w.Write([]byte(`{"data":[]}`))
+	}))
+	t.Cleanup(provider.Close)
+
+	s := newTestServer(t, provider.URL, "warmup:\n  mode: connect\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	s.reloadMu.Lock()
+	s.jobs = startGatewayJobs(ctx, s.currentGateway(), s.config())
+	s.reloadMu.Unlock()
+	t.Cleanup(func() { s.jobs.stop() })
+
+	waitFor := func(n int32) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); warmups.Load() < n; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d warm-ups, got %d", n, warmups.Load())
+			}
+		}
+	}
+	waitFor(1)
+
+	if _, err := s.reloadConfig(ctx); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	waitFor(2)
+}
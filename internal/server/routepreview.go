@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/apierror"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/gateway"
+)
+
+// maxRoutePreviewBody caps the request bodies accepted for a route preview.
+const maxRoutePreviewBody = 32 << 20
+
+var routePreviewTypes = map[string]gateway.RequestType{
+	"/v1/chat/completions": gateway.RequestTypeChatCompletions,
+	"/v1/responses":        gateway.RequestTypeResponses,
+	"/v1/messages":         gateway.RequestTypeAnthropicMessages,
+}
+
+// handleAdminRoutePreview reports the rule and provider order a request body
+// would be routed with, without sending it. The "path" query parameter is the
+// endpoint the body is meant for; defaults to /v1/chat/completions.
+func (s *Server) handleAdminRoutePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		path = "/v1/chat/completions"
+	}
+	reqType, ok := routePreviewTypes[path]
+	if !ok {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "unsupported path "+path)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRoutePreviewBody))
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "read request body: "+err.Error())
+		return
+	}
+
+	plan, err := s.currentGateway().DryRun(body, reqType, path)
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+	if plan.Providers == nil {
+		plan.Providers = []gateway.PlannedProvider{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(plan)
+}
@@ -3,17 +3,23 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mylxsw/asteria/log"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/apierror"
 	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
 	"github.com/mylxsw/openai-cost-optimal-gateway/internal/gateway"
 	internalmw "github.com/mylxsw/openai-cost-optimal-gateway/internal/middleware"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/report"
 	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/version"
 )
 
 // getEnv fetches environment variable value; returns empty string if not set.
@@ -27,29 +33,53 @@ func getEnv(key string) string {
 // lookupEnv allows us to patch during tests if needed.
 var lookupEnv = func(key string) (string, bool) { return os.LookupEnv(key) }
 
-const requestLogRetentionDays = 3
-
 type Server struct {
-	cfg     *config.Config
-	gateway *gateway.Gateway
+	// cfg and gateway are swapped together when the configuration is reloaded
+	cfg     atomic.Pointer[config.Config]
+	gateway atomic.Pointer[gateway.Gateway]
 	auth    *internalmw.APIKeyAuth
 	httpSrv *http.Server
 	usage   storage.Store
+	// tenantMu serializes tenant onboarding
+	tenantMu sync.Mutex
+	// reloadMu serializes configuration reloads and guards jobs
+	reloadMu sync.Mutex
+	// jobs are the background jobs of the serving gateway
+	jobs *gatewayJobs
+	// shutdown is closed when the server stops, ending long-lived event streams
+	shutdown chan struct{}
+	// configPath is the file the configuration was loaded from
+	configPath string
+	// lastCleanup is when the retention cleanup last ran
+	lastCleanup atomic.Pointer[time.Time]
 }
 
 func New(cfg *config.Config, gw *gateway.Gateway, usage storage.Store) *Server {
-	return &Server{
-		cfg:     cfg,
-		gateway: gw,
-		auth:    internalmw.NewAPIKeyAuth(cfg.APIKeys),
-		usage:   usage,
+	s := &Server{
+		auth:     internalmw.NewAPIKeyAuth(cfg),
+		usage:    usage,
+		shutdown: make(chan struct{}),
 	}
+	s.cfg.Store(cfg)
+	s.gateway.Store(gw)
+	return s
+}
+
+// config returns the running configuration.
+func (s *Server) config() *config.Config {
+	return s.cfg.Load()
+}
+
+// currentGateway returns the gateway serving new requests. Handlers load it
+// once, so a request is served by one gateway even across a reload.
+func (s *Server) currentGateway() *gateway.Gateway {
+	return s.gateway.Load()
 }
 
 func (s *Server) Run(ctx context.Context) error {
 	handler := s.buildHandler()
 	// allow PORT env var to override the listen port, common for cloud envs
-	listen := s.cfg.Listen
+	listen := s.config().Listen
 	if port := strings.TrimSpace(getEnv("PORT")); port != "" {
 		// if listen is host:port, replace port; if only port provided in env, use :PORT
 		if strings.Contains(listen, ":") {
@@ -71,11 +101,50 @@ func (s *Server) Run(ctx context.Context) error {
 		Handler:           handler,
 		ReadHeaderTimeout: 60 * time.Second,
 	}
+	tlsConfig, err := serverTLSConfig(s.config().TLS)
+	if err != nil {
+		return err
+	}
+	s.httpSrv.TLSConfig = tlsConfig
+	s.httpSrv.RegisterOnShutdown(func() { close(s.shutdown) })
 
 	// Start cleanup goroutine if usage tracking and cleanup are enabled
-	if s.cfg.SaveUsage && s.usage != nil && s.cfg.CleanupEnabled {
+	if s.config().SaveUsage && s.usage != nil && s.config().CleanupEnabled {
 		go s.startCleanupTask(ctx)
 	}
+	gw, cfg := s.currentGateway(), s.config()
+	s.reloadMu.Lock()
+	s.jobs = startGatewayJobs(ctx, gw, cfg)
+	s.reloadMu.Unlock()
+	if s.configPath != "" {
+		go s.reloadOnHangup(ctx)
+		if cfg.ConfigWatchIntervalSeconds > 0 {
+			go s.watchConfigFile(ctx, time.Duration(cfg.ConfigWatchIntervalSeconds)*time.Second)
+		}
+	}
+	if len(s.config().APIKeys) > 0 && !s.config().HasAdminKey() {
+		log.Warningf("no admin_keys entry or key with the admin role is configured, api_keys may only call the /v1 routes")
+	}
+	if len(s.config().Reports) > 0 {
+		if s.usage == nil {
+			log.Warningf("usage reports are configured but save_usage is disabled, reports will not be sent")
+		} else {
+			reports, err := report.New(s.config().Reports, s.usage, s.currentGateway().Notifier())
+			if err != nil {
+				return err
+			}
+			go reports.Run(ctx)
+		}
+	}
+
+	var heartbeatDone chan struct{}
+	if s.config().HeartbeatURL != "" {
+		heartbeatDone = make(chan struct{})
+		go func() {
+			defer close(heartbeatDone)
+			s.runHeartbeat(ctx)
+		}()
+	}
 
 	go func() {
 		<-ctx.Done()
@@ -86,9 +155,22 @@ func (s *Server) Run(ctx context.Context) error {
 		}
 	}()
 
-	log.Infof("listening on %s", listen)
-	err := s.httpSrv.ListenAndServe()
+	if tlsConfig != nil {
+		log.Infof("listening on %s (https)", listen)
+		err = s.httpSrv.ListenAndServeTLS(s.config().TLS.CertFile, s.config().TLS.KeyFile)
+	} else {
+		log.Infof("listening on %s", listen)
+		err = s.httpSrv.ListenAndServe()
+	}
 	if err == http.ErrServerClosed {
+		// Let the heartbeat report the shutdown before the process exits.
+		if heartbeatDone != nil {
+			<-heartbeatDone
+		}
+		// Send the traces still queued and push the final counts.
+		s.reloadMu.Lock()
+		s.jobs.stop()
+		s.reloadMu.Unlock()
 		return nil
 	}
 	return err
@@ -101,6 +183,9 @@ func (s *Server) buildHandler() http.Handler {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/version", s.handleVersion)
+	mux.HandleFunc("/openapi.json", s.handleOpenAPI)
 
 	// Handle common static resources
 	mux.HandleFunc("/favicon.ico", func(w http.ResponseWriter, _ *http.Request) {
@@ -117,21 +202,52 @@ func (s *Server) buildHandler() http.Handler {
 	mux.Handle("/v1/messages", http.HandlerFunc(s.handleAnthropicMessages))
 	mux.Handle("/v1/models", http.HandlerFunc(s.handleModels))
 
-	if s.cfg.SaveUsage && s.usage != nil {
+	mux.Handle("/admin/loglevel", http.HandlerFunc(s.handleAdminLogLevel))
+	mux.Handle("/admin/inspection", http.HandlerFunc(s.handleAdminInspection))
+	mux.Handle("/admin/stats", http.HandlerFunc(s.handleAdminStats))
+	mux.Handle("/admin/providers", http.HandlerFunc(s.handleAdminProviders))
+	mux.Handle("/admin/config/diff", http.HandlerFunc(s.handleAdminConfigDiff))
+	mux.Handle("/admin/config/reload", http.HandlerFunc(s.handleAdminConfigReload))
+	mux.Handle("/admin/state", http.HandlerFunc(s.handleAdminState))
+	mux.Handle("/admin/route/preview", http.HandlerFunc(s.handleAdminRoutePreview))
+
+	if s.config().SaveUsage && s.usage != nil {
 		mux.Handle("/usage", http.HandlerFunc(s.handleUsage))
 		mux.Handle("/usage/request_detail", http.HandlerFunc(s.handleRequestDetail))
+		mux.Handle("/usage/session", http.HandlerFunc(s.handleSessionUsage))
+		mux.Handle("/usage/events", http.HandlerFunc(s.handleUsageEvents))
+		mux.Handle("/admin/backup", http.HandlerFunc(s.handleAdminBackup))
+		mux.Handle("/admin/storage", http.HandlerFunc(s.handleAdminStorage))
+		mux.Handle("/admin/storage/vacuum", http.HandlerFunc(s.handleAdminStorageVacuum))
+		mux.Handle("/admin/replay/{request_id}", http.HandlerFunc(s.handleAdminReplay))
+		mux.Handle("/admin/alerts", http.HandlerFunc(s.handleAdminAlerts))
+		mux.Handle("/admin/audit", http.HandlerFunc(s.handleAdminAudit))
+		mux.Handle("/admin/tenants", http.HandlerFunc(s.handleAdminTenants))
+		mux.Handle("/admin/tenants/{id}/export", http.HandlerFunc(s.handleAdminTenantExport))
+		mux.Handle("/admin/tenants/{id}/data", http.HandlerFunc(s.handleAdminTenantData))
 		if dashboardHandler := newDashboardHandler(); dashboardHandler != nil {
 			mux.Handle("/dashboard", dashboardHandler)
 			mux.Handle("/dashboard/", dashboardHandler)
 		}
 	}
 
-	return chain(mux, s.auth.MiddlewareWithSkipper(s.shouldSkipAuth), recoverMiddleware, loggingMiddleware)
+	middlewares := []func(http.Handler) http.Handler{internalmw.RequestID, s.auth.MiddlewareWithSkipper(s.shouldSkipAuth), recoverMiddleware, versionHeaderMiddleware, loggingMiddleware, s.auditMiddleware}
+	if s.config().CORS != nil {
+		middlewares = append([]func(http.Handler) http.Handler{corsMiddleware(s.config().CORS)}, middlewares...)
+	}
+	if s.config().TLS != nil && s.config().TLS.HSTS != nil {
+		middlewares = append([]func(http.Handler) http.Handler{hstsMiddleware(s.config().TLS.HSTS)}, middlewares...)
+	}
+	return chain(mux, middlewares...)
 }
 
 func (s *Server) shouldSkipAuth(r *http.Request) bool {
+	// OPTIONS on a proxy route only lists its methods; browsers send it without credentials.
+	if r.Method == http.MethodOptions && strings.HasPrefix(r.URL.Path, "/v1/") {
+		return true
+	}
 	if r.Method == http.MethodGet {
-		if r.URL.Path == "/healthz" {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || r.URL.Path == "/version" || r.URL.Path == "/openapi.json" {
 			return true
 		}
 		if strings.HasPrefix(r.URL.Path, "/dashboard") {
@@ -153,46 +269,103 @@ func (s *Server) shouldSkipAuth(r *http.Request) bool {
 }
 
 func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if answerOptionsOrHead(w, r, http.MethodPost) {
+		return
+	}
 	if r.Method != http.MethodPost {
-		methodNotAllowed(w, http.MethodPost)
+		methodNotAllowed(w, r, http.MethodPost)
 		return
 	}
-	s.gateway.Proxy(w, r, gateway.RequestTypeChatCompletions)
+	s.currentGateway().Proxy(w, r, gateway.RequestTypeChatCompletions)
 }
 
 func (s *Server) handleResponses(w http.ResponseWriter, r *http.Request) {
+	if answerOptionsOrHead(w, r, http.MethodPost) {
+		return
+	}
 	if r.Method != http.MethodPost {
-		methodNotAllowed(w, http.MethodPost)
+		methodNotAllowed(w, r, http.MethodPost)
 		return
 	}
-	s.gateway.Proxy(w, r, gateway.RequestTypeResponses)
+	s.currentGateway().Proxy(w, r, gateway.RequestTypeResponses)
 }
 
 func (s *Server) handleAnthropicMessages(w http.ResponseWriter, r *http.Request) {
+	if answerOptionsOrHead(w, r, http.MethodPost) {
+		return
+	}
 	if r.Method != http.MethodPost {
-		methodNotAllowed(w, http.MethodPost)
+		methodNotAllowed(w, r, http.MethodPost)
 		return
 	}
-	s.gateway.Proxy(w, r, gateway.RequestTypeAnthropicMessages)
+	s.currentGateway().Proxy(w, r, gateway.RequestTypeAnthropicMessages)
 }
 
 func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		methodNotAllowed(w, http.MethodGet)
+	if r.Method == http.MethodOptions && answerOptionsOrHead(w, r, http.MethodGet) {
+		return
+	}
+	// HEAD is answered like GET; the server drops the body.
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, r, http.MethodGet)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	response := s.gateway.ModelList()
+	response := s.currentGateway().ModelList(r.Context())
 	_ = json.NewEncoder(w).Encode(response)
 }
 
+// handleReadyz reports whether the instance can serve traffic: storage must be
+// reachable when usage tracking is enabled, and optionally at least one provider
+// must respond.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := s.ready(ctx); err != nil {
+		apierror.Write(w, r, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// ready reports why the gateway cannot serve traffic, or nil when it can.
+func (s *Server) ready(ctx context.Context) error {
+	if s.config().SaveUsage && s.usage != nil {
+		if err := s.usage.Ping(ctx); err != nil {
+			log.Warningf("readiness check failed: %v", err)
+			return errors.New("storage unavailable")
+		}
+	}
+	if s.config().ReadinessCheckProviders && !s.currentGateway().HasReachableProvider(ctx) {
+		return errors.New("no reachable provider")
+	}
+	return nil
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(version.Get())
+}
+
 func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
 	if s.usage == nil {
-		http.Error(w, "usage tracking disabled", http.StatusNotFound)
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "usage tracking disabled")
 		return
 	}
 	if r.Method != http.MethodGet {
-		methodNotAllowed(w, http.MethodGet)
+		methodNotAllowed(w, r, http.MethodGet)
 		return
 	}
 
@@ -204,9 +377,29 @@ func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	requestID := strings.TrimSpace(r.URL.Query().Get("request_id"))
-	records, err := s.usage.QueryUsage(r.Context(), storage.UsageQuery{Limit: limit, RequestID: requestID})
+	tenant := strings.TrimSpace(r.URL.Query().Get("tenant"))
+	// Tenant keys can only see their own records; global keys may filter by tenant.
+	if identity, ok := internalmw.IdentityFromContext(r.Context()); ok && identity.Tenant != "" {
+		tenant = identity.Tenant
+	}
+	query := storage.UsageQuery{
+		Limit:     limit,
+		RequestID: requestID,
+		Tenant:    tenant,
+		KeyID:     strings.TrimSpace(r.URL.Query().Get("key_id")),
+		KeyName:   strings.TrimSpace(r.URL.Query().Get("key_name")),
+	}
+	if since := strings.TrimSpace(r.URL.Query().Get("since")); since != "" {
+		parsed, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "since must be an RFC 3339 time")
+			return
+		}
+		query.Since = parsed
+	}
+	records, err := s.usage.QueryUsage(r.Context(), query)
 	if err != nil {
-		http.Error(w, "query usage records: "+err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "query usage records: "+err.Error())
 		return
 	}
 
@@ -223,33 +416,80 @@ func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleRequestDetail(w http.ResponseWriter, r *http.Request) {
 	if s.usage == nil {
-		http.Error(w, "request log tracking disabled", http.StatusNotFound)
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "request log tracking disabled")
 		return
 	}
 	if r.Method != http.MethodGet {
-		methodNotAllowed(w, http.MethodGet)
+		methodNotAllowed(w, r, http.MethodGet)
 		return
 	}
 	requestID := strings.TrimSpace(r.URL.Query().Get("request_id"))
 	if requestID == "" {
-		http.Error(w, "request_id is required", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "request_id is required")
 		return
 	}
 
 	logEntry, err := s.usage.GetRequestLog(r.Context(), requestID)
 	if err != nil {
-		http.Error(w, "query request log: "+err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "query request log: "+err.Error())
 		return
 	}
 	if logEntry == nil {
-		http.Error(w, "request not found", http.StatusNotFound)
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "request not found")
 		return
 	}
+	if identity, ok := internalmw.IdentityFromContext(r.Context()); ok && identity.Tenant != "" && logEntry.Meta["tenant"] != identity.Tenant {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "request not found")
+		return
+	}
+
+	if responses, ok := s.usage.(storage.ResponseLogStore); ok {
+		response, err := responses.GetResponseLog(r.Context(), requestID)
+		if err != nil {
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "query response log: "+err.Error())
+			return
+		}
+		logEntry.Response = response
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(logEntry)
 }
 
+func (s *Server) handleSessionUsage(w http.ResponseWriter, r *http.Request) {
+	sessions, ok := s.usage.(storage.SessionStore)
+	if !ok {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "session usage is not supported by the configured storage")
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	session := strings.TrimSpace(r.URL.Query().Get("session_id"))
+	if session == "" {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "session_id is required")
+		return
+	}
+	tenant := strings.TrimSpace(r.URL.Query().Get("tenant"))
+	if identity, ok := internalmw.IdentityFromContext(r.Context()); ok && identity.Tenant != "" {
+		tenant = identity.Tenant
+	}
+
+	totals, err := sessions.SumSessionUsage(r.Context(), storage.SessionUsageQuery{Session: session, Tenant: tenant})
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "query session usage: "+err.Error())
+		return
+	}
+	if len(totals) == 0 {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "session not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.currentGateway().SummarizeSession(session, totals))
+}
+
 type usageSummary struct {
 	TotalRequests         int `json:"total_requests"`
 	TotalPromptTokens     int `json:"total_prompt_tokens"`
@@ -261,9 +501,9 @@ type usageResponse struct {
 	Summary usageSummary          `json:"summary"`
 }
 
-func methodNotAllowed(w http.ResponseWriter, allowed string) {
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed string) {
 	w.Header().Set("Allow", allowed)
-	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "method not allowed")
 }
 
 type middleware func(http.Handler) http.Handler
@@ -280,16 +520,55 @@ func loggingMiddleware(next http.Handler) http.Handler {
 		start := time.Now()
 		next.ServeHTTP(w, r)
 		duration := time.Since(start)
-		log.Debugf("%s %s %s", r.Method, r.URL.Path, duration)
+		internalmw.Logger(r.Context()).Debugf("%s %s %s", r.Method, r.URL.Path, duration)
 	})
 }
 
+// versionHeaderMiddleware stamps every response with the running gateway version.
+// The header is applied when the status is written because the proxy replaces
+// response headers with the upstream ones.
+func versionHeaderMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&versionHeaderWriter{ResponseWriter: w}, r)
+	})
+}
+
+type versionHeaderWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *versionHeaderWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set("x-gateway-version", version.Version)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *versionHeaderWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *versionHeaderWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *versionHeaderWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func recoverMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rec := recover(); rec != nil {
-				log.Errorf("panic recovered: %v", rec)
-				http.Error(w, "internal server error", http.StatusInternalServerError)
+				internalmw.Logger(r.Context()).Errorf("panic recovered: %v", rec)
+				apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 			}
 		}()
 		next.ServeHTTP(w, r)
@@ -297,14 +576,10 @@ func recoverMiddleware(next http.Handler) http.Handler {
 }
 
 func (s *Server) startCleanupTask(ctx context.Context) {
-	// Get retention period from config, default to 3 days
-	retentionDays := s.cfg.RetentionDays
-	if retentionDays <= 0 {
-		retentionDays = 3
-	}
+	policy := s.config().RetentionPolicy()
 
 	// Cleanup interval: default every 6 hours, configurable via config
-	intervalHours := s.cfg.CleanupIntervalHours
+	intervalHours := s.config().CleanupIntervalHours
 	if intervalHours <= 0 {
 		intervalHours = 6
 	}
@@ -312,10 +587,11 @@ func (s *Server) startCleanupTask(ctx context.Context) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	log.Infof("usage/request cleanup task started: usage_retention=%d days, request_retention=%d days, interval=%dh", retentionDays, requestLogRetentionDays, intervalHours)
+	log.Infof("usage/request cleanup task started: usage_retention=%d days, request_retention=%d days, response_retention=%d days, interval=%dh",
+		policy.UsageDays, policy.RequestLogDays, policy.ResponseLogDays, intervalHours)
 
 	// Run cleanup immediately on startup
-	s.performCleanup(ctx, retentionDays)
+	s.performCleanup(ctx, policy)
 
 	for {
 		select {
@@ -323,24 +599,28 @@ func (s *Server) startCleanupTask(ctx context.Context) {
 			log.Infof("cleanup task stopped")
 			return
 		case <-ticker.C:
-			s.performCleanup(ctx, retentionDays)
+			s.performCleanup(ctx, policy)
 		}
 	}
 }
 
-func (s *Server) performCleanup(ctx context.Context, retentionDays int) {
+func (s *Server) performCleanup(ctx context.Context, policy config.RetentionConfig) {
 	if s.usage == nil {
 		return
 	}
+	defer func() {
+		now := time.Now()
+		s.lastCleanup.Store(&now)
+	}()
 
-	log.Infof("starting cleanup of usage records older than %d days and request logs older than %d days", retentionDays, requestLogRetentionDays)
+	log.Infof("starting cleanup of usage records older than %d days and request logs older than %d days", policy.UsageDays, policy.RequestLogDays)
 
-	usageDeleted, err := s.usage.CleanupOldRecords(ctx, retentionDays)
+	usageDeleted, err := s.usage.CleanupOldRecords(ctx, policy.UsageDays)
 	if err != nil {
 		log.Errorf("cleanup old records failed: %v", err)
 	}
 
-	requestDeleted, reqErr := s.usage.CleanupOldRequestLogs(ctx, requestLogRetentionDays)
+	requestDeleted, reqErr := s.usage.CleanupOldRequestLogs(ctx, policy.RequestLogDays)
 	if reqErr != nil {
 		log.Errorf("cleanup old request logs failed: %v", reqErr)
 	}
@@ -355,4 +635,29 @@ func (s *Server) performCleanup(ctx context.Context, retentionDays int) {
 	} else {
 		log.Debugf("cleanup completed: no old request logs to delete")
 	}
+
+	if responses, ok := s.usage.(storage.ResponseLogStore); ok {
+		responseDeleted, err := responses.CleanupOldResponseLogs(ctx, policy.ResponseLogDays)
+		if err != nil {
+			log.Errorf("cleanup old response logs failed: %v", err)
+		} else if responseDeleted > 0 {
+			log.Infof("cleanup completed: deleted %d old response logs", responseDeleted)
+		}
+	}
+	if alerts, ok := s.usage.(storage.AlertStore); ok && policy.AlertDays > 0 {
+		alertDeleted, err := alerts.CleanupOldAlerts(ctx, policy.AlertDays)
+		if err != nil {
+			log.Errorf("cleanup old alerts failed: %v", err)
+		} else if alertDeleted > 0 {
+			log.Infof("cleanup completed: deleted %d old alerts", alertDeleted)
+		}
+	}
+	if audit, ok := s.usage.(storage.AuditStore); ok && policy.AuditDays > 0 {
+		auditDeleted, err := audit.CleanupOldAudit(ctx, policy.AuditDays)
+		if err != nil {
+			log.Errorf("cleanup old audit records failed: %v", err)
+		} else if auditDeleted > 0 {
+			log.Infof("cleanup completed: deleted %d old audit records", auditDeleted)
+		}
+	}
 }
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/gateway"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+// testConfig is the configuration the server tests start from: a client key,
+// an admin key and one model. Tests append their own settings.
+const testConfig = `
+listen: ":8080"
+save_usage: true
+storage_type: sqlite
+storage_uri: "file:%s"
+api_keys:
+  - sk-client-key
+admin_keys:
+  - sk-admin-key
+providers:
+  - id: p1
+    base_url: %s
+    access_token: sk-upstream
+models:
+  - model: gpt-4o
+    providers:
+      - provider: p1
+`
+
+// newTestServer starts a server like the gateway binary does, from testConfig
+// followed by extra, with usage stored in a temporary SQLite database.
+func newTestServer(t *testing.T, providerURL, extra string) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeTestConfig(t, path, fmt.Sprintf(testConfig, filepath.Join(dir, "usage.db"), providerURL)+extra)
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	store, err := storage.New(context.Background(), cfg.StorageType, cfg.StorageURI)
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close(context.Background()) })
+	if err := LoadStoredTenants(context.Background(), cfg, store); err != nil {
+		t.Fatalf("load tenants: %v", err)
+	}
+	gw, err := gateway.New(cfg, store)
+	if err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+	s := New(cfg, gw, store)
+	s.SetConfigPath(path)
+	return s
+}
+
+func writeTestConfig(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve sends a request with the API key to the handler and returns the response.
+func serve(handler http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/apierror"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/gateway"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/version"
+)
+
+// stateSnapshot is the runtime state exported by GET /admin/state: the
+// effective configuration and the tenants created through the onboarding API.
+type stateSnapshot struct {
+	Version    string                `json:"version"`
+	ExportedAt time.Time             `json:"exported_at"`
+	Config     *config.Config        `json:"config"`
+	Tenants    []config.TenantConfig `json:"tenants"`
+}
+
+type importStateResponse struct {
+	DryRun   bool     `json:"dry_run"`
+	Imported []string `json:"imported"`
+	Skipped  []string `json:"skipped"`
+	// ConfigDiff lists the routing changes the snapshot configuration has
+	// compared to this gateway, which the import applies unless it is a dry run
+	ConfigDiff    gateway.ConfigDiff `json:"config_diff"`
+	ConfigSummary []string           `json:"config_summary"`
+	// ConfigApplied reports whether the snapshot configuration now serves requests
+	ConfigApplied bool `json:"config_applied"`
+}
+
+// handleAdminState exports the runtime state with GET and imports a snapshot
+// with POST, for promoting a gateway between environments.
+func (s *Server) handleAdminState(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.exportState(w, r)
+	case http.MethodPost:
+		s.importState(w, r)
+	default:
+		methodNotAllowed(w, r, "GET, POST")
+	}
+}
+
+func (s *Server) exportState(w http.ResponseWriter, r *http.Request) {
+	tenants, err := s.storedTenants(r)
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, err.Error())
+		return
+	}
+
+	s.tenantMu.Lock()
+	data, err := json.Marshal(stateSnapshot{
+		Version:    version.Version,
+		ExportedAt: time.Now().UTC(),
+		Config:     s.config(),
+		Tenants:    tenants,
+	})
+	s.tenantMu.Unlock()
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "encode state: "+err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("gateway-state-%s.json", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	_, _ = w.Write(data)
+}
+
+func (s *Server) importState(w http.ResponseWriter, r *http.Request) {
+	tenantStore, ok := s.usage.(storage.TenantStore)
+	if !ok {
+		apierror.Write(w, r, http.StatusNotImplemented, apierror.CodeNotSupported, "state import is not supported by the configured storage")
+		return
+	}
+	var snapshot stateSnapshot
+	if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "decode state: "+err.Error())
+		return
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	if snapshot.Config != nil {
+		// The snapshot holds an effective configuration, its defaults are already set.
+		if err := snapshot.Config.Validate(); err != nil {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid snapshot configuration: "+err.Error())
+			return
+		}
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.tenantMu.Lock()
+	defer s.tenantMu.Unlock()
+
+	resp := importStateResponse{DryRun: dryRun, Imported: []string{}, Skipped: []string{}, ConfigSummary: []string{}}
+	if snapshot.Config != nil {
+		resp.ConfigDiff = gateway.DiffConfig(s.config(), snapshot.Config)
+		if summary := resp.ConfigDiff.Lines(); summary != nil {
+			resp.ConfigSummary = summary
+		}
+	}
+	for _, tenant := range snapshot.Tenants {
+		if _, exists := s.config().TenantByID(tenant.ID); exists {
+			resp.Skipped = append(resp.Skipped, tenant.ID)
+			continue
+		}
+		if dryRun {
+			resp.Imported = append(resp.Imported, tenant.ID)
+			continue
+		}
+		if err := s.registerTenant(r.Context(), tenantStore, tenant); err != nil {
+			if errors.Is(err, storage.ErrTenantExists) {
+				resp.Skipped = append(resp.Skipped, tenant.ID)
+				continue
+			}
+			status, code := http.StatusInternalServerError, apierror.CodeInternal
+			if errors.Is(err, errInvalidTenant) {
+				status, code = http.StatusBadRequest, apierror.CodeInvalidRequest
+			}
+			apierror.Write(w, r, status, code, fmt.Sprintf("import tenant %s: %v", tenant.ID, err))
+			return
+		}
+		resp.Imported = append(resp.Imported, tenant.ID)
+	}
+	if !dryRun && snapshot.Config != nil {
+		if _, err := s.applyConfigLocked(r.Context(), snapshot.Config); err != nil {
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "apply snapshot configuration: "+err.Error())
+			return
+		}
+		resp.ConfigApplied = true
+		for _, line := range resp.ConfigSummary {
+			log.Infof("state import: applied config change: %s", line)
+		}
+	}
+	if !dryRun {
+		setAuditDiff(r, nil, map[string]any{"imported_tenants": resp.Imported, "config_changes": resp.ConfigSummary})
+		log.Infof("state import: %d tenants imported, %d skipped", len(resp.Imported), len(resp.Skipped))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// storedTenants returns the tenants created through the onboarding API.
+func (s *Server) storedTenants(r *http.Request) ([]config.TenantConfig, error) {
+	tenantStore, ok := s.usage.(storage.TenantStore)
+	if !ok {
+		return []config.TenantConfig{}, nil
+	}
+	return listStoredTenants(r.Context(), tenantStore)
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAdminStateExport(t *testing.T) {
+	handler := newTestServer(t, "https://p1.example.com/v1", "").buildHandler()
+	rec := serve(handler, http.MethodPost, "/admin/tenants", "sk-admin-key", `{"id":"team-x"}`)
+	var tenant createTenantResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &tenant); err != nil {
+		t.Fatalf("decode tenant: %v", err)
+	}
+
+	rec = serve(handler, http.MethodGet, "/admin/state", "sk-admin-key", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if disposition := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment;") {
+		t.Fatalf("expected a download, got %q", disposition)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &fields); err != nil {
+		t.Fatalf("decode state: %v", err)
+	}
+	for _, name := range []string{"version", "exported_at", "config", "tenants"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("state is missing %s: %s", name, rec.Body.String())
+		}
+	}
+
+	var snapshot stateSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("decode state: %v", err)
+	}
+	if snapshot.Config == nil || len(snapshot.Config.Models) != 1 || snapshot.ExportedAt.IsZero() {
+		t.Fatalf("expected the effective configuration, got %+v", snapshot)
+	}
+	if len(snapshot.Tenants) != 1 || snapshot.Tenants[0].ID != "team-x" || len(snapshot.Tenants[0].APIKeyDigests) != 1 {
+		t.Fatalf("expected the onboarded tenant with its key digest, got %+v", snapshot.Tenants)
+	}
+	if strings.Contains(rec.Body.String(), tenant.APIKey) {
+		t.Fatal("the state must not contain the tenant's API key")
+	}
+}
+
+func TestAdminStateImport(t *testing.T) {
+	source := newTestServer(t, "https://p1.example.com/v1", "").buildHandler()
+	serve(source, http.MethodPost, "/admin/tenants", "sk-admin-key", `{"id":"team-x"}`)
+	state := serve(source, http.MethodGet, "/admin/state", "sk-admin-key", "").Body.String()
+
+	target := newTestServer(t, "https://p1.example.com/v1", "")
+	handler := target.buildHandler()
+	rec := serve(handler, http.MethodPost, "/admin/state", "sk-admin-key", state)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &fields); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	for _, name := range []string{"dry_run", "imported", "skipped", "config_diff", "config_summary", "config_applied"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("import response is missing %s: %s", name, rec.Body.String())
+		}
+	}
+	var resp importStateResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.DryRun || !resp.ConfigApplied || len(resp.Imported) != 1 || resp.Imported[0] != "team-x" {
+		t.Fatalf("unexpected import %+v", resp)
+	}
+	if _, ok := target.config().TenantByID("team-x"); !ok {
+		t.Fatal("expected the imported tenant to be served")
+	}
+}
+
+func TestAdminStateRequiresAdmin(t *testing.T) {
+	handler := newTestServer(t, "https://p1.example.com/v1", "").buildHandler()
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		if rec := serve(handler, method, "/admin/state", "sk-client-key", "{}"); rec.Code != http.StatusForbidden {
+			t.Errorf("%s: expected a proxy key to be forbidden, got %d", method, rec.Code)
+		}
+		if rec := serve(handler, method, "/admin/state", "", "{}"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected a missing key to be rejected, got %d", method, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mylxsw/asteria/log"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/apierror"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+type createTenantRequest struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Template string `json:"template"`
+	// Budget replaces the budget of the template
+	Budget *config.BudgetConfig `json:"budget,omitempty"`
+}
+
+type createTenantResponse struct {
+	Tenant config.TenantConfig `json:"tenant"`
+	APIKey string              `json:"api_key"`
+}
+
+// LoadStoredTenants appends the tenants created through the onboarding API to cfg,
+// so they are routed and authenticated like tenants from the config file.
+func LoadStoredTenants(ctx context.Context, cfg *config.Config, usage storage.Store) error {
+	tenantStore, ok := usage.(storage.TenantStore)
+	if !ok {
+		return nil
+	}
+	tenants, err := listStoredTenants(ctx, tenantStore)
+	if err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		if _, exists := cfg.TenantByID(tenant.ID); exists {
+			log.Warningf("stored tenant %s is shadowed by the config file", tenant.ID)
+			continue
+		}
+		cfg.Tenants = append(cfg.Tenants, tenant)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("validate stored tenants: %w", err)
+	}
+	return nil
+}
+
+// listStoredTenants decodes the tenants created through the onboarding API.
+// Tenants stored before keys were kept as digests get their keys replaced by
+// digests, so plaintext keys are never served again.
+func listStoredTenants(ctx context.Context, tenantStore storage.TenantStore) ([]config.TenantConfig, error) {
+	records, err := tenantStore.ListTenants(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list stored tenants: %w", err)
+	}
+	tenants := make([]config.TenantConfig, 0, len(records))
+	for _, rec := range records {
+		var tenant config.TenantConfig
+		if err := json.Unmarshal(rec.Spec, &tenant); err != nil {
+			return nil, fmt.Errorf("decode stored tenant %s: %w", rec.ID, err)
+		}
+		tenants = append(tenants, tenant.WithKeyDigests())
+	}
+	return tenants, nil
+}
+
+// handleAdminTenants onboards a tenant in one call: it applies the requested
+// template, generates the first API key, persists the tenant and starts serving it.
+func (s *Server) handleAdminTenants(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	tenantStore, ok := s.usage.(storage.TenantStore)
+	if !ok {
+		apierror.Write(w, r, http.StatusNotImplemented, apierror.CodeNotSupported, "tenant onboarding is not supported by the configured storage")
+		return
+	}
+
+	var req createTenantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "decode request body: "+err.Error())
+		return
+	}
+	tenant := config.TenantConfig{ID: strings.TrimSpace(req.ID), Name: strings.TrimSpace(req.Name)}
+	if tenant.ID == "" {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "tenant id is required")
+		return
+	}
+	if req.Template != "" {
+		tpl, ok := s.config().TenantTemplateByName(req.Template)
+		if !ok {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, fmt.Sprintf("tenant template %s not found", req.Template))
+			return
+		}
+		tpl.Apply(&tenant)
+	}
+	if req.Budget != nil {
+		tenant.Budget = req.Budget
+	}
+	key, err := generateAPIKey()
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "generate api key: "+err.Error())
+		return
+	}
+	tenant.APIKeys = []string{key}
+
+	s.tenantMu.Lock()
+	defer s.tenantMu.Unlock()
+
+	if err := s.registerTenant(r.Context(), tenantStore, tenant); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrTenantExists):
+			apierror.Write(w, r, http.StatusConflict, apierror.CodeConflict, fmt.Sprintf("tenant %s already exists", tenant.ID))
+		case errors.Is(err, errInvalidTenant):
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		default:
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, err.Error())
+		}
+		return
+	}
+	audited := tenant
+	audited.APIKeys = []string{maskKey(key)}
+	setAuditDiff(r, nil, audited)
+	log.Infof("tenant %s onboarded with template %q", tenant.ID, req.Template)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(createTenantResponse{Tenant: tenant.WithKeyDigests(), APIKey: key})
+}
+
+// errInvalidTenant is returned by registerTenant when the tenant does not
+// pass config validation.
+var errInvalidTenant = errors.New("invalid tenant")
+
+// registerTenant validates and persists a new tenant and starts serving it.
+// Its keys are stored and kept as digests only. The caller must hold tenantMu.
+func (s *Server) registerTenant(ctx context.Context, tenantStore storage.TenantStore, tenant config.TenantConfig) error {
+	tenant = tenant.WithKeyDigests()
+	cfg := s.config()
+	if _, exists := cfg.TenantByID(tenant.ID); exists {
+		return storage.ErrTenantExists
+	}
+	candidate := *cfg
+	candidate.Tenants = append(append([]config.TenantConfig(nil), cfg.Tenants...), tenant)
+	if err := candidate.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidTenant, err)
+	}
+
+	spec, err := json.Marshal(tenant)
+	if err != nil {
+		return fmt.Errorf("encode tenant: %w", err)
+	}
+	if err := tenantStore.SaveTenant(ctx, storage.TenantRecord{ID: tenant.ID, Spec: spec}); err != nil {
+		if errors.Is(err, storage.ErrTenantExists) {
+			return err
+		}
+		return fmt.Errorf("save tenant: %w", err)
+	}
+
+	// Requests in flight keep reading the configuration they loaded.
+	s.cfg.Store(&candidate)
+	s.currentGateway().AddTenant(tenant)
+	s.auth.AddTenant(tenant)
+	return nil
+}
+
+// handleAdminTenantExport streams a snapshot of a single tenant's usage data.
+func (s *Server) handleAdminTenantExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	partitioner, ok := s.usage.(storage.TenantPartitioner)
+	if !ok {
+		apierror.Write(w, r, http.StatusNotImplemented, apierror.CodeNotSupported, "tenant export requires storage_partition_by_tenant")
+		return
+	}
+	tenant := r.PathValue("id")
+	filename := fmt.Sprintf("tenant-%s-%s.db", url.PathEscape(tenant), time.Now().Format("20060102-150405"))
+	streamSnapshot(w, r, filename, func(dest string) error {
+		return partitioner.ExportTenant(r.Context(), tenant, dest)
+	})
+}
+
+// handleAdminTenantData deletes all usage records and request logs of a tenant
+// without touching the data of other tenants.
+func (s *Server) handleAdminTenantData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, r, http.MethodDelete)
+		return
+	}
+	partitioner, ok := s.usage.(storage.TenantPartitioner)
+	if !ok {
+		apierror.Write(w, r, http.StatusNotImplemented, apierror.CodeNotSupported, "tenant data deletion requires storage_partition_by_tenant")
+		return
+	}
+	tenant := r.PathValue("id")
+	if err := partitioner.DropTenant(r.Context(), tenant); err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "delete tenant data: "+err.Error())
+		return
+	}
+	setAuditDiff(r, map[string]any{"tenant": tenant}, nil)
+	log.Infof("usage data of tenant %s deleted", tenant)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func generateAPIKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "sk-" + hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/storage"
+)
+
+const tenantTemplates = `
+tenant_templates:
+  - name: basic
+    models:
+      - gpt-4o
+    budget:
+      monthly_cost: 100
+`
+
+func TestAdminTenantsOnboardsTenant(t *testing.T) {
+	s := newTestServer(t, "https://p1.example.com/v1", tenantTemplates)
+	handler := s.buildHandler()
+
+	rec := serve(handler, http.MethodPost, "/admin/tenants", "sk-admin-key", `{"id":"team-x","name":"Team X","template":"basic"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp createTenantResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	tenant := resp.Tenant
+	if resp.APIKey == "" || len(tenant.APIKeys) != 0 || len(tenant.APIKeyDigests) != 1 {
+		t.Fatalf("expected the key once and only its digest in the tenant, got %+v", resp)
+	}
+	if tenant.ID != "team-x" || len(tenant.Models) != 1 || tenant.Budget == nil || tenant.Budget.MonthlyCost != 100 {
+		t.Fatalf("expected the template to be applied, got %+v", tenant)
+	}
+
+	// The new key is served right away and reads the usage of its tenant.
+	if rec := serve(handler, http.MethodGet, "/usage", resp.APIKey, ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected the issued key to read its usage, got %d: %s", rec.Code, rec.Body.String())
+	}
+	records, err := s.usage.(storage.TenantStore).ListTenants(context.Background())
+	if err != nil || len(records) != 1 || records[0].ID != "team-x" {
+		t.Fatalf("expected the tenant to be stored, got %+v, %v", records, err)
+	}
+}
+
+func TestAdminTenantsRequiresAdmin(t *testing.T) {
+	handler := newTestServer(t, "https://p1.example.com/v1", tenantTemplates).buildHandler()
+
+	body := `{"id":"team-x","template":"basic"}`
+	if rec := serve(handler, http.MethodPost, "/admin/tenants", "sk-client-key", body); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a proxy key to be forbidden, got %d", rec.Code)
+	}
+	if rec := serve(handler, http.MethodPost, "/admin/tenants", "", body); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a missing key to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestAdminTenantsRejectsInvalidTenants(t *testing.T) {
+	handler := newTestServer(t, "https://p1.example.com/v1", tenantTemplates).buildHandler()
+
+	if rec := serve(handler, http.MethodPost, "/admin/tenants", "sk-admin-key", `{"id":"team-x"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	cases := []struct {
+		name, body string
+		status     int
+	}{
+		{"duplicate id", `{"id":"team-x"}`, http.StatusConflict},
+		{"missing id", `{"name":"Team Y"}`, http.StatusBadRequest},
+		{"unknown template", `{"id":"team-y","template":"premium"}`, http.StatusBadRequest},
+		{"negative budget", `{"id":"team-y","template":"basic","budget":{"monthly_cost":-1}}`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if rec := serve(handler, http.MethodPost, "/admin/tenants", "sk-admin-key", c.body); rec.Code != c.status {
+			t.Errorf("%s: expected %d, got %d: %s", c.name, c.status, rec.Code, rec.Body.String())
+		}
+	}
+}
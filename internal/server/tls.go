@@ -0,0 +1,37 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/mylxsw/openai-cost-optimal-gateway/internal/config"
+)
+
+// serverTLSConfig builds the listener TLS settings, or returns nil when the
+// listener serves plain HTTP.
+func serverTLSConfig(cfg *config.TLSConfig) (*tls.Config, error) {
+	if cfg == nil || cfg.CertFile == "" {
+		return nil, nil
+	}
+	minVersion, err := config.ParseTLSVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	suites, err := config.CipherSuiteIDs(cfg.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{MinVersion: minVersion, CipherSuites: suites}, nil
+}
+
+// hstsMiddleware sets the Strict-Transport-Security header on every response,
+// including the ones rejected by authentication.
+func hstsMiddleware(hsts *config.HSTSConfig) func(http.Handler) http.Handler {
+	value := hsts.Header()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Strict-Transport-Security", value)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
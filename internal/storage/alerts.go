@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// AlertRecord is a notification event raised by the gateway.
+type AlertRecord struct {
+	ID        int64          `json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	EventID   string         `json:"event_id"`
+	Type      string         `json:"type"`
+	Severity  string         `json:"severity"`
+	Message   string         `json:"message"`
+	Provider  string         `json:"provider,omitempty"`
+	Model     string         `json:"model,omitempty"`
+	Tenant    string         `json:"tenant,omitempty"`
+	Key       string         `json:"key,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// AlertQuery filters alert history. Zero values match everything.
+type AlertQuery struct {
+	Since    time.Time
+	Until    time.Time
+	Type     string
+	Severity string
+	Provider string
+	Tenant   string
+	Limit    int
+}
+
+// AlertStore is implemented by stores that keep the history of fired alerts.
+type AlertStore interface {
+	RecordAlert(ctx context.Context, alert AlertRecord) error
+	// QueryAlerts returns matching alerts, newest first.
+	QueryAlerts(ctx context.Context, query AlertQuery) ([]AlertRecord, error)
+	// CleanupOldAlerts removes alerts older than retentionDays.
+	CleanupOldAlerts(ctx context.Context, retentionDays int) (int64, error)
+}
+
+func (q AlertQuery) limit() int {
+	if q.Limit <= 0 {
+		return 100
+	}
+	return q.Limit
+}
+
+func (q AlertQuery) matches(alert AlertRecord) bool {
+	if !q.Since.IsZero() && alert.CreatedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !alert.CreatedAt.Before(q.Until) {
+		return false
+	}
+	for _, f := range []struct{ want, got string }{
+		{q.Type, alert.Type},
+		{q.Severity, alert.Severity},
+		{q.Provider, alert.Provider},
+		{q.Tenant, alert.Tenant},
+	} {
+		if f.want != "" && f.want != f.got {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *sqliteStore) RecordAlert(ctx context.Context, alert AlertRecord) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if alert.CreatedAt.IsZero() {
+		alert.CreatedAt = time.Now()
+	}
+	details, err := json.Marshal(alert.Details)
+	if err != nil {
+		return fmt.Errorf("encode alert details: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO alerts
+		(created_at, event_id, type, severity, message, provider, model, tenant, alert_key, details)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		alert.CreatedAt.Format(time.RFC3339Nano),
+		alert.EventID,
+		alert.Type,
+		alert.Severity,
+		alert.Message,
+		alert.Provider,
+		alert.Model,
+		alert.Tenant,
+		alert.Key,
+		string(details),
+	)
+	if err != nil {
+		return fmt.Errorf("insert alert: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) QueryAlerts(ctx context.Context, query AlertQuery) ([]AlertRecord, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	querySQL := `SELECT id, created_at, event_id, type, severity, message, provider, model, tenant, alert_key, details FROM alerts`
+	var conditions []string
+	var args []interface{}
+	if !query.Since.IsZero() {
+		conditions = append(conditions, "datetime(created_at) >= datetime(?)")
+		args = append(args, query.Since.Format(time.RFC3339Nano))
+	}
+	if !query.Until.IsZero() {
+		conditions = append(conditions, "datetime(created_at) < datetime(?)")
+		args = append(args, query.Until.Format(time.RFC3339Nano))
+	}
+	for _, f := range []struct{ column, value string }{
+		{"type", query.Type},
+		{"severity", query.Severity},
+		{"provider", query.Provider},
+		{"tenant", query.Tenant},
+	} {
+		if f.value != "" {
+			conditions = append(conditions, f.column+" = ?")
+			args = append(args, f.value)
+		}
+	}
+	if len(conditions) > 0 {
+		querySQL += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	querySQL += " ORDER BY datetime(created_at) DESC, id DESC LIMIT ?"
+	args = append(args, query.limit())
+
+	rows, err := s.db.QueryContext(ctx, querySQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var alerts []AlertRecord
+	for rows.Next() {
+		var (
+			alert     AlertRecord
+			createdAt string
+			details   string
+		)
+		if err := rows.Scan(&alert.ID, &createdAt, &alert.EventID, &alert.Type, &alert.Severity, &alert.Message,
+			&alert.Provider, &alert.Model, &alert.Tenant, &alert.Key, &details); err != nil {
+			return nil, fmt.Errorf("scan alert: %w", err)
+		}
+		if parsed, err := time.Parse(time.RFC3339Nano, createdAt); err == nil {
+			alert.CreatedAt = parsed
+		}
+		if details != "" && details != "null" {
+			if err := json.Unmarshal([]byte(details), &alert.Details); err != nil {
+				return nil, fmt.Errorf("decode alert details: %w", err)
+			}
+		}
+		alerts = append(alerts, alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate alerts: %w", err)
+	}
+	return alerts, nil
+}
+
+func (s *sqliteStore) CleanupOldAlerts(ctx context.Context, retentionDays int) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	result, err := s.db.ExecContext(ctx, `DELETE FROM alerts WHERE datetime(created_at) < datetime(?)`, cutoff.Format(time.RFC3339Nano))
+	if err != nil {
+		return 0, fmt.Errorf("cleanup old alerts: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("alert rows affected: %w", err)
+	}
+	return rows, nil
+}
+
+func (f *fileStore) RecordAlert(_ context.Context, alert AlertRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	alert.ID = 1
+	if n := len(f.alerts); n > 0 {
+		alert.ID = f.alerts[n-1].ID + 1
+	}
+	if alert.CreatedAt.IsZero() {
+		alert.CreatedAt = time.Now()
+	}
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("encode alert: %w", err)
+	}
+	file, err := os.OpenFile(f.alertPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open alert store: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write alert: %w", err)
+	}
+
+	f.alerts = append(f.alerts, alert)
+	return nil
+}
+
+func (f *fileStore) QueryAlerts(_ context.Context, query AlertQuery) ([]AlertRecord, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var alerts []AlertRecord
+	for i := len(f.alerts) - 1; i >= 0 && len(alerts) < query.limit(); i-- {
+		if query.matches(f.alerts[i]) {
+			alerts = append(alerts, f.alerts[i])
+		}
+	}
+	return alerts, nil
+}
+
+func (f *fileStore) CleanupOldAlerts(_ context.Context, retentionDays int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	var kept []AlertRecord
+	for _, alert := range f.alerts {
+		if alert.CreatedAt.After(cutoff) {
+			kept = append(kept, alert)
+		}
+	}
+	removed := int64(len(f.alerts) - len(kept))
+	if removed == 0 {
+		return 0, nil
+	}
+	if err := rewriteLines(f.alertPath, kept); err != nil {
+		return 0, fmt.Errorf("cleanup old alerts: %w", err)
+	}
+	f.alerts = kept
+	return removed, nil
+}
+
+// rewriteLines replaces the file at path with one JSON line per item.
+func rewriteLines[T any](path string, items []T) error {
+	var buf bytes.Buffer
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(data, '\n'))
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+func (f *fileStore) loadAlerts() error {
+	file, err := os.OpenFile(f.alertPath, os.O_RDONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open alert store: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var alert AlertRecord
+		if err := json.Unmarshal([]byte(line), &alert); err != nil {
+			return fmt.Errorf("decode alert: %w", err)
+		}
+		f.alerts = append(f.alerts, alert)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read alerts: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// AuditRecord is an administrative action taken through the admin API.
+type AuditRecord struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Actor is the masked API key that made the call.
+	Actor  string `json:"actor"`
+	Tenant string `json:"tenant,omitempty"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	// Diff describes the change, typically as "before" and "after" values.
+	Diff map[string]any `json:"diff,omitempty"`
+}
+
+// AuditQuery filters the audit log. Zero values match everything.
+type AuditQuery struct {
+	Since time.Time
+	Until time.Time
+	Actor string
+	Path  string
+	Limit int
+}
+
+// AuditStore is implemented by stores that keep an audit log of admin actions.
+type AuditStore interface {
+	RecordAudit(ctx context.Context, record AuditRecord) error
+	// QueryAudit returns matching records, newest first.
+	QueryAudit(ctx context.Context, query AuditQuery) ([]AuditRecord, error)
+	// CleanupOldAudit removes audit records older than retentionDays.
+	CleanupOldAudit(ctx context.Context, retentionDays int) (int64, error)
+}
+
+func (q AuditQuery) limit() int {
+	if q.Limit <= 0 {
+		return 100
+	}
+	return q.Limit
+}
+
+func (q AuditQuery) matches(record AuditRecord) bool {
+	if !q.Since.IsZero() && record.CreatedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !record.CreatedAt.Before(q.Until) {
+		return false
+	}
+	if q.Actor != "" && q.Actor != record.Actor {
+		return false
+	}
+	return q.Path == "" || strings.HasPrefix(record.Path, q.Path)
+}
+
+func (s *sqliteStore) RecordAudit(ctx context.Context, record AuditRecord) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	diff, err := json.Marshal(record.Diff)
+	if err != nil {
+		return fmt.Errorf("encode audit diff: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO audit_log
+		(created_at, actor, tenant, method, path, status, diff)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		record.CreatedAt.Format(time.RFC3339Nano),
+		record.Actor,
+		record.Tenant,
+		record.Method,
+		record.Path,
+		record.Status,
+		string(diff),
+	)
+	if err != nil {
+		return fmt.Errorf("insert audit record: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) QueryAudit(ctx context.Context, query AuditQuery) ([]AuditRecord, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	querySQL := `SELECT id, created_at, actor, tenant, method, path, status, diff FROM audit_log`
+	var conditions []string
+	var args []interface{}
+	if !query.Since.IsZero() {
+		conditions = append(conditions, "datetime(created_at) >= datetime(?)")
+		args = append(args, query.Since.Format(time.RFC3339Nano))
+	}
+	if !query.Until.IsZero() {
+		conditions = append(conditions, "datetime(created_at) < datetime(?)")
+		args = append(args, query.Until.Format(time.RFC3339Nano))
+	}
+	if query.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, query.Actor)
+	}
+	if query.Path != "" {
+		conditions = append(conditions, "substr(path, 1, ?) = ?")
+		args = append(args, len(query.Path), query.Path)
+	}
+	if len(conditions) > 0 {
+		querySQL += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	querySQL += " ORDER BY datetime(created_at) DESC, id DESC LIMIT ?"
+	args = append(args, query.limit())
+
+	rows, err := s.db.QueryContext(ctx, querySQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var records []AuditRecord
+	for rows.Next() {
+		var (
+			record    AuditRecord
+			createdAt string
+			diff      string
+		)
+		if err := rows.Scan(&record.ID, &createdAt, &record.Actor, &record.Tenant, &record.Method, &record.Path, &record.Status, &diff); err != nil {
+			return nil, fmt.Errorf("scan audit record: %w", err)
+		}
+		if parsed, err := time.Parse(time.RFC3339Nano, createdAt); err == nil {
+			record.CreatedAt = parsed
+		}
+		if diff != "" && diff != "null" {
+			if err := json.Unmarshal([]byte(diff), &record.Diff); err != nil {
+				return nil, fmt.Errorf("decode audit diff: %w", err)
+			}
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate audit log: %w", err)
+	}
+	return records, nil
+}
+
+func (s *sqliteStore) CleanupOldAudit(ctx context.Context, retentionDays int) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	result, err := s.db.ExecContext(ctx, `DELETE FROM audit_log WHERE datetime(created_at) < datetime(?)`, cutoff.Format(time.RFC3339Nano))
+	if err != nil {
+		return 0, fmt.Errorf("cleanup old audit records: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("audit rows affected: %w", err)
+	}
+	return rows, nil
+}
+
+func (f *fileStore) RecordAudit(_ context.Context, record AuditRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	record.ID = 1
+	if n := len(f.audit); n > 0 {
+		record.ID = f.audit[n-1].ID + 1
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encode audit record: %w", err)
+	}
+	file, err := os.OpenFile(f.auditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write audit record: %w", err)
+	}
+
+	f.audit = append(f.audit, record)
+	return nil
+}
+
+func (f *fileStore) QueryAudit(_ context.Context, query AuditQuery) ([]AuditRecord, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var records []AuditRecord
+	for i := len(f.audit) - 1; i >= 0 && len(records) < query.limit(); i-- {
+		if query.matches(f.audit[i]) {
+			records = append(records, f.audit[i])
+		}
+	}
+	return records, nil
+}
+
+func (f *fileStore) CleanupOldAudit(_ context.Context, retentionDays int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	var kept []AuditRecord
+	for _, record := range f.audit {
+		if record.CreatedAt.After(cutoff) {
+			kept = append(kept, record)
+		}
+	}
+	removed := int64(len(f.audit) - len(kept))
+	if removed == 0 {
+		return 0, nil
+	}
+	if err := rewriteLines(f.auditPath, kept); err != nil {
+		return 0, fmt.Errorf("cleanup old audit records: %w", err)
+	}
+	f.audit = kept
+	return removed, nil
+}
+
+func (f *fileStore) loadAudit() error {
+	file, err := os.OpenFile(f.auditPath, os.O_RDONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return fmt.Errorf("decode audit record: %w", err)
+		}
+		f.audit = append(f.audit, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read audit log: %w", err)
+	}
+	return nil
+}
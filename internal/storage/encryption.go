@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RequestLogEncrypter is implemented by stores that can encrypt the headers
+// and body of request logs at rest. Logs written before the key was set, or
+// while none was set, stay readable.
+type RequestLogEncrypter interface {
+	// SetRequestLogKey enables AES-256-GCM encryption with the 32 byte key.
+	SetRequestLogKey(key []byte) error
+}
+
+// sealedPrefix marks encrypted values: the prefix is followed by the base64
+// encoded nonce and ciphertext.
+const sealedPrefix = "enc:v1:"
+
+func newLogCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("request log key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create gcm: %w", err)
+	}
+	return aead, nil
+}
+
+func seal(aead cipher.AEAD, plaintext string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func isSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// unseal decrypts a value produced by seal; other values are returned as is.
+func unseal(aead cipher.AEAD, value string) (string, error) {
+	if !isSealed(value) {
+		return value, nil
+	}
+	if aead == nil {
+		return "", errors.New("request log is encrypted but no key is configured")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted request log")
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt request log: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// sealedRequestLog is the encrypted part of a request log in the file store,
+// which keeps both in the body field.
+type sealedRequestLog struct {
+	Headers map[string][]string `json:"headers"`
+	Body    string              `json:"body"`
+}
+
+func sealRequestLog(aead cipher.AEAD, log RequestLog) (RequestLog, error) {
+	data, err := json.Marshal(sealedRequestLog{Headers: log.Headers, Body: log.Body})
+	if err != nil {
+		return log, fmt.Errorf("encode request log: %w", err)
+	}
+	sealed, err := seal(aead, string(data))
+	if err != nil {
+		return log, err
+	}
+	log.Headers = nil
+	log.Body = sealed
+	return log, nil
+}
+
+func unsealRequestLog(aead cipher.AEAD, log RequestLog) (RequestLog, error) {
+	if !isSealed(log.Body) {
+		return log, nil
+	}
+	data, err := unseal(aead, log.Body)
+	if err != nil {
+		return log, err
+	}
+	var parts sealedRequestLog
+	if err := json.Unmarshal([]byte(data), &parts); err != nil {
+		return log, fmt.Errorf("decode request log: %w", err)
+	}
+	log.Headers = parts.Headers
+	log.Body = parts.Body
+	return log, nil
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Exporter is implemented by stores whose usage records and request logs can
+// be read in full, e.g. to migrate them to another backend. Each call returns
+// up to limit entries with an id greater than afterID, in id order. Request
+// logs are returned decrypted.
+type Exporter interface {
+	ExportUsage(ctx context.Context, afterID int64, limit int) ([]UsageRecord, error)
+	ExportRequestLogs(ctx context.Context, afterID int64, limit int) ([]RequestLog, error)
+}
+
+// Importer is implemented by stores that can write a batch of usage records
+// or request logs at once. The ids of the entries are ignored.
+type Importer interface {
+	ImportUsage(ctx context.Context, records []UsageRecord) error
+	ImportRequestLogs(ctx context.Context, logs []RequestLog) error
+}
+
+func (s *sqliteStore) ExportUsage(ctx context.Context, afterID int64, limit int) ([]UsageRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+usageRecordColumns+` FROM usage_records WHERE id > ? ORDER BY id LIMIT ?`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("export usage records: %w", err)
+	}
+	return scanUsageRecords(rows)
+}
+
+func (s *sqliteStore) ExportRequestLogs(ctx context.Context, afterID int64, limit int) ([]RequestLog, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+requestLogColumns+` FROM request_logs WHERE id > ? ORDER BY id LIMIT ?`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("export request logs: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []RequestLog
+	for rows.Next() {
+		log, err := s.scanRequestLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, *log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate request logs: %w", err)
+	}
+	return logs, nil
+}
+
+func (s *sqliteStore) ImportUsage(ctx context.Context, records []UsageRecord) error {
+	return s.inTx(ctx, func(tx execer) error {
+		for _, record := range records {
+			if err := insertUsage(ctx, tx, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) ImportRequestLogs(ctx context.Context, logs []RequestLog) error {
+	return s.inTx(ctx, func(tx execer) error {
+		for _, log := range logs {
+			if err := s.insertRequestLog(ctx, tx, log); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) inTx(ctx context.Context, fn func(tx execer) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (f *fileStore) ExportUsage(_ context.Context, afterID int64, limit int) ([]UsageRecord, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var records []UsageRecord
+	for _, rec := range f.records {
+		if rec.ID > afterID {
+			records = append(records, rec)
+			if len(records) == limit {
+				break
+			}
+		}
+	}
+	return records, nil
+}
+
+func (f *fileStore) ExportRequestLogs(_ context.Context, afterID int64, limit int) ([]RequestLog, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var logs []RequestLog
+	for _, entry := range f.requestLogs {
+		if entry.ID <= afterID {
+			continue
+		}
+		log, err := unsealRequestLog(f.logCipher, entry)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
+		if len(logs) == limit {
+			break
+		}
+	}
+	return logs, nil
+}
+
+// ImportUsage appends the records to the usage file in a single write.
+func (f *fileStore) ImportUsage(_ context.Context, records []UsageRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var buf bytes.Buffer
+	imported := make([]UsageRecord, 0, len(records))
+	for _, record := range records {
+		f.nextID++
+		record.ID = f.nextID
+		if record.CreatedAt.IsZero() {
+			record.CreatedAt = time.Now()
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("encode usage record: %w", err)
+		}
+		buf.Write(append(data, '\n'))
+		imported = append(imported, record)
+	}
+	if err := appendFile(f.usagePath, buf.Bytes()); err != nil {
+		return fmt.Errorf("write usage records: %w", err)
+	}
+	f.records = append(f.records, imported...)
+	return nil
+}
+
+// ImportRequestLogs appends the request logs, sealed when a key is set, to the
+// request log file in a single write.
+func (f *fileStore) ImportRequestLogs(_ context.Context, logs []RequestLog) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var buf bytes.Buffer
+	imported := make([]RequestLog, 0, len(logs))
+	for _, log := range logs {
+		f.nextRequestLogID++
+		log.ID = f.nextRequestLogID
+		if log.CreatedAt.IsZero() {
+			log.CreatedAt = time.Now()
+		}
+		if f.logCipher != nil {
+			sealed, err := sealRequestLog(f.logCipher, log)
+			if err != nil {
+				return err
+			}
+			log = sealed
+		}
+		data, err := json.Marshal(log)
+		if err != nil {
+			return fmt.Errorf("encode request log: %w", err)
+		}
+		buf.Write(append(data, '\n'))
+		imported = append(imported, log)
+	}
+	if err := appendFile(f.requestLogPath, buf.Bytes()); err != nil {
+		return fmt.Errorf("write request logs: %w", err)
+	}
+	f.requestLogs = append(f.requestLogs, imported...)
+	return nil
+}
+
+func appendFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,566 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TenantPartitioner is implemented by stores that keep the data of each tenant
+// apart, so that it can be exported or deleted wholesale.
+type TenantPartitioner interface {
+	// ExportTenant writes a snapshot of the tenant's data to destPath.
+	ExportTenant(ctx context.Context, tenant, destPath string) error
+	// DropTenant deletes all usage records and request logs of the tenant.
+	DropTenant(ctx context.Context, tenant string) error
+}
+
+// partitionedStore keeps the records of every tenant in a separate database
+// file, while records without a tenant and the tenant definitions stay in the
+// shared store.
+type partitionedStore struct {
+	mu         sync.RWMutex
+	shared     Store
+	dir        string
+	ext        string
+	open       func(ctx context.Context, path string) (Store, error)
+	partitions map[string]Store
+	logKey     []byte
+}
+
+// NewPartitioned opens a store like New, but writes the data of each tenant to its
+// own file under a "<name>_partitions" directory next to the shared storage file.
+func NewPartitioned(ctx context.Context, driver, uri string, opts ...Option) (Store, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	shared, err := New(ctx, driver, uri, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &partitionedStore{shared: shared, partitions: make(map[string]Store)}
+	var base string
+	switch s := shared.(type) {
+	case *sqliteStore:
+		base = s.path
+		pragmas, options := s.pragmas, s.options
+		p.open = func(ctx context.Context, path string) (Store, error) {
+			return openSQLiteStore(ctx, path, pragmas, options)
+		}
+	case *fileStore:
+		base = s.usagePath
+		p.open = func(_ context.Context, path string) (Store, error) {
+			return openFileStore(path)
+		}
+	default:
+		_ = shared.Close(ctx)
+		return nil, fmt.Errorf("storage driver %s does not support tenant partitions", driver)
+	}
+	p.dir = strings.TrimSuffix(base, filepath.Ext(base)) + "_partitions"
+	if p.ext = filepath.Ext(base); p.ext == "" {
+		p.ext = ".db"
+	}
+
+	if err := p.loadPartitions(ctx); err != nil {
+		_ = p.Close(ctx)
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *partitionedStore) loadPartitions(ctx context.Context) error {
+	if err := os.MkdirAll(p.dir, 0o755); err != nil {
+		return fmt.Errorf("create partition directory: %w", err)
+	}
+	matches, err := filepath.Glob(filepath.Join(p.dir, "*"+p.ext))
+	if err != nil {
+		return fmt.Errorf("list partitions: %w", err)
+	}
+	for _, path := range matches {
+		tenant, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(path), p.ext))
+		if err != nil || tenant == "" {
+			continue
+		}
+		store, err := p.open(ctx, path)
+		if err != nil {
+			return fmt.Errorf("open partition of tenant %s: %w", tenant, err)
+		}
+		p.partitions[tenant] = store
+	}
+	return nil
+}
+
+func (p *partitionedStore) partitionPath(tenant string) string {
+	return filepath.Join(p.dir, url.PathEscape(tenant)+p.ext)
+}
+
+// partition returns the store that holds the tenant's data. With create unset a
+// tenant without data yields nil.
+func (p *partitionedStore) partition(ctx context.Context, tenant string, create bool) (Store, error) {
+	if tenant == "" {
+		return p.shared, nil
+	}
+
+	p.mu.RLock()
+	store, ok := p.partitions[tenant]
+	p.mu.RUnlock()
+	if ok || !create {
+		return store, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if store, ok := p.partitions[tenant]; ok {
+		return store, nil
+	}
+	store, err := p.open(ctx, p.partitionPath(tenant))
+	if err != nil {
+		return nil, fmt.Errorf("open partition of tenant %s: %w", tenant, err)
+	}
+	if p.logKey != nil {
+		if err := store.(RequestLogEncrypter).SetRequestLogKey(p.logKey); err != nil {
+			_ = store.Close(ctx)
+			return nil, err
+		}
+	}
+	p.partitions[tenant] = store
+	return store, nil
+}
+
+// all returns the shared store followed by every tenant partition.
+func (p *partitionedStore) all() []Store {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	stores := make([]Store, 0, len(p.partitions)+1)
+	stores = append(stores, p.shared)
+	for _, store := range p.partitions {
+		stores = append(stores, store)
+	}
+	return stores
+}
+
+func (p *partitionedStore) RecordUsage(ctx context.Context, record UsageRecord) error {
+	store, err := p.partition(ctx, record.Tenant, true)
+	if err != nil {
+		return err
+	}
+	return store.RecordUsage(ctx, record)
+}
+
+func (p *partitionedStore) QueryUsage(ctx context.Context, query UsageQuery) ([]UsageRecord, error) {
+	if query.Tenant != "" {
+		store, err := p.partition(ctx, query.Tenant, false)
+		if err != nil || store == nil {
+			return nil, err
+		}
+		return store.QueryUsage(ctx, query)
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	var records []UsageRecord
+	for _, store := range p.all() {
+		part, err := store.QueryUsage(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, part...)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].CreatedAt.After(records[j].CreatedAt)
+	})
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+func (p *partitionedStore) SumUsage(ctx context.Context, query UsageSumQuery) (UsageTotals, error) {
+	if query.Tenant != "" {
+		store, err := p.partition(ctx, query.Tenant, false)
+		if err != nil || store == nil {
+			return UsageTotals{}, err
+		}
+		return store.SumUsage(ctx, query)
+	}
+
+	var totals UsageTotals
+	for _, store := range p.all() {
+		part, err := store.SumUsage(ctx, query)
+		if err != nil {
+			return UsageTotals{}, err
+		}
+		totals.Add(part)
+	}
+	return totals, nil
+}
+
+func (p *partitionedStore) SumUsageByModel(ctx context.Context, query UsageSumQuery) (map[string]UsageTotals, error) {
+	if query.Tenant != "" {
+		store, err := p.partition(ctx, query.Tenant, false)
+		if err != nil || store == nil {
+			return map[string]UsageTotals{}, err
+		}
+		return store.SumUsageByModel(ctx, query)
+	}
+
+	result := make(map[string]UsageTotals)
+	for _, store := range p.all() {
+		part, err := store.SumUsageByModel(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for model, totals := range part {
+			sum := result[model]
+			sum.Add(totals)
+			result[model] = sum
+		}
+	}
+	return result, nil
+}
+
+func (p *partitionedStore) CleanupOldRecords(ctx context.Context, retentionDays int) (int64, error) {
+	var removed int64
+	for _, store := range p.all() {
+		n, err := store.CleanupOldRecords(ctx, retentionDays)
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+func (p *partitionedStore) RecordRequestLog(ctx context.Context, log RequestLog) error {
+	store, err := p.partition(ctx, log.Meta["tenant"], true)
+	if err != nil {
+		return err
+	}
+	return store.RecordRequestLog(ctx, log)
+}
+
+func (p *partitionedStore) SetRequestLogKey(key []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stores := []Store{p.shared}
+	for _, store := range p.partitions {
+		stores = append(stores, store)
+	}
+	for _, store := range stores {
+		encrypter, ok := store.(RequestLogEncrypter)
+		if !ok {
+			return errors.New("storage does not support request log encryption")
+		}
+		if err := encrypter.SetRequestLogKey(key); err != nil {
+			return err
+		}
+	}
+	p.logKey = key
+	return nil
+}
+
+func (p *partitionedStore) GetRequestLog(ctx context.Context, requestID string) (*RequestLog, error) {
+	for _, store := range p.all() {
+		log, err := store.GetRequestLog(ctx, requestID)
+		if err != nil || log != nil {
+			return log, err
+		}
+	}
+	return nil, nil
+}
+
+func (p *partitionedStore) CleanupOldRequestLogs(ctx context.Context, retentionDays int) (int64, error) {
+	var removed int64
+	for _, store := range p.all() {
+		n, err := store.CleanupOldRequestLogs(ctx, retentionDays)
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+func (p *partitionedStore) Ping(ctx context.Context) error {
+	for _, store := range p.all() {
+		if err := store.Ping(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *partitionedStore) Close(ctx context.Context) error {
+	var errs []error
+	for _, store := range p.all() {
+		if err := store.Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *partitionedStore) SaveTenant(ctx context.Context, tenant TenantRecord) error {
+	return p.shared.(TenantStore).SaveTenant(ctx, tenant)
+}
+
+func (p *partitionedStore) ListTenants(ctx context.Context) ([]TenantRecord, error) {
+	return p.shared.(TenantStore).ListTenants(ctx)
+}
+
+func (p *partitionedStore) RecordAlert(ctx context.Context, alert AlertRecord) error {
+	return p.shared.(AlertStore).RecordAlert(ctx, alert)
+}
+
+func (p *partitionedStore) QueryAlerts(ctx context.Context, query AlertQuery) ([]AlertRecord, error) {
+	return p.shared.(AlertStore).QueryAlerts(ctx, query)
+}
+
+func (p *partitionedStore) CleanupOldAlerts(ctx context.Context, retentionDays int) (int64, error) {
+	return p.shared.(AlertStore).CleanupOldAlerts(ctx, retentionDays)
+}
+
+func (p *partitionedStore) RecordAudit(ctx context.Context, record AuditRecord) error {
+	return p.shared.(AuditStore).RecordAudit(ctx, record)
+}
+
+func (p *partitionedStore) QueryAudit(ctx context.Context, query AuditQuery) ([]AuditRecord, error) {
+	return p.shared.(AuditStore).QueryAudit(ctx, query)
+}
+
+func (p *partitionedStore) CleanupOldAudit(ctx context.Context, retentionDays int) (int64, error) {
+	return p.shared.(AuditStore).CleanupOldAudit(ctx, retentionDays)
+}
+
+func (p *partitionedStore) ExportTenant(ctx context.Context, tenant, destPath string) error {
+	store, err := p.partition(ctx, tenant, false)
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		return fmt.Errorf("tenant %s has no stored data", tenant)
+	}
+	backuper, ok := store.(Backuper)
+	if !ok {
+		return errors.New("export is not supported by the configured storage")
+	}
+	return backuper.Backup(ctx, destPath)
+}
+
+// Backup writes one database holding the shared data and the data of every
+// tenant, so the snapshot can be downloaded as a single file.
+func (p *partitionedStore) Backup(ctx context.Context, destPath string) error {
+	backuper, ok := p.shared.(Backuper)
+	if !ok {
+		return errors.New("backup is not supported by the configured storage")
+	}
+	if err := backuper.Backup(ctx, destPath); err != nil {
+		return err
+	}
+	dest, err := p.open(ctx, destPath)
+	if err != nil {
+		return fmt.Errorf("open backup: %w", err)
+	}
+	defer dest.Close(ctx)
+	// The copied shared data keeps its sealed request logs; the tenant logs are
+	// exported decrypted and must be sealed with the same key.
+	if p.logKey != nil {
+		if err := dest.(RequestLogEncrypter).SetRequestLogKey(p.logKey); err != nil {
+			return err
+		}
+	}
+
+	stores := p.ordered()
+	for _, store := range stores[1:] {
+		if err := copyStore(ctx, store, dest); err != nil {
+			return fmt.Errorf("backup tenant partition: %w", err)
+		}
+	}
+	return nil
+}
+
+// copyStore appends the usage records and request logs of src to dest.
+func copyStore(ctx context.Context, src, dest Store) error {
+	exporter, ok := src.(Exporter)
+	if !ok {
+		return errors.New("storage does not support export")
+	}
+	importer, ok := dest.(Importer)
+	if !ok {
+		return errors.New("storage does not support import")
+	}
+	const batch = 500
+	for afterID := int64(0); ; {
+		records, err := exporter.ExportUsage(ctx, afterID, batch)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			break
+		}
+		afterID = records[len(records)-1].ID
+		if err := importer.ImportUsage(ctx, records); err != nil {
+			return err
+		}
+	}
+	for afterID := int64(0); ; {
+		logs, err := exporter.ExportRequestLogs(ctx, afterID, batch)
+		if err != nil || len(logs) == 0 {
+			return err
+		}
+		afterID = logs[len(logs)-1].ID
+		if err := importer.ImportRequestLogs(ctx, logs); err != nil {
+			return err
+		}
+	}
+}
+
+// ordered returns the shared store followed by the tenant partitions sorted by
+// tenant, the order in which the data is exported.
+func (p *partitionedStore) ordered() []Store {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	tenants := make([]string, 0, len(p.partitions))
+	for tenant := range p.partitions {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	stores := make([]Store, 0, len(tenants)+1)
+	stores = append(stores, p.shared)
+	for _, tenant := range tenants {
+		stores = append(stores, p.partitions[tenant])
+	}
+	return stores
+}
+
+// partitionIDBits is the number of low bits of an exported id that hold the id
+// within its store; the high bits hold the position of the store in ordered.
+const partitionIDBits = 40
+
+// exportPartitions reads the next entries after the exported id afterID,
+// moving on to the next store when one is exhausted. The ids of the returned
+// entries are exported ids, so they can be passed back as afterID.
+func exportPartitions[T any](ctx context.Context, stores []Store, afterID int64, read func(Exporter, int64) ([]T, error), id func(*T) *int64) ([]T, error) {
+	local := afterID & (1<<partitionIDBits - 1)
+	for i := int(afterID >> partitionIDBits); i < len(stores); i++ {
+		exporter, ok := stores[i].(Exporter)
+		if !ok {
+			return nil, errors.New("storage does not support export")
+		}
+		entries, err := read(exporter, local)
+		if err != nil || len(entries) > 0 {
+			for j := range entries {
+				*id(&entries[j]) |= int64(i) << partitionIDBits
+			}
+			return entries, err
+		}
+		local = 0
+	}
+	return nil, nil
+}
+
+func (p *partitionedStore) ExportUsage(ctx context.Context, afterID int64, limit int) ([]UsageRecord, error) {
+	return exportPartitions(ctx, p.ordered(), afterID,
+		func(e Exporter, after int64) ([]UsageRecord, error) { return e.ExportUsage(ctx, after, limit) },
+		func(r *UsageRecord) *int64 { return &r.ID })
+}
+
+func (p *partitionedStore) ExportRequestLogs(ctx context.Context, afterID int64, limit int) ([]RequestLog, error) {
+	return exportPartitions(ctx, p.ordered(), afterID,
+		func(e Exporter, after int64) ([]RequestLog, error) { return e.ExportRequestLogs(ctx, after, limit) },
+		func(l *RequestLog) *int64 { return &l.ID })
+}
+
+// ImportUsage writes each record to the partition of its tenant.
+func (p *partitionedStore) ImportUsage(ctx context.Context, records []UsageRecord) error {
+	byTenant := make(map[string][]UsageRecord)
+	for _, record := range records {
+		byTenant[record.Tenant] = append(byTenant[record.Tenant], record)
+	}
+	for tenant, batch := range byTenant {
+		store, err := p.partition(ctx, tenant, true)
+		if err != nil {
+			return err
+		}
+		importer, ok := store.(Importer)
+		if !ok {
+			return errors.New("storage does not support import")
+		}
+		if err := importer.ImportUsage(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportRequestLogs writes each request log to the partition of its tenant.
+func (p *partitionedStore) ImportRequestLogs(ctx context.Context, logs []RequestLog) error {
+	byTenant := make(map[string][]RequestLog)
+	for _, log := range logs {
+		byTenant[log.Meta["tenant"]] = append(byTenant[log.Meta["tenant"]], log)
+	}
+	for tenant, batch := range byTenant {
+		store, err := p.partition(ctx, tenant, true)
+		if err != nil {
+			return err
+		}
+		importer, ok := store.(Importer)
+		if !ok {
+			return errors.New("storage does not support import")
+		}
+		if err := importer.ImportRequestLogs(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *partitionedStore) DropTenant(ctx context.Context, tenant string) error {
+	if tenant == "" {
+		return errors.New("tenant is required")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	store, ok := p.partitions[tenant]
+	if !ok {
+		return nil
+	}
+	if err := store.Close(ctx); err != nil {
+		return fmt.Errorf("close partition of tenant %s: %w", tenant, err)
+	}
+	delete(p.partitions, tenant)
+
+	for _, path := range store.(partitionFiles).files() {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove partition file: %w", err)
+		}
+	}
+	return nil
+}
+
+// partitionFiles lists the files backing a store, so a partition can be removed.
+type partitionFiles interface {
+	files() []string
+}
+
+func (s *sqliteStore) files() []string {
+	return []string{s.path, s.path + "-wal", s.path + "-shm", s.path + "-journal"}
+}
+
+func (f *fileStore) files() []string {
+	return []string{f.usagePath, f.requestLogPath, f.tenantPath, f.responseLogPath}
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPartitionedStoreSeparatesTenants(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	uri := fmt.Sprintf("file:%s", filepath.Join(dir, "usage.db"))
+
+	store, err := NewPartitioned(ctx, "sqlite", uri)
+	if err != nil {
+		t.Fatalf("create partitioned store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close(ctx) })
+
+	now := time.Now()
+	records := []UsageRecord{
+		{CreatedAt: now.Add(-2 * time.Minute), Model: "shared", Outcome: "success", RequestTokens: 1},
+		{CreatedAt: now.Add(-time.Minute), Tenant: "team-a", Model: "a", Outcome: "success", RequestTokens: 10},
+		{CreatedAt: now, Tenant: "team-b", Model: "b", Outcome: "success", RequestTokens: 100},
+	}
+	for _, rec := range records {
+		if err := store.RecordUsage(ctx, rec); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+	if err := store.RecordRequestLog(ctx, RequestLog{RequestID: "req-a", Meta: map[string]string{"tenant": "team-a"}}); err != nil {
+		t.Fatalf("record request log: %v", err)
+	}
+
+	all, err := store.QueryUsage(ctx, UsageQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("query usage: %v", err)
+	}
+	if len(all) != 3 || all[0].Model != "b" || all[2].Model != "shared" {
+		t.Fatalf("unexpected merged records: %+v", all)
+	}
+	totals, err := store.SumUsage(ctx, UsageSumQuery{Tenant: "team-a"})
+	if err != nil {
+		t.Fatalf("sum usage: %v", err)
+	}
+	if totals.RequestTokens != 10 {
+		t.Fatalf("expected 10 tokens for team-a, got %d", totals.RequestTokens)
+	}
+	if log, err := store.GetRequestLog(ctx, "req-a"); err != nil || log == nil {
+		t.Fatalf("expected request log from team-a partition, got %v, %v", log, err)
+	}
+
+	partitioner := store.(TenantPartitioner)
+	exportPath := filepath.Join(dir, "export", "team-a.db")
+	if err := partitioner.ExportTenant(ctx, "team-a", exportPath); err != nil {
+		t.Fatalf("export tenant: %v", err)
+	}
+	exported, err := New(ctx, "sqlite", fmt.Sprintf("file:%s", exportPath))
+	if err != nil {
+		t.Fatalf("open export: %v", err)
+	}
+	exportedRecords, err := exported.QueryUsage(ctx, UsageQuery{Limit: 10})
+	_ = exported.Close(ctx)
+	if err != nil || len(exportedRecords) != 1 || exportedRecords[0].Tenant != "team-a" {
+		t.Fatalf("unexpected exported records: %+v, %v", exportedRecords, err)
+	}
+
+	if err := partitioner.DropTenant(ctx, "team-a"); err != nil {
+		t.Fatalf("drop tenant: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "usage_partitions", "team-a.db")); !os.IsNotExist(err) {
+		t.Fatalf("expected partition file to be removed, got %v", err)
+	}
+	remaining, err := store.QueryUsage(ctx, UsageQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("query usage after drop: %v", err)
+	}
+	if len(remaining) != 2 {
+		t.Fatalf("expected other tenants to be untouched, got %+v", remaining)
+	}
+
+	// Partitions are picked up again after a restart.
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("close store: %v", err)
+	}
+	reopened, err := NewPartitioned(ctx, "sqlite", uri)
+	if err != nil {
+		t.Fatalf("reopen partitioned store: %v", err)
+	}
+	t.Cleanup(func() { _ = reopened.Close(ctx) })
+	teamB, err := reopened.QueryUsage(ctx, UsageQuery{Limit: 10, Tenant: "team-b"})
+	if err != nil || len(teamB) != 1 {
+		t.Fatalf("expected team-b record after reopen, got %+v, %v", teamB, err)
+	}
+}
+
+func TestPartitionedStoreBackupAndExport(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewPartitioned(ctx, "sqlite", fmt.Sprintf("file:%s", filepath.Join(dir, "usage.db")))
+	if err != nil {
+		t.Fatalf("create partitioned store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close(ctx) })
+	for _, tenant := range []string{"", "team-b", "team-a", "team-a"} {
+		if err := store.RecordUsage(ctx, UsageRecord{CreatedAt: time.Now(), Tenant: tenant, Outcome: "success", RequestTokens: 1}); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+	if err := store.RecordRequestLog(ctx, RequestLog{RequestID: "req-b", Meta: map[string]string{"tenant": "team-b"}}); err != nil {
+		t.Fatalf("record request log: %v", err)
+	}
+
+	// Export in batches smaller than a partition, as migrate-storage does.
+	exporter := store.(Exporter)
+	var exported []UsageRecord
+	for afterID := int64(0); ; {
+		batch, err := exporter.ExportUsage(ctx, afterID, 1)
+		if err != nil {
+			t.Fatalf("export usage: %v", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+		exported = append(exported, batch...)
+		afterID = batch[len(batch)-1].ID
+	}
+	if len(exported) != 4 || exported[0].Tenant != "" || exported[1].Tenant != "team-a" || exported[3].Tenant != "team-b" {
+		t.Fatalf("unexpected exported records: %+v", exported)
+	}
+
+	backupPath := filepath.Join(dir, "backup.db")
+	if err := store.(Backuper).Backup(ctx, backupPath); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	backup, err := New(ctx, "sqlite", fmt.Sprintf("file:%s", backupPath))
+	if err != nil {
+		t.Fatalf("open backup: %v", err)
+	}
+	defer backup.Close(ctx)
+	totals, err := backup.SumUsage(ctx, UsageSumQuery{})
+	if err != nil || totals.RequestTokens != 4 {
+		t.Fatalf("expected every partition in the backup, got %+v, %v", totals, err)
+	}
+	if log, err := backup.GetRequestLog(ctx, "req-b"); err != nil || log == nil {
+		t.Fatalf("expected the tenant request log in the backup, got %v, %v", log, err)
+	}
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ResponseLog is the final response body of a sampled request, stored next to
+// its request log for offline comparison of providers.
+type ResponseLog struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	RequestID  string    `json:"request_id"`
+	Tenant     string    `json:"tenant,omitempty"`
+	Provider   string    `json:"provider"`
+	Model      string    `json:"model"`
+	StatusCode int       `json:"status_code"`
+	Body       string    `json:"body"`
+	// Truncated reports that Body was cut at the configured size cap
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ResponseLogStore is implemented by stores that keep response bodies.
+type ResponseLogStore interface {
+	RecordResponseLog(ctx context.Context, log ResponseLog) error
+	// GetResponseLog returns the latest response log of the request, or nil.
+	GetResponseLog(ctx context.Context, requestID string) (*ResponseLog, error)
+	// CleanupOldResponseLogs removes response logs older than retentionDays.
+	CleanupOldResponseLogs(ctx context.Context, retentionDays int) (int64, error)
+}
+
+func (s *sqliteStore) RecordResponseLog(ctx context.Context, log ResponseLog) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if s.writer != nil {
+		return s.writer.do(ctx, func(ctx context.Context, tx execer) error {
+			return s.insertResponseLog(ctx, tx, log)
+		})
+	}
+	return s.insertResponseLog(ctx, s.db, log)
+}
+
+func (s *sqliteStore) insertResponseLog(ctx context.Context, db execer, log ResponseLog) error {
+	if log.CreatedAt.IsZero() {
+		log.CreatedAt = time.Now()
+	}
+	body := log.Body
+	if s.logCipher != nil {
+		var err error
+		if body, err = seal(s.logCipher, body); err != nil {
+			return err
+		}
+	}
+	_, err := db.ExecContext(ctx, `INSERT INTO response_logs
+		(created_at, request_id, tenant, provider, model, status, body, truncated)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		log.CreatedAt.Format(time.RFC3339Nano), log.RequestID, log.Tenant, log.Provider, log.Model, log.StatusCode, body, log.Truncated)
+	if err != nil {
+		return fmt.Errorf("insert response log: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) GetResponseLog(ctx context.Context, requestID string) (*ResponseLog, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if strings.TrimSpace(requestID) == "" {
+		return nil, errors.New("request id is required")
+	}
+
+	var (
+		log       ResponseLog
+		createdAt string
+	)
+	err := s.db.QueryRowContext(ctx, `SELECT id, created_at, request_id, tenant, provider, model, status, body, truncated
+		FROM response_logs WHERE request_id = ? ORDER BY id DESC LIMIT 1`, requestID).
+		Scan(&log.ID, &createdAt, &log.RequestID, &log.Tenant, &log.Provider, &log.Model, &log.StatusCode, &log.Body, &log.Truncated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query response log: %w", err)
+	}
+	if parsed, err := time.Parse(time.RFC3339Nano, createdAt); err == nil {
+		log.CreatedAt = parsed
+	}
+	if log.Body, err = unseal(s.logCipher, log.Body); err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+func (s *sqliteStore) CleanupOldResponseLogs(ctx context.Context, retentionDays int) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	result, err := s.db.ExecContext(ctx, `DELETE FROM response_logs WHERE datetime(created_at) < datetime(?)`, cutoff.Format(time.RFC3339Nano))
+	if err != nil {
+		return 0, fmt.Errorf("cleanup old response logs: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("response log rows affected: %w", err)
+	}
+	return rows, nil
+}
+
+func (f *fileStore) RecordResponseLog(_ context.Context, log ResponseLog) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	log.ID = int64(len(f.responseLogs)) + 1
+	if log.CreatedAt.IsZero() {
+		log.CreatedAt = time.Now()
+	}
+	stored := log
+	if f.logCipher != nil {
+		var err error
+		if stored.Body, err = seal(f.logCipher, log.Body); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("encode response log: %w", err)
+	}
+	file, err := os.OpenFile(f.responseLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open response log store: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write response log: %w", err)
+	}
+
+	f.responseLogs = append(f.responseLogs, stored)
+	return nil
+}
+
+func (f *fileStore) GetResponseLog(_ context.Context, requestID string) (*ResponseLog, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for i := len(f.responseLogs) - 1; i >= 0; i-- {
+		if f.responseLogs[i].RequestID != requestID {
+			continue
+		}
+		log := f.responseLogs[i]
+		var err error
+		if log.Body, err = unseal(f.logCipher, log.Body); err != nil {
+			return nil, err
+		}
+		return &log, nil
+	}
+	return nil, nil
+}
+
+func (f *fileStore) CleanupOldResponseLogs(_ context.Context, retentionDays int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	var kept []ResponseLog
+	var removed int64
+	for _, log := range f.responseLogs {
+		if log.CreatedAt.After(cutoff) {
+			kept = append(kept, log)
+		} else {
+			removed++
+		}
+	}
+	f.responseLogs = kept
+
+	file, err := os.OpenFile(f.responseLogPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("open response log for cleanup: %w", err)
+	}
+	defer file.Close()
+	for _, log := range f.responseLogs {
+		data, err := json.Marshal(log)
+		if err != nil {
+			return 0, fmt.Errorf("encode response log during cleanup: %w", err)
+		}
+		if _, err := file.Write(append(data, '\n')); err != nil {
+			return 0, fmt.Errorf("write response log during cleanup: %w", err)
+		}
+	}
+	return removed, nil
+}
+
+func (f *fileStore) loadResponseLogs() error {
+	file, err := os.OpenFile(f.responseLogPath, os.O_RDONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open response log store: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var log ResponseLog
+		if err := json.Unmarshal([]byte(line), &log); err != nil {
+			return fmt.Errorf("decode response log: %w", err)
+		}
+		f.responseLogs = append(f.responseLogs, log)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read response logs: %w", err)
+	}
+	return nil
+}
+
+func (p *partitionedStore) RecordResponseLog(ctx context.Context, log ResponseLog) error {
+	store, err := p.partition(ctx, log.Tenant, true)
+	if err != nil {
+		return err
+	}
+	return store.(ResponseLogStore).RecordResponseLog(ctx, log)
+}
+
+func (p *partitionedStore) GetResponseLog(ctx context.Context, requestID string) (*ResponseLog, error) {
+	for _, store := range p.all() {
+		log, err := store.(ResponseLogStore).GetResponseLog(ctx, requestID)
+		if err != nil || log != nil {
+			return log, err
+		}
+	}
+	return nil, nil
+}
+
+func (p *partitionedStore) CleanupOldResponseLogs(ctx context.Context, retentionDays int) (int64, error) {
+	var removed int64
+	for _, store := range p.all() {
+		n, err := store.(ResponseLogStore).CleanupOldResponseLogs(ctx, retentionDays)
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+	return removed, nil
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SessionUsageQuery selects the usage records of a session.
+type SessionUsageQuery struct {
+	Session string
+	// Tenant restricts results to a single tenant when set
+	Tenant string
+}
+
+// ProviderModelTotals aggregates the usage records served by one provider
+// model.
+type ProviderModelTotals struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	UsageTotals
+	FirstAt time.Time `json:"first_at"`
+	LastAt  time.Time `json:"last_at"`
+}
+
+// SessionStore is implemented by stores that aggregate usage per session.
+type SessionStore interface {
+	// SumSessionUsage returns the totals of the session per provider and
+	// provider model, sorted by provider and model.
+	SumSessionUsage(ctx context.Context, query SessionUsageQuery) ([]ProviderModelTotals, error)
+}
+
+// ProviderModelSummer is implemented by stores that aggregate usage per
+// provider model, which is what costs are priced by.
+type ProviderModelSummer interface {
+	// SumUsageByProviderModel aggregates like SumUsage per provider and
+	// provider model, sorted by provider and model.
+	SumUsageByProviderModel(ctx context.Context, query UsageSumQuery) ([]ProviderModelTotals, error)
+}
+
+// errSessionRequired rejects session queries without a session.
+var errSessionRequired = errors.New("session is required")
+
+func (s *sqliteStore) SumSessionUsage(ctx context.Context, query SessionUsageQuery) ([]ProviderModelTotals, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if strings.TrimSpace(query.Session) == "" {
+		return nil, errSessionRequired
+	}
+
+	querySQL := "SELECT COALESCE(provider, ''), COALESCE(model, ''), MIN(created_at), MAX(created_at), " + sumUsageColumns +
+		" FROM usage_records WHERE session = ?"
+	args := []interface{}{query.Session}
+	if strings.TrimSpace(query.Tenant) != "" {
+		querySQL += " AND tenant = ?"
+		args = append(args, query.Tenant)
+	}
+	querySQL += " GROUP BY COALESCE(provider, ''), COALESCE(model, '') ORDER BY 1, 2"
+
+	rows, err := s.db.QueryContext(ctx, querySQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sum session usage: %w", err)
+	}
+	return scanProviderModelTotals(rows)
+}
+
+// scanProviderModelTotals reads rows of provider, model, first and last
+// creation time and sumUsageColumns, and closes them.
+func scanProviderModelTotals(rows *sql.Rows) ([]ProviderModelTotals, error) {
+	defer rows.Close()
+
+	var result []ProviderModelTotals
+	for rows.Next() {
+		var (
+			totals        ProviderModelTotals
+			first, lastAt string
+		)
+		if err := rows.Scan(&totals.Provider, &totals.Model, &first, &lastAt, &totals.Requests, &totals.Failures, &totals.RequestTokens, &totals.ResponseTokens); err != nil {
+			return nil, fmt.Errorf("scan provider model totals: %w", err)
+		}
+		totals.FirstAt, _ = time.Parse(time.RFC3339Nano, first)
+		totals.LastAt, _ = time.Parse(time.RFC3339Nano, lastAt)
+		result = append(result, totals)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate provider model totals: %w", err)
+	}
+	return result, nil
+}
+
+func (f *fileStore) SumSessionUsage(_ context.Context, query SessionUsageQuery) ([]ProviderModelTotals, error) {
+	if strings.TrimSpace(query.Session) == "" {
+		return nil, errSessionRequired
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	tenant := strings.TrimSpace(query.Tenant)
+	var result []ProviderModelTotals
+	for _, rec := range f.records {
+		if rec.Session != query.Session || (tenant != "" && rec.Tenant != tenant) {
+			continue
+		}
+		result = mergeProviderModelTotals(result, providerModelTotalsOf(rec))
+	}
+	sortProviderModelTotals(result)
+	return result, nil
+}
+
+func (p *partitionedStore) SumSessionUsage(ctx context.Context, query SessionUsageQuery) ([]ProviderModelTotals, error) {
+	if query.Tenant != "" {
+		store, err := p.partition(ctx, query.Tenant, false)
+		if err != nil || store == nil {
+			return nil, err
+		}
+		return store.(SessionStore).SumSessionUsage(ctx, query)
+	}
+
+	var result []ProviderModelTotals
+	for _, store := range p.all() {
+		part, err := store.(SessionStore).SumSessionUsage(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, totals := range part {
+			result = mergeProviderModelTotals(result, totals)
+		}
+	}
+	sortProviderModelTotals(result)
+	return result, nil
+}
+
+// mergeProviderModelTotals merges totals into the entry of the same provider model.
+func mergeProviderModelTotals(result []ProviderModelTotals, totals ProviderModelTotals) []ProviderModelTotals {
+	for i := range result {
+		entry := &result[i]
+		if entry.Provider != totals.Provider || entry.Model != totals.Model {
+			continue
+		}
+		entry.Add(totals.UsageTotals)
+		if totals.FirstAt.Before(entry.FirstAt) {
+			entry.FirstAt = totals.FirstAt
+		}
+		if totals.LastAt.After(entry.LastAt) {
+			entry.LastAt = totals.LastAt
+		}
+		return result
+	}
+	return append(result, totals)
+}
+
+func providerModelTotalsOf(rec UsageRecord) ProviderModelTotals {
+	return ProviderModelTotals{
+		Provider:    rec.Provider,
+		Model:       rec.Model,
+		UsageTotals: totalsOf(rec),
+		FirstAt:     rec.CreatedAt,
+		LastAt:      rec.CreatedAt,
+	}
+}
+
+func sortProviderModelTotals(result []ProviderModelTotals) {
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Provider != result[j].Provider {
+			return result[i].Provider < result[j].Provider
+		}
+		return result[i].Model < result[j].Model
+	})
+}
+
+func (s *sqliteStore) SumUsageByProviderModel(ctx context.Context, query UsageSumQuery) ([]ProviderModelTotals, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	where, args := sumUsageWhere(query)
+	querySQL := "SELECT COALESCE(provider, ''), COALESCE(model, ''), MIN(created_at), MAX(created_at), " + sumUsageColumns +
+		" FROM usage_records" + where + " GROUP BY COALESCE(provider, ''), COALESCE(model, '') ORDER BY 1, 2"
+	rows, err := s.db.QueryContext(ctx, querySQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sum usage records by provider model: %w", err)
+	}
+	return scanProviderModelTotals(rows)
+}
+
+func (f *fileStore) SumUsageByProviderModel(_ context.Context, query UsageSumQuery) ([]ProviderModelTotals, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var result []ProviderModelTotals
+	for _, rec := range f.records {
+		if !matchesSumQuery(rec, query) {
+			continue
+		}
+		result = mergeProviderModelTotals(result, providerModelTotalsOf(rec))
+	}
+	sortProviderModelTotals(result)
+	return result, nil
+}
+
+func (p *partitionedStore) SumUsageByProviderModel(ctx context.Context, query UsageSumQuery) ([]ProviderModelTotals, error) {
+	if query.Tenant != "" {
+		store, err := p.partition(ctx, query.Tenant, false)
+		if err != nil || store == nil {
+			return nil, err
+		}
+		return store.(ProviderModelSummer).SumUsageByProviderModel(ctx, query)
+	}
+
+	var result []ProviderModelTotals
+	for _, store := range p.all() {
+		part, err := store.(ProviderModelSummer).SumUsageByProviderModel(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, totals := range part {
+			result = mergeProviderModelTotals(result, totals)
+		}
+	}
+	sortProviderModelTotals(result)
+	return result, nil
+}
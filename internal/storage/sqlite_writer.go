@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SQLiteOptions tunes the sqlite store for write heavy traffic.
+type SQLiteOptions struct {
+	// JournalMode and Synchronous set the journal_mode and synchronous
+	// pragmas; the driver defaults apply when empty
+	JournalMode string
+	Synchronous string
+	// BusyTimeout is how long a statement waits for a locked database; the
+	// driver default (5s) applies when zero
+	BusyTimeout time.Duration
+	// WriteBatchSize routes usage records and request logs through a single
+	// writer committing up to this many in one transaction; 0 writes directly
+	WriteBatchSize int
+	// WriteFlushInterval is how long the writer waits for a batch to fill
+	WriteFlushInterval time.Duration
+	// CheckpointInterval runs a truncating WAL checkpoint periodically; 0
+	// leaves checkpoints to sqlite
+	CheckpointInterval time.Duration
+}
+
+// Option configures a store created by New or NewPartitioned.
+type Option func(*options)
+
+type options struct {
+	sqlite SQLiteOptions
+}
+
+// WithSQLite applies opts to sqlite stores; other drivers ignore it.
+func WithSQLite(opts SQLiteOptions) Option {
+	return func(o *options) {
+		o.sqlite = opts
+	}
+}
+
+func applyOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// sqliteDSN builds the connection string of a database file.
+func sqliteDSN(path string, pragmas []string, opts SQLiteOptions) string {
+	var params []string
+	for _, pragma := range pragmas {
+		params = append(params, "_pragma="+pragma)
+	}
+	if opts.JournalMode != "" {
+		params = append(params, "_journal_mode="+url.QueryEscape(strings.ToUpper(opts.JournalMode)))
+	}
+	if opts.Synchronous != "" {
+		params = append(params, "_synchronous="+url.QueryEscape(strings.ToUpper(opts.Synchronous)))
+	}
+	if opts.BusyTimeout > 0 {
+		params = append(params, "_busy_timeout="+strconv.FormatInt(opts.BusyTimeout.Milliseconds(), 10))
+	}
+	if len(params) == 0 {
+		return path
+	}
+	return path + "?" + strings.Join(params, "&")
+}
+
+// writeOp is a write run by the single writer within a batch transaction.
+type writeOp struct {
+	ctx   context.Context
+	apply func(ctx context.Context, tx execer) error
+	done  chan error
+}
+
+// sqliteWriter serializes the writes of a store through one goroutine that
+// commits them in batches, so concurrent requests do not contend for the
+// database lock.
+type sqliteWriter struct {
+	db        *sql.DB
+	ops       chan writeOp
+	batchSize int
+	flush     time.Duration
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	// pending counts the operations queued or in a batch not committed yet
+	pending atomic.Int64
+}
+
+var errWriterClosed = errors.New("sqlite writer is closed")
+
+func newSQLiteWriter(db *sql.DB, batchSize int, flush time.Duration) *sqliteWriter {
+	if flush <= 0 {
+		flush = 50 * time.Millisecond
+	}
+	w := &sqliteWriter{
+		db:        db,
+		ops:       make(chan writeOp, batchSize*4),
+		batchSize: batchSize,
+		flush:     flush,
+		stop:      make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+// do queues apply and waits until its batch is committed.
+func (w *sqliteWriter) do(ctx context.Context, apply func(ctx context.Context, tx execer) error) error {
+	op := writeOp{ctx: context.WithoutCancel(ctx), apply: apply, done: make(chan error, 1)}
+	select {
+	case <-w.stop:
+		return errWriterClosed
+	default:
+	}
+	w.pending.Add(1)
+	select {
+	case w.ops <- op:
+	case <-w.stop:
+		w.pending.Add(-1)
+		return errWriterClosed
+	case <-ctx.Done():
+		w.pending.Add(-1)
+		return ctx.Err()
+	}
+	select {
+	case err := <-op.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *sqliteWriter) run() {
+	defer w.wg.Done()
+	for {
+		select {
+		case op := <-w.ops:
+			w.commit(w.collect(op))
+		case <-w.stop:
+			// Writes queued before Close are still committed.
+			for {
+				select {
+				case op := <-w.ops:
+					w.commit(w.collect(op))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// collect gathers the operations queued with first, until the batch is full
+// or the flush interval passes.
+func (w *sqliteWriter) collect(first writeOp) []writeOp {
+	batch := []writeOp{first}
+	timer := time.NewTimer(w.flush)
+	defer timer.Stop()
+	for len(batch) < w.batchSize {
+		select {
+		case op := <-w.ops:
+			batch = append(batch, op)
+		case <-timer.C:
+			return batch
+		case <-w.stop:
+			return batch
+		}
+	}
+	return batch
+}
+
+// commit runs a batch in one transaction. A failed operation only fails its
+// own caller; a failed commit fails them all.
+func (w *sqliteWriter) commit(batch []writeOp) {
+	defer w.pending.Add(-int64(len(batch)))
+	tx, err := w.db.Begin()
+	if err != nil {
+		for _, op := range batch {
+			op.done <- fmt.Errorf("begin write batch: %w", err)
+		}
+		return
+	}
+	errs := make([]error, len(batch))
+	for i, op := range batch {
+		errs[i] = op.apply(op.ctx, tx)
+	}
+	if err := tx.Commit(); err != nil {
+		for _, op := range batch {
+			op.done <- fmt.Errorf("commit write batch: %w", err)
+		}
+		return
+	}
+	for i, op := range batch {
+		op.done <- errs[i]
+	}
+}
+
+func (w *sqliteWriter) close() {
+	w.closeOnce.Do(func() {
+		close(w.stop)
+	})
+	w.wg.Wait()
+}
+
+// runCheckpoints truncates the WAL every interval until stop is closed, so it
+// does not grow without bound under constant writes.
+func (s *sqliteStore) runCheckpoints(interval time.Duration, stop <-chan struct{}) {
+	defer s.background.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// A checkpoint blocked by readers is retried with the next tick.
+			_, _ = s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Stats describes the size and write backlog of a store.
+type Stats struct {
+	Driver string `json:"driver"`
+	// SizeBytes is the size of the files backing the store
+	SizeBytes int64 `json:"size_bytes"`
+	// Rows counts the rows of each table, or the records of each file
+	Rows map[string]int64 `json:"rows"`
+	// PendingWrites is the number of writes queued and not committed yet
+	PendingWrites int64 `json:"pending_writes"`
+	// Partitions is the number of tenant partitions, with storage_partition_by_tenant
+	Partitions int `json:"partitions,omitempty"`
+}
+
+// StatsReporter is implemented by stores that report their size and row counts.
+type StatsReporter interface {
+	Stats(ctx context.Context) (Stats, error)
+}
+
+// Vacuumer is implemented by stores that can rebuild their files to reclaim
+// the space of deleted rows.
+type Vacuumer interface {
+	Vacuum(ctx context.Context) error
+}
+
+// ErrVacuumNotSupported is returned by Vacuum when none of the stores can vacuum.
+var ErrVacuumNotSupported = errors.New("vacuum is not supported by the configured storage")
+
+// sqliteTables are the tables whose rows are counted in the stats.
+var sqliteTables = []string{"usage_records", "request_logs", "response_logs", "tenants", "alerts", "audit_log"}
+
+func (s *sqliteStore) Stats(ctx context.Context) (Stats, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	stats := Stats{Driver: "sqlite", SizeBytes: filesSize(s.files()), Rows: map[string]int64{}}
+	for _, table := range sqliteTables {
+		var count int64
+		if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&count); err != nil {
+			return Stats{}, fmt.Errorf("count %s rows: %w", table, err)
+		}
+		stats.Rows[table] = count
+	}
+	if s.writer != nil {
+		stats.PendingWrites = s.writer.pending.Load()
+	}
+	return stats, nil
+}
+
+// Vacuum rebuilds the database file. Writes wait for it to finish.
+func (s *sqliteStore) Vacuum(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, err := s.db.ExecContext(ctx, "VACUUM"); err != nil {
+		return fmt.Errorf("vacuum sqlite database: %w", err)
+	}
+	return nil
+}
+
+func (f *fileStore) Stats(_ context.Context) (Stats, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return Stats{
+		Driver:    "file",
+		SizeBytes: filesSize([]string{f.usagePath, f.requestLogPath, f.tenantPath, f.alertPath, f.auditPath, f.responseLogPath}),
+		Rows: map[string]int64{
+			"usage_records": int64(len(f.records)),
+			"request_logs":  int64(len(f.requestLogs)),
+			"response_logs": int64(len(f.responseLogs)),
+			"tenants":       int64(len(f.tenants)),
+			"alerts":        int64(len(f.alerts)),
+			"audit_log":     int64(len(f.audit)),
+		},
+	}, nil
+}
+
+// Stats adds up the stats of the shared store and every partition.
+func (p *partitionedStore) Stats(ctx context.Context) (Stats, error) {
+	stores := p.all()
+	stats := Stats{Rows: map[string]int64{}, Partitions: len(stores) - 1}
+	for _, store := range stores {
+		reporter, ok := store.(StatsReporter)
+		if !ok {
+			continue
+		}
+		part, err := reporter.Stats(ctx)
+		if err != nil {
+			return Stats{}, err
+		}
+		stats.Driver = part.Driver
+		stats.SizeBytes += part.SizeBytes
+		stats.PendingWrites += part.PendingWrites
+		for table, count := range part.Rows {
+			stats.Rows[table] += count
+		}
+	}
+	return stats, nil
+}
+
+// Vacuum vacuums the shared store and every partition.
+func (p *partitionedStore) Vacuum(ctx context.Context) error {
+	vacuumed := false
+	for _, store := range p.all() {
+		vacuumer, ok := store.(Vacuumer)
+		if !ok {
+			continue
+		}
+		if err := vacuumer.Vacuum(ctx); err != nil {
+			return err
+		}
+		vacuumed = true
+	}
+	if !vacuumed {
+		return ErrVacuumNotSupported
+	}
+	return nil
+}
+
+// filesSize adds up the size of the files that exist.
+func filesSize(paths []string) int64 {
+	var size int64
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"bufio"
 	"context"
+	"crypto/cipher"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -19,14 +20,23 @@ import (
 )
 
 type UsageRecord struct {
-	ID                int64         `json:"id"`
-	CreatedAt         time.Time     `json:"created_at"`
-	Path              string        `json:"path"`
-	Provider          string        `json:"provider"`
-	Model             string        `json:"model"`
-	OriginalModel     string        `json:"original_model"`
-	ProviderRequestID string        `json:"provider_request_id"`
-	RequestID         string        `json:"request_id"`
+	ID                int64     `json:"id"`
+	CreatedAt         time.Time `json:"created_at"`
+	Path              string    `json:"path"`
+	Provider          string    `json:"provider"`
+	Model             string    `json:"model"`
+	OriginalModel     string    `json:"original_model"`
+	ProviderRequestID string    `json:"provider_request_id"`
+	RequestID         string    `json:"request_id"`
+	Tenant            string    `json:"tenant,omitempty"`
+	Route             string    `json:"route,omitempty"`
+	Moderation        string    `json:"moderation,omitempty"`
+	// Session groups the requests of a multi-turn conversation or agent run
+	Session string `json:"session,omitempty"`
+	// KeyID identifies the API key of the request by a digest, never the key itself
+	KeyID string `json:"key_id,omitempty"`
+	// KeyName is the configured name of the API key of the request
+	KeyName           string        `json:"key_name,omitempty"`
 	Attempt           int           `json:"attempt"`
 	RequestTokens     int           `json:"request_tokens"`
 	ResponseTokens    int           `json:"response_tokens"`
@@ -37,6 +47,20 @@ type UsageRecord struct {
 	Error             string        `json:"error,omitempty"`
 }
 
+// OutcomeClientCancelled marks a request the client abandoned before the
+// response completed; its tokens are those generated until then.
+const OutcomeClientCancelled = "client_cancelled"
+
+// OutcomeSlowClient marks a stream the gateway ended because the client did
+// not read it fast enough; its tokens are those sent until then.
+const OutcomeSlowClient = "slow_client"
+
+// Billable reports whether the tokens of the record count towards usage
+// totals and budgets.
+func (r UsageRecord) Billable() bool {
+	return r.Outcome == "success" || r.Outcome == OutcomeClientCancelled || r.Outcome == OutcomeSlowClient
+}
+
 type RequestLog struct {
 	ID        int64               `json:"id"`
 	CreatedAt time.Time           `json:"created_at"`
@@ -48,40 +72,102 @@ type RequestLog struct {
 	Meta      map[string]string   `json:"meta,omitempty"`
 	Tags      map[string]string   `json:"tags,omitempty"`
 	Extra     map[string]any      `json:"extra,omitempty"`
+	// Response is the stored response of the request, when response logs are on
+	Response *ResponseLog `json:"response,omitempty"`
 }
 
 type UsageQuery struct {
 	Limit     int
 	RequestID string
+	// Tenant restricts results to a single tenant when set
+	Tenant string
+	// KeyID restricts results to the records of one API key digest when set
+	KeyID string
+	// KeyName restricts results to the records of one named API key when set
+	KeyName string
+	// Since excludes records created before it when set
+	Since time.Time
+}
+
+// UsageSumQuery selects the usage records aggregated by SumUsage.
+type UsageSumQuery struct {
+	Since time.Time
+	// Until excludes records created at or after it when set
+	Until  time.Time
+	Tenant string
+	// KeyID restricts the totals to the records of one API key digest when set
+	KeyID string
+}
+
+// UsageTotals aggregates usage records. Token totals only include successful requests.
+type UsageTotals struct {
+	Requests       int64 `json:"requests"`
+	Failures       int64 `json:"failures"`
+	RequestTokens  int64 `json:"request_tokens"`
+	ResponseTokens int64 `json:"response_tokens"`
+}
+
+// Add accumulates other into t.
+func (t *UsageTotals) Add(other UsageTotals) {
+	t.Requests += other.Requests
+	t.Failures += other.Failures
+	t.RequestTokens += other.RequestTokens
+	t.ResponseTokens += other.ResponseTokens
 }
 
 type Store interface {
 	RecordUsage(ctx context.Context, record UsageRecord) error
 	QueryUsage(ctx context.Context, query UsageQuery) ([]UsageRecord, error)
+	SumUsage(ctx context.Context, query UsageSumQuery) (UsageTotals, error)
+	// SumUsageByModel aggregates like SumUsage, keyed by the model requested by the client.
+	SumUsageByModel(ctx context.Context, query UsageSumQuery) (map[string]UsageTotals, error)
 	CleanupOldRecords(ctx context.Context, retentionDays int) (int64, error)
 	RecordRequestLog(ctx context.Context, log RequestLog) error
 	GetRequestLog(ctx context.Context, requestID string) (*RequestLog, error)
 	CleanupOldRequestLogs(ctx context.Context, retentionDays int) (int64, error)
+	// Ping verifies that the underlying storage is reachable and writable.
+	Ping(ctx context.Context) error
 	Close(ctx context.Context) error
 }
 
+// Backuper is implemented by stores that can produce a consistent snapshot of
+// their data while the gateway keeps serving traffic.
+type Backuper interface {
+	Backup(ctx context.Context, destPath string) error
+}
+
 type sqliteStore struct {
-	db      *sql.DB
-	path    string
-	pragmas []string
+	db        *sql.DB
+	path      string
+	pragmas   []string
+	options   SQLiteOptions
+	logCipher cipher.AEAD
+	// writer batches usage records and request logs when write batching is on
+	writer         *sqliteWriter
+	stopBackground chan struct{}
+	background     sync.WaitGroup
 }
 
 type fileStore struct {
 	mu               sync.RWMutex
 	usagePath        string
 	requestLogPath   string
+	tenantPath       string
+	alertPath        string
+	auditPath        string
+	responseLogPath  string
 	records          []UsageRecord
 	requestLogs      []RequestLog
+	logCipher        cipher.AEAD
+	tenants          []TenantRecord
+	alerts           []AlertRecord
+	audit            []AuditRecord
+	responseLogs     []ResponseLog
 	nextID           int64
 	nextRequestLogID int64
 }
 
-func New(ctx context.Context, driver, uri string) (Store, error) {
+func New(ctx context.Context, driver, uri string, opts ...Option) (Store, error) {
 	driver = normalizeDriver(driver)
 	if driver == "" {
 		return nil, errors.New("storage driver is required")
@@ -95,7 +181,7 @@ func New(ctx context.Context, driver, uri string) (Store, error) {
 
 	switch driver {
 	case "sqlite":
-		store, err := newSQLiteStore(ctx, uri)
+		store, err := newSQLiteStore(ctx, uri, applyOptions(opts).sqlite)
 		if err != nil {
 			return nil, err
 		}
@@ -108,54 +194,63 @@ func New(ctx context.Context, driver, uri string) (Store, error) {
 		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 			return nil, fmt.Errorf("create storage directory: %w", err)
 		}
-		requestLogPath := strings.TrimSuffix(path, filepath.Ext(path)) + "_requests.jsonl"
-		fs := &fileStore{usagePath: path, requestLogPath: requestLogPath}
-		if err := fs.load(); err != nil {
-			return nil, err
-		}
-		return fs, nil
+		return openFileStore(path)
 	default:
 		return nil, fmt.Errorf("unsupported storage driver %s", driver)
 	}
 }
 
-func newSQLiteStore(ctx context.Context, uri string) (*sqliteStore, error) {
+func newSQLiteStore(ctx context.Context, uri string, opts SQLiteOptions) (*sqliteStore, error) {
 	path, pragmas, err := parseSQLiteURI(uri)
 	if err != nil {
 		return nil, err
 	}
+	return openSQLiteStore(ctx, path, pragmas, opts)
+}
 
+func openSQLiteStore(ctx context.Context, path string, pragmas []string, opts SQLiteOptions) (*sqliteStore, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return nil, fmt.Errorf("create sqlite directory: %w", err)
 	}
 
-	// Build connection string with pragmas
-	connStr := path
-	if len(pragmas) > 0 {
-		params := make([]string, len(pragmas))
-		for i, pragma := range pragmas {
-			params[i] = "_pragma=" + pragma
-		}
-		connStr += "?" + strings.Join(params, "&")
-	}
-
-	db, err := sql.Open("sqlite3", connStr)
+	db, err := sql.Open("sqlite3", sqliteDSN(path, pragmas, opts))
 	if err != nil {
 		return nil, fmt.Errorf("open sqlite database: %w", err)
 	}
 
-	store := &sqliteStore{db: db, path: path, pragmas: pragmas}
+	store := &sqliteStore{db: db, path: path, pragmas: pragmas, options: opts, stopBackground: make(chan struct{})}
 	if err := store.initSchema(ctx); err != nil {
 		db.Close()
 		return nil, err
 	}
+	if opts.WriteBatchSize > 0 {
+		store.writer = newSQLiteWriter(db, opts.WriteBatchSize, opts.WriteFlushInterval)
+	}
+	if opts.CheckpointInterval > 0 {
+		store.background.Add(1)
+		go store.runCheckpoints(opts.CheckpointInterval, store.stopBackground)
+	}
 	return store, nil
 }
 
+// execer runs statements on the database or within a transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
 func (s *sqliteStore) RecordUsage(ctx context.Context, record UsageRecord) error {
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	if s.writer != nil {
+		return s.writer.do(ctx, func(ctx context.Context, tx execer) error {
+			return insertUsage(ctx, tx, record)
+		})
+	}
+	return insertUsage(ctx, s.db, record)
+}
+
+func insertUsage(ctx context.Context, db execer, record UsageRecord) error {
 	if record.CreatedAt.IsZero() {
 		record.CreatedAt = time.Now()
 	}
@@ -164,10 +259,10 @@ func (s *sqliteStore) RecordUsage(ctx context.Context, record UsageRecord) error
 	}
 
 	query := `INSERT INTO usage_records 
-		(created_at, path, provider, model, original_model, provider_request_id, request_id, attempt, request_tokens, response_tokens, status, outcome, error, duration, first_token_latency) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		(created_at, path, provider, model, original_model, provider_request_id, request_id, tenant, route, moderation, session, key_id, key_name, attempt, request_tokens, response_tokens, status, outcome, error, duration, first_token_latency) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := s.db.ExecContext(ctx, query,
+	_, err := db.ExecContext(ctx, query,
 		record.CreatedAt.Format(time.RFC3339Nano),
 		record.Path,
 		record.Provider,
@@ -175,6 +270,12 @@ func (s *sqliteStore) RecordUsage(ctx context.Context, record UsageRecord) error
 		record.OriginalModel,
 		record.ProviderRequestID,
 		record.RequestID,
+		record.Tenant,
+		record.Route,
+		record.Moderation,
+		record.Session,
+		record.KeyID,
+		record.KeyName,
 		record.Attempt,
 		record.RequestTokens,
 		record.ResponseTokens,
@@ -191,6 +292,9 @@ func (s *sqliteStore) RecordUsage(ctx context.Context, record UsageRecord) error
 	return nil
 }
 
+// usageRecordColumns are the usage_records columns read by scanUsageRecords.
+const usageRecordColumns = `id, created_at, path, provider, model, original_model, provider_request_id, request_id, tenant, route, moderation, session, key_id, key_name, attempt, request_tokens, response_tokens, status, outcome, error, duration, first_token_latency`
+
 func (s *sqliteStore) QueryUsage(ctx context.Context, query UsageQuery) ([]UsageRecord, error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -201,14 +305,33 @@ func (s *sqliteStore) QueryUsage(ctx context.Context, query UsageQuery) ([]Usage
 		limit = 100
 	}
 
-	querySQL := `SELECT id, created_at, path, provider, model, original_model, provider_request_id, request_id, attempt, request_tokens, response_tokens, status, outcome, error, duration, first_token_latency 
-		FROM usage_records`
+	querySQL := `SELECT ` + usageRecordColumns + ` FROM usage_records`
 	args := []interface{}{}
 
+	var conditions []string
 	if strings.TrimSpace(query.RequestID) != "" {
-		querySQL += " WHERE request_id = ?"
+		conditions = append(conditions, "request_id = ?")
 		args = append(args, query.RequestID)
 	}
+	if strings.TrimSpace(query.Tenant) != "" {
+		conditions = append(conditions, "tenant = ?")
+		args = append(args, query.Tenant)
+	}
+	if strings.TrimSpace(query.KeyID) != "" {
+		conditions = append(conditions, "key_id = ?")
+		args = append(args, query.KeyID)
+	}
+	if strings.TrimSpace(query.KeyName) != "" {
+		conditions = append(conditions, "key_name = ?")
+		args = append(args, query.KeyName)
+	}
+	if !query.Since.IsZero() {
+		conditions = append(conditions, "datetime(created_at) >= datetime(?)")
+		args = append(args, query.Since.Format(time.RFC3339Nano))
+	}
+	if len(conditions) > 0 {
+		querySQL += " WHERE " + strings.Join(conditions, " AND ")
+	}
 
 	querySQL += " ORDER BY datetime(created_at) DESC, id DESC LIMIT ?"
 	args = append(args, limit)
@@ -217,6 +340,11 @@ func (s *sqliteStore) QueryUsage(ctx context.Context, query UsageQuery) ([]Usage
 	if err != nil {
 		return nil, fmt.Errorf("query usage records: %w", err)
 	}
+	return scanUsageRecords(rows)
+}
+
+// scanUsageRecords reads rows selected with usageRecordColumns and closes them.
+func scanUsageRecords(rows *sql.Rows) ([]UsageRecord, error) {
 	defer rows.Close()
 
 	var records []UsageRecord
@@ -234,6 +362,12 @@ func (s *sqliteStore) QueryUsage(ctx context.Context, query UsageQuery) ([]Usage
 			&record.OriginalModel,
 			&record.ProviderRequestID,
 			&record.RequestID,
+			&record.Tenant,
+			&record.Route,
+			&record.Moderation,
+			&record.Session,
+			&record.KeyID,
+			&record.KeyName,
 			&record.Attempt,
 			&record.RequestTokens,
 			&record.ResponseTokens,
@@ -271,13 +405,87 @@ func (s *sqliteStore) QueryUsage(ctx context.Context, query UsageQuery) ([]Usage
 		records = append(records, record)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("iterate usage records: %w", err)
 	}
 
 	return records, nil
 }
 
+const sumUsageColumns = `COUNT(*),
+		COALESCE(SUM(CASE WHEN outcome IN ('success', 'client_cancelled', 'slow_client') THEN 0 ELSE 1 END), 0),
+		COALESCE(SUM(CASE WHEN outcome IN ('success', 'client_cancelled', 'slow_client') THEN request_tokens ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN outcome IN ('success', 'client_cancelled', 'slow_client') THEN response_tokens ELSE 0 END), 0)`
+
+func sumUsageWhere(query UsageSumQuery) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if !query.Since.IsZero() {
+		conditions = append(conditions, "datetime(created_at) >= datetime(?)")
+		args = append(args, query.Since.Format(time.RFC3339Nano))
+	}
+	if !query.Until.IsZero() {
+		conditions = append(conditions, "datetime(created_at) < datetime(?)")
+		args = append(args, query.Until.Format(time.RFC3339Nano))
+	}
+	if strings.TrimSpace(query.Tenant) != "" {
+		conditions = append(conditions, "tenant = ?")
+		args = append(args, query.Tenant)
+	}
+	if query.KeyID != "" {
+		conditions = append(conditions, "key_id = ?")
+		args = append(args, query.KeyID)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (s *sqliteStore) SumUsage(ctx context.Context, query UsageSumQuery) (UsageTotals, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	where, args := sumUsageWhere(query)
+	var totals UsageTotals
+	if err := s.db.QueryRowContext(ctx, "SELECT "+sumUsageColumns+" FROM usage_records"+where, args...).Scan(&totals.Requests, &totals.Failures, &totals.RequestTokens, &totals.ResponseTokens); err != nil {
+		return UsageTotals{}, fmt.Errorf("sum usage records: %w", err)
+	}
+	return totals, nil
+}
+
+func (s *sqliteStore) SumUsageByModel(ctx context.Context, query UsageSumQuery) (map[string]UsageTotals, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	where, args := sumUsageWhere(query)
+	querySQL := "SELECT COALESCE(NULLIF(original_model, ''), model, ''), " + sumUsageColumns + " FROM usage_records" + where +
+		" GROUP BY COALESCE(NULLIF(original_model, ''), model, '')"
+	rows, err := s.db.QueryContext(ctx, querySQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sum usage records by model: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]UsageTotals)
+	for rows.Next() {
+		var (
+			model  string
+			totals UsageTotals
+		)
+		if err := rows.Scan(&model, &totals.Requests, &totals.Failures, &totals.RequestTokens, &totals.ResponseTokens); err != nil {
+			return nil, fmt.Errorf("scan usage totals: %w", err)
+		}
+		result[model] = totals
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate usage totals: %w", err)
+	}
+	return result, nil
+}
+
 func (s *sqliteStore) CleanupOldRecords(ctx context.Context, retentionDays int) (int64, error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -306,6 +514,15 @@ func (s *sqliteStore) RecordRequestLog(ctx context.Context, log RequestLog) erro
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	if s.writer != nil {
+		return s.writer.do(ctx, func(ctx context.Context, tx execer) error {
+			return s.insertRequestLog(ctx, tx, log)
+		})
+	}
+	return s.insertRequestLog(ctx, s.db, log)
+}
+
+func (s *sqliteStore) insertRequestLog(ctx context.Context, db execer, log RequestLog) error {
 	if log.CreatedAt.IsZero() {
 		log.CreatedAt = time.Now()
 	}
@@ -326,16 +543,35 @@ func (s *sqliteStore) RecordRequestLog(ctx context.Context, log RequestLog) erro
 		return fmt.Errorf("encode extra: %w", err)
 	}
 
-	_, err = s.db.ExecContext(ctx, `
+	headers, body := string(headersJSON), log.Body
+	if s.logCipher != nil {
+		if headers, err = seal(s.logCipher, headers); err != nil {
+			return err
+		}
+		if body, err = seal(s.logCipher, body); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.ExecContext(ctx, `
 		INSERT INTO request_logs (created_at, request_id, method, path, headers, body, meta, tags, extra)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, log.CreatedAt.Format(time.RFC3339Nano), log.RequestID, log.Method, log.Path, string(headersJSON), log.Body, string(metaJSON), string(tagsJSON), string(extraJSON))
+	`, log.CreatedAt.Format(time.RFC3339Nano), log.RequestID, log.Method, log.Path, headers, body, string(metaJSON), string(tagsJSON), string(extraJSON))
 	if err != nil {
 		return fmt.Errorf("insert request log: %w", err)
 	}
 	return nil
 }
 
+func (s *sqliteStore) SetRequestLogKey(key []byte) error {
+	aead, err := newLogCipher(key)
+	if err != nil {
+		return err
+	}
+	s.logCipher = aead
+	return nil
+}
+
 func (s *sqliteStore) GetRequestLog(ctx context.Context, requestID string) (*RequestLog, error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -345,25 +581,46 @@ func (s *sqliteStore) GetRequestLog(ctx context.Context, requestID string) (*Req
 	}
 
 	row := s.db.QueryRowContext(ctx, `
-		SELECT id, created_at, request_id, method, path, headers, body, meta, tags, extra
+		SELECT `+requestLogColumns+`
 		FROM request_logs
 		WHERE request_id = ?
 		ORDER BY datetime(created_at) DESC, id DESC
 		LIMIT 1
 	`, requestID)
 
+	log, err := s.scanRequestLog(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return log, err
+}
+
+// requestLogColumns are the request_logs columns read by scanRequestLog.
+const requestLogColumns = `id, created_at, request_id, method, path, headers, body, meta, tags, extra`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanRequestLog reads a row selected with requestLogColumns, decrypting the
+// headers and body.
+func (s *sqliteStore) scanRequestLog(row rowScanner) (*RequestLog, error) {
 	var log RequestLog
 	var createdAtStr string
 	var headersJSON, metaJSON, tagsJSON, extraJSON string
 	if err := row.Scan(&log.ID, &createdAtStr, &log.RequestID, &log.Method, &log.Path, &headersJSON, &log.Body, &metaJSON, &tagsJSON, &extraJSON); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
 		return nil, fmt.Errorf("get request log: %w", err)
 	}
 	if ts, err := time.Parse(time.RFC3339Nano, createdAtStr); err == nil {
 		log.CreatedAt = ts
 	}
+	var err error
+	if headersJSON, err = unseal(s.logCipher, headersJSON); err != nil {
+		return nil, err
+	}
+	if log.Body, err = unseal(s.logCipher, log.Body); err != nil {
+		return nil, err
+	}
 	if headersJSON != "" {
 		_ = json.Unmarshal([]byte(headersJSON), &log.Headers)
 	}
@@ -396,7 +653,50 @@ func (s *sqliteStore) CleanupOldRequestLogs(ctx context.Context, retentionDays i
 	return rows, nil
 }
 
+func (s *sqliteStore) Ping(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping sqlite database: %w", err)
+	}
+	var one int
+	if err := s.db.QueryRowContext(ctx, "SELECT 1 FROM usage_records LIMIT 1").Scan(&one); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("query sqlite database: %w", err)
+	}
+	return nil
+}
+
+// Backup writes an online snapshot of the database to destPath using VACUUM INTO.
+// The destination file must not exist yet.
+func (s *sqliteStore) Backup(ctx context.Context, destPath string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if strings.TrimSpace(destPath) == "" {
+		return errors.New("backup path is required")
+	}
+	if _, err := os.Stat(destPath); err == nil {
+		return fmt.Errorf("backup file %s already exists", destPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0o755); err != nil {
+		return fmt.Errorf("create backup directory: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "VACUUM INTO ?", destPath); err != nil {
+		return fmt.Errorf("backup sqlite database: %w", err)
+	}
+	return nil
+}
+
 func (s *sqliteStore) Close(ctx context.Context) error {
+	if s.writer != nil {
+		s.writer.close()
+	}
+	if s.stopBackground != nil {
+		close(s.stopBackground)
+		s.stopBackground = nil
+		s.background.Wait()
+	}
 	if s.db != nil {
 		return s.db.Close()
 	}
@@ -414,6 +714,12 @@ func (s *sqliteStore) initSchema(ctx context.Context) error {
         original_model TEXT,
         provider_request_id TEXT,
         request_id TEXT,
+        tenant TEXT NOT NULL DEFAULT '',
+        route TEXT NOT NULL DEFAULT '',
+        moderation TEXT NOT NULL DEFAULT '',
+        session TEXT NOT NULL DEFAULT '',
+        key_id TEXT NOT NULL DEFAULT '',
+        key_name TEXT NOT NULL DEFAULT '',
         attempt INTEGER NOT NULL DEFAULT 1,
         request_tokens INTEGER NOT NULL DEFAULT 0,
         response_tokens INTEGER NOT NULL DEFAULT 0,
@@ -444,6 +750,75 @@ func (s *sqliteStore) initSchema(ctx context.Context) error {
 		return fmt.Errorf("create request_logs table: %w", err)
 	}
 
+	createTenantSQL := `CREATE TABLE IF NOT EXISTS tenants (
+		id TEXT PRIMARY KEY,
+		created_at TEXT NOT NULL,
+		spec TEXT NOT NULL
+	)`
+	if _, err := s.db.ExecContext(ctx, createTenantSQL); err != nil {
+		return fmt.Errorf("create tenants table: %w", err)
+	}
+
+	createResponseLogSQL := `CREATE TABLE IF NOT EXISTS response_logs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TEXT NOT NULL,
+		request_id TEXT NOT NULL,
+		tenant TEXT NOT NULL DEFAULT '',
+		provider TEXT,
+		model TEXT,
+		status INTEGER,
+		body TEXT,
+		truncated INTEGER NOT NULL DEFAULT 0
+	)`
+	if _, err := s.db.ExecContext(ctx, createResponseLogSQL); err != nil {
+		return fmt.Errorf("create response_logs table: %w", err)
+	}
+	for _, stmt := range []string{
+		`CREATE INDEX IF NOT EXISTS idx_response_logs_created_at ON response_logs (created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_response_logs_request_id ON response_logs (request_id)`,
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("create response_logs index: %w", err)
+		}
+	}
+
+	createAlertSQL := `CREATE TABLE IF NOT EXISTS alerts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TEXT NOT NULL,
+		event_id TEXT,
+		type TEXT NOT NULL,
+		severity TEXT,
+		message TEXT,
+		provider TEXT NOT NULL DEFAULT '',
+		model TEXT NOT NULL DEFAULT '',
+		tenant TEXT NOT NULL DEFAULT '',
+		alert_key TEXT,
+		details TEXT
+	)`
+	if _, err := s.db.ExecContext(ctx, createAlertSQL); err != nil {
+		return fmt.Errorf("create alerts table: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_alerts_created_at ON alerts (created_at DESC)`); err != nil {
+		return fmt.Errorf("create alerts index: %w", err)
+	}
+
+	createAuditSQL := `CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TEXT NOT NULL,
+		actor TEXT NOT NULL DEFAULT '',
+		tenant TEXT NOT NULL DEFAULT '',
+		method TEXT,
+		path TEXT,
+		status INTEGER NOT NULL DEFAULT 0,
+		diff TEXT
+	)`
+	if _, err := s.db.ExecContext(ctx, createAuditSQL); err != nil {
+		return fmt.Errorf("create audit_log table: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at DESC)`); err != nil {
+		return fmt.Errorf("create audit_log index: %w", err)
+	}
+
 	// Create index
 	createIndexSQL := `CREATE INDEX IF NOT EXISTS idx_usage_records_created_at ON usage_records (created_at DESC)`
 	if _, err := s.db.ExecContext(ctx, createIndexSQL); err != nil {
@@ -469,6 +844,12 @@ func (s *sqliteStore) initSchema(ctx context.Context) error {
 		"ALTER TABLE usage_records ADD COLUMN outcome TEXT",
 		"ALTER TABLE usage_records ADD COLUMN error TEXT",
 		"ALTER TABLE usage_records ADD COLUMN first_token_latency INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE usage_records ADD COLUMN tenant TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE usage_records ADD COLUMN route TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE usage_records ADD COLUMN moderation TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE usage_records ADD COLUMN session TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE usage_records ADD COLUMN key_id TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE usage_records ADD COLUMN key_name TEXT NOT NULL DEFAULT ''",
 	}
 
 	for _, stmt := range alterStatements {
@@ -481,6 +862,14 @@ func (s *sqliteStore) initSchema(ctx context.Context) error {
 		}
 	}
 
+	// The session and key_id columns may only exist after the migrations above.
+	if _, err := s.db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_usage_records_session ON usage_records (session) WHERE session != ''`); err != nil {
+		return fmt.Errorf("create usage_records session index: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_usage_records_key_id ON usage_records (key_id, created_at) WHERE key_id != ''`); err != nil {
+		return fmt.Errorf("create usage_records key_id index: %w", err)
+	}
+
 	return nil
 }
 
@@ -584,6 +973,15 @@ func parseMySQLURI(uri string) (string, error) {
 	return filepath.Join("data", "gateway-mysql", sanitized), nil
 }
 
+func openFileStore(path string) (*fileStore, error) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	fs := &fileStore{usagePath: path, requestLogPath: base + "_requests.jsonl", tenantPath: base + "_tenants.jsonl", alertPath: base + "_alerts.jsonl", auditPath: base + "_audit.jsonl", responseLogPath: base + "_responses.jsonl"}
+	if err := fs.load(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
 func (f *fileStore) RecordUsage(_ context.Context, record UsageRecord) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -626,10 +1024,25 @@ func (f *fileStore) QueryUsage(_ context.Context, query UsageQuery) ([]UsageReco
 
 	records := make([]UsageRecord, 0, len(f.records))
 	requestID := strings.TrimSpace(query.RequestID)
+	tenant := strings.TrimSpace(query.Tenant)
+	keyID := strings.TrimSpace(query.KeyID)
+	keyName := strings.TrimSpace(query.KeyName)
 	for _, rec := range f.records {
 		if requestID != "" && rec.RequestID != requestID {
 			continue
 		}
+		if tenant != "" && rec.Tenant != tenant {
+			continue
+		}
+		if keyID != "" && rec.KeyID != keyID {
+			continue
+		}
+		if keyName != "" && rec.KeyName != keyName {
+			continue
+		}
+		if !query.Since.IsZero() && rec.CreatedAt.Before(query.Since) {
+			continue
+		}
 		records = append(records, rec)
 	}
 	sort.Slice(records, func(i, j int) bool {
@@ -641,6 +1054,61 @@ func (f *fileStore) QueryUsage(_ context.Context, query UsageQuery) ([]UsageReco
 	return records, nil
 }
 
+func (f *fileStore) SumUsage(_ context.Context, query UsageSumQuery) (UsageTotals, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var totals UsageTotals
+	for _, rec := range f.records {
+		if matchesSumQuery(rec, query) {
+			totals.Add(totalsOf(rec))
+		}
+	}
+	return totals, nil
+}
+
+func (f *fileStore) SumUsageByModel(_ context.Context, query UsageSumQuery) (map[string]UsageTotals, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	result := make(map[string]UsageTotals)
+	for _, rec := range f.records {
+		if !matchesSumQuery(rec, query) {
+			continue
+		}
+		model := rec.OriginalModel
+		if model == "" {
+			model = rec.Model
+		}
+		totals := result[model]
+		totals.Add(totalsOf(rec))
+		result[model] = totals
+	}
+	return result, nil
+}
+
+func matchesSumQuery(rec UsageRecord, query UsageSumQuery) bool {
+	if !query.Since.IsZero() && rec.CreatedAt.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && !rec.CreatedAt.Before(query.Until) {
+		return false
+	}
+	if query.KeyID != "" && rec.KeyID != query.KeyID {
+		return false
+	}
+	tenant := strings.TrimSpace(query.Tenant)
+	return tenant == "" || rec.Tenant == tenant
+}
+
+// totalsOf converts a single record; tokens only count for billable requests.
+func totalsOf(rec UsageRecord) UsageTotals {
+	if !rec.Billable() {
+		return UsageTotals{Requests: 1, Failures: 1}
+	}
+	return UsageTotals{Requests: 1, RequestTokens: int64(rec.RequestTokens), ResponseTokens: int64(rec.ResponseTokens)}
+}
+
 func (f *fileStore) CleanupOldRecords(ctx context.Context, retentionDays int) (int64, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -682,6 +1150,20 @@ func (f *fileStore) CleanupOldRecords(ctx context.Context, retentionDays int) (i
 	return removedCount, nil
 }
 
+func (f *fileStore) Ping(_ context.Context) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, path := range []string{f.usagePath, f.requestLogPath} {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("open storage file: %w", err)
+		}
+		_ = file.Close()
+	}
+	return nil
+}
+
 func (f *fileStore) Close(ctx context.Context) error {
 	return nil
 }
@@ -693,6 +1175,18 @@ func (f *fileStore) load() error {
 	if err := f.loadRequestLogs(); err != nil {
 		return err
 	}
+	if err := f.loadTenants(); err != nil {
+		return err
+	}
+	if err := f.loadAlerts(); err != nil {
+		return err
+	}
+	if err := f.loadAudit(); err != nil {
+		return err
+	}
+	if err := f.loadResponseLogs(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -747,6 +1241,13 @@ func (f *fileStore) RecordRequestLog(_ context.Context, log RequestLog) error {
 		log.CreatedAt = time.Now()
 	}
 
+	if f.logCipher != nil {
+		sealed, err := sealRequestLog(f.logCipher, log)
+		if err != nil {
+			return err
+		}
+		log = sealed
+	}
 	f.requestLogs = append(f.requestLogs, log)
 
 	data, err := json.Marshal(log)
@@ -766,6 +1267,17 @@ func (f *fileStore) RecordRequestLog(_ context.Context, log RequestLog) error {
 	return nil
 }
 
+func (f *fileStore) SetRequestLogKey(key []byte) error {
+	aead, err := newLogCipher(key)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.logCipher = aead
+	f.mu.Unlock()
+	return nil
+}
+
 func (f *fileStore) GetRequestLog(_ context.Context, requestID string) (*RequestLog, error) {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
@@ -777,7 +1289,10 @@ func (f *fileStore) GetRequestLog(_ context.Context, requestID string) (*Request
 
 	for i := len(f.requestLogs) - 1; i >= 0; i-- {
 		if f.requestLogs[i].RequestID == requestID {
-			log := f.requestLogs[i]
+			log, err := unsealRequestLog(f.logCipher, f.requestLogs[i])
+			if err != nil {
+				return nil, err
+			}
 			return &log, nil
 		}
 	}
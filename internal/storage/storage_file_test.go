@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStoreImportSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "usage")
+	store, err := openFileStore(path)
+	if err != nil {
+		t.Fatalf("open file store: %v", err)
+	}
+	if err := store.SetRequestLogKey(make([]byte, 32)); err != nil {
+		t.Fatalf("set key: %v", err)
+	}
+	if err := store.RecordUsage(ctx, UsageRecord{RequestID: "req-0"}); err != nil {
+		t.Fatalf("record usage: %v", err)
+	}
+	if err := store.ImportUsage(ctx, []UsageRecord{{ID: 7, RequestID: "req-1"}, {ID: 7, RequestID: "req-2"}}); err != nil {
+		t.Fatalf("import usage: %v", err)
+	}
+	if err := store.ImportRequestLogs(ctx, []RequestLog{{RequestID: "req-1", Body: `{"model":"gpt-4o"}`}}); err != nil {
+		t.Fatalf("import request logs: %v", err)
+	}
+
+	reopened, err := openFileStore(path)
+	if err != nil {
+		t.Fatalf("reopen file store: %v", err)
+	}
+	if err := reopened.SetRequestLogKey(make([]byte, 32)); err != nil {
+		t.Fatalf("set key: %v", err)
+	}
+	records, err := reopened.ExportUsage(ctx, 0, 10)
+	if err != nil || len(records) != 3 {
+		t.Fatalf("expected 3 records, got %+v %v", records, err)
+	}
+	for i, rec := range records {
+		if rec.ID != int64(i+1) {
+			t.Fatalf("expected imported records to get new ids, got %+v", records)
+		}
+	}
+	log, err := reopened.GetRequestLog(ctx, "req-1")
+	if err != nil || log == nil || log.Body != `{"model":"gpt-4o"}` {
+		t.Fatalf("expected the imported request log, got %+v %v", log, err)
+	}
+}
+
+func TestFileStoreCleansUpOldAlertsAndAudit(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "usage")
+	store, err := openFileStore(path)
+	if err != nil {
+		t.Fatalf("open file store: %v", err)
+	}
+	old := time.Now().AddDate(0, 0, -10)
+	for _, createdAt := range []time.Time{old, time.Now()} {
+		if err := store.RecordAlert(ctx, AlertRecord{CreatedAt: createdAt, Type: "provider_unhealthy"}); err != nil {
+			t.Fatalf("record alert: %v", err)
+		}
+		if err := store.RecordAudit(ctx, AuditRecord{CreatedAt: createdAt, Path: "/admin/tenants"}); err != nil {
+			t.Fatalf("record audit: %v", err)
+		}
+	}
+	if removed, err := store.CleanupOldAlerts(ctx, 7); err != nil || removed != 1 {
+		t.Fatalf("expected 1 alert to be removed, got %d %v", removed, err)
+	}
+	if removed, err := store.CleanupOldAudit(ctx, 7); err != nil || removed != 1 {
+		t.Fatalf("expected 1 audit record to be removed, got %d %v", removed, err)
+	}
+	if err := store.RecordAlert(ctx, AlertRecord{Type: "provider_recovered"}); err != nil {
+		t.Fatalf("record alert: %v", err)
+	}
+
+	reopened, err := openFileStore(path)
+	if err != nil {
+		t.Fatalf("reopen file store: %v", err)
+	}
+	alerts, _ := reopened.QueryAlerts(ctx, AlertQuery{})
+	if len(alerts) != 2 || alerts[0].ID == alerts[1].ID {
+		t.Fatalf("expected 2 alerts with distinct ids, got %+v", alerts)
+	}
+	audit, _ := reopened.QueryAudit(ctx, AuditQuery{})
+	if len(audit) != 1 {
+		t.Fatalf("expected 1 audit record, got %+v", audit)
+	}
+}
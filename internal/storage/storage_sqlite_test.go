@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"testing"
@@ -68,3 +69,640 @@ func TestSQLiteStoreRecordAndQuery(t *testing.T) {
 		t.Fatalf("unexpected outcome: %s", got.Outcome)
 	}
 }
+
+func TestSQLiteStoreBackup(t *testing.T) {
+	dir := t.TempDir()
+	uri := fmt.Sprintf("file:%s", filepath.Join(dir, "usage.db"))
+
+	store, err := New(context.Background(), "sqlite", uri)
+	if err != nil {
+		t.Fatalf("create sqlite store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close(context.Background())
+	})
+
+	if err := store.RecordUsage(context.Background(), UsageRecord{Provider: "provider-a", RequestID: "req-1"}); err != nil {
+		t.Fatalf("record usage: %v", err)
+	}
+
+	backuper, ok := store.(Backuper)
+	if !ok {
+		t.Fatalf("sqlite store does not support backups")
+	}
+	dest := filepath.Join(dir, "backups", "snapshot.db")
+	if err := backuper.Backup(context.Background(), dest); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if err := backuper.Backup(context.Background(), dest); err == nil {
+		t.Fatalf("expected error when backup file already exists")
+	}
+
+	snapshot, err := New(context.Background(), "sqlite", fmt.Sprintf("file:%s", dest))
+	if err != nil {
+		t.Fatalf("open snapshot: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = snapshot.Close(context.Background())
+	})
+	records, err := snapshot.QueryUsage(context.Background(), UsageQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("query snapshot: %v", err)
+	}
+	if len(records) != 1 || records[0].RequestID != "req-1" {
+		t.Fatalf("unexpected snapshot records: %+v", records)
+	}
+}
+
+func TestSQLiteStoreQueryUsageByTenant(t *testing.T) {
+	dir := t.TempDir()
+	uri := fmt.Sprintf("file:%s", filepath.Join(dir, "usage.db"))
+
+	store, err := New(context.Background(), "sqlite", uri)
+	if err != nil {
+		t.Fatalf("create sqlite store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close(context.Background())
+	})
+
+	now := time.Now()
+	for _, rec := range []UsageRecord{
+		{RequestID: "req-1", Tenant: "team-a", CreatedAt: now.Add(-48 * time.Hour)},
+		{RequestID: "req-2", Tenant: "team-b", CreatedAt: now},
+		{RequestID: "req-3", KeyName: "batch-jobs", CreatedAt: now},
+	} {
+		if err := store.RecordUsage(context.Background(), rec); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+
+	records, err := store.QueryUsage(context.Background(), UsageQuery{Limit: 10, Tenant: "team-a"})
+	if err != nil {
+		t.Fatalf("query usage: %v", err)
+	}
+	if len(records) != 1 || records[0].RequestID != "req-1" || records[0].Tenant != "team-a" {
+		t.Fatalf("unexpected tenant records: %+v", records)
+	}
+
+	all, err := store.QueryUsage(context.Background(), UsageQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("query usage: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(all))
+	}
+
+	named, err := store.QueryUsage(context.Background(), UsageQuery{Limit: 10, KeyName: "batch-jobs"})
+	if err != nil {
+		t.Fatalf("query usage: %v", err)
+	}
+	if len(named) != 1 || named[0].RequestID != "req-3" || named[0].KeyName != "batch-jobs" {
+		t.Fatalf("unexpected key records: %+v", named)
+	}
+
+	recent, err := store.QueryUsage(context.Background(), UsageQuery{Limit: 10, Since: now.Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("query usage: %v", err)
+	}
+	if len(recent) != 2 {
+		t.Fatalf("expected the records of the last hour, got %+v", recent)
+	}
+}
+
+func TestSQLiteStoreSaveAndListTenants(t *testing.T) {
+	dir := t.TempDir()
+	uri := fmt.Sprintf("file:%s", filepath.Join(dir, "usage.db"))
+
+	store, err := New(context.Background(), "sqlite", uri)
+	if err != nil {
+		t.Fatalf("create sqlite store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close(context.Background())
+	})
+
+	tenants, ok := store.(TenantStore)
+	if !ok {
+		t.Fatalf("sqlite store does not implement TenantStore")
+	}
+	spec := []byte(`{"id":"team-a","api_keys":["sk-a"]}`)
+	if err := tenants.SaveTenant(context.Background(), TenantRecord{ID: "team-a", Spec: spec}); err != nil {
+		t.Fatalf("save tenant: %v", err)
+	}
+	if err := tenants.SaveTenant(context.Background(), TenantRecord{ID: "team-a", Spec: spec}); !errors.Is(err, ErrTenantExists) {
+		t.Fatalf("expected ErrTenantExists, got %v", err)
+	}
+
+	records, err := tenants.ListTenants(context.Background())
+	if err != nil {
+		t.Fatalf("list tenants: %v", err)
+	}
+	if len(records) != 1 || records[0].ID != "team-a" || string(records[0].Spec) != string(spec) {
+		t.Fatalf("unexpected tenants: %+v", records)
+	}
+}
+
+func TestSQLiteStoreSumUsageByModel(t *testing.T) {
+	dir := t.TempDir()
+	uri := fmt.Sprintf("file:%s", filepath.Join(dir, "usage.db"))
+
+	store, err := New(context.Background(), "sqlite", uri)
+	if err != nil {
+		t.Fatalf("create sqlite store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close(context.Background())
+	})
+
+	now := time.Now()
+	for _, rec := range []UsageRecord{
+		{CreatedAt: now.Add(-time.Hour), Model: "gpt-4o-2024", OriginalModel: "gpt-4o", Outcome: "success", RequestTokens: 10, ResponseTokens: 5},
+		{CreatedAt: now.Add(-time.Hour), Model: "gpt-4o", OriginalModel: "gpt-4o", Outcome: "failure"},
+		{CreatedAt: now.Add(-time.Hour), Model: "claude", Outcome: "success", RequestTokens: 7},
+		{CreatedAt: now.Add(-time.Hour), Model: "claude", Outcome: OutcomeClientCancelled, RequestTokens: 3, ResponseTokens: 2},
+		{CreatedAt: now.Add(-48 * time.Hour), Model: "claude", Outcome: "success", RequestTokens: 100},
+	} {
+		if err := store.RecordUsage(context.Background(), rec); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+
+	query := UsageSumQuery{Since: now.Add(-24 * time.Hour), Until: now}
+	byModel, err := store.SumUsageByModel(context.Background(), query)
+	if err != nil {
+		t.Fatalf("sum usage by model: %v", err)
+	}
+	want := map[string]UsageTotals{
+		"gpt-4o": {Requests: 2, Failures: 1, RequestTokens: 10, ResponseTokens: 5},
+		"claude": {Requests: 2, RequestTokens: 10, ResponseTokens: 2},
+	}
+	if len(byModel) != len(want) || byModel["gpt-4o"] != want["gpt-4o"] || byModel["claude"] != want["claude"] {
+		t.Fatalf("unexpected totals by model: %+v", byModel)
+	}
+
+	totals, err := store.SumUsage(context.Background(), UsageSumQuery{Until: now.Add(-24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("sum usage: %v", err)
+	}
+	if totals.Requests != 1 || totals.RequestTokens != 100 {
+		t.Fatalf("expected only the old record before until, got %+v", totals)
+	}
+}
+
+func TestSQLiteStoreRecordAndQueryAlerts(t *testing.T) {
+	dir := t.TempDir()
+	uri := fmt.Sprintf("file:%s", filepath.Join(dir, "usage.db"))
+
+	store, err := New(context.Background(), "sqlite", uri)
+	if err != nil {
+		t.Fatalf("create sqlite store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close(context.Background())
+	})
+
+	alerts, ok := store.(AlertStore)
+	if !ok {
+		t.Fatalf("sqlite store does not implement AlertStore")
+	}
+	now := time.Now()
+	for _, alert := range []AlertRecord{
+		{CreatedAt: now.Add(-3 * time.Hour), Type: "provider_unhealthy", Severity: "critical", Provider: "p1"},
+		{CreatedAt: now.Add(-2 * time.Hour), Type: "provider_recovered", Severity: "info", Provider: "p1"},
+		{CreatedAt: now.Add(-time.Hour), Type: "provider_unhealthy", Severity: "critical", Provider: "p2", Details: map[string]any{"failures": 3}},
+	} {
+		if err := alerts.RecordAlert(context.Background(), alert); err != nil {
+			t.Fatalf("record alert: %v", err)
+		}
+	}
+
+	got, err := alerts.QueryAlerts(context.Background(), AlertQuery{Type: "provider_unhealthy"})
+	if err != nil {
+		t.Fatalf("query alerts: %v", err)
+	}
+	if len(got) != 2 || got[0].Provider != "p2" || got[1].Provider != "p1" {
+		t.Fatalf("expected unhealthy alerts newest first, got %+v", got)
+	}
+	if got[0].Details["failures"] != float64(3) {
+		t.Fatalf("expected details to round trip, got %+v", got[0].Details)
+	}
+
+	got, err = alerts.QueryAlerts(context.Background(), AlertQuery{Since: now.Add(-150 * time.Minute), Provider: "p1"})
+	if err != nil {
+		t.Fatalf("query alerts: %v", err)
+	}
+	if len(got) != 1 || got[0].Type != "provider_recovered" {
+		t.Fatalf("expected only the recovery of p1, got %+v", got)
+	}
+
+	if err := alerts.RecordAlert(context.Background(), AlertRecord{CreatedAt: now.AddDate(0, 0, -10), Type: "provider_unhealthy"}); err != nil {
+		t.Fatalf("record alert: %v", err)
+	}
+	removed, err := alerts.CleanupOldAlerts(context.Background(), 7)
+	if err != nil || removed != 1 {
+		t.Fatalf("expected 1 alert to be removed, got %d %v", removed, err)
+	}
+}
+
+func TestSQLiteStoreEncryptsRequestLogs(t *testing.T) {
+	dir := t.TempDir()
+	uri := fmt.Sprintf("file:%s", filepath.Join(dir, "usage.db"))
+
+	store, err := New(context.Background(), "sqlite", uri)
+	if err != nil {
+		t.Fatalf("create sqlite store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close(context.Background())
+	})
+
+	ctx := context.Background()
+	if err := store.RecordRequestLog(ctx, RequestLog{RequestID: "plain", Body: `{"a":1}`}); err != nil {
+		t.Fatalf("record plain request log: %v", err)
+	}
+	if err := store.(RequestLogEncrypter).SetRequestLogKey(make([]byte, 32)); err != nil {
+		t.Fatalf("set key: %v", err)
+	}
+	log := RequestLog{RequestID: "secret", Headers: map[string][]string{"X-Test": {"1"}}, Body: `{"prompt":"hello"}`}
+	if err := store.RecordRequestLog(ctx, log); err != nil {
+		t.Fatalf("record request log: %v", err)
+	}
+
+	var headers, body string
+	row := store.(*sqliteStore).db.QueryRowContext(ctx, `SELECT headers, body FROM request_logs WHERE request_id = 'secret'`)
+	if err := row.Scan(&headers, &body); err != nil {
+		t.Fatalf("scan raw row: %v", err)
+	}
+	if !isSealed(headers) || !isSealed(body) {
+		t.Fatalf("expected encrypted columns, got %q %q", headers, body)
+	}
+
+	got, err := store.GetRequestLog(ctx, "secret")
+	if err != nil {
+		t.Fatalf("get request log: %v", err)
+	}
+	if got.Body != log.Body || got.Headers["X-Test"][0] != "1" {
+		t.Fatalf("unexpected decrypted log %+v", got)
+	}
+	plain, err := store.GetRequestLog(ctx, "plain")
+	if err != nil || plain.Body != `{"a":1}` {
+		t.Fatalf("expected plaintext log to stay readable, got %+v, %v", plain, err)
+	}
+}
+
+func TestSQLiteStoreResponseLogs(t *testing.T) {
+	dir := t.TempDir()
+	uri := fmt.Sprintf("file:%s", filepath.Join(dir, "usage.db"))
+
+	store, err := New(context.Background(), "sqlite", uri)
+	if err != nil {
+		t.Fatalf("create sqlite store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close(context.Background())
+	})
+
+	ctx := context.Background()
+	if err := store.(RequestLogEncrypter).SetRequestLogKey(make([]byte, 32)); err != nil {
+		t.Fatalf("set key: %v", err)
+	}
+	responses := store.(ResponseLogStore)
+	old := ResponseLog{CreatedAt: time.Now().AddDate(0, 0, -10), RequestID: "old", Body: `{"id":"old"}`}
+	if err := responses.RecordResponseLog(ctx, old); err != nil {
+		t.Fatalf("record old response log: %v", err)
+	}
+	recent := ResponseLog{RequestID: "recent", Provider: "openai", Model: "gpt-4o", StatusCode: 200, Body: `{"id":"recent"}`, Truncated: true}
+	if err := responses.RecordResponseLog(ctx, recent); err != nil {
+		t.Fatalf("record response log: %v", err)
+	}
+
+	var body string
+	row := store.(*sqliteStore).db.QueryRowContext(ctx, `SELECT body FROM response_logs WHERE request_id = 'recent'`)
+	if err := row.Scan(&body); err != nil {
+		t.Fatalf("scan raw row: %v", err)
+	}
+	if !isSealed(body) {
+		t.Fatalf("expected encrypted body, got %q", body)
+	}
+
+	got, err := responses.GetResponseLog(ctx, "recent")
+	if err != nil {
+		t.Fatalf("get response log: %v", err)
+	}
+	if got == nil || got.Body != recent.Body || got.Provider != "openai" || got.StatusCode != 200 || !got.Truncated {
+		t.Fatalf("unexpected response log %+v", got)
+	}
+
+	if _, err := responses.CleanupOldResponseLogs(ctx, 7); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if got, err := responses.GetResponseLog(ctx, "old"); err != nil || got != nil {
+		t.Fatalf("expected old response log to be removed, got %+v, %v", got, err)
+	}
+	if got, err := responses.GetResponseLog(ctx, "recent"); err != nil || got == nil {
+		t.Fatalf("expected recent response log to stay, got %+v, %v", got, err)
+	}
+}
+
+func TestSQLiteStoreStatsAndVacuum(t *testing.T) {
+	dir := t.TempDir()
+	uri := fmt.Sprintf("file:%s", filepath.Join(dir, "usage.db"))
+
+	store, err := New(context.Background(), "sqlite", uri)
+	if err != nil {
+		t.Fatalf("create sqlite store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close(context.Background())
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := store.RecordUsage(ctx, UsageRecord{RequestID: fmt.Sprintf("req-%d", i), Model: "gpt-4o", Provider: "openai"}); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+	if err := store.RecordRequestLog(ctx, RequestLog{RequestID: "req-0", Body: `{}`}); err != nil {
+		t.Fatalf("record request log: %v", err)
+	}
+
+	stats, err := store.(StatsReporter).Stats(ctx)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Driver != "sqlite" || stats.SizeBytes == 0 || stats.PendingWrites != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats.Rows["usage_records"] != 3 || stats.Rows["request_logs"] != 1 || stats.Rows["response_logs"] != 0 {
+		t.Fatalf("unexpected row counts %v", stats.Rows)
+	}
+
+	if err := store.(Vacuumer).Vacuum(ctx); err != nil {
+		t.Fatalf("vacuum: %v", err)
+	}
+	if stats, err := store.(StatsReporter).Stats(ctx); err != nil || stats.Rows["usage_records"] != 3 {
+		t.Fatalf("expected rows to survive vacuum, got %+v, %v", stats, err)
+	}
+}
+
+func TestSQLiteStoreRecordAndQueryAudit(t *testing.T) {
+	dir := t.TempDir()
+	uri := fmt.Sprintf("file:%s", filepath.Join(dir, "usage.db"))
+
+	store, err := New(context.Background(), "sqlite", uri)
+	if err != nil {
+		t.Fatalf("create sqlite store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close(context.Background())
+	})
+
+	auditStore := store.(AuditStore)
+	ctx := context.Background()
+	now := time.Now()
+	records := []AuditRecord{
+		{CreatedAt: now.Add(-2 * time.Hour), Actor: "sk-a****aaaa", Method: "PUT", Path: "/admin/loglevel", Status: 200, Diff: map[string]any{"before": "info", "after": "debug"}},
+		{CreatedAt: now.Add(-time.Hour), Actor: "sk-b****bbbb", Method: "POST", Path: "/admin/tenants", Status: 201},
+		{CreatedAt: now, Actor: "sk-a****aaaa", Method: "DELETE", Path: "/admin/tenants/t1/data", Status: 204},
+	}
+	for _, record := range records {
+		if err := auditStore.RecordAudit(ctx, record); err != nil {
+			t.Fatalf("record audit: %v", err)
+		}
+	}
+
+	got, err := auditStore.QueryAudit(ctx, AuditQuery{Actor: "sk-a****aaaa"})
+	if err != nil {
+		t.Fatalf("query audit: %v", err)
+	}
+	if len(got) != 2 || got[0].Path != "/admin/tenants/t1/data" || got[1].Diff["after"] != "debug" {
+		t.Fatalf("unexpected audit records %+v", got)
+	}
+
+	got, err = auditStore.QueryAudit(ctx, AuditQuery{Path: "/admin/tenants", Since: now.Add(-90 * time.Minute), Limit: 1})
+	if err != nil {
+		t.Fatalf("query audit: %v", err)
+	}
+	if len(got) != 1 || got[0].Method != "DELETE" {
+		t.Fatalf("unexpected audit records %+v", got)
+	}
+
+	if err := auditStore.RecordAudit(ctx, AuditRecord{CreatedAt: now.AddDate(0, 0, -10), Actor: "sk-c****cccc"}); err != nil {
+		t.Fatalf("record audit: %v", err)
+	}
+	removed, err := auditStore.CleanupOldAudit(ctx, 7)
+	if err != nil || removed != 1 {
+		t.Fatalf("expected 1 audit record to be removed, got %d %v", removed, err)
+	}
+}
+
+func TestSQLiteStoreExportAndImport(t *testing.T) {
+	ctx := context.Background()
+	open := func(name string) Store {
+		store, err := New(ctx, "sqlite", "file:"+filepath.Join(t.TempDir(), name))
+		if err != nil {
+			t.Fatalf("create sqlite store: %v", err)
+		}
+		t.Cleanup(func() { _ = store.Close(ctx) })
+		return store
+	}
+	source, dest := open("source.db"), open("dest.db")
+	if err := source.(RequestLogEncrypter).SetRequestLogKey(make([]byte, 32)); err != nil {
+		t.Fatalf("set key: %v", err)
+	}
+
+	for i := range 5 {
+		if err := source.RecordUsage(ctx, UsageRecord{RequestID: fmt.Sprintf("req-%d", i), Model: "gpt-4o", Outcome: "success", RequestTokens: i}); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+	if err := source.RecordRequestLog(ctx, RequestLog{RequestID: "req-0", Method: "POST", Body: `{"model":"gpt-4o"}`, Headers: map[string][]string{"A": {"b"}}}); err != nil {
+		t.Fatalf("record request log: %v", err)
+	}
+
+	exporter := source.(Exporter)
+	var afterID int64
+	batches := 0
+	for {
+		records, err := exporter.ExportUsage(ctx, afterID, 2)
+		if err != nil {
+			t.Fatalf("export usage: %v", err)
+		}
+		if len(records) == 0 {
+			break
+		}
+		batches++
+		if err := dest.(Importer).ImportUsage(ctx, records); err != nil {
+			t.Fatalf("import usage: %v", err)
+		}
+		afterID = records[len(records)-1].ID
+	}
+	if batches != 3 {
+		t.Fatalf("expected 3 batches, got %d", batches)
+	}
+	logs, err := exporter.ExportRequestLogs(ctx, 0, 10)
+	if err != nil || len(logs) != 1 || logs[0].Body != `{"model":"gpt-4o"}` {
+		t.Fatalf("expected decrypted request log, got %+v %v", logs, err)
+	}
+	if err := dest.(Importer).ImportRequestLogs(ctx, logs); err != nil {
+		t.Fatalf("import request logs: %v", err)
+	}
+
+	records, err := dest.QueryUsage(ctx, UsageQuery{Limit: 10})
+	if err != nil || len(records) != 5 {
+		t.Fatalf("expected 5 migrated records, got %d %v", len(records), err)
+	}
+	log, err := dest.GetRequestLog(ctx, "req-0")
+	if err != nil || log == nil || log.Headers["A"][0] != "b" {
+		t.Fatalf("expected migrated request log, got %+v %v", log, err)
+	}
+}
+
+func TestSQLiteStoreBatchedWriter(t *testing.T) {
+	uri := fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "usage.db"))
+	store, err := New(context.Background(), "sqlite", uri, WithSQLite(SQLiteOptions{
+		JournalMode:        "wal",
+		Synchronous:        "normal",
+		BusyTimeout:        time.Second,
+		WriteBatchSize:     8,
+		WriteFlushInterval: 10 * time.Millisecond,
+		CheckpointInterval: 20 * time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatalf("create sqlite store: %v", err)
+	}
+	sqlite := store.(*sqliteStore)
+
+	var mode string
+	if err := sqlite.db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Fatalf("expected wal journal mode, got %q: %v", mode, err)
+	}
+
+	const writes = 50
+	errs := make(chan error, writes)
+	for i := 0; i < writes; i++ {
+		go func(i int) {
+			errs <- store.RecordUsage(context.Background(), UsageRecord{RequestID: fmt.Sprintf("req-%d", i), Outcome: "success", RequestTokens: 1})
+		}(i)
+	}
+	for i := 0; i < writes; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+	if err := store.RecordRequestLog(context.Background(), RequestLog{RequestID: "req-1", Method: "POST", Path: "/v1/chat/completions"}); err != nil {
+		t.Fatalf("record request log: %v", err)
+	}
+
+	totals, err := store.SumUsage(context.Background(), UsageSumQuery{})
+	if err != nil {
+		t.Fatalf("sum usage: %v", err)
+	}
+	if totals.Requests != writes || totals.RequestTokens != writes {
+		t.Fatalf("expected %d batched records, got %+v", writes, totals)
+	}
+	if log, err := store.GetRequestLog(context.Background(), "req-1"); err != nil || log == nil {
+		t.Fatalf("request log not written: %v", err)
+	}
+
+	if err := store.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := store.RecordUsage(context.Background(), UsageRecord{RequestID: "late"}); err == nil {
+		t.Fatal("writes after close must fail")
+	}
+}
+
+func TestSQLiteStoreSumSessionUsage(t *testing.T) {
+	dir := t.TempDir()
+	uri := fmt.Sprintf("file:%s", filepath.Join(dir, "usage.db"))
+
+	store, err := New(context.Background(), "sqlite", uri)
+	if err != nil {
+		t.Fatalf("create sqlite store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close(context.Background())
+	})
+
+	now := time.Now()
+	for _, rec := range []UsageRecord{
+		{CreatedAt: now.Add(-time.Minute), Session: "s1", Tenant: "acme", Provider: "p1", Model: "gpt-4o", Outcome: "success", RequestTokens: 10, ResponseTokens: 5},
+		{CreatedAt: now, Session: "s1", Tenant: "acme", Provider: "p1", Model: "gpt-4o", Outcome: "success", RequestTokens: 20, ResponseTokens: 5},
+		{CreatedAt: now, Session: "s1", Tenant: "acme", Provider: "p2", Model: "claude", Outcome: "failure"},
+		{CreatedAt: now, Session: "s1", Tenant: "other", Provider: "p1", Model: "gpt-4o", Outcome: "success", RequestTokens: 100},
+		{CreatedAt: now, Session: "s2", Tenant: "acme", Provider: "p1", Model: "gpt-4o", Outcome: "success", RequestTokens: 100},
+	} {
+		if err := store.RecordUsage(context.Background(), rec); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+
+	sessions := store.(SessionStore)
+	totals, err := sessions.SumSessionUsage(context.Background(), SessionUsageQuery{Session: "s1", Tenant: "acme"})
+	if err != nil {
+		t.Fatalf("sum session usage: %v", err)
+	}
+	if len(totals) != 2 || totals[0].Provider != "p1" || totals[1].Provider != "p2" {
+		t.Fatalf("unexpected session totals %+v", totals)
+	}
+	if want := (UsageTotals{Requests: 2, RequestTokens: 30, ResponseTokens: 10}); totals[0].UsageTotals != want {
+		t.Fatalf("unexpected p1 totals %+v", totals[0].UsageTotals)
+	}
+	if !totals[0].FirstAt.Equal(now.Add(-time.Minute)) || !totals[0].LastAt.Equal(now) {
+		t.Fatalf("unexpected p1 time range %s - %s", totals[0].FirstAt, totals[0].LastAt)
+	}
+	if totals[1].Failures != 1 {
+		t.Fatalf("expected the p2 failure, got %+v", totals[1])
+	}
+
+	if totals, err = sessions.SumSessionUsage(context.Background(), SessionUsageQuery{Session: "s1"}); err != nil || len(totals) != 2 || totals[0].RequestTokens != 130 {
+		t.Fatalf("expected the session across tenants, got %+v %v", totals, err)
+	}
+	if _, err := sessions.SumSessionUsage(context.Background(), SessionUsageQuery{}); err == nil {
+		t.Fatal("expected an error without a session")
+	}
+}
+
+func TestSQLiteStoreSumUsageByProviderModelOfKey(t *testing.T) {
+	dir := t.TempDir()
+	uri := fmt.Sprintf("file:%s", filepath.Join(dir, "usage.db"))
+
+	store, err := New(context.Background(), "sqlite", uri)
+	if err != nil {
+		t.Fatalf("create sqlite store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close(context.Background())
+	})
+
+	now := time.Now()
+	for _, rec := range []UsageRecord{
+		{CreatedAt: now, KeyID: "key-a", Provider: "p1", Model: "gpt-4o", Outcome: "success", RequestTokens: 10, ResponseTokens: 5},
+		{CreatedAt: now, KeyID: "key-a", Provider: "p1", Model: "gpt-4o", Outcome: "success", RequestTokens: 20},
+		{CreatedAt: now, KeyID: "key-a", Provider: "p2", Model: "claude", Outcome: "success", RequestTokens: 7},
+		{CreatedAt: now, KeyID: "key-b", Provider: "p1", Model: "gpt-4o", Outcome: "success", RequestTokens: 100},
+		{CreatedAt: now.Add(-48 * time.Hour), KeyID: "key-a", Provider: "p1", Model: "gpt-4o", Outcome: "success", RequestTokens: 100},
+	} {
+		if err := store.RecordUsage(context.Background(), rec); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+
+	totals, err := store.(ProviderModelSummer).SumUsageByProviderModel(context.Background(), UsageSumQuery{KeyID: "key-a", Since: now.Add(-24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("sum usage by provider model: %v", err)
+	}
+	if len(totals) != 2 || totals[0].Provider != "p1" || totals[1].Provider != "p2" {
+		t.Fatalf("unexpected totals %+v", totals)
+	}
+	if want := (UsageTotals{Requests: 2, RequestTokens: 30, ResponseTokens: 5}); totals[0].UsageTotals != want {
+		t.Fatalf("unexpected p1 totals %+v", totals[0].UsageTotals)
+	}
+
+	sum, err := store.SumUsage(context.Background(), UsageSumQuery{KeyID: "key-b"})
+	if err != nil || sum.RequestTokens != 100 {
+		t.Fatalf("expected only the usage of key-b, got %+v %v", sum, err)
+	}
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrTenantExists is returned by SaveTenant when a tenant with the same id is already stored.
+var ErrTenantExists = errors.New("tenant already exists")
+
+// TenantRecord is a tenant created at runtime. Spec holds the tenant definition as
+// JSON so that the storage layer stays independent of the config package.
+type TenantRecord struct {
+	ID        string          `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Spec      json.RawMessage `json:"spec"`
+}
+
+// TenantStore is implemented by stores that can persist tenants created at runtime.
+type TenantStore interface {
+	SaveTenant(ctx context.Context, tenant TenantRecord) error
+	ListTenants(ctx context.Context) ([]TenantRecord, error)
+}
+
+func (s *sqliteStore) SaveTenant(ctx context.Context, tenant TenantRecord) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if tenant.CreatedAt.IsZero() {
+		tenant.CreatedAt = time.Now()
+	}
+
+	var exists int
+	err := s.db.QueryRowContext(ctx, "SELECT 1 FROM tenants WHERE id = ?", tenant.ID).Scan(&exists)
+	if err == nil {
+		return ErrTenantExists
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("query tenant: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, "INSERT INTO tenants (id, created_at, spec) VALUES (?, ?, ?)",
+		tenant.ID, tenant.CreatedAt.UTC().Format(time.RFC3339Nano), string(tenant.Spec)); err != nil {
+		return fmt.Errorf("insert tenant: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) ListTenants(ctx context.Context) ([]TenantRecord, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT id, created_at, spec FROM tenants ORDER BY created_at, id")
+	if err != nil {
+		return nil, fmt.Errorf("query tenants: %w", err)
+	}
+	defer rows.Close()
+
+	var tenants []TenantRecord
+	for rows.Next() {
+		var (
+			tenant    TenantRecord
+			createdAt string
+			spec      string
+		)
+		if err := rows.Scan(&tenant.ID, &createdAt, &spec); err != nil {
+			return nil, fmt.Errorf("scan tenant: %w", err)
+		}
+		if parsed, err := time.Parse(time.RFC3339Nano, createdAt); err == nil {
+			tenant.CreatedAt = parsed
+		}
+		tenant.Spec = json.RawMessage(spec)
+		tenants = append(tenants, tenant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate tenants: %w", err)
+	}
+	return tenants, nil
+}
+
+func (f *fileStore) SaveTenant(_ context.Context, tenant TenantRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, existing := range f.tenants {
+		if existing.ID == tenant.ID {
+			return ErrTenantExists
+		}
+	}
+	if tenant.CreatedAt.IsZero() {
+		tenant.CreatedAt = time.Now()
+	}
+
+	data, err := json.Marshal(tenant)
+	if err != nil {
+		return fmt.Errorf("encode tenant: %w", err)
+	}
+	file, err := os.OpenFile(f.tenantPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open tenant store: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write tenant: %w", err)
+	}
+
+	f.tenants = append(f.tenants, tenant)
+	return nil
+}
+
+func (f *fileStore) ListTenants(_ context.Context) ([]TenantRecord, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	tenants := make([]TenantRecord, len(f.tenants))
+	copy(tenants, f.tenants)
+	return tenants, nil
+}
+
+func (f *fileStore) loadTenants() error {
+	file, err := os.OpenFile(f.tenantPath, os.O_RDONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("open tenant store: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var tenant TenantRecord
+		if err := json.Unmarshal([]byte(line), &tenant); err != nil {
+			return fmt.Errorf("decode tenant: %w", err)
+		}
+		f.tenants = append(f.tenants, tenant)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read tenants: %w", err)
+	}
+	return nil
+}
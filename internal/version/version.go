@@ -0,0 +1,28 @@
+package version
+
+import "runtime"
+
+// These values are injected at build time, e.g.
+//
+//	go build -ldflags "-X github.com/mylxsw/openai-cost-optimal-gateway/internal/version.Version=v1.2.3"
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+	BuildDate = "unknown"
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+func Get() Info {
+	return Info{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
@@ -0,0 +1,331 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// InspectionStats are the prompt inspection counters since the gateway started.
+type InspectionStats struct {
+	Inspected        int64            `json:"inspected"`
+	Detections       int64            `json:"detections"`
+	Blocked          int64            `json:"blocked"`
+	ClassifierErrors int64            `json:"classifier_errors"`
+	ByRule           map[string]int64 `json:"by_rule"`
+	ByModel          map[string]int64 `json:"by_model"`
+	BySource         map[string]int64 `json:"by_source"`
+}
+
+// ConfigDiff lists the routing changes of the configuration file on disk
+// against the running configuration.
+type ConfigDiff struct {
+	Path    string `json:"path"`
+	Changed bool   `json:"changed"`
+	// Diff holds the changes by kind, e.g. models_added
+	Diff json.RawMessage `json:"diff"`
+	// Summary describes each change in a line
+	Summary []string `json:"summary"`
+}
+
+// StateSnapshot is the effective configuration of a gateway with the tenants
+// onboarded through the API. It holds provider tokens and API keys.
+type StateSnapshot struct {
+	Version    string            `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Config     json.RawMessage   `json:"config"`
+	Tenants    []json.RawMessage `json:"tenants"`
+}
+
+// StateImport is the result of a state import.
+type StateImport struct {
+	DryRun   bool     `json:"dry_run"`
+	Imported []string `json:"imported"`
+	// Skipped are the tenants that already exist
+	Skipped []string `json:"skipped"`
+	// ConfigDiff and ConfigSummary describe how the snapshot configuration
+	// differs from the gateway's; the import applies it unless it is a dry run
+	ConfigDiff    json.RawMessage `json:"config_diff"`
+	ConfigSummary []string        `json:"config_summary"`
+	// ConfigApplied reports whether the snapshot configuration now serves requests
+	ConfigApplied bool `json:"config_applied"`
+}
+
+// Backup is a snapshot of the usage database kept on the gateway host.
+type Backup struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Alert is a published alert.
+type Alert struct {
+	ID        int64          `json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	EventID   string         `json:"event_id"`
+	Type      string         `json:"type"`
+	Severity  string         `json:"severity"`
+	Message   string         `json:"message"`
+	Provider  string         `json:"provider,omitempty"`
+	Model     string         `json:"model,omitempty"`
+	Tenant    string         `json:"tenant,omitempty"`
+	Key       string         `json:"key,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// AlertQuery filters the alert history. Zero values match everything; Limit
+// defaults to 100 on the gateway.
+type AlertQuery struct {
+	Since    time.Time
+	Until    time.Time
+	Type     string
+	Severity string
+	Provider string
+	Tenant   string
+	Limit    int
+}
+
+// AuditRecord is a state changing admin API call.
+type AuditRecord struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Actor is the masked API key that made the call
+	Actor  string         `json:"actor"`
+	Tenant string         `json:"tenant,omitempty"`
+	Method string         `json:"method"`
+	Path   string         `json:"path"`
+	Status int            `json:"status"`
+	Diff   map[string]any `json:"diff,omitempty"`
+}
+
+// AuditQuery filters the audit log. Zero values match everything; Limit
+// defaults to 100 on the gateway.
+type AuditQuery struct {
+	Since time.Time
+	Until time.Time
+	Actor string
+	// Path matches the calls to paths with this prefix
+	Path  string
+	Limit int
+}
+
+// TenantRequest onboards a tenant, configured from the named tenant template.
+type TenantRequest struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Template string `json:"template,omitempty"`
+	// Budget replaces the budget of the template, e.g. {"monthly_cost": 100}
+	Budget json.RawMessage `json:"budget,omitempty"`
+}
+
+// Tenant is an onboarded tenant with its first API key, returned only once.
+type Tenant struct {
+	// Tenant is the configuration of the tenant
+	Tenant json.RawMessage `json:"tenant"`
+	APIKey string          `json:"api_key"`
+}
+
+// RoutePreview is a request body to route, meant for Path; Path defaults to
+// /v1/chat/completions.
+type RoutePreview struct {
+	Path string
+	Body json.RawMessage
+}
+
+// RoutePlan describes how the gateway would route a request.
+type RoutePlan struct {
+	// Model is the requested model, ResolvedModel the one routed after
+	// deprecations and aliases
+	Model         string `json:"model"`
+	ResolvedModel string `json:"resolved_model"`
+	// Route is model, group, discovered or default
+	Route string `json:"route"`
+	// Rule is the expression of the matching rule; empty when the default
+	// provider order applies
+	Rule       string `json:"rule,omitempty"`
+	TokenCount int    `json:"token_count"`
+	// Providers are the candidates in the order they would be tried
+	Providers []PlannedProvider `json:"providers"`
+	// Unsupported lists the capabilities that ruled out candidates
+	Unsupported []string `json:"unsupported,omitempty"`
+}
+
+// PlannedProvider is a candidate of a RoutePlan.
+type PlannedProvider struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+}
+
+// LogLevel returns the log level of the gateway.
+func (c *Client) LogLevel(ctx context.Context) (string, error) {
+	var resp struct {
+		Level string `json:"level"`
+	}
+	if err := c.getJSON(ctx, "/admin/loglevel", nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Level, nil
+}
+
+// SetLogLevel switches the log level to debug, info, warn or error.
+func (c *Client) SetLogLevel(ctx context.Context, level string) error {
+	return c.doJSON(ctx, http.MethodPut, "/admin/loglevel", nil, map[string]string{"level": level}, nil)
+}
+
+// InspectionStats returns the prompt inspection counters.
+func (c *Client) InspectionStats(ctx context.Context) (*InspectionStats, error) {
+	var stats InspectionStats
+	if err := c.getJSON(ctx, "/admin/inspection", nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// ConfigDiff returns the routing changes a restart would apply.
+func (c *Client) ConfigDiff(ctx context.Context) (*ConfigDiff, error) {
+	var diff ConfigDiff
+	if err := c.getJSON(ctx, "/admin/config/diff", nil, &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// ExportState returns the effective configuration and the onboarded tenants.
+func (c *Client) ExportState(ctx context.Context) (*StateSnapshot, error) {
+	var snapshot StateSnapshot
+	if err := c.getJSON(ctx, "/admin/state", nil, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// ImportState registers the tenants of a snapshot that do not exist yet; with
+// dryRun it only reports them.
+func (c *Client) ImportState(ctx context.Context, snapshot *StateSnapshot, dryRun bool) (*StateImport, error) {
+	var result StateImport
+	query := url.Values{"dry_run": {strconv.FormatBool(dryRun)}}
+	if err := c.doJSON(ctx, http.MethodPost, "/admin/state", query, snapshot, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Backup snapshots the usage database into the backup directory of the
+// gateway under name.
+func (c *Client) Backup(ctx context.Context, name string) (*Backup, error) {
+	if name == "" {
+		return nil, errors.New("backup name is required, use DownloadBackup to receive the snapshot")
+	}
+	var backup Backup
+	if err := c.doJSON(ctx, http.MethodPost, "/admin/backup", nil, map[string]string{"name": name}, &backup); err != nil {
+		return nil, err
+	}
+	return &backup, nil
+}
+
+// DownloadBackup snapshots the usage database and writes it to w.
+func (c *Client) DownloadBackup(ctx context.Context, w io.Writer) error {
+	return c.download(ctx, http.MethodPost, "/admin/backup", bytes.NewReader([]byte("{}")), w)
+}
+
+// Alerts returns the alert history, newest first.
+func (c *Client) Alerts(ctx context.Context, q AlertQuery) ([]Alert, error) {
+	query := setQuery(url.Values{}, map[string]string{
+		"type": q.Type, "severity": q.Severity, "provider": q.Provider, "tenant": q.Tenant,
+		"since": formatTime(q.Since), "until": formatTime(q.Until), "limit": formatLimit(q.Limit),
+	})
+	var resp struct {
+		Data []Alert `json:"data"`
+	}
+	if err := c.getJSON(ctx, "/admin/alerts", query, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Audit returns the audit log of admin API calls, newest first.
+func (c *Client) Audit(ctx context.Context, q AuditQuery) ([]AuditRecord, error) {
+	query := setQuery(url.Values{}, map[string]string{
+		"actor": q.Actor, "path": q.Path,
+		"since": formatTime(q.Since), "until": formatTime(q.Until), "limit": formatLimit(q.Limit),
+	})
+	var resp struct {
+		Data []AuditRecord `json:"data"`
+	}
+	if err := c.getJSON(ctx, "/admin/audit", query, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// CreateTenant onboards a tenant and returns its first API key.
+func (c *Client) CreateTenant(ctx context.Context, req TenantRequest) (*Tenant, error) {
+	var tenant Tenant
+	if err := c.doJSON(ctx, http.MethodPost, "/admin/tenants", nil, req, &tenant); err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// ExportTenant writes a snapshot of the usage data of a tenant to w.
+func (c *Client) ExportTenant(ctx context.Context, id string, w io.Writer) error {
+	return c.download(ctx, http.MethodGet, "/admin/tenants/"+url.PathEscape(id)+"/export", nil, w)
+}
+
+// DeleteTenantData deletes the usage records and request logs of a tenant.
+func (c *Client) DeleteTenantData(ctx context.Context, id string) error {
+	return c.doJSON(ctx, http.MethodDelete, "/admin/tenants/"+url.PathEscape(id)+"/data", nil, nil, nil)
+}
+
+// PreviewRoute returns the rule and provider order a request body would be
+// routed with, without sending it.
+func (c *Client) PreviewRoute(ctx context.Context, preview RoutePreview) (*RoutePlan, error) {
+	query := setQuery(url.Values{}, map[string]string{"path": preview.Path})
+	resp, err := c.send(ctx, http.MethodPost, "/admin/route/preview", query, bytes.NewReader(preview.Body), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var plan RoutePlan
+	if err := json.NewDecoder(resp.Body).Decode(&plan); err != nil {
+		return nil, fmt.Errorf("decode route preview: %w", err)
+	}
+	return &plan, nil
+}
+
+// download copies a response body to w. Downloads outlive any client timeout.
+func (c *Client) download(ctx context.Context, method, path string, body io.Reader, w io.Writer) error {
+	contentType := ""
+	if body != nil {
+		contentType = "application/json"
+	}
+	resp, err := c.sendWith(ctx, &http.Client{Transport: c.HTTPClient.Transport}, method, path, nil, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("download %s: %w", path, err)
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatLimit(limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	return strconv.Itoa(limit)
+}
@@ -0,0 +1,185 @@
+// Package client is a Go client for the management APIs of the gateway: usage
+// records and events, the admin endpoints, tenant onboarding and route
+// previews.
+//
+//	c := client.New("http://127.0.0.1:8000", os.Getenv("GATEWAY_API_KEY"))
+//	usage, err := c.Usage(ctx, client.UsageQuery{Limit: 100})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client calls a gateway with an API key. Usage endpoints need a key with the
+// read-usage or admin role, the others an admin key.
+type Client struct {
+	baseURL string
+	apiKey  string
+	// HTTPClient sends the requests; streams ignore its timeout and last
+	// until their context is done
+	HTTPClient *http.Client
+}
+
+// New returns a client for the gateway at baseURL, e.g. http://127.0.0.1:8000.
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// APIError is a response of the gateway with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gateway returned %d: %s", e.StatusCode, e.Message)
+}
+
+// VersionInfo describes the build of the gateway.
+type VersionInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Model is a model, alias or group served by the gateway.
+type Model struct {
+	ID         string `json:"id"`
+	Object     string `json:"object"`
+	Created    int64  `json:"created"`
+	OwnedBy    string `json:"owned_by"`
+	Discovered bool   `json:"discovered,omitempty"`
+}
+
+// Version returns the build of the gateway.
+func (c *Client) Version(ctx context.Context) (*VersionInfo, error) {
+	var info VersionInfo
+	if err := c.getJSON(ctx, "/version", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Ready returns nil when the gateway can serve traffic, or the reason it
+// cannot as an *APIError.
+func (c *Client) Ready(ctx context.Context) error {
+	resp, err := c.send(ctx, http.MethodGet, "/readyz", nil, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Models lists the models the API key may use.
+func (c *Client) Models(ctx context.Context) ([]Model, error) {
+	var list struct {
+		Data []Model `json:"data"`
+	}
+	if err := c.getJSON(ctx, "/v1/models", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Data, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, out any) error {
+	return c.doJSON(ctx, http.MethodGet, path, query, nil, out)
+}
+
+// doJSON sends in as the JSON body, when not nil, and decodes the response
+// into out, when not nil.
+func (c *Client) doJSON(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+	resp, err := c.send(ctx, method, path, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s response: %w", path, err)
+	}
+	return nil
+}
+
+// send returns the response of a request, or an *APIError for a non-2xx
+// status. The caller closes the body.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	return c.sendWith(ctx, c.HTTPClient, method, path, query, body, contentType)
+}
+
+func (c *Client) sendWith(ctx context.Context, httpClient *http.Client, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: errorMessage(message)}
+	}
+	return resp, nil
+}
+
+// errorMessage returns the message of a JSON error response of the gateway,
+// or the trimmed body when it is not one.
+func errorMessage(body []byte) string {
+	var payload struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Error.Message != "" {
+		return payload.Error.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// setQuery sets the non-empty values of a query.
+func setQuery(query url.Values, values map[string]string) url.Values {
+	for name, value := range values {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	return query
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUsageSendsQueryAndKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/usage" || r.URL.Query().Get("limit") != "5" || r.URL.Query().Get("tenant") != "team-a" || r.URL.Query().Get("key_name") != "batch-jobs" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		if r.Header.Get("Authorization") != "Bearer sk-test" {
+			t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+		_, _ = io.WriteString(w, `{"data":[{"request_id":"req-1","key_name":"batch-jobs","status":"success","duration":1500000000,"request_tokens":7}],"summary":{"total_requests":1}}`)
+	}))
+	defer srv.Close()
+
+	usage, err := New(srv.URL+"/", "sk-test").Usage(context.Background(), UsageQuery{Limit: 5, Tenant: "team-a", KeyName: "batch-jobs"})
+	if err != nil {
+		t.Fatalf("usage: %v", err)
+	}
+	if len(usage.Data) != 1 || usage.Data[0].RequestID != "req-1" || usage.Data[0].KeyName != "batch-jobs" || usage.Data[0].Duration != 1500*time.Millisecond || usage.Summary.TotalRequests != 1 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":{"message":"forbidden","type":"permission_error","code":"permission_denied"}}`))
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, "sk-test").InspectionStats(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden || apiErr.Message != "forbidden" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestStreamUsage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("provider") != "openai" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, ": keep-alive\n\n")
+		for i := 1; i <= 3; i++ {
+			_, _ = fmt.Fprintf(w, "event: usage\ndata: {\"request_id\":\"req-%d\",\"provider\":\"openai\"}\n\n", i)
+		}
+	}))
+	defer srv.Close()
+
+	stop := errors.New("stop")
+	var ids []string
+	err := New(srv.URL, "sk-test").StreamUsage(context.Background(), UsageEventFilter{Provider: "openai"}, func(record UsageRecord) error {
+		ids = append(ids, record.RequestID)
+		if len(ids) == 2 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || len(ids) != 2 || ids[1] != "req-2" {
+		t.Fatalf("unexpected result %v %v", err, ids)
+	}
+}
+
+func TestPreviewRoute(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.URL.Query().Get("path") != "/v1/messages" || string(body) != `{"model":"claude"}` {
+			t.Errorf("unexpected request %s %s %s", r.Method, r.URL, body)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"model": "claude", "resolved_model": "claude", "route": "model", "token_count": 3,
+			"providers": []map[string]string{{"provider": "anthropic", "model": "claude-sonnet"}},
+		})
+	}))
+	defer srv.Close()
+
+	plan, err := New(srv.URL, "sk-test").PreviewRoute(context.Background(), RoutePreview{Path: "/v1/messages", Body: json.RawMessage(`{"model":"claude"}`)})
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if plan.Route != "model" || len(plan.Providers) != 1 || plan.Providers[0].Model != "claude-sonnet" {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+}
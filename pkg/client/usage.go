@@ -0,0 +1,150 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// UsageRecord is a provider attempt, or a request blocked before any.
+type UsageRecord struct {
+	ID                int64         `json:"id"`
+	CreatedAt         time.Time     `json:"created_at"`
+	Path              string        `json:"path"`
+	Provider          string        `json:"provider"`
+	Model             string        `json:"model"`
+	OriginalModel     string        `json:"original_model"`
+	ProviderRequestID string        `json:"provider_request_id"`
+	RequestID         string        `json:"request_id"`
+	Tenant            string        `json:"tenant,omitempty"`
+	Route             string        `json:"route,omitempty"`
+	Moderation        string        `json:"moderation,omitempty"`
+	KeyID             string        `json:"key_id,omitempty"`
+	KeyName           string        `json:"key_name,omitempty"`
+	Attempt           int           `json:"attempt"`
+	RequestTokens     int           `json:"request_tokens"`
+	ResponseTokens    int           `json:"response_tokens"`
+	StatusCode        int           `json:"status_code"`
+	Outcome           string        `json:"status"`
+	Duration          time.Duration `json:"duration"`
+	FirstTokenLatency time.Duration `json:"first_token_latency"`
+	Error             string        `json:"error,omitempty"`
+}
+
+// UsageSummary totals the records of a usage query.
+type UsageSummary struct {
+	TotalRequests         int `json:"total_requests"`
+	TotalPromptTokens     int `json:"total_prompt_tokens"`
+	TotalCompletionTokens int `json:"total_completion_tokens"`
+}
+
+// UsageResponse is the result of a usage query, newest records first.
+type UsageResponse struct {
+	Data    []UsageRecord `json:"data"`
+	Summary UsageSummary  `json:"summary"`
+}
+
+// UsageQuery filters usage records. Zero values match everything; Limit
+// defaults to 100 on the gateway.
+type UsageQuery struct {
+	Limit     int
+	RequestID string
+	// Tenant is ignored for tenant keys, which only see their own records
+	Tenant string
+	// KeyID is the digest of an API key as found in usage records
+	KeyID   string
+	KeyName string
+}
+
+// RequestLog is a stored request body with its headers.
+type RequestLog struct {
+	ID        int64               `json:"id"`
+	CreatedAt time.Time           `json:"created_at"`
+	RequestID string              `json:"request_id"`
+	Method    string              `json:"method"`
+	Path      string              `json:"path"`
+	Headers   map[string][]string `json:"headers"`
+	Body      string              `json:"body"`
+	Meta      map[string]string   `json:"meta,omitempty"`
+	Tags      map[string]string   `json:"tags,omitempty"`
+	Extra     map[string]any      `json:"extra,omitempty"`
+}
+
+// UsageEventFilter selects the streamed usage events. Zero values match
+// everything.
+type UsageEventFilter struct {
+	// Model matches the requested or the provider model
+	Model    string
+	Provider string
+	Tenant   string
+}
+
+// Usage returns the latest usage records.
+func (c *Client) Usage(ctx context.Context, q UsageQuery) (*UsageResponse, error) {
+	query := setQuery(url.Values{}, map[string]string{"request_id": q.RequestID, "tenant": q.Tenant, "key_id": q.KeyID, "key_name": q.KeyName, "limit": formatLimit(q.Limit)})
+	var usage UsageResponse
+	if err := c.getJSON(ctx, "/usage", query, &usage); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// RequestDetail returns the stored request log of a request.
+func (c *Client) RequestDetail(ctx context.Context, requestID string) (*RequestLog, error) {
+	var entry RequestLog
+	if err := c.getJSON(ctx, "/usage/request_detail", url.Values{"request_id": {requestID}}, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// StreamUsage calls handle with the usage record of each request as it
+// completes, until ctx is done, handle returns an error or the gateway closes
+// the stream. The error of handle is returned unchanged.
+func (c *Client) StreamUsage(ctx context.Context, filter UsageEventFilter, handle func(UsageRecord) error) error {
+	query := setQuery(url.Values{}, map[string]string{"model": filter.Model, "provider": filter.Provider, "tenant": filter.Tenant})
+	// The stream outlives any client timeout.
+	streamClient := &http.Client{Transport: c.HTTPClient.Transport}
+	resp, err := c.sendWith(ctx, streamClient, http.MethodGet, "/usage/events", query, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	event, data := "", ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event == "usage" && data != "" {
+				var record UsageRecord
+				if err := json.Unmarshal([]byte(data), &record); err != nil {
+					return fmt.Errorf("decode usage event: %w", err)
+				}
+				if err := handle(record); err != nil {
+					return err
+				}
+			}
+			event, data = "", ""
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read usage events: %w", err)
+	}
+	return errors.New("usage event stream closed by the gateway")
+}